@@ -32,6 +32,7 @@ import (
 	"istio.io/istio/galley/pkg/config/analysis/analyzers/destinationrule"
 	"istio.io/istio/galley/pkg/config/analysis/analyzers/gateway"
 	"istio.io/istio/galley/pkg/config/analysis/analyzers/injection"
+	"istio.io/istio/galley/pkg/config/analysis/analyzers/memberroll"
 	"istio.io/istio/galley/pkg/config/analysis/analyzers/multicluster"
 	"istio.io/istio/galley/pkg/config/analysis/analyzers/service"
 	"istio.io/istio/galley/pkg/config/analysis/analyzers/sidecar"
@@ -294,6 +295,41 @@ var testGrid = []testCase{
 			{msg.InvalidRegexp, "VirtualService lots-of-regexes"},
 		},
 	},
+	{
+		name:       "memberRollGatewayWorkloads",
+		inputFiles: []string{"testdata/memberroll.yaml"},
+		analyzer:   &memberroll.GatewayAnalyzer{},
+		expected: []message{
+			{msg.GatewayWorkloadNotInMemberRoll, "Gateway bookinfo-gateway.bookinfo"},
+		},
+	},
+	{
+		name:       "memberRollHosts",
+		inputFiles: []string{"testdata/memberroll.yaml"},
+		analyzer:   &memberroll.HostAnalyzer{},
+		expected: []message{
+			{msg.ReferencedHostNotInMemberRoll, "VirtualService bookinfo-routes.bookinfo"},
+			{msg.ReferencedHostNotInMemberRoll, "VirtualService bookinfo-routes.bookinfo"},
+			{msg.ReferencedHostNotInMemberRoll, "DestinationRule reviews-foreign.bookinfo"},
+		},
+	},
+	{
+		name:       "memberRollNamespaces",
+		inputFiles: []string{"testdata/memberroll.yaml"},
+		analyzer:   &memberroll.NamespaceAnalyzer{},
+		expected: []message{
+			{msg.NamespaceNotInMemberRoll, "VirtualService reviews.unmanaged"},
+			{msg.NamespaceNotInMemberRoll, "DestinationRule reviews.unmanaged"},
+		},
+	},
+	{
+		name:       "memberRollNamespacesWithoutMemberRoll",
+		inputFiles: []string{"testdata/virtualservice_destinationhosts.yaml"},
+		analyzer:   &memberroll.NamespaceAnalyzer{},
+		expected:   []message{
+			// no messages, analysis is skipped if there is no member roll
+		},
+	},
 	{
 		name: "unknown service registry in mesh networks",
 		inputFiles: []string{
@@ -0,0 +1,95 @@
+// Copyright Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memberroll
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	k8s_labels "k8s.io/apimachinery/pkg/labels"
+
+	"istio.io/api/networking/v1alpha3"
+	"istio.io/istio/galley/pkg/config/analysis"
+	"istio.io/istio/galley/pkg/config/analysis/analyzers/util"
+	"istio.io/istio/galley/pkg/config/analysis/msg"
+	"istio.io/istio/pkg/config/resource"
+	"istio.io/istio/pkg/config/schema/collection"
+	"istio.io/istio/pkg/config/schema/collections"
+)
+
+// GatewayAnalyzer checks that the workloads selected by a Gateway are in
+// namespaces of the same mesh as the Gateway
+type GatewayAnalyzer struct{}
+
+var _ analysis.Analyzer = &GatewayAnalyzer{}
+
+// Metadata implements analysis.Analyzer
+func (*GatewayAnalyzer) Metadata() analysis.Metadata {
+	return analysis.Metadata{
+		Name:        "memberroll.GatewayAnalyzer",
+		Description: "Checks that the workloads selected by a Gateway are in member namespaces of the same mesh",
+		Inputs: collection.Names{
+			collections.K8SMaistraIoV1Servicemeshmemberrolls.Name(),
+			collections.IstioNetworkingV1Alpha3Gateways.Name(),
+			collections.K8SCoreV1Pods.Name(),
+		},
+	}
+}
+
+// Analyze implements analysis.Analyzer
+func (*GatewayAnalyzer) Analyze(c analysis.Context) {
+	meshes, found := getMeshes(c)
+	if !found {
+		return
+	}
+
+	c.ForEach(collections.IstioNetworkingV1Alpha3Gateways.Name(), func(r *resource.Instance) bool {
+		controlPlane, ok := meshes.controlPlane(r.Metadata.FullName.Namespace)
+		if !ok {
+			return true
+		}
+		gw := r.Message.(*v1alpha3.Gateway)
+		if len(gw.Selector) == 0 {
+			return true
+		}
+		gwSelector := k8s_labels.SelectorFromSet(gw.Selector)
+
+		// report each foreign namespace once, in the order the pods are visited
+		reported := map[string]struct{}{}
+		c.ForEach(collections.K8SCoreV1Pods.Name(), func(rPod *resource.Instance) bool {
+			pod := rPod.Message.(*v1.Pod)
+			if !gwSelector.Matches(k8s_labels.Set(pod.ObjectMeta.Labels)) {
+				return true
+			}
+			podNs := rPod.Metadata.FullName.Namespace
+			if podControlPlane, ok := meshes.controlPlane(podNs); ok && podControlPlane == controlPlane {
+				return true
+			}
+			if _, ok := reported[string(podNs)]; ok {
+				return true
+			}
+			reported[string(podNs)] = struct{}{}
+
+			m := msg.NewGatewayWorkloadNotInMemberRoll(r, gwSelector.String(), string(podNs), string(controlPlane))
+			label := util.ExtractLabelFromSelectorString(gwSelector.String())
+			if line, ok := util.ErrorLine(r, fmt.Sprintf(util.GatewaySelector, label)); ok {
+				m.Line = line
+			}
+			c.Report(collections.IstioNetworkingV1Alpha3Gateways.Name(), m)
+			return true
+		})
+		return true
+	})
+}
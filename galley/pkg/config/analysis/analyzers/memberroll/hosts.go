@@ -0,0 +1,115 @@
+// Copyright Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memberroll
+
+import (
+	"fmt"
+
+	"istio.io/api/networking/v1alpha3"
+	"istio.io/istio/galley/pkg/config/analysis"
+	"istio.io/istio/galley/pkg/config/analysis/analyzers/util"
+	"istio.io/istio/galley/pkg/config/analysis/msg"
+	"istio.io/istio/pkg/config/resource"
+	"istio.io/istio/pkg/config/schema/collection"
+	"istio.io/istio/pkg/config/schema/collections"
+)
+
+// HostAnalyzer checks that the service hosts referenced by VirtualServices and
+// DestinationRules are in namespaces of the same mesh as the referencing resource
+type HostAnalyzer struct{}
+
+var _ analysis.Analyzer = &HostAnalyzer{}
+
+// Metadata implements analysis.Analyzer
+func (*HostAnalyzer) Metadata() analysis.Metadata {
+	return analysis.Metadata{
+		Name:        "memberroll.HostAnalyzer",
+		Description: "Checks that hosts referenced by VirtualServices and DestinationRules are in member namespaces of the same mesh",
+		Inputs: collection.Names{
+			collections.K8SMaistraIoV1Servicemeshmemberrolls.Name(),
+			collections.IstioNetworkingV1Alpha3Destinationrules.Name(),
+			collections.IstioNetworkingV1Alpha3Virtualservices.Name(),
+		},
+	}
+}
+
+// Analyze implements analysis.Analyzer
+func (a *HostAnalyzer) Analyze(c analysis.Context) {
+	meshes, found := getMeshes(c)
+	if !found {
+		return
+	}
+
+	c.ForEach(collections.IstioNetworkingV1Alpha3Virtualservices.Name(), func(r *resource.Instance) bool {
+		vs := r.Message.(*v1alpha3.VirtualService)
+		for _, host := range vs.GetHosts() {
+			a.checkHost(c, meshes, collections.IstioNetworkingV1Alpha3Virtualservices.Name(), r, host, "")
+		}
+		for i, route := range vs.GetHttp() {
+			for j, rd := range route.GetRoute() {
+				a.checkHost(c, meshes, collections.IstioNetworkingV1Alpha3Virtualservices.Name(), r, rd.GetDestination().GetHost(),
+					fmt.Sprintf(util.DestinationHost, "http", i, j))
+			}
+			if mirror := route.GetMirror(); mirror != nil {
+				a.checkHost(c, meshes, collections.IstioNetworkingV1Alpha3Virtualservices.Name(), r, mirror.GetHost(),
+					fmt.Sprintf(util.MirrorHost, i))
+			}
+		}
+		for i, route := range vs.GetTls() {
+			for j, rd := range route.GetRoute() {
+				a.checkHost(c, meshes, collections.IstioNetworkingV1Alpha3Virtualservices.Name(), r, rd.GetDestination().GetHost(),
+					fmt.Sprintf(util.DestinationHost, "tls", i, j))
+			}
+		}
+		for i, route := range vs.GetTcp() {
+			for j, rd := range route.GetRoute() {
+				a.checkHost(c, meshes, collections.IstioNetworkingV1Alpha3Virtualservices.Name(), r, rd.GetDestination().GetHost(),
+					fmt.Sprintf(util.DestinationHost, "tcp", i, j))
+			}
+		}
+		return true
+	})
+
+	c.ForEach(collections.IstioNetworkingV1Alpha3Destinationrules.Name(), func(r *resource.Instance) bool {
+		dr := r.Message.(*v1alpha3.DestinationRule)
+		a.checkHost(c, meshes, collections.IstioNetworkingV1Alpha3Destinationrules.Name(), r, dr.GetHost(), "")
+		return true
+	})
+}
+
+// checkHost reports the host if it is a Kubernetes service in a namespace
+// outside the mesh of the resource. Resources that are not in any mesh are
+// reported by the NamespaceAnalyzer.
+func (*HostAnalyzer) checkHost(c analysis.Context, meshes meshes, col collection.Name, r *resource.Instance, host, path string) {
+	controlPlane, ok := meshes.controlPlane(r.Metadata.FullName.Namespace)
+	if !ok || host == "" {
+		return
+	}
+	hostNs := util.GetFullNameFromFQDN(util.ConvertHostToFQDN(r.Metadata.FullName.Namespace, host)).Namespace
+	if hostNs == "" {
+		// not a Kubernetes service
+		return
+	}
+	if hostControlPlane, ok := meshes.controlPlane(hostNs); ok && hostControlPlane == controlPlane {
+		return
+	}
+	m := msg.NewReferencedHostNotInMemberRoll(r, host, string(hostNs), string(controlPlane))
+	if path != "" {
+		if line, ok := util.ErrorLine(r, path); ok {
+			m.Line = line
+		}
+	}
+	c.Report(col, m)
+}
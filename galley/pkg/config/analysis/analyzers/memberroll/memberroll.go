@@ -0,0 +1,69 @@
+// Copyright Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memberroll
+
+import (
+	"github.com/gogo/protobuf/types"
+
+	"istio.io/istio/galley/pkg/config/analysis"
+	"istio.io/istio/pkg/config/resource"
+	"istio.io/istio/pkg/config/schema/collections"
+)
+
+// memberRollName is the name of the ServiceMeshMemberRoll of a control plane,
+// member rolls with other names are ignored by istiod
+const memberRollName = "default"
+
+// meshes maps the namespaces of all meshes in the cluster to the namespace
+// of the control plane whose ServiceMeshMemberRoll includes them
+type meshes map[resource.Namespace]resource.Namespace
+
+// getMeshes returns the namespaces of the meshes defined by the
+// ServiceMeshMemberRolls named default. Like istiod, only the members the
+// operator configured are taken into account, as listed in the status of the
+// member roll. The namespace of a member roll is always part of its mesh. If
+// there are no member rolls, the cluster is not multi-tenant and false is
+// returned.
+func getMeshes(c analysis.Context) (meshes, bool) {
+	m := meshes{}
+	found := false
+	c.ForEach(collections.K8SMaistraIoV1Servicemeshmemberrolls.Name(), func(r *resource.Instance) bool {
+		if r.Metadata.FullName.Name != memberRollName {
+			return true
+		}
+		found = true
+		controlPlane := r.Metadata.FullName.Namespace
+		m[controlPlane] = controlPlane
+		memberRoll, ok := r.Message.(*types.Struct)
+		if !ok {
+			return true
+		}
+		status := memberRoll.GetFields()["status"].GetStructValue()
+		for _, member := range status.GetFields()["configuredMembers"].GetListValue().GetValues() {
+			if ns := member.GetStringValue(); ns != "" {
+				m[resource.Namespace(ns)] = controlPlane
+			}
+		}
+		return true
+	})
+	return m, found
+}
+
+// controlPlane returns the namespace of the control plane that manages the
+// given namespace
+func (m meshes) controlPlane(ns resource.Namespace) (resource.Namespace, bool) {
+	controlPlane, ok := m[ns]
+	return controlPlane, ok
+}
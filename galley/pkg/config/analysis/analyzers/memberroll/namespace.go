@@ -0,0 +1,74 @@
+// Copyright Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memberroll
+
+import (
+	"istio.io/istio/galley/pkg/config/analysis"
+	"istio.io/istio/galley/pkg/config/analysis/analyzers/util"
+	"istio.io/istio/galley/pkg/config/analysis/msg"
+	"istio.io/istio/pkg/config/resource"
+	"istio.io/istio/pkg/config/schema/collection"
+	"istio.io/istio/pkg/config/schema/collections"
+)
+
+// NamespaceAnalyzer checks that Istio configuration is in namespaces that are
+// members of a ServiceMeshMemberRoll, as the control plane ignores it otherwise
+type NamespaceAnalyzer struct{}
+
+var _ analysis.Analyzer = &NamespaceAnalyzer{}
+
+// memberCollections are the collections whose resources are only processed by
+// the control plane if they are in a member namespace
+var memberCollections = collection.Names{
+	collections.IstioNetworkingV1Alpha3Destinationrules.Name(),
+	collections.IstioNetworkingV1Alpha3Envoyfilters.Name(),
+	collections.IstioNetworkingV1Alpha3Gateways.Name(),
+	collections.IstioNetworkingV1Alpha3Serviceentries.Name(),
+	collections.IstioNetworkingV1Alpha3Sidecars.Name(),
+	collections.IstioNetworkingV1Alpha3Virtualservices.Name(),
+	collections.IstioSecurityV1Beta1Authorizationpolicies.Name(),
+}
+
+// Metadata implements analysis.Analyzer
+func (*NamespaceAnalyzer) Metadata() analysis.Metadata {
+	return analysis.Metadata{
+		Name:        "memberroll.NamespaceAnalyzer",
+		Description: "Checks that Istio configuration is in namespaces that are members of a ServiceMeshMemberRoll",
+		Inputs:      append(collection.Names{collections.K8SMaistraIoV1Servicemeshmemberrolls.Name()}, memberCollections...),
+	}
+}
+
+// Analyze implements analysis.Analyzer
+func (*NamespaceAnalyzer) Analyze(c analysis.Context) {
+	meshes, found := getMeshes(c)
+	if !found {
+		return
+	}
+	for _, col := range memberCollections {
+		col := col
+		c.ForEach(col, func(r *resource.Instance) bool {
+			ns := r.Metadata.FullName.Namespace
+			if _, ok := meshes.controlPlane(ns); ok {
+				return true
+			}
+			m := msg.NewNamespaceNotInMemberRoll(r, string(ns))
+			if line, ok := util.ErrorLine(r, util.MetadataNamespace); ok {
+				m.Line = line
+			}
+			c.Report(col, m)
+			return true
+		})
+	}
+}
@@ -327,6 +327,31 @@ func (sa *SourceAnalyzer) AddFileKubeMeshNetworks(file string) error {
 	return nil
 }
 
+// AddFileKubeMemberRoll adds the ServiceMeshMemberRoll from the specified yaml file to the analyzer.
+// Member rolls without a namespace are assumed to be in the Istio namespace. Other resources in the file are ignored.
+// The member roll takes precedence over a member roll with the same name from a previously added source.
+func (sa *SourceAnalyzer) AddFileKubeMemberRoll(file string) error {
+	by, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	s, found := sa.kubeResources.Find(collections.K8SMaistraIoV1Servicemeshmemberrolls.Name().String())
+	if !found {
+		// none of the analyzers uses the member roll
+		return nil
+	}
+
+	src := kube_inmemory.NewKubeSource(collection.SchemasFor(s))
+	src.SetDefaultNamespace(sa.istioNamespace)
+	if err := src.ApplyContent(file, string(by)); err != nil {
+		return err
+	}
+
+	sa.sources = append(sa.sources, precedenceSourceInput{src: src, cols: collection.Names{s.Name()}})
+	return nil
+}
+
 // AddDefaultResources adds some basic dummy Istio resources, based on mesh configuration.
 // This is useful for files-only analysis cases where we don't expect the user to be including istio system resources
 // and don't want to generate false positives because they aren't there.
@@ -39,6 +39,7 @@ import (
 	"istio.io/istio/pkg/config/resource"
 	"istio.io/istio/pkg/config/schema"
 	"istio.io/istio/pkg/config/schema/collection"
+	"istio.io/istio/pkg/config/schema/collections"
 )
 
 type testAnalyzer struct {
@@ -220,6 +221,49 @@ func TestAddReaderKubeSource(t *testing.T) {
 	g.Expect(sa.meshCfg.RootNamespace).To(Equal(testRootNamespace)) // Should be mesh config from the file now
 }
 
+func TestAddFileKubeMemberRoll(t *testing.T) {
+	g := NewWithT(t)
+
+	cancel := make(chan struct{})
+
+	var memberRolls []resource.FullName
+	a := &testAnalyzer{
+		fn: func(ctx analysis.Context) {
+			ctx.ForEach(collections.K8SMaistraIoV1Servicemeshmemberrolls.Name(), func(r *resource.Instance) bool {
+				memberRolls = append(memberRolls, r.Metadata.FullName)
+				return true
+			})
+		},
+		inputs: collection.Names{collections.K8SMaistraIoV1Servicemeshmemberrolls.Name()},
+	}
+
+	sa := NewSourceAnalyzer(schema.MustGet(), analysis.Combine("a", a), "default", "istio-system", nil, false, timeout)
+	err := sa.AddReaderKubeSource(nil)
+	g.Expect(err).To(BeNil())
+
+	tmpfile := tempFileFromString(t, kubeyaml.JoinString(data.YamlN1I1V1, `
+apiVersion: maistra.io/v1
+kind: ServiceMeshMemberRoll
+metadata:
+  name: default
+spec:
+  members:
+  - bookinfo
+`))
+	defer func() { _ = os.Remove(tmpfile.Name()) }()
+
+	err = sa.AddFileKubeMemberRoll(tmpfile.Name())
+	g.Expect(err).To(BeNil())
+	g.Expect(sa.sources).To(HaveLen(2))
+
+	_, err = sa.Analyze(cancel)
+	g.Expect(err).To(BeNil())
+	g.Expect(memberRolls).To(ConsistOf(resource.NewFullName("istio-system", "default")))
+
+	err = sa.AddFileKubeMemberRoll("nonexistent.yaml")
+	g.Expect(err).To(Not(BeNil()))
+}
+
 func TestAddReaderKubeSourceSkipsBadEntries(t *testing.T) {
 	g := NewWithT(t)
 
@@ -120,6 +120,18 @@ var (
 	// VirtualServiceIneffectiveMatch defines a diag.MessageType for message "VirtualServiceIneffectiveMatch".
 	// Description: A VirtualService rule match duplicates a match in a previous rule.
 	VirtualServiceIneffectiveMatch = diag.NewMessageType(diag.Info, "IST0131", "VirtualService rule %v match %v is not used (duplicates a match in rule %v).")
+
+	// NamespaceNotInMemberRoll defines a diag.MessageType for message "NamespaceNotInMemberRoll".
+	// Description: A resource is in a namespace that is not a member of any ServiceMeshMemberRoll, so it is ignored by the control plane.
+	NamespaceNotInMemberRoll = diag.NewMessageType(diag.Warning, "IST0132", "The resource is in namespace %s, which is not a member of any ServiceMeshMemberRoll. It is ignored by the control plane.")
+
+	// ReferencedHostNotInMemberRoll defines a diag.MessageType for message "ReferencedHostNotInMemberRoll".
+	// Description: A host refers to a namespace that is not a member of the mesh of the referencing resource.
+	ReferencedHostNotInMemberRoll = diag.NewMessageType(diag.Warning, "IST0133", "Host %s refers to namespace %s, which is not a member of the mesh of control plane %s.")
+
+	// GatewayWorkloadNotInMemberRoll defines a diag.MessageType for message "GatewayWorkloadNotInMemberRoll".
+	// Description: A Gateway selects workloads in a namespace that is not a member of its mesh.
+	GatewayWorkloadNotInMemberRoll = diag.NewMessageType(diag.Warning, "IST0134", "The gateway selector %s matches workloads in namespace %s, which is not a member of the mesh of control plane %s.")
 )
 
 // All returns a list of all known message types.
@@ -153,6 +165,9 @@ func All() []*diag.MessageType {
 		NoServerCertificateVerificationPortLevel,
 		VirtualServiceUnreachableRule,
 		VirtualServiceIneffectiveMatch,
+		NamespaceNotInMemberRoll,
+		ReferencedHostNotInMemberRoll,
+		GatewayWorkloadNotInMemberRoll,
 	}
 }
 
@@ -441,3 +456,34 @@ func NewVirtualServiceIneffectiveMatch(r *resource.Instance, ruleno string, matc
 		dupno,
 	)
 }
+
+// NewNamespaceNotInMemberRoll returns a new diag.Message based on NamespaceNotInMemberRoll.
+func NewNamespaceNotInMemberRoll(r *resource.Instance, namespace string) diag.Message {
+	return diag.NewMessage(
+		NamespaceNotInMemberRoll,
+		r,
+		namespace,
+	)
+}
+
+// NewReferencedHostNotInMemberRoll returns a new diag.Message based on ReferencedHostNotInMemberRoll.
+func NewReferencedHostNotInMemberRoll(r *resource.Instance, host string, namespace string, controlPlane string) diag.Message {
+	return diag.NewMessage(
+		ReferencedHostNotInMemberRoll,
+		r,
+		host,
+		namespace,
+		controlPlane,
+	)
+}
+
+// NewGatewayWorkloadNotInMemberRoll returns a new diag.Message based on GatewayWorkloadNotInMemberRoll.
+func NewGatewayWorkloadNotInMemberRoll(r *resource.Instance, selector string, namespace string, controlPlane string) diag.Message {
+	return diag.NewMessage(
+		GatewayWorkloadNotInMemberRoll,
+		r,
+		selector,
+		namespace,
+		controlPlane,
+	)
+}
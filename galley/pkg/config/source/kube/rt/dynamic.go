@@ -106,6 +106,38 @@ func (p *Provider) getDynamicAdapter(r resource.Schema) *Adapter {
 	}
 }
 
+const (
+	memberRollGroup = "maistra.io"
+	memberRollKind  = "ServiceMeshMemberRoll"
+)
+
+// getMemberRollAdapter returns a dynamic adapter that keeps the status of
+// ServiceMeshMemberRolls next to their spec, since the namespaces that are part
+// of the mesh are the members the operator configured, not the requested ones.
+func (p *Provider) getMemberRollAdapter(r resource.Schema) *Adapter {
+	a := p.getDynamicAdapter(r)
+	a.extractResource = func(o interface{}) (proto.Message, error) {
+		u, ok := o.(*unstructured.Unstructured)
+		if !ok {
+			return nil, fmt.Errorf("extractResource: not unstructured: %v", o)
+		}
+
+		data := map[string]interface{}{}
+		for _, field := range []string{"spec", "status"} {
+			if value, found := u.Object[field]; found {
+				data[field] = value
+			}
+		}
+		pr := r.MustNewInstance().(proto.Message)
+		if err := pb.UnmarshalData(pr, data); err != nil {
+			return nil, err
+		}
+
+		return pr, nil
+	}
+	return a
+}
+
 // Check if the parsed resource is empty
 func empty(r *unstructured.Unstructured) bool {
 	if r.Object == nil || len(r.Object) == 0 {
@@ -28,6 +28,7 @@ import (
 	"istio.io/istio/galley/pkg/config/testing/basicmeta"
 	"istio.io/istio/galley/pkg/config/testing/data"
 	"istio.io/istio/pkg/config"
+	"istio.io/istio/pkg/config/schema/collections"
 )
 
 func TestParseDynamic(t *testing.T) {
@@ -86,6 +87,40 @@ func TestExtractResourceDynamic(t *testing.T) {
 	}
 }
 
+func TestExtractResourceMemberRoll(t *testing.T) {
+	g := NewWithT(t)
+	a := rt.DefaultProvider().GetAdapter(collections.K8SMaistraIoV1Servicemeshmemberrolls.Resource())
+
+	input, err := yaml.ToJSON([]byte(`
+apiVersion: maistra.io/v1
+kind: ServiceMeshMemberRoll
+metadata:
+  name: default
+  namespace: istio-system
+spec:
+  members:
+  - bookinfo
+  - pending
+status:
+  configuredMembers:
+  - bookinfo
+`))
+	g.Expect(err).To(BeNil())
+	obj, err := a.ParseJSON(input)
+	g.Expect(err).To(BeNil())
+
+	out, err := a.ExtractResource(obj)
+	g.Expect(err).To(BeNil())
+	memberRoll, ok := out.(*types.Struct)
+	g.Expect(ok).To(BeTrue())
+	spec := memberRoll.GetFields()["spec"].GetStructValue()
+	g.Expect(spec.GetFields()["members"].GetListValue().GetValues()).To(HaveLen(2))
+	status := memberRoll.GetFields()["status"].GetStructValue()
+	configuredMembers := status.GetFields()["configuredMembers"].GetListValue().GetValues()
+	g.Expect(configuredMembers).To(HaveLen(1))
+	g.Expect(configuredMembers[0].GetStringValue()).To(Equal("bookinfo"))
+}
+
 func parseDynamic(t *testing.T, input []byte, kind string) (metaV1.Object, proto.Message) {
 	t.Helper()
 	g := NewWithT(t)
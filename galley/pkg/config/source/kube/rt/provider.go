@@ -79,6 +79,9 @@ func (p *Provider) GetAdapter(r resource.Schema) *Adapter {
 	if t, found := p.known[asTypesKey(r.Group(), r.Kind())]; found {
 		return t
 	}
+	if r.Group() == memberRollGroup && r.Kind() == memberRollKind {
+		return p.getMemberRollAdapter(r)
+	}
 
 	return p.getDynamicAdapter(r)
 }
@@ -69,6 +69,7 @@ var (
 	colorize          bool
 	msgOutputFormat   string
 	meshCfgFile       string
+	memberRollFile    string
 	selectedNamespace string
 	allNamespaces     bool
 	suppress          []string
@@ -97,6 +98,9 @@ func Analyze() *cobra.Command {
   # Analyze yaml files without connecting to a live cluster
   istioctl analyze --use-kube=false a.yaml b.yaml my-app-config/
 
+  # Analyze the current live cluster, using the members of the ServiceMeshMemberRoll in smmr.yaml
+  istioctl analyze --memberRollFile smmr.yaml
+
   # Analyze the current live cluster and suppress PodMissingProxy for pod mypod in namespace 'testing'.
   istioctl analyze -S "IST0103=Pod mypod.testing"
 
@@ -183,6 +187,14 @@ func Analyze() *cobra.Command {
 				_ = sa.AddFileKubeMeshConfig(meshCfgFile)
 			}
 
+			// If we explicitly specify a member roll, use it.
+			// This takes precedence over a member roll with the same name from a running Kube instance.
+			if memberRollFile != "" {
+				if err := sa.AddFileKubeMemberRoll(memberRollFile); err != nil {
+					return err
+				}
+			}
+
 			// If we're not using kube (files only), add defaults for some resources we expect to be provided by Istio
 			if !useKube {
 				err := sa.AddDefaultResources()
@@ -283,6 +295,8 @@ func Analyze() *cobra.Command {
 		fmt.Sprintf("Output format: one of %v", formatting.MsgOutputFormatKeys))
 	analysisCmd.PersistentFlags().StringVar(&meshCfgFile, "meshConfigFile", "",
 		"Overrides the mesh config values to use for analysis.")
+	analysisCmd.PersistentFlags().StringVar(&memberRollFile, "memberRollFile", "",
+		"The ServiceMeshMemberRoll that defines the member namespaces of the mesh. Overrides the member roll in the cluster.")
 	analysisCmd.PersistentFlags().BoolVarP(&allNamespaces, "all-namespaces", "A", false,
 		"Analyze all namespaces")
 	analysisCmd.PersistentFlags().StringArrayVarP(&suppress, "suppress", "S", []string{},
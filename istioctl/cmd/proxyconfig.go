@@ -410,6 +410,64 @@ func listenerConfigCmd() *cobra.Command {
 	return listenerConfigCmd
 }
 
+func filterOrderConfigCmd() *cobra.Command {
+	var podName, podNamespace string
+
+	filterOrderConfigCmd := &cobra.Command{
+		Use:   "filter-order [<type>/]<name>[.<namespace>]",
+		Short: "Retrieves the order of HTTP filters for the Envoy in the specified pod",
+		Long: `Retrieve the order in which the Envoy instance in the specified pod runs its HTTP filters,
+including the ServiceMeshExtensions applied to it.`,
+		Example: `  # Retrieve the HTTP filter order of all listeners for a given pod from Envoy.
+  istioctl proxy-config filter-order <pod-name[.namespace]>
+
+  # Retrieve the HTTP filter order of the listeners with port 9080.
+  istioctl proxy-config filter-order <pod-name[.namespace]> --port 9080
+
+  # Retrieve the HTTP filter order without using Kubernetes API
+  ssh <user@hostname> 'curl localhost:15000/config_dump' > envoy-config.json
+  istioctl proxy-config filter-order --file envoy-config.json
+`,
+		Aliases: []string{"fo"},
+		Args: func(cmd *cobra.Command, args []string) error {
+			if (len(args) == 1) != (configDumpFile == "") {
+				cmd.Println(cmd.UsageString())
+				return fmt.Errorf("filter-order requires pod name or --file parameter")
+			}
+			return nil
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			var configWriter *configdump.ConfigWriter
+			var err error
+			if len(args) == 1 {
+				if podName, podNamespace, err = getPodName(args[0]); err != nil {
+					return err
+				}
+				configWriter, err = setupPodConfigdumpWriter(podName, podNamespace, c.OutOrStdout())
+			} else {
+				configWriter, err = setupFileConfigdumpWriter(configDumpFile, c.OutOrStdout())
+			}
+			if err != nil {
+				return err
+			}
+			filter := configdump.ListenerFilter{
+				Address: address,
+				Port:    uint32(port),
+				Type:    listenerType,
+			}
+			return configWriter.PrintHTTPFilterOrder(filter)
+		},
+	}
+
+	filterOrderConfigCmd.PersistentFlags().StringVar(&address, "address", "", "Filter listeners by address field")
+	filterOrderConfigCmd.PersistentFlags().StringVar(&listenerType, "type", "", "Filter listeners by type field")
+	filterOrderConfigCmd.PersistentFlags().IntVar(&port, "port", 0, "Filter listeners by Port field")
+	filterOrderConfigCmd.PersistentFlags().StringVarP(&configDumpFile, "file", "f", "",
+		"Envoy config dump JSON file")
+
+	return filterOrderConfigCmd
+}
+
 func logCmd() *cobra.Command {
 	var podName, podNamespace string
 
@@ -784,6 +842,7 @@ func proxyConfig() *cobra.Command {
 
 	configCmd.AddCommand(clusterConfigCmd())
 	configCmd.AddCommand(listenerConfigCmd())
+	configCmd.AddCommand(filterOrderConfigCmd())
 	configCmd.AddCommand(logCmd())
 	configCmd.AddCommand(routeConfigCmd())
 	configCmd.AddCommand(bootstrapConfigCmd())
@@ -0,0 +1,182 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"istio.io/istio/istioctl/pkg/util/handlers"
+	"istio.io/istio/pkg/spiffe"
+	"istio.io/istio/security/pkg/pki/ca"
+)
+
+// revokeCmd revokes workload certificates issued by the Istio CA.
+func revokeCmd() *cobra.Command {
+	var (
+		serials        []string
+		serviceAccount string
+		trustDomain    string
+		list           bool
+	)
+	cmd := &cobra.Command{
+		Use:   "revoke [<spiffe-id>...]",
+		Short: "Revoke workload certificates issued by the Istio CA",
+		Long: `Revokes workload certificates issued by the Istio CA, by SPIFFE identity or by serial number.
+
+Revoking an identity revokes every certificate issued to it before the revocation; certificates
+issued afterwards, for example after the compromised workload was redeployed, stay valid.
+Istiod only keeps track of the certificates it issued since it started, so certificates issued
+before an istiod restart are not covered by an identity revocation and must be revoked by serial
+number.
+
+Istiod publishes the resulting certificate revocation list along with its root certificate, and
+proxies reject the revoked certificates once they receive it. The list is only published when
+istiod signs workload certificates with a root certificate that has the cRLSign key usage: a root
+created by an older release must be rotated first, and revocation is not supported with a
+plugged-in intermediate CA certificate, since proxies would require a revocation list for every
+CA of the chain.`,
+		Example: `  # Revoke the certificates of the productpage service account
+  istioctl experimental revoke --service-account productpage -n default
+
+  # Revoke a SPIFFE identity
+  istioctl x revoke spiffe://cluster.local/ns/default/sa/productpage
+
+  # Revoke a single certificate by serial number
+  istioctl x revoke --serial 3a:5f:01:9c
+
+  # List the current revocations
+  istioctl x revoke --list`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := interfaceFactory(kubeconfig)
+			if err != nil {
+				return err
+			}
+			ns := istioNamespace
+			if list {
+				cm, err := client.CoreV1().ConfigMaps(ns).Get(context.TODO(), ca.RevocationConfigMap, metav1.GetOptions{})
+				if err != nil && !k8serrors.IsNotFound(err) {
+					return err
+				}
+				if k8serrors.IsNotFound(err) {
+					cm = nil
+				}
+				revocations, err := ca.ParseRevocations(cm)
+				if err != nil {
+					return err
+				}
+				return printRevocations(cmd.OutOrStdout(), revocations)
+			}
+
+			now := time.Now().UTC().Truncate(time.Second)
+			var revocations []ca.Revocation
+			if serviceAccount != "" {
+				args = append(args, spiffe.Identity{
+					TrustDomain:    trustDomain,
+					Namespace:      handlers.HandleNamespace(namespace, defaultNamespace),
+					ServiceAccount: serviceAccount,
+				}.String())
+			}
+			for _, id := range args {
+				if _, err := spiffe.ParseIdentity(id); err != nil {
+					return err
+				}
+				revocations = append(revocations, ca.Revocation{Identity: id, RevokedAt: now})
+			}
+			for _, s := range serials {
+				serial, err := ca.NormalizeSerialNumber(s)
+				if err != nil {
+					return err
+				}
+				revocations = append(revocations, ca.Revocation{SerialNumber: serial, RevokedAt: now})
+			}
+			if len(revocations) == 0 {
+				return errors.New("expecting an identity, --service-account or --serial")
+			}
+
+			added, err := ca.AddRevocations(client.CoreV1(), ns, revocations)
+			if err != nil {
+				return err
+			}
+			for _, r := range revocations {
+				if !containsRevocation(added, r) {
+					fmt.Fprintf(cmd.OutOrStdout(), "%s is already revoked\n", describeRevocation(r))
+					continue
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "revoked %s\n", describeRevocation(r))
+			}
+			return nil
+		},
+	}
+	cmd.PersistentFlags().StringSliceVar(&serials, "serial", nil,
+		"Serial numbers of the certificates to revoke, in hex")
+	cmd.PersistentFlags().StringVar(&serviceAccount, "service-account", "",
+		"Service account, in the --namespace namespace, whose identity to revoke")
+	cmd.PersistentFlags().StringVar(&trustDomain, "trust-domain", "cluster.local",
+		"Trust domain of the identity revoked with --service-account")
+	cmd.PersistentFlags().BoolVar(&list, "list", false,
+		"List the current revocations instead of revoking")
+	cmd.Long += "\n\n" + ExperimentalMsg
+	return cmd
+}
+
+func containsRevocation(revocations []ca.Revocation, r ca.Revocation) bool {
+	for _, a := range revocations {
+		if a.SerialNumber == r.SerialNumber && a.Identity == r.Identity {
+			return true
+		}
+	}
+	return false
+}
+
+func describeRevocation(r ca.Revocation) string {
+	if r.SerialNumber != "" {
+		return "certificate " + r.SerialNumber
+	}
+	return "identity " + r.Identity
+}
+
+func printRevocations(writer io.Writer, revocations []ca.Revocation) error {
+	if len(revocations) == 0 {
+		_, err := fmt.Fprintln(writer, "No revocations found.")
+		return err
+	}
+	w := new(tabwriter.Writer).Init(writer, 0, 8, 3, ' ', 0)
+	fmt.Fprintln(w, "SERIAL\tIDENTITY\tREVOKED AT\tEXPIRES AT")
+	for _, r := range revocations {
+		expires := "-"
+		if r.ExpiresAt != nil {
+			expires = r.ExpiresAt.UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", valueOrDash(r.SerialNumber), valueOrDash(r.Identity),
+			r.RevokedAt.UTC().Format(time.RFC3339), expires)
+	}
+	return w.Flush()
+}
+
+func valueOrDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,100 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"istio.io/istio/security/pkg/pki/ca"
+)
+
+func TestRevoke(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	interfaceFactory = func(_ string) (kubernetes.Interface, error) {
+		return client, nil
+	}
+	defer func() {
+		interfaceFactory = createInterface
+		namespace = ""
+	}()
+
+	cases := []struct {
+		args              string
+		expectedException bool
+		expectedOutput    string
+	}{
+		{
+			args:           "x revoke --list",
+			expectedOutput: "No revocations found.\n",
+		},
+		{
+			args:              "x revoke",
+			expectedException: true,
+			expectedOutput:    "Error: expecting an identity, --service-account or --serial\n",
+		},
+		{
+			args:              "x revoke foo",
+			expectedException: true,
+			expectedOutput:    "Error: identity is not a spiffe format: foo\n",
+		},
+		{
+			args:              "x revoke --serial zz",
+			expectedException: true,
+			expectedOutput:    "Error: invalid certificate serial number \"zz\"\n",
+		},
+		{
+			args:           "x revoke --service-account productpage -n default --serial 3A:5F",
+			expectedOutput: "revoked identity spiffe://cluster.local/ns/default/sa/productpage\nrevoked certificate 3a5f\n",
+		},
+		{
+			args:           "x revoke --serial 3a5f",
+			expectedOutput: "certificate 3a5f is already revoked\n",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.args, func(t *testing.T) {
+			var out bytes.Buffer
+			rootCmd := GetRootCmd(strings.Split(c.args, " "))
+			rootCmd.SetOut(&out)
+			rootCmd.SetErr(&out)
+			err := rootCmd.Execute()
+			if c.expectedException != (err != nil) {
+				t.Fatalf("unexpected error %v, output %q", err, out.String())
+			}
+			if out.String() != c.expectedOutput {
+				t.Fatalf("got output %q, want %q", out.String(), c.expectedOutput)
+			}
+		})
+	}
+
+	cm, err := client.CoreV1().ConfigMaps("istio-system").Get(context.TODO(), ca.RevocationConfigMap, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	revocations, err := ca.ParseRevocations(cm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revocations) != 2 {
+		t.Errorf("unexpected revocations: %+v", revocations)
+	}
+}
@@ -231,6 +231,8 @@ debug and diagnose their Istio mesh.
 	deprecate(vmBootstrapCmd)
 	experimentalCmd.AddCommand(vmBootstrapCmd)
 	experimentalCmd.AddCommand(waitCmd())
+	experimentalCmd.AddCommand(simulateCmd())
+	experimentalCmd.AddCommand(revokeCmd())
 	experimentalCmd.AddCommand(mesh.UninstallCmd(loggingOptions))
 	experimentalCmd.AddCommand(configCmd())
 	postInstallWebhookCmd := Webhook()
@@ -0,0 +1,347 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"text/tabwriter"
+
+	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/spf13/cobra"
+
+	"istio.io/istio/istioctl/pkg/clioptions"
+	"istio.io/istio/istioctl/pkg/util/configdump"
+	"istio.io/istio/pilot/pkg/model"
+	simulation "istio.io/istio/pilot/pkg/simulation/engine"
+)
+
+const (
+	simulateSourceProxy  = "proxy"
+	simulateSourceIstiod = "istiod"
+)
+
+type simulateOptions struct {
+	// Where the proxy configuration comes from
+	source          string
+	configDumpFile  string
+	configFiles     []string
+	proxyType       string
+	proxyNamespace  string
+	proxyIP         string
+	proxyLabels     map[string]string
+	controlPlaneOpt clioptions.ControlPlaneOptions
+
+	// The synthetic request
+	protocol string
+	host     string
+	port     int
+	path     string
+	headers  []string
+	tls      string
+	sni      string
+	address  string
+	mode     string
+}
+
+func simulateCmd() *cobra.Command {
+	opts := &simulateOptions{}
+	cmd := &cobra.Command{
+		Use:   "simulate [<type>/]<name>[.<namespace>]",
+		Short: "Simulate a request against the configuration of a proxy",
+		Long: `Simulate sends a synthetic request through the listeners, filter chains, routes and clusters of a proxy
+and prints what the request matched, along with the Istio configuration objects that produced each match.
+
+The proxy configuration can be read from the Envoy running in a pod, from the configuration Istiod generates
+for that pod (--source istiod), from an Envoy config dump file (--file), or generated locally from Istio
+configuration YAML files (--config-file). Services used with local configuration must be declared as
+ServiceEntries.`,
+		Example: `  # Simulate an HTTP request from the productpage pod to the reviews service
+  istioctl experimental simulate productpage-v1-7f44c4d57c-ccvxb --host reviews --port 9080 --path /reviews/1
+
+  # Simulate the same request against the configuration Istiod would send to the pod
+  istioctl experimental simulate productpage-v1-7f44c4d57c-ccvxb --source istiod --host reviews --port 9080
+
+  # Simulate a TLS request reaching an ingress gateway, using a config dump file
+  istioctl experimental simulate -f gateway_config_dump.json --mode gateway --tls tls --host example.com --port 443
+
+  # Simulate a request against configuration generated from local files
+  istioctl experimental simulate --config-file service-entry.yaml,virtual-service.yaml --host foo.example.com --port 80`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			local := opts.configDumpFile != "" || len(opts.configFiles) > 0
+			if opts.configDumpFile != "" && len(opts.configFiles) > 0 {
+				return fmt.Errorf("--file and --config-file cannot be used together")
+			}
+			if len(args) == 1 && local {
+				return fmt.Errorf("a pod cannot be combined with --file or --config-file")
+			}
+			if len(args) != 1 && !local {
+				cmd.Println(cmd.UsageString())
+				return fmt.Errorf("simulate requires a pod, --file or --config-file")
+			}
+			if len(args) > 1 {
+				return fmt.Errorf("simulate accepts at most one pod")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			call, err := opts.buildCall()
+			if err != nil {
+				return err
+			}
+			sim, err := opts.buildSimulation(args)
+			if err != nil {
+				return err
+			}
+			result, err := sim.Run(call)
+			if err != nil {
+				return fmt.Errorf("failed to simulate request: %v", err)
+			}
+			printSimulationResult(cmd.OutOrStdout(), result)
+			return result.Error
+		},
+	}
+
+	opts.controlPlaneOpt.AttachControlPlaneFlags(cmd)
+	cmd.PersistentFlags().StringVar(&opts.source, "source", simulateSourceProxy,
+		"Where to read the pod's configuration from, one of 'proxy' or 'istiod'")
+	cmd.PersistentFlags().StringVarP(&opts.configDumpFile, "file", "f", "",
+		"Envoy config dump JSON file")
+	cmd.PersistentFlags().StringSliceVar(&opts.configFiles, "config-file", nil,
+		"Istio configuration YAML files to generate the proxy configuration from")
+	cmd.PersistentFlags().StringVar(&opts.proxyType, "proxy-type", string(model.SidecarProxy),
+		"The type of proxy to generate configuration for with --config-file, one of 'sidecar' or 'router'")
+	cmd.PersistentFlags().StringVar(&opts.proxyNamespace, "proxy-namespace", "default",
+		"The namespace of the proxy to generate configuration for with --config-file")
+	cmd.PersistentFlags().StringVar(&opts.proxyIP, "proxy-ip", "1.1.1.1",
+		"The IP address of the proxy to generate configuration for with --config-file")
+	cmd.PersistentFlags().StringToStringVar(&opts.proxyLabels, "proxy-labels", nil,
+		"The labels of the proxy to generate configuration for with --config-file; e.g. --proxy-labels istio=ingressgateway")
+
+	cmd.PersistentFlags().StringVar(&opts.protocol, "protocol", string(simulation.HTTP),
+		"The request protocol, one of 'http', 'http2' or 'tcp'")
+	cmd.PersistentFlags().StringVar(&opts.host, "host", "",
+		"The host of the request, used as the Host header and, for TLS requests, the SNI")
+	cmd.PersistentFlags().IntVar(&opts.port, "port", 80,
+		"The destination port of the request")
+	cmd.PersistentFlags().StringVar(&opts.path, "path", "/",
+		"The path of the request")
+	cmd.PersistentFlags().StringArrayVar(&opts.headers, "header", nil,
+		"Request header in the form 'name: value'; may be repeated")
+	cmd.PersistentFlags().StringVar(&opts.tls, "tls", string(simulation.Plaintext),
+		"The TLS mode of the request, one of 'plaintext', 'tls' or 'mtls'")
+	cmd.PersistentFlags().StringVar(&opts.sni, "sni", "",
+		"The SNI of the request, defaults to the host for TLS requests")
+	cmd.PersistentFlags().StringVar(&opts.address, "address", "",
+		"The destination IP address of the request")
+	cmd.PersistentFlags().StringVar(&opts.mode, "mode", string(simulation.CallModeOutbound),
+		"How the request reaches the proxy, one of 'outbound', 'inbound' or 'gateway'")
+
+	return cmd
+}
+
+func (o *simulateOptions) buildCall() (simulation.Call, error) {
+	call := simulation.Call{
+		Address:    o.address,
+		Port:       o.port,
+		Path:       o.path,
+		HostHeader: o.host,
+		Headers:    http.Header{},
+		Sni:        o.sni,
+	}
+	switch p := simulation.Protocol(o.protocol); p {
+	case simulation.HTTP, simulation.HTTP2, simulation.TCP:
+		call.Protocol = p
+	default:
+		return call, fmt.Errorf("unknown protocol %q", o.protocol)
+	}
+	switch t := simulation.TLSMode(o.tls); t {
+	case simulation.Plaintext, simulation.TLS, simulation.MTLS:
+		call.TLS = t
+	default:
+		return call, fmt.Errorf("unknown TLS mode %q", o.tls)
+	}
+	switch m := simulation.CallMode(o.mode); m {
+	case simulation.CallModeOutbound, simulation.CallModeInbound, simulation.CallModeGateway:
+		call.CallMode = m
+	default:
+		return call, fmt.Errorf("unknown mode %q", o.mode)
+	}
+	if call.Sni == "" && call.TLS == simulation.MTLS {
+		call.Sni = o.host
+	}
+	for _, h := range o.headers {
+		kv := strings.SplitN(h, ":", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return call, fmt.Errorf("invalid header %q, expected 'name: value'", h)
+		}
+		call.Headers.Add(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]))
+	}
+	return call, nil
+}
+
+func (o *simulateOptions) buildSimulation(args []string) (*simulation.Simulation, error) {
+	if len(o.configFiles) > 0 {
+		return o.buildLocalSimulation()
+	}
+	var dump []byte
+	var err error
+	if o.configDumpFile != "" {
+		dump, err = readConfigFile(o.configDumpFile)
+	} else {
+		dump, err = o.fetchPodConfigDump(args[0])
+	}
+	if err != nil {
+		return nil, err
+	}
+	w := &configdump.Wrapper{}
+	if err := json.Unmarshal(dump, w); err != nil {
+		return nil, fmt.Errorf("failed to parse config dump: %v", err)
+	}
+	listeners, clusters, routes, err := resourcesFromConfigDump(w)
+	if err != nil {
+		return nil, err
+	}
+	return simulation.NewSimulation(listeners, clusters, routes), nil
+}
+
+func (o *simulateOptions) fetchPodConfigDump(podflag string) ([]byte, error) {
+	podName, ns, err := getPodName(podflag)
+	if err != nil {
+		return nil, err
+	}
+	kubeClient, err := kubeClientWithRevision(kubeconfig, configContext, o.controlPlaneOpt.Revision)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create k8s client: %v", err)
+	}
+	switch o.source {
+	case simulateSourceProxy:
+		dump, err := kubeClient.EnvoyDo(context.TODO(), podName, ns, "GET", "config_dump", nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute command on %s.%s sidecar: %v", podName, ns, err)
+		}
+		return dump, nil
+	case simulateSourceIstiod:
+		path := fmt.Sprintf("/debug/config_dump?proxyID=%s.%s", podName, ns)
+		responses, err := kubeClient.AllDiscoveryDo(context.TODO(), istioNamespace, path)
+		if err != nil {
+			return nil, err
+		}
+		// Only the Istiod instance the proxy is connected to returns a valid config dump
+		for _, resp := range responses {
+			if err := json.Unmarshal(resp, &configdump.Wrapper{}); err == nil {
+				return resp, nil
+			}
+		}
+		return nil, fmt.Errorf("unable to find config dump for %s.%s in Istiod responses", podName, ns)
+	default:
+		return nil, fmt.Errorf("unknown source %q, must be one of %q or %q", o.source, simulateSourceProxy, simulateSourceIstiod)
+	}
+}
+
+// buildLocalSimulation generates the proxy configuration from local Istio configuration files.
+func (o *simulateOptions) buildLocalSimulation() (*simulation.Simulation, error) {
+	configs := make([]string, 0, len(o.configFiles))
+	for _, f := range o.configFiles {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		configs = append(configs, string(b))
+	}
+	var proxyType model.NodeType
+	switch model.NodeType(o.proxyType) {
+	case model.SidecarProxy, model.Router:
+		proxyType = model.NodeType(o.proxyType)
+	default:
+		return nil, fmt.Errorf("unknown proxy type %q", o.proxyType)
+	}
+	return simulation.NewSimulationFromConfig(strings.Join(configs, "\n---\n"), &model.Proxy{
+		Type:            proxyType,
+		ConfigNamespace: o.proxyNamespace,
+		IPAddresses:     []string{o.proxyIP},
+		Metadata:        &model.NodeMetadata{Labels: o.proxyLabels},
+	})
+}
+
+// resourcesFromConfigDump extracts the dynamic listeners, clusters and routes of a config dump.
+func resourcesFromConfigDump(w *configdump.Wrapper) ([]*listener.Listener, []*cluster.Cluster, []*route.RouteConfiguration, error) {
+	listenerDump, err := w.GetDynamicListenerDump(true)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to read listeners: %v", err)
+	}
+	listeners := make([]*listener.Listener, 0, len(listenerDump.DynamicListeners))
+	for _, l := range listenerDump.DynamicListeners {
+		out := &listener.Listener{}
+		if err := ptypes.UnmarshalAny(l.ActiveState.Listener, out); err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to unmarshal listener: %v", err)
+		}
+		listeners = append(listeners, out)
+	}
+
+	clusterDump, err := w.GetDynamicClusterDump(true)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to read clusters: %v", err)
+	}
+	clusters := make([]*cluster.Cluster, 0, len(clusterDump.DynamicActiveClusters))
+	for _, c := range clusterDump.DynamicActiveClusters {
+		out := &cluster.Cluster{}
+		if err := ptypes.UnmarshalAny(c.Cluster, out); err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to unmarshal cluster: %v", err)
+		}
+		clusters = append(clusters, out)
+	}
+
+	routeDump, err := w.GetDynamicRouteDump(true)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to read routes: %v", err)
+	}
+	routes := make([]*route.RouteConfiguration, 0, len(routeDump.DynamicRouteConfigs))
+	for _, r := range routeDump.DynamicRouteConfigs {
+		out := &route.RouteConfiguration{}
+		if err := ptypes.UnmarshalAny(r.RouteConfig, out); err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to unmarshal route: %v", err)
+		}
+		routes = append(routes, out)
+	}
+	return listeners, clusters, routes, nil
+}
+
+func printSimulationResult(out io.Writer, r simulation.Result) {
+	w := new(tabwriter.Writer).Init(out, 0, 8, 1, ' ', 0)
+	row := func(name, value string) {
+		if value != "" {
+			_, _ = fmt.Fprintf(w, "%s:\t%s\n", name, value)
+		}
+	}
+	row("LISTENER", r.ListenerMatched)
+	row("FILTER CHAIN", r.FilterChainMatched)
+	row("ROUTE CONFIG", r.RouteConfigMatched)
+	row("VIRTUAL HOST", r.VirtualHostMatched)
+	row("ROUTE", r.RouteMatched)
+	row("CLUSTER", r.ClusterMatched)
+	for _, c := range r.ConfigsMatched {
+		row("CONFIG", c)
+	}
+	_ = w.Flush()
+}
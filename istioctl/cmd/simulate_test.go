@@ -0,0 +1,125 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	adminapi "github.com/envoyproxy/go-control-plane/envoy/admin/v3"
+	"github.com/golang/protobuf/ptypes/any"
+
+	"istio.io/istio/istioctl/pkg/util/configdump"
+	"istio.io/istio/pilot/pkg/networking/core/v1alpha3"
+	networking "istio.io/istio/pilot/pkg/networking/util"
+	"istio.io/istio/pilot/test/util"
+)
+
+func TestSimulate(t *testing.T) {
+	dumpFile := writeSimulateConfigDump(t, "testdata/simulate/config.yaml")
+	defer os.RemoveAll(filepath.Dir(dumpFile))
+
+	cases := []execTestCase{
+		{ // neither pod nor files
+			args:           strings.Split("x simulate --host foo.example.com", " "),
+			expectedString: "simulate requires a pod, --file or --config-file",
+			wantException:  true,
+		},
+		{ // config files and config dump are exclusive
+			args:           strings.Split("x simulate -f dump.json --config-file testdata/simulate/config.yaml", " "),
+			expectedString: "--file and --config-file cannot be used together",
+			wantException:  true,
+		},
+		{ // invalid header
+			args:           strings.Split("x simulate --config-file testdata/simulate/config.yaml --header foo", " "),
+			expectedString: `invalid header "foo"`,
+			wantException:  true,
+		},
+		{ // matched route from local configuration
+			args: strings.Split("x simulate --config-file testdata/simulate/config.yaml --host foo.example.com --port 80 --path /api/v1", " "),
+			expectedOutput: `LISTENER:     0.0.0.0_80
+ROUTE CONFIG: 80
+VIRTUAL HOST: foo.example.com:80
+ROUTE:        api
+CLUSTER:      outbound|80||foo.example.com
+CONFIG:       /apis/networking.istio.io/v1alpha3/namespaces/default/virtual-service/foo
+`,
+		},
+		{ // unmatched path from local configuration
+			args:           strings.Split("x simulate --config-file testdata/simulate/config.yaml --host foo.example.com --port 80 --path /other", " "),
+			expectedString: "no route matched",
+			wantException:  true,
+		},
+		{ // matched route from a config dump
+			args:           strings.Split(fmt.Sprintf("x simulate -f %s --host foo.example.com --port 80 --path /api", dumpFile), " "),
+			expectedString: "CLUSTER:      outbound|80||foo.example.com",
+		},
+	}
+
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("case %d %s", i, strings.Join(c.args, " ")), func(t *testing.T) {
+			verifyExecTestOutput(t, c)
+		})
+	}
+}
+
+// writeSimulateConfigDump generates the configuration of a sidecar from the given Istio configuration and
+// writes it to a temporary file as an Envoy config dump.
+func writeSimulateConfigDump(t *testing.T, configFile string) string {
+	t.Helper()
+	cg := v1alpha3.NewConfigGenTest(t, v1alpha3.TestOptions{
+		ConfigString: string(util.ReadFile(configFile, t)),
+	})
+	proxy := cg.SetupProxy(nil)
+
+	listeners := &adminapi.ListenersConfigDump{}
+	for _, l := range cg.Listeners(proxy) {
+		listeners.DynamicListeners = append(listeners.DynamicListeners, &adminapi.ListenersConfigDump_DynamicListener{
+			Name:        l.Name,
+			ActiveState: &adminapi.ListenersConfigDump_DynamicListenerState{Listener: networking.MessageToAny(l)},
+		})
+	}
+	clusters := &adminapi.ClustersConfigDump{}
+	for _, c := range cg.Clusters(proxy) {
+		clusters.DynamicActiveClusters = append(clusters.DynamicActiveClusters,
+			&adminapi.ClustersConfigDump_DynamicCluster{Cluster: networking.MessageToAny(c)})
+	}
+	routes := &adminapi.RoutesConfigDump{}
+	for _, r := range cg.Routes(proxy) {
+		routes.DynamicRouteConfigs = append(routes.DynamicRouteConfigs,
+			&adminapi.RoutesConfigDump_DynamicRouteConfig{RouteConfig: networking.MessageToAny(r)})
+	}
+	w := &configdump.Wrapper{ConfigDump: &adminapi.ConfigDump{
+		Configs: []*any.Any{networking.MessageToAny(clusters), networking.MessageToAny(listeners), networking.MessageToAny(routes)},
+	}}
+	b, err := w.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "simulate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "config_dump.json")
+	if err := ioutil.WriteFile(file, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
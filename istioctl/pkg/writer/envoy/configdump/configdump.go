@@ -29,6 +29,9 @@ import (
 type ConfigWriter struct {
 	Stdout     io.Writer
 	configDump *configdump.Wrapper
+	// extensionConfigs are the names of the extensions by the name of the
+	// filter configs received over ECDS
+	extensionConfigs map[string]string
 }
 
 // Prime loads the config dump into the writer ready for printing
@@ -41,6 +44,7 @@ func (c *ConfigWriter) Prime(b []byte) error {
 		return fmt.Errorf("error unmarshalling config dump response from Envoy: %v", err)
 	}
 	c.configDump = &cd
+	c.extensionConfigs = extensionConfigNames(b)
 	return nil
 }
 
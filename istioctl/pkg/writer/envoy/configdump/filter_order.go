@@ -0,0 +1,194 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configdump
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	wasm "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/wasm/v3"
+	httpConn "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/any"
+	structpb "github.com/golang/protobuf/ptypes/struct"
+
+	"istio.io/istio/pkg/servicemesh/extension"
+)
+
+const (
+	wasmFilterName = "envoy.filters.http.wasm"
+
+	// ecdsConfigDumpType is the type of the config dump section holding the
+	// filter configs received over ECDS, which the vendored admin API lacks
+	ecdsConfigDumpType = "type.googleapis.com/envoy.admin.v3.EcdsConfigDump"
+)
+
+// httpFilterEntry is a single HTTP filter of a filter chain
+type httpFilterEntry struct {
+	filterChain string
+	name        string
+	extension   string
+}
+
+// PrintHTTPFilterOrder prints the HTTP filters of the relevant listeners in
+// the order in which Envoy runs them. For WebAssembly filters, the name of the
+// ServiceMeshExtension they were created from is printed as well.
+func (c *ConfigWriter) PrintHTTPFilterOrder(filter ListenerFilter) error {
+	w, listeners, err := c.setupListenerConfigWriter()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, "LISTENER\tFILTER CHAIN\tORDER\tHTTP FILTER\tEXTENSION")
+	for _, l := range listeners {
+		if !filter.Verify(l) {
+			continue
+		}
+		entries, err := retrieveHTTPFilterOrder(l, c.extensionConfigs)
+		if err != nil {
+			return err
+		}
+		order := 0
+		lastChain := ""
+		for _, entry := range entries {
+			if entry.filterChain != lastChain {
+				order = 0
+				lastChain = entry.filterChain
+			}
+			order++
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", l.Name, entry.filterChain, order, entry.name, entry.extension)
+		}
+	}
+	return w.Flush()
+}
+
+// retrieveHTTPFilterOrder returns the HTTP filters of the listener. The
+// extensions of filters configured over ECDS are looked up in extensionConfigs
+// by the name of their filter config.
+func retrieveHTTPFilterOrder(l *listener.Listener, extensionConfigs map[string]string) ([]httpFilterEntry, error) {
+	entries := []httpFilterEntry{}
+	for i, filterChain := range getFilterChains(l) {
+		chainName := filterChain.Name
+		if chainName == "" {
+			chainName = fmt.Sprintf("#%d", i)
+		}
+		for _, filter := range filterChain.GetFilters() {
+			if filter.Name != HTTPListener {
+				continue
+			}
+			hcm := &httpConn.HttpConnectionManager{}
+			// Allow Unmarshal to work even if Envoy and istioctl are different
+			filter.GetTypedConfig().TypeUrl = "type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager"
+			if err := ptypes.UnmarshalAny(filter.GetTypedConfig(), hcm); err != nil {
+				return nil, fmt.Errorf("unmarshal http connection manager of listener %s: %v", l.Name, err)
+			}
+			for _, httpFilter := range hcm.GetHttpFilters() {
+				entry := httpFilterEntry{
+					filterChain: chainName,
+					name:        httpFilter.Name,
+					extension:   "-",
+				}
+				if httpFilter.Name == wasmFilterName {
+					if name := wasmFilterExtensionName(httpFilter); name != "" {
+						entry.extension = name
+					}
+				} else if name := extensionConfigs[httpFilter.Name]; name != "" && httpFilter.GetConfigDiscovery() != nil {
+					entry.extension = name
+				} else if isExtensionConfigDiscoveryFilter(httpFilter) {
+					// the filter config was not received yet, its name identifies the extension
+					_, entry.extension = extension.SplitExtensionConfigName(httpFilter.Name)
+				}
+				entries = append(entries, entry)
+			}
+		}
+	}
+	return entries, nil
+}
+
+// isExtensionConfigDiscoveryFilter returns whether the filter is a WebAssembly
+// filter whose configuration is retrieved over ECDS
+func isExtensionConfigDiscoveryFilter(httpFilter *httpConn.HttpFilter) bool {
+	for _, typeURL := range httpFilter.GetConfigDiscovery().GetTypeUrls() {
+		if typeURL == extension.WasmFilterTypeURL {
+			return true
+		}
+	}
+	return false
+}
+
+// wasmFilterExtensionName returns the plugin name of a WebAssembly filter, which
+// is the name of the ServiceMeshExtension the filter was created from
+func wasmFilterExtensionName(httpFilter *httpConn.HttpFilter) string {
+	return wasmConfigName(httpFilter.GetTypedConfig())
+}
+
+// wasmConfigName returns the plugin name of a WebAssembly filter config
+func wasmConfigName(config *any.Any) string {
+	if config == nil {
+		return ""
+	}
+	wasmConfig := &wasm.Wasm{}
+	if ptypes.Is(config, wasmConfig) {
+		if err := ptypes.UnmarshalAny(config, wasmConfig); err != nil {
+			return ""
+		}
+		return wasmConfig.GetConfig().GetName()
+	}
+	structConfig := &structpb.Struct{}
+	if ptypes.Is(config, structConfig) {
+		if err := ptypes.UnmarshalAny(config, structConfig); err != nil {
+			return ""
+		}
+		return structConfig.GetFields()["config"].GetStructValue().GetFields()["name"].GetStringValue()
+	}
+	return ""
+}
+
+// extensionConfigNames returns the plugin names of the WebAssembly filter
+// configs received over ECDS, by the name of the filter config, from the raw
+// config dump. Filter configs that cannot be parsed are left out.
+func extensionConfigNames(configDump []byte) map[string]string {
+	dump := struct {
+		Configs []json.RawMessage `json:"configs"`
+	}{}
+	if err := json.Unmarshal(configDump, &dump); err != nil {
+		return nil
+	}
+	names := map[string]string{}
+	for _, raw := range dump.Configs {
+		section := struct {
+			Type        string `json:"@type"`
+			EcdsFilters []struct {
+				EcdsFilter json.RawMessage `json:"ecds_filter"`
+			} `json:"ecds_filters"`
+		}{}
+		if err := json.Unmarshal(raw, &section); err != nil || section.Type != ecdsConfigDumpType {
+			continue
+		}
+		for _, filter := range section.EcdsFilters {
+			config := &core.TypedExtensionConfig{}
+			if err := (&jsonpb.Unmarshaler{AllowUnknownFields: true}).Unmarshal(bytes.NewReader(filter.EcdsFilter), config); err != nil {
+				continue
+			}
+			if name := wasmConfigName(config.GetTypedConfig()); name != "" {
+				names[config.GetName()] = name
+			}
+		}
+	}
+	return names
+}
@@ -0,0 +1,148 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configdump
+
+import (
+	"testing"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	httpConn "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+	structpb "github.com/golang/protobuf/ptypes/struct"
+	"github.com/google/go-cmp/cmp"
+
+	"istio.io/istio/pilot/pkg/networking/util"
+	"istio.io/istio/pkg/servicemesh/extension"
+)
+
+func wasmFilter(name string) *httpConn.HttpFilter {
+	return &httpConn.HttpFilter{
+		Name: wasmFilterName,
+		ConfigType: &httpConn.HttpFilter_TypedConfig{
+			TypedConfig: util.MessageToAny(&structpb.Struct{
+				Fields: map[string]*structpb.Value{
+					"config": {Kind: &structpb.Value_StructValue{StructValue: &structpb.Struct{Fields: map[string]*structpb.Value{
+						"name": {Kind: &structpb.Value_StringValue{StringValue: name}},
+					}}}},
+				},
+			}),
+		},
+	}
+}
+
+func configDiscoveryFilter(name string) *httpConn.HttpFilter {
+	return &httpConn.HttpFilter{
+		Name: name,
+		ConfigType: &httpConn.HttpFilter_ConfigDiscovery{
+			ConfigDiscovery: &core.ExtensionConfigSource{
+				TypeUrls: []string{extension.WasmFilterTypeURL},
+			},
+		},
+	}
+}
+
+func TestRetrieveHTTPFilterOrder(t *testing.T) {
+	hcm := &httpConn.HttpConnectionManager{
+		HttpFilters: []*httpConn.HttpFilter{
+			wasmFilter("header-append"),
+			configDiscoveryFilter("istio-system.request-log"),
+			configDiscoveryFilter("istio-system.rate-limit"),
+			{Name: "istio_authn"},
+			wasmFilter("auth-audit"),
+			{Name: "envoy.filters.http.rbac"},
+			{Name: "envoy.router"},
+		},
+	}
+	l := &listener.Listener{
+		Name: "virtualInbound",
+		FilterChains: []*listener.FilterChain{
+			{
+				Name: "10.0.0.1_8080",
+				Filters: []*listener.Filter{
+					{
+						Name:       wellknown.HTTPConnectionManager,
+						ConfigType: &listener.Filter_TypedConfig{TypedConfig: util.MessageToAny(hcm)},
+					},
+				},
+			},
+			{
+				Filters: []*listener.Filter{
+					{Name: wellknown.TCPProxy},
+				},
+			},
+		},
+	}
+
+	extensionConfigs := map[string]string{"istio-system.rate-limit": "ratelimit"}
+	entries, err := retrieveHTTPFilterOrder(l, extensionConfigs)
+	if err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+	expected := []httpFilterEntry{
+		{filterChain: "10.0.0.1_8080", name: wasmFilterName, extension: "header-append"},
+		{filterChain: "10.0.0.1_8080", name: "istio-system.request-log", extension: "request-log"},
+		{filterChain: "10.0.0.1_8080", name: "istio-system.rate-limit", extension: "ratelimit"},
+		{filterChain: "10.0.0.1_8080", name: "istio_authn", extension: "-"},
+		{filterChain: "10.0.0.1_8080", name: wasmFilterName, extension: "auth-audit"},
+		{filterChain: "10.0.0.1_8080", name: "envoy.filters.http.rbac", extension: "-"},
+		{filterChain: "10.0.0.1_8080", name: "envoy.router", extension: "-"},
+	}
+	if !cmp.Equal(entries, expected, cmp.AllowUnexported(httpFilterEntry{})) {
+		t.Errorf("unexpected filter order: %s", cmp.Diff(entries, expected, cmp.AllowUnexported(httpFilterEntry{})))
+	}
+}
+
+func TestExtensionConfigNames(t *testing.T) {
+	configDump := []byte(`{
+  "configs": [
+    {
+      "@type": "type.googleapis.com/envoy.admin.v3.ListenersConfigDump"
+    },
+    {
+      "@type": "type.googleapis.com/envoy.admin.v3.EcdsConfigDump",
+      "ecds_filters": [
+        {
+          "version_info": "1",
+          "ecds_filter": {
+            "@type": "type.googleapis.com/envoy.config.core.v3.TypedExtensionConfig",
+            "name": "istio-system.rate-limit",
+            "typed_config": {
+              "@type": "type.googleapis.com/envoy.extensions.filters.http.wasm.v3.Wasm",
+              "config": {
+                "name": "ratelimit"
+              }
+            }
+          }
+        },
+        {
+          "version_info": "1",
+          "ecds_filter": {
+            "@type": "type.googleapis.com/envoy.config.core.v3.TypedExtensionConfig",
+            "name": "istio-system.unparsable",
+            "typed_config": {
+              "@type": "type.googleapis.com/unknown.Type"
+            }
+          }
+        }
+      ]
+    }
+  ]
+}`)
+	expected := map[string]string{"istio-system.rate-limit": "ratelimit"}
+	if names := extensionConfigNames(configDump); !cmp.Equal(names, expected) {
+		t.Errorf("unexpected extension config names: %s", cmp.Diff(names, expected))
+	}
+}
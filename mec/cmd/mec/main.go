@@ -24,10 +24,14 @@ import (
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/client-go/tools/cache"
 
+	"istio.io/istio/mec/pkg/model"
+	"istio.io/istio/mec/pkg/pullstrategy/oci"
 	"istio.io/istio/mec/pkg/pullstrategy/ossm"
 	"istio.io/istio/mec/pkg/server"
+	"istio.io/istio/mec/pkg/verification"
 	"istio.io/istio/pkg/kube"
 	"istio.io/istio/pkg/servicemesh/apis/servicemesh/v1alpha1"
 	memberroll "istio.io/istio/pkg/servicemesh/controller"
@@ -38,6 +42,9 @@ import (
 
 const (
 	defaultResyncPeriod = time.Minute * 5
+
+	pullStrategyOSSM = "ossm"
+	pullStrategyOCI  = "oci"
 )
 
 var (
@@ -47,6 +54,14 @@ var (
 	registryURL    string
 	resyncPeriod   string
 	namespace      string
+	pullStrategy   string
+	cacheDirectory string
+	policyFile     string
+	diskQuota      string
+	gcInterval     time.Duration
+	gcGracePeriod  time.Duration
+
+	insecureRegistries []string
 )
 
 func main() {
@@ -88,11 +103,42 @@ func createCommand(args []string) *cobra.Command {
 				log.Errorf("Failed to create Extension Controller: %v", err)
 			}
 
-			p, err := ossm.NewOSSMPullStrategy(config, namespace)
+			var p model.ImagePullStrategy
+			switch pullStrategy {
+			case pullStrategyOSSM:
+				p, err = ossm.NewOSSMPullStrategy(config, namespace)
+				if err != nil {
+					log.Errorf("Failed to create OSSMPullStrategy: %v", err)
+				}
+			case pullStrategyOCI:
+				p, err = oci.NewOCIPullStrategy(cacheDirectory, insecureRegistries)
+				if err != nil {
+					log.Errorf("Failed to create OCIPullStrategy: %v", err)
+					return
+				}
+			default:
+				log.Errorf("Unknown pull strategy '%s', must be one of %s, %s", pullStrategy, pullStrategyOSSM, pullStrategyOCI)
+				return
+			}
+			var verifier *verification.Verifier
+			if policyFile != "" {
+				verifier, err = verification.LoadPolicy(policyFile)
+				if err != nil {
+					log.Errorf("Failed to load verification policy: %v", err)
+					return
+				}
+			}
+			quota, err := resource.ParseQuantity(diskQuota)
+			if err != nil {
+				log.Errorf("Failed to parse --diskQuota parameter: %v", err)
+				return
+			}
+			modules, err := server.NewModuleStore(serveDirectory, quota.Value(), gcGracePeriod)
 			if err != nil {
-				log.Errorf("Failed to create OSSMPullStrategy: %v", err)
+				log.Errorf("Failed to create module store: %v", err)
+				return
 			}
-			w, err := server.NewWorker(config, p, baseURL, serveDirectory)
+			w, err := server.NewWorker(config, p, verifier, baseURL, modules)
 			if err != nil {
 				log.Errorf("Failed to create worker: %v", err)
 				return
@@ -118,7 +164,10 @@ func createCommand(args []string) *cobra.Command {
 				},
 			})
 
-			ws := server.NewHTTPServer(8080, serveDirectory)
+			ws := server.NewHTTPServer(8080, serveDirectory, modules)
+			if err := ws.EnableMetrics(); err != nil {
+				log.Errorf("Failed to enable metrics: %v", err)
+			}
 
 			fw := filewatcher.NewWatcher()
 			err = fw.Add(tokenPath)
@@ -159,6 +208,7 @@ func createCommand(args []string) *cobra.Command {
 			ec.Start(stopChan)
 			w.Start(stopChan)
 			ws.Start(stopChan)
+			modules.Start(gcInterval, stopChan)
 
 			sigc := make(chan os.Signal, 1)
 			signal.Notify(sigc,
@@ -182,6 +232,20 @@ func createCommand(args []string) *cobra.Command {
 	cmd.PersistentFlags().StringVar(&registryURL, "registryURL", "image-registry.openshift-image-registry.svc:5000",
 		"Registry from which to pull images by default")
 	cmd.PersistentFlags().StringVar(&namespace, "namespace", "istio-system", "The namespace that MEC is running in")
+	cmd.PersistentFlags().StringVar(&pullStrategy, "pullStrategy", pullStrategyOSSM,
+		"Strategy used to pull extension images, either 'ossm' (podman and ImageStreams) or 'oci' (native registry client)")
+	cmd.PersistentFlags().StringVar(&cacheDirectory, "cacheDirectory", "/var/cache/mec",
+		"Directory in which the oci pull strategy caches image manifests and layers")
+	cmd.PersistentFlags().StringSliceVar(&insecureRegistries, "insecureRegistries", []string{},
+		"Registries the oci pull strategy accesses via plain HTTP")
+	cmd.PersistentFlags().StringVar(&policyFile, "verificationPolicy", "",
+		"File containing the policy that WASM modules are verified against before they are served. Verification is disabled if empty")
+	cmd.PersistentFlags().StringVar(&diskQuota, "diskQuota", "0",
+		"Maximum size of the WASM modules in the serve directory, e.g. 512Mi. Unreferenced modules are evicted to stay within the quota. Unlimited if 0")
+	cmd.PersistentFlags().DurationVar(&gcInterval, "gcInterval", time.Minute,
+		"Interval in which WASM modules that are no longer referenced by any extension are deleted")
+	cmd.PersistentFlags().DurationVar(&gcGracePeriod, "gcGracePeriod", 10*time.Minute,
+		"Time a WASM module is kept after it stopped being referenced, so that proxies can still fetch it")
 
 	return cmd
 }
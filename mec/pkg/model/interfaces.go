@@ -28,3 +28,10 @@ type Image interface {
 	GetManifest() *Manifest
 	SHA256() string
 }
+
+// SignatureFetcher is implemented by ImagePullStrategies that are able to
+// retrieve detached signatures stored alongside an image in the registry
+type SignatureFetcher interface {
+	// GetSignatures returns all signatures for the image with the given digest
+	GetSignatures(image *ImageRef, digest string) ([]Signature, error)
+}
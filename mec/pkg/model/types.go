@@ -102,3 +102,10 @@ func StringToImageRef(ref string) (result *ImageRef) {
 
 	return result
 }
+
+// Signature is a cosign-style detached signature. Payload is the signed
+// simple signing document, Signature the raw signature over it.
+type Signature struct {
+	Payload   []byte
+	Signature []byte
+}
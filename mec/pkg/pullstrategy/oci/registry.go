@@ -0,0 +1,395 @@
+// Copyright Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultRegistry       = "docker.io"
+	defaultRegistryMirror = "registry-1.docker.io"
+
+	headerAuthorization  = "Authorization"
+	headerAuthenticate   = "WWW-Authenticate"
+	headerAccept         = "Accept"
+	headerContentDigest  = "Docker-Content-Digest"
+	digestPrefixSHA256   = "sha256:"
+	loginUsername        = "mec"
+	loginSucceededOutput = "Login Succeeded!"
+)
+
+var (
+	errManifestNotFound = errors.New("manifest not found")
+
+	// digestRegexp matches the only digests we accept. Digests end up in
+	// cache file names, anything else could escape the cache directory.
+	digestRegexp = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+)
+
+// validateDigest returns an error unless digest is a well-formed sha256 digest
+func validateDigest(digest string) error {
+	if !digestRegexp.MatchString(digest) {
+		return fmt.Errorf("invalid digest %q", digest)
+	}
+	return nil
+}
+
+// credential holds the username and password used to authenticate against a registry
+type credential struct {
+	username string
+	password string
+}
+
+// registryClient implements the parts of the OCI distribution protocol that
+// are required to pull an image: fetching manifests and blobs, including
+// basic and bearer token authentication.
+type registryClient struct {
+	httpClient *http.Client
+	insecure   map[string]bool
+
+	mut         sync.RWMutex
+	credentials map[string]credential
+	tokens      map[string]string
+}
+
+func newRegistryClient(httpClient *http.Client, insecureRegistries []string) *registryClient {
+	insecure := map[string]bool{}
+	for _, registry := range insecureRegistries {
+		insecure[registry] = true
+	}
+	return &registryClient{
+		httpClient:  httpClient,
+		insecure:    insecure,
+		credentials: map[string]credential{},
+		tokens:      map[string]string{},
+	}
+}
+
+// repository identifies a repository on a specific registry
+type repository struct {
+	registry string
+	name     string
+}
+
+// splitHub splits the hub of an ImageRef into the registry host and the
+// repository namespace, e.g. "quay.io/maistra" becomes "quay.io" and "maistra".
+func splitHub(hub string) (registry, namespace string) {
+	parts := strings.SplitN(hub, "/", 2)
+	if len(parts) == 1 {
+		if strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost" {
+			return parts[0], ""
+		}
+		return defaultRegistry, parts[0]
+	}
+	if strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost" {
+		return parts[0], parts[1]
+	}
+	return defaultRegistry, hub
+}
+
+func newRepository(hub, repo string) repository {
+	registry, namespace := splitHub(hub)
+	name := repo
+	if namespace != "" {
+		name = namespace + "/" + repo
+	}
+	return repository{
+		registry: registry,
+		name:     name,
+	}
+}
+
+func (c *registryClient) baseURL(registry string) string {
+	scheme := "https"
+	if c.insecure[registry] {
+		scheme = "http"
+	}
+	if registry == defaultRegistry {
+		registry = defaultRegistryMirror
+	}
+	return fmt.Sprintf("%s://%s", scheme, registry)
+}
+
+// normalizeRegistry strips scheme and path from a registry URL as passed in via --registryURL
+func normalizeRegistry(registryURL string) string {
+	if u, err := url.Parse(registryURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return strings.SplitN(registryURL, "/", 2)[0]
+}
+
+func (c *registryClient) login(registryURL, token string) (string, error) {
+	registry := normalizeRegistry(registryURL)
+	c.mut.Lock()
+	c.credentials[registry] = credential{
+		username: loginUsername,
+		password: token,
+	}
+	// drop any tokens that were obtained with the previous credentials
+	for key := range c.tokens {
+		if strings.HasPrefix(key, registry+"|") {
+			delete(c.tokens, key)
+		}
+	}
+	c.mut.Unlock()
+
+	resp, err := c.do(registry, "", http.MethodGet, c.baseURL(registry)+"/v2/", nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("login to %s failed: %s", registry, resp.Status)
+	}
+	return loginSucceededOutput, nil
+}
+
+func (c *registryClient) getCredential(registry string) (credential, bool) {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	cred, ok := c.credentials[registry]
+	return cred, ok
+}
+
+// do executes a request against the registry. If the registry responds with
+// 401 Unauthorized, the challenge is answered and the request is retried once.
+func (c *registryClient) do(registry, scope, method, reqURL string, header http.Header) (*http.Response, error) {
+	tokenKey := registry + "|" + scope
+	c.mut.RLock()
+	token := c.tokens[tokenKey]
+	c.mut.RUnlock()
+
+	req, err := newRequest(method, reqURL, header)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set(headerAuthorization, "Bearer "+token)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		return resp, nil
+	}
+	challenge := resp.Header.Get(headerAuthenticate)
+	resp.Body.Close()
+
+	scheme, params := parseChallenge(challenge)
+	req, err = newRequest(method, reqURL, header)
+	if err != nil {
+		return nil, err
+	}
+	switch scheme {
+	case "basic":
+		cred, ok := c.getCredential(registry)
+		if !ok {
+			return nil, fmt.Errorf("registry %s requires authentication but no credentials are configured", registry)
+		}
+		req.SetBasicAuth(cred.username, cred.password)
+	case "bearer":
+		if params["scope"] == "" && scope != "" {
+			params["scope"] = scope
+		}
+		token, err = c.fetchToken(registry, params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to obtain bearer token from %s: %v", params["realm"], err)
+		}
+		c.mut.Lock()
+		c.tokens[tokenKey] = token
+		c.mut.Unlock()
+		req.Header.Set(headerAuthorization, "Bearer "+token)
+	default:
+		return nil, fmt.Errorf("unsupported authentication challenge from registry %s: '%s'", registry, challenge)
+	}
+	return c.httpClient.Do(req)
+}
+
+func newRequest(method, reqURL string, header http.Header) (*http.Request, error) {
+	req, err := http.NewRequest(method, reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	return req, nil
+}
+
+type tokenResponse struct {
+	Token       string `json:"token"`
+	AccessToken string `json:"access_token"`
+}
+
+func (c *registryClient) fetchToken(registry string, params map[string]string) (string, error) {
+	realm := params["realm"]
+	if realm == "" {
+		return "", fmt.Errorf("bearer challenge is missing realm")
+	}
+	tokenURL, err := url.Parse(realm)
+	if err != nil {
+		return "", err
+	}
+	query := tokenURL.Query()
+	if service := params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	if scope := params["scope"]; scope != "" {
+		query.Set("scope", scope)
+	}
+	tokenURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, tokenURL.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if cred, ok := c.getCredential(registry); ok {
+		req.SetBasicAuth(cred.username, cred.password)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+	tr := tokenResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
+		return "", fmt.Errorf("failed to decode token response: %v", err)
+	}
+	if tr.Token != "" {
+		return tr.Token, nil
+	}
+	if tr.AccessToken != "" {
+		return tr.AccessToken, nil
+	}
+	return "", fmt.Errorf("token response did not contain a token")
+}
+
+// parseChallenge parses a WWW-Authenticate header value, e.g.
+// Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:foo/bar:pull"
+func parseChallenge(challenge string) (scheme string, params map[string]string) {
+	params = map[string]string{}
+	challenge = strings.TrimSpace(challenge)
+	i := strings.Index(challenge, " ")
+	if i < 0 {
+		return strings.ToLower(challenge), params
+	}
+	scheme = strings.ToLower(challenge[:i])
+	rest := challenge[i+1:]
+	for len(rest) > 0 {
+		rest = strings.TrimLeft(rest, " ,")
+		eq := strings.Index(rest, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = rest[eq+1:]
+		var value string
+		if strings.HasPrefix(rest, "\"") {
+			end := strings.Index(rest[1:], "\"")
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			end := strings.Index(rest, ",")
+			if end < 0 {
+				value, rest = rest, ""
+			} else {
+				value, rest = rest[:end], rest[end:]
+			}
+		}
+		params[key] = value
+	}
+	return scheme, params
+}
+
+func pullScope(repo repository) string {
+	return fmt.Sprintf("repository:%s:pull", repo.name)
+}
+
+// fetchManifest retrieves the manifest for the given reference (tag or digest)
+// and returns its raw bytes together with its verified sha256 digest.
+func (c *registryClient) fetchManifest(repo repository, reference string) ([]byte, string, error) {
+	if strings.HasPrefix(reference, digestPrefixSHA256) {
+		if err := validateDigest(reference); err != nil {
+			return nil, "", err
+		}
+	}
+	reqURL := fmt.Sprintf("%s/v2/%s/manifests/%s", c.baseURL(repo.registry), repo.name, reference)
+	header := http.Header{}
+	header.Add(headerAccept, mediaTypeOCIManifest)
+	header.Add(headerAccept, mediaTypeDockerManifest)
+	resp, err := c.do(repo.registry, pullScope(repo), http.MethodGet, reqURL, header)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, "", fmt.Errorf("failed to fetch manifest %s: %w", reqURL, errManifestNotFound)
+	} else if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("failed to fetch manifest %s: %s", reqURL, resp.Status)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxManifestSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(body) > maxManifestSize {
+		return nil, "", fmt.Errorf("manifest %s exceeds maximum size of %d bytes", reqURL, maxManifestSize)
+	}
+	digest := digestPrefixSHA256 + fmt.Sprintf("%x", sha256.Sum256(body))
+	if strings.HasPrefix(reference, digestPrefixSHA256) && reference != digest {
+		return nil, "", fmt.Errorf("manifest digest mismatch: requested %s but got %s", reference, digest)
+	}
+	if headerDigest := resp.Header.Get(headerContentDigest); headerDigest != "" && headerDigest != digest {
+		return nil, "", fmt.Errorf("manifest digest mismatch: registry reported %s but got %s", headerDigest, digest)
+	}
+	return body, digest, nil
+}
+
+// fetchBlob opens a stream to the blob with the given digest. The caller is
+// responsible for verifying the content and closing the returned reader.
+func (c *registryClient) fetchBlob(repo repository, digest string) (io.ReadCloser, error) {
+	if err := validateDigest(digest); err != nil {
+		return nil, err
+	}
+	reqURL := fmt.Sprintf("%s/v2/%s/blobs/%s", c.baseURL(repo.registry), repo.name, digest)
+	resp, err := c.do(repo.registry, pullScope(repo), http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to fetch blob %s: %s", reqURL, resp.Status)
+	}
+	return resp.Body, nil
+}
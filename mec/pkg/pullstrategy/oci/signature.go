@@ -0,0 +1,93 @@
+// Copyright Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"istio.io/istio/mec/pkg/model"
+)
+
+const (
+	// cosign stores signatures as an image tagged sha256-<digest>.sig in the same repository
+	signatureTagSuffix  = ".sig"
+	signatureAnnotation = "dev.cosignproject.cosign/signature"
+	maxPayloadSize      = 1024 * 1024
+)
+
+func signatureTag(digest string) string {
+	return "sha256-" + hexDigest(digest) + signatureTagSuffix
+}
+
+// GetSignatures retrieves the cosign signatures of the image with the given digest.
+// An image without signatures yields an empty list.
+func (p *ociPullStrategy) GetSignatures(image *model.ImageRef, digest string) ([]model.Signature, error) {
+	repo := newRepository(image.Hub, image.Repository)
+	manifestBytes, _, err := p.client.fetchManifest(repo, signatureTag(digest))
+	if errors.Is(err, errManifestNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	manifest := &imageManifest{}
+	if err := json.Unmarshal(manifestBytes, manifest); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal signature manifest: %v", err)
+	}
+	signatures := []model.Signature{}
+	for _, layer := range manifest.Layers {
+		encoded, ok := layer.Annotations[signatureAnnotation]
+		if !ok {
+			continue
+		}
+		sig, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode signature of layer %s: %v", layer.Digest, err)
+		}
+		payload, err := p.fetchPayload(repo, layer)
+		if err != nil {
+			return nil, err
+		}
+		signatures = append(signatures, model.Signature{
+			Payload:   payload,
+			Signature: sig,
+		})
+	}
+	return signatures, nil
+}
+
+func (p *ociPullStrategy) fetchPayload(repo repository, layer descriptor) ([]byte, error) {
+	body, err := p.client.fetchBlob(repo, layer.Digest)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	payload, err := ioutil.ReadAll(io.LimitReader(body, maxPayloadSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) > maxPayloadSize {
+		return nil, fmt.Errorf("signature payload %s exceeds maximum size of %d bytes", layer.Digest, maxPayloadSize)
+	}
+	if actual := fmt.Sprintf("%s%x", digestPrefixSHA256, sha256.Sum256(payload)); actual != layer.Digest {
+		return nil, fmt.Errorf("digest mismatch for signature payload %s: got %s", layer.Digest, actual)
+	}
+	return payload, nil
+}
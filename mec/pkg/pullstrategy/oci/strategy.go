@@ -0,0 +1,392 @@
+// Copyright Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"istio.io/istio/mec/pkg/model"
+	"istio.io/pkg/log"
+)
+
+const (
+	mediaTypeOCIManifest    = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeDockerManifest = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeWasmLayer      = "application/vnd.module.wasm.content.layer.v1+wasm"
+
+	manifestFileName = "manifest.yaml"
+	maxManifestSize  = 4 * 1024 * 1024
+
+	defaultTimeout = 5 * time.Minute
+)
+
+// imageManifest is the subset of the OCI image manifest (and docker v2 schema2 manifest) we need
+type imageManifest struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType,omitempty"`
+	Config        descriptor   `json:"config"`
+	Layers        []descriptor `json:"layers"`
+}
+
+type descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type ociPullStrategy struct {
+	client   *registryClient
+	cacheDir string
+}
+
+// NewOCIPullStrategy returns an ImagePullStrategy that pulls images directly
+// from an OCI compliant registry and caches manifests and layers in cacheDir.
+// Registries listed in insecureRegistries are accessed via plain HTTP.
+func NewOCIPullStrategy(cacheDir string, insecureRegistries []string) (model.ImagePullStrategy, error) {
+	return newOCIPullStrategy(&http.Client{Timeout: defaultTimeout}, cacheDir, insecureRegistries)
+}
+
+func newOCIPullStrategy(httpClient *http.Client, cacheDir string, insecureRegistries []string) (*ociPullStrategy, error) {
+	for _, dir := range []string{blobDir(cacheDir), manifestDir(cacheDir)} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create cache directory %s: %v", dir, err)
+		}
+	}
+	return &ociPullStrategy{
+		client:   newRegistryClient(httpClient, insecureRegistries),
+		cacheDir: cacheDir,
+	}, nil
+}
+
+func blobDir(cacheDir string) string {
+	return filepath.Join(cacheDir, "blobs", "sha256")
+}
+
+func manifestDir(cacheDir string) string {
+	return filepath.Join(cacheDir, "manifests", "sha256")
+}
+
+func hexDigest(digest string) string {
+	return strings.TrimPrefix(digest, digestPrefixSHA256)
+}
+
+func (p *ociPullStrategy) blobPath(digest string) string {
+	return filepath.Join(blobDir(p.cacheDir), hexDigest(digest))
+}
+
+func (p *ociPullStrategy) manifestPath(digest string) string {
+	return filepath.Join(manifestDir(p.cacheDir), hexDigest(digest))
+}
+
+// GetImage returns an image that has been pulled previously
+func (p *ociPullStrategy) GetImage(image *model.ImageRef) (model.Image, error) {
+	// only works with imageRefs that come with a SHA256 value
+	if image.SHA256 == "" {
+		return nil, fmt.Errorf("getImage() only works for pinned images")
+	}
+	if err := validateDigest(digestPrefixSHA256 + image.SHA256); err != nil {
+		return nil, err
+	}
+	manifestBytes, err := ioutil.ReadFile(p.manifestPath(image.SHA256))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	manifest := &imageManifest{}
+	if err := json.Unmarshal(manifestBytes, manifest); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal cached manifest: %v", err)
+	}
+	if err := validateLayerDigests(manifest); err != nil {
+		return nil, err
+	}
+	for _, layer := range manifest.Layers {
+		if _, err := os.Stat(p.blobPath(layer.Digest)); os.IsNotExist(err) {
+			// incomplete cache entry, needs to be pulled again
+			return nil, nil
+		}
+	}
+	return p.newImage(digestPrefixSHA256+image.SHA256, manifest)
+}
+
+// PullImage retrieves an image from a remote registry
+func (p *ociPullStrategy) PullImage(image *model.ImageRef) (model.Image, error) {
+	repo := newRepository(image.Hub, image.Repository)
+	reference := image.Tag
+	if image.SHA256 != "" {
+		reference = digestPrefixSHA256 + image.SHA256
+	}
+	log.Infof("Pulling image %s", image.String())
+	manifestBytes, digest, err := p.client.fetchManifest(repo, reference)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &imageManifest{}
+	if err := json.Unmarshal(manifestBytes, manifest); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal manifest: %v", err)
+	}
+	if manifest.SchemaVersion != 2 {
+		return nil, fmt.Errorf("unsupported manifest schema version %d", manifest.SchemaVersion)
+	}
+	if len(manifest.Layers) == 0 {
+		return nil, fmt.Errorf("image %s does not contain any layers", image.String())
+	}
+	if err := validateLayerDigests(manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest for image %s: %v", image.String(), err)
+	}
+	for _, layer := range manifest.Layers {
+		if err := p.pullBlob(repo, layer); err != nil {
+			return nil, err
+		}
+	}
+	if err := writeFileAtomic(p.manifestPath(digest), manifestBytes); err != nil {
+		return nil, fmt.Errorf("failed to cache manifest: %v", err)
+	}
+	log.Infof("Pulled image %s with digest %s", image.String(), digest)
+	return p.newImage(digest, manifest)
+}
+
+// Login is used to provide credentials for the given registry
+func (p *ociPullStrategy) Login(registryURL, token string) (string, error) {
+	return p.client.login(registryURL, token)
+}
+
+// pullBlob downloads a blob into the cache unless it is already present,
+// verifying both its size and digest.
+func (p *ociPullStrategy) pullBlob(repo repository, layer descriptor) error {
+	if err := validateDigest(layer.Digest); err != nil {
+		return err
+	}
+	filename := p.blobPath(layer.Digest)
+	if _, err := os.Stat(filename); err == nil {
+		log.Debugf("Layer %s already cached", layer.Digest)
+		return nil
+	}
+	body, err := p.client.fetchBlob(repo, layer.Digest)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	tmpFile, err := ioutil.TempFile(blobDir(p.cacheDir), "download-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmpFile, h), body)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to download blob %s: %v", layer.Digest, err)
+	}
+	if layer.Size > 0 && n != layer.Size {
+		return fmt.Errorf("size mismatch for blob %s: expected %d bytes but got %d", layer.Digest, layer.Size, n)
+	}
+	if actual := fmt.Sprintf("%s%x", digestPrefixSHA256, h.Sum(nil)); actual != layer.Digest {
+		return fmt.Errorf("digest mismatch for blob %s: got %s", layer.Digest, actual)
+	}
+	return os.Rename(tmpFile.Name(), filename)
+}
+
+// validateLayerDigests checks the layer digests of a manifest before they are
+// used to build paths into the cache.
+func validateLayerDigests(manifest *imageManifest) error {
+	for _, layer := range manifest.Layers {
+		if err := validateDigest(layer.Digest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeFileAtomic(filename string, data []byte) error {
+	tmpFile, err := ioutil.TempFile(filepath.Dir(filename), "tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	_, err = tmpFile.Write(data)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), filename)
+}
+
+type ociImage struct {
+	sha256   string
+	layers   []descriptor
+	manifest *model.Manifest
+	cacheDir string
+}
+
+func (p *ociPullStrategy) newImage(digest string, manifest *imageManifest) (*ociImage, error) {
+	img := &ociImage{
+		sha256:   digest,
+		layers:   manifest.Layers,
+		cacheDir: p.cacheDir,
+	}
+	if wasmLayer := img.wasmLayer(); wasmLayer != nil {
+		// wasm artifacts carry no manifest.yaml, the module is the layer itself
+		img.manifest = &model.Manifest{
+			SchemaVersion: model.ManifestSchemaVersion1,
+			Module:        hexDigest(wasmLayer.Digest) + ".wasm",
+		}
+		return img, nil
+	}
+	var buf bytes.Buffer
+	found, err := img.extractFile(manifestFileName, &buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract manifest from container image: %v", err)
+	}
+	if !found {
+		return nil, fmt.Errorf("container image does not contain %s", manifestFileName)
+	}
+	img.manifest = &model.Manifest{}
+	if err := yaml.Unmarshal(buf.Bytes(), img.manifest); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal manifest.yaml: %v", err)
+	}
+	return img, nil
+}
+
+func (ref *ociImage) wasmLayer() *descriptor {
+	for i := range ref.layers {
+		if ref.layers[i].MediaType == mediaTypeWasmLayer {
+			return &ref.layers[i]
+		}
+	}
+	return nil
+}
+
+func (ref *ociImage) layerPath(layer descriptor) string {
+	return filepath.Join(blobDir(ref.cacheDir), hexDigest(layer.Digest))
+}
+
+// extractFile looks up a file in the image's layers and writes its content to w.
+// Layers are searched top-down, so files in upper layers shadow lower ones.
+func (ref *ociImage) extractFile(name string, w io.Writer) (bool, error) {
+	name = normalizePath(name)
+	for i := len(ref.layers) - 1; i >= 0; i-- {
+		found, err := extractFileFromLayer(ref.layerPath(ref.layers[i]), name, w)
+		if err != nil || found {
+			return found, err
+		}
+	}
+	return false, nil
+}
+
+func normalizePath(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+func extractFileFromLayer(layerFile, name string, w io.Writer) (bool, error) {
+	f, err := os.Open(layerFile)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	var r io.Reader = bufio.NewReader(f)
+	// layers may or may not be compressed, regardless of what the media type claims
+	if magic, err := r.(*bufio.Reader).Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return false, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return false, nil
+		} else if err != nil {
+			return false, fmt.Errorf("failed to read layer %s: %v", filepath.Base(layerFile), err)
+		}
+		if hdr.Typeflag != tar.TypeReg || normalizePath(hdr.Name) != name {
+			continue
+		}
+		if _, err := io.Copy(w, tr); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+}
+
+func (ref *ociImage) CopyWasmModule(outputFile string) (err error) {
+	out, err := os.Create(outputFile)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			// don't leave a partial module behind, it would be served as is
+			os.Remove(outputFile)
+		}
+	}()
+
+	if wasmLayer := ref.wasmLayer(); wasmLayer != nil {
+		in, err := os.Open(ref.layerPath(*wasmLayer))
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		_, err = io.Copy(out, in)
+		return err
+	}
+
+	found, err := ref.extractFile(ref.manifest.Module, out)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("container image does not contain wasm module %s", ref.manifest.Module)
+	}
+	return nil
+}
+
+func (ref *ociImage) GetManifest() *model.Manifest {
+	return ref.manifest
+}
+
+func (ref *ociImage) SHA256() string {
+	return hexDigest(ref.sha256)
+}
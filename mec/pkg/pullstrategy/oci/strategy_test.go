@@ -0,0 +1,545 @@
+// Copyright Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"istio.io/istio/mec/pkg/model"
+	fakestrategy "istio.io/istio/mec/pkg/pullstrategy/fake"
+)
+
+const (
+	testToken       = "s3cr3t"
+	testBearerToken = "bearer-token"
+)
+
+// fakeRegistry is a minimal in-process stand-in for an OCI distribution registry
+type fakeRegistry struct {
+	auth      string // "", "basic" or "bearer"
+	manifests map[string][]byte
+	blobs     map[string][]byte
+	// corruptBlobs serves wrong content for all blobs
+	corruptBlobs bool
+	blobRequests int
+	server       *httptest.Server
+}
+
+func newFakeRegistry(auth string) *fakeRegistry {
+	r := &fakeRegistry{
+		auth:      auth,
+		manifests: map[string][]byte{},
+		blobs:     map[string][]byte{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", r.handleToken)
+	mux.HandleFunc("/v2/", r.handleV2)
+	r.server = httptest.NewServer(mux)
+	return r
+}
+
+func (r *fakeRegistry) host() string {
+	u, _ := url.Parse(r.server.URL)
+	return u.Host
+}
+
+func digestOf(data []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+}
+
+func (r *fakeRegistry) push(repo, tag string, layers []descriptor, layerData [][]byte) string {
+	for i, data := range layerData {
+		r.blobs[layers[i].Digest] = data
+	}
+	manifest, _ := json.Marshal(imageManifest{
+		SchemaVersion: 2,
+		MediaType:     mediaTypeOCIManifest,
+		Layers:        layers,
+	})
+	digest := digestOf(manifest)
+	r.manifests[repo+":"+tag] = manifest
+	r.manifests[repo+":"+digest] = manifest
+	return digest
+}
+
+func (r *fakeRegistry) authorized(req *http.Request) bool {
+	switch r.auth {
+	case "basic":
+		user, pass, ok := req.BasicAuth()
+		return ok && user == loginUsername && pass == testToken
+	case "bearer":
+		return req.Header.Get(headerAuthorization) == "Bearer "+testBearerToken
+	}
+	return true
+}
+
+func (r *fakeRegistry) handleToken(w http.ResponseWriter, req *http.Request) {
+	user, pass, ok := req.BasicAuth()
+	if !ok || user != loginUsername || pass != testToken {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(tokenResponse{Token: testBearerToken})
+}
+
+func (r *fakeRegistry) handleV2(w http.ResponseWriter, req *http.Request) {
+	if !r.authorized(req) {
+		switch r.auth {
+		case "basic":
+			w.Header().Set(headerAuthenticate, `Basic realm="fake"`)
+		case "bearer":
+			w.Header().Set(headerAuthenticate, fmt.Sprintf(`Bearer realm="%s/token",service="fake"`, r.server.URL))
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	p := strings.TrimPrefix(req.URL.Path, "/v2/")
+	if p == "" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if i := strings.Index(p, "/manifests/"); i > -1 {
+		manifest, ok := r.manifests[p[:i]+":"+p[i+len("/manifests/"):]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set(headerContentDigest, digestOf(manifest))
+		_, _ = w.Write(manifest)
+		return
+	}
+	if i := strings.Index(p, "/blobs/"); i > -1 {
+		r.blobRequests++
+		blob, ok := r.blobs[p[i+len("/blobs/"):]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.corruptBlobs {
+			blob = append([]byte("corrupt"), blob[7:]...)
+		}
+		_, _ = w.Write(blob)
+		return
+	}
+	w.WriteHeader(http.StatusNotFound)
+}
+
+func createLayer(t *testing.T, files map[string]string, compress bool) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var tw *tar.Writer
+	var gz *gzip.Writer
+	if compress {
+		gz = gzip.NewWriter(&buf)
+		tw = tar.NewWriter(gz)
+	} else {
+		tw = tar.NewWriter(&buf)
+	}
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func layerDescriptor(mediaType string, data []byte) descriptor {
+	return descriptor{
+		MediaType: mediaType,
+		Digest:    digestOf(data),
+		Size:      int64(len(data)),
+	}
+}
+
+func TestPullImage(t *testing.T) {
+	manifestYAML := fakestrategy.FakeManifestYAML + "module: extension.wasm\n"
+	expectedManifest := fakestrategy.FakeManifest
+	expectedManifest.Module = "extension.wasm"
+
+	baseLayer := createLayer(t, map[string]string{
+		"manifest.yaml":  "schemaVersion: 1\nname: shadowed\n",
+		"extension.wasm": "old",
+	}, true)
+	topLayer := createLayer(t, map[string]string{
+		"./manifest.yaml": manifestYAML,
+		"/extension.wasm": fakestrategy.FakeModule,
+	}, false)
+	wasmArtifact := []byte(fakestrategy.FakeModule2)
+
+	testCases := []struct {
+		name             string
+		auth             string
+		login            bool
+		corruptBlobs     bool
+		wasmArtifact     bool
+		pinned           bool
+		expectedError    bool
+		expectedManifest *model.Manifest
+		expectedModule   string
+	}{
+		{
+			name:             "pass_anonymous",
+			expectedManifest: &expectedManifest,
+			expectedModule:   fakestrategy.FakeModule,
+		},
+		{
+			name:             "pass_pinned",
+			pinned:           true,
+			expectedManifest: &expectedManifest,
+			expectedModule:   fakestrategy.FakeModule,
+		},
+		{
+			name:             "pass_basicAuth",
+			auth:             "basic",
+			login:            true,
+			expectedManifest: &expectedManifest,
+			expectedModule:   fakestrategy.FakeModule,
+		},
+		{
+			name:             "pass_bearerAuth",
+			auth:             "bearer",
+			login:            true,
+			expectedManifest: &expectedManifest,
+			expectedModule:   fakestrategy.FakeModule,
+		},
+		{
+			name:          "fail_bearerAuthNoLogin",
+			auth:          "bearer",
+			expectedError: true,
+		},
+		{
+			name:          "fail_corruptBlob",
+			corruptBlobs:  true,
+			expectedError: true,
+		},
+		{
+			name:         "pass_wasmArtifact",
+			wasmArtifact: true,
+			expectedManifest: &model.Manifest{
+				SchemaVersion: model.ManifestSchemaVersion1,
+				Module:        hexDigest(digestOf(wasmArtifact)) + ".wasm",
+			},
+			expectedModule: fakestrategy.FakeModule2,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			registry := newFakeRegistry(tc.auth)
+			defer registry.server.Close()
+			registry.corruptBlobs = tc.corruptBlobs
+
+			var digest string
+			if tc.wasmArtifact {
+				digest = registry.push("test/extension", "latest",
+					[]descriptor{layerDescriptor(mediaTypeWasmLayer, wasmArtifact)},
+					[][]byte{wasmArtifact})
+			} else {
+				digest = registry.push("test/extension", "latest",
+					[]descriptor{
+						layerDescriptor("application/vnd.oci.image.layer.v1.tar+gzip", baseLayer),
+						layerDescriptor("application/vnd.oci.image.layer.v1.tar", topLayer),
+					},
+					[][]byte{baseLayer, topLayer})
+			}
+
+			tmpDir, err := ioutil.TempDir("", "ocitest")
+			if err != nil {
+				t.Fatalf("failed to create temp dir: %s", err)
+			}
+			defer os.RemoveAll(tmpDir)
+
+			strategy, err := newOCIPullStrategy(registry.server.Client(), filepath.Join(tmpDir, "cache"), []string{registry.host()})
+			if err != nil {
+				t.Fatalf("failed to create strategy: %s", err)
+			}
+			if tc.login {
+				if _, err := strategy.Login("http://"+registry.host(), testToken); err != nil {
+					t.Fatalf("failed to login: %s", err)
+				}
+			}
+
+			imageRef := model.StringToImageRef(registry.host() + "/test/extension:latest")
+			if tc.pinned {
+				imageRef = model.StringToImageRef(registry.host() + "/test/extension@" + digest)
+			}
+			img, err := strategy.PullImage(imageRef)
+			if tc.expectedError {
+				if err == nil {
+					t.Fatal("Expected error but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error but got %s", err)
+			}
+			if img.SHA256() != hexDigest(digest) {
+				t.Errorf("expected SHA256 %s but got %s", hexDigest(digest), img.SHA256())
+			}
+			if !cmp.Equal(img.GetManifest(), tc.expectedManifest) {
+				t.Errorf("Manifest comparison failed: -want +got\n%v", cmp.Diff(tc.expectedManifest, img.GetManifest()))
+			}
+			outputFile := filepath.Join(tmpDir, "module")
+			if err := img.CopyWasmModule(outputFile); err != nil {
+				t.Fatalf("failed to copy wasm module: %s", err)
+			}
+			content, err := ioutil.ReadFile(outputFile)
+			if err != nil {
+				t.Fatalf("failed to read wasm module: %s", err)
+			}
+			if string(content) != tc.expectedModule {
+				t.Errorf("expected module content '%s' but got '%s'", tc.expectedModule, string(content))
+			}
+
+			// the image should now be served from the cache
+			blobRequests := registry.blobRequests
+			cachedImg, err := strategy.GetImage(&model.ImageRef{SHA256: hexDigest(digest)})
+			if err != nil {
+				t.Fatalf("failed to get cached image: %s", err)
+			}
+			if cachedImg == nil {
+				t.Fatal("expected cached image but got nil")
+			}
+			if !cmp.Equal(cachedImg.GetManifest(), tc.expectedManifest) {
+				t.Errorf("Cached manifest comparison failed: -want +got\n%v", cmp.Diff(tc.expectedManifest, cachedImg.GetManifest()))
+			}
+			if _, err := strategy.PullImage(imageRef); err != nil {
+				t.Fatalf("failed to pull image again: %s", err)
+			}
+			if registry.blobRequests != blobRequests {
+				t.Errorf("expected layers to be served from the cache, but %d blobs were fetched", registry.blobRequests-blobRequests)
+			}
+		})
+	}
+}
+
+func TestPullImageInvalidDigest(t *testing.T) {
+	registry := newFakeRegistry("")
+	defer registry.server.Close()
+
+	tmpDir, err := ioutil.TempDir("", "ocitest")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// a local file outside of the cache that a traversal digest points to
+	secret := filepath.Join(tmpDir, "secret")
+	if err := ioutil.WriteFile(secret, []byte("secret"), 0600); err != nil {
+		t.Fatalf("failed to write file: %s", err)
+	}
+	registry.push("test/extension", "latest",
+		[]descriptor{{MediaType: mediaTypeWasmLayer, Digest: "sha256:../../../secret", Size: 6}},
+		[][]byte{[]byte("secret")})
+
+	strategy, err := newOCIPullStrategy(registry.server.Client(), filepath.Join(tmpDir, "cache"), []string{registry.host()})
+	if err != nil {
+		t.Fatalf("failed to create strategy: %s", err)
+	}
+	if _, err := strategy.PullImage(model.StringToImageRef(registry.host() + "/test/extension:latest")); err == nil {
+		t.Fatal("Expected error for traversal digest but got nil")
+	}
+	if registry.blobRequests != 0 {
+		t.Errorf("expected no blobs to be fetched, but %d were", registry.blobRequests)
+	}
+
+	if _, err := strategy.PullImage(&model.ImageRef{Hub: registry.host() + "/test", Repository: "extension", SHA256: "../../secret"}); err == nil {
+		t.Error("Expected error for traversal manifest digest but got nil")
+	}
+	if _, err := strategy.GetImage(&model.ImageRef{SHA256: "../../../secret"}); err == nil {
+		t.Error("Expected error for traversal image digest but got nil")
+	}
+}
+
+func TestGetImage(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "ocitest")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	strategy, err := newOCIPullStrategy(http.DefaultClient, tmpDir, nil)
+	if err != nil {
+		t.Fatalf("failed to create strategy: %s", err)
+	}
+	if _, err := strategy.GetImage(model.StringToImageRef("docker.io/test/test:latest")); err == nil {
+		t.Error("Expected error for unpinned image but got nil")
+	}
+	img, err := strategy.GetImage(&model.ImageRef{SHA256: "41af286dc0b172ed2f1ca934fd2278de4a1192302ffa07087cea2682e7d372e3"})
+	if err != nil {
+		t.Errorf("Expected no error but got %s", err)
+	}
+	if img != nil {
+		t.Errorf("Expected nil image but got %v", img)
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	testCases := []struct {
+		challenge      string
+		expectedScheme string
+		expectedParams map[string]string
+	}{
+		{
+			challenge:      `Basic realm="registry"`,
+			expectedScheme: "basic",
+			expectedParams: map[string]string{"realm": "registry"},
+		},
+		{
+			challenge:      `Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:foo/bar:pull,push"`,
+			expectedScheme: "bearer",
+			expectedParams: map[string]string{
+				"realm":   "https://auth.docker.io/token",
+				"service": "registry.docker.io",
+				"scope":   "repository:foo/bar:pull,push",
+			},
+		},
+		{
+			challenge:      `Bearer realm=https://auth.example.com/token, service=example`,
+			expectedScheme: "bearer",
+			expectedParams: map[string]string{
+				"realm":   "https://auth.example.com/token",
+				"service": "example",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.challenge, func(t *testing.T) {
+			scheme, params := parseChallenge(tc.challenge)
+			if scheme != tc.expectedScheme {
+				t.Errorf("expected scheme %s but got %s", tc.expectedScheme, scheme)
+			}
+			if !cmp.Equal(params, tc.expectedParams) {
+				t.Errorf("params comparison failed: -want +got\n%v", cmp.Diff(tc.expectedParams, params))
+			}
+		})
+	}
+}
+
+func TestNewRepository(t *testing.T) {
+	testCases := []struct {
+		hub      string
+		repo     string
+		expected repository
+	}{
+		{
+			hub:      "quay.io/maistra",
+			repo:     "extension",
+			expected: repository{registry: "quay.io", name: "maistra/extension"},
+		},
+		{
+			hub:      "localhost:5000/a/b",
+			repo:     "extension",
+			expected: repository{registry: "localhost:5000", name: "a/b/extension"},
+		},
+		{
+			hub:      "maistra",
+			repo:     "extension",
+			expected: repository{registry: defaultRegistry, name: "maistra/extension"},
+		},
+		{
+			hub:      "docker.io/library",
+			repo:     "extension",
+			expected: repository{registry: defaultRegistry, name: "library/extension"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.hub, func(t *testing.T) {
+			repo := newRepository(tc.hub, tc.repo)
+			if repo != tc.expected {
+				t.Errorf("expected %v but got %v", tc.expected, repo)
+			}
+		})
+	}
+}
+
+func TestGetSignatures(t *testing.T) {
+	registry := newFakeRegistry("")
+	defer registry.server.Close()
+
+	layer := createLayer(t, map[string]string{"manifest.yaml": fakestrategy.FakeManifestYAML}, true)
+	digest := registry.push("test/extension", "latest",
+		[]descriptor{layerDescriptor("application/vnd.oci.image.layer.v1.tar+gzip", layer)},
+		[][]byte{layer})
+	unsignedLayer := createLayer(t, map[string]string{"manifest.yaml": fakestrategy.FakeManifestYAML}, false)
+	unsignedDigest := registry.push("test/extension", "unsigned",
+		[]descriptor{layerDescriptor("application/vnd.oci.image.layer.v1.tar", unsignedLayer)},
+		[][]byte{unsignedLayer})
+
+	payload := []byte(`{"critical":{"image":{"docker-manifest-digest":"` + digest + `"}}}`)
+	sigLayer := layerDescriptor("application/vnd.dev.cosign.simplesigning.v1+json", payload)
+	sigLayer.Annotations = map[string]string{signatureAnnotation: base64.StdEncoding.EncodeToString([]byte("signature"))}
+	registry.push("test/extension", signatureTag(digest), []descriptor{sigLayer}, [][]byte{payload})
+
+	tmpDir, err := ioutil.TempDir("", "ocitest")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	strategy, err := newOCIPullStrategy(registry.server.Client(), tmpDir, []string{registry.host()})
+	if err != nil {
+		t.Fatalf("failed to create strategy: %s", err)
+	}
+	imageRef := model.StringToImageRef(registry.host() + "/test/extension:latest")
+
+	signatures, err := strategy.GetSignatures(imageRef, digest)
+	if err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+	expected := []model.Signature{{Payload: payload, Signature: []byte("signature")}}
+	if !cmp.Equal(signatures, expected) {
+		t.Errorf("Signature comparison failed: -want +got\n%v", cmp.Diff(expected, signatures))
+	}
+
+	signatures, err = strategy.GetSignatures(imageRef, unsignedDigest)
+	if err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+	if len(signatures) != 0 {
+		t.Errorf("Expected no signatures but got %d", len(signatures))
+	}
+}
@@ -29,6 +29,7 @@ import (
 
 type HTTPServer struct {
 	serveDirectory string
+	modules        *ModuleStore
 	mux            *http.ServeMux
 	srv            *http.Server
 }
@@ -53,6 +54,9 @@ func (s *HTTPServer) handleRequest(res http.ResponseWriter, req *http.Request) {
 		res.WriteHeader(404)
 		return
 	}
+	if s.modules != nil {
+		s.modules.Touch(uuid.String())
+	}
 	res.WriteHeader(200)
 	if _, err := res.Write(data); err != nil {
 		log.Errorf("error writing response: %s", err)
@@ -67,9 +71,17 @@ func (s *HTTPServer) Start(stopChan <-chan struct{}) {
 	}()
 }
 
-func NewHTTPServer(port uint, serveDirectory string) *HTTPServer {
+// EnableMetrics serves the metrics of mec at /metrics
+func (s *HTTPServer) EnableMetrics() error {
+	return addMonitor(s.mux)
+}
+
+// NewHTTPServer creates an HTTPServer. modules is optional, if it is set the
+// modules' last access is recorded for LRU eviction.
+func NewHTTPServer(port uint, serveDirectory string, modules *ModuleStore) *HTTPServer {
 	s := &HTTPServer{
 		serveDirectory: serveDirectory,
+		modules:        modules,
 	}
 	s.mux = http.NewServeMux()
 	s.mux.HandleFunc("/", s.handleRequest)
@@ -75,7 +75,7 @@ func TestHTTPServer(t *testing.T) {
 		}
 	}()
 
-	server := NewHTTPServer(50505, tmpDir)
+	server := NewHTTPServer(50505, tmpDir, nil)
 	baseURL := "http://127.0.0.1:50505/"
 	stopChan := make(<-chan struct{})
 	server.Start(stopChan)
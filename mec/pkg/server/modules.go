@@ -0,0 +1,259 @@
+// Copyright Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"istio.io/pkg/log"
+)
+
+// module is a WebAssembly module in the serve directory
+type module struct {
+	size int64
+	// references holds the keys of the extensions whose status refers to the module
+	references map[string]struct{}
+	// lastAccess is the last time the module was published or served
+	lastAccess time.Time
+	// unreferencedSince is the time the last reference to the module was released
+	unreferencedSince time.Time
+}
+
+// ModuleStore keeps track of the modules in the serve directory. Modules that
+// are not referenced by any extension anymore are deleted once they have been
+// unreferenced for the grace period, which gives proxies that did not receive
+// the new configuration yet time to fetch them. If the modules exceed the disk
+// quota, unreferenced modules are evicted in least recently used order.
+type ModuleStore struct {
+	directory   string
+	quota       int64
+	gracePeriod time.Duration
+
+	modules map[string]*module
+	size    int64
+	now     func() time.Time
+
+	mut sync.Mutex
+}
+
+// NewModuleStore creates a ModuleStore for the given directory and registers
+// the modules that are already present as unreferenced. The Worker retains
+// them again when it processes the extensions whose status refers to them. A
+// quota of 0 disables the disk quota.
+func NewModuleStore(directory string, quota int64, gracePeriod time.Duration) (*ModuleStore, error) {
+	s := &ModuleStore{
+		directory:   directory,
+		quota:       quota,
+		gracePeriod: gracePeriod,
+		modules:     map[string]*module{},
+		now:         time.Now,
+	}
+	files, err := ioutil.ReadDir(directory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read serve directory: %v", err)
+	}
+	now := s.now()
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		if _, err := uuid.Parse(file.Name()); err != nil {
+			continue
+		}
+		s.modules[file.Name()] = &module{
+			size:              file.Size(),
+			references:        map[string]struct{}{},
+			lastAccess:        file.ModTime(),
+			unreferencedSince: now,
+		}
+		s.size += file.Size()
+	}
+	s.recordMetrics()
+	return s, nil
+}
+
+// Publish registers the module with the given ID, which must be present in
+// the serve directory, as referenced by the given extension. If the modules
+// exceed the quota and evicting unreferenced modules does not free enough
+// space, the module is deleted and an error is returned.
+func (s *ModuleStore) Publish(id, extension string) error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	defer s.recordMetrics()
+
+	if m, ok := s.modules[id]; ok {
+		m.references[extension] = struct{}{}
+		m.lastAccess = s.now()
+		return nil
+	}
+
+	info, err := os.Stat(path.Join(s.directory, id))
+	if err != nil {
+		return err
+	}
+	m := &module{
+		size:       info.Size(),
+		references: map[string]struct{}{extension: {}},
+		lastAccess: s.now(),
+	}
+	s.modules[id] = m
+	s.size += m.size
+	if s.quota <= 0 || s.size <= s.quota {
+		return nil
+	}
+	s.evict(s.size - s.quota)
+	if s.size <= s.quota {
+		return nil
+	}
+	s.remove(id)
+	return fmt.Errorf("module of %d bytes exceeds disk quota of %d bytes, %d bytes are used by other modules",
+		m.size, s.quota, s.size)
+}
+
+// Retain marks the module with the given ID as referenced by the given
+// extension, if the module is present
+func (s *ModuleStore) Retain(id, extension string) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if m, ok := s.modules[id]; ok {
+		m.references[extension] = struct{}{}
+	}
+}
+
+// Release removes the reference of the given extension to the module with
+// the given ID. Once unreferenced, the module is deleted after the grace period.
+func (s *ModuleStore) Release(id, extension string) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	m, ok := s.modules[id]
+	if !ok {
+		return
+	}
+	if _, referenced := m.references[extension]; !referenced {
+		return
+	}
+	delete(m.references, extension)
+	if len(m.references) == 0 {
+		m.unreferencedSince = s.now()
+	}
+}
+
+// Delete immediately deletes the module with the given ID, regardless of
+// references to it
+func (s *ModuleStore) Delete(id string) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if _, ok := s.modules[id]; !ok {
+		if err := os.Remove(path.Join(s.directory, id)); err != nil && !os.IsNotExist(err) {
+			log.Errorf("Failed to delete module %s: %v", id, err)
+		}
+		return
+	}
+	s.remove(id)
+	s.recordMetrics()
+}
+
+// Touch records that the module with the given ID was served
+func (s *ModuleStore) Touch(id string) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if m, ok := s.modules[id]; ok {
+		m.lastAccess = s.now()
+	}
+}
+
+// CollectGarbage deletes all modules that have been unreferenced for longer
+// than the grace period
+func (s *ModuleStore) CollectGarbage() {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	now := s.now()
+	for id, m := range s.modules {
+		if len(m.references) == 0 && now.Sub(m.unreferencedSince) >= s.gracePeriod {
+			log.Infof("Deleting unreferenced module %s", id)
+			if s.remove(id) {
+				moduleEvictions.With(reasonTag.Value(evictionReasonGarbage)).Increment()
+			}
+		}
+	}
+	s.recordMetrics()
+}
+
+// Start periodically collects garbage until stopChan is closed
+func (s *ModuleStore) Start(interval time.Duration, stopChan <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.CollectGarbage()
+			case <-stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// evict deletes unreferenced modules, least recently used first, until at
+// least the given number of bytes was freed. Must be called with the lock held.
+func (s *ModuleStore) evict(bytes int64) {
+	var candidates []string
+	for id, m := range s.modules {
+		if len(m.references) == 0 {
+			candidates = append(candidates, id)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return s.modules[candidates[i]].lastAccess.Before(s.modules[candidates[j]].lastAccess)
+	})
+	var freed int64
+	for _, id := range candidates {
+		if freed >= bytes {
+			return
+		}
+		size := s.modules[id].size
+		log.Infof("Evicting unreferenced module %s to stay within disk quota", id)
+		if s.remove(id) {
+			freed += size
+			moduleEvictions.With(reasonTag.Value(evictionReasonQuota)).Increment()
+		}
+	}
+}
+
+// remove deletes the module from disk. Must be called with the lock held.
+func (s *ModuleStore) remove(id string) bool {
+	if err := os.Remove(path.Join(s.directory, id)); err != nil && !os.IsNotExist(err) {
+		log.Errorf("Failed to delete module %s: %v", id, err)
+		return false
+	}
+	s.size -= s.modules[id].size
+	delete(s.modules, id)
+	return true
+}
+
+// recordMetrics must be called with the lock held
+func (s *ModuleStore) recordMetrics() {
+	moduleBytes.Record(float64(s.size))
+	moduleCount.Record(float64(len(s.modules)))
+}
@@ -0,0 +1,175 @@
+// Copyright Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const (
+	moduleA = "0b0c7d5a-24df-11eb-89f5-482ae3492105"
+	moduleB = "0b0c7d5b-24df-11eb-89f5-482ae3492105"
+	moduleC = "0b0c7d5c-24df-11eb-89f5-482ae3492105"
+)
+
+func TestModuleStore(t *testing.T) {
+	testCases := []struct {
+		name            string
+		quota           int64
+		run             func(s *ModuleStore, clock *time.Time) error
+		expectedError   bool
+		expectedModules []string
+	}{
+		{
+			name: "referenced_modules_are_kept",
+			run: func(s *ModuleStore, clock *time.Time) error {
+				*clock = clock.Add(time.Hour)
+				return publish(s, moduleA, "ns/a")
+			},
+			expectedModules: []string{moduleA},
+		},
+		{
+			name: "released_module_is_kept_for_grace_period",
+			run: func(s *ModuleStore, clock *time.Time) error {
+				if err := publish(s, moduleA, "ns/a"); err != nil {
+					return err
+				}
+				s.Release(moduleA, "ns/a")
+				*clock = clock.Add(time.Minute)
+				return nil
+			},
+			expectedModules: []string{moduleA},
+		},
+		{
+			name: "released_module_is_deleted_after_grace_period",
+			run: func(s *ModuleStore, clock *time.Time) error {
+				if err := publish(s, moduleA, "ns/a"); err != nil {
+					return err
+				}
+				if err := publish(s, moduleB, "ns/b"); err != nil {
+					return err
+				}
+				s.Release(moduleA, "ns/a")
+				*clock = clock.Add(time.Hour)
+				return nil
+			},
+			expectedModules: []string{moduleB},
+		},
+		{
+			name: "module_shared_by_extensions_is_kept",
+			run: func(s *ModuleStore, clock *time.Time) error {
+				if err := publish(s, moduleA, "ns/a"); err != nil {
+					return err
+				}
+				if err := s.Publish(moduleA, "ns/b"); err != nil {
+					return err
+				}
+				s.Release(moduleA, "ns/a")
+				*clock = clock.Add(time.Hour)
+				return nil
+			},
+			expectedModules: []string{moduleA},
+		},
+		{
+			name:  "least_recently_used_module_is_evicted",
+			quota: 20,
+			run: func(s *ModuleStore, clock *time.Time) error {
+				if err := publish(s, moduleA, "ns/a"); err != nil {
+					return err
+				}
+				*clock = clock.Add(time.Second)
+				if err := publish(s, moduleB, "ns/b"); err != nil {
+					return err
+				}
+				s.Release(moduleA, "ns/a")
+				s.Release(moduleB, "ns/b")
+				*clock = clock.Add(time.Second)
+				s.Touch(moduleA)
+				return publish(s, moduleC, "ns/c")
+			},
+			expectedModules: []string{moduleA, moduleC},
+		},
+		{
+			name:  "referenced_modules_are_not_evicted",
+			quota: 20,
+			run: func(s *ModuleStore, clock *time.Time) error {
+				if err := publish(s, moduleA, "ns/a"); err != nil {
+					return err
+				}
+				if err := publish(s, moduleB, "ns/b"); err != nil {
+					return err
+				}
+				return publish(s, moduleC, "ns/c")
+			},
+			expectedError:   true,
+			expectedModules: []string{moduleA, moduleB},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpDir, err := ioutil.TempDir("", "modulestoretest")
+			if err != nil {
+				t.Fatalf("failed to create temp dir: %s", err)
+			}
+			defer os.RemoveAll(tmpDir)
+
+			s, err := NewModuleStore(tmpDir, tc.quota, 10*time.Minute)
+			if err != nil {
+				t.Fatalf("failed to create module store: %s", err)
+			}
+			clock := time.Now()
+			s.now = func() time.Time { return clock }
+
+			err = tc.run(s, &clock)
+			if tc.expectedError && err == nil {
+				t.Fatalf("Expected error but got nil")
+			} else if !tc.expectedError && err != nil {
+				t.Fatalf("Expected no error but got %s", err)
+			}
+			s.CollectGarbage()
+
+			files, err := ioutil.ReadDir(tmpDir)
+			if err != nil {
+				t.Fatalf("failed to read serve directory: %s", err)
+			}
+			modules := []string{}
+			for _, file := range files {
+				modules = append(modules, file.Name())
+			}
+			sort.Strings(modules)
+			if !cmp.Equal(modules, tc.expectedModules) {
+				t.Fatalf("unexpected modules -got +want: %s", cmp.Diff(modules, tc.expectedModules))
+			}
+			if s.size != int64(10*len(tc.expectedModules)) {
+				t.Fatalf("expected %d bytes but got %d", 10*len(tc.expectedModules), s.size)
+			}
+		})
+	}
+}
+
+// publish writes a module of 10 bytes to the serve directory and publishes it
+func publish(s *ModuleStore, id, extension string) error {
+	if err := ioutil.WriteFile(path.Join(s.directory, id), []byte("0123456789"), os.ModePerm); err != nil {
+		return err
+	}
+	return s.Publish(id, extension)
+}
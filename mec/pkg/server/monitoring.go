@@ -0,0 +1,71 @@
+// Copyright Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	ocprom "contrib.go.opencensus.io/exporter/prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opencensus.io/stats/view"
+
+	"istio.io/pkg/monitoring"
+)
+
+const (
+	metricsPath = "/metrics"
+
+	evictionReasonGarbage = "unreferenced"
+	evictionReasonQuota   = "quota"
+)
+
+var (
+	reasonTag = monitoring.MustCreateLabel("reason")
+
+	moduleBytes = monitoring.NewGauge(
+		"mec_module_bytes",
+		"Total size of the WebAssembly modules in the serve directory.",
+	)
+
+	moduleCount = monitoring.NewGauge(
+		"mec_modules",
+		"Number of WebAssembly modules in the serve directory.",
+	)
+
+	moduleEvictions = monitoring.NewSum(
+		"mec_module_evictions_total",
+		"Total number of WebAssembly modules deleted from the serve directory.",
+		monitoring.WithLabels(reasonTag),
+	)
+)
+
+func init() {
+	monitoring.MustRegister(
+		moduleBytes,
+		moduleCount,
+		moduleEvictions,
+	)
+}
+
+func addMonitor(mux *http.ServeMux) error {
+	exporter, err := ocprom.NewExporter(ocprom.Options{Registry: prometheus.DefaultRegisterer.(*prometheus.Registry)})
+	if err != nil {
+		return fmt.Errorf("could not set up prometheus exporter: %v", err)
+	}
+	view.RegisterExporter(exporter)
+	mux.Handle(metricsPath, exporter)
+	return nil
+}
@@ -26,12 +26,21 @@ import (
 	"sync"
 
 	"github.com/google/uuid"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
 
 	"istio.io/istio/mec/pkg/model"
+	"istio.io/istio/mec/pkg/verification"
 	"istio.io/istio/pkg/servicemesh/apis/servicemesh/v1alpha1"
+	"istio.io/istio/pkg/servicemesh/client/v1alpha1/clientset/versioned/scheme"
 	v1alpha1client "istio.io/istio/pkg/servicemesh/client/v1alpha1/clientset/versioned/typed/servicemesh/v1alpha1"
+	maistramodel "istio.io/istio/pkg/servicemesh/model"
 	"istio.io/pkg/log"
 )
 
@@ -39,6 +48,14 @@ const (
 	ExtensionEventOperationAdd    = 0
 	ExtensionEventOperationDelete = 1
 	ExtensionEventOperationUpdate = 2
+
+	eventReasonVerificationFailed = "VerificationFailed"
+	eventReasonRolloutStarted     = "RolloutStarted"
+	eventReasonRolloutCompleted   = "RolloutCompleted"
+
+	// stagingSuffix is appended to modules that have not been verified yet.
+	// The HTTP server only serves files named by a UUID, so these are never served.
+	stagingSuffix = ".staging"
 )
 
 type ExtensionEvent struct {
@@ -53,12 +70,15 @@ type Worker struct {
 	serveDirectory string
 
 	pullStrategy model.ImagePullStrategy
+	verifier     *verification.Verifier
+	modules      *ModuleStore
 
-	client       v1alpha1client.ServicemeshV1alpha1Interface
-	stopChan     <-chan struct{}
-	resultChan   chan workerResult
-	Queue        chan ExtensionEvent
-	enableLogger bool
+	client        v1alpha1client.ServicemeshV1alpha1Interface
+	eventRecorder record.EventRecorder
+	stopChan      <-chan struct{}
+	resultChan    chan workerResult
+	Queue         chan ExtensionEvent
+	enableLogger  bool
 
 	mut sync.Mutex
 }
@@ -81,19 +101,32 @@ func (r *workerResult) AddError(err error) {
 	r.errors = append(r.errors, err)
 }
 
-func NewWorker(config *rest.Config, pullStrategy model.ImagePullStrategy, baseURL, serveDirectory string) (*Worker, error) {
+// NewWorker creates a Worker that publishes modules to the directory of the
+// given ModuleStore. verifier is optional, if it is nil modules are published
+// without verification.
+func NewWorker(config *rest.Config, pullStrategy model.ImagePullStrategy, verifier *verification.Verifier,
+	baseURL string, modules *ModuleStore) (*Worker, error) {
 	client, err := v1alpha1client.NewForConfig(config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create client from config: %v", err)
 	}
+	kubeClient, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kube client from config: %v", err)
+	}
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeClient.CoreV1().Events("")})
 
 	return &Worker{
 		client:         client,
+		eventRecorder:  broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "mec"}),
+		verifier:       verifier,
 		Queue:          make(chan ExtensionEvent, 100),
 		resultChan:     make(chan workerResult, 100),
 		pullStrategy:   pullStrategy,
 		baseURL:        baseURL,
-		serveDirectory: serveDirectory,
+		serveDirectory: modules.directory,
+		modules:        modules,
 	}, nil
 }
 
@@ -104,22 +137,28 @@ func (w *Worker) processEvent(event ExtensionEvent) {
 		successful: true,
 	}
 	extension := event.Extension
-	result.AddMessage("Processing " + extension.Namespace + "/" + extension.Name)
+	key := maistramodel.ExtensionKey(extension.Namespace, extension.Name)
+	result.AddMessage("Processing " + key)
 
 	if event.Operation == ExtensionEventOperationDelete {
-		if len(extension.Status.Deployment.URL) > len(w.baseURL) {
-			id := extension.Status.Deployment.URL[len(w.baseURL):]
-			filename := path.Join(w.serveDirectory, id)
-			os.Remove(filename)
+		w.releaseModule(extension.Status.Deployment.URL, key)
+		if extension.Status.Rollout != nil && extension.Status.Rollout.Previous != nil {
+			w.releaseModule(extension.Status.Rollout.Previous.URL, key)
 		}
 		return
 	}
+	// modules found on disk after a restart start out unreferenced, retain the
+	// module the status refers to so that it survives a failed pull
+	w.modules.Retain(w.moduleID(extension.Status.Deployment.URL), key)
+	// proxies that are not part of a rollout keep using the previous module
+	if extension.Status.Rollout != nil && extension.Status.Rollout.Previous != nil {
+		w.modules.Retain(w.moduleID(extension.Status.Rollout.Previous.URL), key)
+	}
 	imageRef := model.StringToImageRef(extension.Spec.Image)
 
 	if imageRef == nil {
-		result.AddError(fmt.Errorf("failed to parse spec.image: '%s'", extension.Spec.Image))
-		result.Fail()
-		w.resultChan <- result
+		w.failExtension(extension, v1alpha1.ConditionTypePulled, v1alpha1.ConditionReasonInvalidImage,
+			fmt.Errorf("failed to parse spec.image: '%s'", extension.Spec.Image), &result)
 		return
 	}
 
@@ -135,14 +174,14 @@ func (w *Worker) processEvent(event ExtensionEvent) {
 		result.AddMessage(fmt.Sprintf("Image %s not present. Pulling", imageRef.String()))
 		img, err = w.pullStrategy.PullImage(imageRef)
 		if err != nil {
-			result.AddError(fmt.Errorf("failed to pull image %s: %v", imageRef.String(), err))
-			result.Fail()
-			w.resultChan <- result
+			w.failExtension(extension, v1alpha1.ConditionTypePulled, v1alpha1.ConditionReasonPullFailed,
+				fmt.Errorf("failed to pull image %s: %v", imageRef.String(), err), &result)
 			return
 		}
 	}
-	var id string
+	var id, replacedID string
 	containerImageChanged := false
+	rolloutChanged := false
 
 	if strings.HasPrefix(extension.Status.Deployment.URL, w.baseURL) {
 		url, err := url.Parse(extension.Status.Deployment.URL)
@@ -155,14 +194,10 @@ func (w *Worker) processEvent(event ExtensionEvent) {
 	}
 
 	if img.SHA256() != extension.Status.Deployment.ContainerSHA256 {
-		// if container sha changed, re-generate UUID
+		// if container sha changed, re-generate UUID. The existing module is
+		// replaced once the new one has been published.
 		containerImageChanged = true
-		if id != "" {
-			err := os.Remove(path.Join(w.serveDirectory, id))
-			if err != nil {
-				result.AddError(fmt.Errorf("failed to delete existing wasm module: %s", err))
-			}
-		}
+		replacedID = id
 
 		wasmUUID, err := uuid.NewRandom()
 		if err != nil {
@@ -175,17 +210,25 @@ func (w *Worker) processEvent(event ExtensionEvent) {
 	}
 
 	filename := path.Join(w.serveDirectory, id)
+	// new modules are extracted to a staging file that is not served until verification passed
+	moduleFile := filename
 	if _, err := os.Stat(filename); os.IsNotExist(err) {
-		err = img.CopyWasmModule(filename)
+		moduleFile = filename + stagingSuffix
+		defer os.Remove(moduleFile)
+		err = img.CopyWasmModule(moduleFile)
 		if err != nil {
-			result.AddError(fmt.Errorf("failed to extract wasm module: %v", err))
-			result.Fail()
-			w.resultChan <- result
+			w.failExtension(extension, v1alpha1.ConditionTypePulled, v1alpha1.ConditionReasonPullFailed,
+				fmt.Errorf("failed to extract wasm module: %v", err), &result)
 			return
 		}
 	}
+	conditionsChanged := extension.Status.SetCondition(v1alpha1.Condition{
+		Type:   v1alpha1.ConditionTypePulled,
+		Status: corev1.ConditionTrue,
+		Reason: v1alpha1.ConditionReasonImagePulled,
+	})
 
-	sha, err := generateSHA256(filename)
+	sha, err := generateSHA256(moduleFile)
 	if err != nil {
 		result.AddError(fmt.Errorf("failed to generate sha256 of wasm module: %v", err))
 		result.Fail()
@@ -194,6 +237,52 @@ func (w *Worker) processEvent(event ExtensionEvent) {
 	}
 	result.AddMessage(fmt.Sprintf("WASM module SHA256 is %s", sha))
 
+	if w.verifier != nil {
+		if err := w.verifier.Verify(imageRef, img, sha, w.pullStrategy); err != nil {
+			reason := fmt.Errorf("verification of image %s failed: %v", imageRef.String(), err)
+			if moduleFile != filename {
+				os.Remove(moduleFile)
+			}
+			if replacedID != "" {
+				// an update was rejected, the last verified module keeps being served
+				w.rejectRevision(extension, reason, &result)
+			} else {
+				if moduleFile == filename {
+					// the module is already published and must not be served anymore
+					w.modules.Delete(id)
+				}
+				w.rejectExtension(extension, reason, &result)
+			}
+			w.resultChan <- result
+			return
+		}
+		result.AddMessage(fmt.Sprintf("Image %s passed verification", imageRef.String()))
+		conditionsChanged = extension.Status.SetCondition(v1alpha1.Condition{
+			Type:   v1alpha1.ConditionTypeVerified,
+			Status: corev1.ConditionTrue,
+			Reason: v1alpha1.ConditionReasonVerificationPassed,
+		}) || conditionsChanged
+	} else {
+		conditionsChanged = extension.Status.SetCondition(v1alpha1.Condition{
+			Type:    v1alpha1.ConditionTypeVerified,
+			Status:  corev1.ConditionFalse,
+			Reason:  v1alpha1.ConditionReasonVerificationDisabled,
+			Message: "no verification policy is configured",
+		}) || conditionsChanged
+	}
+	if moduleFile != filename {
+		if err := os.Rename(moduleFile, filename); err != nil {
+			w.failExtension(extension, v1alpha1.ConditionTypePublished, v1alpha1.ConditionReasonPublishFailed,
+				fmt.Errorf("failed to publish wasm module: %v", err), &result)
+			return
+		}
+	}
+	if err := w.modules.Publish(id, key); err != nil {
+		w.failExtension(extension, v1alpha1.ConditionTypePublished, v1alpha1.ConditionReasonQuotaExceeded,
+			fmt.Errorf("failed to publish wasm module: %v", err), &result)
+		return
+	}
+
 	filePath, err := url.Parse(id)
 	if err != nil {
 		result.AddError(fmt.Errorf("failed to parse new UUID '%s' as URL path: %s", id, err))
@@ -208,10 +297,29 @@ func (w *Worker) processEvent(event ExtensionEvent) {
 		w.resultChan <- result
 	}
 
+	if replacedID != "" {
+		if w.startRollout(extension) {
+			result.AddMessage(fmt.Sprintf("Rolling out new module, keeping previous module %s", replacedID))
+		} else {
+			w.modules.Release(replacedID, key)
+		}
+	}
+
 	extension.Status.Deployment.SHA256 = sha
 	extension.Status.Deployment.ContainerSHA256 = img.SHA256()
 	extension.Status.Deployment.URL = baseURL.ResolveReference(filePath).String()
 	extension.Status.Deployment.Ready = true
+	extension.Status.Deployment.Message = ""
+	conditionsChanged = extension.Status.SetCondition(v1alpha1.Condition{
+		Type:   v1alpha1.ConditionTypePublished,
+		Status: corev1.ConditionTrue,
+		Reason: v1alpha1.ConditionReasonModulePublished,
+	}) || conditionsChanged
+
+	if extension.Status.Rollout != nil && !maistramodel.RolloutInProgress(extension) {
+		w.completeRollout(extension, &result)
+		rolloutChanged = true
+	}
 
 	manifest := img.GetManifest()
 
@@ -227,13 +335,14 @@ func (w *Worker) processEvent(event ExtensionEvent) {
 		extension.Status.Priority = *extension.Spec.Priority
 	}
 
-	if !containerImageChanged && extension.Generation > 0 && extension.Status.ObservedGeneration == extension.Generation {
+	if !containerImageChanged && !rolloutChanged && !conditionsChanged &&
+		extension.Generation > 0 && extension.Status.ObservedGeneration == extension.Generation {
 		result.AddMessage("Skipping status update")
 		w.resultChan <- result
 		return
 	}
 	extension.Status.ObservedGeneration = extension.Generation
-	_, err = w.client.ServiceMeshExtensions(extension.Namespace).UpdateStatus(context.TODO(), extension, v1.UpdateOptions{})
+	err = w.updateStatus(extension)
 	if err != nil {
 		result.AddError(fmt.Errorf("failed to update status of extension: %v", err))
 		result.Fail()
@@ -241,6 +350,195 @@ func (w *Worker) processEvent(event ExtensionEvent) {
 	w.resultChan <- result
 }
 
+// rejectExtension unpublishes the extension's module and reports the reason
+// in the extension's status and as an event. It is used when there is no
+// previously verified module to fall back to.
+func (w *Worker) rejectExtension(extension *v1alpha1.ServiceMeshExtension, reason error, result *workerResult) {
+	result.AddError(reason)
+	result.Fail()
+	w.eventRecorder.Event(extension, corev1.EventTypeWarning, eventReasonVerificationFailed, reason.Error())
+
+	extension.Status.Deployment = v1alpha1.DeploymentStatus{
+		Ready:   false,
+		Message: reason.Error(),
+	}
+	extension.Status.SetCondition(v1alpha1.Condition{
+		Type:    v1alpha1.ConditionTypeVerified,
+		Status:  corev1.ConditionFalse,
+		Reason:  v1alpha1.ConditionReasonVerificationFailed,
+		Message: reason.Error(),
+	})
+	extension.Status.SetCondition(v1alpha1.Condition{
+		Type:    v1alpha1.ConditionTypePublished,
+		Status:  corev1.ConditionFalse,
+		Reason:  v1alpha1.ConditionReasonVerificationFailed,
+		Message: "the module was not published because it failed verification",
+	})
+	if extension.Status.Rollout != nil && extension.Status.Rollout.Previous != nil {
+		w.releaseModule(extension.Status.Rollout.Previous.URL, maistramodel.ExtensionKey(extension.Namespace, extension.Name))
+	}
+	extension.Status.Rollout = nil
+	extension.Status.ObservedGeneration = extension.Generation
+	err := w.updateStatus(extension)
+	if err != nil {
+		result.AddError(fmt.Errorf("failed to update status of extension: %v", err))
+	}
+}
+
+// rejectRevision reports that an updated image of the extension failed
+// verification. The previously published module keeps being served, only the
+// Verified condition and the deployment message report the rejected revision.
+func (w *Worker) rejectRevision(extension *v1alpha1.ServiceMeshExtension, reason error, result *workerResult) {
+	result.AddError(reason)
+	result.Fail()
+	w.eventRecorder.Event(extension, corev1.EventTypeWarning, eventReasonVerificationFailed, reason.Error())
+
+	extension.Status.Deployment.Message = reason.Error()
+	extension.Status.SetCondition(v1alpha1.Condition{
+		Type:    v1alpha1.ConditionTypeVerified,
+		Status:  corev1.ConditionFalse,
+		Reason:  v1alpha1.ConditionReasonVerificationFailed,
+		Message: reason.Error() + "; the previously verified module is still served",
+	})
+	extension.Status.ObservedGeneration = extension.Generation
+	err := w.updateStatus(extension)
+	if err != nil {
+		result.AddError(fmt.Errorf("failed to update status of extension: %v", err))
+	}
+}
+
+// mecConditionTypes are the conditions of the extension status written by mec.
+// istiod writes the other conditions.
+var mecConditionTypes = []v1alpha1.ConditionType{
+	v1alpha1.ConditionTypePulled,
+	v1alpha1.ConditionTypeVerified,
+	v1alpha1.ConditionTypePublished,
+}
+
+// updateStatus writes the status of the extension. istiod writes the proxy
+// acknowledgements, its own conditions, and the failure count and rollback
+// state of a rollout concurrently, so if the update conflicts, only the fields
+// owned by mec are applied to the latest version of the extension.
+func (w *Worker) updateStatus(extension *v1alpha1.ServiceMeshExtension) error {
+	status := extension.Status.DeepCopy()
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		_, err := w.client.ServiceMeshExtensions(extension.Namespace).UpdateStatus(context.TODO(), extension, v1.UpdateOptions{})
+		if !apierrors.IsConflict(err) {
+			return err
+		}
+		latest, getErr := w.client.ServiceMeshExtensions(extension.Namespace).Get(context.TODO(), extension.Name, v1.GetOptions{})
+		if getErr != nil {
+			return getErr
+		}
+		mergeStatus(&latest.Status, status)
+		extension = latest
+		return err
+	})
+}
+
+// mergeStatus copies the fields of the status owned by mec into latest. The
+// rollout state recorded by istiod is kept as long as it is for the same
+// rollout.
+func mergeStatus(latest, status *v1alpha1.ServiceMeshExtensionStatus) {
+	rollout := status.Rollout.DeepCopy()
+	if current := latest.Rollout; current != nil && rollout != nil && rollout.Previous != nil &&
+		current.Previous != nil && current.Previous.URL == rollout.Previous.URL &&
+		latest.Deployment.SHA256 == status.Deployment.SHA256 {
+		rollout.Failures = current.Failures
+		rollout.RolledBack = current.RolledBack
+	}
+	latest.Rollout = rollout
+	latest.Phase = status.Phase
+	latest.ObservedGeneration = status.ObservedGeneration
+	latest.Deployment = status.Deployment
+	for _, conditionType := range mecConditionTypes {
+		condition := status.GetCondition(conditionType)
+		if condition == nil {
+			continue
+		}
+		if existing := latest.GetCondition(conditionType); existing != nil {
+			*existing = *condition
+			continue
+		}
+		latest.Conditions = append(latest.Conditions, *condition)
+	}
+}
+
+// failExtension reports that processing the extension failed in the given
+// condition of the extension's status. Modules that were published before
+// keep being served.
+func (w *Worker) failExtension(extension *v1alpha1.ServiceMeshExtension, conditionType v1alpha1.ConditionType,
+	conditionReason v1alpha1.ConditionReason, reason error, result *workerResult) {
+	result.AddError(reason)
+	result.Fail()
+	changed := extension.Status.SetCondition(v1alpha1.Condition{
+		Type:    conditionType,
+		Status:  corev1.ConditionFalse,
+		Reason:  conditionReason,
+		Message: reason.Error(),
+	})
+	if changed {
+		err := w.updateStatus(extension)
+		if err != nil {
+			result.AddError(fmt.Errorf("failed to update status of extension: %v", err))
+		}
+	}
+	w.resultChan <- *result
+}
+
+// startRollout keeps the currently deployed module as the previous deployment
+// if the extension's spec asks for a staged rollout. It returns false if the
+// current module is not needed anymore and can be deleted.
+func (w *Worker) startRollout(extension *v1alpha1.ServiceMeshExtension) bool {
+	if extension.Spec.Rollout == nil || !extension.Status.Deployment.Ready {
+		return false
+	}
+	if extension.Status.Rollout != nil && extension.Status.Rollout.Previous != nil {
+		// the image changed during a rollout. The module being rolled out is
+		// superseded, proxies that were not part of the rollout keep the previous one.
+		extension.Status.Rollout.Failures = 0
+		extension.Status.Rollout.RolledBack = false
+		return false
+	}
+	previous := extension.Status.Deployment
+	previous.Message = ""
+	extension.Status.Rollout = &v1alpha1.RolloutStatus{
+		Previous: &previous,
+	}
+	w.eventRecorder.Eventf(extension, corev1.EventTypeNormal, eventReasonRolloutStarted,
+		"Rolling out image %s", extension.Spec.Image)
+	return true
+}
+
+// completeRollout releases the module of the previous deployment once all
+// proxies have been moved to the new one
+func (w *Worker) completeRollout(extension *v1alpha1.ServiceMeshExtension, result *workerResult) {
+	if previous := extension.Status.Rollout.Previous; previous != nil {
+		w.releaseModule(previous.URL, maistramodel.ExtensionKey(extension.Namespace, extension.Name))
+		w.eventRecorder.Eventf(extension, corev1.EventTypeNormal, eventReasonRolloutCompleted,
+			"Rollout of image %s completed", extension.Spec.Image)
+		result.AddMessage("Rollout completed")
+	}
+	extension.Status.Rollout = nil
+}
+
+// releaseModule releases the extension's reference to the module that is
+// served under the given URL
+func (w *Worker) releaseModule(moduleURL, extension string) {
+	if id := w.moduleID(moduleURL); id != "" {
+		w.modules.Release(id, extension)
+	}
+}
+
+// moduleID returns the ID of the module that is served under the given URL,
+// or an empty string if the URL is not served by this worker
+func (w *Worker) moduleID(moduleURL string) string {
+	if len(moduleURL) <= len(w.baseURL) || !strings.HasPrefix(moduleURL, w.baseURL) {
+		return ""
+	}
+	return path.Base(moduleURL)
+}
+
 func (w *Worker) Start(stopChan <-chan struct{}) {
 	w.mut.Lock()
 	defer w.mut.Unlock()
@@ -20,6 +20,7 @@ import (
 	"io/ioutil"
 	"net/url"
 	"os"
+	"path"
 	"strings"
 	"sync"
 	"testing"
@@ -27,9 +28,16 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/google/uuid"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ktesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
 
+	"istio.io/istio/mec/pkg/model"
 	fakestrategy "istio.io/istio/mec/pkg/pullstrategy/fake"
+	"istio.io/istio/mec/pkg/verification"
 	"istio.io/istio/pkg/servicemesh/apis/servicemesh/v1alpha1"
 	"istio.io/istio/pkg/servicemesh/client/v1alpha1/clientset/versioned/fake"
 	"istio.io/pkg/log"
@@ -40,17 +48,66 @@ const (
 )
 
 var (
+	fifty      = 50
 	oneHundred = 100
 	twoHundred = 200
+
+	invalidImageConditions = []v1alpha1.Condition{
+		{
+			Type:    v1alpha1.ConditionTypePulled,
+			Status:  corev1.ConditionFalse,
+			Reason:  v1alpha1.ConditionReasonInvalidImage,
+			Message: "failed to parse spec.image: ''",
+		},
+	}
+	publishedConditions = []v1alpha1.Condition{
+		{
+			Type:   v1alpha1.ConditionTypePulled,
+			Status: corev1.ConditionTrue,
+			Reason: v1alpha1.ConditionReasonImagePulled,
+		},
+		{
+			Type:    v1alpha1.ConditionTypeVerified,
+			Status:  corev1.ConditionFalse,
+			Reason:  v1alpha1.ConditionReasonVerificationDisabled,
+			Message: "no verification policy is configured",
+		},
+		{
+			Type:   v1alpha1.ConditionTypePublished,
+			Status: corev1.ConditionTrue,
+			Reason: v1alpha1.ConditionReasonModulePublished,
+		},
+	}
+	verifiedConditions = []v1alpha1.Condition{
+		{
+			Type:   v1alpha1.ConditionTypePulled,
+			Status: corev1.ConditionTrue,
+			Reason: v1alpha1.ConditionReasonImagePulled,
+		},
+		{
+			Type:   v1alpha1.ConditionTypeVerified,
+			Status: corev1.ConditionTrue,
+			Reason: v1alpha1.ConditionReasonVerificationPassed,
+		},
+		{
+			Type:   v1alpha1.ConditionTypePublished,
+			Status: corev1.ConditionTrue,
+			Reason: v1alpha1.ConditionReasonModulePublished,
+		},
+	}
 )
 
 func TestWorker(t *testing.T) {
 	testCases := []struct {
-		name           string
-		events         []ExtensionEvent
-		extension      v1alpha1.ServiceMeshExtension
-		expectedStatus v1alpha1.ServiceMeshExtensionStatus
-		expectedError  bool
+		name            string
+		events          []ExtensionEvent
+		extension       v1alpha1.ServiceMeshExtension
+		verifier        *verification.Verifier
+		quota           int64
+		expectedStatus  v1alpha1.ServiceMeshExtensionStatus
+		expectedEvents  int
+		expectedModules int
+		expectedError   bool
 	}{
 		{
 			name: "invalid_resource",
@@ -61,8 +118,10 @@ func TestWorker(t *testing.T) {
 					Generation: 1,
 				},
 			},
-			expectedStatus: v1alpha1.ServiceMeshExtensionStatus{},
-			expectedError:  true,
+			expectedStatus: v1alpha1.ServiceMeshExtensionStatus{
+				Conditions: invalidImageConditions,
+			},
+			expectedError: true,
 		},
 		{
 			name: "valid_resource",
@@ -84,8 +143,10 @@ func TestWorker(t *testing.T) {
 					ContainerSHA256: fakestrategy.FakeContainerSHA256,
 					SHA256:          fakestrategy.FakeModuleSHA256,
 				},
+				Conditions:         publishedConditions,
 				ObservedGeneration: 1,
 			},
+			expectedModules: 1,
 		},
 		{
 			name: "valid_resource_update_module",
@@ -122,8 +183,10 @@ func TestWorker(t *testing.T) {
 					ContainerSHA256: fakestrategy.FakeContainer2SHA256,
 					SHA256:          fakestrategy.FakeModule2SHA256,
 				},
+				Conditions:         publishedConditions,
 				ObservedGeneration: 2,
 			},
+			expectedModules: 1,
 		},
 		{
 			name: "valid_resource_update_priority",
@@ -175,8 +238,312 @@ func TestWorker(t *testing.T) {
 					ContainerSHA256: fakestrategy.FakeContainerSHA256,
 					SHA256:          fakestrategy.FakeModuleSHA256,
 				},
+				Conditions:         publishedConditions,
 				ObservedGeneration: 4,
 			},
+			expectedModules: 1,
+		},
+		{
+			name: "valid_resource_pinned_digest",
+			extension: v1alpha1.ServiceMeshExtension{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       "test",
+					Namespace:  "test",
+					Generation: 1,
+				},
+				Spec: v1alpha1.ServiceMeshExtensionSpec{
+					Image: "docker.io/test/test:latest",
+				},
+			},
+			verifier: newVerifier(t, verification.Rule{
+				Image:   "docker.io/test/*",
+				Digests: []string{fakestrategy.FakeModuleSHA256},
+			}),
+			expectedStatus: v1alpha1.ServiceMeshExtensionStatus{
+				Phase:    fakestrategy.FakeManifest.Phase,
+				Priority: fakestrategy.FakeManifest.Priority,
+				Deployment: v1alpha1.DeploymentStatus{
+					Ready:           true,
+					ContainerSHA256: fakestrategy.FakeContainerSHA256,
+					SHA256:          fakestrategy.FakeModuleSHA256,
+				},
+				Conditions:         verifiedConditions,
+				ObservedGeneration: 1,
+			},
+			expectedModules: 1,
+		},
+		{
+			name: "invalid_resource_digest_not_pinned",
+			extension: v1alpha1.ServiceMeshExtension{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       "test",
+					Namespace:  "test",
+					Generation: 1,
+				},
+				Spec: v1alpha1.ServiceMeshExtensionSpec{
+					Image: "docker.io/test/test:latest",
+				},
+			},
+			verifier: newVerifier(t, verification.Rule{
+				Image:   "docker.io/test/test",
+				Digests: []string{fakestrategy.FakeModule2SHA256},
+			}),
+			expectedStatus: v1alpha1.ServiceMeshExtensionStatus{
+				Deployment: v1alpha1.DeploymentStatus{
+					Message: fmt.Sprintf("verification of image docker.io/test/test:latest failed: "+
+						"neither image digest %s nor module digest %s is pinned for docker.io/test/test",
+						strings.TrimPrefix(fakestrategy.FakeContainerSHA256, "sha256:"), fakestrategy.FakeModuleSHA256),
+				},
+				Conditions: []v1alpha1.Condition{
+					{
+						Type:   v1alpha1.ConditionTypePulled,
+						Status: corev1.ConditionTrue,
+						Reason: v1alpha1.ConditionReasonImagePulled,
+					},
+					{
+						Type:   v1alpha1.ConditionTypeVerified,
+						Status: corev1.ConditionFalse,
+						Reason: v1alpha1.ConditionReasonVerificationFailed,
+						Message: fmt.Sprintf("verification of image docker.io/test/test:latest failed: "+
+							"neither image digest %s nor module digest %s is pinned for docker.io/test/test",
+							strings.TrimPrefix(fakestrategy.FakeContainerSHA256, "sha256:"), fakestrategy.FakeModuleSHA256),
+					},
+					{
+						Type:    v1alpha1.ConditionTypePublished,
+						Status:  corev1.ConditionFalse,
+						Reason:  v1alpha1.ConditionReasonVerificationFailed,
+						Message: "the module was not published because it failed verification",
+					},
+				},
+				ObservedGeneration: 1,
+			},
+			expectedEvents: 1,
+			expectedError:  true,
+		},
+		{
+			name: "invalid_resource_update_rejected",
+			extension: v1alpha1.ServiceMeshExtension{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       "test",
+					Namespace:  "test",
+					Generation: 1,
+				},
+				Spec: v1alpha1.ServiceMeshExtensionSpec{
+					Image: "docker.io/test/test:latest",
+				},
+			},
+			events: []ExtensionEvent{
+				{
+					Extension: &v1alpha1.ServiceMeshExtension{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:       "test",
+							Namespace:  "test",
+							Generation: 2,
+						},
+						Spec: v1alpha1.ServiceMeshExtensionSpec{
+							Image: "docker.io/other/test:latest",
+						},
+					},
+					Operation: ExtensionEventOperationUpdate,
+				},
+			},
+			verifier: newVerifier(t, verification.Rule{
+				Image:   "docker.io/*",
+				Digests: []string{fakestrategy.FakeModuleSHA256},
+			}),
+			// the verified module of the first revision keeps being served
+			expectedStatus: v1alpha1.ServiceMeshExtensionStatus{
+				Phase:    fakestrategy.FakeManifest.Phase,
+				Priority: fakestrategy.FakeManifest.Priority,
+				Deployment: v1alpha1.DeploymentStatus{
+					Ready:           true,
+					ContainerSHA256: fakestrategy.FakeContainerSHA256,
+					SHA256:          fakestrategy.FakeModuleSHA256,
+					Message: fmt.Sprintf("verification of image docker.io/other/test:latest failed: "+
+						"neither image digest %s nor module digest %s is pinned for docker.io/other/test",
+						strings.TrimPrefix(fakestrategy.FakeContainer2SHA256, "sha256:"), fakestrategy.FakeModule2SHA256),
+				},
+				Conditions: []v1alpha1.Condition{
+					verifiedConditions[0],
+					{
+						Type:   v1alpha1.ConditionTypeVerified,
+						Status: corev1.ConditionFalse,
+						Reason: v1alpha1.ConditionReasonVerificationFailed,
+						Message: fmt.Sprintf("verification of image docker.io/other/test:latest failed: "+
+							"neither image digest %s nor module digest %s is pinned for docker.io/other/test; "+
+							"the previously verified module is still served",
+							strings.TrimPrefix(fakestrategy.FakeContainer2SHA256, "sha256:"), fakestrategy.FakeModule2SHA256),
+					},
+					verifiedConditions[2],
+				},
+				ObservedGeneration: 2,
+			},
+			expectedEvents:  1,
+			expectedModules: 1,
+			expectedError:   true,
+		},
+		{
+			name: "valid_resource_rollout",
+			extension: v1alpha1.ServiceMeshExtension{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       "test",
+					Namespace:  "test",
+					Generation: 1,
+				},
+				Spec: v1alpha1.ServiceMeshExtensionSpec{
+					Image:   "docker.io/test/test:latest",
+					Rollout: &v1alpha1.RolloutStrategy{Percentage: &fifty},
+				},
+			},
+			events: []ExtensionEvent{
+				{
+					Extension: &v1alpha1.ServiceMeshExtension{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:       "test",
+							Namespace:  "test",
+							Generation: 2,
+						},
+						Spec: v1alpha1.ServiceMeshExtensionSpec{
+							Image:   "docker.io/other/test:latest",
+							Rollout: &v1alpha1.RolloutStrategy{Percentage: &fifty},
+						},
+					},
+					Operation: ExtensionEventOperationUpdate,
+				},
+			},
+			expectedStatus: v1alpha1.ServiceMeshExtensionStatus{
+				Phase:    fakestrategy.FakeManifest2.Phase,
+				Priority: fakestrategy.FakeManifest2.Priority,
+				Deployment: v1alpha1.DeploymentStatus{
+					Ready:           true,
+					ContainerSHA256: fakestrategy.FakeContainer2SHA256,
+					SHA256:          fakestrategy.FakeModule2SHA256,
+				},
+				Rollout: &v1alpha1.RolloutStatus{
+					Previous: &v1alpha1.DeploymentStatus{
+						Ready:           true,
+						ContainerSHA256: fakestrategy.FakeContainerSHA256,
+						SHA256:          fakestrategy.FakeModuleSHA256,
+					},
+				},
+				Conditions:         publishedConditions,
+				ObservedGeneration: 2,
+			},
+			expectedEvents:  1,
+			expectedModules: 2,
+		},
+		{
+			name: "valid_resource_rollout_completed",
+			extension: v1alpha1.ServiceMeshExtension{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       "test",
+					Namespace:  "test",
+					Generation: 1,
+				},
+				Spec: v1alpha1.ServiceMeshExtensionSpec{
+					Image:   "docker.io/test/test:latest",
+					Rollout: &v1alpha1.RolloutStrategy{Percentage: &fifty},
+				},
+			},
+			events: []ExtensionEvent{
+				{
+					Extension: &v1alpha1.ServiceMeshExtension{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:       "test",
+							Namespace:  "test",
+							Generation: 2,
+						},
+						Spec: v1alpha1.ServiceMeshExtensionSpec{
+							Image:   "docker.io/other/test:latest",
+							Rollout: &v1alpha1.RolloutStrategy{Percentage: &fifty},
+						},
+					},
+					Operation: ExtensionEventOperationUpdate,
+				},
+				{
+					Extension: &v1alpha1.ServiceMeshExtension{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:       "test",
+							Namespace:  "test",
+							Generation: 3,
+						},
+						Spec: v1alpha1.ServiceMeshExtensionSpec{
+							Image:   "docker.io/other/test:latest",
+							Rollout: &v1alpha1.RolloutStrategy{Percentage: &oneHundred},
+						},
+					},
+					Operation: ExtensionEventOperationUpdate,
+				},
+			},
+			expectedStatus: v1alpha1.ServiceMeshExtensionStatus{
+				Phase:    fakestrategy.FakeManifest2.Phase,
+				Priority: fakestrategy.FakeManifest2.Priority,
+				Deployment: v1alpha1.DeploymentStatus{
+					Ready:           true,
+					ContainerSHA256: fakestrategy.FakeContainer2SHA256,
+					SHA256:          fakestrategy.FakeModule2SHA256,
+				},
+				Conditions:         publishedConditions,
+				ObservedGeneration: 3,
+			},
+			expectedEvents:  2,
+			expectedModules: 1,
+		},
+		{
+			name: "invalid_resource_rollout_quota_exceeded",
+			extension: v1alpha1.ServiceMeshExtension{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       "test",
+					Namespace:  "test",
+					Generation: 1,
+				},
+				Spec: v1alpha1.ServiceMeshExtensionSpec{
+					Image:   "docker.io/test/test:latest",
+					Rollout: &v1alpha1.RolloutStrategy{Percentage: &fifty},
+				},
+			},
+			events: []ExtensionEvent{
+				{
+					Extension: &v1alpha1.ServiceMeshExtension{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:       "test",
+							Namespace:  "test",
+							Generation: 2,
+						},
+						Spec: v1alpha1.ServiceMeshExtensionSpec{
+							Image:   "docker.io/other/test:latest",
+							Rollout: &v1alpha1.RolloutStrategy{Percentage: &fifty},
+						},
+					},
+					Operation: ExtensionEventOperationUpdate,
+				},
+			},
+			// the previous module must be kept during the rollout, so both do not fit
+			quota: int64(len(fakestrategy.FakeModule) + len(fakestrategy.FakeModule2) - 1),
+			expectedStatus: v1alpha1.ServiceMeshExtensionStatus{
+				Phase:    fakestrategy.FakeManifest.Phase,
+				Priority: fakestrategy.FakeManifest.Priority,
+				Deployment: v1alpha1.DeploymentStatus{
+					Ready:           true,
+					ContainerSHA256: fakestrategy.FakeContainerSHA256,
+					SHA256:          fakestrategy.FakeModuleSHA256,
+				},
+				Conditions: []v1alpha1.Condition{
+					publishedConditions[0],
+					publishedConditions[1],
+					{
+						Type:   v1alpha1.ConditionTypePublished,
+						Status: corev1.ConditionFalse,
+						Reason: v1alpha1.ConditionReasonQuotaExceeded,
+						Message: fmt.Sprintf("failed to publish wasm module: module of %d bytes exceeds disk quota of %d bytes, "+
+							"%d bytes are used by other modules", len(fakestrategy.FakeModule2),
+							len(fakestrategy.FakeModule)+len(fakestrategy.FakeModule2)-1, len(fakestrategy.FakeModule)),
+					},
+				},
+				ObservedGeneration: 1,
+			},
+			expectedModules: 1,
+			expectedError:   true,
 		},
 	}
 	for _, tc := range testCases {
@@ -192,7 +559,9 @@ func TestWorker(t *testing.T) {
 					t.Fatalf("Failed to remove temp directory %s", tmpDir)
 				}
 			}()
-			w := createWorker(tmpDir, clientset)
+			w := createWorker(t, tmpDir, clientset)
+			w.modules.quota = tc.quota
+			w.verifier = tc.verifier
 			stopChan := make(chan struct{})
 			w.Start(stopChan)
 			w.client.ServiceMeshExtensions(tc.extension.Namespace).Create(context.TODO(), &tc.extension, metav1.CreateOptions{})
@@ -244,15 +613,31 @@ func TestWorker(t *testing.T) {
 				}
 			}
 			stopChan <- struct{}{}
+			// modules that are no longer referenced are deleted immediately without grace period
+			w.modules.CollectGarbage()
 			updatedExtension, err := w.client.ServiceMeshExtensions(tc.extension.Namespace).Get(context.TODO(), tc.extension.Name, metav1.GetOptions{})
 			if err != nil {
 				t.Fatalf("failed to Get() extension: %s", err)
 			}
 			// ignore Deployment.URL because it contains a random UUID
-			if !cmp.Equal(tc.expectedStatus, updatedExtension.Status, cmpopts.IgnoreFields(v1alpha1.DeploymentStatus{}, "URL")) {
-				t.Fatalf("comparison failed -got +want: %s", cmp.Diff(tc.expectedStatus, updatedExtension.Status, cmpopts.IgnoreFields(v1alpha1.DeploymentStatus{}, "URL")))
+			ignoredFields := cmp.Options{
+				cmpopts.IgnoreFields(v1alpha1.DeploymentStatus{}, "URL"),
+				cmpopts.IgnoreFields(v1alpha1.Condition{}, "LastTransitionTime"),
+			}
+			if !cmp.Equal(tc.expectedStatus, updatedExtension.Status, ignoredFields) {
+				t.Fatalf("comparison failed -got +want: %s", cmp.Diff(tc.expectedStatus, updatedExtension.Status, ignoredFields))
 			}
-			if !cmp.Equal(tc.expectedStatus, v1alpha1.ServiceMeshExtensionStatus{}) {
+			if events := len(w.eventRecorder.(*record.FakeRecorder).Events); events != tc.expectedEvents {
+				t.Fatalf("expected %d events but got %d", tc.expectedEvents, events)
+			}
+			modules, err := ioutil.ReadDir(tmpDir)
+			if err != nil {
+				t.Fatalf("failed to read serve directory: %s", err)
+			}
+			if len(modules) != tc.expectedModules {
+				t.Fatalf("expected %d modules but got %d", tc.expectedModules, len(modules))
+			}
+			if tc.expectedStatus.Deployment.Ready {
 				// validate URL
 				url, err := url.Parse(updatedExtension.Status.Deployment.URL)
 				if err != nil {
@@ -269,15 +654,156 @@ func TestWorker(t *testing.T) {
 	}
 }
 
-func createWorker(tmpDir string, clientset *fake.Clientset) *Worker {
+func createWorker(t *testing.T, tmpDir string, clientset *fake.Clientset) *Worker {
+	modules, err := NewModuleStore(tmpDir, 0, 0)
+	if err != nil {
+		t.Fatalf("failed to create module store: %s", err)
+	}
 	return &Worker{
 		baseURL:        baseURL,
 		client:         clientset.ServicemeshV1alpha1(),
 		mut:            sync.Mutex{},
 		pullStrategy:   &fakestrategy.PullStrategy{},
 		serveDirectory: tmpDir,
+		modules:        modules,
+		eventRecorder:  record.NewFakeRecorder(100),
 		Queue:          make(chan ExtensionEvent),
 		resultChan:     make(chan workerResult, 100),
 		enableLogger:   false,
 	}
 }
+
+func newVerifier(t *testing.T, rules ...verification.Rule) *verification.Verifier {
+	v, err := verification.NewVerifier(&verification.Policy{Rules: rules}, nil)
+	if err != nil {
+		t.Fatalf("failed to create verifier: %s", err)
+	}
+	return v
+}
+
+func TestUpdateStatusConflict(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	_, err := clientset.ServicemeshV1alpha1().ServiceMeshExtensions("test").Create(context.TODO(), &v1alpha1.ServiceMeshExtension{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "test"},
+		Status: v1alpha1.ServiceMeshExtensionStatus{
+			Deployment: v1alpha1.DeploymentStatus{SHA256: fakestrategy.FakeModule2SHA256},
+			Rollout: &v1alpha1.RolloutStatus{
+				Previous:   &v1alpha1.DeploymentStatus{URL: baseURL + "/previous"},
+				Failures:   3,
+				RolledBack: true,
+			},
+			AckedProxies: 5,
+			Conditions: []v1alpha1.Condition{
+				{Type: v1alpha1.ConditionTypeAppliedToProxies, Status: corev1.ConditionTrue, Reason: v1alpha1.ConditionReasonProxiesAcked},
+				{Type: v1alpha1.ConditionTypePulled, Status: corev1.ConditionFalse},
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("failed to create extension: %s", err)
+	}
+	// istiod updated the rollout state since the worker read the extension
+	conflicts := 1
+	clientset.PrependReactor("update", "servicemeshextensions", func(action ktesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "status" || conflicts == 0 {
+			return false, nil, nil
+		}
+		conflicts--
+		return true, nil, apierrors.NewConflict(v1alpha1.SchemeGroupVersion.WithResource("servicemeshextensions").GroupResource(),
+			"test", fmt.Errorf("the object has been modified"))
+	})
+	tmpDir, err := ioutil.TempDir("", "workertest")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	w := createWorker(t, tmpDir, clientset)
+
+	stale := &v1alpha1.ServiceMeshExtension{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "test"},
+		Status: v1alpha1.ServiceMeshExtensionStatus{
+			Deployment: v1alpha1.DeploymentStatus{SHA256: fakestrategy.FakeModule2SHA256, Ready: true},
+			Rollout: &v1alpha1.RolloutStatus{
+				Previous: &v1alpha1.DeploymentStatus{URL: baseURL + "/previous"},
+			},
+			ObservedGeneration: 2,
+			Conditions: []v1alpha1.Condition{
+				{Type: v1alpha1.ConditionTypePulled, Status: corev1.ConditionTrue},
+			},
+		},
+	}
+	if err := w.updateStatus(stale); err != nil {
+		t.Fatalf("failed to update status: %s", err)
+	}
+	updated, err := w.client.ServiceMeshExtensions("test").Get(context.TODO(), "test", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to Get() extension: %s", err)
+	}
+	if !updated.Status.Deployment.Ready || updated.Status.ObservedGeneration != 2 {
+		t.Errorf("status of the worker was not written: %v", updated.Status)
+	}
+	if updated.Status.Rollout.Failures != 3 || !updated.Status.Rollout.RolledBack {
+		t.Errorf("rollout state written by istiod was overwritten: %v", updated.Status.Rollout)
+	}
+	if updated.Status.AckedProxies != 5 {
+		t.Errorf("acknowledgements written by istiod were overwritten: %v", updated.Status)
+	}
+	if c := updated.Status.GetCondition(v1alpha1.ConditionTypeAppliedToProxies); c == nil || c.Status != corev1.ConditionTrue {
+		t.Errorf("condition written by istiod was overwritten: %v", updated.Status.Conditions)
+	}
+	if c := updated.Status.GetCondition(v1alpha1.ConditionTypePulled); c == nil || c.Status != corev1.ConditionTrue {
+		t.Errorf("condition of the worker was not written: %v", updated.Status.Conditions)
+	}
+}
+
+type failingPullStrategy struct {
+	fakestrategy.PullStrategy
+}
+
+func (p *failingPullStrategy) PullImage(imageRef *model.ImageRef) (model.Image, error) {
+	return nil, fmt.Errorf("registry unavailable")
+}
+
+func TestFailedPullAfterRestartKeepsModule(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "workertest")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	// the module was published before the restart
+	id := uuid.New().String()
+	if err := ioutil.WriteFile(path.Join(tmpDir, id), []byte(fakestrategy.FakeModule), 0644); err != nil {
+		t.Fatalf("failed to write module: %s", err)
+	}
+	clientset := fake.NewSimpleClientset()
+	w := createWorker(t, tmpDir, clientset)
+	w.pullStrategy = &failingPullStrategy{}
+
+	extension := &v1alpha1.ServiceMeshExtension{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "test", Generation: 2},
+		Spec: v1alpha1.ServiceMeshExtensionSpec{
+			Image: "docker.io/test/test:latest",
+		},
+		Status: v1alpha1.ServiceMeshExtensionStatus{
+			Deployment: v1alpha1.DeploymentStatus{
+				Ready:           true,
+				URL:             baseURL + "/" + id,
+				ContainerSHA256: fakestrategy.FakeContainerSHA256,
+				SHA256:          fakestrategy.FakeModuleSHA256,
+			},
+			ObservedGeneration: 1,
+		},
+	}
+	if _, err := w.client.ServiceMeshExtensions("test").Create(context.TODO(), extension, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("failed to create extension: %s", err)
+	}
+	w.processEvent(ExtensionEvent{Extension: extension, Operation: ExtensionEventOperationAdd})
+	if res := <-w.resultChan; res.successful {
+		t.Fatalf("expected the pull to fail")
+	}
+	// modules that are no longer referenced are deleted immediately without grace period
+	w.modules.CollectGarbage()
+	if _, err := os.Stat(path.Join(tmpDir, id)); err != nil {
+		t.Fatalf("module referenced by the extension status was deleted: %s", err)
+	}
+}
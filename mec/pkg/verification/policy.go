@@ -0,0 +1,119 @@
+// Copyright Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verification
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Policy describes which WebAssembly modules mec is allowed to publish.
+//
+// Example:
+//
+//	publicKeys:
+//	- /etc/mec/keys/release.pub
+//	rules:
+//	- image: quay.io/maistra/*
+//	  requireSignature: true
+//	- image: docker.io/corp/header-append
+//	  digests:
+//	  - 9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08
+type Policy struct {
+	// PublicKeys are paths to PEM encoded public keys that signatures are verified against
+	PublicKeys []string `yaml:"publicKeys"`
+	// Rules are evaluated in order, the first rule matching an image applies
+	Rules []Rule `yaml:"rules"`
+}
+
+// Rule defines the verification requirements for a set of images
+type Rule struct {
+	// Image is the image repository without tag or digest. A trailing '*' matches any suffix.
+	Image string `yaml:"image"`
+	// Digests pins the image to a set of sha256 digests. A digest matches
+	// either the container image or the WebAssembly module it contains.
+	Digests []string `yaml:"digests"`
+	// RequireSignature requires at least one valid signature from one of the policy's public keys
+	RequireSignature bool `yaml:"requireSignature"`
+}
+
+// LoadPolicy reads a Policy from a YAML file and loads the public keys it references.
+// Relative key paths are resolved against the directory of the policy file.
+func LoadPolicy(filename string) (*Verifier, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read verification policy: %v", err)
+	}
+	policy := &Policy{}
+	if err := yaml.UnmarshalStrict(data, policy); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal verification policy: %v", err)
+	}
+	keys := make([]crypto.PublicKey, 0, len(policy.PublicKeys))
+	for _, keyFile := range policy.PublicKeys {
+		if !filepath.IsAbs(keyFile) {
+			keyFile = filepath.Join(filepath.Dir(filename), keyFile)
+		}
+		keyPEM, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read public key: %v", err)
+		}
+		key, err := ParsePublicKey(keyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key %s: %v", keyFile, err)
+		}
+		keys = append(keys, key)
+	}
+	return NewVerifier(policy, keys)
+}
+
+// ParsePublicKey parses a PEM encoded PKIX public key
+func ParsePublicKey(keyPEM []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+func (r *Rule) matches(image string) bool {
+	if strings.HasSuffix(r.Image, "*") {
+		return strings.HasPrefix(image, strings.TrimSuffix(r.Image, "*"))
+	}
+	return r.Image == image
+}
+
+func (p *Policy) validate(keys []crypto.PublicKey) error {
+	for i, rule := range p.Rules {
+		if rule.Image == "" {
+			return fmt.Errorf("rule %d: image must not be empty", i)
+		}
+		if rule.RequireSignature && len(keys) == 0 {
+			return fmt.Errorf("rule %d: requireSignature is set but no public keys are configured", i)
+		}
+		for _, digest := range rule.Digests {
+			if len(strings.TrimPrefix(digest, sha256Prefix)) != 64 {
+				return fmt.Errorf("rule %d: invalid sha256 digest '%s'", i, digest)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+// Copyright Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verification
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"istio.io/istio/mec/pkg/model"
+)
+
+const (
+	sha256Prefix = "sha256:"
+
+	cosignSignatureType = "cosign container image signature"
+)
+
+// Verifier enforces a Policy on pulled images
+type Verifier struct {
+	policy *Policy
+	keys   []crypto.PublicKey
+}
+
+// simpleSigningPayload is the payload signed by cosign
+type simpleSigningPayload struct {
+	Critical struct {
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+}
+
+// NewVerifier creates a Verifier for the given policy. keys are the public
+// keys that signatures are verified against.
+func NewVerifier(policy *Policy, keys []crypto.PublicKey) (*Verifier, error) {
+	for _, key := range keys {
+		switch key.(type) {
+		case *ecdsa.PublicKey, *rsa.PublicKey, ed25519.PublicKey:
+		default:
+			return nil, fmt.Errorf("unsupported public key type %T", key)
+		}
+	}
+	if err := policy.validate(keys); err != nil {
+		return nil, fmt.Errorf("invalid verification policy: %v", err)
+	}
+	return &Verifier{
+		policy: policy,
+		keys:   keys,
+	}, nil
+}
+
+// Verify checks an image and the sha256 of the WebAssembly module extracted
+// from it against the policy. Images not matched by any rule are accepted.
+func (v *Verifier) Verify(imageRef *model.ImageRef, img model.Image, moduleSHA256 string, pullStrategy model.ImagePullStrategy) error {
+	repository := imageRef.Hub + "/" + imageRef.Repository
+	var rule *Rule
+	for i := range v.policy.Rules {
+		if v.policy.Rules[i].matches(repository) {
+			rule = &v.policy.Rules[i]
+			break
+		}
+	}
+	if rule == nil {
+		return nil
+	}
+
+	imageDigest := strings.TrimPrefix(img.SHA256(), sha256Prefix)
+	if len(rule.Digests) > 0 {
+		pinned := false
+		for _, digest := range rule.Digests {
+			digest = strings.TrimPrefix(digest, sha256Prefix)
+			if digest == imageDigest || digest == moduleSHA256 {
+				pinned = true
+				break
+			}
+		}
+		if !pinned {
+			return fmt.Errorf("neither image digest %s nor module digest %s is pinned for %s", imageDigest, moduleSHA256, repository)
+		}
+	}
+
+	if rule.RequireSignature {
+		fetcher, ok := pullStrategy.(model.SignatureFetcher)
+		if !ok {
+			return fmt.Errorf("signature required for %s but the pull strategy does not support signatures", repository)
+		}
+		signatures, err := fetcher.GetSignatures(imageRef, sha256Prefix+imageDigest)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve signatures for %s: %v", repository, err)
+		}
+		if len(signatures) == 0 {
+			return fmt.Errorf("signature required for %s but image %s is not signed", repository, imageDigest)
+		}
+		var lastErr error
+		for _, sig := range signatures {
+			if lastErr = v.verifySignature(sig, repository, imageDigest); lastErr == nil {
+				return nil
+			}
+		}
+		return fmt.Errorf("no valid signature found for image %s: %v", imageDigest, lastErr)
+	}
+	return nil
+}
+
+func (v *Verifier) verifySignature(sig model.Signature, repository, imageDigest string) error {
+	verified := false
+	for _, key := range v.keys {
+		if verifyWithKey(key, sig.Payload, sig.Signature) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return fmt.Errorf("signature does not match any trusted public key")
+	}
+
+	payload := &simpleSigningPayload{}
+	if err := json.Unmarshal(sig.Payload, payload); err != nil {
+		return fmt.Errorf("failed to unmarshal signature payload: %v", err)
+	}
+	if payload.Critical.Type != cosignSignatureType {
+		return fmt.Errorf("unexpected signature type '%s'", payload.Critical.Type)
+	}
+	if payload.Critical.Image.DockerManifestDigest != sha256Prefix+imageDigest {
+		return fmt.Errorf("signature is for digest %s", payload.Critical.Image.DockerManifestDigest)
+	}
+	if ref := payload.Critical.Identity.DockerReference; ref != "" && ref != repository {
+		return fmt.Errorf("signature is for repository %s", ref)
+	}
+	return nil
+}
+
+func verifyWithKey(key crypto.PublicKey, payload, signature []byte) bool {
+	digest := sha256.Sum256(payload)
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(k, digest[:], signature)
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], signature) == nil
+	case ed25519.PublicKey:
+		return ed25519.Verify(k, payload, signature)
+	}
+	return false
+}
@@ -0,0 +1,294 @@
+// Copyright Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verification
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"istio.io/istio/mec/pkg/model"
+	fakestrategy "istio.io/istio/mec/pkg/pullstrategy/fake"
+)
+
+const (
+	imageDigest  = "41af286dc0b172ed2f1ca934fd2278de4a1192302ffa07087cea2682e7d372e3"
+	moduleDigest = fakestrategy.FakeModuleSHA256
+)
+
+type fakeImage struct{}
+
+func (i *fakeImage) CopyWasmModule(outputFile string) error { return nil }
+func (i *fakeImage) GetManifest() *model.Manifest           { return &fakestrategy.FakeManifest }
+func (i *fakeImage) SHA256() string                         { return imageDigest }
+
+type fakeSignatureFetcher struct {
+	fakestrategy.PullStrategy
+	signatures []model.Signature
+}
+
+func (f *fakeSignatureFetcher) GetSignatures(image *model.ImageRef, digest string) ([]model.Signature, error) {
+	return f.signatures, nil
+}
+
+func payloadFor(repository, digest string) []byte {
+	return []byte(fmt.Sprintf(`{"critical":{"identity":{"docker-reference":"%s"},"image":{"docker-manifest-digest":"sha256:%s"},`+
+		`"type":"cosign container image signature"},"optional":null}`, repository, digest))
+}
+
+func sign(t *testing.T, key *ecdsa.PrivateKey, payload []byte) model.Signature {
+	t.Helper()
+	digest := sha256.Sum256(payload)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatalf("failed to sign payload: %s", err)
+	}
+	return model.Signature{
+		Payload:   payload,
+		Signature: sig,
+	}
+}
+
+func TestVerify(t *testing.T) {
+	trustedKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	untrustedKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repository := "quay.io/maistra/test"
+	imageRef := model.StringToImageRef(repository + ":latest")
+
+	testCases := []struct {
+		name          string
+		rules         []Rule
+		signatures    []model.Signature
+		noSignatures  bool
+		expectedError bool
+	}{
+		{
+			name: "pass_noMatchingRule",
+			rules: []Rule{
+				{Image: "docker.io/*", RequireSignature: true},
+			},
+		},
+		{
+			name: "pass_moduleDigestPinned",
+			rules: []Rule{
+				{Image: repository, Digests: []string{moduleDigest}},
+			},
+		},
+		{
+			name: "pass_imageDigestPinned",
+			rules: []Rule{
+				{Image: "quay.io/*", Digests: []string{"sha256:" + imageDigest}},
+			},
+		},
+		{
+			name: "fail_digestNotPinned",
+			rules: []Rule{
+				{Image: repository, Digests: []string{fakestrategy.FakeModule2SHA256}},
+			},
+			expectedError: true,
+		},
+		{
+			name: "pass_signed",
+			rules: []Rule{
+				{Image: "quay.io/maistra/*", RequireSignature: true},
+			},
+			signatures: []model.Signature{
+				sign(t, untrustedKey, payloadFor(repository, imageDigest)),
+				sign(t, trustedKey, payloadFor(repository, imageDigest)),
+			},
+		},
+		{
+			name: "fail_unsigned",
+			rules: []Rule{
+				{Image: "quay.io/maistra/*", RequireSignature: true},
+			},
+			expectedError: true,
+		},
+		{
+			name: "fail_untrustedKey",
+			rules: []Rule{
+				{Image: "quay.io/maistra/*", RequireSignature: true},
+			},
+			signatures: []model.Signature{
+				sign(t, untrustedKey, payloadFor(repository, imageDigest)),
+			},
+			expectedError: true,
+		},
+		{
+			name: "fail_signatureForOtherDigest",
+			rules: []Rule{
+				{Image: "quay.io/maistra/*", RequireSignature: true},
+			},
+			signatures: []model.Signature{
+				sign(t, trustedKey, payloadFor(repository, moduleDigest)),
+			},
+			expectedError: true,
+		},
+		{
+			name: "fail_signatureForOtherRepository",
+			rules: []Rule{
+				{Image: "quay.io/maistra/*", RequireSignature: true},
+			},
+			signatures: []model.Signature{
+				sign(t, trustedKey, payloadFor("quay.io/maistra/other", imageDigest)),
+			},
+			expectedError: true,
+		},
+		{
+			name: "fail_tamperedPayload",
+			rules: []Rule{
+				{Image: "quay.io/maistra/*", RequireSignature: true},
+			},
+			signatures: []model.Signature{
+				{
+					Payload:   payloadFor(repository, imageDigest),
+					Signature: sign(t, trustedKey, payloadFor("quay.io/maistra/other", imageDigest)).Signature,
+				},
+			},
+			expectedError: true,
+		},
+		{
+			name: "fail_strategyWithoutSignatureSupport",
+			rules: []Rule{
+				{Image: "quay.io/maistra/*", RequireSignature: true},
+			},
+			noSignatures:  true,
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := NewVerifier(&Policy{Rules: tc.rules}, []crypto.PublicKey{&trustedKey.PublicKey})
+			if err != nil {
+				t.Fatalf("failed to create verifier: %s", err)
+			}
+			var strategy model.ImagePullStrategy = &fakeSignatureFetcher{signatures: tc.signatures}
+			if tc.noSignatures {
+				strategy = &fakestrategy.PullStrategy{}
+			}
+			err = v.Verify(imageRef, &fakeImage{}, moduleDigest, strategy)
+			if tc.expectedError && err == nil {
+				t.Error("Expected error but got nil")
+			} else if !tc.expectedError && err != nil {
+				t.Errorf("Expected no error but got %s", err)
+			}
+		})
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyBytes, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpDir, err := ioutil.TempDir("", "policytest")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, "key.pub"),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: keyBytes}), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name          string
+		policy        string
+		expectedError bool
+	}{
+		{
+			name: "pass",
+			policy: `
+publicKeys:
+- key.pub
+rules:
+- image: quay.io/maistra/*
+  requireSignature: true
+- image: docker.io/test/test
+  digests:
+  - ` + moduleDigest,
+		},
+		{
+			name: "fail_missingKey",
+			policy: `
+publicKeys:
+- missing.pub
+`,
+			expectedError: true,
+		},
+		{
+			name: "fail_signatureWithoutKeys",
+			policy: `
+rules:
+- image: quay.io/maistra/*
+  requireSignature: true
+`,
+			expectedError: true,
+		},
+		{
+			name: "fail_invalidDigest",
+			policy: `
+rules:
+- image: quay.io/maistra/*
+  digests:
+  - abcdef
+`,
+			expectedError: true,
+		},
+		{
+			name: "fail_unknownField",
+			policy: `
+rules:
+- image: quay.io/maistra/*
+  requireSignatures: true
+`,
+			expectedError: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			policyFile := filepath.Join(tmpDir, tc.name+".yaml")
+			if err := ioutil.WriteFile(policyFile, []byte(tc.policy), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := LoadPolicy(policyFile)
+			if tc.expectedError && err == nil {
+				t.Error("Expected error but got nil")
+			} else if !tc.expectedError && err != nil {
+				t.Errorf("Expected no error but got %s", err)
+			}
+		})
+	}
+}
@@ -42,6 +42,7 @@ import (
 	"istio.io/istio/pkg/security"
 	"istio.io/istio/pkg/util/gogoprotomarshal"
 	"istio.io/istio/security/pkg/credentialfetcher"
+	"istio.io/istio/security/pkg/keyprovider"
 	stsserver "istio.io/istio/security/pkg/stsservice/server"
 	"istio.io/istio/security/pkg/stsservice/tokenmanager"
 	cleaniptables "istio.io/istio/tools/istio-clean-iptables/pkg/cmd"
@@ -139,13 +140,36 @@ var (
 	eccSigAlgEnv        = env.RegisterStringVar("ECC_SIGNATURE_ALGORITHM", "", "The type of ECC signature algorithm to use when generating private keys").Get()
 	fileMountedCertsEnv = env.RegisterBoolVar("FILE_MOUNTED_CERTS", false, "").Get()
 	useTokenForCSREnv   = env.RegisterBoolVar("USE_TOKEN_FOR_CSR", false, "CSR requires a token").Get()
-	credFetcherTypeEnv  = env.RegisterStringVar("CREDENTIAL_FETCHER_TYPE", "",
-		"The type of the credential fetcher. Currently supported types include GoogleComputeEngine").Get()
+	restCAAuthEnv       = env.RegisterStringVar("REST_CA_AUTH", "token",
+		"The authentication of the CSRs sent to the RestCA provider: token, ott or mtls").Get()
+	restCATokenFileEnv = env.RegisterStringVar("REST_CA_TOKEN_FILE", "",
+		"The file holding the token used to authenticate with the RestCA provider. Defaults to the workload token").Get()
+	restCAClientCertEnv = env.RegisterStringVar("REST_CA_CLIENT_CERT", "",
+		"The client certificate presented to the RestCA provider").Get()
+	restCAClientKeyEnv = env.RegisterStringVar("REST_CA_CLIENT_KEY", "",
+		"The key of the client certificate presented to the RestCA provider").Get()
+	restCARootCertEnv = env.RegisterStringVar("REST_CA_ROOT_CERT", "",
+		"The root certificate of the PKI behind the RestCA provider, appended to the returned certificate chains "+
+			"that do not include it").Get()
+	credFetcherTypeEnv = env.RegisterStringVar("CREDENTIAL_FETCHER_TYPE", "",
+		"The type of the credential fetcher. Currently supported types include GoogleComputeEngine, AWS, Azure "+
+			"and OIDC").Get()
 	credIdentityProvider = env.RegisterStringVar("CREDENTIAL_IDENTITY_PROVIDER", "GoogleComputeEngine",
 		"The identity provider for credential. Currently default supported identity provider is GoogleComputeEngine").Get()
+	keyProviderEnv = env.RegisterStringVar("KEY_PROVIDER", security.KeyProviderMemory,
+		"The provider of the workload private keys: memory or file. Keys are only sent to the proxy by the "+
+			"memory provider, the proxy reads them from their file otherwise").Get()
+	keyProviderDirEnv = env.RegisterStringVar("KEY_PROVIDER_DIR", "./etc/istio/proxy/keys",
+		"The directory holding the workload private keys of the file key provider").Get()
 	proxyXDSViaAgent = env.RegisterBoolVar("PROXY_XDS_VIA_AGENT", true,
 		"If set to true, envoy will proxy XDS calls via the agent instead of directly connecting to istiod. This option "+
 			"will be removed once the feature is stabilized.").Get()
+	wasmHealthCheckInterval = env.RegisterDurationVar("WASM_HEALTH_CHECK_INTERVAL", 10*time.Second,
+		"The interval at which WebAssembly failures in Envoy are checked and reported to istiod, "+
+			"which uses them to roll back extension rollouts. Zero disables the check.").Get()
+	grpcBootstrapEnv = env.RegisterStringVar("GRPC_XDS_BOOTSTRAP", "",
+		"If set, the agent writes a bootstrap to this file for proxyless gRPC applications, "+
+			"which connect to the XDS proxy of the agent.").Get()
 	// This is a copy of the env var in the init code.
 	dnsCaptureByAgent = env.RegisterBoolVar("ISTIO_META_DNS_CAPTURE", false,
 		"If set to true, enable the capture of outgoing DNS packets on port 53, redirecting to istio-agent on :15053").Get()
@@ -266,6 +290,11 @@ var (
 			secOpts.EnableWorkloadSDS = true
 			secOpts.EnableGatewaySDS = enableGatewaySDSEnv
 			secOpts.CAProviderName = caProviderEnv
+			secOpts.RESTCAAuth = restCAAuthEnv
+			secOpts.RESTCATokenFile = restCATokenFileEnv
+			secOpts.RESTCAClientCertFile = restCAClientCertEnv
+			secOpts.RESTCAClientKeyFile = restCAClientKeyEnv
+			secOpts.RESTCARootCertFile = restCARootCertEnv
 
 			secOpts.TrustDomain = trustDomainEnv
 			secOpts.Pkcs8Keys = pkcs8KeysEnv
@@ -278,9 +307,7 @@ var (
 			// Disable the secret eviction for istio agent.
 			secOpts.EvictionDuration = 0
 
-			// TODO (liminw): CredFetcher is a general interface. In 1.7, we limit the use on GCE only because
-			// GCE is the only supported plugin at the moment.
-			if credFetcherTypeEnv == security.GCE {
+			if credFetcherTypeEnv != "" {
 				secOpts.CredIdentityProvider = credIdentityProvider
 				credFetcher, err := credentialfetcher.NewCredFetcher(credFetcherTypeEnv, secOpts.TrustDomain, jwtPath, secOpts.CredIdentityProvider)
 				if err != nil {
@@ -290,10 +317,20 @@ var (
 				secOpts.CredFetcher = credFetcher
 			}
 
+			keyProvider, err := keyprovider.NewKeyProvider(keyprovider.Options{
+				Type: keyProviderEnv,
+				Dir:  keyProviderDirEnv,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to create key provider: %v", err)
+			}
+			secOpts.KeyProvider = keyProvider
+
 			agentConfig := &istio_agent.AgentConfig{
 				XDSRootCerts: xdsRootCA,
 				CARootCerts:  caRootCA,
 				XDSHeaders:   map[string]string{},
+				ServiceNode:  role.ServiceNode(),
 			}
 			extractXDSHeadersFromEnv(agentConfig)
 			if proxyXDSViaAgent {
@@ -301,6 +338,8 @@ var (
 				agentConfig.DNSCapture = dnsCaptureByAgent
 				agentConfig.ProxyNamespace = podNamespace
 				agentConfig.ProxyDomain = role.DNSDomain
+				agentConfig.WasmHealthCheckInterval = wasmHealthCheckInterval
+				agentConfig.GRPCBootstrapPath = grpcBootstrapEnv
 			}
 			sa := istio_agent.NewAgent(&proxyConfig, agentConfig, secOpts)
 
@@ -124,12 +124,11 @@ func (s *Server) initConfigController(args *PilotArgs) error {
 	// Create the config store.
 	s.environment.IstioConfigStore = model.MakeIstioStore(s.configController)
 
-	if features.EnableIOR {
-		ior.Register(s.kubeClient, s.configController, args.Namespace, s.kubeClient.GetMemberRoll())
-	}
-
 	// Defer starting the controller until after the service is created.
 	s.addStartFunc(func(stop <-chan struct{}) error {
+		if features.EnableIOR {
+			ior.Register(s.kubeClient, s.configController, args.Namespace, s.kubeClient.GetMemberRoll(), stop)
+		}
 		go s.configController.Run(stop)
 		return nil
 	})
@@ -147,7 +146,20 @@ func (s *Server) initK8SConfigStore(args *PilotArgs) error {
 	}
 	s.ConfigStores = append(s.ConfigStores, configController)
 	if features.EnableServiceApis {
-		s.ConfigStores = append(s.ConfigStores, gateway.NewController(s.kubeClient, configController, args.RegistryOptions.KubeOptions))
+		gwc := gateway.NewController(s.kubeClient, configController, args.RegistryOptions.KubeOptions)
+		s.ConfigStores = append(s.ConfigStores, gwc)
+		s.addTerminatingStartFunc(func(stop <-chan struct{}) error {
+			leaderelection.
+				NewLeaderElection(args.Namespace, args.PodName, leaderelection.GatewayStatusController, s.kubeClient).
+				AddRunFunction(func(leaderStop <-chan struct{}) {
+					log.Infof("Starting gateway status writer")
+					gwc.SetStatusWrite(true)
+					<-leaderStop
+					log.Infof("Stopping gateway status writer")
+					gwc.SetStatusWrite(false)
+				}).Run(stop)
+			return nil
+		})
 	}
 	if features.EnableAnalysis {
 		if err := s.initInprocessAnalysisController(args); err != nil {
@@ -0,0 +1,294 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"context"
+	"io/ioutil"
+	"sort"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+
+	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/servicemesh/apis/servicemesh/v1alpha1"
+	"istio.io/istio/pkg/spiffe"
+	"istio.io/pkg/log"
+)
+
+const (
+	// Groups of federated trust bundle sources. Sources from the environment take precedence,
+	// as the groups are sorted by name.
+	envBundleSources = "environment"
+	crdBundleSources = "servicemeshtrustbundles"
+)
+
+var trustBundleResource = v1alpha1.SchemeGroupVersion.WithResource("servicemeshtrustbundles")
+
+// initFederatedTrustBundles keeps the trust bundles of federated SPIFFE trust domains up to date.
+// Istiod verifies its clients with them, and if enabled, distributes them to proxies over SDS.
+func (s *Server) initFederatedTrustBundles(args *PilotArgs) error {
+	sources, err := bundleSourcesFromEnv()
+	if err != nil {
+		return err
+	}
+	watchResources := features.EnableFederatedTrustBundles && s.kubeClient != nil
+	if len(sources) == 0 && !watchResources {
+		return nil
+	}
+
+	bundles, err := spiffe.NewFederatedBundles(features.SpiffeBundleRefreshInterval, nil)
+	if err != nil {
+		return err
+	}
+	bundles.SetSources(envBundleSources, sources)
+	// Fetch the bundles before serving, so that clients from federated trust domains are accepted right away.
+	if err := bundles.Refresh(); err != nil {
+		log.Warnf("failed to fetch SPIFFE trust bundles, retrying in the background: %v", err)
+	}
+	provider := &trustBundleProvider{
+		bundles:    bundles,
+		caCertFile: args.ServerOptions.TLSOptions.CaCertFile,
+		server:     s,
+	}
+	provider.updatePeerCertVerifier()
+	bundles.AddHandler(func() {
+		provider.updatePeerCertVerifier()
+		if features.EnableFederatedTrustBundles {
+			s.XDSServer.ConfigUpdate(&model.PushRequest{
+				Full:   true,
+				Reason: []model.TriggerReason{model.TrustBundleTrigger},
+			})
+		}
+	})
+	if features.EnableFederatedTrustBundles {
+		s.environment.TrustBundles = provider
+	}
+	if watchResources {
+		s.initTrustBundleInformer(args.Namespace, bundles)
+	}
+
+	s.addStartFunc(func(stop <-chan struct{}) error {
+		go bundles.Run(stop)
+		return nil
+	})
+	return nil
+}
+
+func bundleSourcesFromEnv() ([]spiffe.BundleSource, error) {
+	var sources []spiffe.BundleSource
+	if features.SpiffeBundleEndpoints != "" {
+		endpoints, err := spiffe.ParseBundleEndpoints(features.SpiffeBundleEndpoints)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, endpoints...)
+	}
+	if features.SpiffeBundleFiles != "" {
+		files, err := spiffe.ParseBundleFiles(features.SpiffeBundleFiles)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, files...)
+	}
+	return sources, nil
+}
+
+// initTrustBundleInformer watches the ServiceMeshTrustBundles in the istiod namespace. Other namespaces
+// are not watched, since a trust bundle lets proxies throughout the mesh accept peers of its trust domain.
+func (s *Server) initTrustBundleInformer(namespace string, bundles *spiffe.FederatedBundles) {
+	client := s.kubeClient.Dynamic().Resource(trustBundleResource).Namespace(namespace)
+	informer := cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return client.List(context.TODO(), options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return client.Watch(context.TODO(), options)
+			},
+		},
+		&unstructured.Unstructured{},
+		0,
+		cache.Indexers{},
+	)
+	update := func() {
+		bundles.SetSources(crdBundleSources, trustBundleSources(informer.GetStore().List()))
+	}
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { update() },
+		UpdateFunc: func(interface{}, interface{}) { update() },
+		DeleteFunc: func(interface{}) { update() },
+	})
+	s.addStartFunc(func(stop <-chan struct{}) error {
+		go informer.Run(stop)
+		return nil
+	})
+}
+
+// trustBundleSources returns the bundle sources configured by ServiceMeshTrustBundles, ordered by name.
+func trustBundleSources(objs []interface{}) []spiffe.BundleSource {
+	resources := make([]*v1alpha1.ServiceMeshTrustBundle, 0, len(objs))
+	for _, obj := range objs {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+		tb := &v1alpha1.ServiceMeshTrustBundle{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, tb); err != nil {
+			log.Warnf("invalid ServiceMeshTrustBundle %s/%s: %v", u.GetNamespace(), u.GetName(), err)
+			continue
+		}
+		resources = append(resources, tb)
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		return resources[i].Name < resources[j].Name
+	})
+
+	sources := make([]spiffe.BundleSource, 0, len(resources))
+	for _, tb := range resources {
+		spec := tb.Spec
+		if spec.TrustDomain == "" || (spec.Endpoint == "") == (spec.Bundle == "") {
+			log.Warnf("invalid ServiceMeshTrustBundle %s/%s: a trust domain and exactly one of endpoint and bundle must be set",
+				tb.Namespace, tb.Name)
+			continue
+		}
+		source := spiffe.BundleSource{TrustDomain: spec.TrustDomain, Bundle: []byte(spec.Bundle)}
+		if spec.Endpoint != "" {
+			source = spiffe.BundleSource{TrustDomain: spec.TrustDomain, Endpoint: spec.Endpoint}
+		}
+		sources = append(sources, source)
+	}
+	return sources
+}
+
+// trustBundleProvider provides the federated trust bundles to the push context.
+type trustBundleProvider struct {
+	bundles    *spiffe.FederatedBundles
+	caCertFile string
+	server     *Server
+
+	mu sync.Mutex
+	// verified are the trust domains set in the peer cert verifier of istiod.
+	verified []string
+}
+
+var _ model.TrustBundleProvider = &trustBundleProvider{}
+
+// FederatedTrustDomains returns the federated trust domains, except for the trust domain of the mesh itself.
+func (p *trustBundleProvider) FederatedTrustDomains() []string {
+	local := spiffe.GetTrustDomain()
+	var out []string
+	for _, td := range p.bundles.TrustDomains() {
+		if td != local {
+			out = append(out, td)
+		}
+	}
+	return out
+}
+
+func (p *trustBundleProvider) TrustBundle(trustDomain string) []byte {
+	if trustDomain == spiffe.GetTrustDomain() {
+		return nil
+	}
+	if bundle := p.bundles.Bundle(trustDomain); bundle != nil {
+		return bundle.PEM()
+	}
+	return nil
+}
+
+// MeshTrustBundle returns the root certificates of the mesh and of all federated trust domains.
+func (p *trustBundleProvider) MeshTrustBundle() []byte {
+	roots := p.server.meshRootCerts(p.caCertFile)
+	if len(roots) == 0 {
+		// Without the root certificates of the mesh, peers of the mesh would be rejected.
+		return nil
+	}
+	for _, td := range p.FederatedTrustDomains() {
+		roots = append(roots, p.TrustBundle(td)...)
+	}
+	return roots
+}
+
+// MeshCRL returns the certificate revocation list of the mesh CA and those of the federated trust domains.
+// Proxies require a CRL of every CA once one is configured, so peers of federated trust domains that do not
+// provide their CRLs are rejected while the mesh CA publishes one.
+func (p *trustBundleProvider) MeshCRL() []byte {
+	p.server.crlMu.RLock()
+	crl := append([]byte(nil), p.server.crl...)
+	p.server.crlMu.RUnlock()
+	if len(crl) == 0 {
+		return nil
+	}
+	for _, td := range p.FederatedTrustDomains() {
+		bundle := p.bundles.Bundle(td)
+		if bundle == nil {
+			continue
+		}
+		if len(bundle.CRLs) == 0 {
+			log.Warnf("trust bundle of %s does not contain a certificate revocation list, its peers are rejected "+
+				"while the mesh CA revokes certificates", td)
+		}
+		crl = append(crl, bundle.CRLPEM()...)
+	}
+	return crl
+}
+
+// updatePeerCertVerifier sets the federated trust bundles in the peer cert verifier of istiod, and removes
+// the trust domains that are no longer federated.
+func (p *trustBundleProvider) updatePeerCertVerifier() {
+	verifier := p.server.peerCertVerifier
+	if verifier == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	current := p.FederatedTrustDomains()
+	for _, td := range current {
+		if bundle := p.bundles.Bundle(td); bundle != nil {
+			verifier.SetMapping(td, bundle.Certs)
+		}
+	}
+	for _, td := range p.verified {
+		if p.bundles.Bundle(td) == nil {
+			verifier.SetMapping(td, nil)
+		}
+	}
+	p.verified = current
+}
+
+// meshRootCerts returns the PEM encoded root certificates of the mesh.
+func (s *Server) meshRootCerts(caCertFile string) []byte {
+	var rootCertBytes []byte
+	if caCertFile != "" {
+		var err error
+		if rootCertBytes, err = ioutil.ReadFile(caCertFile); err != nil {
+			log.Errorf("failed to read root certificates %s: %v", caCertFile, err)
+			return nil
+		}
+		return rootCertBytes
+	}
+	if s.RA != nil {
+		rootCertBytes = append(rootCertBytes, s.RA.GetCAKeyCertBundle().GetRootCertPem()...)
+	}
+	if s.CA != nil {
+		rootCertBytes = append(rootCertBytes, s.CA.GetCAKeyCertBundle().GetRootCertPem()...)
+	}
+	return rootCertBytes
+}
@@ -0,0 +1,212 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"istio.io/istio/pkg/spiffe"
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+func newTrustBundle(name, trustDomain, endpoint, bundle string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "maistra.io/v1alpha1",
+		"kind":       "ServiceMeshTrustBundle",
+		"metadata":   map[string]interface{}{"name": name, "namespace": namespace},
+		"spec": map[string]interface{}{
+			"trustDomain": trustDomain,
+			"endpoint":    endpoint,
+			"bundle":      bundle,
+		},
+	}}
+}
+
+func TestTrustBundleSources(t *testing.T) {
+	sources := trustBundleSources([]interface{}{
+		newTrustBundle("b", "example.com", "", "-----BEGIN CERTIFICATE-----"),
+		newTrustBundle("a", "example.org", "https://example.org/bundle", ""),
+		newTrustBundle("both", "example.net", "https://example.net/bundle", "-----BEGIN CERTIFICATE-----"),
+		newTrustBundle("no-trust-domain", "", "https://example.net/bundle", ""),
+	})
+	expected := []spiffe.BundleSource{
+		{TrustDomain: "example.org", Endpoint: "https://example.org/bundle"},
+		{TrustDomain: "example.com", Bundle: []byte("-----BEGIN CERTIFICATE-----")},
+	}
+	if len(sources) != len(expected) {
+		t.Fatalf("expected %d sources, got %v", len(expected), sources)
+	}
+	for i := range expected {
+		if sources[i].TrustDomain != expected[i].TrustDomain || sources[i].Endpoint != expected[i].Endpoint ||
+			!bytes.Equal(sources[i].Bundle, expected[i].Bundle) {
+			t.Errorf("source %d: expected %v, got %v", i, expected[i], sources[i])
+		}
+	}
+}
+
+type testCA struct {
+	certPem []byte
+	keyPem  []byte
+}
+
+func newTestCA(t *testing.T, org string) *testCA {
+	t.Helper()
+	certPem, keyPem, err := util.GenCertKeyFromOptions(util.CertOptions{
+		TTL:          time.Hour,
+		Org:          org,
+		IsCA:         true,
+		IsSelfSigned: true,
+		RSAKeySize:   2048,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{certPem: certPem, keyPem: keyPem}
+}
+
+// issue returns the DER encoded workload certificate for the SPIFFE ID.
+func (ca *testCA) issue(t *testing.T, id string) []byte {
+	t.Helper()
+	signer, err := util.ParsePemEncodedCertificate(ca.certPem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := util.ParsePemEncodedKey(ca.keyPem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPem, _, err := util.GenCertKeyFromOptions(util.CertOptions{
+		Host:       id,
+		TTL:        time.Hour,
+		SignerCert: signer,
+		SignerPriv: key,
+		RSAKeySize: 2048,
+		IsServer:   true,
+		IsClient:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(certPem)
+	return block.Bytes
+}
+
+// crl returns the PEM encoded certificate revocation list of the CA, revoking nothing.
+func (ca *testCA) crl(t *testing.T) []byte {
+	t.Helper()
+	signer, err := util.ParsePemEncodedCertificate(ca.certPem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := util.ParsePemEncodedKey(ca.keyPem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now(),
+		NextUpdate: time.Now().Add(time.Hour),
+	}, signer, key.(crypto.Signer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der})
+}
+
+func TestTrustBundleProvider(t *testing.T) {
+	// The mesh and a federated trust domain, each with its own CA.
+	meshCA := newTestCA(t, "cluster.local")
+	federatedCA := newTestCA(t, "example.org")
+	dir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer removeSilent(dir)
+	rootCertFile := filepath.Join(dir, "root-cert.pem")
+	if err := ioutil.WriteFile(rootCertFile, meshCA.certPem, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{}
+	if err := s.setPeerCertVerifier(TLSOptions{CaCertFile: rootCertFile}); err != nil {
+		t.Fatal(err)
+	}
+	bundles, err := spiffe.NewFederatedBundles(time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	federatedCRL := federatedCA.crl(t)
+	bundles.SetSources(crdBundleSources, []spiffe.BundleSource{
+		{TrustDomain: "example.org", Bundle: append(append([]byte(nil), federatedCA.certPem...), federatedCRL...)},
+	})
+	if err := bundles.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	provider := &trustBundleProvider{bundles: bundles, caCertFile: rootCertFile, server: s}
+	provider.updatePeerCertVerifier()
+
+	if got := provider.FederatedTrustDomains(); len(got) != 1 || got[0] != "example.org" {
+		t.Fatalf("unexpected federated trust domains %v", got)
+	}
+	if got := provider.TrustBundle("example.org"); !bytes.Equal(bytes.TrimSpace(got), bytes.TrimSpace(federatedCA.certPem)) {
+		t.Fatalf("unexpected trust bundle %s", got)
+	}
+	if got := string(provider.MeshTrustBundle()); !strings.HasPrefix(got, string(meshCA.certPem)) ||
+		!strings.Contains(got, strings.TrimSpace(string(federatedCA.certPem))) {
+		t.Fatalf("unexpected mesh trust bundle %s", got)
+	}
+
+	// The CRLs of the federated trust domains are only needed once the mesh CA publishes one.
+	if got := provider.MeshCRL(); got != nil {
+		t.Fatalf("expected no mesh CRL without revocations, got %s", got)
+	}
+	meshCRL := meshCA.crl(t)
+	s.crl = meshCRL
+	if got := provider.MeshCRL(); !bytes.Equal(got, append(append([]byte(nil), meshCRL...), federatedCRL...)) {
+		t.Fatalf("unexpected mesh CRL %s", got)
+	}
+
+	// Istiod accepts clients of the mesh and of the federated trust domain, each verified with its own roots.
+	verifier := s.peerCertVerifier
+	if err := verifier.VerifyPeerCert([][]byte{meshCA.issue(t, "spiffe://cluster.local/ns/foo/sa/bar")}, nil); err != nil {
+		t.Fatalf("failed to verify mesh client: %v", err)
+	}
+	if err := verifier.VerifyPeerCert([][]byte{federatedCA.issue(t, "spiffe://example.org/ns/foo/sa/bar")}, nil); err != nil {
+		t.Fatalf("failed to verify federated client: %v", err)
+	}
+	if err := verifier.VerifyPeerCert([][]byte{federatedCA.issue(t, "spiffe://cluster.local/ns/foo/sa/bar")}, nil); err == nil {
+		t.Fatalf("expected federated CA not to be trusted for the mesh")
+	}
+
+	// Clients of a trust domain that is no longer federated are rejected.
+	bundles.SetSources(crdBundleSources, nil)
+	provider.updatePeerCertVerifier()
+	if err := verifier.VerifyPeerCert([][]byte{federatedCA.issue(t, "spiffe://example.org/ns/foo/sa/bar")}, nil); err == nil ||
+		!strings.Contains(err.Error(), "no cert pool found for trust domain example.org") {
+		t.Fatalf("expected federated client to be rejected, got %v", err)
+	}
+}
@@ -139,6 +139,37 @@ var (
 	audience = env.RegisterStringVar("AUDIENCE", "",
 		"Expected audience in the tokens. ")
 
+	awsInstanceIdentityCerts = env.RegisterStringVar("AWS_INSTANCE_IDENTITY_CERTS", "",
+		"File holding the PEM encoded AWS public certificates of the regions whose EC2 instance identity "+
+			"documents are trusted. If set, VMs using the AWS credential fetcher are authenticated. The instances "+
+			"are bound to the nonce of their agent in the istio-aws-instances configmap, to detect replayed documents.")
+
+	awsIdentityMapping = env.RegisterStringVar("AWS_IDENTITY_MAPPING", "",
+		"Comma separated list of account=namespace/serviceaccount or account/instance=namespace/serviceaccount "+
+			"entries, mapping the EC2 instances to their workload identity.")
+
+	azureTenantID = env.RegisterStringVar("AZURE_TENANT_ID", "",
+		"Azure tenant issuing the managed identity tokens. If set, VMs using the Azure credential fetcher "+
+			"are authenticated.")
+
+	azureTokenAudience = env.RegisterStringVar("AZURE_TOKEN_AUDIENCE", "",
+		"Expected audience of the Azure managed identity tokens. Defaults to the trust domain.")
+
+	azureIdentityMapping = env.RegisterStringVar("AZURE_IDENTITY_MAPPING", "",
+		"Comma separated list of objectID=namespace/serviceaccount entries, mapping the Azure managed "+
+			"identities to their workload identity.")
+
+	platformOIDCIssuer = env.RegisterStringVar("PLATFORM_OIDC_ISSUER", "",
+		"OIDC issuer of the tokens sent by the OIDC credential fetcher. If set, VMs using the OIDC "+
+			"credential fetcher are authenticated.")
+
+	platformOIDCAudience = env.RegisterStringVar("PLATFORM_OIDC_AUDIENCE", "",
+		"Expected audience of the tokens sent by the OIDC credential fetcher.")
+
+	platformOIDCIdentityMapping = env.RegisterStringVar("PLATFORM_OIDC_IDENTITY_MAPPING", "",
+		"Comma separated list of subject=namespace/serviceaccount entries, mapping the subjects of the "+
+			"OIDC tokens to their workload identity.")
+
 	caRSAKeySize = env.RegisterIntVar("CITADEL_SELF_SIGNED_CA_RSA_KEY_SIZE", 2048,
 		"Specify the RSA key size to use for self-signed Istio CA certificates.")
 
@@ -229,11 +260,80 @@ func (s *Server) RunCA(grpc *grpc.Server, ca caserver.CertificateAuthority, opts
 		}
 	}
 
+	var configMaps corev1.ConfigMapsGetter
+	if s.kubeClient != nil {
+		configMaps = s.kubeClient.Kube().CoreV1()
+	}
+	for _, auth := range platformAuthenticators(opts.TrustDomain, configMaps, opts.Namespace) {
+		caServer.Authenticators = append(caServer.Authenticators, auth)
+		log.Infof("Using %s authentication", auth.AuthenticatorType())
+	}
+
 	caServer.Register(grpc)
 
 	log.Info("Istiod CA has started")
 }
 
+// platformAuthenticators returns the configured authenticators of the credentials sent by the
+// AWS, Azure and OIDC credential fetchers of VM workloads. Misconfigured authenticators are skipped.
+// The state shared by the istiod replicas is stored in ConfigMaps of the namespace.
+func platformAuthenticators(trustDomain string, configMaps corev1.ConfigMapsGetter, namespace string) []authenticate.Authenticator {
+	var auths []authenticate.Authenticator
+	if certsFile := awsInstanceIdentityCerts.Get(); certsFile != "" {
+		auth, err := newAWSAuthenticator(certsFile, trustDomain, configMaps, namespace)
+		if err != nil {
+			log.Errorf("Failed to create the AWS authenticator: %v", err)
+		} else {
+			auths = append(auths, auth)
+		}
+	}
+	if tenant := azureTenantID.Get(); tenant != "" {
+		aud := azureTokenAudience.Get()
+		if aud == "" {
+			aud = trustDomain
+		}
+		mapping, err := authenticate.ParseIdentityMapping(azureIdentityMapping.Get())
+		if err == nil {
+			var auth *authenticate.PlatformJwtAuthenticator
+			auth, err = authenticate.NewAzureAuthenticator(fmt.Sprintf("https://sts.windows.net/%s/", tenant),
+				aud, trustDomain, mapping)
+			if err == nil {
+				auths = append(auths, auth)
+			}
+		}
+		if err != nil {
+			log.Errorf("Failed to create the Azure authenticator: %v", err)
+		}
+	}
+	if iss := platformOIDCIssuer.Get(); iss != "" {
+		mapping, err := authenticate.ParseIdentityMapping(platformOIDCIdentityMapping.Get())
+		if err == nil {
+			var auth *authenticate.PlatformJwtAuthenticator
+			auth, err = authenticate.NewOIDCAuthenticator(iss, platformOIDCAudience.Get(), trustDomain, mapping)
+			if err == nil {
+				auths = append(auths, auth)
+			}
+		}
+		if err != nil {
+			log.Errorf("Failed to create the OIDC authenticator: %v", err)
+		}
+	}
+	return auths
+}
+
+func newAWSAuthenticator(certsFile, trustDomain string, configMaps corev1.ConfigMapsGetter,
+	namespace string) (*authenticate.AWSAuthenticator, error) {
+	certs, err := ioutil.ReadFile(certsFile)
+	if err != nil {
+		return nil, err
+	}
+	mapping, err := authenticate.ParseIdentityMapping(awsIdentityMapping.Get())
+	if err != nil {
+		return nil, err
+	}
+	return authenticate.NewAWSAuthenticator(certs, trustDomain, mapping, configMaps, namespace)
+}
+
 // detectAuthEnv will use the JWT token that is mounted in istiod to set the default audience
 // and trust domain for Istiod, if not explicitly defined.
 // K8S will use the same kind of tokens for the pods, and the value in istiod's own token is
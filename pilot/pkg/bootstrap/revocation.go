@@ -0,0 +1,104 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstrap
+
+import (
+	"bytes"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/kube/configmapwatcher"
+	"istio.io/istio/security/pkg/pki/ca"
+	"istio.io/pkg/log"
+)
+
+// crlRefreshInterval is how often the certificate revocation list is checked for renewal, and
+// identity revocations are resolved against newly issued certificates.
+const crlRefreshInterval = time.Hour
+
+// initCARevocation keeps the revocation list of the CA in sync with the revocation configmap,
+// and maintains the certificate revocation list published with the root cert.
+func (s *Server) initCARevocation(args *PilotArgs) {
+	if s.CA == nil || s.kubeClient == nil {
+		return
+	}
+	if err := s.CA.CheckCRLSigner(); err != nil {
+		// Revocations are still tracked, so that they are published once the CA certificate is rotated.
+		log.Errorf("certificate revocation lists cannot be published, revoked certificates are not rejected by proxies: %v", err)
+	}
+	s.crlUpdated = make(chan struct{}, 1)
+	watcher := configmapwatcher.NewController(s.kubeClient, args.Namespace, ca.RevocationConfigMap, func(cm *v1.ConfigMap) {
+		revocations, err := ca.ParseRevocations(cm)
+		if err != nil {
+			log.Errorf("failed to load CA revocations: %v", err)
+			return
+		}
+		s.CA.SetRevocations(revocations)
+		s.syncRevocations(args.Namespace)
+	})
+	s.addStartFunc(func(stop <-chan struct{}) error {
+		go watcher.Run(stop)
+		go func() {
+			ticker := time.NewTicker(crlRefreshInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-stop:
+					return
+				case <-ticker.C:
+					s.syncRevocations(args.Namespace)
+				}
+			}
+		}()
+		return nil
+	})
+}
+
+// syncRevocations records the serial numbers of the certificates this istiod issued to revoked
+// identities in the revocation configmap, so that the CRL published by the leader covers
+// certificates issued by every replica, and refreshes the CRL.
+func (s *Server) syncRevocations(namespace string) {
+	if resolved := s.CA.ResolveRevocations(); len(resolved) > 0 {
+		if _, err := ca.AddRevocations(s.kubeClient.CoreV1(), namespace, resolved); err != nil {
+			log.Errorf("failed to record revoked certificates: %v", err)
+		}
+	}
+
+	crl, err := s.CA.CRL()
+	if err != nil {
+		log.Errorf("failed to generate certificate revocation list: %v", err)
+		return
+	}
+	s.crlMu.Lock()
+	changed := !bytes.Equal(s.crl, crl)
+	s.crl = crl
+	s.crlMu.Unlock()
+	if changed {
+		log.Infof("certificate revocation list updated")
+		select {
+		case s.crlUpdated <- struct{}{}:
+		default:
+		}
+		if s.environment.TrustBundles != nil {
+			// The mesh trust bundle served to proxies carries the CRL as well.
+			s.XDSServer.ConfigUpdate(&model.PushRequest{
+				Full:   true,
+				Reason: []model.TriggerReason{model.TrustBundleTrigger},
+			})
+		}
+	}
+}
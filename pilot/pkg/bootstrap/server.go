@@ -65,7 +65,11 @@ import (
 	istiokeepalive "istio.io/istio/pkg/keepalive"
 	kubelib "istio.io/istio/pkg/kube"
 	"istio.io/istio/pkg/kube/inject"
+	"istio.io/istio/pkg/servicemesh/apis/servicemesh/v1alpha1"
+	v1alpha1client "istio.io/istio/pkg/servicemesh/client/v1alpha1/clientset/versioned/typed/servicemesh/v1alpha1"
 	"istio.io/istio/pkg/servicemesh/controller/extension"
+	maistraextension "istio.io/istio/pkg/servicemesh/extension"
+	maistramodel "istio.io/istio/pkg/servicemesh/model"
 	"istio.io/istio/pkg/spiffe"
 	"istio.io/istio/security/pkg/k8s/chiron"
 	"istio.io/istio/security/pkg/pki/ca"
@@ -168,6 +172,11 @@ type Server struct {
 	istiodCert   *tls.Certificate
 	jwtPath      string
 
+	// crl is the certificate revocation list of the CA, published along with its root cert.
+	crl        []byte
+	crlMu      sync.RWMutex
+	crlUpdated chan struct{}
+
 	// startFuncs keeps track of functions that need to be executed when Istiod starts.
 	startFuncs []startFunc
 	// requiredTerminations keeps track of components that should block server exit
@@ -278,6 +287,9 @@ func NewServer(args *PilotArgs) (*Server, error) {
 	if err := s.setPeerCertVerifier(args.ServerOptions.TLSOptions); err != nil {
 		return nil, err
 	}
+	if err := s.initFederatedTrustBundles(args); err != nil {
+		return nil, fmt.Errorf("error initializing federated trust bundles: %v", err)
+	}
 
 	// Secure gRPC Server must be initialized after CA is created as may use a Citadel generated cert.
 	if err := s.initSecureDiscoveryService(args); err != nil {
@@ -334,6 +346,7 @@ func NewServer(args *PilotArgs) (*Server, error) {
 	// Start CA or RA server. This should be called after CA and Istiod certs have been created.
 	s.startCA(caOpts)
 
+	s.initCARevocation(args)
 	s.initNamespaceController(args)
 
 	// TODO: don't run this if galley is started, one ctlz is enough
@@ -466,6 +479,10 @@ func (s *Server) initSDSServer(args *PilotArgs) {
 			s.XDSServer.Generators[v3.SecretType] = xds.NewSecretGen(sc, s.XDSServer.Cache)
 		}
 	}
+	if features.EnableFederatedTrustBundles && s.XDSServer.Generators[v3.SecretType] == nil {
+		// Serve the trust bundles of federated trust domains, without credentials.
+		s.XDSServer.Generators[v3.SecretType] = xds.NewSecretGen(nil, s.XDSServer.Cache)
+	}
 }
 
 // initKubeClient creates the k8s client if running in an k8s environment.
@@ -555,6 +572,52 @@ func (s *Server) initExtensionController(args *PilotArgs) error {
 		if err != nil {
 			return multierror.Prefix(err, "Could not create ExtensionController.")
 		}
+		client, err := v1alpha1client.NewForConfig(s.kubeClient.RESTConfig())
+		if err != nil {
+			return multierror.Prefix(err, "Could not create ServiceMeshExtension client.")
+		}
+		rolloutMonitor := maistraextension.NewRolloutMonitor(client)
+		s.XDSServer.ExtensionHealth = rolloutMonitor
+		orderingReporter := maistraextension.NewOrderingReporter(client)
+		s.addStartFunc(func(stop <-chan struct{}) error {
+			// every replica counts the failures of the proxies connected to it
+			go rolloutMonitor.Run(stop)
+			return nil
+		})
+		s.addTerminatingStartFunc(func(stop <-chan struct{}) error {
+			leaderelection.
+				NewLeaderElection(args.Namespace, args.PodName, leaderelection.ExtensionStatusController, s.kubeClient).
+				AddRunFunction(func(leaderStop <-chan struct{}) {
+					log.Infof("Starting extension status writers")
+					orderingReporter.SetStatusWrite(true)
+					go orderingReporter.Report(ec.GetExtensions())
+					<-leaderStop
+					orderingReporter.SetStatusWrite(false)
+					log.Infof("Stopping extension status writers")
+				}).Run(stop)
+			return nil
+		})
+		extensionsChanged := func() {
+			s.extensionsChanged()
+			go orderingReporter.Report(ec.GetExtensions())
+		}
+		ec.RegisterEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) { extensionsChanged() },
+			UpdateFunc: func(old, cur interface{}) {
+				// skip resyncs and updates of informational status
+				oldExtension, curExtension := old.(*v1alpha1.ServiceMeshExtension), cur.(*v1alpha1.ServiceMeshExtension)
+				if !maistramodel.ConfigChanged(oldExtension, curExtension) {
+					return
+				}
+				// over ECDS, a new module or configuration does not require new listeners
+				if features.EnableMaistraExtensionECDS && !maistramodel.FilterChainChanged(oldExtension, curExtension) {
+					s.extensionConfigChanged(curExtension)
+				} else {
+					extensionsChanged()
+				}
+			},
+			DeleteFunc: func(obj interface{}) { extensionsChanged() },
+		})
 		s.environment.ExtensionStore = ec
 		s.environment.ExtensionStore.Start(make(chan struct{}))
 	}
@@ -562,6 +625,29 @@ func (s *Server) initExtensionController(args *PilotArgs) error {
 	return nil
 }
 
+// extensionsChanged pushes the new set of extensions, including the state of
+// their rollouts, to all proxies
+func (s *Server) extensionsChanged() {
+	s.XDSServer.ConfigUpdate(&model.PushRequest{
+		Full:   true,
+		Reason: []model.TriggerReason{model.ConfigUpdate},
+	})
+}
+
+// extensionConfigChanged pushes the new filter configuration of an extension
+// to all proxies over ECDS
+func (s *Server) extensionConfigChanged(extension *v1alpha1.ServiceMeshExtension) {
+	s.XDSServer.ConfigUpdate(&model.PushRequest{
+		Full: true,
+		ConfigsUpdated: map[model.ConfigKey]struct{}{{
+			Kind:      maistramodel.ServiceMeshExtensionKind,
+			Name:      extension.Name,
+			Namespace: extension.Namespace,
+		}: {}},
+		Reason: []model.TriggerReason{model.ConfigUpdate},
+	})
+}
+
 // initIstiodAdminServer initializes monitoring, debug and readiness end points.
 func (s *Server) initIstiodAdminServer(args *PilotArgs, wh *inject.Webhook) error {
 	s.httpServer = &http.Server{
@@ -723,6 +809,12 @@ func (s *Server) initSecureDiscoveryService(args *PilotArgs) error {
 			return err
 		},
 	}
+	// The root certificates of federated trust domains are updated while istiod is running.
+	cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		c := cfg.Clone()
+		c.ClientCAs = s.peerCertVerifier.GetGeneralCertPool()
+		return c, nil
+	}
 
 	tlsCreds := credentials.NewTLS(cfg)
 
@@ -1020,7 +1112,7 @@ func (s *Server) getCertKeyPaths(tlsOptions TLSOptions) (string, string) {
 
 // setPeerCertVerifier sets up a SPIFFE certificate verifier with the current istiod configuration.
 func (s *Server) setPeerCertVerifier(tlsOptions TLSOptions) error {
-	if tlsOptions.CaCertFile == "" && s.CA == nil && features.SpiffeBundleEndpoints == "" {
+	if tlsOptions.CaCertFile == "" && s.CA == nil && features.SpiffeBundleEndpoints == "" && features.SpiffeBundleFiles == "" {
 		// Running locally without configured certs - no TLS mode
 		return nil
 	}
@@ -1032,12 +1124,7 @@ func (s *Server) setPeerCertVerifier(tlsOptions TLSOptions) error {
 			return err
 		}
 	} else {
-		if s.RA != nil {
-			rootCertBytes = append(rootCertBytes, s.RA.GetCAKeyCertBundle().GetRootCertPem()...)
-		}
-		if s.CA != nil {
-			rootCertBytes = append(rootCertBytes, s.CA.GetCAKeyCertBundle().GetRootCertPem()...)
-		}
+		rootCertBytes = s.meshRootCerts("")
 	}
 
 	if len(rootCertBytes) != 0 {
@@ -1048,15 +1135,7 @@ func (s *Server) setPeerCertVerifier(tlsOptions TLSOptions) error {
 		}
 	}
 
-	if features.SpiffeBundleEndpoints != "" {
-		certMap, err := spiffe.RetrieveSpiffeBundleRootCertsFromStringInput(
-			features.SpiffeBundleEndpoints, []*x509.Certificate{})
-		if err != nil {
-			return err
-		}
-		s.peerCertVerifier.AddMappings(certMap)
-	}
-
+	// The trust bundles of federated trust domains are added by initFederatedTrustBundles.
 	return nil
 }
 
@@ -1105,6 +1184,16 @@ func (s *Server) initNamespaceController(args *PilotArgs) {
 					// recreate it again.
 					s.kubeClient.RunAndWait(stop)
 					nc.Run(leaderStop)
+					go func() {
+						for {
+							select {
+							case <-leaderStop:
+								return
+							case <-s.crlUpdated:
+								nc.Resync()
+							}
+						}
+					}()
 				}).
 				Run(stop)
 			return nil
@@ -1184,8 +1273,11 @@ func (s *Server) startCA(caOpts *caOptions) {
 }
 
 func (s *Server) fetchCARoot() map[string]string {
+	s.crlMu.RLock()
+	defer s.crlMu.RUnlock()
 	return map[string]string{
 		constants.CACertNamespaceConfigMapDataName: string(s.CA.GetCAKeyCertBundle().GetRootCertPem()),
+		constants.CACRLNamespaceConfigMapDataName:  string(s.crl),
 	}
 }
 
@@ -28,6 +28,8 @@ import (
 	"fmt"
 	"time"
 
+	xnsinformers "github.com/maistra/xns-informer/pkg/informers"
+	"go.uber.org/atomic"
 	"gomodules.xyz/jsonpatch/v2"
 	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
 	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
@@ -83,13 +85,17 @@ type Client struct {
 
 	// The service-apis client we will use to access objects
 	serviceApisClient serviceapisclient.Interface
+
+	// initialSync is set once the informers synced for the first time. Informers of namespaces that are
+	// added to the member roll later start unsynced, which must not hold back the events of other namespaces.
+	initialSync *atomic.Bool
 }
 
 var _ model.ConfigStoreCache = &Client{}
 
 // Validate we are ready to handle events. Until the informers are synced, we will block the queue
 func (cl *Client) checkReadyForEvents(curr interface{}) error {
-	if !cl.HasSynced() {
+	if !cl.initialSync.Load() && !cl.HasSynced() {
 		return errors.New("waiting till full synchronization")
 	}
 	_, err := cache.DeletionHandlingMetaNamespaceKeyFunc(curr)
@@ -130,6 +136,7 @@ func (cl *Client) HasSynced() bool {
 			return false
 		}
 	}
+	cl.initialSync.Store(true)
 	return true
 }
 
@@ -146,6 +153,7 @@ func New(client kube.Client, revision string, options controller2.Options) (mode
 		kinds:             map[config.GroupVersionKind]*cacheHandler{},
 		istioClient:       client.Istio(),
 		serviceApisClient: client.ServiceApis(),
+		initialSync:       atomic.NewBool(false),
 	}
 	var known map[string]struct{}
 	if options.EnableCRDScan {
@@ -172,10 +180,35 @@ func New(client kube.Client, revision string, options controller2.Options) (mode
 			scope.Warnf("Skipping CRD %v as it is not present", s.Resource().GroupVersionKind())
 		}
 	}
+	client.AddNamespaceHandler(xnsinformers.NamespaceSetHandlerFuncs{
+		RemoveFunc: out.onNamespaceRemoved,
+	})
 
 	return out, nil
 }
 
+// onNamespaceRemoved emits delete events for the configs in a namespace that is no longer watched.
+// It is called before the informers of the namespace are stopped, while the configs are still in the caches.
+func (cl *Client) onNamespaceRemoved(namespace string) {
+	for _, h := range cl.kinds {
+		if h.schema.Resource().IsClusterScoped() {
+			continue
+		}
+		h := h
+		objs, err := h.lister(namespace).List(klabels.Everything())
+		if err != nil {
+			scope.Errorf("error listing %v in removed namespace %q: %v", h.schema.Resource().Kind(), namespace, err)
+			continue
+		}
+		for _, obj := range objs {
+			obj := obj
+			cl.queue.Push(func() error {
+				return h.onEvent(nil, obj, model.EventDelete)
+			})
+		}
+	}
+}
+
 // Schemas for the store
 func (cl *Client) Schemas() collection.Schemas {
 	return cl.schemas
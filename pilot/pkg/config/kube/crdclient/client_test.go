@@ -284,3 +284,55 @@ func TestClient(t *testing.T) {
 	})
 
 }
+
+// Ensure that delete events are sent for the configs of namespaces that are no longer watched
+func TestClientNamespaceRemoved(t *testing.T) {
+	r := collections.IstioNetworkingV1Alpha3Virtualservices.Resource()
+	fake := kube.NewFakeClient()
+	store, err := New(fake, "", controller.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := make(chan model.Event, 10)
+	store.RegisterEventHandler(r.GroupVersionKind(), func(_ config.Config, _ config.Config, e model.Event) {
+		events <- e
+	})
+	stop := make(chan struct{})
+	defer close(stop)
+	go store.Run(stop)
+	fake.RunAndWait(stop)
+	cache.WaitForCacheSync(stop, store.HasSynced)
+
+	pb, err := r.NewInstance()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Create(config.Config{
+		Meta: config.Meta{
+			GroupVersionKind: r.GroupVersionKind(),
+			Name:             "name",
+			Namespace:        "ns",
+		},
+		Spec: pb,
+	}); err != nil {
+		t.Fatalf("Create => got %v", err)
+	}
+	expectEvent := func(expected model.Event) {
+		t.Helper()
+		select {
+		case e := <-events:
+			if e != expected {
+				t.Fatalf("expected %v event, got %v", expected, e)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %v event", expected)
+		}
+	}
+	expectEvent(model.EventAdd)
+
+	fake.SetNamespaces("other")
+	expectEvent(model.EventDelete)
+	if cfg := store.Get(r.GroupVersionKind(), "name", "ns"); cfg != nil {
+		t.Fatalf("expected config of removed namespace to be gone, got %v", cfg)
+	}
+}
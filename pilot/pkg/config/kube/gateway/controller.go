@@ -35,17 +35,33 @@ var (
 	errUnsupportedType = fmt.Errorf("unsupported type: this operation only supports gateway, destination rule, and virtual service resource type")
 )
 
-type controller struct {
+// Controller is a read-only view of the service-apis resources, converted to Istio resources.
+// It also writes the status of the service-apis resources it handles, when enabled.
+type Controller struct {
 	client kubernetes.Interface
 	cache  model.ConfigStoreCache
 	domain string
+	status *statusWriter
 }
 
-func NewController(client kubernetes.Interface, c model.ConfigStoreCache, options controller2.Options) model.ConfigStoreCache {
-	return &controller{client, c, options.DomainSuffix}
+var _ model.ConfigStoreCache = &Controller{}
+
+func NewController(client kubernetes.Interface, c model.ConfigStoreCache, options controller2.Options) *Controller {
+	return &Controller{
+		client: client,
+		cache:  c,
+		domain: options.DomainSuffix,
+		status: newStatusWriter(c),
+	}
+}
+
+// SetStatusWrite enables or disables the status writes. Only one instance, the leader, should write
+// the status.
+func (c *Controller) SetStatusWrite(enabled bool) {
+	c.status.SetEnabled(enabled)
 }
 
-func (c *controller) Schemas() collection.Schemas {
+func (c *Controller) Schemas() collection.Schemas {
 	return collection.SchemasFor(
 		collections.IstioNetworkingV1Alpha3Virtualservices,
 		collections.IstioNetworkingV1Alpha3Gateways,
@@ -53,11 +69,11 @@ func (c *controller) Schemas() collection.Schemas {
 	)
 }
 
-func (c controller) Get(typ config.GroupVersionKind, name, namespace string) *config.Config {
+func (c Controller) Get(typ config.GroupVersionKind, name, namespace string) *config.Config {
 	panic("get is not supported")
 }
 
-func (c controller) List(typ config.GroupVersionKind, namespace string) ([]config.Config, error) {
+func (c Controller) List(typ config.GroupVersionKind, namespace string) ([]config.Config, error) {
 	if typ != gvk.Gateway && typ != gvk.VirtualService && typ != gvk.DestinationRule {
 		return nil, errUnsupportedType
 	}
@@ -111,7 +127,8 @@ func (c controller) List(typ config.GroupVersionKind, namespace string) ([]confi
 		namespaces[ns.Name] = &nsl.Items[i]
 	}
 	input.Namespaces = namespaces
-	output := convertResources(input)
+	output, report := convertResources(input)
+	c.status.Enqueue(report)
 
 	switch typ {
 	case gvk.Gateway:
@@ -133,35 +150,36 @@ func anyApisUsed(input *KubernetesResources) bool {
 		len(input.BackendPolicy) > 0
 }
 
-func (c controller) Create(config config.Config) (revision string, err error) {
+func (c Controller) Create(config config.Config) (revision string, err error) {
 	return "", errUnsupportedOp
 }
 
-func (c controller) Update(config config.Config) (newRevision string, err error) {
+func (c Controller) Update(config config.Config) (newRevision string, err error) {
 	return "", errUnsupportedOp
 }
 
-func (c controller) UpdateStatus(config config.Config) (newRevision string, err error) {
+func (c Controller) UpdateStatus(config config.Config) (newRevision string, err error) {
 	return "", errUnsupportedOp
 }
 
-func (c controller) Patch(typ config.GroupVersionKind, name, namespace string, patchFn config.PatchFunc) (string, error) {
+func (c Controller) Patch(typ config.GroupVersionKind, name, namespace string, patchFn config.PatchFunc) (string, error) {
 	return "", errUnsupportedOp
 }
 
-func (c controller) Delete(typ config.GroupVersionKind, name, namespace string) error {
+func (c Controller) Delete(typ config.GroupVersionKind, name, namespace string) error {
 	return errUnsupportedOp
 }
 
-func (c controller) RegisterEventHandler(typ config.GroupVersionKind, handler func(config.Config, config.Config, model.Event)) {
+func (c Controller) RegisterEventHandler(typ config.GroupVersionKind, handler func(config.Config, config.Config, model.Event)) {
 	c.cache.RegisterEventHandler(typ, func(prev, cur config.Config, event model.Event) {
 		handler(prev, cur, event)
 	})
 }
 
-func (c controller) Run(stop <-chan struct{}) {
+func (c Controller) Run(stop <-chan struct{}) {
+	c.status.Run(stop)
 }
 
-func (c controller) HasSynced() bool {
+func (c Controller) HasSynced() bool {
 	return c.cache.HasSynced()
 }
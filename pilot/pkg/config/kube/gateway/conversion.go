@@ -51,8 +51,8 @@ type KubernetesResources struct {
 	Domain string
 }
 
-func isRouteMatch(cfg config.Config, res resource.Schema, gatewayNamespace string,
-	routes k8s.RouteBindingSelector, namespaces map[string]*corev1.Namespace) bool {
+// isRouteSelected returns true if a route is of the kind and has the labels a listener selects.
+func isRouteSelected(cfg config.Config, res resource.Schema, routes k8s.RouteBindingSelector) bool {
 	if routes.Kind != res.Kind() {
 		return false
 	}
@@ -64,10 +64,12 @@ func isRouteMatch(cfg config.Config, res resource.Schema, gatewayNamespace strin
 		log.Errorf("failed to create route selector: %v", err)
 		return false
 	}
-	if !ls.Matches(klabels.Set(cfg.Labels)) {
-		return false
-	}
+	return ls.Matches(klabels.Set(cfg.Labels))
+}
 
+// isNamespaceAllowed returns true if a listener allows the routes of the namespace of a route.
+func isNamespaceAllowed(cfg config.Config, gatewayNamespace string,
+	routes k8s.RouteBindingSelector, namespaces map[string]*corev1.Namespace) bool {
 	if routes.Namespaces == nil {
 		// "This is restricted to the namespace of this Gateway by default"
 		return gatewayNamespace == cfg.Namespace
@@ -96,31 +98,67 @@ func isRouteMatch(cfg config.Config, res resource.Schema, gatewayNamespace strin
 	return true
 }
 
-func (r *KubernetesResources) fetchHTTPRoutes(gatewayNamespace string, routes k8s.RouteBindingSelector) []config.Config {
-	result := []config.Config{}
-	for _, http := range r.HTTPRoute {
-		if isRouteMatch(http, collections.K8SServiceApisV1Alpha1Httproutes.Resource(), gatewayNamespace, routes, r.Namespaces) {
-			result = append(result, http)
-		}
+// routeGateways returns the gateways a route allows to use it.
+func routeGateways(cfg config.Config) k8s.RouteGateways {
+	switch spec := cfg.Spec.(type) {
+	case *k8s.HTTPRouteSpec:
+		return spec.Gateways
+	case *k8s.TCPRouteSpec:
+		return spec.Gateways
+	case *k8s.TLSRouteSpec:
+		return spec.Gateways
 	}
-	return result
+	return k8s.RouteGateways{}
 }
 
-func (r *KubernetesResources) fetchTCPRoutes(gatewayNamespace string, routes k8s.RouteBindingSelector) []config.Config {
-	result := []config.Config{}
-	for _, http := range r.TCPRoute {
-		if isRouteMatch(http, collections.K8SServiceApisV1Alpha1Tcproutes.Resource(), gatewayNamespace, routes, r.Namespaces) {
-			result = append(result, http)
+// isGatewayAllowed returns true if a route allows a gateway to use it.
+func isGatewayAllowed(cfg config.Config, gateway k8s.GatewayReference) bool {
+	allowed := routeGateways(cfg)
+	switch allowed.Allow {
+	case k8s.GatewayAllowAll:
+		return true
+	case k8s.GatewayAllowFromList:
+		for _, ref := range allowed.GatewayRefs {
+			if ref == gateway {
+				return true
+			}
 		}
+		return false
+	default:
+		// SameNamespace is the default
+		return gateway.Namespace == cfg.Namespace
 	}
-	return result
 }
 
-func (r *KubernetesResources) fetchTLSRoutes(gatewayNamespace string, routes k8s.RouteBindingSelector) []config.Config {
+// bindRoutes returns the routes a listener of a gateway binds to, which are the routes the listener
+// selects that allow the gateway to use them. Whether the selected routes are admitted is reported.
+func (r *KubernetesResources) bindRoutes(gw config.Config, routes k8s.RouteBindingSelector, rep *reporter) []config.Config {
+	ref := k8s.GatewayReference{Name: gw.Name, Namespace: gw.Namespace}
 	result := []config.Config{}
-	for _, http := range r.TLSRoute {
-		if isRouteMatch(http, collections.K8SServiceApisV1Alpha1Tlsroutes.Resource(), gatewayNamespace, routes, r.Namespaces) {
-			result = append(result, http)
+	for _, kind := range []struct {
+		schema resource.Schema
+		routes []config.Config
+	}{
+		{collections.K8SServiceApisV1Alpha1Httproutes.Resource(), r.HTTPRoute},
+		{collections.K8SServiceApisV1Alpha1Tcproutes.Resource(), r.TCPRoute},
+		{collections.K8SServiceApisV1Alpha1Tlsroutes.Resource(), r.TLSRoute},
+	} {
+		for _, route := range kind.routes {
+			if !isRouteSelected(route, kind.schema, routes) {
+				continue
+			}
+			k := toRouteKey(route)
+			if !isNamespaceAllowed(route, gw.Namespace, routes, r.Namespaces) {
+				rep.bindRoute(k, ref, false, reasonNotAllowedByListeners,
+					fmt.Sprintf("the listeners of the gateway do not allow routes from namespace %s", route.Namespace))
+				continue
+			}
+			if !isGatewayAllowed(route, ref) {
+				rep.bindRoute(k, ref, false, reasonNotAllowedByRoute, "the route does not allow the gateway to use it")
+				continue
+			}
+			rep.bindRoute(k, ref, true, reasonAdmitted, "")
+			result = append(result, route)
 		}
 	}
 	return result
@@ -134,13 +172,16 @@ type IstioResources struct {
 
 var _ = k8s.HTTPRoute{}
 
-func convertResources(r *KubernetesResources) IstioResources {
+// convertResources converts the service-apis resources into Istio resources, and reports the status
+// of the service-apis resources.
+func convertResources(r *KubernetesResources) (IstioResources, *StatusReport) {
 	result := IstioResources{}
-	gw, routeMap := convertGateway(r)
+	rep := newReporter()
+	gw, routeMap := convertGateway(r, rep)
 	result.Gateway = gw
-	result.VirtualService = convertVirtualService(r, routeMap)
+	result.VirtualService = convertVirtualService(r, routeMap, rep)
 	result.DestinationRule = convertDestinationRule(r)
-	return result
+	return result, rep.report(r)
 }
 
 // Unique key to identify a route
@@ -206,7 +247,7 @@ func convertDestinationRule(r *KubernetesResources) []config.Config {
 	return result
 }
 
-func convertVirtualService(r *KubernetesResources, routeMap map[RouteKey][]string) []config.Config {
+func convertVirtualService(r *KubernetesResources, routeMap map[RouteKey][]string, rep *reporter) []config.Config {
 	result := []config.Config{}
 	for _, obj := range r.TCPRoute {
 		gateways, f := routeMap[toRouteKey(obj)]
@@ -215,7 +256,7 @@ func convertVirtualService(r *KubernetesResources, routeMap map[RouteKey][]strin
 			continue
 		}
 
-		vsConfig := buildTCPVirtualService(obj, gateways, r.Domain)
+		vsConfig := buildTCPVirtualService(obj, gateways, r.Domain, rep.refErrors(toRouteKey(obj)))
 		result = append(result, vsConfig)
 	}
 
@@ -226,7 +267,7 @@ func convertVirtualService(r *KubernetesResources, routeMap map[RouteKey][]strin
 			continue
 		}
 
-		vsConfig := buildTLSVirtualService(obj, gateways, r.Domain)
+		vsConfig := buildTLSVirtualService(obj, gateways, r.Domain, rep.refErrors(toRouteKey(obj)))
 		result = append(result, vsConfig)
 	}
 
@@ -237,12 +278,12 @@ func convertVirtualService(r *KubernetesResources, routeMap map[RouteKey][]strin
 			continue
 		}
 
-		result = append(result, buildHTTPVirtualServices(obj, gateways, r.Domain)...)
+		result = append(result, buildHTTPVirtualServices(obj, gateways, r.Domain, rep.refErrors(toRouteKey(obj)))...)
 	}
 	return result
 }
 
-func buildHTTPVirtualServices(obj config.Config, gateways []string, domain string) []config.Config {
+func buildHTTPVirtualServices(obj config.Config, gateways []string, domain string, errs *refErrors) []config.Config {
 	result := []config.Config{}
 
 	route := obj.Spec.(*k8s.HTTPRouteSpec)
@@ -252,7 +293,7 @@ func buildHTTPVirtualServices(obj config.Config, gateways []string, domain strin
 	httproutes := []*istio.HTTPRoute{}
 	hosts := hostnameToStringList(route.Hostnames)
 	for _, r := range route.Rules {
-		// TODO: implement redirect, rewrite, timeout, mirror, corspolicy, retries
+		// TODO: implement timeout, corspolicy, retries
 		vs := &istio.HTTPRoute{}
 		for _, match := range r.Matches {
 			vs.Match = append(vs.Match, &istio.HTTPMatchRequest{
@@ -260,16 +301,19 @@ func buildHTTPVirtualServices(obj config.Config, gateways []string, domain strin
 				Headers: createHeadersMatch(match),
 			})
 		}
+		// Other filters, such as ExtensionRef, are ignored and reported in the route status
 		for _, filter := range r.Filters {
 			switch filter.Type {
 			case k8s.HTTPRouteFilterRequestHeaderModifier:
 				vs.Headers = createHeadersFilter(filter.RequestHeaderModifier)
+			case k8s.HTTPRouteFilterRequestMirror:
+				vs.Mirror = createMirrorFilter(filter.RequestMirror, obj.Namespace, errs)
 			default:
-				log.Warnf("unsupported filter type %q", filter.Type)
+				errs.unsupportedFilter(filter, "route")
 			}
 		}
 
-		vs.Route = buildHTTPDestination(r.ForwardTo, obj.Namespace)
+		vs.Route = buildHTTPDestination(r.ForwardTo, obj.Namespace, errs)
 		httproutes = append(httproutes, vs)
 	}
 	vsConfig := config.Config{
@@ -298,13 +342,13 @@ func hostnameToStringList(h []k8s.Hostname) []string {
 	return res
 }
 
-func buildTCPVirtualService(obj config.Config, gateways []string, domain string) config.Config {
+func buildTCPVirtualService(obj config.Config, gateways []string, domain string, errs *refErrors) config.Config {
 	route := obj.Spec.(*k8s.TCPRouteSpec)
 	routes := []*istio.TCPRoute{}
 	for _, r := range route.Rules {
 		ir := &istio.TCPRoute{
 			Match: buildTCPMatch(r.Matches),
-			Route: buildTCPDestination(r.ForwardTo, obj.Namespace),
+			Route: buildTCPDestination(r.ForwardTo, obj.Namespace, errs),
 		}
 		routes = append(routes, ir)
 	}
@@ -327,13 +371,13 @@ func buildTCPVirtualService(obj config.Config, gateways []string, domain string)
 	return vsConfig
 }
 
-func buildTLSVirtualService(obj config.Config, gateways []string, domain string) config.Config {
+func buildTLSVirtualService(obj config.Config, gateways []string, domain string, errs *refErrors) config.Config {
 	route := obj.Spec.(*k8s.TLSRouteSpec)
 	routes := []*istio.TLSRoute{}
 	for _, r := range route.Rules {
 		ir := &istio.TLSRoute{
 			Match: buildTLSMatch(r.Matches),
-			Route: buildTCPDestination(r.ForwardTo, obj.Namespace),
+			Route: buildTCPDestination(r.ForwardTo, obj.Namespace, errs),
 		}
 		routes = append(routes, ir)
 	}
@@ -356,14 +400,14 @@ func buildTLSVirtualService(obj config.Config, gateways []string, domain string)
 	return vsConfig
 }
 
-func buildTCPDestination(action []k8s.RouteForwardTo, ns string) []*istio.RouteDestination {
+func buildTCPDestination(action []k8s.RouteForwardTo, ns string, errs *refErrors) []*istio.RouteDestination {
 	if len(action) == 0 {
 		return nil
 	}
 
 	if len(action) == 1 {
 		return []*istio.RouteDestination{{
-			Destination: buildGenericDestination(action[0], ns),
+			Destination: buildGenericDestination(action[0], ns, errs),
 		}}
 	}
 
@@ -374,7 +418,7 @@ func buildTCPDestination(action []k8s.RouteForwardTo, ns string) []*istio.RouteD
 	weights = standardizeWeights(weights)
 	res := []*istio.RouteDestination{}
 	for i, fwd := range action {
-		dst := buildGenericDestination(fwd, ns)
+		dst := buildGenericDestination(fwd, ns, errs)
 		res = append(res, &istio.RouteDestination{
 			Destination: dst,
 			Weight:      int32(weights[i]),
@@ -420,35 +464,34 @@ func intSum(n []int) int {
 	return r
 }
 
-func buildHTTPDestination(action []k8s.HTTPRouteForwardTo, ns string) []*istio.HTTPRouteDestination {
+func buildHTTPDestination(action []k8s.HTTPRouteForwardTo, ns string, errs *refErrors) []*istio.HTTPRouteDestination {
 	if action == nil {
 		return nil
 	}
 
-	if len(action) == 1 {
-		return []*istio.HTTPRouteDestination{{
-			Destination: buildDestination(action[0], ns),
-		}}
-	}
-
 	weights := []int{}
 	for _, w := range action {
 		weights = append(weights, int(w.Weight))
 	}
-	weights = standardizeWeights(weights)
+	if len(action) > 1 {
+		weights = standardizeWeights(weights)
+	}
 	res := []*istio.HTTPRouteDestination{}
 	for i, fwd := range action {
-		dst := buildDestination(fwd, ns)
+		dst := buildDestination(fwd, ns, errs)
 		rd := &istio.HTTPRouteDestination{
 			Destination: dst,
-			Weight:      int32(weights[i]),
+		}
+		if len(action) > 1 {
+			rd.Weight = int32(weights[i])
 		}
 		for _, filter := range fwd.Filters {
 			switch filter.Type {
 			case k8s.HTTPRouteFilterRequestHeaderModifier:
 				rd.Headers = createHeadersFilter(filter.RequestHeaderModifier)
 			default:
-				log.Warnf("unsupported filter type %q", filter.Type)
+				// Istio mirrors requests per route, not per destination
+				errs.unsupportedFilter(filter, "destination")
 			}
 		}
 		res = append(res, rd)
@@ -456,28 +499,26 @@ func buildHTTPDestination(action []k8s.HTTPRouteForwardTo, ns string) []*istio.H
 	return res
 }
 
-func buildDestination(to k8s.HTTPRouteForwardTo, ns string) *istio.Destination {
-	res := &istio.Destination{
-		Port: &istio.PortSelector{Number: uint32(to.Port)},
-	}
-	if to.ServiceName != nil {
-		res.Host = fmt.Sprintf("%s.%s.svc.%s", *to.ServiceName, ns, constants.DefaultKubernetesDomain)
-	} else if to.BackendRef != nil {
-		// TODO support this
-		log.Errorf("referencing unsupported destination; backendRef is not supported")
-	}
-	return res
+func buildDestination(to k8s.HTTPRouteForwardTo, ns string, errs *refErrors) *istio.Destination {
+	return buildServiceDestination(to.ServiceName, to.BackendRef, to.Port, ns, errs)
 }
 
-func buildGenericDestination(to k8s.RouteForwardTo, ns string) *istio.Destination {
+func buildGenericDestination(to k8s.RouteForwardTo, ns string, errs *refErrors) *istio.Destination {
+	return buildServiceDestination(to.ServiceName, to.BackendRef, to.Port, ns, errs)
+}
+
+func buildServiceDestination(serviceName *string, backendRef *k8s.LocalObjectReference, port k8s.PortNumber,
+	ns string, errs *refErrors) *istio.Destination {
 	res := &istio.Destination{
-		Port: &istio.PortSelector{Number: uint32(to.Port)},
+		Port: &istio.PortSelector{Number: uint32(port)},
 	}
-	if to.ServiceName != nil {
-		res.Host = fmt.Sprintf("%s.%s.svc.%s", *to.ServiceName, ns, constants.DefaultKubernetesDomain)
-	} else if to.BackendRef != nil {
+	if serviceName != nil {
+		res.Host = fmt.Sprintf("%s.%s.svc.%s", *serviceName, ns, constants.DefaultKubernetesDomain)
+	} else if backendRef != nil {
 		// TODO support this
-		log.Errorf("referencing unsupported destination; backendRef is not supported")
+		errs.add("unsupported backendRef %s %s, only services are supported", backendRef.Kind, backendRef.Name)
+	} else {
+		errs.add("missing serviceName")
 	}
 	return res
 }
@@ -545,6 +586,14 @@ func createHeadersFilter(filter *k8s.HTTPRequestHeaderFilter) *istio.Headers {
 	}
 }
 
+func createMirrorFilter(filter *k8s.HTTPRequestMirrorFilter, ns string, errs *refErrors) *istio.Destination {
+	if filter == nil {
+		errs.add("missing requestMirror of filter type %q", k8s.HTTPRouteFilterRequestMirror)
+		return nil
+	}
+	return buildServiceDestination(filter.ServiceName, filter.BackendRef, filter.Port, ns, errs)
+}
+
 func createHeadersMatch(match k8s.HTTPRouteMatch) map[string]*istio.StringMatch {
 	if match.Headers == nil {
 		return nil
@@ -598,7 +647,7 @@ func getGatewayClasses(r *KubernetesResources) map[string]struct{} {
 	return classes
 }
 
-func convertGateway(r *KubernetesResources) ([]config.Config, map[RouteKey][]string) {
+func convertGateway(r *KubernetesResources, rep *reporter) ([]config.Config, map[RouteKey][]string) {
 	result := []config.Config{}
 	routeToGateway := map[RouteKey][]string{}
 	classes := getGatewayClasses(r)
@@ -610,7 +659,13 @@ func convertGateway(r *KubernetesResources) ([]config.Config, map[RouteKey][]str
 		}
 		name := obj.Name + "-" + constants.KubernetesGatewayName
 		var servers []*istio.Server
+		listeners := make([]listenerReport, 0, len(kgw.Listeners))
 		for _, l := range kgw.Listeners {
+			lr := listenerReport{listener: l}
+			if l.TLS != nil && l.TLS.Mode != k8s.TLSModePassthrough && !isSecretReference(l.TLS.CertificateRef) {
+				lr.invalidCertificate = fmt.Sprintf("invalid certificate reference %s %s, only secrets are allowed",
+					l.TLS.CertificateRef.Kind, l.TLS.CertificateRef.Name)
+			}
 			server := &istio.Server{
 				// Allow all hosts here. Specific routing will be determined by the virtual services
 				Hosts: buildHostnameMatch(l.Hostname),
@@ -628,19 +683,18 @@ func convertGateway(r *KubernetesResources) ([]config.Config, map[RouteKey][]str
 			servers = append(servers, server)
 
 			// TODO support VirtualService direct reference
-			for _, http := range r.fetchHTTPRoutes(obj.Namespace, l.Routes) {
-				k := toRouteKey(http)
-				routeToGateway[k] = append(routeToGateway[k], obj.Namespace+"/"+name)
-			}
-			for _, tcp := range r.fetchTCPRoutes(obj.Namespace, l.Routes) {
-				k := toRouteKey(tcp)
-				routeToGateway[k] = append(routeToGateway[k], obj.Namespace+"/"+name)
-			}
-			for _, tls := range r.fetchTLSRoutes(obj.Namespace, l.Routes) {
-				k := toRouteKey(tls)
-				routeToGateway[k] = append(routeToGateway[k], obj.Namespace+"/"+name)
+			for _, route := range r.bindRoutes(obj, l.Routes, rep) {
+				k := toRouteKey(route)
+				gwName := obj.Namespace + "/" + name
+				// A route may be bound by several listeners of the same gateway
+				if !containsString(routeToGateway[k], gwName) {
+					routeToGateway[k] = append(routeToGateway[k], gwName)
+				}
+				lr.routes = append(lr.routes, k)
 			}
+			listeners = append(listeners, lr)
 		}
+		rep.gateway(obj, listeners)
 		gatewayConfig := config.Config{
 			Meta: config.Meta{
 				CreationTimestamp: obj.CreationTimestamp,
@@ -660,6 +714,15 @@ func convertGateway(r *KubernetesResources) ([]config.Config, map[RouteKey][]str
 	return result, routeToGateway
 }
 
+func containsString(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
 func buildTLS(tls *k8s.GatewayTLSConfig) *istio.ServerTLSSettings {
 	if tls == nil {
 		return nil
@@ -683,12 +746,17 @@ func buildTLS(tls *k8s.GatewayTLSConfig) *istio.ServerTLSSettings {
 }
 
 func buildSecretReference(ref k8s.LocalObjectReference) string {
-	if !emptyOrEqual(ref.Group, gvk.Secret.Version) || !emptyOrEqual(ref.Kind, gvk.Secret.Kind) {
+	if !isSecretReference(ref) {
 		log.Errorf("invalid certificate reference %v, only secret is allowed", ref)
 	}
 	return ref.Name
 }
 
+func isSecretReference(ref k8s.LocalObjectReference) bool {
+	// The core API group is referred to as "core"
+	return (ref.Group == "core" || emptyOrEqual(ref.Group, gvk.Secret.Group)) && emptyOrEqual(ref.Kind, gvk.Secret.Kind)
+}
+
 func buildHostnameMatch(hostname *k8s.Hostname) []string {
 	// service-apis hostname semantics match ours, so pass directly. The one
 	// exception is they allow unset, which is equivalent to * for us
@@ -37,11 +37,12 @@ func TestConvertResources(t *testing.T) {
 		"mismatch",
 		"weighted",
 		"backendpolicy",
+		"mirror",
 	}
 	for _, tt := range cases {
 		t.Run(tt, func(t *testing.T) {
 			input := readConfig(t, fmt.Sprintf("testdata/%s.yaml", tt))
-			output := convertResources(splitInput(input))
+			output, _ := convertResources(splitInput(input))
 
 			goldenFile := fmt.Sprintf("testdata/%s.yaml.golden", tt)
 			if util.Refresh() {
@@ -0,0 +1,578 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gateway
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8s "sigs.k8s.io/service-apis/apis/v1alpha1"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config"
+	"istio.io/istio/pkg/config/schema/gvk"
+	"istio.io/pkg/log"
+)
+
+// Condition types and reasons set by the controller, in addition to the ones defined by the API.
+const (
+	conditionRouteResolvedRefs = "ResolvedRefs"
+
+	reasonHandled               = "Handled"
+	reasonUnsupportedParameters = "UnsupportedParameters"
+	reasonScheduled             = "Scheduled"
+	reasonReady                 = "Ready"
+	reasonResolvedRefs          = "ResolvedRefs"
+	reasonAdmitted              = "Admitted"
+	reasonNotAllowedByListeners = "NotAllowedByListeners"
+	reasonNotAllowedByRoute     = "NotAllowedByRoute"
+	reasonUnresolvedRefs        = "UnresolvedRefs"
+	reasonUnsupportedFilters    = "UnsupportedFilters"
+)
+
+// refErrors collects the references of a route that could not be resolved, such as unsupported
+// destinations, and the filters of the route that are not translated.
+type refErrors struct {
+	unresolved  []string
+	unsupported []string
+}
+
+func (e *refErrors) add(format string, args ...interface{}) {
+	e.unresolved = append(e.unresolved, fmt.Sprintf(format, args...))
+}
+
+// unsupportedFilter reports a filter that is ignored. Only RequestHeaderModifier and
+// RequestMirror filters are translated, custom filters referenced with ExtensionRef are not.
+func (e *refErrors) unsupportedFilter(filter k8s.HTTPRouteFilter, target string) {
+	msg := fmt.Sprintf("unsupported filter type %q for a %s", filter.Type, target)
+	if ref := filter.ExtensionRef; filter.Type == k8s.HTTPRouteFilterExtensionRef && ref != nil {
+		msg = fmt.Sprintf("unsupported filter type %q referencing %s %s of group %q for a %s",
+			filter.Type, ref.Kind, ref.Name, ref.Group, target)
+	}
+	e.unsupported = append(e.unsupported, msg)
+}
+
+func (e *refErrors) empty() bool {
+	return e == nil || len(e.unresolved)+len(e.unsupported) == 0
+}
+
+func (e *refErrors) message() string {
+	return strings.Join(append(append([]string{}, e.unresolved...), e.unsupported...), "; ")
+}
+
+// listenerReport holds what is reported on a listener of a gateway.
+type listenerReport struct {
+	listener           k8s.Listener
+	invalidCertificate string
+	// routes are the routes bound to the listener
+	routes []RouteKey
+}
+
+// routeBinding holds whether a gateway admitted a route, and why.
+type routeBinding struct {
+	admitted bool
+	reason   string
+	message  string
+}
+
+// reporter collects the status of the service-apis resources while they are converted.
+type reporter struct {
+	gateways map[RouteKey][]listenerReport
+	bindings map[RouteKey]map[k8s.GatewayReference]*routeBinding
+	errors   map[RouteKey]*refErrors
+}
+
+func newReporter() *reporter {
+	return &reporter{
+		gateways: map[RouteKey][]listenerReport{},
+		bindings: map[RouteKey]map[k8s.GatewayReference]*routeBinding{},
+		errors:   map[RouteKey]*refErrors{},
+	}
+}
+
+func (r *reporter) gateway(obj config.Config, listeners []listenerReport) {
+	r.gateways[toRouteKey(obj)] = listeners
+}
+
+// bindRoute reports whether a gateway admitted a route. A route bound by any listener of a gateway
+// is admitted by the gateway.
+func (r *reporter) bindRoute(route RouteKey, gateway k8s.GatewayReference, admitted bool, reason, message string) {
+	bindings := r.bindings[route]
+	if bindings == nil {
+		bindings = map[k8s.GatewayReference]*routeBinding{}
+		r.bindings[route] = bindings
+	}
+	if b := bindings[gateway]; b != nil && b.admitted {
+		return
+	}
+	bindings[gateway] = &routeBinding{admitted: admitted, reason: reason, message: message}
+}
+
+func (r *reporter) refErrors(route RouteKey) *refErrors {
+	errs := r.errors[route]
+	if errs == nil {
+		errs = &refErrors{}
+		r.errors[route] = errs
+	}
+	return errs
+}
+
+// StatusReport holds the status computed for the service-apis resources handled by Istio.
+type StatusReport struct {
+	// configs are the resources with their current status, and statuses their computed status.
+	configs  map[RouteKey]config.Config
+	statuses map[RouteKey]config.Status
+}
+
+func (r *reporter) report(resources *KubernetesResources) *StatusReport {
+	out := &StatusReport{
+		configs:  map[RouteKey]config.Config{},
+		statuses: map[RouteKey]config.Status{},
+	}
+	classes := getGatewayClasses(resources)
+	for _, obj := range resources.GatewayClass {
+		if _, f := classes[obj.Name]; !f {
+			continue
+		}
+		k := toRouteKey(obj)
+		out.configs[k] = obj
+		out.statuses[k] = r.gatewayClassStatus(obj)
+	}
+	for _, obj := range resources.Gateway {
+		k := toRouteKey(obj)
+		listeners, f := r.gateways[k]
+		if !f {
+			continue
+		}
+		out.configs[k] = obj
+		out.statuses[k] = r.gatewayStatus(obj, listeners)
+	}
+	for _, routes := range [][]config.Config{resources.HTTPRoute, resources.TCPRoute, resources.TLSRoute} {
+		for _, obj := range routes {
+			k := toRouteKey(obj)
+			bindings, f := r.bindings[k]
+			if !f {
+				continue
+			}
+			out.configs[k] = obj
+			out.statuses[k] = r.routeStatus(obj, bindings)
+		}
+	}
+	return out
+}
+
+func (r *reporter) gatewayClassStatus(obj config.Config) *k8s.GatewayClassStatus {
+	condition := metav1.Condition{
+		Type:   string(k8s.GatewayClassConditionStatusInvalidParameters),
+		Status: metav1.ConditionFalse,
+		Reason: reasonHandled,
+		// The message is required
+		Message: "Handled by Istio controller",
+	}
+	if obj.Spec.(*k8s.GatewayClassSpec).ParametersRef != nil {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = reasonUnsupportedParameters
+		condition.Message = "Istio controller does not support parameters"
+	}
+	return &k8s.GatewayClassStatus{Conditions: []metav1.Condition{condition}}
+}
+
+func (r *reporter) gatewayStatus(obj config.Config, listeners []listenerReport) *k8s.GatewayStatus {
+	status := &k8s.GatewayStatus{
+		Conditions: []metav1.Condition{{
+			Type:    string(k8s.GatewayConditionScheduled),
+			Status:  metav1.ConditionTrue,
+			Reason:  reasonScheduled,
+			Message: "Handled by Istio controller",
+		}},
+	}
+	if current, ok := obj.Status.(*k8s.GatewayStatus); ok && current != nil {
+		status.Addresses = current.Addresses
+	}
+	var notReady []string
+	for _, l := range listeners {
+		resolved := metav1.Condition{
+			Type:    string(k8s.ListenerConditionResolvedRefs),
+			Status:  metav1.ConditionTrue,
+			Reason:  reasonResolvedRefs,
+			Message: "All references resolved",
+		}
+		ready := metav1.Condition{
+			Type:    string(k8s.ListenerConditionReady),
+			Status:  metav1.ConditionTrue,
+			Reason:  reasonReady,
+			Message: "Listener is ready",
+		}
+		var degraded []string
+		for _, route := range l.routes {
+			if !r.errors[route].empty() {
+				degraded = append(degraded, route.Namespace+"/"+route.Name)
+			}
+		}
+		if l.invalidCertificate != "" {
+			resolved.Status = metav1.ConditionFalse
+			resolved.Reason = string(k8s.ListenerReasonInvalidCertificateRef)
+			resolved.Message = l.invalidCertificate
+			ready.Status = metav1.ConditionFalse
+			ready.Reason = string(k8s.ListenerReasonInvalid)
+			ready.Message = l.invalidCertificate
+			notReady = append(notReady, fmt.Sprint(l.listener.Port))
+		} else if len(degraded) > 0 {
+			resolved.Status = metav1.ConditionFalse
+			resolved.Reason = string(k8s.ListenerReasonDegradedRoutes)
+			resolved.Message = fmt.Sprintf("Routes with unresolved references or unsupported filters: %s", strings.Join(degraded, ", "))
+		}
+		status.Listeners = mergeListenerStatus(status.Listeners, k8s.ListenerStatus{
+			Port:       l.listener.Port,
+			Protocol:   l.listener.Protocol,
+			Hostname:   l.listener.Hostname,
+			Conditions: []metav1.Condition{resolved, ready},
+		})
+	}
+	ready := metav1.Condition{
+		Type:    string(k8s.GatewayConditionReady),
+		Status:  metav1.ConditionTrue,
+		Reason:  reasonReady,
+		Message: "Listeners are ready",
+	}
+	if len(notReady) > 0 {
+		ready.Status = metav1.ConditionFalse
+		ready.Reason = string(k8s.GatewayReasonListenersNotValid)
+		ready.Message = fmt.Sprintf("Invalid listeners on ports: %s", strings.Join(notReady, ", "))
+	}
+	status.Conditions = append(status.Conditions, ready)
+	return status
+}
+
+// mergeListenerStatus adds the status of a listener. The status of listeners is reported per port,
+// so the listeners sharing a port report the conditions that are not met by any of them.
+func mergeListenerStatus(statuses []k8s.ListenerStatus, status k8s.ListenerStatus) []k8s.ListenerStatus {
+	for i := range statuses {
+		if statuses[i].Port != status.Port {
+			continue
+		}
+		for _, c := range status.Conditions {
+			for j := range statuses[i].Conditions {
+				if statuses[i].Conditions[j].Type == c.Type && c.Status == metav1.ConditionFalse {
+					statuses[i].Conditions[j] = c
+				}
+			}
+		}
+		return statuses
+	}
+	return append(statuses, status)
+}
+
+func (r *reporter) routeStatus(obj config.Config, bindings map[k8s.GatewayReference]*routeBinding) config.Status {
+	resolved := metav1.Condition{
+		Type:    conditionRouteResolvedRefs,
+		Status:  metav1.ConditionTrue,
+		Reason:  reasonResolvedRefs,
+		Message: "All references resolved",
+	}
+	if errs := r.errors[toRouteKey(obj)]; !errs.empty() {
+		resolved.Status = metav1.ConditionFalse
+		resolved.Reason = reasonUnresolvedRefs
+		if len(errs.unresolved) == 0 {
+			resolved.Reason = reasonUnsupportedFilters
+		}
+		resolved.Message = errs.message()
+	}
+
+	refs := make([]k8s.GatewayReference, 0, len(bindings))
+	for ref := range bindings {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].Namespace != refs[j].Namespace {
+			return refs[i].Namespace < refs[j].Namespace
+		}
+		return refs[i].Name < refs[j].Name
+	})
+	gateways := make([]k8s.RouteGatewayStatus, 0, len(refs))
+	for _, ref := range refs {
+		b := bindings[ref]
+		admitted := metav1.Condition{
+			Type:    string(k8s.ConditionRouteAdmitted),
+			Status:  metav1.ConditionTrue,
+			Reason:  b.reason,
+			Message: "Route was admitted by the gateway",
+		}
+		if !b.admitted {
+			admitted.Status = metav1.ConditionFalse
+			admitted.Message = b.message
+		}
+		gateways = append(gateways, k8s.RouteGatewayStatus{
+			GatewayRef: ref,
+			Conditions: []metav1.Condition{admitted, resolved},
+		})
+	}
+	status := k8s.RouteStatus{Gateways: gateways}
+
+	switch obj.GroupVersionKind {
+	case gvk.HTTPRoute:
+		return &k8s.HTTPRouteStatus{RouteStatus: status}
+	case gvk.TCPRoute:
+		return &k8s.TCPRouteStatus{RouteStatus: status}
+	case gvk.TLSRoute:
+		return &k8s.TLSRouteStatus{RouteStatus: status}
+	}
+	return nil
+}
+
+// routeStatus returns the status shared by all route types.
+func routeStatus(status config.Status) *k8s.RouteStatus {
+	switch s := status.(type) {
+	case *k8s.HTTPRouteStatus:
+		return &s.RouteStatus
+	case *k8s.TCPRouteStatus:
+		return &s.RouteStatus
+	case *k8s.TLSRouteStatus:
+		return &s.RouteStatus
+	}
+	return nil
+}
+
+// statusWriter writes the status of the service-apis resources, while writes are enabled. Writes
+// are only enabled on the instance elected to write status, so that instances do not race.
+type statusWriter struct {
+	store   model.ConfigStore
+	enabled int32
+
+	mu sync.Mutex
+	// pending holds the latest status report that was not written yet
+	pending *StatusReport
+	// written holds the resource version of each resource when its status was last written,
+	// to not write the same status twice while the cache catches up
+	written map[RouteKey]string
+	notify  chan struct{}
+}
+
+func newStatusWriter(store model.ConfigStore) *statusWriter {
+	return &statusWriter{
+		store:   store,
+		written: map[RouteKey]string{},
+		notify:  make(chan struct{}, 1),
+	}
+}
+
+// SetEnabled enables or disables status writes.
+func (w *statusWriter) SetEnabled(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&w.enabled, v)
+	if enabled {
+		w.trigger()
+	}
+}
+
+func (w *statusWriter) isEnabled() bool {
+	return atomic.LoadInt32(&w.enabled) == 1
+}
+
+// Enqueue schedules the write of a status report.
+func (w *statusWriter) Enqueue(report *StatusReport) {
+	w.mu.Lock()
+	w.pending = report
+	w.mu.Unlock()
+	if w.isEnabled() {
+		w.trigger()
+	}
+}
+
+func (w *statusWriter) trigger() {
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (w *statusWriter) Run(stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case <-w.notify:
+			if w.isEnabled() {
+				w.write()
+			}
+		}
+	}
+}
+
+func (w *statusWriter) write() {
+	w.mu.Lock()
+	report := w.pending
+	w.pending = nil
+	w.mu.Unlock()
+	if report == nil {
+		return
+	}
+	for k, cfg := range report.configs {
+		status := mergeStatus(cfg.Status, report.statuses[k])
+		if statusEqual(cfg.Status, status) || w.written[k] == cfg.ResourceVersion {
+			continue
+		}
+		cfg.Status = status
+		if _, err := w.store.UpdateStatus(cfg); err != nil {
+			log.Warnf("failed to update status of %s %s/%s: %v", k.Gvk.Kind, k.Namespace, k.Name, err)
+			continue
+		}
+		w.written[k] = cfg.ResourceVersion
+	}
+}
+
+// mergeStatus returns the computed status of a resource, keeping the transition times of the
+// conditions that did not change and the status reported for the gateways of other controllers.
+func mergeStatus(current, computed config.Status) config.Status {
+	switch s := computed.(type) {
+	case *k8s.GatewayClassStatus:
+		out := &k8s.GatewayClassStatus{}
+		if c, ok := current.(*k8s.GatewayClassStatus); ok && c != nil {
+			out.Conditions = mergeConditions(c.Conditions, s.Conditions)
+		} else {
+			out.Conditions = mergeConditions(nil, s.Conditions)
+		}
+		return out
+	case *k8s.GatewayStatus:
+		out := &k8s.GatewayStatus{Addresses: s.Addresses}
+		c, _ := current.(*k8s.GatewayStatus)
+		if c == nil {
+			c = &k8s.GatewayStatus{}
+		}
+		out.Conditions = mergeConditions(c.Conditions, s.Conditions)
+		for _, l := range s.Listeners {
+			var currentConditions []metav1.Condition
+			for _, cl := range c.Listeners {
+				if cl.Port == l.Port {
+					currentConditions = cl.Conditions
+				}
+			}
+			l.Conditions = mergeConditions(currentConditions, l.Conditions)
+			out.Listeners = append(out.Listeners, l)
+		}
+		return out
+	}
+
+	rs := routeStatus(computed)
+	if rs == nil {
+		return computed
+	}
+	var currentGateways []k8s.RouteGatewayStatus
+	if c := routeStatus(current); c != nil {
+		currentGateways = c.Gateways
+	}
+	gateways := []k8s.RouteGatewayStatus{}
+	ours := map[k8s.GatewayReference]struct{}{}
+	for _, g := range rs.Gateways {
+		ours[g.GatewayRef] = struct{}{}
+		var currentConditions []metav1.Condition
+		for _, cg := range currentGateways {
+			if cg.GatewayRef == g.GatewayRef {
+				currentConditions = cg.Conditions
+			}
+		}
+		g.Conditions = mergeConditions(currentConditions, g.Conditions)
+		gateways = append(gateways, g)
+	}
+	for _, cg := range currentGateways {
+		if _, f := ours[cg.GatewayRef]; !f {
+			gateways = append(gateways, cg)
+		}
+	}
+	out := k8s.RouteStatus{Gateways: gateways}
+	switch computed.(type) {
+	case *k8s.HTTPRouteStatus:
+		return &k8s.HTTPRouteStatus{RouteStatus: out}
+	case *k8s.TCPRouteStatus:
+		return &k8s.TCPRouteStatus{RouteStatus: out}
+	default:
+		return &k8s.TLSRouteStatus{RouteStatus: out}
+	}
+}
+
+// mergeConditions sets the transition time of the computed conditions, which is kept from the current
+// condition of the same type if its status did not change.
+func mergeConditions(current, computed []metav1.Condition) []metav1.Condition {
+	now := metav1.Now()
+	out := make([]metav1.Condition, 0, len(computed))
+	for _, c := range computed {
+		c.LastTransitionTime = now
+		for _, cc := range current {
+			if cc.Type == c.Type && cc.Status == c.Status {
+				c.LastTransitionTime = cc.LastTransitionTime
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// statusEqual compares statuses, ignoring the transition times of their conditions.
+func statusEqual(a, b config.Status) bool {
+	return reflect.DeepEqual(stripTimes(a), stripTimes(b))
+}
+
+// stripTimes returns a copy of a status without the transition times of its conditions.
+func stripTimes(status config.Status) config.Status {
+	strip := func(conditions []metav1.Condition) []metav1.Condition {
+		if len(conditions) == 0 {
+			return nil
+		}
+		out := make([]metav1.Condition, 0, len(conditions))
+		for _, c := range conditions {
+			c.LastTransitionTime = metav1.Time{}
+			out = append(out, c)
+		}
+		return out
+	}
+	switch s := status.(type) {
+	case *k8s.GatewayClassStatus:
+		if s == nil {
+			return nil
+		}
+		return &k8s.GatewayClassStatus{Conditions: strip(s.Conditions)}
+	case *k8s.GatewayStatus:
+		if s == nil {
+			return nil
+		}
+		out := &k8s.GatewayStatus{Conditions: strip(s.Conditions)}
+		if len(s.Addresses) > 0 {
+			out.Addresses = s.Addresses
+		}
+		for _, l := range s.Listeners {
+			l.Conditions = strip(l.Conditions)
+			out.Listeners = append(out.Listeners, l)
+		}
+		return out
+	}
+	rs := routeStatus(status)
+	if rs == nil {
+		return status
+	}
+	var gateways []k8s.RouteGatewayStatus
+	for _, g := range rs.Gateways {
+		g.Conditions = strip(g.Conditions)
+		gateways = append(gateways, g)
+	}
+	return &k8s.RouteStatus{Gateways: gateways}
+}
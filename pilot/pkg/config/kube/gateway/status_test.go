@@ -0,0 +1,126 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gateway
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8s "sigs.k8s.io/service-apis/apis/v1alpha1"
+
+	"istio.io/istio/pkg/config"
+	"istio.io/istio/pkg/config/schema/gvk"
+)
+
+func TestConvertStatus(t *testing.T) {
+	input := readConfig(t, "testdata/mirror.yaml")
+	_, report := convertResources(splitInput(input))
+
+	status := func(kind config.GroupVersionKind, name, namespace string) interface{} {
+		t.Helper()
+		s, f := report.statuses[RouteKey{Gvk: kind, Name: name, Namespace: namespace}]
+		if !f {
+			t.Fatalf("no status for %v %s/%s", kind.Kind, namespace, name)
+		}
+		return s
+	}
+	expectCondition := func(conditions []metav1.Condition, typ string, want metav1.ConditionStatus, reason string) {
+		t.Helper()
+		for _, c := range conditions {
+			if c.Type == typ {
+				if c.Status != want || c.Reason != reason {
+					t.Fatalf("condition %s: got %s/%s, want %s/%s", typ, c.Status, c.Reason, want, reason)
+				}
+				return
+			}
+		}
+		t.Fatalf("condition %s not found in %v", typ, conditions)
+	}
+
+	gwc := status(gvk.GatewayClass, "istio", "").(*k8s.GatewayClassStatus)
+	expectCondition(gwc.Conditions, string(k8s.GatewayClassConditionStatusInvalidParameters), metav1.ConditionFalse, reasonHandled)
+
+	gw := status(gvk.ServiceApisGateway, "gateway", "istio-system").(*k8s.GatewayStatus)
+	expectCondition(gw.Conditions, string(k8s.GatewayConditionScheduled), metav1.ConditionTrue, reasonScheduled)
+	expectCondition(gw.Conditions, string(k8s.GatewayConditionReady), metav1.ConditionFalse, string(k8s.GatewayReasonListenersNotValid))
+	if len(gw.Listeners) != 2 {
+		t.Fatalf("expected 2 listeners, got %v", gw.Listeners)
+	}
+	expectCondition(gw.Listeners[0].Conditions, string(k8s.ListenerConditionResolvedRefs), metav1.ConditionFalse, string(k8s.ListenerReasonDegradedRoutes))
+	expectCondition(gw.Listeners[0].Conditions, string(k8s.ListenerConditionReady), metav1.ConditionTrue, reasonReady)
+	expectCondition(gw.Listeners[1].Conditions, string(k8s.ListenerConditionResolvedRefs), metav1.ConditionFalse, string(k8s.ListenerReasonInvalidCertificateRef))
+	expectCondition(gw.Listeners[1].Conditions, string(k8s.ListenerConditionReady), metav1.ConditionFalse, string(k8s.ListenerReasonInvalid))
+
+	mirror := status(gvk.HTTPRoute, "mirror", "default").(*k8s.HTTPRouteStatus)
+	if len(mirror.Gateways) != 1 {
+		t.Fatalf("expected 1 gateway, got %v", mirror.Gateways)
+	}
+	expectCondition(mirror.Gateways[0].Conditions, string(k8s.ConditionRouteAdmitted), metav1.ConditionTrue, reasonAdmitted)
+	expectCondition(mirror.Gateways[0].Conditions, conditionRouteResolvedRefs, metav1.ConditionFalse, reasonUnsupportedFilters)
+	for _, c := range mirror.Gateways[0].Conditions {
+		if c.Type == conditionRouteResolvedRefs && !strings.Contains(c.Message, `"ExtensionRef" referencing RouteFilter my-filter`) {
+			t.Fatalf("expected the ExtensionRef filter to be reported, got %q", c.Message)
+		}
+	}
+
+	same := status(gvk.HTTPRoute, "same-namespace", "default").(*k8s.HTTPRouteStatus)
+	expectCondition(same.Gateways[0].Conditions, string(k8s.ConditionRouteAdmitted), metav1.ConditionFalse, reasonNotAllowedByRoute)
+}
+
+func TestMergeStatus(t *testing.T) {
+	before := metav1.NewTime(time.Unix(1000, 0))
+	other := k8s.RouteGatewayStatus{
+		GatewayRef: k8s.GatewayReference{Name: "other", Namespace: "default"},
+		Conditions: []metav1.Condition{{Type: string(k8s.ConditionRouteAdmitted), Status: metav1.ConditionTrue}},
+	}
+	ours := k8s.GatewayReference{Name: "gateway", Namespace: "istio-system"}
+	current := &k8s.HTTPRouteStatus{RouteStatus: k8s.RouteStatus{Gateways: []k8s.RouteGatewayStatus{
+		{
+			GatewayRef: ours,
+			Conditions: []metav1.Condition{
+				{Type: string(k8s.ConditionRouteAdmitted), Status: metav1.ConditionTrue, Reason: reasonAdmitted, LastTransitionTime: before},
+				{Type: conditionRouteResolvedRefs, Status: metav1.ConditionTrue, Reason: reasonResolvedRefs, LastTransitionTime: before},
+			},
+		},
+		other,
+	}}}
+	computed := &k8s.HTTPRouteStatus{RouteStatus: k8s.RouteStatus{Gateways: []k8s.RouteGatewayStatus{{
+		GatewayRef: ours,
+		Conditions: []metav1.Condition{
+			{Type: string(k8s.ConditionRouteAdmitted), Status: metav1.ConditionTrue, Reason: reasonAdmitted},
+			{Type: conditionRouteResolvedRefs, Status: metav1.ConditionFalse, Reason: reasonUnresolvedRefs},
+		},
+	}}}}
+
+	merged := mergeStatus(current, computed).(*k8s.HTTPRouteStatus)
+	if len(merged.Gateways) != 2 || merged.Gateways[1].GatewayRef != other.GatewayRef {
+		t.Fatalf("expected the status of other gateways to be kept, got %v", merged.Gateways)
+	}
+	conditions := merged.Gateways[0].Conditions
+	if !conditions[0].LastTransitionTime.Equal(&before) {
+		t.Fatalf("expected the transition time of an unchanged condition to be kept, got %v", conditions[0].LastTransitionTime)
+	}
+	if conditions[1].LastTransitionTime.Equal(&before) {
+		t.Fatalf("expected the transition time of a changed condition to be updated")
+	}
+	if statusEqual(current, merged) {
+		t.Fatalf("expected statuses to differ")
+	}
+	if !statusEqual(merged, mergeStatus(merged, computed)) {
+		t.Fatalf("expected statuses to be equal")
+	}
+}
@@ -15,7 +15,9 @@
 package ior
 
 import (
+	"reflect"
 	"strings"
+	"time"
 
 	"k8s.io/client-go/kubernetes"
 
@@ -29,8 +31,13 @@ import (
 
 var iorLog = log.RegisterScope("ior", "IOR logging", 0)
 
+// resyncInterval is how often the routes are synced with the Gateways even if no Gateway changed,
+// to pick up the admission status of the routes and conflicts with routes not managed by IOR
+const resyncInterval = time.Minute
+
 // Register configures IOR component to respond to Gateway creations and removals
-func Register(client kubernetes.Interface, store model.ConfigStoreCache, pilotNamespace string, mrc controller.MemberRollController) {
+func Register(client kubernetes.Interface, store model.ConfigStoreCache, pilotNamespace string, mrc controller.MemberRollController,
+	stop <-chan struct{}) {
 	iorLog.Info("Registering IOR component")
 
 	if !isRouteSupported(client) {
@@ -45,7 +52,11 @@ func Register(client kubernetes.Interface, store model.ConfigStoreCache, pilotNa
 	}
 
 	kind := collections.IstioNetworkingV1Alpha3Gateways.Resource().GroupVersionKind()
-	store.RegisterEventHandler(kind, func(_, curr config.Config, event model.Event) {
+	store.RegisterEventHandler(kind, func(prev, curr config.Config, event model.Event) {
+		// the status of the Gateway is written by IOR itself
+		if event == model.EventUpdate && onlyStatusChanged(prev, curr) {
+			return
+		}
 		// encapsulate in goroutine to not slow down processing because of waiting for mutex
 		go func() {
 			_, ok := curr.Spec.(*networking.Gateway)
@@ -60,6 +71,27 @@ func Register(client kubernetes.Interface, store model.ConfigStoreCache, pilotNa
 			}
 		}()
 	})
+
+	go func() {
+		ticker := time.NewTicker(resyncInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := r.syncGatewaysAndRoutes(); err != nil {
+					iorLog.Errora(err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+func onlyStatusChanged(prev, curr config.Config) bool {
+	return reflect.DeepEqual(prev.Spec, curr.Spec) &&
+		reflect.DeepEqual(prev.Labels, curr.Labels) &&
+		reflect.DeepEqual(prev.Annotations, curr.Annotations)
 }
 
 func isRouteSupported(client kubernetes.Interface) bool {
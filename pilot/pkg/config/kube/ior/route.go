@@ -16,6 +16,7 @@ package ior
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 
@@ -23,35 +24,49 @@ import (
 	v1 "github.com/openshift/api/route/v1"
 	routev1 "github.com/openshift/client-go/route/clientset/versioned/typed/route/v1"
 	"golang.org/x/net/context"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
 
 	networking "istio.io/api/networking/v1alpha3"
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pkg/config"
+	"istio.io/istio/pkg/config/protocol"
 	"istio.io/istio/pkg/config/schema/collections"
 	"istio.io/istio/pkg/kube"
 	"istio.io/istio/pkg/servicemesh/controller"
 )
 
 const (
-	maistraPrefix               = "maistra.io/"
-	generatedByLabel            = maistraPrefix + "generated-by"
-	generatedByValue            = "ior"
-	originalHostAnnotation      = maistraPrefix + "original-host"
-	gatewayNameLabel            = maistraPrefix + "gateway-name"
-	gatewayNamespaceLabel       = maistraPrefix + "gateway-namespace"
-	gatewayResourceVersionLabel = maistraPrefix + "gateway-resourceVersion"
+	maistraPrefix          = "maistra.io/"
+	generatedByLabel       = maistraPrefix + "generated-by"
+	generatedByValue       = "ior"
+	originalHostAnnotation = maistraPrefix + "original-host"
+	gatewayNameLabel       = maistraPrefix + "gateway-name"
+	gatewayNamespaceLabel  = maistraPrefix + "gateway-namespace"
+
+	// terminationAnnotation selects how the routes of the servers of a Gateway in SIMPLE TLS mode
+	// terminate TLS: "passthrough" (the default) or "reencrypt"
+	terminationAnnotation  = maistraPrefix + "ior-tls-termination"
+	terminationPassthrough = "passthrough"
+	terminationReencrypt   = "reencrypt"
+
+	defaultHTTPPort  = "http2"
+	defaultHTTPSPort = "https"
 )
 
 // route manages the integration between Istio Gateways and OpenShift Routes
 type route struct {
 	pilotNamespace string
-	client         *routev1.RouteV1Client
+	client         routev1.RoutesGetter
 	kubeClient     kubernetes.Interface
 	store          model.ConfigStoreCache
+	recorder       record.EventRecorder
 
 	// memberroll functionality
 	mrc           controller.MemberRollController
@@ -59,6 +74,16 @@ type route struct {
 	namespaces    []string
 }
 
+// routeSpec is a route that is needed to expose a host of a Gateway
+type routeSpec struct {
+	gateway       config.Meta
+	originalHost  string
+	namespace     string
+	annotations   map[string]string
+	httpsRedirect bool
+	spec          v1.RouteSpec
+}
+
 // newRoute returns a new instance of Route object
 func newRoute(kubeClient kubernetes.Interface, store model.ConfigStoreCache, pilotNamespace string, mrc controller.MemberRollController) (*route, error) {
 	r := &route{}
@@ -74,6 +99,10 @@ func newRoute(kubeClient kubernetes.Interface, store model.ConfigStoreCache, pil
 	r.mrc = mrc
 	r.namespaces = []string{pilotNamespace}
 
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeClient.CoreV1().Events("")})
+	r.recorder = broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "ior"})
+
 	if r.mrc != nil {
 		r.mrc.Register(r, "ior")
 	}
@@ -95,48 +124,116 @@ func (r *route) syncGatewaysAndRoutes() error {
 	if err != nil {
 		return fmt.Errorf("could not get list of Gateways: %s", err)
 	}
+	// the oldest Gateway wins when several Gateways expose the same host
+	sort.SliceStable(configs, func(i, j int) bool {
+		if !configs[i].CreationTimestamp.Equal(configs[j].CreationTimestamp) {
+			return configs[i].CreationTimestamp.Before(configs[j].CreationTimestamp)
+		}
+		return configs[i].Namespace+"/"+configs[i].Name < configs[j].Namespace+"/"+configs[j].Name
+	})
 
-	var routes []v1.Route
-
+	var owned, foreign []v1.Route
 	for _, ns := range r.namespaces {
-		routeList, err := r.client.Routes(ns).List(context.TODO(), metav1.ListOptions{
-			LabelSelector: fmt.Sprintf("%s=%s", generatedByLabel, generatedByValue),
-		})
+		routeList, err := r.client.Routes(ns).List(context.TODO(), metav1.ListOptions{})
 		if err != nil {
 			return fmt.Errorf("could not get list of Routes in namespace %s: %s", ns, err)
 		}
-		routes = append(routes, routeList.Items...)
-	}
-
-	var result *multierror.Error
-	routesMap := make(map[string]*v1.Route, len(routes))
-	for _, route := range routes {
-		_, err := findConfig(configs, route.Labels[gatewayNameLabel], route.Labels[gatewayNamespaceLabel], route.Labels[gatewayResourceVersionLabel])
-		if err != nil {
-			result = multierror.Append(r.deleteRoute(&route))
-		} else {
-			routesMap[getHost(route)] = &route
+		for _, route := range routeList.Items {
+			if route.Labels[generatedByLabel] == generatedByValue {
+				owned = append(owned, route)
+			} else {
+				foreign = append(foreign, route)
+			}
 		}
 	}
 
+	issues := map[string][]string{}
+	desired := map[string]*routeSpec{}
+	var keys []string
+	hostOwners := map[string]string{}
 	for _, cfg := range configs {
 		gateway := cfg.Spec.(*networking.Gateway)
-		iorLog.Debugf("Found Gateway: %s/%s", cfg.Namespace, cfg.Name)
+		gatewayKey := cfg.Namespace + "/" + cfg.Name
+		iorLog.Debugf("Found Gateway: %s", gatewayKey)
 
+		svc, err := r.findService(gateway)
 		for _, server := range gateway.Servers {
 			for _, host := range server.Hosts {
-				_, ok := routesMap[host]
-				if !ok {
-					result = multierror.Append(r.createRoute(cfg.Meta, gateway, host, server.Tls != nil))
+				if err != nil {
+					issues[gatewayKey] = append(issues[gatewayKey], fmt.Sprintf("host %s: %v", host, err))
+					continue
+				}
+				spec, err := buildRoute(cfg.Meta, server, host, svc)
+				if err != nil {
+					issues[gatewayKey] = append(issues[gatewayKey], fmt.Sprintf("host %s: %v", host, err))
+					continue
+				}
+				if conflict := findConflict(foreign, spec); conflict != nil {
+					issues[gatewayKey] = append(issues[gatewayKey], fmt.Sprintf("host %s is already exposed by route %s/%s, which is not managed by IOR",
+						host, conflict.Namespace, conflict.Name))
+					continue
 				}
+				if spec.spec.Host != "" {
+					if owner, ok := hostOwners[spec.spec.Host]; ok && owner != gatewayKey {
+						issues[gatewayKey] = append(issues[gatewayKey], fmt.Sprintf("host %s is already exposed by gateway %s", host, owner))
+						continue
+					}
+					hostOwners[spec.spec.Host] = gatewayKey
+				}
+				key := routeKey(cfg.Namespace, cfg.Name, host)
+				if other, ok := desired[key]; ok {
+					spec = mergeRoutes(other, spec)
+				} else {
+					keys = append(keys, key)
+				}
+				desired[key] = spec
+			}
+		}
+	}
+
+	var result *multierror.Error
+	existing := make(map[string]*v1.Route, len(owned))
+	for i := range owned {
+		route := &owned[i]
+		key := routeKey(route.Labels[gatewayNamespaceLabel], route.Labels[gatewayNameLabel], getHost(*route))
+		if spec, ok := desired[key]; ok && existing[key] == nil && routeUpToDate(route, spec) {
+			existing[key] = route
+			continue
+		}
+		if err := r.deleteRoute(route); err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
 
+	for _, key := range keys {
+		spec := desired[key]
+		gatewayKey := spec.gateway.Namespace + "/" + spec.gateway.Name
+		if route, ok := existing[key]; ok {
+			if reason := notAdmittedReason(route); reason != "" {
+				issues[gatewayKey] = append(issues[gatewayKey], fmt.Sprintf("route %s/%s for host %s was not admitted: %s",
+					route.Namespace, route.Name, spec.originalHost, reason))
 			}
+			continue
+		}
+		if err := r.createRoute(spec); err != nil {
+			issues[gatewayKey] = append(issues[gatewayKey], err.Error())
+			result = multierror.Append(result, err)
+		}
+	}
+
+	for _, cfg := range configs {
+		if err := r.reportStatus(cfg, issues[cfg.Namespace+"/"+cfg.Name]); err != nil {
+			result = multierror.Append(result, err)
 		}
 	}
 
 	return result.ErrorOrNil()
 }
 
+func routeKey(gatewayNamespace, gatewayName, host string) string {
+	return gatewayNamespace + "/" + gatewayName + "/" + host
+}
+
 func getHost(route v1.Route) string {
 	if host := route.ObjectMeta.Annotations[originalHostAnnotation]; host != "" {
 		return host
@@ -144,47 +241,23 @@ func getHost(route v1.Route) string {
 	return route.Spec.Host
 }
 
-func (r *route) deleteRoute(route *v1.Route) error {
-	var immediate int64
-	host := getHost(*route)
-	err := r.client.Routes(route.Namespace).Delete(context.TODO(), route.ObjectMeta.Name, metav1.DeleteOptions{GracePeriodSeconds: &immediate})
+// buildRoute returns the route that exposes a host of a server of the Gateway through the given
+// gateway service
+func buildRoute(metadata config.Meta, server *networking.Server, originalHost string, svc *corev1.Service) (*routeSpec, error) {
+	host, wildcard := routeHost(originalHost)
+	tlsConfig, err := routeTLS(server, metadata.Annotations[terminationAnnotation])
 	if err != nil {
-		return fmt.Errorf("error deleting route %s/%s: %s", route.ObjectMeta.Namespace, route.ObjectMeta.Name, err)
-	}
-
-	iorLog.Infof("Deleted route %s/%s (gateway hostname: %s)", route.ObjectMeta.Namespace, route.ObjectMeta.Name, host)
-	return nil
-}
-
-// must be called with lock held
-func (r *route) createRoute(metadata config.Meta, gateway *networking.Gateway, originalHost string, tls bool) error {
-	var wildcard = v1.WildcardPolicyNone
-	actualHost := originalHost
-
-	iorLog.Debugf("Creating route for hostname %s", originalHost)
-
-	if originalHost == "*" {
-		iorLog.Warnf("Gateway %s/%s: Hostname * is not supported at the moment. Letting OpenShift create it instead.", metadata.Namespace, metadata.Name)
-		actualHost = ""
-	} else if strings.HasPrefix(originalHost, "*.") {
-		// FIXME: Update link below to version 4.5 when it's out
-		// Wildcards are not enabled by default in OCP 3.x.
-		// See https://docs.openshift.com/container-platform/3.11/install_config/router/default_haproxy_router.html#using-wildcard-routes
-		// FIXME(2): Is there a way to check if OCP supports wildcard and print out a warning if not?
-		wildcard = v1.WildcardPolicySubdomain
-		actualHost = "wildcard." + strings.TrimPrefix(originalHost, "*.")
+		return nil, err
 	}
-
-	var tlsConfig *v1.TLSConfig
-	targetPort := "http2"
-	if tls {
-		tlsConfig = &v1.TLSConfig{Termination: v1.TLSTerminationPassthrough}
-		targetPort = "https"
+	targetPort := defaultHTTPPort
+	if tlsConfig != nil {
+		targetPort = defaultHTTPSPort
 	}
-
-	serviceNamespace, serviceName, err := r.findService(gateway)
-	if err != nil {
-		return err
+	for _, port := range svc.Spec.Ports {
+		if port.Port == int32(server.GetPort().GetNumber()) && port.Name != "" {
+			targetPort = port.Name
+			break
+		}
 	}
 
 	annotations := map[string]string{
@@ -196,19 +269,14 @@ func (r *route) createRoute(metadata config.Meta, gateway *networking.Gateway, o
 		}
 	}
 
-	nr, err := r.client.Routes(serviceNamespace).Create(context.TODO(), &v1.Route{
-		ObjectMeta: metav1.ObjectMeta{
-			GenerateName: fmt.Sprintf("%s-%s-", metadata.Namespace, metadata.Name),
-			Labels: map[string]string{
-				generatedByLabel:            generatedByValue,
-				gatewayNamespaceLabel:       metadata.Namespace,
-				gatewayNameLabel:            metadata.Name,
-				gatewayResourceVersionLabel: metadata.ResourceVersion,
-			},
-			Annotations: annotations,
-		},
-		Spec: v1.RouteSpec{
-			Host: actualHost,
+	return &routeSpec{
+		gateway:       metadata,
+		originalHost:  originalHost,
+		namespace:     svc.Namespace,
+		annotations:   annotations,
+		httpsRedirect: server.GetTls().GetHttpsRedirect(),
+		spec: v1.RouteSpec{
+			Host: host,
 			Port: &v1.RoutePort{
 				TargetPort: intstr.IntOrString{
 					Type:   intstr.String,
@@ -216,15 +284,173 @@ func (r *route) createRoute(metadata config.Meta, gateway *networking.Gateway, o
 				},
 			},
 			To: v1.RouteTargetReference{
-				Name: serviceName,
+				Name: svc.Name,
 			},
 			TLS:            tlsConfig,
 			WildcardPolicy: wildcard,
 		},
+	}, nil
+}
+
+// mergeRoutes combines the routes of a host that is exposed by several servers of the same Gateway.
+// A TLS route wins over a plain text one and redirects plain text requests if the plain text server does.
+func mergeRoutes(a, b *routeSpec) *routeSpec {
+	tlsRoute, plain := a, b
+	if a.spec.TLS == nil {
+		tlsRoute, plain = b, a
+	}
+	if tlsRoute.spec.TLS == nil || plain.spec.TLS != nil {
+		return b
+	}
+	if plain.httpsRedirect {
+		tlsRoute.spec.TLS.InsecureEdgeTerminationPolicy = v1.InsecureEdgeTerminationPolicyRedirect
+	}
+	return tlsRoute
+}
+
+// routeHost returns the host and wildcard policy of the route for a host of a Gateway. If the host
+// is *, the host is empty and OpenShift generates one.
+func routeHost(originalHost string) (string, v1.WildcardPolicyType) {
+	// strip the namespace of hosts in namespace/dnsName format
+	host := originalHost
+	if i := strings.Index(host, "/"); i >= 0 {
+		host = host[i+1:]
+	}
+
+	if host == "*" {
+		return "", v1.WildcardPolicyNone
+	}
+	if strings.HasPrefix(host, "*.") {
+		// Wildcard routes must be allowed in the router, otherwise the route is not admitted.
+		// See https://docs.openshift.com/container-platform/4.6/networking/ingress-operator.html#using-wildcard-routes_configuring-ingress
+		return "wildcard." + strings.TrimPrefix(host, "*."), v1.WildcardPolicySubdomain
+	}
+	return host, v1.WildcardPolicyNone
+}
+
+// routeTLS returns the TLS configuration of the route for a server of a Gateway, or nil if the
+// server does not use TLS
+func routeTLS(server *networking.Server, termination string) (*v1.TLSConfig, error) {
+	tls := server.GetTls()
+	if tls == nil {
+		return nil, nil
+	}
+	// plain text servers that only redirect to HTTPS
+	if tls.HttpsRedirect && !protocol.Parse(server.GetPort().GetProtocol()).IsTLS() {
+		return nil, nil
+	}
+	if termination != "" && termination != terminationPassthrough && termination != terminationReencrypt {
+		return nil, fmt.Errorf("invalid value %q of annotation %s, must be %q or %q",
+			termination, terminationAnnotation, terminationPassthrough, terminationReencrypt)
+	}
+
+	switch tls.Mode {
+	case networking.ServerTLSSettings_PASSTHROUGH, networking.ServerTLSSettings_AUTO_PASSTHROUGH:
+		return &v1.TLSConfig{Termination: v1.TLSTerminationPassthrough}, nil
+	case networking.ServerTLSSettings_SIMPLE:
+		if termination == terminationReencrypt {
+			return &v1.TLSConfig{Termination: v1.TLSTerminationReencrypt}, nil
+		}
+		return &v1.TLSConfig{Termination: v1.TLSTerminationPassthrough}, nil
+	case networking.ServerTLSSettings_MUTUAL:
+		// the router does not forward client certificates, so the gateway must terminate TLS
+		if termination == terminationReencrypt {
+			return nil, fmt.Errorf("TLS mode MUTUAL cannot be re-encrypted by the router, as the client certificate would be lost")
+		}
+		return &v1.TLSConfig{Termination: v1.TLSTerminationPassthrough}, nil
+	case networking.ServerTLSSettings_ISTIO_MUTUAL:
+		return nil, fmt.Errorf("TLS mode ISTIO_MUTUAL is not supported, as only clients with an Istio certificate can connect")
+	}
+	return nil, fmt.Errorf("TLS mode %v is not supported", tls.Mode)
+}
+
+// routeUpToDate returns true if the existing route matches the desired one
+func routeUpToDate(route *v1.Route, spec *routeSpec) bool {
+	if route.Namespace != spec.namespace {
+		return false
+	}
+	// OpenShift generates the host if it is empty
+	if spec.spec.Host != "" && route.Spec.Host != spec.spec.Host {
+		return false
+	}
+	if route.Spec.WildcardPolicy != spec.spec.WildcardPolicy ||
+		route.Spec.To.Name != spec.spec.To.Name ||
+		route.Spec.Port == nil || route.Spec.Port.TargetPort != spec.spec.Port.TargetPort {
+		return false
+	}
+	if (route.Spec.TLS == nil) != (spec.spec.TLS == nil) ||
+		(route.Spec.TLS != nil && (route.Spec.TLS.Termination != spec.spec.TLS.Termination ||
+			route.Spec.TLS.InsecureEdgeTerminationPolicy != spec.spec.TLS.InsecureEdgeTerminationPolicy)) {
+		return false
+	}
+	for key, value := range spec.annotations {
+		if route.Annotations[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// findConflict returns a route that is not managed by IOR and exposes the host of the desired route
+func findConflict(routes []v1.Route, spec *routeSpec) *v1.Route {
+	if spec.spec.Host == "" {
+		return nil
+	}
+	for i, route := range routes {
+		if route.Spec.Host == spec.spec.Host && route.Spec.Path == "" {
+			return &routes[i]
+		}
+	}
+	return nil
+}
+
+// notAdmittedReason returns why a router rejected the route, or an empty string if no router did
+func notAdmittedReason(route *v1.Route) string {
+	for _, ingress := range route.Status.Ingress {
+		for _, condition := range ingress.Conditions {
+			if condition.Type == v1.RouteAdmitted && condition.Status == corev1.ConditionFalse {
+				if condition.Message != "" {
+					return fmt.Sprintf("%s (%s)", condition.Reason, condition.Message)
+				}
+				return condition.Reason
+			}
+		}
+	}
+	return ""
+}
+
+func (r *route) deleteRoute(route *v1.Route) error {
+	var immediate int64
+	host := getHost(*route)
+	err := r.client.Routes(route.Namespace).Delete(context.TODO(), route.ObjectMeta.Name, metav1.DeleteOptions{GracePeriodSeconds: &immediate})
+	if err != nil {
+		return fmt.Errorf("error deleting route %s/%s: %s", route.ObjectMeta.Namespace, route.ObjectMeta.Name, err)
+	}
+
+	iorLog.Infof("Deleted route %s/%s (gateway hostname: %s)", route.ObjectMeta.Namespace, route.ObjectMeta.Name, host)
+	return nil
+}
+
+// must be called with lock held
+func (r *route) createRoute(spec *routeSpec) error {
+	metadata := spec.gateway
+	iorLog.Debugf("Creating route for hostname %s", spec.originalHost)
+
+	nr, err := r.client.Routes(spec.namespace).Create(context.TODO(), &v1.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: fmt.Sprintf("%s-%s-", metadata.Namespace, metadata.Name),
+			Labels: map[string]string{
+				generatedByLabel:      generatedByValue,
+				gatewayNamespaceLabel: metadata.Namespace,
+				gatewayNameLabel:      metadata.Name,
+			},
+			Annotations: spec.annotations,
+		},
+		Spec: spec.spec,
 	}, metav1.CreateOptions{})
 
 	if err != nil {
-		return fmt.Errorf("error creating a route for the host %s (gateway: %s/%s): %s", originalHost, metadata.Namespace, metadata.Name, err)
+		return fmt.Errorf("error creating a route for the host %s (gateway: %s/%s): %s", spec.originalHost, metadata.Namespace, metadata.Name, err)
 	}
 
 	iorLog.Infof("Created route %s/%s for hostname %s (gateway: %s/%s)",
@@ -252,46 +478,37 @@ func (r *route) initClient() error {
 }
 
 // findService tries to find a service that matches with the given gateway selector, in the given namespaces
-// Returns the namespace and service name that is a match, or an error
+// Returns the service that is a match, or an error
 // must be called with lock held
-func (r *route) findService(gateway *networking.Gateway) (string, string, error) {
+func (r *route) findService(gateway *networking.Gateway) (*corev1.Service, error) {
 	gwSelector := labels.SelectorFromSet(gateway.Selector)
 
 	for _, ns := range r.namespaces {
 		// Get the list of pods that match the gateway selector
 		podList, err := r.kubeClient.CoreV1().Pods(ns).List(context.TODO(), metav1.ListOptions{LabelSelector: gwSelector.String()})
 		if err != nil {
-			return "", "", fmt.Errorf("could not get the list of pods in namespace %s: %v", ns, err)
+			return nil, fmt.Errorf("could not get the list of pods in namespace %s: %v", ns, err)
 		}
 
 		// Get the list of services in this namespace
 		svcList, err := r.kubeClient.CoreV1().Services(ns).List(context.TODO(), metav1.ListOptions{})
 		if err != nil {
-			return "", "", fmt.Errorf("could not get the list of services in namespace %s: %v", ns, err)
+			return nil, fmt.Errorf("could not get the list of services in namespace %s: %v", ns, err)
 		}
 
 		// Look for a service whose selector matches the pod labels
 		for _, pod := range podList.Items {
 			podLabels := labels.Set(pod.ObjectMeta.Labels)
 
-			for _, svc := range svcList.Items {
+			for i, svc := range svcList.Items {
 				svcSelector := labels.SelectorFromSet(svc.Spec.Selector)
 				if svcSelector.Matches(podLabels) {
-					return ns, svc.Name, nil
+					return &svcList.Items[i], nil
 				}
 			}
 		}
 	}
 
-	return "", "", fmt.Errorf("could not find a service that matches the gateway selector `%s'. Namespaces where we looked at: %v",
+	return nil, fmt.Errorf("could not find a service that matches the gateway selector `%s'. Namespaces where we looked at: %v",
 		gwSelector.String(), r.namespaces)
 }
-
-func findConfig(list []config.Config, name, namespace, resourceVersion string) (config.Config, error) {
-	for _, item := range list {
-		if item.Name == name && item.Namespace == namespace && item.ResourceVersion == resourceVersion {
-			return item, nil
-		}
-	}
-	return config.Config{}, fmt.Errorf("config not found")
-}
@@ -0,0 +1,317 @@
+// Copyright Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ior
+
+import (
+	"testing"
+
+	v1 "github.com/openshift/api/route/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"istio.io/api/meta/v1alpha1"
+	networking "istio.io/api/networking/v1alpha3"
+	"istio.io/istio/pkg/config"
+)
+
+func TestRouteHost(t *testing.T) {
+	testCases := []struct {
+		host             string
+		expectedHost     string
+		expectedWildcard v1.WildcardPolicyType
+	}{
+		{host: "www.example.com", expectedHost: "www.example.com", expectedWildcard: v1.WildcardPolicyNone},
+		{host: "ns/www.example.com", expectedHost: "www.example.com", expectedWildcard: v1.WildcardPolicyNone},
+		{host: "*.example.com", expectedHost: "wildcard.example.com", expectedWildcard: v1.WildcardPolicySubdomain},
+		{host: "*/*.example.com", expectedHost: "wildcard.example.com", expectedWildcard: v1.WildcardPolicySubdomain},
+		{host: "*", expectedHost: "", expectedWildcard: v1.WildcardPolicyNone},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.host, func(t *testing.T) {
+			host, wildcard := routeHost(tc.host)
+			if host != tc.expectedHost || wildcard != tc.expectedWildcard {
+				t.Fatalf("expected host %q with wildcard policy %s, got %q with %s", tc.expectedHost, tc.expectedWildcard, host, wildcard)
+			}
+		})
+	}
+}
+
+func TestRouteTLS(t *testing.T) {
+	testCases := []struct {
+		name                string
+		server              *networking.Server
+		termination         string
+		expectedTermination v1.TLSTerminationType
+		expectedError       bool
+	}{
+		{
+			name:   "plain_text",
+			server: &networking.Server{Port: &networking.Port{Number: 80, Protocol: "HTTP"}},
+		},
+		{
+			name: "https_redirect",
+			server: &networking.Server{
+				Port: &networking.Port{Number: 80, Protocol: "HTTP"},
+				Tls:  &networking.ServerTLSSettings{HttpsRedirect: true},
+			},
+		},
+		{
+			name: "passthrough",
+			server: &networking.Server{
+				Port: &networking.Port{Number: 443, Protocol: "TLS"},
+				Tls:  &networking.ServerTLSSettings{Mode: networking.ServerTLSSettings_PASSTHROUGH},
+			},
+			expectedTermination: v1.TLSTerminationPassthrough,
+		},
+		{
+			name: "auto_passthrough",
+			server: &networking.Server{
+				Port: &networking.Port{Number: 15443, Protocol: "TLS"},
+				Tls:  &networking.ServerTLSSettings{Mode: networking.ServerTLSSettings_AUTO_PASSTHROUGH},
+			},
+			expectedTermination: v1.TLSTerminationPassthrough,
+		},
+		{
+			name: "simple",
+			server: &networking.Server{
+				Port: &networking.Port{Number: 443, Protocol: "HTTPS"},
+				Tls:  &networking.ServerTLSSettings{Mode: networking.ServerTLSSettings_SIMPLE},
+			},
+			expectedTermination: v1.TLSTerminationPassthrough,
+		},
+		{
+			name: "simple_reencrypt",
+			server: &networking.Server{
+				Port: &networking.Port{Number: 443, Protocol: "HTTPS"},
+				Tls:  &networking.ServerTLSSettings{Mode: networking.ServerTLSSettings_SIMPLE},
+			},
+			termination:         terminationReencrypt,
+			expectedTermination: v1.TLSTerminationReencrypt,
+		},
+		{
+			name: "mutual",
+			server: &networking.Server{
+				Port: &networking.Port{Number: 443, Protocol: "HTTPS"},
+				Tls:  &networking.ServerTLSSettings{Mode: networking.ServerTLSSettings_MUTUAL},
+			},
+			expectedTermination: v1.TLSTerminationPassthrough,
+		},
+		{
+			name: "mutual_reencrypt",
+			server: &networking.Server{
+				Port: &networking.Port{Number: 443, Protocol: "HTTPS"},
+				Tls:  &networking.ServerTLSSettings{Mode: networking.ServerTLSSettings_MUTUAL},
+			},
+			termination:   terminationReencrypt,
+			expectedError: true,
+		},
+		{
+			name: "istio_mutual",
+			server: &networking.Server{
+				Port: &networking.Port{Number: 443, Protocol: "HTTPS"},
+				Tls:  &networking.ServerTLSSettings{Mode: networking.ServerTLSSettings_ISTIO_MUTUAL},
+			},
+			expectedError: true,
+		},
+		{
+			name: "invalid_termination",
+			server: &networking.Server{
+				Port: &networking.Port{Number: 443, Protocol: "HTTPS"},
+				Tls:  &networking.ServerTLSSettings{Mode: networking.ServerTLSSettings_SIMPLE},
+			},
+			termination:   "edge",
+			expectedError: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tlsConfig, err := routeTLS(tc.server, tc.termination)
+			if tc.expectedError {
+				if err == nil {
+					t.Fatalf("expected error but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error but got %s", err)
+			}
+			var termination v1.TLSTerminationType
+			if tlsConfig != nil {
+				termination = tlsConfig.Termination
+			}
+			if termination != tc.expectedTermination {
+				t.Fatalf("expected termination %q, got %q", tc.expectedTermination, termination)
+			}
+		})
+	}
+}
+
+func TestBuildRoute(t *testing.T) {
+	gateway := config.Meta{
+		Name:      "gw",
+		Namespace: "ns",
+		Annotations: map[string]string{
+			"kubectl.kubernetes.io/last-applied-configuration": "{}",
+			"foo": "bar",
+		},
+	}
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "istio-ingressgateway", Namespace: "istio-system"},
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{
+				{Name: "http2", Port: 80},
+				{Name: "https", Port: 443},
+				{Name: "tls-custom", Port: 8443},
+			},
+		},
+	}
+	http := &networking.Server{
+		Port:  &networking.Port{Number: 80, Protocol: "HTTP"},
+		Hosts: []string{"www.example.com"},
+		Tls:   &networking.ServerTLSSettings{HttpsRedirect: true},
+	}
+	https := &networking.Server{
+		Port:  &networking.Port{Number: 8443, Protocol: "HTTPS"},
+		Hosts: []string{"www.example.com"},
+		Tls:   &networking.ServerTLSSettings{Mode: networking.ServerTLSSettings_SIMPLE},
+	}
+
+	plain, err := buildRoute(gateway, http, "www.example.com", svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secure, err := buildRoute(gateway, https, "www.example.com", svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secure.spec.Port.TargetPort.StrVal != "tls-custom" {
+		t.Errorf("expected target port tls-custom, got %s", secure.spec.Port.TargetPort.StrVal)
+	}
+	if _, ok := secure.annotations["kubectl.kubernetes.io/last-applied-configuration"]; ok {
+		t.Errorf("expected kubectl annotations to be dropped")
+	}
+	if secure.annotations["foo"] != "bar" || secure.annotations[originalHostAnnotation] != "www.example.com" {
+		t.Errorf("unexpected annotations %v", secure.annotations)
+	}
+
+	merged := mergeRoutes(plain, secure)
+	if merged.spec.TLS == nil || merged.spec.TLS.InsecureEdgeTerminationPolicy != v1.InsecureEdgeTerminationPolicyRedirect {
+		t.Fatalf("expected TLS route that redirects plain text requests, got %v", merged.spec.TLS)
+	}
+
+	route := &v1.Route{
+		ObjectMeta: metav1.ObjectMeta{Namespace: merged.namespace, Annotations: merged.annotations},
+		Spec:       *merged.spec.DeepCopy(),
+	}
+	if !routeUpToDate(route, merged) {
+		t.Errorf("expected route to be up to date")
+	}
+	route.Spec.TLS.Termination = v1.TLSTerminationReencrypt
+	if routeUpToDate(route, merged) {
+		t.Errorf("expected route with different termination to be outdated")
+	}
+}
+
+func TestFindConflict(t *testing.T) {
+	routes := []v1.Route{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "path", Namespace: "ns"},
+			Spec:       v1.RouteSpec{Host: "www.example.com", Path: "/api"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "ns"},
+			Spec:       v1.RouteSpec{Host: "other.example.com"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "wildcard", Namespace: "ns"},
+			Spec:       v1.RouteSpec{Host: "wildcard.example.org", WildcardPolicy: v1.WildcardPolicySubdomain},
+		},
+	}
+	testCases := []struct {
+		host     string
+		expected string
+	}{
+		{host: "www.example.com"},
+		{host: "other.example.com", expected: "other"},
+		{host: "*.example.org", expected: "wildcard"},
+		{host: "*"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.host, func(t *testing.T) {
+			host, wildcard := routeHost(tc.host)
+			conflict := findConflict(routes, &routeSpec{spec: v1.RouteSpec{Host: host, WildcardPolicy: wildcard}})
+			name := ""
+			if conflict != nil {
+				name = conflict.Name
+			}
+			if name != tc.expected {
+				t.Fatalf("expected conflict with %q, got %q", tc.expected, name)
+			}
+		})
+	}
+}
+
+func TestNotAdmittedReason(t *testing.T) {
+	route := &v1.Route{
+		Status: v1.RouteStatus{
+			Ingress: []v1.RouteIngress{
+				{
+					Conditions: []v1.RouteIngressCondition{
+						{
+							Type:    v1.RouteAdmitted,
+							Status:  corev1.ConditionFalse,
+							Reason:  "RouteNotAdmitted",
+							Message: "wildcard routes are not allowed",
+						},
+					},
+				},
+			},
+		},
+	}
+	if reason := notAdmittedReason(route); reason != "RouteNotAdmitted (wildcard routes are not allowed)" {
+		t.Fatalf("unexpected reason %q", reason)
+	}
+	route.Status.Ingress[0].Conditions[0].Status = corev1.ConditionTrue
+	if reason := notAdmittedReason(route); reason != "" {
+		t.Fatalf("expected admitted route, got reason %q", reason)
+	}
+}
+
+func TestSetCondition(t *testing.T) {
+	current := &v1alpha1.IstioStatus{
+		Conditions: []*v1alpha1.IstioCondition{
+			{Type: "Reconciled", Status: "True"},
+			{Type: routesConditionType, Status: "True", Message: "ok"},
+		},
+	}
+
+	status, changed := setCondition(current, &v1alpha1.IstioCondition{Type: routesConditionType, Status: "True", Message: "ok"})
+	if changed || len(status.Conditions) != 2 {
+		t.Fatalf("expected unchanged status, got %v", status)
+	}
+
+	status, changed = setCondition(current, &v1alpha1.IstioCondition{Type: routesConditionType, Status: "False", Message: "conflict"})
+	if !changed || len(status.Conditions) != 2 || status.Conditions[1].Message != "conflict" || status.Conditions[0].Type != "Reconciled" {
+		t.Fatalf("expected updated condition, got %v", status)
+	}
+	if current.Conditions[1].Message != "ok" {
+		t.Fatalf("expected current status to be left untouched")
+	}
+
+	status, changed = setCondition(nil, &v1alpha1.IstioCondition{Type: routesConditionType, Status: "True"})
+	if !changed || len(status.Conditions) != 1 {
+		t.Fatalf("expected new condition, got %v", status)
+	}
+}
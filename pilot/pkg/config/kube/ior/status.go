@@ -0,0 +1,98 @@
+// Copyright Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ior
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gogo/protobuf/types"
+	corev1 "k8s.io/api/core/v1"
+
+	"istio.io/api/meta/v1alpha1"
+	"istio.io/istio/pkg/config"
+)
+
+const (
+	// routesConditionType is the type of the condition IOR reports on Gateways
+	routesConditionType = "RoutesReady"
+
+	reasonRoutesCreated  = "RoutesCreated"
+	reasonRoutesNotReady = "RoutesNotReady"
+)
+
+// reportStatus sets the condition of the routes of the Gateway and records a warning event for it
+// when some of its hosts are not exposed. Nothing is written if the condition did not change.
+// must be called with lock held
+func (r *route) reportStatus(cfg config.Config, issues []string) error {
+	desired := &v1alpha1.IstioCondition{
+		Type:               routesConditionType,
+		Status:             "True",
+		LastProbeTime:      types.TimestampNow(),
+		LastTransitionTime: types.TimestampNow(),
+		Reason:             reasonRoutesCreated,
+		Message:            "All hosts are exposed by OpenShift routes",
+	}
+	if len(issues) > 0 {
+		desired.Status = "False"
+		desired.Reason = reasonRoutesNotReady
+		desired.Message = strings.Join(issues, "; ")
+	}
+
+	status, changed := setCondition(cfg.Status, desired)
+	if !changed {
+		return nil
+	}
+
+	if len(issues) > 0 {
+		r.recorder.Event(&corev1.ObjectReference{
+			APIVersion:      cfg.GroupVersionKind.GroupVersion(),
+			Kind:            cfg.GroupVersionKind.Kind,
+			Namespace:       cfg.Namespace,
+			Name:            cfg.Name,
+			ResourceVersion: cfg.ResourceVersion,
+		}, corev1.EventTypeWarning, reasonRoutesNotReady, desired.Message)
+	}
+
+	cfg.Status = status
+	if _, err := r.store.UpdateStatus(cfg); err != nil {
+		return fmt.Errorf("error updating status of gateway %s/%s: %s", cfg.Namespace, cfg.Name, err)
+	}
+	return nil
+}
+
+// setCondition returns a copy of the status with the condition of the same type replaced by the
+// desired one, and whether the status or message of the condition changed
+func setCondition(current config.Status, desired *v1alpha1.IstioCondition) (*v1alpha1.IstioStatus, bool) {
+	status := &v1alpha1.IstioStatus{}
+	if s, ok := current.(*v1alpha1.IstioStatus); ok && s != nil {
+		status = s.DeepCopy()
+	}
+	for i, condition := range status.Conditions {
+		if condition.Type != desired.Type {
+			continue
+		}
+		if condition.Status == desired.Status && condition.Message == desired.Message {
+			return status, false
+		}
+		if condition.Status == desired.Status {
+			desired.LastTransitionTime = condition.LastTransitionTime
+		}
+		status.Conditions[i] = desired
+		return status, true
+	}
+	status.Conditions = append(status.Conditions, desired)
+	return status, true
+}
@@ -0,0 +1,172 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// maxNegativeTTL caps how long a negative answer is cached, no matter what the SOA says,
+	// so that newly created names become resolvable quickly.
+	maxNegativeTTL = 5 * time.Minute
+	// defaultCacheSize is the maximum number of upstream responses kept in the cache.
+	defaultCacheSize = 4096
+)
+
+type cacheKey struct {
+	name   string
+	qtype  uint16
+	qclass uint16
+}
+
+type cacheEntry struct {
+	msg     *dns.Msg
+	stored  time.Time
+	expires time.Time
+}
+
+// responseCache caches upstream DNS responses for as long as their TTL allows. Negative responses
+// (NXDOMAIN, or NOERROR without answers) are cached for the TTL of the SOA record of the authority
+// section as described in RFC 2308, and are not cached at all when there is no SOA record.
+type responseCache struct {
+	mu         sync.Mutex
+	entries    map[cacheKey]*cacheEntry
+	maxEntries int
+	now        func() time.Time
+}
+
+func newResponseCache(maxEntries int) *responseCache {
+	return &responseCache{
+		entries:    map[cacheKey]*cacheEntry{},
+		maxEntries: maxEntries,
+		now:        time.Now,
+	}
+}
+
+func keyFor(req *dns.Msg) cacheKey {
+	q := req.Question[0]
+	return cacheKey{name: strings.ToLower(q.Name), qtype: q.Qtype, qclass: q.Qclass}
+}
+
+// get returns a copy of the cached response to the request, with the TTLs reduced by the time
+// spent in the cache, or nil if there is no valid cached response.
+func (c *responseCache) get(req *dns.Msg) *dns.Msg {
+	key := keyFor(req)
+	now := c.now()
+	c.mu.Lock()
+	entry, f := c.entries[key]
+	if f && !now.Before(entry.expires) {
+		delete(c.entries, key)
+		f = false
+	}
+	c.mu.Unlock()
+	if !f {
+		return nil
+	}
+
+	elapsed := uint32(now.Sub(entry.stored) / time.Second)
+	response := entry.msg.Copy()
+	response.Id = req.Id
+	response.Question = req.Question
+	for _, section := range [][]dns.RR{response.Answer, response.Ns, response.Extra} {
+		for _, rr := range section {
+			hdr := rr.Header()
+			if hdr.Rrtype == dns.TypeOPT {
+				continue
+			}
+			if hdr.Ttl > elapsed {
+				hdr.Ttl -= elapsed
+			} else {
+				hdr.Ttl = 0
+			}
+		}
+	}
+	return response
+}
+
+// add caches the upstream response to the request, if it is cacheable.
+func (c *responseCache) add(req *dns.Msg, response *dns.Msg) {
+	ttl := cacheTTL(response)
+	if ttl <= 0 {
+		return
+	}
+	now := c.now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= c.maxEntries {
+		c.evict(now)
+	}
+	c.entries[keyFor(req)] = &cacheEntry{
+		msg:     response.Copy(),
+		stored:  now,
+		expires: now.Add(ttl),
+	}
+}
+
+// evict makes room for a new entry, preferably by dropping expired entries. The caller must hold the lock.
+func (c *responseCache) evict(now time.Time) {
+	for k, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+	for k := range c.entries {
+		if len(c.entries) < c.maxEntries {
+			return
+		}
+		delete(c.entries, k)
+	}
+}
+
+// cacheTTL returns how long the response may be cached, or 0 if it must not be cached.
+func cacheTTL(response *dns.Msg) time.Duration {
+	if response.Truncated {
+		return 0
+	}
+	switch {
+	case response.Rcode == dns.RcodeSuccess && len(response.Answer) > 0:
+		return minTTL(response.Answer)
+	case response.Rcode == dns.RcodeNameError || response.Rcode == dns.RcodeSuccess:
+		for _, rr := range response.Ns {
+			if soa, ok := rr.(*dns.SOA); ok {
+				ttl := soa.Hdr.Ttl
+				if soa.Minttl < ttl {
+					ttl = soa.Minttl
+				}
+				d := time.Duration(ttl) * time.Second
+				if d > maxNegativeTTL {
+					d = maxNegativeTTL
+				}
+				return d
+			}
+		}
+	}
+	return 0
+}
+
+func minTTL(records []dns.RR) time.Duration {
+	var ttl uint32
+	for i, rr := range records {
+		if i == 0 || rr.Header().Ttl < ttl {
+			ttl = rr.Header().Ttl
+		}
+	}
+	return time.Duration(ttl) * time.Second
+}
@@ -0,0 +1,237 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestResponseCache(t *testing.T) {
+	soa := &dns.SOA{
+		Hdr:    dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 60},
+		Minttl: 20,
+	}
+	answer := func(ttl uint32) *dns.Msg {
+		m := new(dns.Msg)
+		m.Answer = a("www.example.com.", []net.IP{net.ParseIP("1.2.3.4").To4()})
+		m.Answer[0].Header().Ttl = ttl
+		return m
+	}
+	nxdomain := func(ns ...dns.RR) *dns.Msg {
+		m := new(dns.Msg)
+		m.Rcode = dns.RcodeNameError
+		m.Ns = ns
+		return m
+	}
+	truncated := answer(30)
+	truncated.Truncated = true
+	servfail := new(dns.Msg)
+	servfail.Rcode = dns.RcodeServerFailure
+
+	cases := []struct {
+		name     string
+		response *dns.Msg
+		// how long the response is expected to be cached, 0 if not cached
+		ttl time.Duration
+	}{
+		{"positive answer", answer(30), 30 * time.Second},
+		{"positive answer with zero ttl", answer(0), 0},
+		{"negative answer uses soa minimum", nxdomain(soa), 20 * time.Second},
+		{"negative answer without soa", nxdomain(), 0},
+		{"negative answer capped", nxdomain(&dns.SOA{Hdr: dns.RR_Header{Ttl: 86400}, Minttl: 86400}), maxNegativeTTL},
+		{"truncated answer", truncated, 0},
+		{"server failure", servfail, 0},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			c := newResponseCache(10)
+			c.now = func() time.Time { return now }
+			req := new(dns.Msg)
+			req.SetQuestion("www.example.com.", dns.TypeA)
+			c.add(req, tt.response)
+
+			got := c.get(req)
+			if tt.ttl == 0 {
+				if got != nil {
+					t.Fatalf("expected response not to be cached, got %v", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatalf("expected response to be cached")
+			}
+			if got.Id != req.Id {
+				t.Fatalf("expected cached response to match the request id %v, got %v", req.Id, got.Id)
+			}
+
+			// TTLs are reduced by the time spent in the cache
+			elapsed := tt.ttl - time.Second
+			now = now.Add(elapsed)
+			got = c.get(req)
+			if got == nil {
+				t.Fatalf("expected response to be cached until it expires")
+			}
+			original := append(tt.response.Answer, tt.response.Ns...)
+			for i, rr := range append(got.Answer, got.Ns...) {
+				want := original[i].Header().Ttl - uint32(elapsed/time.Second)
+				if rr.Header().Ttl != want {
+					t.Fatalf("expected ttl %v, got %v", want, rr)
+				}
+			}
+			now = now.Add(time.Second)
+			if got := c.get(req); got != nil {
+				t.Fatalf("expected response to expire, got %v", got)
+			}
+		})
+	}
+}
+
+func TestResponseCacheEviction(t *testing.T) {
+	now := time.Now()
+	c := newResponseCache(2)
+	c.now = func() time.Time { return now }
+	response := new(dns.Msg)
+	response.Answer = a("www.example.com.", []net.IP{net.ParseIP("1.2.3.4").To4()})
+	for _, host := range []string{"a.example.com.", "b.example.com.", "c.example.com."} {
+		req := new(dns.Msg)
+		req.SetQuestion(host, dns.TypeA)
+		c.add(req, response)
+	}
+	if len(c.entries) != 2 {
+		t.Fatalf("expected cache to be bounded to 2 entries, got %d", len(c.entries))
+	}
+}
+
+func TestQueryUpstreamCache(t *testing.T) {
+	var queries int32
+	mux := dns.NewServeMux()
+	mux.HandleFunc(".", func(w dns.ResponseWriter, req *dns.Msg) {
+		atomic.AddInt32(&queries, 1)
+		response := new(dns.Msg)
+		response.SetReply(req)
+		switch req.Question[0].Name {
+		case "known.example.com.":
+			response.Answer = a("known.example.com.", []net.IP{net.ParseIP("1.2.3.4").To4()})
+		default:
+			response.Rcode = dns.RcodeNameError
+			response.Ns = []dns.RR{&dns.SOA{
+				Hdr:    dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 60},
+				Ns:     "ns.example.com.",
+				Mbox:   "admin.example.com.",
+				Minttl: 60,
+			}}
+		}
+		_ = w.WriteMsg(response)
+	})
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &dns.Server{PacketConn: pc, Handler: mux}
+	go func() {
+		_ = server.ActivateAndServe()
+	}()
+	defer func() {
+		_ = server.Shutdown()
+	}()
+
+	h := &LocalDNSServer{
+		resolvConfServers: []string{pc.LocalAddr().String()},
+		upstreamCache:     newResponseCache(defaultCacheSize),
+	}
+	client := &dns.Client{Net: "udp", Timeout: 3 * time.Second}
+
+	for _, tt := range []struct {
+		host  string
+		rcode int
+	}{
+		{"known.example.com.", dns.RcodeSuccess},
+		{"unknown.example.com.", dns.RcodeNameError},
+	} {
+		atomic.StoreInt32(&queries, 0)
+		for i := 0; i < 3; i++ {
+			req := new(dns.Msg)
+			req.SetQuestion(tt.host, dns.TypeA)
+			response := h.queryUpstream(client, req)
+			if response.Rcode != tt.rcode {
+				t.Fatalf("%s: expected rcode %v, got %v", tt.host, tt.rcode, response.Rcode)
+			}
+			if response.Id != req.Id {
+				t.Fatalf("%s: expected response id %v, got %v", tt.host, req.Id, response.Id)
+			}
+		}
+		if got := atomic.LoadInt32(&queries); got != 1 {
+			t.Fatalf("%s: expected a single upstream query, got %d", tt.host, got)
+		}
+	}
+}
+
+func TestTruncateCachedResponse(t *testing.T) {
+	ips := make([]net.IP, 0, 64)
+	for i := 0; i < 64; i++ {
+		ips = append(ips, net.IPv4(10, 0, 0, byte(i)).To4())
+	}
+	req := new(dns.Msg)
+	req.SetQuestion("large.example.com.", dns.TypeA)
+	upstream := new(dns.Msg)
+	upstream.SetReply(req)
+	upstream.Answer = a("large.example.com.", ips)
+
+	h := &LocalDNSServer{upstreamCache: newResponseCache(defaultCacheSize)}
+	// the response was received over TCP
+	h.upstreamCache.add(req, upstream)
+
+	for _, tt := range []struct {
+		name      string
+		protocol  string
+		udpSize   uint16
+		truncated bool
+	}{
+		{"tcp", "tcp", 0, false},
+		{"udp", "udp", 0, true},
+		{"udp with small EDNS0 size", "udp", 256, true},
+		{"udp with large EDNS0 size", "udp", 4096, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := new(dns.Msg)
+			req.SetQuestion("large.example.com.", dns.TypeA)
+			if tt.udpSize != 0 {
+				req.SetEdns0(tt.udpSize, false)
+			}
+			response := h.queryUpstream(nil, req)
+			truncateResponse(tt.protocol, req, response)
+			if response.Truncated != tt.truncated {
+				t.Fatalf("expected truncated %v, got %v", tt.truncated, response.Truncated)
+			}
+			if tt.truncated {
+				size := dns.MinMsgSize
+				if int(tt.udpSize) > size {
+					size = int(tt.udpSize)
+				}
+				if response.Len() > size || len(response.Answer) == len(ips) {
+					t.Fatalf("expected the response to fit in %d bytes, got %d bytes and %d answers", size, response.Len(), len(response.Answer))
+				}
+			} else if len(response.Answer) != len(ips) {
+				t.Fatalf("expected %d answers, got %d", len(ips), len(response.Answer))
+			}
+		})
+	}
+}
@@ -16,6 +16,7 @@ package dns
 
 import (
 	"net"
+	"sort"
 	"strings"
 	"sync/atomic"
 
@@ -33,6 +34,9 @@ type LocalDNSServer struct {
 	udpDNSProxy *dnsProxy
 	tcpDNSProxy *dnsProxy
 
+	// Holds the responses of the upstream resolvers, shared by the UDP and TCP proxies
+	upstreamCache *responseCache
+
 	resolvConfServers []string
 	searchNamespaces  []string
 	// The namespace where the proxy resides
@@ -60,6 +64,12 @@ type LookupTable struct {
 	// The cname records here (comprised of different variants of the hosts above,
 	// expanded by the search namespaces) pointing to the actual host.
 	cname map[string][]dns.RR
+	// The key is a service port name in the form of _port-name._protocol.host. (like _http._tcp.example.com.),
+	// the value is the SRV record pointing to the host and port.
+	srv map[string][]dns.RR
+	// The key is the reverse lookup name of a service VIP or pod IP (like 4.3.2.1.in-addr.arpa.), the
+	// value is the PTR records pointing to the hosts with that IP.
+	ptr map[string][]dns.RR
 }
 
 const (
@@ -72,6 +82,7 @@ const (
 func NewLocalDNSServer(proxyNamespace, proxyDomain string) (*LocalDNSServer, error) {
 	h := &LocalDNSServer{
 		proxyNamespace: proxyNamespace,
+		upstreamCache:  newResponseCache(defaultCacheSize),
 	}
 
 	// proxyDomain could contain the namespace making it redundant.
@@ -128,6 +139,8 @@ func (h *LocalDNSServer) UpdateLookupTable(nt *nds.NameTable) {
 		name4:    map[string][]dns.RR{},
 		name6:    map[string][]dns.RR{},
 		cname:    map[string][]dns.RR{},
+		srv:      map[string][]dns.RR{},
+		ptr:      map[string][]dns.RR{},
 	}
 	for host, ni := range nt.Table {
 		// Given a host
@@ -146,7 +159,10 @@ func (h *LocalDNSServer) UpdateLookupTable(nt *nds.NameTable) {
 			continue
 		}
 		lookupTable.buildDNSAnswers(altHosts, ipv4, ipv6, h.searchNamespaces)
+		lookupTable.buildSRVAnswers(altHosts, ni.Ports)
+		lookupTable.buildPTRAnswers(host+".", ipv4, ipv6)
 	}
+	lookupTable.sortPTRAnswers()
 	h.lookupTable.Store(lookupTable)
 }
 
@@ -178,6 +194,7 @@ func (h *LocalDNSServer) ServeDNS(proxy *dnsProxy, w dns.ResponseWriter, req *dn
 		answers, hostFound := lookupTable.lookupHost(req.Question[0].Qtype, hostname)
 
 		if hostFound {
+			recordRequest(req.Question[0].Qtype, sourceLocal)
 			response = new(dns.Msg)
 			response.SetReply(req)
 			response.Answer = answers
@@ -193,9 +210,24 @@ func (h *LocalDNSServer) ServeDNS(proxy *dnsProxy, w dns.ResponseWriter, req *dn
 		}
 	}
 
+	truncateResponse(proxy.protocol, req, response)
 	_ = w.WriteMsg(response)
 }
 
+// truncateResponse truncates UDP responses to the size the client accepts, the UDP payload size
+// advertised with EDNS0 or 512 bytes, and sets the TC bit so that the client retries over TCP.
+// Upstream responses are cached for both protocols, so cached answers may have been received over TCP.
+func truncateResponse(protocol string, req *dns.Msg, response *dns.Msg) {
+	if protocol != "udp" {
+		return
+	}
+	size := dns.MinMsgSize
+	if opt := req.IsEdns0(); opt != nil && int(opt.UDPSize()) > size {
+		size = int(opt.UDPSize())
+	}
+	response.Truncate(size)
+}
+
 func (h *LocalDNSServer) Close() {
 	h.udpDNSProxy.close()
 	h.tcpDNSProxy.close()
@@ -203,19 +235,36 @@ func (h *LocalDNSServer) Close() {
 
 // TODO: Figure out how to send parallel queries to all nameservers
 func (h *LocalDNSServer) queryUpstream(upstreamClient *dns.Client, req *dns.Msg) *dns.Msg {
+	qtype := req.Question[0].Qtype
+	if cached := h.upstreamCache.get(req); cached != nil {
+		recordRequest(qtype, sourceCache)
+		return cached
+	}
+	recordRequest(qtype, sourceUpstream)
+
 	var response *dns.Msg
 	for _, upstream := range h.resolvConfServers {
 		cResponse, _, err := upstreamClient.Exchange(req, upstream)
-		if err == nil && len(cResponse.Answer) > 0 {
+		if err != nil {
+			continue
+		}
+		if len(cResponse.Answer) > 0 {
 			response = cResponse
 			break
 		}
+		// Keep the first negative answer, unless another upstream knows better.
+		if response == nil && (cResponse.Rcode == dns.RcodeNameError || cResponse.Rcode == dns.RcodeSuccess) {
+			response = cResponse
+		}
 	}
 	if response == nil {
+		recordUpstreamFailure(qtype)
 		response = new(dns.Msg)
 		response.SetReply(req)
 		response.Rcode = dns.RcodeNameError
+		return response
 	}
+	h.upstreamCache.add(req, response)
 	return response
 }
 
@@ -280,8 +329,12 @@ func (table *LookupTable) lookupHost(qtype uint16, hostname string) ([]dns.RR, b
 		ipAnswers = table.name4[hostname]
 	case dns.TypeAAAA:
 		ipAnswers = table.name6[hostname]
+	case dns.TypeSRV:
+		// SRV names are never expanded by search namespaces, so there is no cname to chain.
+		return table.srv[hostname], hostFound
+	case dns.TypePTR:
+		return table.ptr[hostname], hostFound
 	default:
-		// TODO: handle PTR records for reverse dns lookups
 		return nil, false
 	}
 
@@ -341,6 +394,47 @@ func (table *LookupTable) buildDNSAnswers(altHosts map[string]struct{}, ipv4 []n
 	}
 }
 
+// buildSRVAnswers stores an SRV record for each named port of the host variants, following the
+// Kubernetes DNS naming of _port-name._protocol.host.
+func (table *LookupTable) buildSRVAnswers(altHosts map[string]struct{}, ports []*nds.NameTable_NameInfo_Port) {
+	for _, port := range ports {
+		proto := "_tcp."
+		if strings.EqualFold(port.Protocol, "UDP") {
+			proto = "_udp."
+		}
+		for h := range altHosts {
+			name := "_" + strings.ToLower(port.Name) + "." + proto + h
+			table.allHosts[name] = struct{}{}
+			table.srv[name] = srv(name, h, port.Number)
+		}
+	}
+}
+
+// buildPTRAnswers stores a PTR record for reverse lookups of each of the host's IPs. Only the
+// canonical host is used as target, its variants are specific to the proxy namespace.
+func (table *LookupTable) buildPTRAnswers(host string, ipv4 []net.IP, ipv6 []net.IP) {
+	for _, ips := range [][]net.IP{ipv4, ipv6} {
+		for _, ip := range ips {
+			name, err := dns.ReverseAddr(ip.String())
+			if err != nil {
+				continue
+			}
+			table.allHosts[name] = struct{}{}
+			table.ptr[name] = append(table.ptr[name], ptr(name, host))
+		}
+	}
+}
+
+// sortPTRAnswers orders the PTR records of IPs shared by several hosts, so that answers do not
+// depend on the iteration order of the name table.
+func (table *LookupTable) sortPTRAnswers() {
+	for _, answers := range table.ptr {
+		sort.Slice(answers, func(i, j int) bool {
+			return answers[i].(*dns.PTR).Ptr < answers[j].(*dns.PTR).Ptr
+		})
+	}
+}
+
 // Borrowed from https://github.com/coredns/coredns/blob/master/plugin/hosts/hosts.go
 // a takes a slice of net.IPs and returns a slice of A RRs.
 func a(host string, ips []net.IP) []dns.RR {
@@ -375,3 +469,20 @@ func cname(host string, targetHost string) []dns.RR {
 	answer.Target = targetHost
 	return []dns.RR{answer}
 }
+
+func srv(name string, target string, port uint32) []dns.RR {
+	answer := new(dns.SRV)
+	answer.Hdr = dns.RR_Header{Name: name, Rrtype: dns.TypeSRV, Class: dns.ClassINET, Ttl: defaultTTLInSeconds}
+	answer.Priority = 0
+	answer.Weight = 100
+	answer.Port = uint16(port)
+	answer.Target = target
+	return []dns.RR{answer}
+}
+
+func ptr(name string, target string) dns.RR {
+	answer := new(dns.PTR)
+	answer.Hdr = dns.RR_Header{Name: name, Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: defaultTTLInSeconds}
+	answer.Ptr = target
+	return answer
+}
@@ -54,12 +54,17 @@ func initDNS() error {
 				Registry:  "Kubernetes",
 				Namespace: "ns1",
 				Shortname: "productpage",
+				Ports:     []*nds.NameTable_NameInfo_Port{{Name: "http", Number: 9080, Protocol: "HTTP"}},
 			},
 			"reviews.ns2.svc.cluster.local": {
 				Ips:       []string{"10.10.10.10"},
 				Registry:  "Kubernetes",
 				Namespace: "ns2",
 				Shortname: "reviews",
+				Ports: []*nds.NameTable_NameInfo_Port{
+					{Name: "http", Number: 9080, Protocol: "HTTP"},
+					{Name: "dns", Number: 53, Protocol: "UDP"},
+				},
 			},
 			"details.ns2.svc.cluster.remote": {
 				Ips:       []string{"11.11.11.11", "12.12.12.12"},
@@ -93,6 +98,7 @@ func TestDNS(t *testing.T) {
 		name                     string
 		host                     string
 		queryAAAA                bool
+		queryType                uint16
 		expected                 []dns.RR
 		expectResolutionFailure  bool
 		expectExternalResolution bool
@@ -193,6 +199,54 @@ func TestDNS(t *testing.T) {
 			queryAAAA:               true,
 			expectResolutionFailure: true,
 		},
+		{
+			name:      "success: SRV query for a service port - fqdn",
+			host:      "_http._tcp.productpage.ns1.svc.cluster.local.",
+			queryType: dns.TypeSRV,
+			expected:  srv("_http._tcp.productpage.ns1.svc.cluster.local.", "productpage.ns1.svc.cluster.local.", 9080),
+		},
+		{
+			name:      "success: SRV query for a service port - shortname",
+			host:      "_http._tcp.productpage.",
+			queryType: dns.TypeSRV,
+			expected:  srv("_http._tcp.productpage.", "productpage.", 9080),
+		},
+		{
+			name:      "success: SRV query for a udp service port - non local namespace",
+			host:      "_dns._udp.reviews.ns2.svc.cluster.local.",
+			queryType: dns.TypeSRV,
+			expected:  srv("_dns._udp.reviews.ns2.svc.cluster.local.", "reviews.ns2.svc.cluster.local.", 53),
+		},
+		{
+			name:                    "failure: SRV query for a known host without port",
+			host:                    "productpage.ns1.svc.cluster.local.",
+			queryType:               dns.TypeSRV,
+			expectResolutionFailure: true,
+		},
+		{
+			name:      "success: PTR query for a service VIP",
+			host:      "9.9.9.9.in-addr.arpa.",
+			queryType: dns.TypePTR,
+			expected:  []dns.RR{ptr("9.9.9.9.in-addr.arpa.", "productpage.ns1.svc.cluster.local.")},
+		},
+		{
+			name:      "success: PTR query for an IP shared by several hosts",
+			host:      "2.2.2.2.in-addr.arpa.",
+			queryType: dns.TypePTR,
+			expected: []dns.RR{
+				ptr("2.2.2.2.in-addr.arpa.", "dual.localhost."),
+				ptr("2.2.2.2.in-addr.arpa.", "ipv4.localhost."),
+			},
+		},
+		{
+			name:      "success: PTR query for an IPv6 address",
+			host:      "9.2.3.8.2.4.0.0.0.0.f.f.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.",
+			queryType: dns.TypePTR,
+			expected: []dns.RR{
+				ptr("9.2.3.8.2.4.0.0.0.0.f.f.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.", "dual.localhost."),
+				ptr("9.2.3.8.2.4.0.0.0.0.f.f.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.", "ipv6.localhost."),
+			},
+		},
 	}
 
 	clients := []dns.Client{
@@ -214,6 +268,9 @@ func TestDNS(t *testing.T) {
 				if tt.queryAAAA {
 					q = dns.TypeAAAA
 				}
+				if tt.queryType != 0 {
+					q = tt.queryType
+				}
 				m.SetQuestion(tt.host, q)
 				res, _, err := clients[i].Exchange(m, testAgentDNSAddr)
 
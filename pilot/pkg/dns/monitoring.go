@@ -0,0 +1,59 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dns
+
+import (
+	"github.com/miekg/dns"
+
+	"istio.io/pkg/monitoring"
+)
+
+const (
+	// sourceLocal marks queries answered from the name table
+	sourceLocal = "local"
+	// sourceCache marks queries answered from the cache of upstream responses
+	sourceCache = "cache"
+	// sourceUpstream marks queries forwarded to the upstream resolvers
+	sourceUpstream = "upstream"
+)
+
+var (
+	typeTag   = monitoring.MustCreateLabel("type")
+	sourceTag = monitoring.MustCreateLabel("source")
+
+	requests = monitoring.NewSum(
+		"dns_requests_total",
+		"Total number of DNS requests, by query type and by where the answer came from.",
+		monitoring.WithLabels(typeTag, sourceTag),
+	)
+
+	upstreamFailures = monitoring.NewSum(
+		"dns_upstream_failures_total",
+		"Total number of DNS requests that no upstream resolver could answer.",
+		monitoring.WithLabels(typeTag),
+	)
+)
+
+func init() {
+	monitoring.MustRegister(requests, upstreamFailures)
+}
+
+func recordRequest(qtype uint16, source string) {
+	requests.With(typeTag.Value(dns.TypeToString[qtype]), sourceTag.Value(source)).Increment()
+}
+
+func recordUpstreamFailure(qtype uint16) {
+	upstreamFailures.With(typeTag.Value(dns.TypeToString[qtype])).Increment()
+}
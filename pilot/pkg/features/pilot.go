@@ -44,6 +44,13 @@ var (
 		"Limits the number of concurrent pushes allowed. On larger machines this can be increased for faster pushes",
 	).Get()
 
+	PushQueueWeights = env.RegisterStringVar(
+		"PILOT_PUSH_QUEUE_WEIGHTS",
+		"gateway=4,incremental=2,full=1",
+		"Sets how many proxies of each push class are pushed in turn: pushes to gateways, pushes of endpoints "+
+			"only and full pushes. Higher weights go first, while every class with pending pushes gets its turn.",
+	).Get()
+
 	// MaxRecvMsgSize The max receive buffer size of gRPC received channel of Pilot in bytes.
 	MaxRecvMsgSize = env.RegisterIntVar(
 		"ISTIO_GPRC_MAXRECVMSGSIZE",
@@ -345,6 +352,19 @@ var (
 			"Use || between <trustdomain, endpoint> tuples. Use | as delimiter between trust domain and endpoint in "+
 			"each tuple. For example: foo|https://url/for/foo||bar|https://url/for/bar").Get()
 
+	SpiffeBundleFiles = env.RegisterStringVar("SPIFFE_BUNDLE_FILES", "",
+		"The SPIFFE bundle trust domain to file mappings. Each file contains a SPIFFE bundle document or PEM "+
+			"encoded root certificates of the trust domain. Uses the same format as SPIFFE_BUNDLE_ENDPOINTS, "+
+			"for example: foo|/etc/bundles/foo.json||bar|/etc/bundles/bar.pem").Get()
+
+	SpiffeBundleRefreshInterval = env.RegisterDurationVar("SPIFFE_BUNDLE_REFRESH_INTERVAL", 5*time.Minute,
+		"How often the federated SPIFFE bundles are refreshed, unless a bundle carries a refresh hint.").Get()
+
+	EnableFederatedTrustBundles = env.RegisterBoolVar("PILOT_ENABLE_FEDERATED_TRUST_BUNDLES", false,
+		"If enabled, the SPIFFE bundles of federated trust domains are distributed to proxies, which then accept "+
+			"peers of these trust domains. Bundles are configured with SPIFFE_BUNDLE_ENDPOINTS, SPIFFE_BUNDLE_FILES and "+
+			"ServiceMeshTrustBundle resources in the istiod namespace.").Get()
+
 	EnableXDSCaching = env.RegisterBoolVar("PILOT_ENABLE_XDS_CACHE", true,
 		"If true, Pilot will cache XDS responses.").Get()
 
@@ -354,6 +374,14 @@ var (
 	XDSCacheMaxSize = env.RegisterIntVar("PILOT_XDS_CACHE_SIZE", 20000,
 		"The maximum number of cache entries for the XDS cache. If the size is <= 0, the cache will have no upper bound.").Get()
 
+	XDSCacheMaxBytes = env.RegisterIntVar("PILOT_XDS_CACHE_MAX_BYTES", 0,
+		"The maximum total size in bytes of the resources held by the XDS cache. If the size is <= 0, "+
+			"the cache size in bytes will have no upper bound.").Get()
+
+	XDSCacheShards = env.RegisterIntVar("PILOT_XDS_CACHE_SHARDS", 16,
+		"The number of independently locked partitions of the XDS cache. More shards reduce lock "+
+			"contention between concurrent pushes.").Get()
+
 	AllowMetadataCertsInMutualTLS = env.RegisterBoolVar("PILOT_ALLOW_METADATA_CERTS_DR_MUTUAL_TLS", false,
 		"If true, Pilot will allow certs specified in Metadata to override DR certs in MUTUAL TLS mode. "+
 			"This is only enabled for migration and will be removed soon.").Get()
@@ -390,6 +418,10 @@ var (
 	EnableMaistraExtensionSupport = env.RegisterBoolVar("ENABLE_MAISTRA_EXTENSIONS", false,
 		"If enabled, pilot, will watch ServiceMeshExtension resources and apply them to filter chains of its proxies").Get()
 
+	EnableMaistraExtensionECDS = env.RegisterBoolVar("ENABLE_MAISTRA_EXTENSIONS_ECDS", false,
+		"If enabled, pilot will deliver ServiceMeshExtensions to proxies over the Extension Config Discovery Service. "+
+			"The istio-agent fetches the modules and hands them to Envoy as local files.").Get()
+
 	EnableIOR = env.RegisterBoolVar("ENABLE_IOR", false,
 		"Whether to enable IOR component, which provides integration between Istio Gateways and OpenShift Routes").Get()
 )
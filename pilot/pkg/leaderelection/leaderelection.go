@@ -36,6 +36,10 @@ const (
 	IngressController = "istio-leader"
 	StatusController  = "istio-status-leader"
 	AnalyzeController = "istio-analyze-leader"
+	// GatewayStatusController writes the status of the service-apis resources.
+	GatewayStatusController = "istio-gateway-status-leader"
+	// ExtensionStatusController writes the status of ServiceMeshExtensions.
+	ExtensionStatusController = "istio-extension-status-leader"
 )
 
 type LeaderElection struct {
@@ -79,6 +79,10 @@ type Environment struct {
 	// DomainSuffix provides a default domain for the Istio server.
 	DomainSuffix string
 
+	// TrustBundles provides the trust bundles of the SPIFFE trust domains federated with the mesh.
+	// Nil if no trust domains are federated.
+	TrustBundles TrustBundleProvider
+
 	ledger ledger.Ledger
 }
 
@@ -167,6 +171,20 @@ type XdsResourceGenerator interface {
 	Generate(proxy *Proxy, push *PushContext, w *WatchedResource, updates *PushRequest) Resources
 }
 
+// DeltaResources is a list of named resources, as sent in delta xDS responses.
+type DeltaResources = []*discovery.Resource
+
+// XdsDeltaResourceGenerator is implemented by generators that know which resources changed, so that
+// delta xDS clients only receive those. Resources of other generators are compared with the versions
+// the client has, which avoids sending unchanged resources but still requires generating all of them.
+type XdsDeltaResourceGenerator interface {
+	XdsResourceGenerator
+	// GenerateDeltas returns the resources that may have changed and the names of the resources that
+	// were removed. If usedDelta is false, the resources are the complete set of the type, and the
+	// resources the client has that are not in the set are removed on full pushes.
+	GenerateDeltas(proxy *Proxy, push *PushContext, w *WatchedResource, updates *PushRequest) (res DeltaResources, removed []string, usedDelta bool)
+}
+
 // Proxy contains information about an specific instance of a proxy (envoy sidecar, gateway,
 // etc). The Proxy is initialized when a sidecar connects to Pilot, and populated from
 // 'node' info in the protocol as well as data extracted from registries.
@@ -220,6 +238,10 @@ type Proxy struct {
 	// Istio version associated with the Proxy
 	IstioVersion *IstioVersion
 
+	// UserAgentName and UserAgentVersion identify the xDS client of the proxy, as reported in its node
+	UserAgentName    string
+	UserAgentVersion string
+
 	// VerifiedIdentity determines whether a proxy had its identity verified. This
 	// generally occurs by JWT or mTLS authentication. This can be false when
 	// connecting over plaintext. If this is set to true, we can verify the proxy has
@@ -289,6 +311,10 @@ type WatchedResource struct {
 	// Note that Envoy may send multiple requests for the same type, for
 	// example to update the set of watched resources or to ACK/NACK.
 	LastRequest *discovery.DiscoveryRequest
+
+	// ResourceVersions tracks the version of each resource the client has, keyed by resource name.
+	// It is only used by delta xDS connections, which only send resources whose version changed.
+	ResourceVersions map[string]string
 }
 
 var (
@@ -212,6 +212,13 @@ type PushContext struct {
 
 	Version string
 
+	// TrustBundles provides the trust bundles of the SPIFFE trust domains federated with the mesh.
+	// Nil if no trust domains are federated.
+	TrustBundles TrustBundleProvider `json:"-"`
+
+	// federatedTrustDomains is the list of federated trust domains at the time of the push.
+	federatedTrustDomains []string
+
 	// cache gateways addresses for each network
 	// this is mainly used for kubernetes multi-cluster scenario
 	networkGateways map[string][]*Gateway
@@ -331,6 +338,8 @@ const (
 	DebugTrigger TriggerReason = "debug"
 	// Describes a push triggered for a Secret change
 	SecretTrigger TriggerReason = "secret"
+	// Describes a push triggered by a change to the trust bundle of a federated trust domain
+	TrustBundleTrigger TriggerReason = "trustbundle"
 )
 
 // Merge two update requests together
@@ -885,6 +894,7 @@ func (ps *PushContext) InitContext(env *Environment, oldPushContext *PushContext
 	ps.ServiceDiscovery = env
 	ps.IstioConfigStore = env
 	ps.Version = env.Version()
+	ps.initTrustBundles(env)
 
 	// Must be initialized first
 	// as initServiceRegistry/VirtualServices/Destrules
@@ -1599,12 +1609,17 @@ func (ps *PushContext) initExtensions(env *Environment) error {
 	return nil
 }
 
-// Extensions return the merged ExtensionWrappers of a proxy
+// Extensions return the merged ExtensionWrappers of a proxy. For extensions
+// that are being rolled out, the deployment the proxy is part of is returned.
 func (ps *PushContext) Extensions(proxy *Proxy) map[v1alpha1.FilterPhase][]*maistramodel.ExtensionWrapper {
 	if proxy == nil {
 		return nil
 	}
 	matchedExtensions := make(map[v1alpha1.FilterPhase][]*maistramodel.ExtensionWrapper)
+	var proxyLabels labels.Instance
+	if proxy.Metadata != nil {
+		proxyLabels = proxy.Metadata.Labels
+	}
 	// First get all the extension configs from the config root namespace
 	// and then add the ones from proxy's own namespace
 	if ps.Mesh.RootNamespace != "" {
@@ -1616,7 +1631,7 @@ func (ps *PushContext) Extensions(proxy *Proxy) map[v1alpha1.FilterPhase][]*mais
 				workloadLabels = labels.Collection{proxy.Metadata.Labels}
 			}
 			if ext.WorkloadSelector == nil || workloadLabels.IsSupersetOf(ext.WorkloadSelector) {
-				matchedExtensions[ext.Phase] = append(matchedExtensions[ext.Phase], ext)
+				matchedExtensions[ext.Phase] = append(matchedExtensions[ext.Phase], ext.ForProxy(proxy.ID, proxyLabels))
 			}
 		}
 	}
@@ -1629,24 +1644,14 @@ func (ps *PushContext) Extensions(proxy *Proxy) map[v1alpha1.FilterPhase][]*mais
 				workloadLabels = labels.Collection{proxy.Metadata.Labels}
 			}
 			if ext.WorkloadSelector == nil || workloadLabels.IsSupersetOf(ext.WorkloadSelector) {
-				matchedExtensions[ext.Phase] = append(matchedExtensions[ext.Phase], ext)
+				matchedExtensions[ext.Phase] = append(matchedExtensions[ext.Phase], ext.ForProxy(proxy.ID, proxyLabels))
 			}
 		}
 	}
 
-	// sort slices by priority
-	for i, slice := range matchedExtensions {
-		sort.SliceStable(slice, func(i, j int) bool {
-			// if priority is the same, in order to still have a
-			// deterministic ordering, we sort based on name + image
-			if slice[i].Priority == slice[j].Priority {
-				in := slice[i].Image + slice[i].Image
-				jn := slice[j].Image + slice[i].Image
-				return in < jn
-			}
-			return slice[i].Priority > slice[j].Priority
-		})
-		matchedExtensions[i] = slice
+	// sort slices by priority and before/after constraints
+	for phase, slice := range matchedExtensions {
+		matchedExtensions[phase] = maistramodel.OrderExtensions(slice)
 	}
 
 	return matchedExtensions
@@ -532,6 +532,91 @@ func TestExtensions(t *testing.T) {
 	}
 }
 
+func TestExtensionsRollout(t *testing.T) {
+	previous := &model.ExtensionWrapper{
+		Name:      "ext",
+		Namespace: "test-ns",
+		Phase:     v1alpha1.FilterPhasePreAuthN,
+		FilterURL: "http://mec/previous",
+	}
+	newExtension := func(rollout model.RolloutWrapper) *model.ExtensionWrapper {
+		rollout.Previous = previous
+		return &model.ExtensionWrapper{
+			Name:      "ext",
+			Namespace: "test-ns",
+			Phase:     v1alpha1.FilterPhasePreAuthN,
+			FilterURL: "http://mec/new",
+			Rollout:   &rollout,
+		}
+	}
+
+	cases := []struct {
+		name        string
+		extension   *model.ExtensionWrapper
+		labels      map[string]string
+		expectedURL string
+	}{
+		{
+			name:        "canary proxy gets new module",
+			extension:   newExtension(model.RolloutWrapper{CanarySelector: map[string]string{"track": "canary"}}),
+			labels:      map[string]string{"app": "v1", "track": "canary"},
+			expectedURL: "http://mec/new",
+		},
+		{
+			name:        "other proxy keeps previous module",
+			extension:   newExtension(model.RolloutWrapper{CanarySelector: map[string]string{"track": "canary"}}),
+			labels:      map[string]string{"app": "v1"},
+			expectedURL: "http://mec/previous",
+		},
+		{
+			name:        "proxy in rollout percentage gets new module",
+			extension:   newExtension(model.RolloutWrapper{Percentage: 100}),
+			labels:      map[string]string{"app": "v1"},
+			expectedURL: "http://mec/new",
+		},
+		{
+			name:        "proxy outside of rollout percentage keeps previous module",
+			extension:   newExtension(model.RolloutWrapper{Percentage: 0}),
+			labels:      map[string]string{"app": "v1"},
+			expectedURL: "http://mec/previous",
+		},
+		{
+			name: "rolled back rollout serves previous module",
+			extension: newExtension(model.RolloutWrapper{
+				CanarySelector: map[string]string{"track": "canary"},
+				RolledBack:     true,
+			}),
+			labels:      map[string]string{"app": "v1", "track": "canary"},
+			expectedURL: "http://mec/previous",
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			push := &PushContext{
+				Mesh: &meshconfig.MeshConfig{
+					RootNamespace: "istio-system",
+				},
+				extensionsByNamespace: map[string][]*model.ExtensionWrapper{
+					"test-ns": {tt.extension},
+				},
+			}
+			proxy := &Proxy{
+				ID:              "pod.test-ns",
+				Metadata:        &NodeMetadata{IstioVersion: "1.4.0", Labels: tt.labels},
+				ConfigNamespace: "test-ns",
+			}
+			extensions := push.Extensions(proxy)[v1alpha1.FilterPhasePreAuthN]
+			if len(extensions) != 1 {
+				t.Fatalf("expected 1 extension but got %d", len(extensions))
+			}
+			if extensions[0].FilterURL != tt.expectedURL {
+				t.Errorf("expected module %s but got %s", tt.expectedURL, extensions[0].FilterURL)
+			}
+		})
+	}
+}
+
 func TestSidecarScope(t *testing.T) {
 	ps := NewPushContext()
 	env := &Environment{Watcher: mesh.NewFixedWatcher(&meshconfig.MeshConfig{RootNamespace: "istio-system"})}
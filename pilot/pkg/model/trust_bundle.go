@@ -0,0 +1,52 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+// TrustBundleProvider provides the trust bundles of the SPIFFE trust domains federated with the mesh.
+type TrustBundleProvider interface {
+	// FederatedTrustDomains returns the sorted list of federated trust domains with a known trust bundle.
+	FederatedTrustDomains() []string
+	// TrustBundle returns the PEM encoded root certificates of a federated trust domain, or nil if it is not known.
+	TrustBundle(trustDomain string) []byte
+	// MeshTrustBundle returns the PEM encoded root certificates of the mesh together with the root
+	// certificates of all federated trust domains.
+	MeshTrustBundle() []byte
+	// MeshCRL returns the PEM encoded certificate revocation list of the mesh CA together with the
+	// revocation lists of the federated trust domains, or nil if the mesh CA has not revoked any
+	// certificate.
+	MeshCRL() []byte
+}
+
+func (ps *PushContext) initTrustBundles(env *Environment) {
+	ps.TrustBundles = env.TrustBundles
+	if env.TrustBundles != nil {
+		ps.federatedTrustDomains = env.TrustBundles.FederatedTrustDomains()
+	}
+}
+
+// FederatedTrustDomains returns the sorted list of SPIFFE trust domains federated with the mesh.
+func (ps *PushContext) FederatedTrustDomains() []string {
+	return ps.federatedTrustDomains
+}
+
+// IsFederatedTrustDomain returns true if the trust domain is federated with the mesh.
+func (ps *PushContext) IsFederatedTrustDomain(trustDomain string) bool {
+	for _, td := range ps.federatedTrustDomains {
+		if td == trustDomain {
+			return true
+		}
+	}
+	return false
+}
@@ -15,14 +15,16 @@
 package model
 
 import (
-	"fmt"
+	"container/list"
+	"hash/fnv"
 	"sync"
+	"sync/atomic"
 
 	"github.com/golang/protobuf/ptypes/any"
-	"github.com/hashicorp/golang-lru/simplelru"
 
 	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/util/sets"
+	v3 "istio.io/istio/pilot/pkg/xds/v3"
 	"istio.io/pkg/monitoring"
 )
 
@@ -30,67 +32,66 @@ func init() {
 	monitoring.MustRegister(xdsCacheReads)
 	monitoring.MustRegister(xdsCacheEvictions)
 	monitoring.MustRegister(xdsCacheSize)
+	monitoring.MustRegister(xdsCacheBytes)
 }
 
 var (
+	resourceTag = monitoring.MustCreateLabel("resource")
+
 	xdsCacheReads = monitoring.NewSum(
 		"xds_cache_reads",
 		"Total number of xds cache xdsCacheReads.",
-		monitoring.WithLabels(typeTag),
+		monitoring.WithLabels(typeTag, resourceTag),
 	)
 
 	xdsCacheEvictions = monitoring.NewSum(
 		"xds_cache_evictions",
 		"Total number of xds cache evictions.",
+		monitoring.WithLabels(resourceTag),
 	)
 
 	xdsCacheSize = monitoring.NewGauge(
 		"xds_cache_size",
 		"Current size of xds cache",
+		monitoring.WithLabels(resourceTag),
 	)
 
-	xdsCacheHits   = xdsCacheReads.With(typeTag.Value("hit"))
-	xdsCacheMisses = xdsCacheReads.With(typeTag.Value("miss"))
+	xdsCacheBytes = monitoring.NewGauge(
+		"xds_cache_bytes",
+		"Current size in bytes of the resources held by the xds cache",
+		monitoring.WithLabels(resourceTag),
+	)
 )
 
-func hit() {
-	if features.EnableXDSCacheMetrics {
-		xdsCacheHits.Increment()
-	}
-}
-
-func miss() {
+func hit(typeURL string) {
 	if features.EnableXDSCacheMetrics {
-		xdsCacheMisses.Increment()
+		xdsCacheReads.With(typeTag.Value("hit"), resourceTag.Value(v3.GetShortType(typeURL))).Increment()
 	}
 }
 
-func evict(k interface{}, v interface{}) {
+func miss(typeURL string) {
 	if features.EnableXDSCacheMetrics {
-		xdsCacheEvictions.Increment()
+		xdsCacheReads.With(typeTag.Value("miss"), resourceTag.Value(v3.GetShortType(typeURL))).Increment()
 	}
 }
 
-func size(cs int) {
+func evict(typeURL string) {
 	if features.EnableXDSCacheMetrics {
-		xdsCacheSize.Record(float64(cs))
-	}
-}
-
-func indexConfig(configIndex map[ConfigKey]sets.Set, k string, entry XdsCacheEntry) {
-	for _, config := range entry.DependentConfigs() {
-		if configIndex[config] == nil {
-			configIndex[config] = sets.NewSet()
-		}
-		configIndex[config].Insert(k)
+		xdsCacheEvictions.With(resourceTag.Value(v3.GetShortType(typeURL))).Increment()
 	}
 }
 
 // XdsCacheEntry interface defines functions that should be implemented by
-// resources that can be cached.
+// resources that can be cached. Endpoints and secrets are cached. Clusters and
+// listeners are rebuilt on every push: their keys would have to cover the proxy
+// metadata and the EnvoyFilter patches applied to them, which is left to a
+// follow-up.
 type XdsCacheEntry interface {
 	// Key is the key to be used in cache.
 	Key() string
+	// TypeURL is the xDS type of the cached resource, for example v3.EndpointType.
+	// Cache usage is accounted per type.
+	TypeURL() string
 	// DependentConfigs is config items that this cache key is dependent on.
 	// Whenever these configs change, we should invalidate this cache entry.
 	DependentConfigs() []ConfigKey
@@ -115,161 +116,271 @@ type XdsCache interface {
 	Keys() []string
 }
 
-// inMemoryCache is a simple implementation of Cache that uses in memory map.
-type inMemoryCache struct {
-	store       map[string]*any.Any
-	configIndex map[ConfigKey]sets.Set
-	mu          sync.RWMutex
+// XdsCacheOptions configures the bounds and sharding of the cache returned by NewXdsCacheWithOptions.
+type XdsCacheOptions struct {
+	// MaxEntries bounds the number of entries in the cache. If <= 0, the number of entries is not bounded.
+	MaxEntries int
+	// MaxBytes bounds the total size of the cached resources. If <= 0, the size is not bounded.
+	MaxBytes int64
+	// Shards is the number of independently locked partitions of the cache. Entries are assigned to
+	// shards by key, and the bounds are split evenly across shards. Defaults to 1.
+	Shards int
+}
+
+// lruCache is a sharded cache. Each shard evicts its least recently used entries once it exceeds
+// its share of the configured bounds. Reads only take the read lock of their shard, so recency is
+// approximated: a read marks the entry as referenced, and a referenced entry that reaches the end
+// of the LRU list is moved back to the front instead of being evicted.
+type lruCache struct {
+	shards []*cacheShard
+	stats  sync.Map // type URL -> *cacheTypeStats
 }
 
-// NewXdsCache returns an instance of a cache.
+var _ XdsCache = &lruCache{}
+
+// NewXdsCache returns an instance of a cache, configured from the pilot features.
 func NewXdsCache() XdsCache {
-	if features.XDSCacheMaxSize <= 0 {
-		return &inMemoryCache{
-			store:       map[string]*any.Any{},
+	return NewXdsCacheWithOptions(XdsCacheOptions{
+		MaxEntries: features.XDSCacheMaxSize,
+		MaxBytes:   int64(features.XDSCacheMaxBytes),
+		Shards:     features.XDSCacheShards,
+	})
+}
+
+// NewXdsCacheWithOptions returns an instance of a cache with the given bounds and sharding.
+func NewXdsCacheWithOptions(opts XdsCacheOptions) XdsCache {
+	shards := opts.Shards
+	if shards <= 0 {
+		shards = 1
+	}
+	// Make sure every shard can hold at least one entry.
+	if opts.MaxEntries > 0 && shards > opts.MaxEntries {
+		shards = opts.MaxEntries
+	}
+	c := &lruCache{shards: make([]*cacheShard, shards)}
+	for i := range c.shards {
+		c.shards[i] = &cacheShard{
+			cache:       c,
+			entries:     map[string]*list.Element{},
+			lru:         list.New(),
 			configIndex: map[ConfigKey]sets.Set{},
 		}
+		if opts.MaxEntries > 0 {
+			c.shards[i].maxEntries = (opts.MaxEntries + shards - 1) / shards
+		}
+		if opts.MaxBytes > 0 {
+			c.shards[i].maxBytes = (opts.MaxBytes + int64(shards) - 1) / int64(shards)
+		}
 	}
-	return &lruCache{
-		store:       newLru(),
-		configIndex: map[ConfigKey]sets.Set{},
+	return c
+}
+
+func (c *lruCache) shard(key string) *cacheShard {
+	if len(c.shards) == 1 {
+		return c.shards[0]
 	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return c.shards[h.Sum32()%uint32(len(c.shards))]
 }
 
-func (c *inMemoryCache) Add(entry XdsCacheEntry, value *any.Any) {
+func (c *lruCache) Add(entry XdsCacheEntry, value *any.Any) {
 	if !entry.Cacheable() {
 		return
 	}
-	c.mu.Lock()
-	defer c.mu.Unlock()
 	k := entry.Key()
-	c.store[k] = value
-	indexConfig(c.configIndex, k, entry)
-	size(len(c.store))
+	c.shard(k).add(k, entry, value)
 }
 
-func (c *inMemoryCache) Get(entry XdsCacheEntry) (*any.Any, bool) {
+func (c *lruCache) Get(entry XdsCacheEntry) (*any.Any, bool) {
 	if !entry.Cacheable() {
 		return nil, false
 	}
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	k, f := c.store[entry.Key()]
-	if f {
-		hit()
-	} else {
-		miss()
+	val, ok := c.shard(entry.Key()).get(entry.Key())
+	if !ok {
+		miss(entry.TypeURL())
+		return nil, false
 	}
-	return k, f
+	hit(entry.TypeURL())
+	return val, true
 }
 
-func (c *inMemoryCache) Clear(configs map[ConfigKey]struct{}) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	for ckey := range configs {
-		referenced := c.configIndex[ckey]
-		delete(c.configIndex, ckey)
-		for keys := range referenced {
-			delete(c.store, keys)
-		}
+// Clear walks each shard independently, so a clear only contends with the pushes using the same shard.
+func (c *lruCache) Clear(configs map[ConfigKey]struct{}) {
+	for _, s := range c.shards {
+		s.clear(configs)
 	}
-	size(len(c.store))
 }
 
-func (c *inMemoryCache) ClearAll() {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.store = map[string]*any.Any{}
-	c.configIndex = map[ConfigKey]sets.Set{}
-	size(len(c.store))
+func (c *lruCache) ClearAll() {
+	for _, s := range c.shards {
+		s.clearAll()
+	}
 }
 
-func (c *inMemoryCache) Keys() []string {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+func (c *lruCache) Keys() []string {
 	keys := []string{}
-	for k := range c.store {
-		keys = append(keys, k)
+	for _, s := range c.shards {
+		keys = s.appendKeys(keys)
 	}
 	return keys
 }
 
-type lruCache struct {
-	store simplelru.LRUCache
+// cacheTypeStats tracks the number and size of the entries of one resource type across all shards.
+type cacheTypeStats struct {
+	entries int64
+	bytes   int64
+}
+
+func (c *lruCache) record(typeURL string, entries int64, bytes int64) {
+	v, ok := c.stats.Load(typeURL)
+	if !ok {
+		v, _ = c.stats.LoadOrStore(typeURL, &cacheTypeStats{})
+	}
+	st := v.(*cacheTypeStats)
+	n := atomic.AddInt64(&st.entries, entries)
+	b := atomic.AddInt64(&st.bytes, bytes)
+	if features.EnableXDSCacheMetrics {
+		resource := resourceTag.Value(v3.GetShortType(typeURL))
+		xdsCacheSize.With(resource).Record(float64(n))
+		xdsCacheBytes.With(resource).Record(float64(b))
+	}
+}
+
+type cacheEntry struct {
+	key        string
+	typeURL    string
+	value      *any.Any
+	size       int64
+	dependents []ConfigKey
+	// referenced is set by reads, and cleared when the entry is spared from eviction.
+	referenced int32
+}
+
+// cacheShard is a single LRU partition of the cache, guarded by its own lock.
+type cacheShard struct {
+	cache *lruCache
 
 	mu          sync.RWMutex
+	entries     map[string]*list.Element
+	lru         *list.List
 	configIndex map[ConfigKey]sets.Set
+	bytes       int64
+	maxEntries  int
+	maxBytes    int64
 }
 
-var _ XdsCache = &lruCache{}
-
-func newLru() simplelru.LRUCache {
-	l, err := simplelru.NewLRU(features.XDSCacheMaxSize, evict)
-	if err != nil {
-		panic(fmt.Errorf("invalid lru configuration: %v", err))
-	}
-	return l
+// entrySize estimates the memory held by a cached resource.
+func entrySize(key string, value *any.Any) int64 {
+	return int64(len(key) + len(value.GetTypeUrl()) + len(value.GetValue()))
 }
 
-func (l *lruCache) Add(entry XdsCacheEntry, value *any.Any) {
-	if !entry.Cacheable() {
+func (s *cacheShard) add(k string, entry XdsCacheEntry, value *any.Any) {
+	size := entrySize(k, value)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, f := s.entries[k]; f {
+		s.remove(e)
+	}
+	if s.maxBytes > 0 && size > s.maxBytes {
+		// The resource can never fit, do not flush the shard trying.
 		return
 	}
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	k := entry.Key()
-	l.store.Add(k, value)
-	indexConfig(l.configIndex, entry.Key(), entry)
-	size(l.store.Len())
+	ce := &cacheEntry{
+		key:        k,
+		typeURL:    entry.TypeURL(),
+		value:      value,
+		size:       size,
+		dependents: entry.DependentConfigs(),
+	}
+	s.entries[k] = s.lru.PushFront(ce)
+	s.bytes += size
+	for _, config := range ce.dependents {
+		if s.configIndex[config] == nil {
+			s.configIndex[config] = sets.NewSet()
+		}
+		s.configIndex[config].Insert(k)
+	}
+	s.cache.record(ce.typeURL, 1, size)
+	for (s.maxEntries > 0 && s.lru.Len() > s.maxEntries) || (s.maxBytes > 0 && s.bytes > s.maxBytes) {
+		oldest := s.lru.Back()
+		oldestEntry := oldest.Value.(*cacheEntry)
+		// Reads are excluded while the lock is held, so every entry is spared at most once.
+		if atomic.CompareAndSwapInt32(&oldestEntry.referenced, 1, 0) {
+			s.lru.MoveToFront(oldest)
+			continue
+		}
+		evict(oldestEntry.typeURL)
+		s.remove(oldest)
+	}
 }
 
-func (l *lruCache) Get(entry XdsCacheEntry) (*any.Any, bool) {
-	if !entry.Cacheable() {
+func (s *cacheShard) get(k string) (*any.Any, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, f := s.entries[k]
+	if !f {
 		return nil, false
 	}
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	val, ok := l.store.Get(entry.Key())
-	if !ok {
-		miss()
-		return nil, false
+	ce := e.Value.(*cacheEntry)
+	if s.maxEntries > 0 || s.maxBytes > 0 {
+		atomic.StoreInt32(&ce.referenced, 1)
 	}
-	hit()
-	return val.(*any.Any), true
+	return ce.value, true
 }
 
-func (l *lruCache) Clear(configs map[ConfigKey]struct{}) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
+func (s *cacheShard) clear(configs map[ConfigKey]struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	for ckey := range configs {
-		referenced := l.configIndex[ckey]
-		delete(l.configIndex, ckey)
+		referenced := s.configIndex[ckey]
+		delete(s.configIndex, ckey)
 		for key := range referenced {
-			l.store.Remove(key)
+			if e, f := s.entries[key]; f {
+				s.remove(e)
+			}
 		}
 	}
-	size(l.store.Len())
 }
 
-func (l *lruCache) ClearAll() {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	l.store.Purge()
-	l.configIndex = map[ConfigKey]sets.Set{}
-	size(l.store.Len())
+func (s *cacheShard) clearAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for e := s.lru.Front(); e != nil; e = e.Next() {
+		ce := e.Value.(*cacheEntry)
+		s.cache.record(ce.typeURL, -1, -ce.size)
+	}
+	s.entries = map[string]*list.Element{}
+	s.lru.Init()
+	s.configIndex = map[ConfigKey]sets.Set{}
+	s.bytes = 0
 }
 
-func (l *lruCache) Keys() []string {
-	l.mu.RLock()
-	defer l.mu.RUnlock()
-	iKeys := l.store.Keys()
-	keys := make([]string, 0, len(iKeys))
-	for _, ik := range iKeys {
-		keys = append(keys, ik.(string))
+func (s *cacheShard) appendKeys(keys []string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for e := s.lru.Front(); e != nil; e = e.Next() {
+		keys = append(keys, e.Value.(*cacheEntry).key)
 	}
 	return keys
 }
 
+// remove drops an entry and its config index references. The caller must hold the lock.
+func (s *cacheShard) remove(e *list.Element) {
+	ce := s.lru.Remove(e).(*cacheEntry)
+	delete(s.entries, ce.key)
+	s.bytes -= ce.size
+	for _, config := range ce.dependents {
+		if keys := s.configIndex[config]; keys != nil {
+			delete(keys, ce.key)
+			if len(keys) == 0 {
+				delete(s.configIndex, config)
+			}
+		}
+	}
+	s.cache.record(ce.typeURL, -1, -ce.size)
+}
+
 // DisabledCache is a cache that is always empty
 type DisabledCache struct{}
 
@@ -507,6 +507,7 @@ type buildClusterOpts struct {
 	clusterMode     ClusterMode
 	direction       model.TrafficDirection
 	proxy           *model.Proxy
+	push            *model.PushContext
 	meshExternal    bool
 	serviceMTLSMode model.MutualTLSMode
 }
@@ -930,6 +931,13 @@ func buildUpstreamClusterTLSContext(opts *buildClusterOpts, tls *networking.Clie
 					authn_model.SDSRootResourceName)),
 			},
 		}
+		// Peers from federated SPIFFE trust domains are validated with their trust bundles, served by istiod.
+		if metadataSDS.GetRootResourceName() == "" && opts.push != nil {
+			if name := authn_model.TrustBundleResourceName(tls.SubjectAltNames, opts.push.FederatedTrustDomains()); name != "" {
+				tlsContext.CommonTlsContext.GetCombinedValidationContext().ValidationContextSdsSecretConfig =
+					authn_model.ConstructTrustBundleSdsSecretConfig(name)
+			}
+		}
 		// Set default SNI of cluster name for istio_mutual if sni is not set.
 		if len(tls.Sni) == 0 {
 			tlsContext.Sni = c.Name
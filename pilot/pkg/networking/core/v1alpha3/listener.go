@@ -1131,7 +1131,7 @@ func (configgen *ConfigGeneratorImpl) buildSidecarOutboundHTTPListenerOptsForPor
 
 func (configgen *ConfigGeneratorImpl) buildSidecarOutboundThriftListenerOptsForPortOrUDS(listenerMapKey *string,
 	currentListenerEntry **outboundListenerEntry, listenerOpts *buildListenerOpts,
-	listenerMap map[string]*outboundListenerEntry, actualWildcard string) (bool, []*filterChainOpts) {
+	listenerMap map[string]*outboundListenerEntry, virtualServices []config.Config, actualWildcard string) (bool, []*filterChainOpts) {
 	// first identify the bind if its not set. Then construct the key
 	// used to lookup the listener in the conflict map.
 	if len(listenerOpts.bind) == 0 { // no user specified bind. Use 0.0.0.0:Port
@@ -1168,9 +1168,10 @@ func (configgen *ConfigGeneratorImpl) buildSidecarOutboundThriftListenerOptsForP
 	// No conflicts. Add a thrift filter chain option to the listenerOpts
 	clusterName := model.BuildSubsetKey(model.TrafficDirectionOutbound, "", listenerOpts.service.Hostname, listenerOpts.port.Port)
 	thriftOpts := &thriftListenerOpts{
-		protocol:    thrift.ProtocolType_AUTO_PROTOCOL,
-		transport:   thrift.TransportType_AUTO_TRANSPORT,
-		routeConfig: configgen.buildSidecarThriftRouteConfig(clusterName, listenerOpts.push.Mesh.ThriftConfig.RateLimitUrl),
+		protocol:  thrift.ProtocolType_AUTO_PROTOCOL,
+		transport: thrift.TransportType_AUTO_TRANSPORT,
+		routeConfig: configgen.buildSidecarOutboundThriftRouteConfig(listenerOpts.proxy, listenerOpts.push,
+			listenerOpts.service, listenerOpts.port, virtualServices, clusterName),
 	}
 
 	return true, []*filterChainOpts{{
@@ -1368,7 +1369,7 @@ func (configgen *ConfigGeneratorImpl) buildSidecarOutboundListenerForPortOrUDS(n
 			// Hard code the service IP for outbound thrift service listeners. HTTP services
 			// use RDS but the Thrift stack has no such dynamic configuration option.
 			if ret, opts = configgen.buildSidecarOutboundThriftListenerOptsForPortOrUDS(&listenerMapKey,
-				&currentListenerEntry, &listenerOpts, listenerMap, actualWildcard); !ret {
+				&currentListenerEntry, &listenerOpts, listenerMap, virtualServices, actualWildcard); !ret {
 				return
 			}
 
@@ -2063,18 +2064,19 @@ func buildCompleteFilterChain(mutable *istionetworking.MutableObjects, opts buil
 			if rlsURI := opts.push.Mesh.ThriftConfig.RateLimitUrl; rlsURI != "" &&
 				mutable.Listener.TrafficDirection == core.TrafficDirection_OUTBOUND &&
 				opts.service != nil &&
-				opts.service.Hostname != "" && false { // TODO: restore ability to add thrift quota
-				rateLimitConfig := buildThriftRatelimit(fmt.Sprint(opts.service.Hostname), opts.push.Mesh.ThriftConfig)
-				rateLimitFilter := &thrift.ThriftFilter{
-					Name: "envoy.filters.thrift.rate_limit",
-				}
-				routerFilter := &thrift.ThriftFilter{
-					Name:       "envoy.filters.thrift.router",
-					ConfigType: &thrift.ThriftFilter_TypedConfig{TypedConfig: util.MessageToAny(rateLimitConfig)},
-				}
-
-				thriftProxies[i].ThriftFilters = append(thriftProxies[i].ThriftFilters, rateLimitFilter, routerFilter)
+				opts.service.Hostname != "" {
+				// The rate limit filter applies the rate limits of the routes, the router must be the last filter.
+				if rateLimitConfig := buildThriftRatelimit(fmt.Sprint(opts.service.Hostname), opts.push.Mesh.ThriftConfig); rateLimitConfig != nil {
+					rateLimitFilter := &thrift.ThriftFilter{
+						Name:       "envoy.filters.thrift.rate_limit",
+						ConfigType: &thrift.ThriftFilter_TypedConfig{TypedConfig: util.MessageToAny(rateLimitConfig)},
+					}
+					routerFilter := &thrift.ThriftFilter{
+						Name: "envoy.filters.thrift.router",
+					}
 
+					thriftProxies[i].ThriftFilters = append(thriftProxies[i].ThriftFilters, rateLimitFilter, routerFilter)
+				}
 			}
 
 			filter := &listener.Filter{
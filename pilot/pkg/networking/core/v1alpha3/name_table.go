@@ -97,6 +97,17 @@ func (configgen *ConfigGeneratorImpl) BuildNameTable(node *model.Proxy, push *mo
 			Ips:      addressList,
 			Registry: svc.Attributes.ServiceRegistry,
 		}
+		for _, port := range svc.Ports {
+			// Only named ports can be looked up with SRV queries
+			if port.Name == "" {
+				continue
+			}
+			nameInfo.Ports = append(nameInfo.Ports, &nds.NameTable_NameInfo_Port{
+				Name:     port.Name,
+				Number:   uint32(port.Port),
+				Protocol: string(port.Protocol),
+			})
+		}
 		if svc.Attributes.ServiceRegistry == string(serviceregistry.Kubernetes) {
 			// The agent will take care of resolving a, a.ns, a.ns.svc, etc.
 			// No need to provide a DNS entry for each variant.
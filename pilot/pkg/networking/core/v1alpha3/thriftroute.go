@@ -17,35 +17,74 @@ package v1alpha3
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 
 	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
 	thrift "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/thrift_proxy/v3"
+	"github.com/golang/protobuf/ptypes/wrappers"
 
+	networking "istio.io/api/networking/v1alpha3"
 	"istio.io/istio/pilot/pkg/model"
+	istio_route "istio.io/istio/pilot/pkg/networking/core/v1alpha3/route"
+	"istio.io/istio/pkg/config"
+	"istio.io/istio/pkg/config/constants"
 	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/config/labels"
+	"istio.io/istio/pkg/config/validation"
 	"istio.io/pkg/log"
 )
 
-// buildDefaultThriftInboundRoute builds a default inbound route.
-func buildDefaultThriftRoute(clusterName, rateLimitClusterName string) *thrift.Route {
-	var rateLimits []*route.RateLimit
-	if rateLimitClusterName != "" {
-		rateLimits = []*route.RateLimit{
-			{
-				Actions: []*route.RateLimit_Action{
-					{
-						ActionSpecifier: &route.RateLimit_Action_SourceCluster_{
-							// Automatically populated
-							SourceCluster: &route.RateLimit_Action_SourceCluster{},
+// thriftMethodNameHeader is the pseudo header set by the Thrift proxy to the name of the called method.
+const thriftMethodNameHeader = ":method-name"
+
+// buildThriftRateLimits builds the rate limit configuration of a route, if a rate limit service is configured.
+// The first descriptor identifies the source and destination clusters. The called method is sent in a separate
+// descriptor along with the destination cluster, so that the rate limit service can apply limits per method
+// without changing the existing descriptor, which Envoy would not send for requests without a method name.
+func buildThriftRateLimits(rateLimitClusterName string) []*route.RateLimit {
+	if rateLimitClusterName == "" {
+		return nil
+	}
+	return []*route.RateLimit{
+		{
+			Actions: []*route.RateLimit_Action{
+				{
+					ActionSpecifier: &route.RateLimit_Action_SourceCluster_{
+						// Automatically populated
+						SourceCluster: &route.RateLimit_Action_SourceCluster{},
+					},
+				},
+				{
+					ActionSpecifier: &route.RateLimit_Action_DestinationCluster_{
+						DestinationCluster: &route.RateLimit_Action_DestinationCluster{},
+					},
+				},
+			},
+		},
+		{
+			Actions: []*route.RateLimit_Action{
+				{
+					ActionSpecifier: &route.RateLimit_Action_DestinationCluster_{
+						DestinationCluster: &route.RateLimit_Action_DestinationCluster{},
+					},
+				},
+				{
+					ActionSpecifier: &route.RateLimit_Action_RequestHeaders_{
+						RequestHeaders: &route.RateLimit_Action_RequestHeaders{
+							HeaderName:    thriftMethodNameHeader,
+							DescriptorKey: "method_name",
 						},
 					},
 				},
 			},
-		}
+		},
 	}
+}
 
+// buildDefaultThriftInboundRoute builds a default inbound route.
+func buildDefaultThriftRoute(clusterName, rateLimitClusterName string) *thrift.Route {
 	return &thrift.Route{
 		Match: &thrift.RouteMatch{
 			MatchSpecifier: &thrift.RouteMatch_MethodName{
@@ -54,13 +93,11 @@ func buildDefaultThriftRoute(clusterName, rateLimitClusterName string) *thrift.R
 		},
 
 		// Specifies a set of rate limit configurations that could be applied to the route.
-		// N.B. Thrift service or method name matching can be achieved by specifying a RequestHeaders
-		// action with the header name ":method-name".
 		Route: &thrift.RouteAction{
 			ClusterSpecifier: &thrift.RouteAction_Cluster{
 				Cluster: clusterName,
 			},
-			RateLimits: rateLimits,
+			RateLimits: buildThriftRateLimits(rateLimitClusterName),
 		},
 	}
 }
@@ -84,6 +121,139 @@ func (configgen *ConfigGeneratorImpl) buildSidecarThriftRouteConfig(clusterName,
 	}
 }
 
+// Builds the route config of an outbound listener. The http routes of the virtual services of the service
+// that are annotated with validation.ThriftRoutesAnnotation are translated to Thrift routes, followed by the
+// default route to the service. The http routes that can't be applied to Thrift, see
+// validation.ValidateThriftRoute, are rejected on admission and skipped here.
+func (configgen *ConfigGeneratorImpl) buildSidecarOutboundThriftRouteConfig(node *model.Proxy, push *model.PushContext,
+	service *model.Service, listenPort *model.Port, virtualServices []config.Config, clusterName string) *thrift.RouteConfiguration {
+
+	rlsClusterName, err := thriftRLSClusterNameFromAuthority(push.Mesh.ThriftConfig.RateLimitUrl)
+	if err != nil {
+		rlsClusterName = ""
+	}
+
+	gateways := map[string]bool{constants.IstioMeshGateway: true}
+	proxyLabels := labels.Collection{node.Metadata.Labels}
+	var routes []*thrift.Route
+	for _, cfg := range getConfigsForHost(service.Hostname, virtualServices) {
+		if !validation.HasThriftRoutes(cfg.Meta) {
+			continue
+		}
+		virtualService := cfg.Spec.(*networking.VirtualService)
+		for _, http := range virtualService.Http {
+			if err := validation.ValidateThriftRoute(http); err != nil {
+				log.Warnf("skipping route of virtual service %s/%s for thrift service %s: %v",
+					cfg.Namespace, cfg.Name, service.Hostname, err)
+				continue
+			}
+			action := buildThriftRouteAction(node, push, http.Route, listenPort, rlsClusterName)
+			if len(http.Match) == 0 {
+				routes = append(routes, &thrift.Route{Match: translateThriftRouteMatch(nil, node), Route: action})
+				continue
+			}
+			for _, match := range http.Match {
+				if matchThrift(match, proxyLabels, gateways, listenPort.Port, node.Metadata.Namespace) {
+					routes = append(routes, &thrift.Route{Match: translateThriftRouteMatch(match, node), Route: action})
+				}
+			}
+		}
+	}
+	routes = append(routes, buildDefaultThriftRoute(clusterName, rlsClusterName))
+
+	return &thrift.RouteConfiguration{
+		Name:   clusterName,
+		Routes: routes,
+	}
+}
+
+// matchThrift checks if a http match of a virtual service applies to the proxy, like matchTCP.
+func matchThrift(match *networking.HTTPMatchRequest, proxyLabels labels.Collection, gateways map[string]bool,
+	port int, proxyNamespace string) bool {
+	if match == nil {
+		return true
+	}
+
+	gatewayMatch := len(match.Gateways) == 0
+	for _, gateway := range match.Gateways {
+		gatewayMatch = gatewayMatch || gateways[gateway]
+	}
+
+	labelMatch := proxyLabels.IsSupersetOf(match.SourceLabels)
+
+	portMatch := match.Port == 0 || match.Port == uint32(port)
+
+	nsMatch := match.SourceNamespace == "" || match.SourceNamespace == proxyNamespace
+
+	return gatewayMatch && labelMatch && portMatch && nsMatch
+}
+
+// translateThriftRouteMatch translates a http match to a Thrift match. An exact method match selects the
+// method, a prefix method match selects the service of multiplexed protocols.
+func translateThriftRouteMatch(in *networking.HTTPMatchRequest, node *model.Proxy) *thrift.RouteMatch {
+	out := &thrift.RouteMatch{
+		MatchSpecifier: &thrift.RouteMatch_MethodName{
+			MethodName: "",
+		},
+	}
+	if in == nil {
+		return out
+	}
+
+	switch m := in.Method.GetMatchType().(type) {
+	case *networking.StringMatch_Exact:
+		out.MatchSpecifier = &thrift.RouteMatch_MethodName{MethodName: m.Exact}
+	case *networking.StringMatch_Prefix:
+		out.MatchSpecifier = &thrift.RouteMatch_ServiceName{ServiceName: m.Prefix}
+	}
+
+	for name, stringMatch := range in.Headers {
+		out.Headers = append(out.Headers, istio_route.TranslateHeaderMatch(name, stringMatch, node))
+	}
+	// sort the headers, as map iteration order is random
+	sort.Slice(out.Headers, func(i, j int) bool {
+		return out.Headers[i].Name < out.Headers[j].Name
+	})
+	return out
+}
+
+// buildThriftRouteAction routes to a single destination, or splits the traffic between weighted destinations.
+func buildThriftRouteAction(node *model.Proxy, push *model.PushContext, destinations []*networking.HTTPRouteDestination,
+	listenPort *model.Port, rateLimitClusterName string) *thrift.RouteAction {
+	out := &thrift.RouteAction{
+		RateLimits: buildThriftRateLimits(rateLimitClusterName),
+	}
+
+	clusterName := func(destination *networking.Destination) string {
+		service := push.ServiceForHostname(node, host.Name(destination.Host))
+		return istio_route.GetDestinationCluster(destination, service, listenPort.Port)
+	}
+
+	if len(destinations) == 1 {
+		out.ClusterSpecifier = &thrift.RouteAction_Cluster{
+			Cluster: clusterName(destinations[0].Destination),
+		}
+		return out
+	}
+
+	weighted := make([]*thrift.WeightedCluster_ClusterWeight, 0, len(destinations))
+	for _, dst := range destinations {
+		if dst.Weight == 0 {
+			continue
+		}
+		weighted = append(weighted, &thrift.WeightedCluster_ClusterWeight{
+			Name:   clusterName(dst.Destination),
+			Weight: &wrappers.UInt32Value{Value: uint32(dst.Weight)},
+		})
+	}
+	out.ClusterSpecifier = &thrift.RouteAction_WeightedClusters{
+		WeightedClusters: &thrift.WeightedCluster{
+			Clusters: weighted,
+		},
+	}
+	return out
+}
+
 // Build a cluster name from an authority (host[:port]) string. If an error is
 // encountered, an empty string is returned as the cluster name.
 func thriftRLSClusterNameFromAuthority(authority string) (string, error) {
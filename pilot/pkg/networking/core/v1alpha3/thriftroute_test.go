@@ -14,7 +14,19 @@
 
 package v1alpha3
 
-import "testing"
+import (
+	"testing"
+
+	thrift "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/thrift_proxy/v3"
+
+	networking "istio.io/api/networking/v1alpha3"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config"
+	"istio.io/istio/pkg/config/mesh"
+	"istio.io/istio/pkg/config/protocol"
+	"istio.io/istio/pkg/config/schema/gvk"
+	"istio.io/istio/pkg/config/validation"
+)
 
 func TestGetClusterNameFromURL(t *testing.T) {
 	cluster, err := thriftRLSClusterNameFromAuthority("")
@@ -29,3 +41,112 @@ func TestGetClusterNameFromURL(t *testing.T) {
 		t.Fatalf("Should return correct cluster name (got %v)", cluster)
 	}
 }
+
+func TestBuildSidecarOutboundThriftRouteConfig(t *testing.T) {
+	service := &model.Service{
+		Hostname: "thrift.default.svc.cluster.local",
+		Ports:    model.PortList{{Name: "thrift", Port: 9090, Protocol: protocol.Thrift}},
+	}
+	port := service.Ports[0]
+	destination := func(subset string, weight int32) *networking.HTTPRouteDestination {
+		return &networking.HTTPRouteDestination{
+			Destination: &networking.Destination{Host: "thrift.default.svc.cluster.local", Subset: subset},
+			Weight:      weight,
+		}
+	}
+	virtualService := config.Config{
+		Meta: config.Meta{
+			GroupVersionKind: gvk.VirtualService, Name: "thrift", Namespace: "default",
+			Annotations: map[string]string{validation.ThriftRoutesAnnotation: "true"},
+		},
+		Spec: &networking.VirtualService{
+			Hosts: []string{"thrift.default.svc.cluster.local"},
+			Http: []*networking.HTTPRoute{
+				{
+					Match: []*networking.HTTPMatchRequest{{
+						Method: &networking.StringMatch{MatchType: &networking.StringMatch_Exact{Exact: "ping"}},
+						Headers: map[string]*networking.StringMatch{
+							"x-canary": {MatchType: &networking.StringMatch_Exact{Exact: "true"}},
+						},
+					}},
+					Route: []*networking.HTTPRouteDestination{destination("v2", 0)},
+				},
+				{
+					// retries are not supported by Thrift, the route is skipped
+					Match: []*networking.HTTPMatchRequest{{
+						Method: &networking.StringMatch{MatchType: &networking.StringMatch_Exact{Exact: "skipped"}},
+					}},
+					Route:   []*networking.HTTPRouteDestination{destination("v2", 0)},
+					Retries: &networking.HTTPRetry{Attempts: 3},
+				},
+				{
+					Match: []*networking.HTTPMatchRequest{
+						{
+							Method: &networking.StringMatch{MatchType: &networking.StringMatch_Prefix{Prefix: "Other:"}},
+						},
+						{
+							// applies to another port
+							Method: &networking.StringMatch{MatchType: &networking.StringMatch_Prefix{Prefix: "Unmatched:"}},
+							Port:   9091,
+						},
+					},
+					Route: []*networking.HTTPRouteDestination{destination("v1", 80), destination("v2", 20)},
+				},
+			},
+		},
+	}
+
+	// the http routes of virtual services without the annotation do not apply to Thrift
+	httpVirtualService := config.Config{
+		Meta: config.Meta{GroupVersionKind: gvk.VirtualService, Name: "http", Namespace: "default"},
+		Spec: &networking.VirtualService{
+			Hosts: []string{"thrift.default.svc.cluster.local"},
+			Http:  []*networking.HTTPRoute{{Route: []*networking.HTTPRouteDestination{destination("v3", 0)}}},
+		},
+	}
+
+	m := mesh.DefaultMeshConfig()
+	m.ThriftConfig.RateLimitUrl = "ratelimit.svc.cluster.local:8081"
+	push := model.NewPushContext()
+	push.Mesh = &m
+	configgen := NewConfigGenerator(nil, &model.DisabledCache{})
+	clusterName := "outbound|9090||thrift.default.svc.cluster.local"
+	rc := configgen.buildSidecarOutboundThriftRouteConfig(getProxy(), push, service, port,
+		[]config.Config{virtualService, httpVirtualService}, clusterName)
+
+	if len(rc.Routes) != 3 {
+		t.Fatalf("expected 3 routes, got %v", rc.Routes)
+	}
+
+	ping := rc.Routes[0]
+	if ping.Match.GetMethodName() != "ping" {
+		t.Errorf("expected a match on the ping method, got %v", ping.Match)
+	}
+	if h := ping.Match.Headers; len(h) != 1 || h[0].Name != "x-canary" || h[0].GetExactMatch() != "true" {
+		t.Errorf("unexpected header match %v", h)
+	}
+	if c := ping.Route.GetCluster(); c != "outbound|9090|v2|thrift.default.svc.cluster.local" {
+		t.Errorf("unexpected cluster %s", c)
+	}
+	if len(ping.Route.RateLimits) != 2 || len(ping.Route.RateLimits[0].Actions) != 2 ||
+		len(ping.Route.RateLimits[1].Actions) != 2 ||
+		ping.Route.RateLimits[1].Actions[1].GetRequestHeaders().GetHeaderName() != thriftMethodNameHeader {
+		t.Errorf("expected rate limits per method, got %v", ping.Route.RateLimits)
+	}
+
+	other := rc.Routes[1]
+	if other.Match.GetServiceName() != "Other:" {
+		t.Errorf("expected a match on the Other service, got %v", other.Match)
+	}
+	weighted := other.Route.GetWeightedClusters().GetClusters()
+	if len(weighted) != 2 || weighted[0].Name != "outbound|9090|v1|thrift.default.svc.cluster.local" ||
+		weighted[0].Weight.GetValue() != 80 || weighted[1].Weight.GetValue() != 20 {
+		t.Errorf("unexpected weighted clusters %v", weighted)
+	}
+
+	def := rc.Routes[2]
+	if _, ok := def.Match.MatchSpecifier.(*thrift.RouteMatch_MethodName); !ok || def.Match.GetMethodName() != "" ||
+		def.Route.GetCluster() != clusterName {
+		t.Errorf("expected the default route last, got %v", def)
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcgen
+
+import (
+	"net"
+	"strconv"
+
+	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	"github.com/golang/protobuf/ptypes/wrappers"
+
+	networking "istio.io/api/networking/v1alpha3"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/core/v1alpha3"
+	"istio.io/istio/pilot/pkg/networking/util"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/pkg/log"
+)
+
+// defaultRingSize is the minimum ring size of consistent hash load balancing, if not set.
+const defaultRingSize = 1024
+
+// BuildClusters handles a gRPC CDS request, used with the 'ApiListener' style of requests.
+// The main difference is that the request includes Resources. Clusters are named either
+// outbound|port|subset|hostname, as referred to by the routes, or hostname:port.
+func (g *GrpcConfigGenerator) BuildClusters(node *model.Proxy, push *model.PushContext, names []string) model.Resources {
+	resp := model.Resources{}
+	for _, n := range names {
+		if c := buildCluster(node, push, n); c != nil {
+			resp = append(resp, util.MessageToAny(c))
+		}
+	}
+	return resp
+}
+
+// buildCluster builds an EDS cluster. gRPC doesn't currently support most of the cluster APIs -
+// returning just the expected EDS result and the load balancing policy. Since the code is
+// relatively strict - we'll add info as needed.
+func buildCluster(node *model.Proxy, push *model.PushContext, name string) *cluster.Cluster {
+	_, subset, hostname, port := model.ParseSubsetKey(name)
+	if hostname == "" {
+		hn, portn, err := net.SplitHostPort(name)
+		if err != nil {
+			log.Warnf("Failed to parse cluster %s: %v", name, err)
+			return nil
+		}
+		port, err = strconv.Atoi(portn)
+		if err != nil {
+			log.Warnf("Failed to parse port of cluster %s: %v", name, err)
+			return nil
+		}
+		hostname = host.Name(hn)
+	}
+	c := &cluster.Cluster{
+		Name:                 name,
+		ClusterDiscoveryType: &cluster.Cluster_Type{Type: cluster.Cluster_EDS},
+		EdsClusterConfig: &cluster.Cluster_EdsClusterConfig{
+			ServiceName: model.BuildSubsetKey(model.TrafficDirectionOutbound, subset, hostname, port),
+			EdsConfig: &core.ConfigSource{
+				ConfigSourceSpecifier: &core.ConfigSource_Ads{
+					Ads: &core.AggregatedConfigSource{},
+				},
+			},
+		},
+		LbPolicy: cluster.Cluster_ROUND_ROBIN,
+		// Endpoints are weighted by locality in EDS
+		CommonLbConfig: &cluster.Cluster_CommonLbConfig{
+			LocalityConfigSpecifier: &cluster.Cluster_CommonLbConfig_LocalityWeightedLbConfig_{
+				LocalityWeightedLbConfig: &cluster.Cluster_CommonLbConfig_LocalityWeightedLbConfig{},
+			},
+		},
+	}
+	policy := trafficPolicy(node, push, hostname, subset, port)
+	applyLoadBalancer(c, policy.GetLoadBalancer())
+	applyTLS(c, node, push, hostname, port, policy.GetTls())
+	return c
+}
+
+// trafficPolicy returns the traffic policy of the destination rule of a service, merged with
+// the traffic policy of the subset.
+func trafficPolicy(node *model.Proxy, push *model.PushContext, hostname host.Name, subset string, port int) *networking.TrafficPolicy {
+	svc := push.ServiceForHostname(node, hostname)
+	if svc == nil {
+		return nil
+	}
+	cfg := push.DestinationRule(node, svc)
+	if cfg == nil {
+		return nil
+	}
+	dr := cfg.Spec.(*networking.DestinationRule)
+	svcPort, _ := svc.Ports.GetByPort(port)
+	policy := v1alpha3.MergeTrafficPolicy(nil, dr.TrafficPolicy, svcPort)
+	if subset == "" {
+		return policy
+	}
+	for _, s := range dr.Subsets {
+		if s.Name == subset {
+			return v1alpha3.MergeTrafficPolicy(policy, s.TrafficPolicy, svcPort)
+		}
+	}
+	return policy
+}
+
+// applyLoadBalancer sets the load balancing policy of a cluster. gRPC implements round robin and
+// ring hash load balancing, other policies fall back to round robin.
+func applyLoadBalancer(c *cluster.Cluster, lb *networking.LoadBalancerSettings) {
+	if lb == nil {
+		return
+	}
+	if consistentHash := lb.GetConsistentHash(); consistentHash != nil {
+		minRingSize := uint64(defaultRingSize)
+		if consistentHash.MinimumRingSize != 0 {
+			minRingSize = consistentHash.MinimumRingSize
+		}
+		c.LbPolicy = cluster.Cluster_RING_HASH
+		c.LbConfig = &cluster.Cluster_RingHashLbConfig_{
+			RingHashLbConfig: &cluster.Cluster_RingHashLbConfig{
+				MinimumRingSize: &wrappers.UInt64Value{Value: minRingSize},
+			},
+		}
+		return
+	}
+	switch lb.GetSimple() {
+	case networking.LoadBalancerSettings_LEAST_CONN, networking.LoadBalancerSettings_RANDOM,
+		networking.LoadBalancerSettings_PASSTHROUGH:
+		log.Debugf("load balancer %v of cluster %s is not supported by gRPC, using round robin", lb.GetSimple(), c.Name)
+	}
+}
@@ -15,35 +15,8 @@
 package grpcgen
 
 import (
-	"net"
-	"strconv"
-	"strings"
-
-	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
-	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
-	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
-	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
-	hcm "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
-	"github.com/golang/protobuf/ptypes/any"
-
 	"istio.io/istio/pilot/pkg/model"
-	"istio.io/istio/pilot/pkg/networking/util"
 	v3 "istio.io/istio/pilot/pkg/xds/v3"
-	"istio.io/istio/pkg/config/host"
-	"istio.io/pkg/log"
-)
-
-const (
-	typePrefix = "type.googleapis.com/envoy.api.v2."
-
-	// Constants used for XDS
-
-	// ClusterType is used for cluster discovery. Typically first request received
-	ClusterType = typePrefix + "Cluster"
-	// ListenerType is sent after clusters and endpoints.
-	ListenerType = typePrefix + "Listener"
-	// RouteType is sent after listeners.
-	RouteType = typePrefix + "RouteConfiguration"
 )
 
 // Support generation of 'ApiListener' LDS responses, used for native support of gRPC.
@@ -56,8 +29,8 @@ const (
 // use this XDS mode to get load balancing info from Istio, including MC/VM/etc.
 
 // The corresponding RDS response is also generated - currently gRPC has special differences
-// and can't understand normal Istio RDS - in particular expects "" instead of "/" as
-// default prefix, and is expects just the route for one host.
+// and can't understand normal Istio RDS - in particular it expects just the route for one host,
+// and weighted clusters to set their total weight.
 // handleAck will detect if the message is an ACK or NACK, and update/log/count
 // using the generic structures. "Classical" CDS/LDS/RDS/EDS use separate logic -
 // this is used for the API-based LDS and generic messages.
@@ -66,173 +39,14 @@ type GrpcConfigGenerator struct {
 }
 
 func (g *GrpcConfigGenerator) Generate(proxy *model.Proxy, push *model.PushContext, w *model.WatchedResource, req *model.PushRequest) model.Resources {
-	// TODO: Eventhough grpc-go supports v3 at the transport layer, it still sends v2 types
-	// in the requests. Fix this when it starts sending v3 types.
 	switch w.TypeUrl {
-	case ListenerType, v3.ListenerType:
+	case v3.ListenerType:
 		return g.BuildListeners(proxy, push, w.ResourceNames)
-	case ClusterType, v3.ClusterType:
+	case v3.ClusterType:
 		return g.BuildClusters(proxy, push, w.ResourceNames)
-	case RouteType, v3.RouteType:
+	case v3.RouteType:
 		return g.BuildHTTPRoutes(proxy, push, w.ResourceNames)
 	}
 
 	return nil
 }
-
-// handleLDSApiType handles a LDS request, returning listeners of ApiListener type.
-// The request may include a list of resource names, using the full_hostname[:port] format to select only
-// specific services.
-func (g *GrpcConfigGenerator) BuildListeners(node *model.Proxy, push *model.PushContext, names []string) []*any.Any {
-	resp := []*any.Any{}
-
-	filter := map[string]bool{}
-	for _, name := range names {
-		if strings.Contains(name, ":") {
-			n, _, err := net.SplitHostPort(name)
-			if err == nil {
-				name = n
-			}
-		}
-		filter[name] = true
-	}
-
-	for _, el := range node.SidecarScope.EgressListeners {
-		for _, sv := range el.Services() {
-			shost := string(sv.Hostname)
-			if len(filter) > 0 {
-				// DiscReq has a filter - only return services that match
-				if !filter[shost] {
-					continue
-				}
-			}
-			for _, p := range sv.Ports {
-				hp := net.JoinHostPort(shost, strconv.Itoa(p.Port))
-				ll := &listener.Listener{
-					Name: hp,
-				}
-
-				ll.Address = &core.Address{
-					Address: &core.Address_SocketAddress{
-						SocketAddress: &core.SocketAddress{
-							Address: sv.Address,
-							PortSpecifier: &core.SocketAddress_PortValue{
-								PortValue: uint32(p.Port),
-							},
-						},
-					},
-				}
-				hcm := &hcm.HttpConnectionManager{
-					RouteSpecifier: &hcm.HttpConnectionManager_Rds{
-						Rds: &hcm.Rds{
-							ConfigSource: &core.ConfigSource{
-								ConfigSourceSpecifier: &core.ConfigSource_Ads{
-									Ads: &core.AggregatedConfigSource{},
-								},
-							},
-							RouteConfigName: hp,
-						},
-					},
-				}
-				hcmAny := util.MessageToAny(hcm)
-				// TODO: grpc-go still expects the v2 Http connection manager TypeUrl. Fix this when it is changed.
-				// https://github.com/grpc/grpc-go/blob/master/xds/internal/version/version.go#L48.
-				hcmAny.TypeUrl = "type.googleapis.com/envoy.config.filter.network.http_connection_manager.v2.HttpConnectionManager"
-				// TODO: for TCP listeners don't generate RDS, but some indication of cluster name.
-				ll.ApiListener = &listener.ApiListener{
-					ApiListener: hcmAny,
-				}
-				resp = append(resp, util.MessageToAny(ll))
-			}
-		}
-	}
-
-	return resp
-}
-
-// Handle a gRPC CDS request, used with the 'ApiListener' style of requests.
-// The main difference is that the request includes Resources.
-func (g *GrpcConfigGenerator) BuildClusters(node *model.Proxy, push *model.PushContext, names []string) []*any.Any {
-	resp := []*any.Any{}
-	// gRPC doesn't currently support any of the APIs - returning just the expected EDS result.
-	// Since the code is relatively strict - we'll add info as needed.
-	for _, n := range names {
-		hn, portn, err := net.SplitHostPort(n)
-		if err != nil {
-			log.Warna("Failed to parse ", n, " ", err)
-			continue
-		}
-		rc := &cluster.Cluster{
-			Name:                 n,
-			ClusterDiscoveryType: &cluster.Cluster_Type{Type: cluster.Cluster_EDS},
-			EdsClusterConfig: &cluster.Cluster_EdsClusterConfig{
-				ServiceName: "outbound|" + portn + "||" + hn,
-				EdsConfig: &core.ConfigSource{
-					ConfigSourceSpecifier: &core.ConfigSource_Ads{
-						Ads: &core.AggregatedConfigSource{},
-					},
-				},
-			},
-		}
-		resp = append(resp, util.MessageToAny(rc))
-	}
-	return resp
-}
-
-// handleSplitRDS supports per-VIP routes, as used by GRPC.
-// This mode is indicated by using names containing full host:port instead of just port.
-// Returns true of the request is of this type.
-func (g *GrpcConfigGenerator) BuildHTTPRoutes(node *model.Proxy, push *model.PushContext, routeNames []string) []*any.Any {
-	resp := []*any.Any{}
-
-	// Currently this mode is only used by GRPC, to extract Cluster for the default
-	// route.
-	for _, n := range routeNames {
-		hn, portn, err := net.SplitHostPort(n)
-		if err != nil {
-			log.Warna("Failed to parse ", n, " ", err)
-			continue
-		}
-		port, err := strconv.Atoi(portn)
-		if err != nil {
-			log.Warna("Failed to parse port ", n, " ", err)
-			continue
-		}
-		el := node.SidecarScope.GetEgressListenerForRDS(port, "")
-		// TODO: use VirtualServices instead !
-		// Currently gRPC doesn't support matching the path.
-		svc := el.Services()
-		for _, s := range svc {
-			if s.Hostname.Matches(host.Name(hn)) {
-				// Only generate the required route for grpc. Will need to generate more
-				// as GRPC adds more features.
-				rc := &route.RouteConfiguration{
-					Name: n,
-					VirtualHosts: []*route.VirtualHost{
-						{
-							Name:    hn,
-							Domains: []string{hn, n},
-
-							Routes: []*route.Route{
-								{
-									Match: &route.RouteMatch{
-										PathSpecifier: &route.RouteMatch_Prefix{Prefix: ""},
-									},
-									Action: &route.Route_Route{
-										Route: &route.RouteAction{
-											ClusterSpecifier: &route.RouteAction_Cluster{
-												Cluster: n,
-											},
-										},
-									},
-								},
-							},
-						},
-					},
-				}
-				resp = append(resp, util.MessageToAny(rc))
-			}
-		}
-	}
-	return resp
-}
@@ -16,11 +16,22 @@ package grpcgen_test
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"testing"
 	"time"
 
+	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	tls "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
 	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+	"github.com/gogo/protobuf/types"
+	"github.com/golang/protobuf/ptypes"
+	structpb "github.com/golang/protobuf/ptypes/struct"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/balancer"
 	"google.golang.org/grpc/resolver"
@@ -30,10 +41,15 @@ import (
 	_ "google.golang.org/grpc/xds"
 
 	networking "istio.io/api/networking/v1alpha3"
+	security "istio.io/api/security/v1beta1"
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/xds"
+	v3 "istio.io/istio/pilot/pkg/xds/v3"
 	"istio.io/istio/pkg/config"
+	"istio.io/istio/pkg/config/protocol"
 	"istio.io/istio/pkg/config/schema/collections"
+	"istio.io/istio/pkg/config/schema/gvk"
+	"istio.io/istio/pkg/istio-agent/grpcxds"
 )
 
 var (
@@ -47,7 +63,39 @@ func TestGRPC(t *testing.T) {
 	ds := xds.NewXDS()
 
 	sd := ds.DiscoveryServer.MemRegistry
-	sd.AddHTTPService("fortio1.fortio.svc.cluster.local", "10.10.10.1", 8081)
+	sd.AddService("fortio1.fortio.svc.cluster.local", &model.Service{
+		Hostname: "fortio1.fortio.svc.cluster.local",
+		Address:  "10.10.10.1",
+		Ports: model.PortList{
+			{Name: "http-main", Port: 8081, Protocol: protocol.HTTP},
+		},
+		Attributes: model.ServiceAttributes{Namespace: "fortio"},
+	})
+	sd.SetEndpoints("fortio1.fortio.svc.cluster.local", "fortio", []*model.IstioEndpoint{
+		{
+			Address:         "127.0.0.1",
+			EndpointPort:    uint32(8081),
+			ServicePortName: "http-main",
+			Labels:          map[string]string{"version": "v1"},
+			Locality:        model.Locality{Label: "region1/zone1/subzone1"},
+		},
+		{
+			Address:         "127.0.0.2",
+			EndpointPort:    uint32(8081),
+			ServicePortName: "http-main",
+			Labels:          map[string]string{"version": "v2"},
+			Locality:        model.Locality{Label: "region2/zone2/subzone2"},
+		},
+	})
+
+	sd.AddService("echo.plaintext.svc.cluster.local", &model.Service{
+		Hostname: "echo.plaintext.svc.cluster.local",
+		Address:  "10.10.10.3",
+		Ports: model.PortList{
+			{Name: "http-main", Port: 8080, Protocol: protocol.HTTP},
+		},
+		Attributes: model.ServiceAttributes{Namespace: "plaintext"},
+	})
 
 	sd.AddHTTPService("istiod.istio-system.svc.cluster.local", "10.10.10.2", 14057)
 	sd.SetEndpoints("istiod.istio-system.svc.cluster.local", "", []*model.IstioEndpoint{
@@ -88,6 +136,104 @@ func TestGRPC(t *testing.T) {
 		},
 	})
 
+	store.Create(config.Config{
+		Meta: config.Meta{
+			GroupVersionKind: gvk.VirtualService,
+			Name:             "fortio1",
+			Namespace:        "fortio",
+		},
+		Spec: &networking.VirtualService{
+			Hosts: []string{"fortio1.fortio.svc.cluster.local"},
+			Http: []*networking.HTTPRoute{
+				{
+					Match: []*networking.HTTPMatchRequest{{
+						Headers: map[string]*networking.StringMatch{
+							"x-canary": {MatchType: &networking.StringMatch_Exact{Exact: "true"}},
+						},
+					}},
+					Route: []*networking.HTTPRouteDestination{{
+						Destination: &networking.Destination{Host: "fortio1.fortio.svc.cluster.local", Subset: "v2"},
+					}},
+					Timeout: &types.Duration{Seconds: 5},
+					Retries: &networking.HTTPRetry{Attempts: 3, PerTryTimeout: &types.Duration{Seconds: 1}},
+					Fault: &networking.HTTPFaultInjection{
+						Abort: &networking.HTTPFaultInjection_Abort{
+							ErrorType:  &networking.HTTPFaultInjection_Abort_HttpStatus{HttpStatus: 503},
+							Percentage: &networking.Percent{Value: 10},
+						},
+					},
+				},
+				{
+					Route: []*networking.HTTPRouteDestination{
+						{
+							Destination: &networking.Destination{Host: "fortio1.fortio.svc.cluster.local", Subset: "v1"},
+							Weight:      80,
+						},
+						{
+							Destination: &networking.Destination{Host: "fortio1.fortio.svc.cluster.local", Subset: "v2"},
+							Weight:      20,
+						},
+					},
+				},
+			},
+		},
+	})
+	store.Create(config.Config{
+		Meta: config.Meta{
+			GroupVersionKind: gvk.DestinationRule,
+			Name:             "fortio1",
+			Namespace:        "fortio",
+		},
+		Spec: &networking.DestinationRule{
+			Host: "fortio1.fortio.svc.cluster.local",
+			TrafficPolicy: &networking.TrafficPolicy{
+				LoadBalancer: &networking.LoadBalancerSettings{
+					LbPolicy: &networking.LoadBalancerSettings_Simple{Simple: networking.LoadBalancerSettings_ROUND_ROBIN},
+				},
+				Tls: &networking.ClientTLSSettings{
+					Mode:            networking.ClientTLSSettings_ISTIO_MUTUAL,
+					SubjectAltNames: []string{"spiffe://cluster.local/ns/fortio/sa/fortio"},
+				},
+			},
+			Subsets: []*networking.Subset{
+				{Name: "v1", Labels: map[string]string{"version": "v1"}},
+				{
+					Name:   "v2",
+					Labels: map[string]string{"version": "v2"},
+					TrafficPolicy: &networking.TrafficPolicy{
+						LoadBalancer: &networking.LoadBalancerSettings{
+							LbPolicy: &networking.LoadBalancerSettings_ConsistentHash{
+								ConsistentHash: &networking.LoadBalancerSettings_ConsistentHashLB{
+									HashKey: &networking.LoadBalancerSettings_ConsistentHashLB_HttpHeaderName{HttpHeaderName: "x-user"},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+	store.Create(config.Config{
+		Meta: config.Meta{
+			GroupVersionKind: gvk.PeerAuthentication,
+			Name:             "default",
+			Namespace:        "istio-system",
+		},
+		Spec: &security.PeerAuthentication{
+			Mtls: &security.PeerAuthentication_MutualTLS{Mode: security.PeerAuthentication_MutualTLS_STRICT},
+		},
+	})
+	store.Create(config.Config{
+		Meta: config.Meta{
+			GroupVersionKind: gvk.PeerAuthentication,
+			Name:             "default",
+			Namespace:        "plaintext",
+		},
+		Spec: &security.PeerAuthentication{
+			Mtls: &security.PeerAuthentication_MutualTLS{Mode: security.PeerAuthentication_MutualTLS_PERMISSIVE},
+		},
+	})
+
 	env := ds.DiscoveryServer.Env
 	if err := env.PushContext.InitContext(env, env.PushContext, nil); err != nil {
 		t.Fatal(err)
@@ -146,6 +292,241 @@ func TestGRPC(t *testing.T) {
 
 	})
 
+	t.Run("gRPC-rds", func(t *testing.T) {
+		res := xdsRequest(t, v3.RouteType, "fortio1.fortio.svc.cluster.local:8081")
+		if len(res.Resources) != 1 {
+			t.Fatalf("expected 1 route configuration, got %d", len(res.Resources))
+		}
+		rc := &route.RouteConfiguration{}
+		if err := ptypes.UnmarshalAny(res.Resources[0], rc); err != nil {
+			t.Fatal(err)
+		}
+		if len(rc.VirtualHosts) != 1 || len(rc.VirtualHosts[0].Routes) != 2 {
+			t.Fatalf("expected 1 virtual host with 2 routes, got %v", rc.VirtualHosts)
+		}
+		routes := rc.VirtualHosts[0].Routes
+
+		canary := routes[0]
+		if h := canary.Match.Headers; len(h) != 1 || h[0].Name != "x-canary" || h[0].GetExactMatch() != "true" {
+			t.Errorf("unexpected header match %v", h)
+		}
+		if c := canary.GetRoute().GetCluster(); c != "outbound|8081|v2|fortio1.fortio.svc.cluster.local" {
+			t.Errorf("unexpected cluster %v", c)
+		}
+		if canary.GetRoute().GetTimeout().GetSeconds() != 5 {
+			t.Errorf("unexpected timeout %v", canary.GetRoute().GetTimeout())
+		}
+		if canary.GetRoute().GetRetryPolicy().GetNumRetries().GetValue() != 3 {
+			t.Errorf("unexpected retry policy %v", canary.GetRoute().GetRetryPolicy())
+		}
+		if _, f := canary.TypedPerFilterConfig[wellknown.Fault]; !f {
+			t.Errorf("expected fault injection, got %v", canary.TypedPerFilterConfig)
+		}
+
+		weighted := routes[1].GetRoute().GetWeightedClusters()
+		if weighted == nil || len(weighted.Clusters) != 2 {
+			t.Fatalf("expected 2 weighted clusters, got %v", routes[1].GetRoute())
+		}
+		if weighted.TotalWeight.GetValue() != 100 {
+			t.Errorf("expected a total weight of 100, got %v", weighted.TotalWeight)
+		}
+		if c := weighted.Clusters[0]; c.Name != "outbound|8081|v1|fortio1.fortio.svc.cluster.local" || c.Weight.GetValue() != 80 {
+			t.Errorf("unexpected weighted cluster %v", c)
+		}
+	})
+
+	t.Run("gRPC-cds", func(t *testing.T) {
+		res := xdsRequest(t, v3.ClusterType,
+			"outbound|8081|v1|fortio1.fortio.svc.cluster.local",
+			"outbound|8081|v2|fortio1.fortio.svc.cluster.local",
+			"istiod.istio-system.svc.cluster.local:14057",
+			"echo.plaintext.svc.cluster.local:8080")
+		clusters := map[string]*cluster.Cluster{}
+		for _, r := range res.Resources {
+			c := &cluster.Cluster{}
+			if err := ptypes.UnmarshalAny(r, c); err != nil {
+				t.Fatal(err)
+			}
+			clusters[c.Name] = c
+		}
+		if len(clusters) != 4 {
+			t.Fatalf("expected 4 clusters, got %v", clusters)
+		}
+		v1 := clusters["outbound|8081|v1|fortio1.fortio.svc.cluster.local"]
+		if v1.LbPolicy != cluster.Cluster_ROUND_ROBIN || v1.EdsClusterConfig.ServiceName != v1.Name {
+			t.Errorf("unexpected cluster %v", v1)
+		}
+		if v2 := clusters["outbound|8081|v2|fortio1.fortio.svc.cluster.local"]; v2.LbPolicy != cluster.Cluster_RING_HASH {
+			t.Errorf("expected ring hash load balancing, got %v", v2.LbPolicy)
+		}
+		istiod := clusters["istiod.istio-system.svc.cluster.local:14057"]
+		if sn := istiod.EdsClusterConfig.ServiceName; sn != "outbound|14057||istiod.istio-system.svc.cluster.local" {
+			t.Errorf("unexpected EDS service name %v", sn)
+		}
+		// STRICT mode without destination rule
+		if istiod.TransportSocket.GetName() != wellknown.TransportSocketTls {
+			t.Errorf("expected TLS for a STRICT service without destination rule, got %v", istiod.TransportSocket)
+		}
+		if echo := clusters["echo.plaintext.svc.cluster.local:8080"]; echo.TransportSocket != nil {
+			t.Errorf("expected no TLS for a PERMISSIVE service without destination rule, got %v", echo.TransportSocket)
+		}
+
+		if v1.TransportSocket.GetName() != wellknown.TransportSocketTls {
+			t.Fatalf("expected a TLS transport socket, got %v", v1.TransportSocket)
+		}
+		tlsContext := &tls.UpstreamTlsContext{}
+		if err := ptypes.UnmarshalAny(v1.TransportSocket.GetTypedConfig(), tlsContext); err != nil {
+			t.Fatal(err)
+		}
+		ctx := tlsContext.CommonTlsContext
+		if p := ctx.TlsCertificateCertificateProviderInstance; p.GetInstanceName() != "default" || p.GetCertificateName() != "default" {
+			t.Errorf("unexpected certificate provider %v", p)
+		}
+		validation := ctx.GetCombinedValidationContext()
+		if p := validation.GetValidationContextCertificateProviderInstance(); p.GetInstanceName() != "default" || p.GetCertificateName() != "ROOTCA" {
+			t.Errorf("unexpected root certificate provider %v", p)
+		}
+		if sans := validation.GetDefaultValidationContext().GetMatchSubjectAltNames(); len(sans) != 1 ||
+			sans[0].GetExact() != "spiffe://cluster.local/ns/fortio/sa/fortio" {
+			t.Errorf("unexpected SANs %v", sans)
+		}
+	})
+
+	t.Run("gRPC-lds-outbound", func(t *testing.T) {
+		for _, tc := range []struct {
+			name     string
+			node     *core.Node
+			expected string
+		}{
+			{"v3", &core.Node{}, hcmTypeURL},
+			{"gRPC Go 1.34", grpcGoNode("1.34.0"), hcmTypeURL},
+			{"gRPC Go 1.33", grpcGoNode("1.33.1"), legacyHCMTypeURL},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				res := xdsRequestFrom(t, tc.node, v3.ListenerType, "fortio1.fortio.svc.cluster.local:8081")
+				if len(res.Resources) != 1 {
+					t.Fatalf("expected 1 listener, got %d", len(res.Resources))
+				}
+				l := &listener.Listener{}
+				if err := ptypes.UnmarshalAny(res.Resources[0], l); err != nil {
+					t.Fatal(err)
+				}
+				if typeURL := l.GetApiListener().GetApiListener().GetTypeUrl(); typeURL != tc.expected {
+					t.Errorf("expected HttpConnectionManager type URL %s, got %s", tc.expected, typeURL)
+				}
+			})
+		}
+	})
+
+	t.Run("gRPC-lds-inbound", func(t *testing.T) {
+		name := fmt.Sprintf(grpcxds.ServerListenerNameTemplate, "10.0.0.1:8080")
+		res := xdsRequest(t, v3.ListenerType, name)
+		if len(res.Resources) != 1 {
+			t.Fatalf("expected 1 listener, got %d", len(res.Resources))
+		}
+		l := &listener.Listener{}
+		if err := ptypes.UnmarshalAny(res.Resources[0], l); err != nil {
+			t.Fatal(err)
+		}
+		if l.Name != name || l.Address.GetSocketAddress().GetPortValue() != 8080 {
+			t.Errorf("unexpected listener %v", l)
+		}
+		if len(l.FilterChains) != 1 {
+			t.Fatalf("expected 1 filter chain, got %v", l.FilterChains)
+		}
+		fc := l.FilterChains[0]
+		if len(fc.Filters) != 1 || fc.Filters[0].Name != wellknown.HTTPConnectionManager {
+			t.Fatalf("unexpected filters %v", fc.Filters)
+		}
+		if typeURL := fc.Filters[0].GetTypedConfig().GetTypeUrl(); typeURL != hcmTypeURL {
+			t.Errorf("unexpected HttpConnectionManager type URL %s", typeURL)
+		}
+		tlsContext := &tls.DownstreamTlsContext{}
+		if err := ptypes.UnmarshalAny(fc.TransportSocket.GetTypedConfig(), tlsContext); err != nil {
+			t.Fatal(err)
+		}
+		if !tlsContext.RequireClientCertificate.GetValue() {
+			t.Errorf("expected client certificates to be required in STRICT mode")
+		}
+	})
+
+	t.Run("gRPC-eds", func(t *testing.T) {
+		res := xdsRequest(t, v3.EndpointType, "outbound|8081|v1|fortio1.fortio.svc.cluster.local")
+		if len(res.Resources) != 1 {
+			t.Fatalf("expected 1 cluster load assignment, got %d", len(res.Resources))
+		}
+		cla := &endpoint.ClusterLoadAssignment{}
+		if err := ptypes.UnmarshalAny(res.Resources[0], cla); err != nil {
+			t.Fatal(err)
+		}
+		if len(cla.Endpoints) != 1 {
+			t.Fatalf("expected endpoints in 1 locality, got %v", cla.Endpoints)
+		}
+		l := cla.Endpoints[0]
+		if l.Locality.GetRegion() != "region1" || l.Locality.GetZone() != "zone1" || l.Locality.GetSubZone() != "subzone1" {
+			t.Errorf("unexpected locality %v", l.Locality)
+		}
+		if l.LoadBalancingWeight.GetValue() == 0 {
+			t.Errorf("expected the locality to be weighted")
+		}
+		if len(l.LbEndpoints) != 1 || l.LbEndpoints[0].GetEndpoint().GetAddress().GetSocketAddress().GetAddress() != "127.0.0.1" {
+			t.Errorf("unexpected endpoints %v", l.LbEndpoints)
+		}
+	})
+}
+
+// xdsRequest sends a request for resources to Istiod, as a gRPC client, and returns the response.
+func xdsRequest(t *testing.T, typeURL string, names ...string) *discovery.DiscoveryResponse {
+	t.Helper()
+	return xdsRequestFrom(t, &core.Node{}, typeURL, names...)
+}
+
+// xdsRequestFrom sends a request from a gRPC node, with the user agent of the given node
+func xdsRequestFrom(t *testing.T, node *core.Node, typeURL string, names ...string) *discovery.DiscoveryResponse {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, grpcAddr, grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	stream, err := discovery.NewAggregatedDiscoveryServiceClient(conn).StreamAggregatedResources(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = stream.Send(&discovery.DiscoveryRequest{
+		Node: &core.Node{
+			Id: "sidecar~10.0.0.1~foo.ns~ns.cluster.local",
+			Metadata: &structpb.Struct{Fields: map[string]*structpb.Value{
+				"GENERATOR": {Kind: &structpb.Value_StringValue{StringValue: "grpc"}},
+			}},
+			UserAgentName:        node.UserAgentName,
+			UserAgentVersionType: node.UserAgentVersionType,
+		},
+		TypeUrl:       typeURL,
+		ResourceNames: names,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+const (
+	hcmTypeURL       = "type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager"
+	legacyHCMTypeURL = "type.googleapis.com/envoy.config.filter.network.http_connection_manager.v2.HttpConnectionManager"
+)
+
+func grpcGoNode(version string) *core.Node {
+	return &core.Node{
+		UserAgentName:        "gRPC Go",
+		UserAgentVersionType: &core.Node_UserAgentVersion{UserAgentVersion: version},
+	}
 }
 
 type testLBClientConn struct {
@@ -0,0 +1,246 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcgen
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	fault "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/fault/v3"
+	router "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/router/v3"
+	hcm "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+	"github.com/golang/protobuf/ptypes/any"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/util"
+	"istio.io/istio/pilot/pkg/security/authn/factory"
+	"istio.io/istio/pkg/config/labels"
+	"istio.io/istio/pkg/istio-agent/grpcxds"
+	"istio.io/pkg/log"
+)
+
+// BuildListeners handles a LDS request, returning listeners of ApiListener type.
+// The request may include a list of resource names, using the full_hostname[:port] format to select only
+// specific services. Server listeners, named with the grpcxds.ServerListenerNamePrefix, are only returned
+// when explicitly requested.
+func (g *GrpcConfigGenerator) BuildListeners(node *model.Proxy, push *model.PushContext, names []string) model.Resources {
+	var inbound, outbound []string
+	for _, name := range names {
+		if strings.HasPrefix(name, grpcxds.ServerListenerNamePrefix) {
+			inbound = append(inbound, name)
+		} else {
+			outbound = append(outbound, name)
+		}
+	}
+
+	resp := model.Resources{}
+	if len(names) == 0 || len(outbound) > 0 {
+		resp = append(resp, buildOutboundListeners(node, outbound)...)
+	}
+	resp = append(resp, buildInboundListeners(node, push, inbound)...)
+	return resp
+}
+
+func buildOutboundListeners(node *model.Proxy, names []string) model.Resources {
+	resp := model.Resources{}
+
+	filter := map[string]bool{}
+	for _, name := range names {
+		if strings.Contains(name, ":") {
+			n, _, err := net.SplitHostPort(name)
+			if err == nil {
+				name = n
+			}
+		}
+		filter[name] = true
+	}
+
+	for _, el := range node.SidecarScope.EgressListeners {
+		for _, sv := range el.Services() {
+			shost := string(sv.Hostname)
+			if len(filter) > 0 {
+				// DiscReq has a filter - only return services that match
+				if !filter[shost] {
+					continue
+				}
+			}
+			for _, p := range sv.Ports {
+				hp := net.JoinHostPort(shost, strconv.Itoa(p.Port))
+				ll := &listener.Listener{
+					Name: hp,
+				}
+
+				ll.Address = &core.Address{
+					Address: &core.Address_SocketAddress{
+						SocketAddress: &core.SocketAddress{
+							Address: sv.Address,
+							PortSpecifier: &core.SocketAddress_PortValue{
+								PortValue: uint32(p.Port),
+							},
+						},
+					},
+				}
+				hcm := &hcm.HttpConnectionManager{
+					RouteSpecifier: &hcm.HttpConnectionManager_Rds{
+						Rds: &hcm.Rds{
+							ConfigSource: &core.ConfigSource{
+								ConfigSourceSpecifier: &core.ConfigSource_Ads{
+									Ads: &core.AggregatedConfigSource{},
+								},
+							},
+							RouteConfigName: hp,
+						},
+					},
+					// The fault filter applies the fault injection configured per route.
+					HttpFilters: []*hcm.HttpFilter{
+						{
+							Name:       wellknown.Fault,
+							ConfigType: &hcm.HttpFilter_TypedConfig{TypedConfig: util.MessageToAny(&fault.HTTPFault{})},
+						},
+						routerFilter(),
+					},
+				}
+				// TODO: for TCP listeners don't generate RDS, but some indication of cluster name.
+				ll.ApiListener = &listener.ApiListener{
+					ApiListener: hcmToAny(node, hcm),
+				}
+				resp = append(resp, util.MessageToAny(ll))
+			}
+		}
+	}
+
+	return resp
+}
+
+// buildInboundListeners returns the server listeners requested by gRPC servers, named after the
+// grpcxds.ServerListenerNameTemplate. The mTLS mode of the port is resolved from the PeerAuthentication
+// policies applying to the workload.
+func buildInboundListeners(node *model.Proxy, push *model.PushContext, names []string) model.Resources {
+	if len(names) == 0 {
+		return nil
+	}
+	policyApplier := factory.NewPolicyApplier(push, node.Metadata.Namespace, labels.Collection{node.Metadata.Labels})
+
+	resp := model.Resources{}
+	for _, name := range names {
+		ip, portStr, err := net.SplitHostPort(strings.TrimPrefix(name, grpcxds.ServerListenerNamePrefix))
+		if err != nil {
+			log.Warnf("invalid server listener name %s: %v", name, err)
+			continue
+		}
+		port, err := strconv.Atoi(portStr)
+		if err != nil {
+			log.Warnf("invalid port in server listener name %s: %v", name, err)
+			continue
+		}
+		mode := policyApplier.GetMutualTLSModeForPort(uint32(port))
+		ll := &listener.Listener{
+			Name: name,
+			Address: &core.Address{
+				Address: &core.Address_SocketAddress{
+					SocketAddress: &core.SocketAddress{
+						Address: ip,
+						PortSpecifier: &core.SocketAddress_PortValue{
+							PortValue: uint32(port),
+						},
+					},
+				},
+			},
+			FilterChains: buildInboundFilterChains(node, mode),
+		}
+		resp = append(resp, util.MessageToAny(ll))
+	}
+	return resp
+}
+
+// buildInboundFilterChains returns the filter chains of a server listener. gRPC can't match filter chains
+// on the transport protocol, so the PERMISSIVE mode is served in plaintext like DISABLE.
+func buildInboundFilterChains(node *model.Proxy, mode model.MutualTLSMode) []*listener.FilterChain {
+	fc := &listener.FilterChain{
+		Name: "plaintext",
+		Filters: []*listener.Filter{{
+			Name: wellknown.HTTPConnectionManager,
+			ConfigType: &listener.Filter_TypedConfig{
+				TypedConfig: hcmToAny(node, &hcm.HttpConnectionManager{
+					RouteSpecifier: &hcm.HttpConnectionManager_RouteConfig{
+						RouteConfig: &route.RouteConfiguration{
+							Name: "inbound",
+							VirtualHosts: []*route.VirtualHost{{
+								Name:    "inbound",
+								Domains: []string{"*"},
+								Routes: []*route.Route{{
+									Match: &route.RouteMatch{
+										PathSpecifier: &route.RouteMatch_Prefix{Prefix: "/"},
+									},
+								}},
+							}},
+						},
+					},
+					HttpFilters: []*hcm.HttpFilter{routerFilter()},
+				}),
+			},
+		}},
+	}
+	if mode == model.MTLSStrict {
+		fc.Name = "mtls"
+		fc.TransportSocket = buildTransportSocket(buildDownstreamTLSContext())
+	}
+	return []*listener.FilterChain{fc}
+}
+
+func routerFilter() *hcm.HttpFilter {
+	return &hcm.HttpFilter{
+		Name:       wellknown.Router,
+		ConfigType: &hcm.HttpFilter_TypedConfig{TypedConfig: util.MessageToAny(&router.Router{})},
+	}
+}
+
+// legacyHCMTypeURL is the type URL of the v2 HttpConnectionManager, which gRPC Go clients before
+// 1.34 expect even in v3 resources.
+const legacyHCMTypeURL = "type.googleapis.com/envoy.config.filter.network.http_connection_manager.v2.HttpConnectionManager"
+
+func hcmToAny(node *model.Proxy, h *hcm.HttpConnectionManager) *any.Any {
+	hcmAny := util.MessageToAny(h)
+	if requiresLegacyHCMTypeURL(node) {
+		hcmAny.TypeUrl = legacyHCMTypeURL
+	}
+	return hcmAny
+}
+
+// requiresLegacyHCMTypeURL returns whether the proxy is a gRPC Go client that only accepts the v2
+// HttpConnectionManager type URL.
+func requiresLegacyHCMTypeURL(node *model.Proxy) bool {
+	if node.UserAgentName != "gRPC Go" {
+		return false
+	}
+	parts := strings.SplitN(node.UserAgentVersion, ".", 3)
+	if len(parts) < 2 {
+		return false
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return false
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return false
+	}
+	return major == 1 && minor < 34
+}
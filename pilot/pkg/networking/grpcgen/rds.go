@@ -0,0 +1,132 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcgen
+
+import (
+	"net"
+	"strconv"
+
+	route "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	"github.com/golang/protobuf/ptypes/wrappers"
+
+	"istio.io/istio/pilot/pkg/model"
+	istioroute "istio.io/istio/pilot/pkg/networking/core/v1alpha3/route"
+	"istio.io/istio/pilot/pkg/networking/util"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/pkg/log"
+)
+
+// BuildHTTPRoutes supports per-VIP routes, as used by GRPC.
+// This mode is indicated by using names containing full host:port instead of just port.
+func (g *GrpcConfigGenerator) BuildHTTPRoutes(node *model.Proxy, push *model.PushContext, routeNames []string) model.Resources {
+	resp := model.Resources{}
+	for _, n := range routeNames {
+		if rc := buildHTTPRoute(node, push, n); rc != nil {
+			resp = append(resp, util.MessageToAny(rc))
+		}
+	}
+	return resp
+}
+
+// buildHTTPRoute builds the route configuration of a host:port, with a single virtual host.
+func buildHTTPRoute(node *model.Proxy, push *model.PushContext, routeName string) *route.RouteConfiguration {
+	hn, portn, err := net.SplitHostPort(routeName)
+	if err != nil {
+		log.Warnf("Failed to parse route %s: %v", routeName, err)
+		return nil
+	}
+	port, err := strconv.Atoi(portn)
+	if err != nil {
+		log.Warnf("Failed to parse port of route %s: %v", routeName, err)
+		return nil
+	}
+
+	el := node.SidecarScope.GetEgressListenerForRDS(port, "")
+	if el == nil {
+		return nil
+	}
+	var svc *model.Service
+	services := map[host.Name]*model.Service{}
+	for _, s := range el.Services() {
+		services[s.Hostname] = s
+		if svc == nil && s.Hostname.Matches(host.Name(hn)) {
+			svc = s
+		}
+	}
+	if svc == nil {
+		return nil
+	}
+
+	return &route.RouteConfiguration{
+		Name: routeName,
+		VirtualHosts: []*route.VirtualHost{
+			{
+				Name:    hn,
+				Domains: []string{hn, routeName},
+				Routes:  buildRoutes(node, push, el, svc, services, port),
+			},
+		},
+	}
+}
+
+// buildRoutes returns the routes of a service port, built from the virtual services of the service
+// like for sidecars. Services without virtual service have a default route to the service.
+func buildRoutes(node *model.Proxy, push *model.PushContext, el *model.IstioEgressListenerWrapper,
+	svc *model.Service, services map[host.Name]*model.Service, port int) []*route.Route {
+	vhosts := istioroute.BuildSidecarVirtualHostsFromConfigAndRegistry(node, push, services, el.VirtualServices(), port)
+	for _, vh := range vhosts {
+		if vh.Port != port {
+			continue
+		}
+		for _, s := range vh.Services {
+			if s.Hostname == svc.Hostname {
+				return setTotalWeights(vh.Routes)
+			}
+		}
+	}
+
+	// Not an HTTP port: route all the requests to the service.
+	return []*route.Route{
+		{
+			Match: &route.RouteMatch{
+				PathSpecifier: &route.RouteMatch_Prefix{Prefix: ""},
+			},
+			Action: &route.Route_Route{
+				Route: &route.RouteAction{
+					ClusterSpecifier: &route.RouteAction_Cluster{
+						Cluster: model.BuildSubsetKey(model.TrafficDirectionOutbound, "", svc.Hostname, port),
+					},
+				},
+			},
+		},
+	}
+}
+
+// setTotalWeights sets the total weight of the weighted clusters of routes, which gRPC requires
+// to be the sum of the weights of the clusters.
+func setTotalWeights(routes []*route.Route) []*route.Route {
+	for _, r := range routes {
+		wc := r.GetRoute().GetWeightedClusters()
+		if wc == nil {
+			continue
+		}
+		var total uint32
+		for _, c := range wc.Clusters {
+			total += c.GetWeight().GetValue()
+		}
+		wc.TotalWeight = &wrappers.UInt32Value{Value: total}
+	}
+	return routes
+}
@@ -0,0 +1,114 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcgen
+
+import (
+	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	tls "github.com/envoyproxy/go-control-plane/envoy/extensions/transport_sockets/tls/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/wrappers"
+
+	networking "istio.io/api/networking/v1alpha3"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/util"
+	authn_model "istio.io/istio/pilot/pkg/security/model"
+	"istio.io/istio/pkg/config/host"
+	"istio.io/istio/pkg/istio-agent/grpcxds"
+	"istio.io/pkg/log"
+)
+
+// gRPC only gets certificates from certificate provider instances, defined in its bootstrap. The
+// instance used is a file watcher of the certificates output by the istio-agent.
+
+// buildCommonTLSContext returns the TLS context using the workload certificate and root certificate of
+// the certificate provider. The peer certificate must match one of the SANs, if any.
+func buildCommonTLSContext(sans []string) *tls.CommonTlsContext {
+	return &tls.CommonTlsContext{
+		TlsCertificateCertificateProviderInstance: &tls.CommonTlsContext_CertificateProviderInstance{
+			InstanceName:    grpcxds.FileWatcherCertProviderName,
+			CertificateName: authn_model.SDSDefaultResourceName,
+		},
+		ValidationContextType: &tls.CommonTlsContext_CombinedValidationContext{
+			CombinedValidationContext: &tls.CommonTlsContext_CombinedCertificateValidationContext{
+				DefaultValidationContext: &tls.CertificateValidationContext{
+					MatchSubjectAltNames: util.StringToExactMatch(sans),
+				},
+				ValidationContextCertificateProviderInstance: &tls.CommonTlsContext_CertificateProviderInstance{
+					InstanceName:    grpcxds.FileWatcherCertProviderName,
+					CertificateName: authn_model.SDSRootResourceName,
+				},
+			},
+		},
+	}
+}
+
+// applyTLS sets the transport socket of a cluster to use Istio mTLS, if the destination rule uses the
+// ISTIO_MUTUAL mode. Without TLS settings, as for sidecars with auto mTLS, mTLS is enabled if the mTLS mode
+// inferred for the service is STRICT. It is not enabled for PERMISSIVE services: unlike Envoy, gRPC can't
+// select the transport per endpoint, and it can't use other certificates than the ones of its certificate
+// providers.
+func applyTLS(c *cluster.Cluster, node *model.Proxy, push *model.PushContext, hostname host.Name, port int,
+	settings *networking.ClientTLSSettings) {
+	if settings == nil && inferServiceMTLSMode(node, push, hostname, port) == model.MTLSStrict {
+		settings = &networking.ClientTLSSettings{Mode: networking.ClientTLSSettings_ISTIO_MUTUAL}
+	}
+	switch settings.GetMode() {
+	case networking.ClientTLSSettings_ISTIO_MUTUAL:
+		sans := settings.GetSubjectAltNames()
+		if len(sans) == 0 {
+			sans = push.ServiceAccounts[hostname][port]
+		}
+		c.TransportSocket = buildTransportSocket(&tls.UpstreamTlsContext{
+			CommonTlsContext: buildCommonTLSContext(sans),
+			Sni:              settings.GetSni(),
+		})
+	case networking.ClientTLSSettings_SIMPLE, networking.ClientTLSSettings_MUTUAL:
+		log.Debugf("TLS mode %v of cluster %s is not supported by gRPC", settings.GetMode(), c.Name)
+	}
+}
+
+// inferServiceMTLSMode returns the mTLS mode of the service port inferred from the PeerAuthentication
+// policies, or MTLSUnknown if auto mTLS is disabled.
+func inferServiceMTLSMode(node *model.Proxy, push *model.PushContext, hostname host.Name, port int) model.MutualTLSMode {
+	if !push.Mesh.GetEnableAutoMtls().GetValue() {
+		return model.MTLSUnknown
+	}
+	svc := push.ServiceForHostname(node, hostname)
+	if svc == nil {
+		return model.MTLSUnknown
+	}
+	svcPort, f := svc.Ports.GetByPort(port)
+	if !f {
+		return model.MTLSUnknown
+	}
+	return push.BestEffortInferServiceMTLSMode(svc, svcPort)
+}
+
+// buildDownstreamTLSContext returns the TLS context of servers, which require client certificates.
+func buildDownstreamTLSContext() *tls.DownstreamTlsContext {
+	return &tls.DownstreamTlsContext{
+		CommonTlsContext:         buildCommonTLSContext(nil),
+		RequireClientCertificate: &wrappers.BoolValue{Value: true},
+	}
+}
+
+func buildTransportSocket(tlsContext proto.Message) *core.TransportSocket {
+	return &core.TransportSocket{
+		Name:       wellknown.TransportSocketTls,
+		ConfigType: &core.TransportSocket_TypedConfig{TypedConfig: util.MessageToAny(tlsContext)},
+	}
+}
@@ -15,13 +15,29 @@
 package authn
 
 import (
-	meshconfig "istio.io/api/mesh/v1alpha1"
 	"istio.io/istio/pilot/pkg/features"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking"
+	authn_model "istio.io/istio/pilot/pkg/security/model"
 )
 
-func trustDomainsForValidation(meshConfig *meshconfig.MeshConfig) []string {
+func trustDomainsForValidation(push *model.PushContext) []string {
 	if features.SkipValidateTrustDomain.Get() {
 		return nil
 	}
-	return append([]string{meshConfig.TrustDomain}, meshConfig.TrustDomainAliases...)
+	tds := append([]string{push.Mesh.TrustDomain}, push.Mesh.TrustDomainAliases...)
+	return append(tds, push.FederatedTrustDomains()...)
+}
+
+// applyMeshTrustBundle lets the inbound filter chains accept peers from federated trust domains.
+func applyMeshTrustBundle(push *model.PushContext, chains []networking.FilterChain) []networking.FilterChain {
+	if len(push.FederatedTrustDomains()) == 0 {
+		return chains
+	}
+	for _, chain := range chains {
+		if chain.TLSContext != nil {
+			authn_model.ApplyMeshTrustBundle(chain.TLSContext.CommonTlsContext)
+		}
+	}
+	return chains
 }
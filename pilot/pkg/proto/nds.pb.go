@@ -65,11 +65,13 @@ type NameTable_NameInfo struct {
 	// the registry where this
 	Registry string `protobuf:"bytes,2,opt,name=registry,proto3" json:"registry,omitempty"`
 	// these are set only for k8s services
-	Shortname            string   `protobuf:"bytes,3,opt,name=shortname,proto3" json:"shortname,omitempty"`
-	Namespace            string   `protobuf:"bytes,4,opt,name=namespace,proto3" json:"namespace,omitempty"`
-	XXX_NoUnkeyedLiteral struct{} `json:"-"`
-	XXX_unrecognized     []byte   `json:"-"`
-	XXX_sizecache        int32    `json:"-"`
+	Shortname string `protobuf:"bytes,3,opt,name=shortname,proto3" json:"shortname,omitempty"`
+	Namespace string `protobuf:"bytes,4,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	// the ports of the service, used to answer SRV queries
+	Ports                []*NameTable_NameInfo_Port `protobuf:"bytes,5,rep,name=ports,proto3" json:"ports,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}                   `json:"-"`
+	XXX_unrecognized     []byte                     `json:"-"`
+	XXX_sizecache        int32                      `json:"-"`
 }
 
 func (m *NameTable_NameInfo) Reset()         { *m = NameTable_NameInfo{} }
@@ -124,29 +126,94 @@ func (m *NameTable_NameInfo) GetNamespace() string {
 	return ""
 }
 
+func (m *NameTable_NameInfo) GetPorts() []*NameTable_NameInfo_Port {
+	if m != nil {
+		return m.Ports
+	}
+	return nil
+}
+
+type NameTable_NameInfo_Port struct {
+	Name                 string   `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Number               uint32   `protobuf:"varint,2,opt,name=number,proto3" json:"number,omitempty"`
+	Protocol             string   `protobuf:"bytes,3,opt,name=protocol,proto3" json:"protocol,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *NameTable_NameInfo_Port) Reset()         { *m = NameTable_NameInfo_Port{} }
+func (m *NameTable_NameInfo_Port) String() string { return proto.CompactTextString(m) }
+func (*NameTable_NameInfo_Port) ProtoMessage()    {}
+func (*NameTable_NameInfo_Port) Descriptor() ([]byte, []int) {
+	return fileDescriptor_nds_e4011d50349a6001, []int{0, 0, 0}
+}
+func (m *NameTable_NameInfo_Port) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_NameTable_NameInfo_Port.Unmarshal(m, b)
+}
+func (m *NameTable_NameInfo_Port) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_NameTable_NameInfo_Port.Marshal(b, m, deterministic)
+}
+func (dst *NameTable_NameInfo_Port) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_NameTable_NameInfo_Port.Merge(dst, src)
+}
+func (m *NameTable_NameInfo_Port) XXX_Size() int {
+	return xxx_messageInfo_NameTable_NameInfo_Port.Size(m)
+}
+func (m *NameTable_NameInfo_Port) XXX_DiscardUnknown() {
+	xxx_messageInfo_NameTable_NameInfo_Port.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_NameTable_NameInfo_Port proto.InternalMessageInfo
+
+func (m *NameTable_NameInfo_Port) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *NameTable_NameInfo_Port) GetNumber() uint32 {
+	if m != nil {
+		return m.Number
+	}
+	return 0
+}
+
+func (m *NameTable_NameInfo_Port) GetProtocol() string {
+	if m != nil {
+		return m.Protocol
+	}
+	return ""
+}
+
 func init() {
 	proto.RegisterType((*NameTable)(nil), "istio.networking.nds.v1.NameTable")
 	proto.RegisterMapType((map[string]*NameTable_NameInfo)(nil), "istio.networking.nds.v1.NameTable.TableEntry")
 	proto.RegisterType((*NameTable_NameInfo)(nil), "istio.networking.nds.v1.NameTable.NameInfo")
+	proto.RegisterType((*NameTable_NameInfo_Port)(nil), "istio.networking.nds.v1.NameTable.NameInfo.Port")
 }
 
 func init() { proto.RegisterFile("nds.proto", fileDescriptor_nds_e4011d50349a6001) }
 
 var fileDescriptor_nds_e4011d50349a6001 = []byte{
-	// 229 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0xe2, 0xcc, 0x4b, 0x29, 0xd6,
-	0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0x12, 0xcf, 0x2c, 0x2e, 0xc9, 0xcc, 0xd7, 0xcb, 0x4b, 0x2d,
-	0x29, 0xcf, 0x2f, 0xca, 0xce, 0xcc, 0x4b, 0xd7, 0x03, 0xc9, 0x95, 0x19, 0x2a, 0xad, 0x65, 0xe2,
-	0xe2, 0xf4, 0x4b, 0xcc, 0x4d, 0x0d, 0x49, 0x4c, 0xca, 0x49, 0x15, 0x72, 0xe6, 0x62, 0x2d, 0x01,
-	0x31, 0x24, 0x18, 0x15, 0x98, 0x35, 0xb8, 0x8d, 0x74, 0xf5, 0x70, 0x68, 0xd3, 0x83, 0x6b, 0xd1,
-	0x03, 0x93, 0xae, 0x79, 0x25, 0x45, 0x95, 0x41, 0x10, 0xbd, 0x52, 0x25, 0x5c, 0x1c, 0x20, 0x69,
-	0xcf, 0xbc, 0xb4, 0x7c, 0x21, 0x01, 0x2e, 0xe6, 0xcc, 0x82, 0x62, 0xb0, 0x71, 0x9c, 0x41, 0x20,
-	0xa6, 0x90, 0x14, 0x17, 0x47, 0x51, 0x6a, 0x7a, 0x66, 0x71, 0x49, 0x51, 0xa5, 0x04, 0x93, 0x02,
-	0xa3, 0x06, 0x67, 0x10, 0x9c, 0x2f, 0x24, 0xc3, 0xc5, 0x59, 0x9c, 0x91, 0x5f, 0x54, 0x92, 0x97,
-	0x98, 0x9b, 0x2a, 0xc1, 0x0c, 0x96, 0x44, 0x08, 0x80, 0x64, 0x41, 0x74, 0x71, 0x41, 0x62, 0x72,
-	0xaa, 0x04, 0x0b, 0x44, 0x16, 0x2e, 0x20, 0x95, 0xca, 0xc5, 0x85, 0x70, 0x0a, 0xc8, 0xde, 0xec,
-	0xd4, 0x4a, 0x09, 0x46, 0xb0, 0x2a, 0x10, 0x53, 0xc8, 0x91, 0x8b, 0xb5, 0x2c, 0x31, 0xa7, 0x34,
-	0x15, 0x6c, 0x29, 0xb7, 0x91, 0x36, 0x11, 0x5e, 0x83, 0xf9, 0x22, 0x08, 0xa2, 0xd3, 0x8a, 0xc9,
-	0x82, 0x31, 0x89, 0x0d, 0x1c, 0x9e, 0xc6, 0x80, 0x00, 0x00, 0x00, 0xff, 0xff, 0x4b, 0x59, 0x9f,
-	0x74, 0x5c, 0x01, 0x00, 0x00,
+	// 286 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x94, 0x90, 0xcf, 0x4a, 0xf3, 0x40,
+	0x14, 0xc5, 0xc9, 0xbf, 0xd2, 0xdc, 0xf2, 0xc1, 0xc7, 0x2c, 0x34, 0x04, 0x17, 0xc5, 0x55, 0x41,
+	0x1c, 0xb4, 0x6e, 0xc4, 0x9d, 0x88, 0x82, 0x9b, 0x22, 0x83, 0x2f, 0x90, 0xd4, 0x6b, 0x0d, 0x4d,
+	0x66, 0xc2, 0xcc, 0xb4, 0x92, 0x77, 0xf0, 0xb9, 0x7c, 0x2e, 0xb9, 0x37, 0x31, 0x5d, 0x09, 0xba,
+	0x49, 0xce, 0x99, 0xc3, 0xb9, 0xf3, 0x9b, 0x0b, 0xa9, 0x7e, 0x71, 0xb2, 0xb5, 0xc6, 0x1b, 0x71,
+	0x5c, 0x39, 0x5f, 0x19, 0xa9, 0xd1, 0xbf, 0x1b, 0xbb, 0xad, 0xf4, 0x46, 0x52, 0xb6, 0xbf, 0x3c,
+	0xfd, 0x8c, 0x20, 0x5d, 0x15, 0x0d, 0x3e, 0x17, 0x65, 0x8d, 0xe2, 0x0e, 0x12, 0x4f, 0x22, 0x0b,
+	0xe6, 0xd1, 0x62, 0xb6, 0x3c, 0x97, 0x3f, 0xd4, 0xe4, 0x58, 0x91, 0xfc, 0xbd, 0xd7, 0xde, 0x76,
+	0xaa, 0xef, 0xe6, 0x1f, 0x21, 0x4c, 0x29, 0x7f, 0xd4, 0xaf, 0x46, 0xfc, 0x87, 0xa8, 0x6a, 0x1d,
+	0xcf, 0x4b, 0x15, 0x49, 0x91, 0xc3, 0xd4, 0xe2, 0xa6, 0x72, 0xde, 0x76, 0x59, 0x38, 0x0f, 0x16,
+	0xa9, 0x1a, 0xbd, 0x38, 0x81, 0xd4, 0xbd, 0x19, 0xeb, 0x75, 0xd1, 0x60, 0x16, 0x71, 0x78, 0x38,
+	0xa0, 0x94, 0xfe, 0xae, 0x2d, 0xd6, 0x98, 0xc5, 0x7d, 0x3a, 0x1e, 0x88, 0x07, 0x48, 0x5a, 0x63,
+	0xbd, 0xcb, 0x12, 0x66, 0xbf, 0xf8, 0x05, 0xfb, 0x37, 0xa5, 0x7c, 0x32, 0xd6, 0xab, 0xbe, 0x9e,
+	0xaf, 0x20, 0x26, 0x2b, 0x04, 0xc4, 0x8c, 0x11, 0xf0, 0x45, 0xac, 0xc5, 0x11, 0x4c, 0xf4, 0xae,
+	0x29, 0xd1, 0x32, 0xf9, 0x3f, 0x35, 0x38, 0x7a, 0x13, 0xef, 0x79, 0x6d, 0xea, 0x01, 0x7b, 0xf4,
+	0x39, 0x02, 0x1c, 0x76, 0x44, 0xfb, 0xd8, 0x62, 0x37, 0x0c, 0x25, 0x29, 0x6e, 0x21, 0xd9, 0x17,
+	0xf5, 0x0e, 0x79, 0xe4, 0x6c, 0x79, 0xf6, 0x07, 0x6e, 0xd5, 0x37, 0x6f, 0xc2, 0xeb, 0xa0, 0x9c,
+	0xf0, 0x85, 0x57, 0x5f, 0x03, 0x00, 0x29, 0xe8, 0xa9, 0xb4, 0xf5, 0x01, 0x00, 0x00,
 }
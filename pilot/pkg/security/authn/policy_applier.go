@@ -36,4 +36,7 @@ type PolicyApplier interface {
 	// AuthNFilter returns the (authn) HTTP filter to enforce the underlying authentication policy.
 	// It may return nil, if no authentication is needed.
 	AuthNFilter(proxyType model.NodeType, port uint32, istioMutualGateway bool) *http_conn.HttpFilter
+
+	// GetMutualTLSModeForPort returns the mutual TLS mode of the given endpoint (aka workload) port.
+	GetMutualTLSModeForPort(endpointPort uint32) model.MutualTLSMode
 }
@@ -69,6 +69,14 @@ const (
 	// KubernetesSecretType is the name of a SDS secret stored in Kubernetes
 	KubernetesSecretType    = "kubernetes"
 	KubernetesSecretTypeURI = KubernetesSecretType + "://"
+
+	// TrustBundleResourcePrefix is the prefix of the SDS resources served by istiod with the trust bundle
+	// of a federated SPIFFE trust domain, e.g. spiffe-bundle://example.org.
+	TrustBundleResourcePrefix = "spiffe-bundle://"
+
+	// MeshTrustBundleResourceName is the SDS resource served by istiod with the root certificates of the mesh
+	// together with the trust bundles of all federated trust domains.
+	MeshTrustBundleResourceName = TrustBundleResourcePrefix + "*"
 )
 
 var (
@@ -266,6 +274,65 @@ func ApplyToCommonTLSContext(tlsContext *tls.CommonTlsContext, metadata *model.N
 	}
 }
 
+// ConstructTrustBundleSdsSecretConfig constructs SDS secret configuration for a trust bundle served by istiod.
+func ConstructTrustBundleSdsSecretConfig(name string) *tls.SdsSecretConfig {
+	return &tls.SdsSecretConfig{
+		Name:      name,
+		SdsConfig: SDSAdsConfig,
+	}
+}
+
+// TrustBundleResourceName returns the SDS resource to validate peers that present one of the subject alt names.
+// If all of them are in the same federated trust domain, the peers are validated with the trust bundle of that
+// trust domain only. If they span the mesh and federated trust domains, the mesh trust bundle is used. An empty
+// name is returned if no federated trust domain is involved, and the root certificate of the mesh is used.
+func TrustBundleResourceName(subjectAltNames []string, federatedTrustDomains []string) string {
+	if len(federatedTrustDomains) == 0 {
+		return ""
+	}
+	federated := ""
+	local := false
+	for _, san := range subjectAltNames {
+		td, err := spiffe.GetTrustDomainFromURISAN(san)
+		if err != nil || !isTrustDomainIn(td, federatedTrustDomains) {
+			local = true
+			continue
+		}
+		if federated != "" && federated != td {
+			return MeshTrustBundleResourceName
+		}
+		federated = td
+	}
+	switch {
+	case federated == "":
+		return ""
+	case local:
+		return MeshTrustBundleResourceName
+	default:
+		return TrustBundleResourcePrefix + federated
+	}
+}
+
+func isTrustDomainIn(trustDomain string, trustDomains []string) bool {
+	for _, td := range trustDomains {
+		if td == trustDomain {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyMeshTrustBundle validates peers with the mesh trust bundle instead of the root certificate of the mesh,
+// so that peers from federated trust domains are accepted as well. Root certificates mounted in the pod are kept.
+// The mesh trust bundle carries the certificate revocation list of the mesh CA, like the root certificate does.
+func ApplyMeshTrustBundle(tlsContext *tls.CommonTlsContext) {
+	combined := tlsContext.GetCombinedValidationContext()
+	if combined == nil || combined.ValidationContextSdsSecretConfig.GetName() != SDSRootResourceName {
+		return
+	}
+	combined.ValidationContextSdsSecretConfig = ConstructTrustBundleSdsSecretConfig(MeshTrustBundleResourceName)
+}
+
 // ApplyCustomSDSToClientCommonTLSContext applies the customized sds to CommonTlsContext
 // Used for building upstream TLS context for egress gateway's TLS/mTLS origination
 func ApplyCustomSDSToClientCommonTLSContext(tlsContext *tls.CommonTlsContext, tlsOpts *networking.ClientTLSSettings) {
@@ -444,3 +444,68 @@ func TestApplyToCommonTLSContext(t *testing.T) {
 		})
 	}
 }
+
+func TestTrustBundleResourceName(t *testing.T) {
+	federated := []string{"example.org", "example.com"}
+	testCases := []struct {
+		name            string
+		subjectAltNames []string
+		federated       []string
+		expected        string
+	}{
+		{
+			name:            "no federated trust domains",
+			subjectAltNames: []string{"spiffe://example.org/ns/foo/sa/bar"},
+			expected:        "",
+		},
+		{
+			name:            "mesh identities",
+			subjectAltNames: []string{"spiffe://cluster.local/ns/foo/sa/bar"},
+			federated:       federated,
+			expected:        "",
+		},
+		{
+			name:            "single federated trust domain",
+			subjectAltNames: []string{"spiffe://example.org/ns/foo/sa/bar", "spiffe://example.org/ns/foo/sa/baz"},
+			federated:       federated,
+			expected:        "spiffe-bundle://example.org",
+		},
+		{
+			name:            "federated trust domains",
+			subjectAltNames: []string{"spiffe://example.org/ns/foo/sa/bar", "spiffe://example.com/ns/foo/sa/bar"},
+			federated:       federated,
+			expected:        MeshTrustBundleResourceName,
+		},
+		{
+			name:            "mesh and federated identities",
+			subjectAltNames: []string{"spiffe://example.org/ns/foo/sa/bar", "spiffe://cluster.local/ns/foo/sa/bar"},
+			federated:       federated,
+			expected:        MeshTrustBundleResourceName,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TrustBundleResourceName(tt.subjectAltNames, tt.federated); got != tt.expected {
+				t.Errorf("got %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestApplyMeshTrustBundle(t *testing.T) {
+	tlsContext := &auth.CommonTlsContext{}
+	ApplyToCommonTLSContext(tlsContext, &model.NodeMetadata{}, "", []string{}, []string{"cluster.local", "example.org"})
+	ApplyMeshTrustBundle(tlsContext)
+	if got := tlsContext.GetCombinedValidationContext().ValidationContextSdsSecretConfig; !cmp.Equal(got,
+		ConstructTrustBundleSdsSecretConfig(MeshTrustBundleResourceName), protocmp.Transform()) {
+		t.Errorf("unexpected validation context %v", got)
+	}
+
+	// Root certificates mounted in the pod are kept.
+	tlsContext = &auth.CommonTlsContext{}
+	ApplyToCommonTLSContext(tlsContext, &model.NodeMetadata{TLSServerRootCert: "/etc/certs/root-cert.pem"}, "", []string{}, nil)
+	ApplyMeshTrustBundle(tlsContext)
+	if got := tlsContext.GetCombinedValidationContext().ValidationContextSdsSecretConfig.Name; got != "file-root:/etc/certs/root-cert.pem" {
+		t.Errorf("unexpected validation context %v", got)
+	}
+}
@@ -36,6 +36,9 @@ type Bundle struct {
 	// Any service with the identity `td1/ns/foo/sa/a-service-account`, `td2/ns/foo/sa/a-service-account`,
 	// or `td3/ns/foo/sa/a-service-account` will be treated the same in the Istio mesh.
 	TrustDomains []string
+	// Contain the SPIFFE trust domains federated with the mesh. Principals of these trust domains
+	// are distinct identities, and are kept as they are.
+	FederatedTrustDomains []string
 }
 
 // NewBundle returns a new trust domain bundle.
@@ -46,6 +49,12 @@ func NewBundle(trustDomain string, trustDomainAliases []string) Bundle {
 	}
 }
 
+// WithFederatedTrustDomains returns a copy of the bundle with the given federated trust domains.
+func (t Bundle) WithFederatedTrustDomains(federatedTrustDomains []string) Bundle {
+	t.FederatedTrustDomains = federatedTrustDomains
+	return t
+}
+
 // ReplaceTrustDomainAliases checks the existing principals and returns a list of new principals
 // with the current trust domain and its aliases.
 // For example, for a user "bar" in namespace "foo".
@@ -72,6 +81,9 @@ func (t Bundle) ReplaceTrustDomainAliases(principals []string) []string {
 		if stringMatch(trustDomainFromPrincipal, t.TrustDomains) || trustDomainFromPrincipal == constants.DefaultKubernetesDomain {
 			// Generate configuration for trust domain and trust domain aliases.
 			principalsIncludingAliases = append(principalsIncludingAliases, t.replaceTrustDomains(principal, trustDomainFromPrincipal)...)
+		} else if stringMatch(trustDomainFromPrincipal, t.FederatedTrustDomains) {
+			// Principals of federated trust domains are authenticated with their own trust bundles.
+			principalsIncludingAliases = append(principalsIncludingAliases, principal)
 		} else {
 			authzLog.Warnf("Trust domain %s from principal %s does not match the current trust "+
 				"domain or its aliases", trustDomainFromPrincipal, principal)
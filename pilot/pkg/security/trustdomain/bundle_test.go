@@ -81,6 +81,12 @@ func TestReplaceTrustDomainAliases(t *testing.T) {
 			principals:        []string{"some-td/ns/foo/sa/bar"},
 			expect:            []string{"some-td/ns/foo/sa/bar"},
 		},
+		{
+			name:              "Principals of federated trust domains as-is",
+			trustDomainBundle: NewBundle("td1", []string{"td2"}).WithFederatedTrustDomains([]string{"example.org"}),
+			principals:        []string{"example.org/ns/foo/sa/bar", "td2/ns/foo/sa/bar"},
+			expect:            []string{"example.org/ns/foo/sa/bar", "td1/ns/foo/sa/bar", "td2/ns/foo/sa/bar"},
+		},
 		{
 			name:              "Principals match one alias",
 			trustDomainBundle: NewBundle("td1", []string{"td2", "some-td"}),
@@ -21,6 +21,7 @@ import (
 	"time"
 
 	"github.com/hashicorp/go-multierror"
+	xnsinformers "github.com/maistra/xns-informer/pkg/informers"
 	"github.com/yl2chen/cidranger"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/meta"
@@ -349,6 +350,10 @@ func NewController(kubeClient kubelib.Client, options Options) *Controller {
 	})
 	registerHandlers(c.pods.informer, c.queue, "Pods", c.pods.onEvent, nil)
 
+	kubeClient.AddNamespaceHandler(xnsinformers.NamespaceSetHandlerFuncs{
+		RemoveFunc: c.onNamespaceRemoved,
+	})
+
 	return c
 }
 
@@ -652,6 +657,26 @@ func (c *Controller) syncEndpoints() error {
 	return err.ErrorOrNil()
 }
 
+// onNamespaceRemoved emits delete events for the endpoints, pods and services in a namespace that is no longer
+// watched. It is called before the informers of the namespace are stopped, while the objects are still in the caches.
+func (c *Controller) onNamespaceRemoved(namespace string) {
+	queueDeletes := func(informer cache.SharedIndexInformer, handler func(interface{}, model.Event) error) {
+		for _, obj := range informer.GetStore().List() {
+			if o, ok := obj.(metav1.Object); !ok || (namespace != metav1.NamespaceAll && o.GetNamespace() != namespace) {
+				continue
+			}
+			obj := obj
+			c.queue.Push(func() error {
+				return handler(obj, model.EventDelete)
+			})
+		}
+	}
+	log.Infof("Removing services of namespace %q, which is no longer watched", namespace)
+	queueDeletes(c.endpoints.getInformer(), c.endpoints.onEvent)
+	queueDeletes(c.pods.informer, c.pods.onEvent)
+	queueDeletes(c.serviceInformer, c.onServiceEvent)
+}
+
 // Run all controllers until a signal is received
 func (c *Controller) Run(stop <-chan struct{}) {
 	if c.networksWatcher != nil {
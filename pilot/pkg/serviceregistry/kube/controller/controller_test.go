@@ -40,6 +40,7 @@ import (
 	"istio.io/istio/pkg/config/labels"
 	"istio.io/istio/pkg/config/mesh"
 	"istio.io/istio/pkg/config/protocol"
+	kubelib "istio.io/istio/pkg/kube"
 	"istio.io/istio/pkg/spiffe"
 	"istio.io/istio/pkg/test"
 	"istio.io/istio/pkg/test/util/retry"
@@ -1682,3 +1683,32 @@ func TestWorkloadInstanceHandlerMultipleEndpoints(t *testing.T) {
 		}
 	}
 }
+
+func TestNamespaceRemoved(t *testing.T) {
+	client := kubelib.NewFakeClient()
+	controller, fx := NewFakeControllerWithOptions(FakeControllerOptions{Client: client})
+	defer controller.Stop()
+	client.SetNamespaces("nsa", "nsb")
+
+	for _, ns := range []string{"nsa", "nsb"} {
+		createService(controller, "svc1", ns, nil, []int32{8080}, map[string]string{"app": "prod-app"}, t)
+		if ev := fx.Wait("service"); ev == nil {
+			t.Fatalf("Timeout creating service in %s", ns)
+		}
+	}
+
+	client.SetNamespaces("nsb")
+	ev := fx.Wait("service")
+	if ev == nil {
+		t.Fatal("Timeout removing services of unwatched namespace")
+	}
+	if ev.ID != string(kube.ServiceHostname("svc1", "nsa", controller.domainSuffix)) {
+		t.Errorf("Expect service %s removed, but got %s", kube.ServiceHostname("svc1", "nsa", controller.domainSuffix), ev.ID)
+	}
+	if svc, _ := controller.GetService(kube.ServiceHostname("svc1", "nsa", controller.domainSuffix)); svc != nil {
+		t.Errorf("Expect service of unwatched namespace to be removed, but got %v", svc)
+	}
+	if svc, _ := controller.GetService(kube.ServiceHostname("svc1", "nsb", controller.domainSuffix)); svc == nil {
+		t.Errorf("Expect service of watched namespace to be kept")
+	}
+}
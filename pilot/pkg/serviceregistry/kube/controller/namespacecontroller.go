@@ -164,6 +164,20 @@ func (nc *NamespaceController) Run(stopCh <-chan struct{}) {
 	go nc.queue.Run(stopCh)
 }
 
+// Resync merges the current data into the configmaps of all namespaces. It is used when the data
+// changes without a namespace or configmap event, for example when the CA revokes a certificate.
+func (nc *NamespaceController) Resync() {
+	for _, obj := range nc.configMapInformer.GetStore().List() {
+		cm, err := convertToConfigMap(obj)
+		if err != nil || cm.Name != CACertNamespaceConfigMap {
+			continue
+		}
+		nc.queue.Push(func() error {
+			return nc.configMapChange(cm)
+		})
+	}
+}
+
 // insertDataForNamespace will add data into the configmap for the specified namespace
 // If the configmap is not found, it will be created.
 // If you know the current contents of the configmap, using UpdateDataInConfigMap is more efficient.
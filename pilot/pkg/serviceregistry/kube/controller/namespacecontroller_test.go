@@ -18,6 +18,7 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 
@@ -54,6 +55,41 @@ func TestNamespaceController(t *testing.T) {
 	expectConfigMap(t, client, "foo", testdata)
 }
 
+func TestNamespaceControllerResync(t *testing.T) {
+	client := kube.NewFakeClient()
+	var mu sync.Mutex
+	testdata := map[string]string{"key": "value"}
+	nc := NewNamespaceController(func() map[string]string {
+		mu.Lock()
+		defer mu.Unlock()
+		return testdata
+	}, client)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	client.RunAndWait(stop)
+	nc.Run(stop)
+
+	createNamespace(t, client, "foo")
+	createNamespace(t, client, "bar")
+	expectConfigMap(t, client, "foo", testdata)
+	expectConfigMap(t, client, "bar", testdata)
+
+	newData := map[string]string{"key": "value", "crl.pem": "crl"}
+	mu.Lock()
+	testdata = newData
+	mu.Unlock()
+	retry.UntilSuccessOrFail(t, func() error {
+		if n := len(nc.configMapInformer.GetStore().List()); n != 2 {
+			return fmt.Errorf("expected 2 configmaps in the informer, got %d", n)
+		}
+		return nil
+	}, retry.Timeout(time.Second*2))
+	nc.Resync()
+	expectConfigMap(t, client, "foo", newData)
+	expectConfigMap(t, client, "bar", newData)
+}
+
 func deleteConfigMap(t *testing.T, client kubernetes.Interface, ns string) {
 	t.Helper()
 	if err := client.CoreV1().ConfigMaps(ns).Delete(context.TODO(), CACertNamespaceConfigMap, metav1.DeleteOptions{}); err != nil {
@@ -0,0 +1,177 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"fmt"
+	"time"
+
+	listener "github.com/envoyproxy/go-control-plane/envoy/config/listener/v3"
+	hcm "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/wellknown"
+	"github.com/golang/protobuf/ptypes"
+
+	"istio.io/istio/pilot/pkg/config/kube/crd"
+	"istio.io/istio/pilot/pkg/config/memory"
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/core/v1alpha3"
+	"istio.io/istio/pilot/pkg/networking/plugin"
+	"istio.io/istio/pilot/pkg/networking/plugin/registry"
+	"istio.io/istio/pilot/pkg/serviceregistry/aggregate"
+	"istio.io/istio/pilot/pkg/serviceregistry/serviceentry"
+	"istio.io/istio/pkg/config/mesh"
+	"istio.io/istio/pkg/config/schema/collections"
+)
+
+// syncTimeout is how long NewSimulationFromConfig waits for the service registry to process the configuration
+const syncTimeout = 10 * time.Second
+
+// NewSimulationFromConfig generates the configuration of a proxy from Istio configuration YAML and builds a
+// simulation from it. Services must be declared as ServiceEntries. Fields of the proxy that are not set
+// get the same defaults as in the tests.
+func NewSimulationFromConfig(configYAML string, proxy *model.Proxy) (*Simulation, error) {
+	configs, _, err := crd.ParseInputs(configYAML)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %v", err)
+	}
+
+	store := memory.MakeSkipValidation(collections.Pilot, true)
+	controller := memory.NewSyncController(store)
+	se := serviceentry.NewServiceDiscovery(controller, model.MakeIstioStore(store), noopXdsUpdater{})
+	serviceDiscovery := aggregate.NewController(aggregate.Options{})
+	serviceDiscovery.AddRegistry(se)
+
+	m := mesh.DefaultMeshConfig()
+	env := &model.Environment{
+		PushContext:      model.NewPushContext(),
+		ServiceDiscovery: serviceDiscovery,
+		IstioConfigStore: model.MakeIstioStore(controller),
+		Watcher:          mesh.NewFixedWatcher(&m),
+		NetworksWatcher:  mesh.NewFixedNetworksWatcher(nil),
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go controller.Run(stop)
+	now := time.Now()
+	for _, cfg := range configs {
+		if cfg.Namespace == "" {
+			cfg.Namespace = "default"
+		}
+		cfg.CreationTimestamp = now
+		if _, err := controller.Create(cfg); err != nil {
+			return nil, fmt.Errorf("failed to create config %s/%s: %v", cfg.Namespace, cfg.Name, err)
+		}
+	}
+	deadline := time.Now().Add(syncTimeout)
+	for !serviceDiscovery.HasSynced() {
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for the service registry to sync")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	se.ResyncEDS()
+	if err := env.PushContext.InitContext(env, nil, nil); err != nil {
+		return nil, fmt.Errorf("failed to initialize push context: %v", err)
+	}
+
+	proxy = setupProxy(env, proxy)
+	cg := v1alpha3.NewConfigGenerator(registry.NewPlugins([]string{plugin.Authn, plugin.Authz}), &model.DisabledCache{})
+	listeners := cg.BuildListeners(proxy, env.PushContext)
+	routeNames, err := extractRoutesFromListeners(listeners)
+	if err != nil {
+		return nil, err
+	}
+	return NewSimulation(listeners, cg.BuildClusters(proxy, env.PushContext),
+		cg.BuildHTTPRoutes(proxy, env.PushContext, routeNames)), nil
+}
+
+// setupProxy fills in the defaults of the proxy and initializes it for the environment, like
+// v1alpha3.ConfigGenTest.SetupProxy.
+func setupProxy(env *model.Environment, p *model.Proxy) *model.Proxy {
+	if p == nil {
+		p = &model.Proxy{}
+	}
+	if p.Metadata == nil {
+		p.Metadata = &model.NodeMetadata{}
+	}
+	if p.Metadata.IstioVersion == "" {
+		p.Metadata.IstioVersion = "1.9.0"
+	}
+	if p.IstioVersion == nil {
+		p.IstioVersion = model.ParseIstioVersion(p.Metadata.IstioVersion)
+	}
+	if p.Type == "" {
+		p.Type = model.SidecarProxy
+	}
+	if p.ConfigNamespace == "" {
+		p.ConfigNamespace = "default"
+	}
+	if p.Metadata.Namespace == "" {
+		p.Metadata.Namespace = p.ConfigNamespace
+	}
+	if p.ID == "" {
+		p.ID = "app.test"
+	}
+	if p.DNSDomain == "" {
+		p.DNSDomain = p.ConfigNamespace + ".svc.cluster.local"
+	}
+	if len(p.IPAddresses) == 0 {
+		p.IPAddresses = []string{"1.1.1.1"}
+	}
+
+	p.SetSidecarScope(env.PushContext)
+	p.SetGatewaysForProxy(env.PushContext)
+	p.SetServiceInstances(env.ServiceDiscovery)
+	p.DiscoverIPVersions()
+	return p
+}
+
+// extractRoutesFromListeners returns the names of the route configurations the listeners refer to.
+func extractRoutesFromListeners(ll []*listener.Listener) ([]string, error) {
+	routes := []string{}
+	for _, l := range ll {
+		for _, fc := range l.FilterChains {
+			for _, filter := range fc.Filters {
+				if filter.Name != wellknown.HTTPConnectionManager {
+					continue
+				}
+				h := &hcm.HttpConnectionManager{}
+				if err := ptypes.UnmarshalAny(filter.GetTypedConfig(), h); err != nil {
+					return nil, fmt.Errorf("failed to unmarshal hcm: %v", err)
+				}
+				if rds, ok := h.GetRouteSpecifier().(*hcm.HttpConnectionManager_Rds); ok {
+					routes = append(routes, rds.Rds.RouteConfigName)
+				}
+			}
+		}
+	}
+	return routes, nil
+}
+
+// noopXdsUpdater ignores the updates of the service registry, as the configuration is generated once.
+type noopXdsUpdater struct{}
+
+var _ model.XDSUpdater = noopXdsUpdater{}
+
+func (noopXdsUpdater) ConfigUpdate(*model.PushRequest) {}
+
+func (noopXdsUpdater) EDSUpdate(_, _, _ string, _ []*model.IstioEndpoint) {}
+
+func (noopXdsUpdater) EDSCacheUpdate(_, _, _ string, _ []*model.IstioEndpoint) {}
+
+func (noopXdsUpdater) SvcUpdate(_, _, _ string, _ model.Event) {}
+
+func (noopXdsUpdater) ProxyUpdate(_, _ string) {}
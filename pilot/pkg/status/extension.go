@@ -0,0 +1,127 @@
+// Copyright Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package status
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+
+	servicemeshv1alpha1 "istio.io/istio/pkg/servicemesh/apis/servicemesh/v1alpha1"
+)
+
+// writeAllExtensionStatus aggregates the distribution of each ServiceMeshExtension over all
+// reporters, and writes the status of the extensions whose distribution changed since it
+// was last written.
+func (c *DistributionController) writeAllExtensionStatus(ctx context.Context) (staleReporters []string) {
+	defer c.mu.Unlock()
+	c.mu.Lock()
+	for key, reporters := range c.ExtensionState {
+		distribution := ExtensionProgress{}
+		for reporter, progress := range reporters {
+			if c.clock.Since(c.ObservationTime[reporter]) > c.StaleInterval {
+				staleReporters = append(staleReporters, reporter)
+				continue
+			}
+			for url, p := range progress {
+				total := distribution[url]
+				total.PlusEquals(p)
+				distribution[url] = total
+			}
+		}
+		if written, ok := c.extensionsWritten[key]; ok && reflect.DeepEqual(written, distribution) {
+			continue
+		}
+		c.extensionsWritten[key] = distribution
+		go c.writeExtensionStatus(ctx, key)
+	}
+	return
+}
+
+func (c *DistributionController) writeExtensionStatus(ctx context.Context, key string) {
+	c.currentlyWriting.Lock(key)
+	defer c.currentlyWriting.Unlock(key)
+	// a newer distribution may have been recorded while waiting for the lock
+	c.mu.RLock()
+	distribution, ok := c.extensionsWritten[key]
+	c.mu.RUnlock()
+	if !ok {
+		return
+	}
+	namespace, name := splitExtensionKey(key)
+	client := c.extensionClient.ServiceMeshExtensions(namespace)
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		extension, err := client.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if !ReconcileExtensionStatus(&extension.Status, distribution) {
+			return nil
+		}
+		_, err = client.UpdateStatus(ctx, extension, metav1.UpdateOptions{})
+		return err
+	})
+	if err == nil {
+		return
+	}
+	defer c.mu.Unlock()
+	c.mu.Lock()
+	if errors.IsNotFound(err) {
+		// this extension has been deleted.  prune its state and move on.
+		delete(c.ExtensionState, key)
+		delete(c.extensionsWritten, key)
+		return
+	}
+	scope.Errorf("Encountered unexpected error updating status for extension %s, will try again later: %s", key, err)
+	delete(c.extensionsWritten, key)
+}
+
+// ReconcileExtensionStatus sets the number of proxies that applied the deployed module of a
+// ServiceMeshExtension and the AppliedToProxies condition. It returns true if the status changed.
+func ReconcileExtensionStatus(status *servicemeshv1alpha1.ServiceMeshExtensionStatus, distribution ExtensionProgress) bool {
+	progress := distribution[status.Deployment.URL]
+	condition := servicemeshv1alpha1.Condition{
+		Type:    servicemeshv1alpha1.ConditionTypeAppliedToProxies,
+		Status:  corev1.ConditionFalse,
+		Reason:  servicemeshv1alpha1.ConditionReasonProxiesPending,
+		Message: fmt.Sprintf("%d/%d proxies applied the module.", progress.AckedInstances, progress.TotalInstances),
+	}
+	if progress.TotalInstances == 0 && progress.AckedInstances == 0 {
+		condition.Reason = servicemeshv1alpha1.ConditionReasonNoMatchingProxies
+		condition.Message = "The module was not sent to any proxy."
+	} else if progress.TotalInstances > 0 && progress.AckedInstances >= progress.TotalInstances {
+		condition.Status = corev1.ConditionTrue
+		condition.Reason = servicemeshv1alpha1.ConditionReasonProxiesAcked
+	}
+	changed := status.SetCondition(condition)
+	if status.AckedProxies != progress.AckedInstances {
+		status.AckedProxies = progress.AckedInstances
+		changed = true
+	}
+	return changed
+}
+
+func splitExtensionKey(key string) (namespace, name string) {
+	if i := strings.Index(key, "/"); i >= 0 {
+		return key[:i], key[i+1:]
+	}
+	return "", key
+}
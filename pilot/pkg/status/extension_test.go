@@ -0,0 +1,141 @@
+// Copyright Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package status
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	corev1 "k8s.io/api/core/v1"
+
+	servicemeshv1alpha1 "istio.io/istio/pkg/servicemesh/apis/servicemesh/v1alpha1"
+)
+
+func TestReconcileExtensionStatus(t *testing.T) {
+	deployed := servicemeshv1alpha1.DeploymentStatus{Ready: true, URL: "http://mec/v2"}
+	tests := []struct {
+		name         string
+		status       servicemeshv1alpha1.ServiceMeshExtensionStatus
+		distribution ExtensionProgress
+		want         bool
+		wantStatus   servicemeshv1alpha1.ServiceMeshExtensionStatus
+	}{
+		{
+			name:   "All proxies acked the deployed module",
+			status: servicemeshv1alpha1.ServiceMeshExtensionStatus{Deployment: deployed},
+			distribution: ExtensionProgress{
+				"http://mec/v1": {AckedInstances: 1, TotalInstances: 0},
+				"http://mec/v2": {AckedInstances: 2, TotalInstances: 2},
+			},
+			want: true,
+			wantStatus: servicemeshv1alpha1.ServiceMeshExtensionStatus{
+				Deployment:   deployed,
+				AckedProxies: 2,
+				Conditions: []servicemeshv1alpha1.Condition{
+					{
+						Type:    servicemeshv1alpha1.ConditionTypeAppliedToProxies,
+						Status:  corev1.ConditionTrue,
+						Reason:  servicemeshv1alpha1.ConditionReasonProxiesAcked,
+						Message: "2/2 proxies applied the module.",
+					},
+				},
+			},
+		},
+		{
+			name: "Proxies still applying the deployed module",
+			status: servicemeshv1alpha1.ServiceMeshExtensionStatus{
+				Deployment:   deployed,
+				AckedProxies: 2,
+				Conditions: []servicemeshv1alpha1.Condition{
+					{
+						Type:    servicemeshv1alpha1.ConditionTypeAppliedToProxies,
+						Status:  corev1.ConditionTrue,
+						Reason:  servicemeshv1alpha1.ConditionReasonProxiesAcked,
+						Message: "2/2 proxies applied the module.",
+					},
+				},
+			},
+			distribution: ExtensionProgress{
+				"http://mec/v2": {AckedInstances: 2, TotalInstances: 3},
+			},
+			want: true,
+			wantStatus: servicemeshv1alpha1.ServiceMeshExtensionStatus{
+				Deployment:   deployed,
+				AckedProxies: 2,
+				Conditions: []servicemeshv1alpha1.Condition{
+					{
+						Type:    servicemeshv1alpha1.ConditionTypeAppliedToProxies,
+						Status:  corev1.ConditionFalse,
+						Reason:  servicemeshv1alpha1.ConditionReasonProxiesPending,
+						Message: "2/3 proxies applied the module.",
+					},
+				},
+			},
+		},
+		{
+			name:         "Module not sent to any proxy",
+			status:       servicemeshv1alpha1.ServiceMeshExtensionStatus{Deployment: deployed},
+			distribution: ExtensionProgress{},
+			want:         true,
+			wantStatus: servicemeshv1alpha1.ServiceMeshExtensionStatus{
+				Deployment: deployed,
+				Conditions: []servicemeshv1alpha1.Condition{
+					{
+						Type:    servicemeshv1alpha1.ConditionTypeAppliedToProxies,
+						Status:  corev1.ConditionFalse,
+						Reason:  servicemeshv1alpha1.ConditionReasonNoMatchingProxies,
+						Message: "The module was not sent to any proxy.",
+					},
+				},
+			},
+		},
+		{
+			name: "Don't Reconcile when nothing changed",
+			status: servicemeshv1alpha1.ServiceMeshExtensionStatus{
+				Deployment:   deployed,
+				AckedProxies: 1,
+				Conditions: []servicemeshv1alpha1.Condition{
+					{
+						Type:    servicemeshv1alpha1.ConditionTypeAppliedToProxies,
+						Status:  corev1.ConditionTrue,
+						Reason:  servicemeshv1alpha1.ConditionReasonProxiesAcked,
+						Message: "1/1 proxies applied the module.",
+					},
+				},
+			},
+			distribution: ExtensionProgress{
+				"http://mec/v2": {AckedInstances: 1, TotalInstances: 1},
+			},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := tt.status.DeepCopy()
+			got := ReconcileExtensionStatus(status, tt.distribution)
+			if got != tt.want {
+				t.Errorf("ReconcileExtensionStatus() got = %v, want %v", got, tt.want)
+			}
+			if !tt.want {
+				return
+			}
+			ignoreTime := cmpopts.IgnoreFields(servicemeshv1alpha1.Condition{}, "LastTransitionTime")
+			if !cmp.Equal(*status, tt.wantStatus, ignoreTime) {
+				t.Errorf("ReconcileExtensionStatus() status diff: %s", cmp.Diff(*status, tt.wantStatus, ignoreTime))
+			}
+		})
+	}
+}
@@ -28,8 +28,14 @@ type DistributionReport struct {
 	Reporter            string         `json:"reporter"`
 	DataPlaneCount      int            `json:"dataPlaneCount"`
 	InProgressResources map[string]int `json:"inProgressResources"`
+	// Extensions maps ServiceMeshExtensions, by namespace/name, to the
+	// distribution of their modules
+	Extensions map[string]ExtensionProgress `json:"extensions,omitempty" yaml:"extensions,omitempty"`
 }
 
+// ExtensionProgress is the distribution of the modules of a ServiceMeshExtension, by module URL
+type ExtensionProgress map[string]Progress
+
 func ReportFromYaml(content []byte) (DistributionReport, error) {
 	out := DistributionReport{}
 	err := yaml.Unmarshal(content, &out)
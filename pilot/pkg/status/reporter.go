@@ -56,7 +56,11 @@ type Reporter struct {
 	status map[string]string
 	// map from nonce to connection ids for which it is current
 	// using map[string]struct to approximate a hashset
-	reverseStatus          map[string]map[string]struct{}
+	reverseStatus map[string]map[string]struct{}
+	// maps from connection id to the ServiceMeshExtension modules, by extension,
+	// last sent to and acknowledged by the dataplane
+	extensionsSent         map[string]map[string]string
+	extensionsAcked        map[string]map[string]string
 	dirty                  bool
 	inProgressResources    map[string]*inProgressEntry
 	client                 v1.ConfigMapInterface
@@ -87,6 +91,8 @@ func (r *Reporter) Init(ledger ledger.Ledger) {
 	r.distributionEventQueue = make(chan distributionEvent, 100_000)
 	r.status = make(map[string]string)
 	r.reverseStatus = make(map[string]map[string]struct{})
+	r.extensionsSent = make(map[string]map[string]string)
+	r.extensionsAcked = make(map[string]map[string]string)
 	r.inProgressResources = make(map[string]*inProgressEntry)
 	go r.readFromEventQueue()
 }
@@ -145,11 +151,14 @@ func (r *Reporter) buildReport() (DistributionReport, []Resource) {
 		Reporter:            r.PodName,
 		DataPlaneCount:      len(r.status),
 		InProgressResources: map[string]int{},
+		Extensions:          r.buildExtensionReport(),
 	}
 	// for every resource in flight
 	for _, ipr := range r.inProgressResources {
 		res := ipr.Resource
 		key := res.String()
+		// report the resource even if no dataplane has it yet, so that its status shows the pending dataplanes
+		out.InProgressResources[key] = 0
 		// for every version (nonce) of the config currently in play
 		for nonce, dataplanes := range r.reverseStatus {
 
@@ -157,11 +166,7 @@ func (r *Reporter) buildReport() (DistributionReport, []Resource) {
 			// it might be more optimal to provide for a full dump of the config at a certain version?
 			dpVersion, err := r.ledger.GetPreviousValue(nonce, res.ToModelKey())
 			if err == nil && dpVersion == res.ResourceVersion {
-				if _, ok := out.InProgressResources[key]; !ok {
-					out.InProgressResources[key] = len(dataplanes)
-				} else {
-					out.InProgressResources[key] += len(dataplanes)
-				}
+				out.InProgressResources[key] += len(dataplanes)
 			} else if err != nil {
 				scope.Errorf("Encountered error retrieving version %s of key %s from Store: %v", nonce, key, err)
 				continue
@@ -180,6 +185,31 @@ func (r *Reporter) buildReport() (DistributionReport, []Resource) {
 	return out, finishedResources
 }
 
+// count the dataplanes that were sent and that acknowledged each ServiceMeshExtension module.
+// must have read lock before calling.
+func (r *Reporter) buildExtensionReport() map[string]ExtensionProgress {
+	out := map[string]ExtensionProgress{}
+	count := func(modules map[string]map[string]string, acked bool) {
+		for _, extensions := range modules {
+			for extension, url := range extensions {
+				if _, ok := out[extension]; !ok {
+					out[extension] = ExtensionProgress{}
+				}
+				progress := out[extension][url]
+				if acked {
+					progress.AckedInstances++
+				} else {
+					progress.TotalInstances++
+				}
+				out[extension][url] = progress
+			}
+		}
+	}
+	count(r.extensionsSent, false)
+	count(r.extensionsAcked, true)
+	return out
+}
+
 // For efficiency, we don't want to be checking on resources that have already reached 100% distribution.
 // When this happens, we remove them from our watch list.
 func (r *Reporter) removeCompletedResource(completedResources []Resource) {
@@ -331,6 +361,19 @@ func (r *Reporter) deleteKeyFromReverseMap(key string) {
 	}
 }
 
+// Register the ServiceMeshExtension modules in the listeners or extension configs that were sent to a dataplane, or
+// that the dataplane acknowledged.
+func (r *Reporter) RegisterExtensions(conID string, modules map[string]string, acked bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.dirty = true
+	if acked {
+		r.extensionsAcked[conID] = modules
+	} else {
+		r.extensionsSent[conID] = modules
+	}
+}
+
 // When a dataplane disconnects, we should no longer count it, nor expect it to ack config.
 func (r *Reporter) RegisterDisconnect(conID string, types []xds.EventType) {
 	r.mu.Lock()
@@ -341,4 +384,6 @@ func (r *Reporter) RegisterDisconnect(conID string, types []xds.EventType) {
 		r.deleteKeyFromReverseMap(key)
 		delete(r.status, key)
 	}
+	delete(r.extensionsSent, conID)
+	delete(r.extensionsAcked, conID)
 }
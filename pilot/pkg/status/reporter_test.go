@@ -55,6 +55,8 @@ func initReporterWithoutStarting() (out Reporter) {
 	out.cm = nil // TODO
 	out.reverseStatus = make(map[string]map[string]struct{})
 	out.status = make(map[string]string)
+	out.extensionsSent = make(map[string]map[string]string)
+	out.extensionsAcked = make(map[string]map[string]string)
 	return
 }
 
@@ -123,4 +125,34 @@ func TestBuildReport(t *testing.T) {
 		myResources[2].String(): 2,
 	}))
 	Expect(r.inProgressResources).NotTo(ContainElement(resources[0]))
+
+	// a new version that no dataplane acked yet is reported as pending on all dataplanes
+	resources[2].ResourceVersion = "2"
+	myResources[2].ResourceVersion = "2"
+	r.AddInProgressResource(*resources[2])
+	rpt, _ = r.buildReport()
+	Expect(rpt.InProgressResources).To(HaveKeyWithValue(myResources[2].String(), 0))
+}
+
+func TestBuildExtensionReport(t *testing.T) {
+	RegisterTestingT(t)
+	r := initReporterWithoutStarting()
+	r.ledger = ledger.Make(time.Minute)
+	// conA and conB applied v1 of the extension, conB was sent v2 but did not ack it yet
+	r.RegisterExtensions("conA", map[string]string{"default/ext": "http://mec/v1"}, false)
+	r.RegisterExtensions("conA", map[string]string{"default/ext": "http://mec/v1"}, true)
+	r.RegisterExtensions("conB", map[string]string{"default/ext": "http://mec/v1"}, false)
+	r.RegisterExtensions("conB", map[string]string{"default/ext": "http://mec/v1"}, true)
+	r.RegisterExtensions("conB", map[string]string{"default/ext": "http://mec/v2"}, false)
+	// conC applied v2 and another extension, but disconnected
+	r.RegisterExtensions("conC", map[string]string{"default/ext": "http://mec/v2", "default/other": "http://mec/v3"}, false)
+	r.RegisterExtensions("conC", map[string]string{"default/ext": "http://mec/v2", "default/other": "http://mec/v3"}, true)
+	r.RegisterDisconnect("conC", []xds.EventType{""})
+	rpt, _ := r.buildReport()
+	Expect(rpt.Extensions).To(Equal(map[string]ExtensionProgress{
+		"default/ext": {
+			"http://mec/v1": Progress{AckedInstances: 2, TotalInstances: 1},
+			"http://mec/v2": Progress{AckedInstances: 0, TotalInstances: 1},
+		},
+	}))
 }
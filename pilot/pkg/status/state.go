@@ -36,6 +36,7 @@ import (
 
 	"istio.io/api/meta/v1alpha1"
 	"istio.io/istio/pilot/pkg/features"
+	v1alpha1client "istio.io/istio/pkg/servicemesh/client/v1alpha1/clientset/versioned/typed/servicemesh/v1alpha1"
 	"istio.io/pkg/log"
 )
 
@@ -63,16 +64,25 @@ type DistributionController struct {
 	currentlyWriting ResourceLock
 	StaleInterval    time.Duration
 	cmInformer       cache.SharedIndexInformer
+	// the distribution last written to the status of each resource, used to skip unchanged writes
+	statusWritten map[Resource]Progress
+	// map from ServiceMeshExtension key to the distribution reported by each reporter
+	ExtensionState    map[string]map[string]ExtensionProgress
+	extensionsWritten map[string]ExtensionProgress
+	extensionClient   v1alpha1client.ServicemeshV1alpha1Interface
 }
 
 func NewController(restConfig rest.Config, namespace string) *DistributionController {
 	c := &DistributionController{
-		CurrentState:    make(map[Resource]map[string]Progress),
-		ObservationTime: make(map[string]time.Time),
-		knownResources:  make(map[schema.GroupVersionResource]dynamic.NamespaceableResourceInterface),
-		UpdateInterval:  200 * time.Millisecond,
-		StaleInterval:   time.Minute,
-		clock:           clock.RealClock{},
+		CurrentState:      make(map[Resource]map[string]Progress),
+		statusWritten:     make(map[Resource]Progress),
+		ObservationTime:   make(map[string]time.Time),
+		knownResources:    make(map[schema.GroupVersionResource]dynamic.NamespaceableResourceInterface),
+		UpdateInterval:    200 * time.Millisecond,
+		StaleInterval:     time.Minute,
+		clock:             clock.RealClock{},
+		ExtensionState:    make(map[string]map[string]ExtensionProgress),
+		extensionsWritten: make(map[string]ExtensionProgress),
 	}
 
 	// client-go defaults to 5 QPS, with 10 Boost, which is insufficient for updating status on all the config
@@ -83,6 +93,9 @@ func NewController(restConfig rest.Config, namespace string) *DistributionContro
 	if c.dynamicClient, err = dynamic.NewForConfig(&restConfig); err != nil {
 		scope.Fatalf("Could not connect to kubernetes: %s", err)
 	}
+	if c.extensionClient, err = v1alpha1client.NewForConfig(&restConfig); err != nil {
+		scope.Fatalf("Could not create ServiceMeshExtension client: %s", err)
+	}
 
 	// configmap informer
 	i := informers.NewSharedInformerFactoryWithOptions(kubernetes.NewForConfigOrDie(&restConfig), 1*time.Minute,
@@ -114,6 +127,7 @@ func (c *DistributionController) Start(stop <-chan struct{}) {
 				return
 			case <-t:
 				staleReporters := c.writeAllStatus(ctx)
+				staleReporters = append(staleReporters, c.writeAllExtensionStatus(ctx)...)
 				if len(staleReporters) > 0 {
 					c.removeStaleReporters(staleReporters)
 				}
@@ -132,12 +146,24 @@ func (c *DistributionController) handleReport(d DistributionReport) {
 		}
 		c.CurrentState[res][d.Reporter] = Progress{d.InProgressResources[resstr], d.DataPlaneCount}
 	}
+	for _, reporters := range c.ExtensionState {
+		delete(reporters, d.Reporter)
+	}
+	for key, progress := range d.Extensions {
+		if _, ok := c.ExtensionState[key]; !ok {
+			c.ExtensionState[key] = make(map[string]ExtensionProgress)
+		}
+		c.ExtensionState[key][d.Reporter] = progress
+	}
 	c.ObservationTime[d.Reporter] = c.clock.Now()
 }
 
+// writeAllStatus aggregates the distribution of each resource over all reporters, and writes the
+// status of the resources whose distribution changed since it was last written. Together with the
+// QPS of the client, this bounds the writes to the API server when many proxies ack config.
 func (c *DistributionController) writeAllStatus(ctx context.Context) (staleReporters []string) {
-	defer c.mu.RUnlock()
-	c.mu.RLock()
+	defer c.mu.Unlock()
+	c.mu.Lock()
 	for config, fractions := range c.CurrentState {
 		var distributionState Progress
 		for reporter, w := range fractions {
@@ -150,9 +176,14 @@ func (c *DistributionController) writeAllStatus(ctx context.Context) (staleRepor
 				distributionState.PlusEquals(w)
 			}
 		}
-		if distributionState.TotalInstances > 0 { // this is necessary when all reports are stale.
-			go c.writeStatus(ctx, config, distributionState)
+		if distributionState.TotalInstances == 0 { // this is necessary when all reports are stale.
+			continue
 		}
+		if written, ok := c.statusWritten[config]; ok && written == distributionState {
+			continue
+		}
+		c.statusWritten[config] = distributionState
+		go c.writeStatus(ctx, config, distributionState)
 	}
 	return
 }
@@ -183,6 +214,9 @@ func (c *DistributionController) writeStatus(ctx context.Context, config Resourc
 			return
 		}
 		scope.Errorf("Encountered unexpected error when retrieving status for %v: %s", config, err)
+		c.mu.Lock()
+		delete(c.statusWritten, config)
+		c.mu.Unlock()
 		return
 
 	}
@@ -199,6 +233,9 @@ func (c *DistributionController) writeStatus(ctx context.Context, config Resourc
 		_, err := resourceInterface.UpdateStatus(ctx, current, metav1.UpdateOptions{})
 		if err != nil {
 			scope.Errorf("Encountered unexpected error updating status for %v, will try again later: %s", config, err)
+			c.mu.Lock()
+			delete(c.statusWritten, config)
+			c.mu.Unlock()
 			return
 		}
 	}
@@ -208,6 +245,7 @@ func (c *DistributionController) pruneOldVersion(config Resource) {
 	defer c.mu.Unlock()
 	c.mu.Lock()
 	delete(c.CurrentState, config)
+	delete(c.statusWritten, config)
 }
 
 func (c *DistributionController) removeStaleReporters(staleReporters []string) {
@@ -219,6 +257,11 @@ func (c *DistributionController) removeStaleReporters(staleReporters []string) {
 		}
 		c.CurrentState[key] = fractions
 	}
+	for _, reporters := range c.ExtensionState {
+		for _, staleReporter := range staleReporters {
+			delete(reporters, staleReporter)
+		}
+	}
 }
 
 func GetTypedStatus(in interface{}) (out v1alpha1.IstioStatus, err error) {
@@ -236,14 +279,17 @@ func boolToConditionStatus(b bool) string {
 	return "False"
 }
 
+// ReconcileStatuses sets the Reconciled condition, with the number of proxies up to date out of all the proxies,
+// and the generation of the resource observed by the proxies. It returns true if the status changed.
 func ReconcileStatuses(current map[string]interface{}, desired Progress, generation int64) (bool, *v1alpha1.IstioStatus) {
 	needsReconcile := false
 	currentStatus, err := GetTypedStatus(current["status"])
+	now := types.TimestampNow()
 	desiredCondition := v1alpha1.IstioCondition{
 		Type:               "Reconciled",
-		Status:             boolToConditionStatus(desired.AckedInstances == desired.TotalInstances),
-		LastProbeTime:      types.TimestampNow(),
-		LastTransitionTime: types.TimestampNow(),
+		Status:             boolToConditionStatus(desired.AckedInstances >= desired.TotalInstances),
+		LastProbeTime:      now,
+		LastTransitionTime: now,
 		Message:            fmt.Sprintf("%d/%d proxies up to date.", desired.AckedInstances, desired.TotalInstances),
 	}
 	if err != nil {
@@ -266,9 +312,15 @@ func ReconcileStatuses(current map[string]interface{}, desired Progress, generat
 	}
 	if currentCondition == nil ||
 		currentCondition.Message != desiredCondition.Message ||
-		currentCondition.Status != desiredCondition.Status {
+		currentCondition.Status != desiredCondition.Status ||
+		currentStatus.ObservedGeneration != generation {
 		needsReconcile = true
 	}
+	if currentCondition != nil && currentCondition.Status == desiredCondition.Status &&
+		currentCondition.LastTransitionTime != nil {
+		// the condition only transitions when its status changes
+		desiredCondition.LastTransitionTime = currentCondition.LastTransitionTime
+	}
 	if conditionIndex > -1 {
 		currentStatus.Conditions[conditionIndex] = &desiredCondition
 	} else {
@@ -19,6 +19,8 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/gogo/protobuf/types"
+
 	"istio.io/api/meta/v1alpha1"
 )
 
@@ -36,6 +38,7 @@ var statusStillPropagating = v1alpha1.IstioStatus{
 		},
 	},
 	ValidationMessages: nil,
+	ObservedGeneration: 1234,
 }
 
 func TestReconcileStatuses(t *testing.T) {
@@ -141,6 +144,31 @@ func TestReconcileStatuses(t *testing.T) {
 				},
 				ObservedGeneration: int64(1234),
 			},
+		}, {
+			name: "Reconcile for generation difference",
+			args: args{
+				current: map[string]interface{}{"status": v1alpha1.IstioStatus{
+					Conditions:         statusStillPropagating.Conditions,
+					ObservedGeneration: 1233,
+				}},
+				desired: Progress{1, 2},
+			},
+			want: true,
+			want1: &v1alpha1.IstioStatus{
+				Conditions: []*v1alpha1.IstioCondition{
+					{
+						Type:    "PassedValidation",
+						Status:  "True",
+						Message: "just a test, here",
+					},
+					{
+						Type:    "Reconciled",
+						Status:  "False",
+						Message: "1/2 proxies up to date.",
+					},
+				},
+				ObservedGeneration: int64(1234),
+			},
 		},
 	}
 	for _, tt := range tests {
@@ -164,6 +192,27 @@ func TestReconcileStatuses(t *testing.T) {
 	}
 }
 
+func TestReconcileStatusesTransitionTime(t *testing.T) {
+	transition := &types.Timestamp{Seconds: 1000}
+	current := map[string]interface{}{"status": v1alpha1.IstioStatus{
+		Conditions: []*v1alpha1.IstioCondition{{
+			Type:               "Reconciled",
+			Status:             "False",
+			LastTransitionTime: transition,
+			Message:            "1/3 proxies up to date.",
+		}},
+	}}
+
+	_, got := ReconcileStatuses(current, Progress{2, 3}, 1)
+	if tt := got.Conditions[0].LastTransitionTime; !reflect.DeepEqual(tt, transition) {
+		t.Errorf("expected the transition time to be kept while the condition status is unchanged, got %v", tt)
+	}
+	_, got = ReconcileStatuses(current, Progress{3, 3}, 1)
+	if tt := got.Conditions[0].LastTransitionTime; reflect.DeepEqual(tt, transition) {
+		t.Errorf("expected the transition time to be updated when the condition status changes")
+	}
+}
+
 func Test_getTypedStatus(t *testing.T) {
 	x := v1alpha1.IstioStatus{}
 	b, _ := json.Marshal(statusStillPropagating)
@@ -15,6 +15,7 @@
 package xds
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -33,6 +34,7 @@ import (
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/networking/util"
 	v3 "istio.io/istio/pilot/pkg/xds/v3"
+	maistramodel "istio.io/istio/pkg/servicemesh/model"
 	"istio.io/istio/pkg/spiffe"
 	istiolog "istio.io/pkg/log"
 )
@@ -79,12 +81,20 @@ type Connection struct {
 	// Both ADS and SDS streams implement this interface
 	stream DiscoveryStream
 
+	// deltaStream is set instead of stream for delta ADS connections
+	deltaStream DeltaDiscoveryStream
+
 	// Original node metadata, to avoid unmarshal/marshal.
 	// This is included in internal events.
 	node *core.Node
 
 	// stop can be used to end the connection manually via debug endpoints. Only to be used for testing.
 	stop chan struct{}
+
+	// extensionModules are the ServiceMeshExtension modules contained in the last
+	// listeners or extension configs sent, which were sent with extensionNonce
+	extensionModules map[string]string
+	extensionNonce   string
 }
 
 // Event represents a config or registry event that results in a push.
@@ -172,10 +182,15 @@ func (s *DiscoveryServer) receive(con *Connection, reqChannel chan *discovery.Di
 // handles 'push' requests and close - the code will eventually call the 'push' code, and it needs more mutex
 // protection. Original code avoided the mutexes by doing both 'push' and 'process requests' in same thread.
 func (s *DiscoveryServer) processRequest(req *discovery.DiscoveryRequest, con *Connection) error {
-	if s.StatusReporter != nil {
-		s.StatusReporter.RegisterEvent(con.ConID, req.TypeUrl, req.ResponseNonce)
+	if req.TypeUrl == maistramodel.WasmHealthTypeURL {
+		if s.ExtensionHealth != nil {
+			s.ExtensionHealth.ReportFailures(con.proxy, s.globalPushContext(), maistramodel.WasmFailures(req))
+		}
+		return nil
 	}
 
+	s.reportRequest(con, req.TypeUrl, req.ResponseNonce, req.ErrorDetail == nil)
+
 	if !s.shouldRespond(con, req) {
 		return nil
 	}
@@ -185,6 +200,18 @@ func (s *DiscoveryServer) processRequest(req *discovery.DiscoveryRequest, con *C
 	return s.pushXds(con, push, versionInfo(), con.Watched(req.TypeUrl), &model.PushRequest{Full: true})
 }
 
+// reportRequest informs the status reporter of a request, which may ACK a response
+func (s *DiscoveryServer) reportRequest(con *Connection, typeURL, responseNonce string, ack bool) {
+	if s.StatusReporter == nil {
+		return
+	}
+	s.StatusReporter.RegisterEvent(con.ConID, typeURL, responseNonce)
+	if typeURL == extensionDeliveryType() && ack &&
+		con.extensionNonce != "" && responseNonce == con.extensionNonce {
+		s.StatusReporter.RegisterExtensions(con.ConID, con.extensionModules, true)
+	}
+}
+
 // StreamAggregatedResources implements the ADS interface.
 func (s *DiscoveryServer) StreamAggregatedResources(stream discovery.AggregatedDiscoveryService_StreamAggregatedResourcesServer) error {
 	// Check if server is ready to accept clients and process new requests.
@@ -195,33 +222,10 @@ func (s *DiscoveryServer) StreamAggregatedResources(stream discovery.AggregatedD
 	// cachesSynced logic to readiness probe to handle cases where kube-proxy
 	// ip tables update latencies.
 	// See https://github.com/istio/istio/issues/25495.
-	if !s.IsServerReady() {
-		return errors.New("server is not ready to serve discovery information")
-	}
-
-	ctx := stream.Context()
-	peerAddr := "0.0.0.0"
-	if peerInfo, ok := peer.FromContext(ctx); ok {
-		peerAddr = peerInfo.Addr.String()
-	}
-
-	ids, err := s.authenticate(ctx)
+	peerAddr, ids, err := s.initStream(stream.Context())
 	if err != nil {
 		return err
 	}
-	if ids != nil {
-		adsLog.Debugf("Authenticated XDS: %v with identity %v", peerAddr, ids)
-	} else {
-		adsLog.Debuga("Unauthenticated XDS: ", peerAddr)
-	}
-
-	// InitContext returns immediately if the context was already initialized.
-	if err = s.globalPushContext().InitContext(s.Env, nil, nil); err != nil {
-		// Error accessing the data - log and close, maybe a different pilot replica
-		// has more luck
-		adsLog.Warnf("Error reading config %v", err)
-		return err
-	}
 	con := newConnection(peerAddr, stream)
 	con.Identities = ids
 
@@ -275,6 +279,38 @@ func (s *DiscoveryServer) StreamAggregatedResources(stream discovery.AggregatedD
 	}
 }
 
+// initStream checks that the server is ready and authenticates the client of a new ADS stream. It
+// returns the address and identities of the client.
+func (s *DiscoveryServer) initStream(ctx context.Context) (string, []string, error) {
+	if !s.IsServerReady() {
+		return "", nil, errors.New("server is not ready to serve discovery information")
+	}
+
+	peerAddr := "0.0.0.0"
+	if peerInfo, ok := peer.FromContext(ctx); ok {
+		peerAddr = peerInfo.Addr.String()
+	}
+
+	ids, err := s.authenticate(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	if ids != nil {
+		adsLog.Debugf("Authenticated XDS: %v with identity %v", peerAddr, ids)
+	} else {
+		adsLog.Debuga("Unauthenticated XDS: ", peerAddr)
+	}
+
+	// InitContext returns immediately if the context was already initialized.
+	if err = s.globalPushContext().InitContext(s.Env, nil, nil); err != nil {
+		// Error accessing the data - log and close, maybe a different pilot replica
+		// has more luck
+		adsLog.Warnf("Error reading config %v", err)
+		return "", nil, err
+	}
+	return peerAddr, ids, nil
+}
+
 // shouldRespond determines whether this request needs to be responded back. It applies the ack/nack rules as per xds protocol
 // using WatchedResource for previous state and discovery request for the current state.
 func (s *DiscoveryServer) shouldRespond(con *Connection, request *discovery.DiscoveryRequest) bool {
@@ -479,6 +515,8 @@ func (s *DiscoveryServer) initProxy(node *core.Node, con *Connection) (*model.Pr
 	}
 	// Update the config namespace associated with this proxy
 	proxy.ConfigNamespace = model.GetProxyConfigNamespace(proxy)
+	proxy.UserAgentName = node.GetUserAgentName()
+	proxy.UserAgentVersion = node.GetUserAgentVersion()
 
 	// this should be done before we look for service instances, but after we load metadata
 	// TODO fix check in kubecontroller treat echo VMs like there isn't a pod
@@ -534,18 +572,6 @@ func (s *DiscoveryServer) setProxyState(proxy *model.Proxy, push *model.PushCont
 	proxy.SetGatewaysForProxy(push)
 }
 
-// DeltaAggregatedResources is not implemented.
-// Instead, Generators may send only updates/add, with Delete indicated by an empty spec.
-// This works if both ends follow this model. For example EDS and the API generator follow this
-// pattern.
-//
-// The delta protocol changes the request, adding unsubscribe/subscribe instead of sending full
-// list of resources. On the response it adds 'removed resources' and sends changes for everything.
-// TODO: we could implement this method if needed, the change is not very big.
-func (s *DiscoveryServer) DeltaAggregatedResources(stream discovery.AggregatedDiscoveryService_DeltaAggregatedResourcesServer) error {
-	return status.Errorf(codes.Unimplemented, "not implemented")
-}
-
 // Compute and send the new configuration for a connection. This is blocking and may be slow
 // for large configs. The method will hold a lock on con.pushMutex.
 func (s *DiscoveryServer) pushConnection(con *Connection, pushEv *Event) error {
@@ -856,6 +882,14 @@ func (conn *Connection) Watched(typeUrl string) *model.WatchedResource {
 	return nil
 }
 
+// streamContext returns the context of the stream of the connection
+func (conn *Connection) streamContext() context.Context {
+	if conn.deltaStream != nil {
+		return conn.deltaStream.Context()
+	}
+	return conn.stream.Context()
+}
+
 func (conn *Connection) Stop() {
 	conn.stop <- struct{}{}
 }
@@ -37,6 +37,7 @@ import (
 	"istio.io/istio/pilot/test/xdstest"
 	"istio.io/istio/pkg/config"
 	"istio.io/istio/pkg/config/schema/collections"
+	"istio.io/istio/pkg/config/schema/gvk"
 	"istio.io/istio/pkg/spiffe"
 	"istio.io/pkg/env"
 	"istio.io/pkg/log"
@@ -275,6 +276,97 @@ func BenchmarkEndpointGeneration(b *testing.B) {
 	}
 }
 
+// BenchmarkXdsCache measures concurrent cache reads and writes, as done by parallel pushes, with
+// different numbers of shards.
+func BenchmarkXdsCache(b *testing.B) {
+	const keys = 1000
+	entries := make([]fakeCacheEntry, 0, keys)
+	for i := 0; i < keys; i++ {
+		entries = append(entries, fakeCacheEntry{
+			key:        fmt.Sprintf("outbound|80||foo-%d.com", i),
+			typeURL:    v3.EndpointType,
+			dependents: []model.ConfigKey{{Kind: gvk.ServiceEntry, Name: fmt.Sprintf("foo-%d.com", i)}},
+		})
+	}
+	value := &any.Any{TypeUrl: v3.EndpointType, Value: make([]byte, 1024)}
+	for _, shards := range []int{1, 16} {
+		b.Run(fmt.Sprintf("shards-%d", shards), func(b *testing.B) {
+			c := model.NewXdsCacheWithOptions(model.XdsCacheOptions{MaxEntries: keys / 2, Shards: shards})
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					e := entries[i%keys]
+					if _, f := c.Get(e); !f {
+						c.Add(e, value)
+					}
+					i++
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkXdsCacheGet measures concurrent cache hits, which only take the read lock of their shard.
+func BenchmarkXdsCacheGet(b *testing.B) {
+	const keys = 1000
+	entries := make([]fakeCacheEntry, 0, keys)
+	for i := 0; i < keys; i++ {
+		entries = append(entries, fakeCacheEntry{key: fmt.Sprintf("outbound|80||foo-%d.com", i), typeURL: v3.EndpointType})
+	}
+	value := &any.Any{TypeUrl: v3.EndpointType, Value: make([]byte, 1024)}
+	for name, opts := range map[string]model.XdsCacheOptions{
+		"unbounded": {},
+		"bounded":   {MaxEntries: keys},
+	} {
+		b.Run(name, func(b *testing.B) {
+			c := model.NewXdsCacheWithOptions(opts)
+			for _, e := range entries {
+				c.Add(e, value)
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					c.Get(entries[i%keys])
+					i++
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkXdsCacheClear measures invalidating a single config in a full cache.
+func BenchmarkXdsCacheClear(b *testing.B) {
+	const keys = 10000
+	value := &any.Any{TypeUrl: v3.EndpointType, Value: make([]byte, 1024)}
+	for _, shards := range []int{1, 16} {
+		b.Run(fmt.Sprintf("shards-%d", shards), func(b *testing.B) {
+			c := model.NewXdsCacheWithOptions(model.XdsCacheOptions{Shards: shards})
+			fill := func() {
+				for i := 0; i < keys; i++ {
+					c.Add(fakeCacheEntry{
+						key:        fmt.Sprintf("outbound|80||foo-%d.com", i),
+						typeURL:    v3.EndpointType,
+						dependents: []model.ConfigKey{{Kind: gvk.ServiceEntry, Name: fmt.Sprintf("foo-%d.com", i%100)}},
+					}, value)
+				}
+			}
+			fill()
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				if n%100 == 0 {
+					// Every config has been cleared, refill the cache
+					b.StopTimer()
+					fill()
+					b.StartTimer()
+				}
+				c.Clear(map[model.ConfigKey]struct{}{{Kind: gvk.ServiceEntry, Name: fmt.Sprintf("foo-%d.com", n%100)}: {}})
+			}
+		})
+	}
+}
+
 // Setup test builds a mock test environment. Note: push context is not initialized, to be able to benchmark separately
 // most should just call setupAndInitializeTest
 func setupTest(t testing.TB, config ConfigInput) (*FakeDiscoveryServer, *model.Proxy) {
@@ -19,6 +19,7 @@ import (
 	"istio.io/istio/pilot/pkg/networking/util"
 	"istio.io/istio/pkg/config"
 	"istio.io/istio/pkg/config/schema/gvk"
+	maistramodel "istio.io/istio/pkg/servicemesh/model"
 )
 
 type CdsGenerator struct {
@@ -35,6 +36,8 @@ var skippedCdsConfigs = map[config.GroupVersionKind]struct{}{
 	gvk.AuthorizationPolicy:   {},
 	gvk.RequestAuthentication: {},
 	gvk.Secret:                {},
+
+	maistramodel.ServiceMeshExtensionKind: {},
 }
 
 // Map all configs that impacts CDS for gateways.
@@ -0,0 +1,471 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"errors"
+	"hash/fnv"
+	"strconv"
+	"time"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/golang/protobuf/ptypes/any"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"istio.io/istio/pilot/pkg/model"
+	v3 "istio.io/istio/pilot/pkg/xds/v3"
+	maistramodel "istio.io/istio/pkg/servicemesh/model"
+)
+
+// DeltaDiscoveryStream is an interface for delta ADS.
+type DeltaDiscoveryStream interface {
+	Send(*discovery.DeltaDiscoveryResponse) error
+	Recv() (*discovery.DeltaDiscoveryRequest, error)
+	grpc.ServerStream
+}
+
+// namedTypes are the types whose resources carry their name in their first field
+var namedTypes = map[string]struct{}{
+	v3.ClusterType:                {},
+	v3.EndpointType:               {},
+	v3.ListenerType:               {},
+	v3.RouteType:                  {},
+	v3.SecretType:                 {},
+	v3.ExtensionConfigurationType: {},
+}
+
+func newDeltaConnection(peerAddr string, stream DeltaDiscoveryStream) *Connection {
+	return &Connection{
+		pushChannel: make(chan *Event),
+		stop:        make(chan struct{}),
+		PeerAddr:    peerAddr,
+		Connect:     time.Now(),
+		deltaStream: stream,
+	}
+}
+
+// DeltaAggregatedResources implements the delta ADS interface. Clients subscribe to and unsubscribe
+// from resources instead of sending the full list of resources they watch, and only receive the
+// resources that changed along with the names of the resources that were removed.
+func (s *DiscoveryServer) DeltaAggregatedResources(stream discovery.AggregatedDiscoveryService_DeltaAggregatedResourcesServer) error {
+	peerAddr, ids, err := s.initStream(stream.Context())
+	if err != nil {
+		return err
+	}
+	con := newDeltaConnection(peerAddr, stream)
+	con.Identities = ids
+
+	var receiveError error
+	reqChannel := make(chan *discovery.DeltaDiscoveryRequest, 1)
+	go s.receiveDelta(con, reqChannel, &receiveError)
+
+	for {
+		select {
+		case req, ok := <-reqChannel:
+			if !ok {
+				// Remote side closed connection or error processing the request.
+				return receiveError
+			}
+			err := s.processDeltaRequest(req, con)
+			if err != nil {
+				return err
+			}
+
+		case pushEv := <-con.pushChannel:
+			err := s.pushConnection(con, pushEv)
+			pushEv.done()
+			if err != nil {
+				return err
+			}
+		case <-con.stop:
+			return nil
+		}
+	}
+}
+
+func (s *DiscoveryServer) receiveDelta(con *Connection, reqChannel chan *discovery.DeltaDiscoveryRequest, errP *error) {
+	defer close(reqChannel) // indicates close of the remote side.
+	firstReq := true
+	for {
+		req, err := con.deltaStream.Recv()
+		if err != nil {
+			if isExpectedGRPCError(err) {
+				adsLog.Infof("ADS: %q %s terminated %v", con.PeerAddr, con.ConID, err)
+				return
+			}
+			*errP = err
+			adsLog.Errorf("ADS: %q %s terminated with error: %v", con.PeerAddr, con.ConID, err)
+			totalXDSInternalErrors.Increment()
+			return
+		}
+		// This should be only set for the first request. The node id may not be set - for example malicious clients.
+		if firstReq {
+			firstReq = false
+			if req.Node == nil || req.Node.Id == "" {
+				*errP = errors.New("missing node ID")
+				return
+			}
+			if err := s.initConnection(req.Node, con); err != nil {
+				*errP = err
+				return
+			}
+			adsLog.Infof("ADS: new delta connection for node:%s", con.ConID)
+			defer func() {
+				s.removeCon(con.ConID)
+				if s.InternalGen != nil {
+					s.InternalGen.OnDisconnect(con)
+				}
+			}()
+		}
+
+		select {
+		case reqChannel <- req:
+		case <-con.deltaStream.Context().Done():
+			adsLog.Infof("ADS: %q %s terminated with stream closed", con.PeerAddr, con.ConID)
+			return
+		}
+	}
+}
+
+func (s *DiscoveryServer) processDeltaRequest(req *discovery.DeltaDiscoveryRequest, con *Connection) error {
+	if req.TypeUrl == maistramodel.WasmHealthTypeURL {
+		if s.ExtensionHealth != nil {
+			s.ExtensionHealth.ReportFailures(con.proxy, s.globalPushContext(), maistramodel.WasmFailures(toDiscoveryRequest(req, nil)))
+		}
+		return nil
+	}
+
+	s.reportRequest(con, req.TypeUrl, req.ResponseNonce, req.ErrorDetail == nil)
+
+	if !s.shouldRespondDelta(con, req) {
+		return nil
+	}
+
+	push := s.globalPushContext()
+
+	return s.pushDeltaXds(con, push, versionInfo(), con.Watched(req.TypeUrl), &model.PushRequest{Full: true})
+}
+
+// shouldRespondDelta determines whether this request needs to be responded back. It updates the
+// subscriptions of the connection: clients only send the names of the resources they subscribe to
+// or unsubscribe from, and only newly subscribed resources need a response.
+func (s *DiscoveryServer) shouldRespondDelta(con *Connection, request *discovery.DeltaDiscoveryRequest) bool {
+	stype := v3.GetShortType(request.TypeUrl)
+
+	if request.ErrorDetail != nil {
+		errCode := codes.Code(request.ErrorDetail.Code)
+		adsLog.Warnf("ADS:%s: ACK ERROR %s %s:%s", stype, con.ConID, errCode.String(), request.ErrorDetail.GetMessage())
+		incrementXDSRejects(request.TypeUrl, con.proxy.ID, errCode.String())
+		if s.InternalGen != nil {
+			s.InternalGen.OnNack(con.proxy, toDiscoveryRequest(request, nil))
+		}
+		return false
+	}
+
+	wildcard := isWildcardTypeURL(request.TypeUrl)
+
+	con.proxy.Lock()
+	defer con.proxy.Unlock()
+	previousInfo := con.proxy.WatchedResources[request.TypeUrl]
+
+	// This is the first request for this type, either on a new stream or after Envoy reconnected.
+	// The initial resource versions are the resources Envoy already has, which need not be sent again.
+	if previousInfo == nil {
+		names := updateSubscriptions(nil, request.ResourceNamesSubscribe, nil)
+		if !wildcard && len(names) == 0 {
+			adsLog.Debugf("ADS:%s: UNSUBSCRIBE %s %s", stype, con.ConID, request.ResponseNonce)
+			return false
+		}
+		if wildcard {
+			names = nil
+		}
+		adsLog.Debugf("ADS:%s: INIT %s %s", stype, con.ConID, request.ResponseNonce)
+		versions := make(map[string]string, len(request.InitialResourceVersions))
+		for name, version := range request.InitialResourceVersions {
+			versions[name] = version
+		}
+		con.proxy.WatchedResources[request.TypeUrl] = &model.WatchedResource{
+			TypeUrl:          request.TypeUrl,
+			ResourceNames:    names,
+			LastRequest:      toDiscoveryRequest(request, names),
+			ResourceVersions: versions,
+		}
+		return true
+	}
+
+	if request.ResponseNonce != "" {
+		if request.ResponseNonce == previousInfo.NonceSent {
+			previousInfo.NonceAcked = request.ResponseNonce
+			previousInfo.VersionAcked = previousInfo.VersionSent
+		} else {
+			adsLog.Debugf("ADS:%s: REQ %s Expired nonce received %s, sent %s", stype,
+				con.ConID, request.ResponseNonce, previousInfo.NonceSent)
+			xdsExpiredNonce.With(typeTag.Value(v3.GetMetricType(request.TypeUrl))).Increment()
+		}
+	}
+
+	// All our wildcard types send all resources regardless of the subscriptions
+	if wildcard || (len(request.ResourceNamesSubscribe) == 0 && len(request.ResourceNamesUnsubscribe) == 0) {
+		adsLog.Debugf("ADS:%s: ACK %s %s", stype, con.ConID, request.ResponseNonce)
+		return false
+	}
+
+	names := updateSubscriptions(previousInfo.ResourceNames, request.ResourceNamesSubscribe, request.ResourceNamesUnsubscribe)
+	adsLog.Debugf("ADS:%s: RESOURCE CHANGE subscribe: %v, unsubscribe: %v %s %s", stype,
+		request.ResourceNamesSubscribe, request.ResourceNamesUnsubscribe, con.ConID, request.ResponseNonce)
+	if len(names) == 0 {
+		delete(con.proxy.WatchedResources, request.TypeUrl)
+		return false
+	}
+	// Envoy forgets unsubscribed resources, so they are sent again if subscribed to later
+	for _, name := range request.ResourceNamesUnsubscribe {
+		delete(previousInfo.ResourceVersions, name)
+	}
+	previousInfo.ResourceNames = names
+	previousInfo.LastRequest = toDiscoveryRequest(request, names)
+	return len(request.ResourceNamesSubscribe) > 0
+}
+
+// updateSubscriptions returns the names of the resources watched after subscribing to and
+// unsubscribing from resources
+func updateSubscriptions(current, subscribe, unsubscribe []string) []string {
+	names := make(map[string]struct{}, len(current)+len(subscribe))
+	for _, name := range current {
+		names[name] = struct{}{}
+	}
+	for _, name := range subscribe {
+		names[name] = struct{}{}
+	}
+	for _, name := range unsubscribe {
+		delete(names, name)
+	}
+	// * is the explicit wildcard subscription
+	delete(names, "*")
+	result := make([]string, 0, len(names))
+	for name := range names {
+		result = append(result, name)
+	}
+	return result
+}
+
+// toDiscoveryRequest returns the state of the world request equivalent to a delta request, for
+// the code that inspects requests
+func toDiscoveryRequest(request *discovery.DeltaDiscoveryRequest, names []string) *discovery.DiscoveryRequest {
+	return &discovery.DiscoveryRequest{
+		Node:          request.Node,
+		TypeUrl:       request.TypeUrl,
+		ResourceNames: names,
+		ResponseNonce: request.ResponseNonce,
+		ErrorDetail:   request.ErrorDetail,
+	}
+}
+
+// Push the resources of a type that changed to a delta connection, along with the names of the
+// removed resources. Resources of generators that do not implement XdsDeltaResourceGenerator are
+// compared with the versions the client has, so that unchanged resources are not sent.
+func (s *DiscoveryServer) pushDeltaXds(con *Connection, push *model.PushContext,
+	currentVersion string, w *model.WatchedResource, req *model.PushRequest) error {
+	if w == nil {
+		return nil
+	}
+	gen := s.findGenerator(w.TypeUrl, con)
+	if gen == nil {
+		return nil
+	}
+
+	t0 := time.Now()
+
+	var res model.DeltaResources
+	var removed []string
+	usedDelta := false
+	if deltaGen, ok := gen.(model.XdsDeltaResourceGenerator); ok {
+		res, removed, usedDelta = deltaGen.GenerateDeltas(con.proxy, push, w, req)
+	} else if cl := gen.Generate(con.proxy, push, w, req); cl != nil {
+		res = toDeltaResources(w.TypeUrl, cl)
+	}
+	if res == nil && len(removed) == 0 {
+		// If we have nothing to send, report that we got an ACK for this version.
+		if s.StatusReporter != nil {
+			s.StatusReporter.RegisterEvent(con.ConID, w.TypeUrl, push.Version)
+		}
+		return nil // No push needed.
+	}
+	defer func() { recordPushTime(w.TypeUrl, time.Since(t0)) }()
+
+	con.proxy.RLock()
+	changed := make(model.DeltaResources, 0, len(res))
+	generated := make(map[string]struct{}, len(res))
+	for _, r := range res {
+		if r.Version == "" {
+			r.Version = resourceVersion(r.Resource)
+		}
+		generated[r.Name] = struct{}{}
+		if w.ResourceVersions[r.Name] != r.Version {
+			changed = append(changed, r)
+		}
+	}
+	// a complete set of resources removes the resources that are not part of it
+	if !usedDelta && req.Full && res != nil {
+		for name := range w.ResourceVersions {
+			if _, f := generated[name]; !f {
+				removed = append(removed, name)
+			}
+		}
+	}
+	con.proxy.RUnlock()
+
+	if len(changed) == 0 && len(removed) == 0 {
+		if s.StatusReporter != nil {
+			s.StatusReporter.RegisterEvent(con.ConID, w.TypeUrl, push.Version)
+		}
+		return nil
+	}
+
+	resp := &discovery.DeltaDiscoveryResponse{
+		TypeUrl:           w.TypeUrl,
+		SystemVersionInfo: currentVersion,
+		Nonce:             nonce(push.Version),
+		Resources:         changed,
+		RemovedResources:  removed,
+	}
+
+	err := con.sendDelta(resp)
+	if err != nil {
+		recordSendError(w.TypeUrl, con.ConID, err)
+		return err
+	}
+	if w.TypeUrl == extensionDeliveryType() && s.StatusReporter != nil {
+		con.extensionModules = extensionModules(con.proxy, push)
+		con.extensionNonce = resp.Nonce
+		s.StatusReporter.RegisterExtensions(con.ConID, con.extensionModules, false)
+	}
+
+	if _, f := SkipLogTypes[w.TypeUrl]; !f {
+		adsLog.Infof("%s: DELTA PUSH for node:%s resources:%d removed:%d", v3.GetShortType(w.TypeUrl), con.proxy.ID, len(changed), len(removed))
+	}
+	return nil
+}
+
+// toDeltaResources names the resources returned by a generator
+func toDeltaResources(typeURL string, resources model.Resources) model.DeltaResources {
+	res := make(model.DeltaResources, 0, len(resources))
+	for _, r := range resources {
+		if r == nil {
+			continue
+		}
+		res = append(res, &discovery.Resource{
+			Name:     resourceName(typeURL, r),
+			Resource: r,
+		})
+	}
+	return res
+}
+
+// resourceName returns the name of a resource. The Envoy resources carry their name in their first
+// field, which is read without unmarshaling the resource. Other resources are named by their content.
+func resourceName(typeURL string, resource *any.Any) string {
+	if _, f := namedTypes[typeURL]; f {
+		if name, ok := firstStringField(resource.Value); ok {
+			return name
+		}
+	}
+	return resourceVersion(resource)
+}
+
+// firstStringField returns the value of the field number 1 of a serialized message, if it is a string
+func firstStringField(b []byte) (string, bool) {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return "", false
+		}
+		b = b[n:]
+		if num == 1 && typ == protowire.BytesType {
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return "", false
+			}
+			return string(v), true
+		}
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return "", false
+		}
+		b = b[n:]
+	}
+	return "", false
+}
+
+// resourceVersion returns the version of a resource, which is a hash of its content
+func resourceVersion(resource *any.Any) string {
+	h := fnv.New64a()
+	_, _ = h.Write(resource.Value)
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+// Send a delta response with timeout
+func (conn *Connection) sendDelta(res *discovery.DeltaDiscoveryResponse) error {
+	errChan := make(chan error, 1)
+	t := time.NewTimer(sendTimeout)
+	go func() {
+		start := time.Now()
+		defer func() { recordSendTime(time.Since(start)) }()
+		errChan <- conn.deltaStream.Send(res)
+		close(errChan)
+	}()
+
+	select {
+	case <-t.C:
+		adsLog.Infof("Timeout writing %s", conn.ConID)
+		xdsResponseWriteTimeouts.Increment()
+		return status.Errorf(codes.DeadlineExceeded, "timeout sending")
+	case err := <-errChan:
+		if err == nil {
+			sz := 0
+			for _, rc := range res.Resources {
+				sz += len(rc.Resource.GetValue())
+			}
+			conn.proxy.Lock()
+			w := conn.proxy.WatchedResources[res.TypeUrl]
+			if w == nil {
+				w = &model.WatchedResource{TypeUrl: res.TypeUrl}
+				conn.proxy.WatchedResources[res.TypeUrl] = w
+			}
+			if w.ResourceVersions == nil {
+				w.ResourceVersions = map[string]string{}
+			}
+			for _, rc := range res.Resources {
+				w.ResourceVersions[rc.Name] = rc.Version
+			}
+			for _, name := range res.RemovedResources {
+				delete(w.ResourceVersions, name)
+			}
+			w.NonceSent = res.Nonce
+			w.VersionSent = res.SystemVersionInfo
+			w.LastSent = time.Now()
+			w.LastSize = sz
+			conn.proxy.Unlock()
+		}
+		// To ensure the channel is empty after a call to Stop, check the
+		// return value and drain the channel (from Stop docs).
+		if !t.Stop() {
+			<-t.C
+		}
+		return err
+	}
+}
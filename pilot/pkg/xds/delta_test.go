@@ -0,0 +1,163 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds_test
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"google.golang.org/grpc"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/xds"
+	v3 "istio.io/istio/pilot/pkg/xds/v3"
+	"istio.io/istio/pkg/adsc"
+)
+
+func deltaReceive(t *testing.T, ads discovery.AggregatedDiscoveryService_DeltaAggregatedResourcesClient) *discovery.DeltaDiscoveryResponse {
+	t.Helper()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-time.After(15 * time.Second):
+			_ = ads.CloseSend()
+		case <-done:
+		}
+	}()
+	res, err := ads.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func resourceNames(res *discovery.DeltaDiscoveryResponse) []string {
+	names := make([]string, 0, len(res.Resources))
+	for _, r := range res.Resources {
+		names = append(names, r.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestDeltaAdsSubscriptions(t *testing.T) {
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+	ads := s.ConnectDeltaADS()
+	node := &corev3.Node{
+		Id:       sidecarID(app3Ip, "app3"),
+		Metadata: nodeMetadata,
+	}
+
+	if err := ads.Send(&discovery.DeltaDiscoveryRequest{
+		Node:                   node,
+		TypeUrl:                v3.EndpointType,
+		ResourceNamesSubscribe: []string{"fake-cluster"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	res := deltaReceive(t, ads)
+	if got := resourceNames(res); res.TypeUrl != v3.EndpointType || !reflect.DeepEqual(got, []string{"fake-cluster"}) {
+		t.Fatalf("expected fake-cluster endpoints, got %v %s", got, res.TypeUrl)
+	}
+	if res.Resources[0].Version == "" {
+		t.Fatalf("expected a resource version")
+	}
+
+	// subscribing to another cluster only sends the endpoints of that cluster
+	if err := ads.Send(&discovery.DeltaDiscoveryRequest{
+		TypeUrl:                v3.EndpointType,
+		ResponseNonce:          res.Nonce,
+		ResourceNamesSubscribe: []string{"other-cluster"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	res = deltaReceive(t, ads)
+	if got := resourceNames(res); !reflect.DeepEqual(got, []string{"other-cluster"}) {
+		t.Fatalf("expected other-cluster endpoints only, got %v", got)
+	}
+	if len(res.RemovedResources) != 0 {
+		t.Fatalf("expected no removed resources, got %v", res.RemovedResources)
+	}
+}
+
+func TestDeltaAdsInitialResourceVersions(t *testing.T) {
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+	ads := s.ConnectDeltaADS()
+	node := &corev3.Node{
+		Id:       sidecarID(app3Ip, "app3"),
+		Metadata: nodeMetadata,
+	}
+	if err := ads.Send(&discovery.DeltaDiscoveryRequest{
+		Node:                   node,
+		TypeUrl:                v3.EndpointType,
+		ResourceNamesSubscribe: []string{"fake-cluster"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	res := deltaReceive(t, ads)
+	version := res.Resources[0].Version
+
+	// A client reconnecting with the resources it has only gets the resources it does not have
+	ads = s.ConnectDeltaADS()
+	if err := ads.Send(&discovery.DeltaDiscoveryRequest{
+		Node:                    node,
+		TypeUrl:                 v3.EndpointType,
+		ResourceNamesSubscribe:  []string{"fake-cluster", "other-cluster"},
+		InitialResourceVersions: map[string]string{"fake-cluster": version},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	res = deltaReceive(t, ads)
+	if got := resourceNames(res); !reflect.DeepEqual(got, []string{"other-cluster"}) {
+		t.Fatalf("expected other-cluster endpoints only, got %v", got)
+	}
+}
+
+func TestDeltaAdsClient(t *testing.T) {
+	s := xds.NewFakeDiscoveryServer(t, xds.FakeOptions{})
+	p := s.SetupProxy(&model.Proxy{})
+	client, err := adsc.New("buffcon", &adsc.Config{
+		IP:                       p.IPAddresses[0],
+		Meta:                     p.Metadata.ToStruct(),
+		Namespace:                p.ConfigNamespace,
+		InitialDiscoveryRequests: []*discovery.DiscoveryRequest{{TypeUrl: v3.ClusterType}},
+		GrpcOpts: []grpc.DialOption{grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return s.Listener.Dial()
+		}),
+			grpc.WithInsecure()},
+		Delta: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Run(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Close)
+
+	if _, err := client.Wait(10*time.Second, v3.ClusterType); err != nil {
+		t.Fatal(err)
+	}
+	if len(client.GetClusters())+len(client.GetEdsClusters()) == 0 {
+		t.Fatal("expected clusters")
+	}
+}
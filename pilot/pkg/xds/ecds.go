@@ -0,0 +1,60 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/util"
+	"istio.io/istio/pkg/servicemesh/extension"
+	maistramodel "istio.io/istio/pkg/servicemesh/model"
+)
+
+// EcdsGenerator generates the configuration of the ServiceMeshExtension filters.
+type EcdsGenerator struct {
+	Server *DiscoveryServer
+}
+
+var _ model.XdsResourceGenerator = &EcdsGenerator{}
+
+func ecdsNeedsPush(req *model.PushRequest) bool {
+	if req == nil {
+		return true
+	}
+	if !req.Full {
+		// ECDS only handles full push
+		return false
+	}
+	// If none set, we will always push
+	if len(req.ConfigsUpdated) == 0 {
+		return true
+	}
+	for config := range req.ConfigsUpdated {
+		if config.Kind == maistramodel.ServiceMeshExtensionKind {
+			return true
+		}
+	}
+	return false
+}
+
+func (e EcdsGenerator) Generate(proxy *model.Proxy, push *model.PushContext, w *model.WatchedResource, req *model.PushRequest) model.Resources {
+	if !ecdsNeedsPush(req) {
+		return nil
+	}
+	resources := model.Resources{}
+	for _, c := range extension.ExtensionConfigs(proxy, push, w.ResourceNames) {
+		resources = append(resources, util.MessageToAny(c))
+	}
+	return resources
+}
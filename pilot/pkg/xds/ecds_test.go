@@ -0,0 +1,73 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package xds
+
+import (
+	"testing"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pkg/config/schema/gvk"
+	maistramodel "istio.io/istio/pkg/servicemesh/model"
+)
+
+func TestExtensionConfigNeedsPush(t *testing.T) {
+	extensionUpdate := map[model.ConfigKey]struct{}{
+		{Kind: maistramodel.ServiceMeshExtensionKind, Name: "header-append", Namespace: "istio-system"}: {},
+	}
+	cases := []struct {
+		name string
+		req  *model.PushRequest
+		ecds bool
+		lds  bool
+	}{
+		{
+			name: "no request",
+			ecds: true,
+			lds:  true,
+		},
+		{
+			name: "incremental push",
+			req:  &model.PushRequest{Full: false},
+		},
+		{
+			name: "full push without updated configs",
+			req:  &model.PushRequest{Full: true},
+			ecds: true,
+			lds:  true,
+		},
+		{
+			name: "extension config update",
+			req:  &model.PushRequest{Full: true, ConfigsUpdated: extensionUpdate},
+			ecds: true,
+		},
+		{
+			name: "unrelated config update",
+			req: &model.PushRequest{Full: true, ConfigsUpdated: map[model.ConfigKey]struct{}{
+				{Kind: gvk.VirtualService, Name: "vs", Namespace: "default"}: {},
+			}},
+			lds: true,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ecdsNeedsPush(tt.req); got != tt.ecds {
+				t.Errorf("Got ECDS needs push = %v, expected %v", got, tt.ecds)
+			}
+			if got := ldsNeedsPush(tt.req); got != tt.lds {
+				t.Errorf("Got LDS needs push = %v, expected %v", got, tt.lds)
+			}
+		})
+	}
+}
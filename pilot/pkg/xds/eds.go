@@ -30,6 +30,7 @@ import (
 	"istio.io/istio/pkg/config/labels"
 	"istio.io/istio/pkg/config/protocol"
 	"istio.io/istio/pkg/config/schema/gvk"
+	maistramodel "istio.io/istio/pkg/servicemesh/model"
 )
 
 // UpdateServiceShards will list the endpoints and create the shards.
@@ -309,6 +310,8 @@ var skippedEdsConfigs = map[config.GroupVersionKind]struct{}{
 	gvk.AuthorizationPolicy:   {},
 	gvk.RequestAuthentication: {},
 	gvk.Secret:                {},
+
+	maistramodel.ServiceMeshExtensionKind: {},
 }
 
 func edsNeedsPush(updates model.XdsUpdates) bool {
@@ -328,11 +331,39 @@ func (eds *EdsGenerator) Generate(proxy *model.Proxy, push *model.PushContext, w
 	if !edsNeedsPush(req.ConfigsUpdated) {
 		return nil
 	}
+	resources, _ := eds.buildEndpoints(proxy, push, w, req)
+	return resources
+}
+
+// GenerateDeltas returns the endpoints of the clusters that were updated, named after their cluster.
+// Endpoints of clusters that are not updated are not sent, and removed clusters are unsubscribed
+// from by the client once they are removed by CDS.
+func (eds *EdsGenerator) GenerateDeltas(proxy *model.Proxy, push *model.PushContext, w *model.WatchedResource,
+	req *model.PushRequest) (model.DeltaResources, []string, bool) {
+	if !edsNeedsPush(req.ConfigsUpdated) {
+		return nil, nil, false
+	}
+	resources, clusterNames := eds.buildEndpoints(proxy, push, w, req)
+	res := make(model.DeltaResources, 0, len(resources))
+	for i, resource := range resources {
+		res = append(res, &discovery.Resource{
+			Name:     clusterNames[i],
+			Resource: resource,
+		})
+	}
+	return res, nil, true
+}
+
+// buildEndpoints returns the endpoints of the watched clusters that need to be pushed, along with
+// the names of their clusters.
+func (eds *EdsGenerator) buildEndpoints(proxy *model.Proxy, push *model.PushContext, w *model.WatchedResource,
+	req *model.PushRequest) ([]*any.Any, []string) {
 	var edsUpdatedServices map[string]struct{}
 	if !req.Full {
 		edsUpdatedServices = model.ConfigNamesOfKind(req.ConfigsUpdated, gvk.ServiceEntry)
 	}
 	resources := make([]*any.Any, 0)
+	clusterNames := make([]string, 0)
 	empty := 0
 
 	cached := 0
@@ -349,6 +380,7 @@ func (eds *EdsGenerator) Generate(proxy *model.Proxy, push *model.PushContext, w
 		builder := NewEndpointBuilder(clusterName, proxy, push)
 		if marshalledEndpoint, f := eds.Server.Cache.Get(builder); f {
 			resources = append(resources, marshalledEndpoint)
+			clusterNames = append(clusterNames, clusterName)
 			cached++
 		} else {
 			l := eds.Server.generateEndpoints(builder)
@@ -362,6 +394,7 @@ func (eds *EdsGenerator) Generate(proxy *model.Proxy, push *model.PushContext, w
 			}
 			resource := util.MessageToAny(l)
 			resources = append(resources, resource)
+			clusterNames = append(clusterNames, clusterName)
 			eds.Server.Cache.Add(builder, resource)
 		}
 	}
@@ -372,7 +405,7 @@ func (eds *EdsGenerator) Generate(proxy *model.Proxy, push *model.PushContext, w
 		adsLog.Debugf("EDS: PUSH INC for node:%s clusters:%d empty:%v cached:%v/%v",
 			proxy.ID, len(resources), empty, cached, cached+regenerated)
 	}
-	return resources
+	return resources, clusterNames
 }
 
 func getOutlierDetectionAndLoadBalancerSettings(
@@ -25,6 +25,7 @@ import (
 	networkingapi "istio.io/api/networking/v1alpha3"
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/networking/util"
+	v3 "istio.io/istio/pilot/pkg/xds/v3"
 	"istio.io/istio/pkg/config"
 	"istio.io/istio/pkg/config/host"
 	"istio.io/istio/pkg/config/schema/gvk"
@@ -105,6 +106,10 @@ func (b EndpointBuilder) Cacheable() bool {
 	return b.service != nil
 }
 
+func (b EndpointBuilder) TypeURL() string {
+	return v3.EndpointType
+}
+
 func (b EndpointBuilder) DependentConfigs() []model.ConfigKey {
 	configs := []model.ConfigKey{}
 	if b.destinationRule != nil {
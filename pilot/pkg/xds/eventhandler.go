@@ -14,7 +14,10 @@
 
 package xds
 
-import v3 "istio.io/istio/pilot/pkg/xds/v3"
+import (
+	"istio.io/istio/pilot/pkg/model"
+	v3 "istio.io/istio/pilot/pkg/xds/v3"
+)
 
 // EventType represents the type of object we are tracking, mapping to envoy TypeUrl.
 type EventType = string
@@ -36,4 +39,14 @@ type DistributionStatusCache interface {
 	RegisterEvent(conID string, eventType EventType, nonce string)
 	RegisterDisconnect(s string, types []EventType)
 	QueryLastNonce(conID string, eventType EventType) (noncePrefix string)
+	// RegisterExtensions notifies the implementer of the ServiceMeshExtension modules, by extension,
+	// contained in the listeners or extension configs sent to a connection or acknowledged by it, and must be non-blocking
+	RegisterExtensions(conID string, modules map[string]string, acked bool)
+}
+
+// ExtensionHealthReporter is notified of WebAssembly failures reported by the agents of connected proxies
+type ExtensionHealthReporter interface {
+	// ReportFailures is called with the new failures by the name of the Envoy counter that counted them,
+	// and must be non-blocking
+	ReportFailures(proxy *model.Proxy, push *model.PushContext, failures map[string]uint64)
 }
@@ -273,6 +273,26 @@ func (f *FakeDiscoveryServer) ConnectADS() discovery.AggregatedDiscoveryService_
 	return client
 }
 
+// ConnectDeltaADS starts a delta ADS connection to the server. It will automatically be cleaned up when the test ends
+func (f *FakeDiscoveryServer) ConnectDeltaADS() discovery.AggregatedDiscoveryService_DeltaAggregatedResourcesClient {
+	conn, err := grpc.Dial("buffcon", grpc.WithInsecure(), grpc.WithBlock(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return f.Listener.Dial()
+	}))
+	if err != nil {
+		f.t.Fatalf("failed to connect: %v", err)
+	}
+	xds := discovery.NewAggregatedDiscoveryServiceClient(conn)
+	client, err := xds.DeltaAggregatedResources(context.Background())
+	if err != nil {
+		f.t.Fatalf("delta stream resources failed: %s", err)
+	}
+	f.t.Cleanup(func() {
+		_ = client.CloseSend()
+		_ = conn.Close()
+	})
+	return client
+}
+
 // Connect starts an ADS connection to the server using adsc. It will automatically be cleaned up when the test ends
 // watch can be configured to determine the resources to watch initially, and wait can be configured to determine what
 // resources we should initially wait for.
@@ -21,6 +21,7 @@ import (
 	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
 	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
 
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
 	v3 "istio.io/istio/pilot/pkg/xds/v3"
 	"istio.io/pkg/env"
@@ -90,6 +91,9 @@ func (s *DiscoveryServer) findGenerator(typeURL string, con *Connection) model.X
 // choose to send partial or even no response if there are no changes.
 func (s *DiscoveryServer) pushXds(con *Connection, push *model.PushContext,
 	currentVersion string, w *model.WatchedResource, req *model.PushRequest) error {
+	if con.deltaStream != nil {
+		return s.pushDeltaXds(con, push, currentVersion, w, req)
+	}
 	if w == nil {
 		return nil
 	}
@@ -122,6 +126,11 @@ func (s *DiscoveryServer) pushXds(con *Connection, push *model.PushContext,
 		recordSendError(w.TypeUrl, con.ConID, err)
 		return err
 	}
+	if w.TypeUrl == extensionDeliveryType() && s.StatusReporter != nil {
+		con.extensionModules = extensionModules(con.proxy, push)
+		con.extensionNonce = resp.Nonce
+		s.StatusReporter.RegisterExtensions(con.ConID, con.extensionModules, false)
+	}
 
 	// Some types handle logs inside Generate, skip them here
 	if _, f := SkipLogTypes[w.TypeUrl]; !f {
@@ -129,3 +138,24 @@ func (s *DiscoveryServer) pushXds(con *Connection, push *model.PushContext,
 	}
 	return nil
 }
+
+// extensionDeliveryType returns the type of the resources that deliver the
+// ServiceMeshExtension modules to proxies
+func extensionDeliveryType() string {
+	if features.EnableMaistraExtensionECDS {
+		return v3.ExtensionConfigurationType
+	}
+	return v3.ListenerType
+}
+
+// extensionModules returns the URLs of the ServiceMeshExtension modules applied
+// to the proxy, by extension
+func extensionModules(proxy *model.Proxy, push *model.PushContext) map[string]string {
+	modules := map[string]string{}
+	for _, extensions := range push.Extensions(proxy) {
+		for _, extension := range extensions {
+			modules[extension.Key()] = extension.FilterURL
+		}
+	}
+	return modules
+}
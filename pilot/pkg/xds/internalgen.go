@@ -140,6 +140,10 @@ func (s *DiscoveryServer) PushAll(res *discovery.DiscoveryResponse) {
 	// Create a temp map to avoid locking the add/remove
 	pending := []*Connection{}
 	for _, v := range s.adsClients {
+		// internal events are only delivered over state of the world streams
+		if v.deltaStream != nil {
+			continue
+		}
 		v.proxy.RLock()
 		if v.proxy.WatchedResources[res.TypeUrl] != nil {
 			pending = append(pending, v)
@@ -19,6 +19,7 @@ import (
 	"istio.io/istio/pilot/pkg/networking/util"
 	"istio.io/istio/pkg/config"
 	"istio.io/istio/pkg/config/schema/gvk"
+	maistramodel "istio.io/istio/pkg/servicemesh/model"
 )
 
 type LdsGenerator struct {
@@ -32,6 +33,8 @@ var skippedLdsConfigs = map[config.GroupVersionKind]struct{}{
 	gvk.DestinationRule: {},
 	gvk.WorkloadGroup:   {},
 	gvk.Secret:          {},
+	// ServiceMeshExtension updates that only change the filter configuration are delivered over ECDS
+	maistramodel.ServiceMeshExtensionKind: {},
 }
 
 func ldsNeedsPush(req *model.PushRequest) bool {
@@ -30,6 +30,7 @@ var (
 	nodeTag    = monitoring.MustCreateLabel("node")
 	typeTag    = monitoring.MustCreateLabel("type")
 	versionTag = monitoring.MustCreateLabel("version")
+	classTag   = monitoring.MustCreateLabel("class")
 
 	// pilot_total_xds_rejects should be used instead. This is for backwards compatibility
 	cdsReject = monitoring.NewGauge(
@@ -123,6 +124,19 @@ var (
 		[]float64{.1, 1, 3, 5, 10, 20, 30},
 	)
 
+	pushQueueDepth = monitoring.NewGauge(
+		"pilot_push_queue_depth",
+		"Number of proxies waiting in the push queue, by push class.",
+		monitoring.WithLabels(classTag),
+	)
+
+	pushQueueWaitTime = monitoring.NewDistribution(
+		"pilot_push_queue_wait_time",
+		"Time in seconds a proxy waits in the push queue, by push class.",
+		[]float64{.01, .1, 1, 3, 5, 10, 20, 30},
+		monitoring.WithLabels(classTag),
+	)
+
 	pushTriggers = monitoring.NewSum(
 		"pilot_push_triggers",
 		"Total number of times a push was triggered, labeled by reason for the push.",
@@ -206,6 +220,14 @@ func incrementXDSRejects(xdsType string, node, errCode string) {
 	}
 }
 
+func recordPushQueueDepth(class pushClass, depth int) {
+	pushQueueDepth.With(classTag.Value(class.String())).Record(float64(depth))
+}
+
+func recordPushQueueWait(class pushClass, duration time.Duration) {
+	pushQueueWaitTime.With(classTag.Value(class.String())).Record(duration.Seconds())
+}
+
 func recordSendTime(duration time.Duration) {
 	sendTime.Record(duration.Seconds())
 }
@@ -230,6 +252,8 @@ func init() {
 		pushTime,
 		proxiesConvergeDelay,
 		proxiesQueueTime,
+		pushQueueDepth,
+		pushQueueWaitTime,
 		pushContextErrors,
 		totalXDSInternalErrors,
 		inboundUpdates,
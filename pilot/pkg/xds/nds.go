@@ -19,6 +19,7 @@ import (
 	"istio.io/istio/pilot/pkg/networking/util"
 	"istio.io/istio/pkg/config"
 	"istio.io/istio/pkg/config/schema/gvk"
+	maistramodel "istio.io/istio/pkg/servicemesh/model"
 )
 
 // Nds stands for Name Discovery Service. Istio agents send NDS requests to istiod
@@ -43,6 +44,8 @@ var skippedNdsConfigs = map[config.GroupVersionKind]struct{}{
 	gvk.AuthorizationPolicy:   {},
 	gvk.RequestAuthentication: {},
 	gvk.PeerAuthentication:    {},
+
+	maistramodel.ServiceMeshExtensionKind: {},
 }
 
 func ndsNeedsPush(req *model.PushRequest) bool {
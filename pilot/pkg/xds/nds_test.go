@@ -62,14 +62,17 @@ func TestNDS(t *testing.T) {
 			"random-1.host.example": {
 				Ips:      []string{"240.240.0.1"},
 				Registry: "External",
+				Ports:    []*nds.NameTable_NameInfo_Port{{Name: "http", Number: 80, Protocol: "HTTP"}},
 			},
 			"random-2.host.example": {
 				Ips:      []string{"9.9.9.9"},
 				Registry: "External",
+				Ports:    []*nds.NameTable_NameInfo_Port{{Name: "http", Number: 80, Protocol: "HTTP"}},
 			},
 			"random-3.host.example": {
 				Ips:      []string{"240.240.0.2"},
 				Registry: "External",
+				Ports:    []*nds.NameTable_NameInfo_Port{{Name: "http", Number: 80, Protocol: "HTTP"}},
 			},
 		},
 	}
@@ -15,20 +15,179 @@
 package xds
 
 import (
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
 )
 
+// pushClass is the class of a push, which determines its priority in the queue.
+type pushClass int
+
+const (
+	// gatewayPush is a push to a gateway, which serves the traffic entering the mesh.
+	gatewayPush pushClass = iota
+	// incrementalPush is a push of endpoints only, which is cheap to build and often urgent.
+	incrementalPush
+	// fullPush is any other push.
+	fullPush
+
+	numPushClasses
+)
+
+var pushClassNames = [numPushClasses]string{"gateway", "incremental", "full"}
+
+func (c pushClass) String() string {
+	return pushClassNames[c]
+}
+
+// classify returns the class of a push request for a connection.
+func classify(con *Connection, request *model.PushRequest) pushClass {
+	if con.proxy != nil && con.proxy.Type == model.Router {
+		return gatewayPush
+	}
+	if request != nil && !request.Full {
+		return incrementalPush
+	}
+	return fullPush
+}
+
+// connectionNamespace returns the namespace a connection is queued in. Connections are
+// dequeued in turns across namespaces, so that a namespace with many proxies does not delay the others.
+func connectionNamespace(con *Connection) string {
+	if con.proxy == nil {
+		return ""
+	}
+	return con.proxy.ConfigNamespace
+}
+
+// defaultPushQueueWeights are the weights of the push classes, used when PILOT_PUSH_QUEUE_WEIGHTS
+// does not set them.
+var defaultPushQueueWeights = [numPushClasses]int{4, 2, 1}
+
+// parsePushQueueWeights parses weights formatted as class=weight pairs separated by commas.
+// Classes that are not set, or set to an invalid weight, get their default weight.
+func parsePushQueueWeights(s string) [numPushClasses]int {
+	weights := defaultPushQueueWeights
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			adsLog.Warnf("invalid push queue weight %q, expected class=weight", pair)
+			continue
+		}
+		name := strings.TrimSpace(kv[0])
+		weight, err := strconv.Atoi(strings.TrimSpace(kv[1]))
+		if err != nil || weight < 1 {
+			adsLog.Warnf("invalid push queue weight %q, expected a positive integer", pair)
+			continue
+		}
+		found := false
+		for c := pushClass(0); c < numPushClasses; c++ {
+			if c.String() == name {
+				weights[c] = weight
+				found = true
+			}
+		}
+		if !found {
+			adsLog.Warnf("unknown push queue class %q", name)
+		}
+	}
+	return weights
+}
+
+// classQueue holds the queued connections of a push class, by namespace.
+type classQueue struct {
+	// namespaces holds the namespaces with queued connections, in the order they are served.
+	namespaces []string
+	// connections holds the queued connections of each namespace, in the order they were queued.
+	connections map[string][]*Connection
+	size        int
+}
+
+func newClassQueue() *classQueue {
+	return &classQueue{connections: map[string][]*Connection{}}
+}
+
+func (q *classQueue) push(ns string, con *Connection) {
+	if len(q.connections[ns]) == 0 {
+		q.namespaces = append(q.namespaces, ns)
+	}
+	q.connections[ns] = append(q.connections[ns], con)
+	q.size++
+}
+
+// remove removes a connection from the queue of its namespace.
+func (q *classQueue) remove(ns string, con *Connection) {
+	cons := q.connections[ns]
+	for i, c := range cons {
+		if c != con {
+			continue
+		}
+		if len(cons) == 1 {
+			delete(q.connections, ns)
+			for j, n := range q.namespaces {
+				if n == ns {
+					q.namespaces = append(q.namespaces[:j:j], q.namespaces[j+1:]...)
+					break
+				}
+			}
+		} else {
+			q.connections[ns] = append(cons[:i:i], cons[i+1:]...)
+		}
+		q.size--
+		return
+	}
+}
+
+// pop removes the first connection of the namespace whose turn it is, and moves the namespace
+// to the end of the line.
+func (q *classQueue) pop() *Connection {
+	ns := q.namespaces[0]
+	q.namespaces = q.namespaces[1:]
+	cons := q.connections[ns]
+	con := cons[0]
+	if len(cons) == 1 {
+		delete(q.connections, ns)
+	} else {
+		q.connections[ns] = cons[1:]
+		q.namespaces = append(q.namespaces, ns)
+	}
+	q.size--
+	return con
+}
+
+// queuedPush is a push request waiting in the queue.
+type queuedPush struct {
+	request  *model.PushRequest
+	class    pushClass
+	enqueued time.Time
+}
+
+// PushQueue holds the connections waiting for a push. Pushes are dequeued by class, with
+// weighted turns so that gateway and incremental pushes go first without starving full pushes,
+// and by namespace within a class.
 type PushQueue struct {
 	cond *sync.Cond
 
 	// pending stores all connections in the queue. If the same connection is enqueued again,
-	// the PushRequest will be merged.
-	pending map[*Connection]*model.PushRequest
+	// the PushRequest will be merged, and the connection keeps its place unless the merged
+	// request moves it to another class.
+	pending map[*Connection]*queuedPush
+
+	// classes maintain ordering of the queue
+	classes [numPushClasses]*classQueue
 
-	// queue maintains ordering of the queue
-	queue []*Connection
+	// weights are the number of connections dequeued from each class in a round, and credits
+	// the number of connections a class can still dequeue in the current round.
+	weights [numPushClasses]int
+	credits [numPushClasses]int
 
 	// processing stores all connections that have been Dequeue(), but not MarkDone().
 	// The value stored will be initially be nil, but may be populated if the connection is Enqueue().
@@ -39,11 +198,21 @@ type PushQueue struct {
 }
 
 func NewPushQueue() *PushQueue {
-	return &PushQueue{
-		pending:    make(map[*Connection]*model.PushRequest),
+	return newPushQueue(parsePushQueueWeights(features.PushQueueWeights))
+}
+
+func newPushQueue(weights [numPushClasses]int) *PushQueue {
+	p := &PushQueue{
+		pending:    make(map[*Connection]*queuedPush),
 		processing: make(map[*Connection]*model.PushRequest),
 		cond:       sync.NewCond(&sync.Mutex{}),
+		weights:    weights,
+		credits:    weights,
 	}
+	for c := range p.classes {
+		p.classes[c] = newClassQueue()
+	}
+	return p
 }
 
 // Enqueue will mark a proxy as pending a push. If it is already pending, pushInfo will be merged.
@@ -62,41 +231,82 @@ func (p *PushQueue) Enqueue(con *Connection, pushRequest *model.PushRequest) {
 		return
 	}
 
-	if request, f := p.pending[con]; f {
-		p.pending[con] = request.Merge(pushRequest)
+	if queued, f := p.pending[con]; f {
+		queued.request = queued.request.Merge(pushRequest)
+		// a full push merged into an incremental push is queued as a full push
+		if class := classify(con, queued.request); class != queued.class {
+			ns := connectionNamespace(con)
+			p.classes[queued.class].remove(ns, con)
+			recordPushQueueDepth(queued.class, p.classes[queued.class].size)
+			queued.class = class
+			p.classes[class].push(ns, con)
+			recordPushQueueDepth(class, p.classes[class].size)
+		}
 		return
 	}
 
-	p.pending[con] = pushRequest
-	p.queue = append(p.queue, con)
+	p.add(con, pushRequest)
 	// Signal waiters on Dequeue that a new item is available
 	p.cond.Signal()
 }
 
+func (p *PushQueue) add(con *Connection, request *model.PushRequest) {
+	class := classify(con, request)
+	p.pending[con] = &queuedPush{request: request, class: class, enqueued: time.Now()}
+	p.classes[class].push(connectionNamespace(con), con)
+	recordPushQueueDepth(class, p.classes[class].size)
+}
+
 // Remove a proxy from the queue. If there are no proxies ready to be removed, this will block
 func (p *PushQueue) Dequeue() (con *Connection, request *model.PushRequest, shutdown bool) {
 	p.cond.L.Lock()
 	defer p.cond.L.Unlock()
 
 	// Block until there is one to remove. Enqueue will signal when one is added.
-	for len(p.queue) == 0 && !p.shuttingDown {
+	for p.size() == 0 && !p.shuttingDown {
 		p.cond.Wait()
 	}
 
-	if len(p.queue) == 0 {
+	if p.size() == 0 {
 		// We must be shutting down.
 		return nil, nil, true
 	}
 
-	con, p.queue = p.queue[0], p.queue[1:]
+	class := p.nextClass()
+	con = p.classes[class].pop()
+	recordPushQueueDepth(class, p.classes[class].size)
 
-	request = p.pending[con]
+	queued := p.pending[con]
 	delete(p.pending, con)
+	recordPushQueueWait(class, time.Since(queued.enqueued))
 
 	// Mark the connection as in progress
 	p.processing[con] = nil
 
-	return con, request, false
+	return con, queued.request, false
+}
+
+// nextClass returns the class to dequeue from. Each class with queued connections dequeues
+// as many connections as its weight in a round, higher priority classes first.
+func (p *PushQueue) nextClass() pushClass {
+	for {
+		for c := pushClass(0); c < numPushClasses; c++ {
+			if p.classes[c].size > 0 && p.credits[c] > 0 {
+				p.credits[c]--
+				return c
+			}
+		}
+		// every class with queued connections used its turns, start a new round
+		p.credits = p.weights
+	}
+}
+
+func (p *PushQueue) size() int {
+	n := 0
+	for _, q := range p.classes {
+		n += q.size
+	}
+	return n
 }
 
 func (p *PushQueue) MarkDone(con *Connection) {
@@ -108,8 +318,7 @@ func (p *PushQueue) MarkDone(con *Connection) {
 	// If the info is present, that means Enqueue was called while connection was not yet marked done.
 	// This means we need to add it back to the queue.
 	if request != nil {
-		p.pending[con] = request
-		p.queue = append(p.queue, con)
+		p.add(con, request)
 		p.cond.Signal()
 	}
 }
@@ -118,7 +327,60 @@ func (p *PushQueue) MarkDone(con *Connection) {
 func (p *PushQueue) Pending() int {
 	p.cond.L.Lock()
 	defer p.cond.L.Unlock()
-	return len(p.queue)
+	return p.size()
+}
+
+// QueuedPushDebug holds debug information for a connection waiting for a push.
+type QueuedPushDebug struct {
+	ConnectionID string   `json:"connectionID"`
+	Namespace    string   `json:"namespace"`
+	Class        string   `json:"class"`
+	Full         bool     `json:"full"`
+	Reasons      []string `json:"reasons,omitempty"`
+	Waiting      string   `json:"waiting"`
+}
+
+// Queued returns the connections waiting for a push, in the order of their classes and the time
+// they were queued.
+func (p *PushQueue) Queued() []QueuedPushDebug {
+	p.cond.L.Lock()
+	defer p.cond.L.Unlock()
+	type entry struct {
+		debug    QueuedPushDebug
+		class    pushClass
+		enqueued time.Time
+	}
+	entries := make([]entry, 0, len(p.pending))
+	now := time.Now()
+	for con, queued := range p.pending {
+		reasons := make([]string, 0, len(queued.request.Reason))
+		for _, r := range queued.request.Reason {
+			reasons = append(reasons, string(r))
+		}
+		entries = append(entries, entry{
+			debug: QueuedPushDebug{
+				ConnectionID: con.ConID,
+				Namespace:    connectionNamespace(con),
+				Class:        queued.class.String(),
+				Full:         queued.request.Full,
+				Reasons:      reasons,
+				Waiting:      now.Sub(queued.enqueued).String(),
+			},
+			class:    queued.class,
+			enqueued: queued.enqueued,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].class != entries[j].class {
+			return entries[i].class < entries[j].class
+		}
+		return entries[i].enqueued.Before(entries[j].enqueued)
+	})
+	out := make([]QueuedPushDebug, 0, len(entries))
+	for _, e := range entries {
+		out = append(out, e.debug)
+	}
+	return out
 }
 
 // ShutDown will cause queue to ignore all new items added to it. As soon as the
@@ -291,3 +291,117 @@ func TestProxyQueue(t *testing.T) {
 		}
 	})
 }
+
+func TestProxyQueuePriority(t *testing.T) {
+	gateway := func(name string) *Connection {
+		return &Connection{ConID: name, proxy: &model.Proxy{Type: model.Router, ConfigNamespace: "istio-system"}}
+	}
+	sidecar := func(name, ns string) *Connection {
+		return &Connection{ConID: name, proxy: &model.Proxy{Type: model.SidecarProxy, ConfigNamespace: ns}}
+	}
+
+	t.Run("classes", func(t *testing.T) {
+		p := newPushQueue([numPushClasses]int{1, 1, 1})
+		defer p.ShutDown()
+		full, eds, gw := sidecar("full", "a"), sidecar("eds", "a"), gateway("gw")
+		p.Enqueue(full, &model.PushRequest{Full: true})
+		p.Enqueue(eds, &model.PushRequest{Full: false})
+		p.Enqueue(gw, &model.PushRequest{Full: true})
+
+		ExpectDequeue(t, p, gw)
+		ExpectDequeue(t, p, eds)
+		ExpectDequeue(t, p, full)
+	})
+
+	t.Run("weights", func(t *testing.T) {
+		p := newPushQueue([numPushClasses]int{1, 2, 1})
+		defer p.ShutDown()
+		fulls := []*Connection{sidecar("full-0", "a"), sidecar("full-1", "a")}
+		eds := []*Connection{sidecar("eds-0", "a"), sidecar("eds-1", "a"), sidecar("eds-2", "a"), sidecar("eds-3", "a")}
+		for _, con := range fulls {
+			p.Enqueue(con, &model.PushRequest{Full: true})
+		}
+		for _, con := range eds {
+			p.Enqueue(con, &model.PushRequest{})
+		}
+
+		// full pushes get their turn once incremental pushes used theirs
+		for _, expected := range []*Connection{eds[0], eds[1], fulls[0], eds[2], eds[3], fulls[1]} {
+			ExpectDequeue(t, p, expected)
+		}
+	})
+
+	t.Run("namespaces", func(t *testing.T) {
+		p := newPushQueue(defaultPushQueueWeights)
+		defer p.ShutDown()
+		a0, a1, a2, b0 := sidecar("a-0", "a"), sidecar("a-1", "a"), sidecar("a-2", "a"), sidecar("b-0", "b")
+		for _, con := range []*Connection{a0, a1, a2, b0} {
+			p.Enqueue(con, &model.PushRequest{Full: true})
+		}
+
+		for _, expected := range []*Connection{a0, b0, a1, a2} {
+			ExpectDequeue(t, p, expected)
+		}
+	})
+
+	t.Run("merged", func(t *testing.T) {
+		p := newPushQueue([numPushClasses]int{1, 1, 1})
+		defer p.ShutDown()
+		eds0, eds1, full := sidecar("eds-0", "b"), sidecar("eds-1", "a"), sidecar("full", "a")
+		p.Enqueue(eds0, &model.PushRequest{})
+		p.Enqueue(eds1, &model.PushRequest{})
+		p.Enqueue(full, &model.PushRequest{Full: true})
+		// a full push merged into a queued incremental push is queued as a full push
+		p.Enqueue(eds0, &model.PushRequest{Full: true})
+
+		for _, q := range p.Queued() {
+			if q.ConnectionID == "eds-0" && (q.Class != "full" || !q.Full) {
+				t.Errorf("expected merged push to be queued as full push, got %+v", q)
+			}
+		}
+		for _, expected := range []*Connection{eds1, full, eds0} {
+			ExpectDequeue(t, p, expected)
+		}
+		if p.Pending() != 0 {
+			t.Errorf("expected no pending pushes, got %d", p.Pending())
+		}
+	})
+
+	t.Run("queued", func(t *testing.T) {
+		p := newPushQueue(defaultPushQueueWeights)
+		defer p.ShutDown()
+		p.Enqueue(sidecar("full", "a"), &model.PushRequest{Full: true, Reason: []model.TriggerReason{model.ConfigUpdate}})
+		p.Enqueue(gateway("gw"), &model.PushRequest{Full: true})
+
+		queued := p.Queued()
+		if len(queued) != 2 {
+			t.Fatalf("expected 2 queued pushes, got %v", queued)
+		}
+		if queued[0].ConnectionID != "gw" || queued[0].Class != "gateway" {
+			t.Errorf("expected gateway push first, got %+v", queued[0])
+		}
+		if queued[1].ConnectionID != "full" || queued[1].Class != "full" || queued[1].Namespace != "a" ||
+			!reflect.DeepEqual(queued[1].Reasons, []string{string(model.ConfigUpdate)}) {
+			t.Errorf("unexpected full push %+v", queued[1])
+		}
+	})
+}
+
+func TestParsePushQueueWeights(t *testing.T) {
+	cases := []struct {
+		in   string
+		want [numPushClasses]int
+	}{
+		{"", defaultPushQueueWeights},
+		{"gateway=10,incremental=5,full=2", [numPushClasses]int{10, 5, 2}},
+		{" full = 3 ", [numPushClasses]int{4, 2, 3}},
+		{"gateway=0,incremental=x,unknown=3,full", defaultPushQueueWeights},
+	}
+	for _, tt := range cases {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := parsePushQueueWeights(tt.in); got != tt.want {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"istio.io/istio/pilot/pkg/networking/util"
 	"istio.io/istio/pkg/config"
 	"istio.io/istio/pkg/config/schema/gvk"
+	maistramodel "istio.io/istio/pkg/servicemesh/model"
 )
 
 type RdsGenerator struct {
@@ -35,6 +36,8 @@ var skippedRdsConfigs = map[config.GroupVersionKind]struct{}{
 	gvk.RequestAuthentication: {},
 	gvk.PeerAuthentication:    {},
 	gvk.Secret:                {},
+
+	maistramodel.ServiceMeshExtensionKind: {},
 }
 
 func rdsNeedsPush(req *model.PushRequest) bool {
@@ -26,6 +26,7 @@ import (
 	"istio.io/istio/pilot/pkg/networking/util"
 	"istio.io/istio/pilot/pkg/secrets"
 	authnmodel "istio.io/istio/pilot/pkg/security/model"
+	v3 "istio.io/istio/pilot/pkg/xds/v3"
 	"istio.io/istio/pkg/config/schema/gvk"
 )
 
@@ -46,6 +47,10 @@ func (sr SecretResource) Key() string {
 	return "sds://" + sr.ResourceName
 }
 
+func (sr SecretResource) TypeURL() string {
+	return v3.SecretType
+}
+
 func (sr SecretResource) DependentConfigs() []model.ConfigKey {
 	return relatedConfigs(model.ConfigKey{Kind: gvk.Secret, Name: sr.Name, Namespace: sr.Namespace})
 }
@@ -94,29 +99,40 @@ func (s *SecretGen) proxyAuthorizedForSecret(proxy *model.Proxy, sr SecretResour
 	return nil
 }
 
-func (s *SecretGen) Generate(proxy *model.Proxy, _ *model.PushContext, w *model.WatchedResource, req *model.PushRequest) model.Resources {
+func (s *SecretGen) Generate(proxy *model.Proxy, push *model.PushContext, w *model.WatchedResource, req *model.PushRequest) model.Resources {
+	if w == nil {
+		return nil
+	}
+	// Trust bundles are public, and are served to every proxy regardless of its type and identity.
+	results, resourceNames := generateTrustBundles(push, w.ResourceNames, req)
+	if len(resourceNames) == 0 {
+		return results
+	}
+	if s.secrets == nil {
+		adsLog.Warnf("proxy %v requested secrets, but no credential reader is configured", proxy.ID)
+		return results
+	}
 	if proxy.VerifiedIdentity == nil {
 		adsLog.Warnf("proxy %v is not authorized to receive secrets. Ensure you are connecting over TLS port and are authenticated.", proxy.ID)
-		return nil
+		return results
 	}
 	secrets, err := s.secrets.ForCluster(proxy.Metadata.ClusterID)
 	if err != nil {
 		adsLog.Warnf("proxy %v is from an unknown cluster, cannot retrieve certificates: %v", proxy.ID, err)
-		return nil
+		return results
 	}
 	if err := secrets.Authorize(proxy.VerifiedIdentity.ServiceAccount, proxy.VerifiedIdentity.Namespace); err != nil {
 		adsLog.Warnf("proxy %v is not authorized to receive secrets: %v", proxy.ID, err)
-		return nil
+		return results
 	}
 	if req == nil || !needsUpdate(proxy, req.ConfigsUpdated) {
-		return nil
+		return results
 	}
 	var updatedSecrets map[model.ConfigKey]struct{}
 	if !req.Full {
 		updatedSecrets = model.ConfigsOfKind(req.ConfigsUpdated, gvk.Secret)
 	}
-	results := model.Resources{}
-	for _, resource := range w.ResourceNames {
+	for _, resource := range resourceNames {
 		sr, err := parseResourceName(resource, proxy.ConfigNamespace)
 		if err != nil {
 			adsLog.Warnf("error parsing resource name: %v", err)
@@ -144,7 +160,7 @@ func (s *SecretGen) Generate(proxy *model.Proxy, _ *model.PushContext, w *model.
 		if isCAOnlySecret {
 			secret := secrets.GetCaCert(sr.Name, sr.Namespace)
 			if secret != nil {
-				res := toEnvoyCaSecret(sr.ResourceName, secret)
+				res := toEnvoyCaSecret(sr.ResourceName, secret, nil)
 				results = append(results, res)
 				s.cache.Add(sr, res)
 			} else {
@@ -164,17 +180,74 @@ func (s *SecretGen) Generate(proxy *model.Proxy, _ *model.PushContext, w *model.
 	return results
 }
 
-func toEnvoyCaSecret(name string, cert []byte) *any.Any {
+// GenerateDeltas returns the trust bundles and credentials that may have changed. Generate leaves out the
+// secrets a push does not affect, so the result is never the complete set of watched secrets, and secrets
+// are only removed once the client unsubscribes from them.
+func (s *SecretGen) GenerateDeltas(proxy *model.Proxy, push *model.PushContext, w *model.WatchedResource,
+	req *model.PushRequest) (model.DeltaResources, []string, bool) {
+	res := s.Generate(proxy, push, w, req)
+	if len(res) == 0 {
+		return nil, nil, true
+	}
+	return toDeltaResources(v3.SecretType, res), nil, true
+}
+
+// generateTrustBundles generates the requested trust bundles of federated SPIFFE trust domains. It returns
+// the remaining resource names, which refer to credentials.
+func generateTrustBundles(push *model.PushContext, names []string, req *model.PushRequest) (model.Resources, []string) {
+	var remaining []string
+	var bundles []string
+	for _, name := range names {
+		if strings.HasPrefix(name, authnmodel.TrustBundleResourcePrefix) {
+			bundles = append(bundles, name)
+		} else {
+			remaining = append(remaining, name)
+		}
+	}
+	// Trust bundles only change with global pushes, which are triggered for trust bundle updates.
+	if len(bundles) == 0 || req == nil || !req.Full || len(req.ConfigsUpdated) > 0 {
+		return nil, remaining
+	}
+
+	results := model.Resources{}
+	for _, name := range bundles {
+		var roots, crl []byte
+		if push != nil && push.TrustBundles != nil {
+			if name == authnmodel.MeshTrustBundleResourceName {
+				roots = push.TrustBundles.MeshTrustBundle()
+				crl = push.TrustBundles.MeshCRL()
+			} else {
+				roots = push.TrustBundles.TrustBundle(strings.TrimPrefix(name, authnmodel.TrustBundleResourcePrefix))
+			}
+		}
+		if len(roots) == 0 {
+			adsLog.Warnf("failed to fetch trust bundle for %v", name)
+			continue
+		}
+		results = append(results, toEnvoyCaSecret(name, roots, crl))
+	}
+	return results, remaining
+}
+
+func toEnvoyCaSecret(name string, cert, crl []byte) *any.Any {
+	validationContext := &tls.CertificateValidationContext{
+		TrustedCa: &core.DataSource{
+			Specifier: &core.DataSource_InlineBytes{
+				InlineBytes: cert,
+			},
+		},
+	}
+	if len(crl) > 0 {
+		validationContext.Crl = &core.DataSource{
+			Specifier: &core.DataSource_InlineBytes{
+				InlineBytes: crl,
+			},
+		}
+	}
 	return util.MessageToAny(&tls.Secret{
 		Name: name,
 		Type: &tls.Secret_ValidationContext{
-			ValidationContext: &tls.CertificateValidationContext{
-				TrustedCa: &core.DataSource{
-					Specifier: &core.DataSource_InlineBytes{
-						InlineBytes: cert,
-					},
-				},
-			},
+			ValidationContext: validationContext,
 		},
 	})
 }
@@ -236,7 +309,7 @@ type SecretGen struct {
 	cache model.XdsCache
 }
 
-var _ model.XdsResourceGenerator = &SecretGen{}
+var _ model.XdsDeltaResourceGenerator = &SecretGen{}
 
 func NewSecretGen(sc secrets.MulticlusterController, cache model.XdsCache) *SecretGen {
 	// TODO: Currently we only have a single secrets controller (Kubernetes). In the future, we will need a mapping
@@ -19,6 +19,7 @@ import (
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -340,3 +341,87 @@ func TestGenerate(t *testing.T) {
 		})
 	}
 }
+
+type fakeTrustBundles map[string]string
+
+func (f fakeTrustBundles) FederatedTrustDomains() []string {
+	return []string{"example.org"}
+}
+
+func (f fakeTrustBundles) TrustBundle(trustDomain string) []byte {
+	return []byte(f[trustDomain])
+}
+
+func (f fakeTrustBundles) MeshTrustBundle() []byte {
+	return []byte(f["cluster.local"] + f["example.org"])
+}
+
+func (f fakeTrustBundles) MeshCRL() []byte {
+	return []byte(f["crl"])
+}
+
+func TestGenerateTrustBundles(t *testing.T) {
+	push := model.NewPushContext()
+	push.TrustBundles = fakeTrustBundles{"cluster.local": "mesh-root", "example.org": "example-root", "crl": "mesh-crl"}
+	gen := NewSecretGen(nil, &model.DisabledCache{})
+	resources := []string{"spiffe-bundle://example.org", authnmodel.MeshTrustBundleResourceName, "spiffe-bundle://unknown.org"}
+
+	cases := []struct {
+		name      string
+		request   *model.PushRequest
+		expect    map[string]string
+		expectCRL map[string]string
+	}{
+		{
+			name:    "full push",
+			request: &model.PushRequest{Full: true},
+			expect: map[string]string{
+				"spiffe-bundle://example.org":          "example-root",
+				authnmodel.MeshTrustBundleResourceName: "mesh-rootexample-root",
+			},
+			// Peers are checked against the CRL of the mesh CA with the mesh trust bundle as well.
+			expectCRL: map[string]string{
+				authnmodel.MeshTrustBundleResourceName: "mesh-crl",
+			},
+		},
+		{
+			name: "config update",
+			request: &model.PushRequest{Full: true, ConfigsUpdated: map[model.ConfigKey]struct{}{
+				{Name: "generic", Namespace: "istio-system", Kind: gvk.Secret}: {},
+			}},
+			expect: map[string]string{},
+		},
+		{
+			name:    "incremental push",
+			request: &model.PushRequest{Full: false},
+			expect:  map[string]string{},
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			// Trust bundles are served to sidecars without a verified identity.
+			proxy := &model.Proxy{Type: model.SidecarProxy, Metadata: &model.NodeMetadata{}}
+			raw := xdstest.ExtractTLSSecrets(t, gen.Generate(proxy, push, &model.WatchedResource{ResourceNames: resources}, tt.request))
+			got := map[string]string{}
+			gotCRL := map[string]string{}
+			for _, scrt := range raw {
+				got[scrt.Name] = string(scrt.GetValidationContext().GetTrustedCa().GetInlineBytes())
+				if crl := scrt.GetValidationContext().GetCrl(); crl != nil {
+					gotCRL[scrt.Name] = string(crl.GetInlineBytes())
+				}
+			}
+			if diff := cmp.Diff(got, tt.expect); diff != "" {
+				t.Fatal(diff)
+			}
+			if diff := cmp.Diff(gotCRL, tt.expectCRL, cmpopts.EquateEmpty()); diff != "" {
+				t.Fatal(diff)
+			}
+
+			// Delta clients keep the trust bundles that are not part of the push.
+			res, removed, usedDelta := gen.GenerateDeltas(proxy, push, &model.WatchedResource{ResourceNames: resources}, tt.request)
+			if !usedDelta || len(removed) != 0 || len(res) != len(tt.expect) {
+				t.Fatalf("unexpected delta: %d resources, removed %v, usedDelta %v", len(res), removed, usedDelta)
+			}
+		})
+	}
+}
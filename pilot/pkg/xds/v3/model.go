@@ -25,6 +25,8 @@ const (
 	RouteType     = resource.RouteType
 	SecretType    = resource.SecretType
 	NameTableType = "type.googleapis.com/istio.networking.nds.v1.NameTable"
+
+	ExtensionConfigurationType = "type.googleapis.com/envoy.config.core.v3.TypedExtensionConfig"
 )
 
 // GetShortType returns an abbreviated form of a type, useful for logging or human friendly messages
@@ -42,6 +44,8 @@ func GetShortType(typeURL string) string {
 		return "SDS"
 	case NameTableType:
 		return "NDS"
+	case ExtensionConfigurationType:
+		return "ECDS"
 	default:
 		return typeURL
 	}
@@ -62,6 +66,8 @@ func GetMetricType(typeURL string) string {
 		return "sds"
 	case NameTableType:
 		return "nds"
+	case ExtensionConfigurationType:
+		return "ecds"
 	default:
 		return typeURL
 	}
@@ -23,6 +23,7 @@ import (
 
 	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
+	v3 "istio.io/istio/pilot/pkg/xds/v3"
 	"istio.io/istio/pkg/config"
 	"istio.io/istio/pkg/config/schema/gvk"
 )
@@ -32,9 +33,35 @@ var (
 	any2 = &any.Any{TypeUrl: "bar"}
 )
 
-var XdsCacheTypes = map[string]int{
-	"InMemory": 0,
-	"Lru":      50,
+var XdsCacheTypes = map[string]model.XdsCacheOptions{
+	"InMemory": {},
+	"Lru":      {MaxEntries: 50},
+	"Sharded":  {MaxEntries: 50, Shards: 16},
+	"Bytes":    {MaxBytes: 1 << 20, Shards: 4},
+}
+
+// fakeCacheEntry is a cache entry of an arbitrary resource type, used to test the cache independently of the
+// builders. Only endpoints and secrets are cached by their builders.
+type fakeCacheEntry struct {
+	key        string
+	typeURL    string
+	dependents []model.ConfigKey
+}
+
+func (f fakeCacheEntry) Key() string {
+	return f.key
+}
+
+func (f fakeCacheEntry) TypeURL() string {
+	return f.typeURL
+}
+
+func (f fakeCacheEntry) DependentConfigs() []model.ConfigKey {
+	return f.dependents
+}
+
+func (f fakeCacheEntry) Cacheable() bool {
+	return true
 }
 
 func TestXdsCache(t *testing.T) {
@@ -46,12 +73,10 @@ func TestXdsCache(t *testing.T) {
 		clusterName: "outbound|2||foo.com",
 		service:     &model.Service{Hostname: "foo.com"},
 	}
-	for ct, cs := range XdsCacheTypes {
-		defaultCache := features.XDSCacheMaxSize
-		features.XDSCacheMaxSize = cs
-		defer func() { features.XDSCacheMaxSize = defaultCache }()
+	for ct, opts := range XdsCacheTypes {
+		opts := opts
 		t.Run(fmt.Sprintf("%s_%s", "simple", ct), func(t *testing.T) {
-			c := model.NewXdsCache()
+			c := model.NewXdsCacheWithOptions(opts)
 			c.Add(ep1, any1)
 			if !reflect.DeepEqual(c.Keys(), []string{ep1.Key()}) {
 				t.Fatalf("unexpected keys: %v, want %v", c.Keys(), ep1.Key())
@@ -70,7 +95,7 @@ func TestXdsCache(t *testing.T) {
 		})
 
 		t.Run(fmt.Sprintf("%s_%s", "multiple hostnames", ct), func(t *testing.T) {
-			c := model.NewXdsCache()
+			c := model.NewXdsCacheWithOptions(opts)
 			c.Add(ep1, any1)
 			c.Add(ep2, any2)
 
@@ -90,7 +115,7 @@ func TestXdsCache(t *testing.T) {
 		})
 
 		t.Run(fmt.Sprintf("%s_%s", "multiple destinationRules", ct), func(t *testing.T) {
-			c := model.NewXdsCache()
+			c := model.NewXdsCacheWithOptions(opts)
 			ep1 := ep1
 			ep1.destinationRule = &config.Config{Meta: config.Meta{Name: "a", Namespace: "b"}}
 			ep2 := ep2
@@ -121,7 +146,7 @@ func TestXdsCache(t *testing.T) {
 		})
 
 		t.Run(fmt.Sprintf("%s_%s", "clear all", ct), func(t *testing.T) {
-			c := model.NewXdsCache()
+			c := model.NewXdsCacheWithOptions(opts)
 			c.Add(ep1, any1)
 			c.Add(ep2, any2)
 
@@ -136,5 +161,113 @@ func TestXdsCache(t *testing.T) {
 				t.Fatalf("unexpected result, found key when not expected: %v", c.Keys())
 			}
 		})
+
+		t.Run(fmt.Sprintf("%s_%s", "resource types", ct), func(t *testing.T) {
+			c := model.NewXdsCacheWithOptions(opts)
+			dr := model.ConfigKey{Kind: gvk.DestinationRule, Name: "a", Namespace: "b"}
+			cds := fakeCacheEntry{key: "cds~outbound|80||foo.com", typeURL: v3.ClusterType, dependents: []model.ConfigKey{dr}}
+			lds := fakeCacheEntry{key: "lds~0.0.0.0_80", typeURL: v3.ListenerType}
+			c.Add(ep1, any1)
+			c.Add(cds, any1)
+			c.Add(lds, any2)
+			if got, _ := c.Get(cds); got != any1 {
+				t.Fatalf("unexpected result: %v, want %v", got, any1)
+			}
+			if got, _ := c.Get(lds); got != any2 {
+				t.Fatalf("unexpected result: %v, want %v", got, any2)
+			}
+			c.Clear(map[model.ConfigKey]struct{}{dr: {}})
+			if _, f := c.Get(cds); f {
+				t.Fatalf("unexpected result, found key when not expected: %v", c.Keys())
+			}
+			if _, f := c.Get(lds); !f {
+				t.Fatalf("expected key %v, got: %v", lds.Key(), c.Keys())
+			}
+			if _, f := c.Get(ep1); !f {
+				t.Fatalf("expected key %v, got: %v", ep1.Key(), c.Keys())
+			}
+		})
+	}
+}
+
+func TestXdsCacheDefaults(t *testing.T) {
+	defaultSize, defaultShards := features.XDSCacheMaxSize, features.XDSCacheShards
+	features.XDSCacheMaxSize, features.XDSCacheShards = 2, 16
+	defer func() { features.XDSCacheMaxSize, features.XDSCacheShards = defaultSize, defaultShards }()
+
+	c := model.NewXdsCache()
+	for i := 0; i < 10; i++ {
+		c.Add(fakeCacheEntry{key: fmt.Sprintf("key-%d", i), typeURL: v3.ClusterType}, any1)
+	}
+	if got := len(c.Keys()); got != 2 {
+		t.Fatalf("expected the cache to be bounded to 2 entries, got %v", c.Keys())
 	}
 }
+
+func TestXdsCacheEviction(t *testing.T) {
+	entry := func(i int) fakeCacheEntry {
+		return fakeCacheEntry{
+			key:        fmt.Sprintf("key-%d", i),
+			typeURL:    v3.ClusterType,
+			dependents: []model.ConfigKey{{Kind: gvk.ServiceEntry, Name: fmt.Sprintf("svc-%d", i)}},
+		}
+	}
+	value := &any.Any{TypeUrl: "foo", Value: make([]byte, 100)}
+	// Each entry takes 100 bytes of value, 3 bytes of type and 5 bytes of key.
+	entrySize := int64(108)
+
+	t.Run("entries", func(t *testing.T) {
+		c := model.NewXdsCacheWithOptions(model.XdsCacheOptions{MaxEntries: 2})
+		c.Add(entry(0), value)
+		c.Add(entry(1), value)
+		// Touch the first entry so the second one is the least recently used
+		c.Get(entry(0))
+		c.Add(entry(2), value)
+		if _, f := c.Get(entry(1)); f {
+			t.Fatalf("expected least recently used entry to be evicted, got %v", c.Keys())
+		}
+		for _, i := range []int{0, 2} {
+			if _, f := c.Get(entry(i)); !f {
+				t.Fatalf("expected %v to be cached, got %v", entry(i).Key(), c.Keys())
+			}
+		}
+	})
+
+	t.Run("bytes", func(t *testing.T) {
+		c := model.NewXdsCacheWithOptions(model.XdsCacheOptions{MaxBytes: 2 * entrySize})
+		for i := 0; i < 3; i++ {
+			c.Add(entry(i), value)
+		}
+		if _, f := c.Get(entry(0)); f {
+			t.Fatalf("expected oldest entry to be evicted, got %v", c.Keys())
+		}
+		if len(c.Keys()) != 2 {
+			t.Fatalf("expected 2 entries, got %v", c.Keys())
+		}
+		// Evicted entries are removed from the config index as well; clearing them is a no-op.
+		c.Clear(map[model.ConfigKey]struct{}{{Kind: gvk.ServiceEntry, Name: "svc-0"}: {}})
+		if len(c.Keys()) != 2 {
+			t.Fatalf("expected 2 entries, got %v", c.Keys())
+		}
+	})
+
+	t.Run("oversized", func(t *testing.T) {
+		c := model.NewXdsCacheWithOptions(model.XdsCacheOptions{MaxBytes: 2 * entrySize})
+		c.Add(entry(0), value)
+		c.Add(entry(1), &any.Any{TypeUrl: "foo", Value: make([]byte, 3*entrySize)})
+		if !reflect.DeepEqual(c.Keys(), []string{entry(0).Key()}) {
+			t.Fatalf("expected oversized entry not to be cached, got %v", c.Keys())
+		}
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		c := model.NewXdsCacheWithOptions(model.XdsCacheOptions{MaxBytes: 2 * entrySize})
+		for i := 0; i < 5; i++ {
+			c.Add(entry(0), value)
+		}
+		c.Add(entry(1), value)
+		if len(c.Keys()) != 2 {
+			t.Fatalf("expected replaced entries to be accounted once, got %v", c.Keys())
+		}
+	})
+}
@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -114,6 +115,10 @@ type Config struct {
 	ResponseHandler ResponseHandler
 
 	GrpcOpts []grpc.DialOption
+
+	// Delta uses the delta ADS protocol instead of the state of the world one. The responses are
+	// merged with the resources received before, so that handlers still see all the resources of a type.
+	Delta bool
 }
 
 // ADSC implements a basic client for ADS, for use in stress tests and tools
@@ -122,6 +127,8 @@ type ADSC struct {
 	// Stream is the GRPC connection stream, allowing direct GRPC send operations.
 	// Set after Dial is called.
 	stream discovery.AggregatedDiscoveryService_StreamAggregatedResourcesClient
+	// deltaStream is the delta ADS stream, used instead of stream if Config.Delta is set.
+	deltaStream discovery.AggregatedDiscoveryService_DeltaAggregatedResourcesClient
 	// xds client used to create a stream
 	client discovery.AggregatedDiscoveryServiceClient
 	conn   *grpc.ClientConn
@@ -196,6 +203,12 @@ type ADSC struct {
 	sync     map[string]time.Time
 	syncCh   chan string
 	Locality *core.Locality
+
+	// subscriptions are the names of the resources subscribed to on the delta stream, by type
+	subscriptions map[string]map[string]struct{}
+	// deltaResources are the resources received on the delta stream, by type and name
+	deltaResources map[string]map[string]*any.Any
+	deltaMutex     sync.Mutex
 }
 
 type ResponseHandler interface {
@@ -367,7 +380,15 @@ func (a *ADSC) Close() {
 func (a *ADSC) Run() error {
 	var err error
 	a.client = discovery.NewAggregatedDiscoveryServiceClient(a.conn)
-	a.stream, err = a.client.StreamAggregatedResources(context.Background())
+	if a.cfg.Delta {
+		a.deltaStream, err = a.client.DeltaAggregatedResources(context.Background())
+		a.deltaMutex.Lock()
+		a.subscriptions = map[string]map[string]struct{}{}
+		a.deltaMutex.Unlock()
+		a.deltaResources = map[string]map[string]*any.Any{}
+	} else {
+		a.stream, err = a.client.StreamAggregatedResources(context.Background())
+	}
 	if err != nil {
 		return err
 	}
@@ -421,7 +442,7 @@ func (a *ADSC) reconnect() {
 func (a *ADSC) handleRecv() {
 	for {
 		var err error
-		msg, err := a.stream.Recv()
+		msg, err := a.recv()
 		if err != nil {
 			a.RecvWg.Done()
 			adscLog.Infof("Connection closed for node %v with err: %v", a.nodeID, err)
@@ -436,101 +457,143 @@ func (a *ADSC) handleRecv() {
 			}
 			return
 		}
+		a.handleResponse(msg)
+	}
+}
+
+// recv returns the next response of the stream. Delta responses are merged with the resources
+// received before.
+func (a *ADSC) recv() (*discovery.DiscoveryResponse, error) {
+	if a.deltaStream == nil {
+		return a.stream.Recv()
+	}
+	resp, err := a.deltaStream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	resources := a.deltaResources[resp.TypeUrl]
+	if resources == nil {
+		resources = map[string]*any.Any{}
+		a.deltaResources[resp.TypeUrl] = resources
+	}
+	for _, r := range resp.Resources {
+		resources[r.Name] = r.Resource
+	}
+	for _, name := range resp.RemovedResources {
+		delete(resources, name)
+	}
+	names := make([]string, 0, len(resources))
+	for name := range resources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	msg := &discovery.DiscoveryResponse{
+		TypeUrl:     resp.TypeUrl,
+		VersionInfo: resp.SystemVersionInfo,
+		Nonce:       resp.Nonce,
+		Resources:   make([]*any.Any, 0, len(names)),
+	}
+	for _, name := range names {
+		msg.Resources = append(msg.Resources, resources[name])
+	}
+	return msg, nil
+}
 
-		// Group-value-kind - used for high level api generator.
-		gvk := strings.SplitN(msg.TypeUrl, "/", 3)
+func (a *ADSC) handleResponse(msg *discovery.DiscoveryResponse) {
+	var err error
+	// Group-value-kind - used for high level api generator.
+	gvk := strings.SplitN(msg.TypeUrl, "/", 3)
 
-		adscLog.Infoa("Received ", a.url, " type ", msg.TypeUrl,
-			" cnt=", len(msg.Resources), " nonce=", msg.Nonce)
-		if a.cfg.ResponseHandler != nil {
-			a.cfg.ResponseHandler.HandleResponse(a, msg)
-		}
+	adscLog.Infoa("Received ", a.url, " type ", msg.TypeUrl,
+		" cnt=", len(msg.Resources), " nonce=", msg.Nonce)
+	if a.cfg.ResponseHandler != nil {
+		a.cfg.ResponseHandler.HandleResponse(a, msg)
+	}
 
-		if msg.TypeUrl == collections.IstioMeshV1Alpha1MeshConfig.Resource().GroupVersionKind().String() &&
-			len(msg.Resources) > 0 {
-			rsc := msg.Resources[0]
-			m := &v1alpha1.MeshConfig{}
-			err = proto.Unmarshal(rsc.Value, m)
+	if msg.TypeUrl == collections.IstioMeshV1Alpha1MeshConfig.Resource().GroupVersionKind().String() &&
+		len(msg.Resources) > 0 {
+		rsc := msg.Resources[0]
+		m := &v1alpha1.MeshConfig{}
+		err = proto.Unmarshal(rsc.Value, m)
+		if err != nil {
+			log.Warna("Failed to unmarshal mesh config", err)
+		}
+		a.Mesh = m
+		if a.LocalCacheDir != "" {
+			// TODO: use jsonpb
+			strResponse, err := json.MarshalIndent(m, "  ", "  ")
 			if err != nil {
-				log.Warna("Failed to unmarshal mesh config", err)
+				return
 			}
-			a.Mesh = m
-			if a.LocalCacheDir != "" {
-				// TODO: use jsonpb
-				strResponse, err := json.MarshalIndent(m, "  ", "  ")
-				if err != nil {
-					continue
-				}
-				err = ioutil.WriteFile(a.LocalCacheDir+"_mesh.json", strResponse, 0644)
-				if err != nil {
-					continue
-				}
-			}
-			continue
-		}
-
-		// Process the resources.
-		listeners := []*listener.Listener{}
-		clusters := []*cluster.Cluster{}
-		routes := []*route.RouteConfiguration{}
-		eds := []*endpoint.ClusterLoadAssignment{}
-		for _, rsc := range msg.Resources { // Any
-			a.VersionInfo[rsc.TypeUrl] = msg.VersionInfo
-			valBytes := rsc.Value
-			switch rsc.TypeUrl {
-			case v3.ListenerType:
-				ll := &listener.Listener{}
-				_ = proto.Unmarshal(valBytes, ll)
-				listeners = append(listeners, ll)
-			case v3.ClusterType:
-				cl := &cluster.Cluster{}
-				_ = proto.Unmarshal(valBytes, cl)
-				clusters = append(clusters, cl)
-			case v3.EndpointType:
-				el := &endpoint.ClusterLoadAssignment{}
-				_ = proto.Unmarshal(valBytes, el)
-				eds = append(eds, el)
-			case v3.RouteType:
-				rl := &route.RouteConfiguration{}
-				_ = proto.Unmarshal(valBytes, rl)
-				routes = append(routes, rl)
-			default:
-				err = a.handleMCP(gvk, rsc, valBytes)
-				if err != nil {
-					log.Warnf("Error handling received MCP config %v", err)
-				}
+			err = ioutil.WriteFile(a.LocalCacheDir+"_mesh.json", strResponse, 0644)
+			if err != nil {
+				return
 			}
 		}
+		return
+	}
 
-		// If we got no resource - still save to the store with empty name/namespace, to notify sync
-		// This scheme also allows us to chunk large responses !
-
-		// TODO: add hook to inject nacks
-		switch msg.TypeUrl {
+	// Process the resources.
+	listeners := []*listener.Listener{}
+	clusters := []*cluster.Cluster{}
+	routes := []*route.RouteConfiguration{}
+	eds := []*endpoint.ClusterLoadAssignment{}
+	for _, rsc := range msg.Resources { // Any
+		a.VersionInfo[rsc.TypeUrl] = msg.VersionInfo
+		valBytes := rsc.Value
+		switch rsc.TypeUrl {
+		case v3.ListenerType:
+			ll := &listener.Listener{}
+			_ = proto.Unmarshal(valBytes, ll)
+			listeners = append(listeners, ll)
 		case v3.ClusterType:
-			a.handleCDS(clusters)
+			cl := &cluster.Cluster{}
+			_ = proto.Unmarshal(valBytes, cl)
+			clusters = append(clusters, cl)
 		case v3.EndpointType:
-			a.handleEDS(eds)
-		case v3.ListenerType:
-			a.handleLDS(listeners)
+			el := &endpoint.ClusterLoadAssignment{}
+			_ = proto.Unmarshal(valBytes, el)
+			eds = append(eds, el)
 		case v3.RouteType:
-			a.handleRDS(routes)
+			rl := &route.RouteConfiguration{}
+			_ = proto.Unmarshal(valBytes, rl)
+			routes = append(routes, rl)
+		default:
+			err = a.handleMCP(gvk, rsc, valBytes)
+			if err != nil {
+				log.Warnf("Error handling received MCP config %v", err)
+			}
 		}
+	}
 
-		a.mutex.Lock()
-		if len(gvk) == 3 {
-			gt := config.GroupVersionKind{Group: gvk[0], Version: gvk[1], Kind: gvk[2]}
-			a.sync[gt.String()] = time.Now()
-			a.syncCh <- gt.String()
-		}
-		a.Received[msg.TypeUrl] = msg
-		a.ack(msg)
-		a.mutex.Unlock()
+	// If we got no resource - still save to the store with empty name/namespace, to notify sync
+	// This scheme also allows us to chunk large responses !
 
-		select {
-		case a.XDSUpdates <- msg:
-		default:
-		}
+	// TODO: add hook to inject nacks
+	switch msg.TypeUrl {
+	case v3.ClusterType:
+		a.handleCDS(clusters)
+	case v3.EndpointType:
+		a.handleEDS(eds)
+	case v3.ListenerType:
+		a.handleLDS(listeners)
+	case v3.RouteType:
+		a.handleRDS(routes)
+	}
+
+	a.mutex.Lock()
+	if len(gvk) == 3 {
+		gt := config.GroupVersionKind{Group: gvk[0], Version: gvk[1], Kind: gvk[2]}
+		a.sync[gt.String()] = time.Now()
+		a.syncCh <- gt.String()
+	}
+	a.Received[msg.TypeUrl] = msg
+	a.ack(msg)
+	a.mutex.Unlock()
+
+	select {
+	case a.XDSUpdates <- msg:
+	default:
 	}
 }
 
@@ -760,8 +823,42 @@ func (a *ADSC) Send(req *discovery.DiscoveryRequest) error {
 		req.Node = a.node()
 		a.sendNodeMeta = false
 	}
-	req.ResponseNonce = time.Now().String()
-	return a.stream.Send(req)
+	if a.deltaStream == nil {
+		req.ResponseNonce = time.Now().String()
+	}
+	return a.send(req)
+}
+
+// send a request on the stream. On a delta stream, the resource names of the request are
+// turned into subscriptions to the resources not subscribed to yet, and unsubscriptions from
+// the resources that are no longer requested.
+func (a *ADSC) send(req *discovery.DiscoveryRequest) error {
+	if a.deltaStream == nil {
+		return a.stream.Send(req)
+	}
+	a.deltaMutex.Lock()
+	subscribed := a.subscriptions[req.TypeUrl]
+	requested := make(map[string]struct{}, len(req.ResourceNames))
+	delta := &discovery.DeltaDiscoveryRequest{
+		Node:          req.Node,
+		TypeUrl:       req.TypeUrl,
+		ResponseNonce: req.ResponseNonce,
+		ErrorDetail:   req.ErrorDetail,
+	}
+	for _, name := range req.ResourceNames {
+		requested[name] = struct{}{}
+		if _, f := subscribed[name]; !f {
+			delta.ResourceNamesSubscribe = append(delta.ResourceNamesSubscribe, name)
+		}
+	}
+	for name := range subscribed {
+		if _, f := requested[name]; !f {
+			delta.ResourceNamesUnsubscribe = append(delta.ResourceNamesUnsubscribe, name)
+		}
+	}
+	a.subscriptions[req.TypeUrl] = requested
+	a.deltaMutex.Unlock()
+	return a.deltaStream.Send(delta)
 }
 
 func (a *ADSC) handleEDS(eds []*endpoint.ClusterLoadAssignment) {
@@ -781,7 +878,7 @@ func (a *ADSC) handleEDS(eds []*endpoint.ClusterLoadAssignment) {
 	}
 	if a.InitialLoad == 0 {
 		// first load - Envoy loads listeners after endpoints
-		_ = a.stream.Send(&discovery.DiscoveryRequest{
+		_ = a.send(&discovery.DiscoveryRequest{
 			Node:    a.node(),
 			TypeUrl: v3.ListenerType,
 		})
@@ -956,7 +1053,7 @@ func XdsInitialRequests() []*discovery.DiscoveryRequest {
 // it will start watching RDS and LDS.
 func (a *ADSC) Watch() {
 	a.watchTime = time.Now()
-	_ = a.stream.Send(&discovery.DiscoveryRequest{
+	_ = a.send(&discovery.DiscoveryRequest{
 		Node:    a.node(),
 		TypeUrl: v3.ClusterType,
 	})
@@ -978,14 +1075,14 @@ func ConfigInitialRequests() []*discovery.DiscoveryRequest {
 
 // WatchConfig will use the new experimental API watching, similar with MCP.
 func (a *ADSC) WatchConfig() {
-	_ = a.stream.Send(&discovery.DiscoveryRequest{
+	_ = a.send(&discovery.DiscoveryRequest{
 		ResponseNonce: time.Now().String(),
 		Node:          a.node(),
 		TypeUrl:       collections.IstioMeshV1Alpha1MeshConfig.Resource().GroupVersionKind().String(),
 	})
 
 	for _, sch := range collections.Pilot.All() {
-		_ = a.stream.Send(&discovery.DiscoveryRequest{
+		_ = a.send(&discovery.DiscoveryRequest{
 			ResponseNonce: time.Now().String(),
 			Node:          a.node(),
 			TypeUrl:       sch.Resource().GroupVersionKind().String(),
@@ -1021,7 +1118,7 @@ func (a *ADSC) sendRsc(typeurl string, rsc []string) {
 		version = ex.VersionInfo
 		nonce = ex.Nonce
 	}
-	_ = a.stream.Send(&discovery.DiscoveryRequest{
+	_ = a.send(&discovery.DiscoveryRequest{
 		ResponseNonce: nonce,
 		VersionInfo:   version,
 		Node:          a.node(),
@@ -1043,7 +1140,7 @@ func (a *ADSC) ack(msg *discovery.DiscoveryResponse) {
 		}
 	}
 
-	_ = a.stream.Send(&discovery.DiscoveryRequest{
+	_ = a.send(&discovery.DiscoveryRequest{
 		ResponseNonce: msg.Nonce,
 		TypeUrl:       msg.TypeUrl,
 		Node:          a.node(),
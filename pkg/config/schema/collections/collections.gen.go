@@ -6,6 +6,7 @@ package collections
 import (
 	"reflect"
 
+	githubcomgogoprotobuftypes "github.com/gogo/protobuf/types"
 	k8sioapiappsv1 "k8s.io/api/apps/v1"
 	k8sioapicorev1 "k8s.io/api/core/v1"
 	k8sioapiextensionsv1beta1 "k8s.io/api/extensions/v1beta1"
@@ -452,6 +453,25 @@ var (
 		}.MustBuild(),
 	}.MustBuild()
 
+	// K8SMaistraIoV1Servicemeshmemberrolls describes the collection
+	// k8s/maistra.io/v1/servicemeshmemberrolls
+	K8SMaistraIoV1Servicemeshmemberrolls = collection.Builder{
+		Name:         "k8s/maistra.io/v1/servicemeshmemberrolls",
+		VariableName: "K8SMaistraIoV1Servicemeshmemberrolls",
+		Disabled:     false,
+		Resource: resource.Builder{
+			Group:         "maistra.io",
+			Kind:          "ServiceMeshMemberRoll",
+			Plural:        "servicemeshmemberrolls",
+			Version:       "v1",
+			Proto:         "google.protobuf.Struct",
+			ReflectType:   reflect.TypeOf(&githubcomgogoprotobuftypes.Struct{}).Elem(),
+			ProtoPackage:  "github.com/gogo/protobuf/types",
+			ClusterScoped: false,
+			ValidateProto: validation.EmptyValidate,
+		}.MustBuild(),
+	}.MustBuild()
+
 	// K8SNetworkingIstioIoV1Alpha3Destinationrules describes the collection
 	// k8s/networking.istio.io/v1alpha3/destinationrules
 	K8SNetworkingIstioIoV1Alpha3Destinationrules = collection.Builder{
@@ -800,6 +820,7 @@ var (
 		MustAdd(K8SCoreV1Secrets).
 		MustAdd(K8SCoreV1Services).
 		MustAdd(K8SExtensionsV1Beta1Ingresses).
+		MustAdd(K8SMaistraIoV1Servicemeshmemberrolls).
 		MustAdd(K8SNetworkingIstioIoV1Alpha3Destinationrules).
 		MustAdd(K8SNetworkingIstioIoV1Alpha3Envoyfilters).
 		MustAdd(K8SNetworkingIstioIoV1Alpha3Gateways).
@@ -848,6 +869,7 @@ var (
 		MustAdd(K8SCoreV1Secrets).
 		MustAdd(K8SCoreV1Services).
 		MustAdd(K8SExtensionsV1Beta1Ingresses).
+		MustAdd(K8SMaistraIoV1Servicemeshmemberrolls).
 		MustAdd(K8SNetworkingIstioIoV1Alpha3Destinationrules).
 		MustAdd(K8SNetworkingIstioIoV1Alpha3Envoyfilters).
 		MustAdd(K8SNetworkingIstioIoV1Alpha3Gateways).
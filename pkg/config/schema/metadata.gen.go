@@ -181,6 +181,11 @@ collections:
     kind: "Ingress"
     group: "extensions"
 
+  # Maistra collections
+  - name: "k8s/maistra.io/v1/servicemeshmemberrolls"
+    kind: "ServiceMeshMemberRoll"
+    group: "maistra.io"
+
   - kind: "GatewayClass"
     name: "k8s/service_apis/v1alpha1/gatewayclasses"
     group: "networking.x-k8s.io"
@@ -291,6 +296,7 @@ snapshots:
       - "k8s/core/v1/secrets"
       - "k8s/core/v1/services"
       - "k8s/core/v1/configmaps"
+      - "k8s/maistra.io/v1/servicemeshmemberrolls"
 
 # Configuration for resource types.
 resources:
@@ -362,6 +368,15 @@ resources:
     statusProto: "k8s.io.service_apis.api.v1alpha1.IngressStatus"
     statusProtoPackage: "k8s.io/api/extensions/v1beta1"
 
+  # The member roll is analyzed as an unstructured object with its spec and
+  # status, its types are not protos
+  - kind: "ServiceMeshMemberRoll"
+    plural: "servicemeshmemberrolls"
+    group: "maistra.io"
+    version: "v1"
+    proto: "google.protobuf.Struct"
+    protoPackage: "github.com/gogo/protobuf/types"
+
   - kind: "GatewayClass"
     plural: "gatewayclasses"
     group: "networking.x-k8s.io"
@@ -568,6 +583,7 @@ transforms:
       "k8s/core/v1/secrets": "k8s/core/v1/secrets"
       "k8s/core/v1/services": "k8s/core/v1/services"
       "k8s/core/v1/configmaps": "k8s/core/v1/configmaps"
+      "k8s/maistra.io/v1/servicemeshmemberrolls": "k8s/maistra.io/v1/servicemeshmemberrolls"
       "istio/mesh/v1alpha1/MeshConfig": "istio/mesh/v1alpha1/MeshConfig"
       "istio/mesh/v1alpha1/MeshNetworks": "istio/mesh/v1alpha1/MeshNetworks"
 `)
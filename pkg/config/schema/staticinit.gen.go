@@ -6,6 +6,9 @@ package schema
 import (
 	// Pull in all the known proto types to ensure we get their types registered.
 
+	// Register protos in "github.com/gogo/protobuf/types"
+	_ "github.com/gogo/protobuf/types"
+
 	// Register protos in "istio.io/api/mesh/v1alpha1"
 	_ "istio.io/api/mesh/v1alpha1"
 
@@ -0,0 +1,81 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validation
+
+import (
+	"errors"
+	"fmt"
+
+	networking "istio.io/api/networking/v1alpha3"
+	"istio.io/istio/pkg/config"
+)
+
+// ThriftRoutesAnnotation marks a VirtualService whose http routes apply to the Thrift ports of its
+// hosts. The routes of such a VirtualService are validated with ValidateThriftRoute on admission.
+const ThriftRoutesAnnotation = "maistra.io/thrift-routes"
+
+// HasThriftRoutes returns whether the http routes of a VirtualService apply to Thrift ports.
+func HasThriftRoutes(meta config.Meta) bool {
+	return meta.Annotations[ThriftRoutesAnnotation] == "true"
+}
+
+// ValidateThriftRoute checks that a http route of a VirtualService can be applied to a Thrift service.
+// The route matches the Thrift method with the method match, where an exact match selects a method and
+// a prefix match selects a multiplexed service, and the Thrift headers with the headers match. Only the
+// destinations of the route are supported, as the Envoy Thrift proxy has no equivalent of the other
+// http features. In particular, retries and timeouts are rejected, as the Thrift route action has no
+// retry or timeout policy.
+func ValidateThriftRoute(http *networking.HTTPRoute) (errs error) {
+	if http == nil {
+		return errors.New("thrift route cannot be null")
+	}
+	for _, match := range http.Match {
+		if match == nil {
+			continue
+		}
+		if match.Uri != nil || match.Scheme != nil || match.Authority != nil || len(match.QueryParams) > 0 ||
+			len(match.WithoutHeaders) > 0 || match.IgnoreUriCase {
+			errs = appendErrors(errs, errors.New("thrift route matches only support method, headers, port, "+
+				"sourceLabels, sourceNamespace and gateways"))
+		}
+		if _, ok := match.Method.GetMatchType().(*networking.StringMatch_Regex); ok {
+			errs = appendErrors(errs, errors.New("thrift route method match must be an exact or prefix match"))
+		}
+		for name, header := range match.Headers {
+			if header == nil {
+				errs = appendErrors(errs, fmt.Errorf("header match %v cannot be null", name))
+			}
+			errs = appendErrors(errs, ValidateHTTPHeaderName(name))
+			errs = appendErrors(errs, validateStringMatchRegexp(header, "headers"))
+		}
+	}
+	if http.Redirect != nil || http.Rewrite != nil || http.Delegate != nil {
+		errs = appendErrors(errs, errors.New("thrift routes do not support redirect, rewrite or delegate"))
+	}
+	if http.Mirror != nil || http.MirrorPercent != nil || http.MirrorPercentage != nil {
+		errs = appendErrors(errs, errors.New("thrift routes do not support mirroring"))
+	}
+	if http.Fault != nil || http.CorsPolicy != nil || http.Headers != nil {
+		errs = appendErrors(errs, errors.New("thrift routes do not support fault injection, CORS or header manipulation"))
+	}
+	if http.Retries != nil || http.Timeout != nil {
+		errs = appendErrors(errs, errors.New("thrift routes do not support retries or timeouts"))
+	}
+	if len(http.Route) == 0 {
+		errs = appendErrors(errs, errors.New("thrift route must have at least one destination"))
+	}
+	errs = appendErrors(errs, validateHTTPRouteDestinations(http.Route))
+	return
+}
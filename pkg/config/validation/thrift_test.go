@@ -0,0 +1,165 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validation
+
+import (
+	"testing"
+
+	"github.com/gogo/protobuf/types"
+
+	networking "istio.io/api/networking/v1alpha3"
+	"istio.io/istio/pkg/config"
+)
+
+func TestValidateThriftRoute(t *testing.T) {
+	destination := []*networking.HTTPRouteDestination{{
+		Destination: &networking.Destination{Host: "thrift.default.svc.cluster.local", Subset: "v1"},
+	}}
+	exactMethod := &networking.StringMatch{MatchType: &networking.StringMatch_Exact{Exact: "ping"}}
+	cases := []struct {
+		name  string
+		route *networking.HTTPRoute
+		valid bool
+	}{
+		{
+			name:  "destination only",
+			route: &networking.HTTPRoute{Route: destination},
+			valid: true,
+		},
+		{
+			name: "method and headers",
+			route: &networking.HTTPRoute{
+				Match: []*networking.HTTPMatchRequest{{
+					Method: exactMethod,
+					Headers: map[string]*networking.StringMatch{
+						"x-canary": {MatchType: &networking.StringMatch_Prefix{Prefix: "t"}},
+					},
+					Port: 9090,
+				}},
+				Route: destination,
+			},
+			valid: true,
+		},
+		{
+			name: "weighted destinations",
+			route: &networking.HTTPRoute{
+				Route: []*networking.HTTPRouteDestination{
+					{Destination: &networking.Destination{Host: "thrift", Subset: "v1"}, Weight: 75},
+					{Destination: &networking.Destination{Host: "thrift", Subset: "v2"}, Weight: 25},
+				},
+			},
+			valid: true,
+		},
+		{
+			name: "invalid weights",
+			route: &networking.HTTPRoute{
+				Route: []*networking.HTTPRouteDestination{
+					{Destination: &networking.Destination{Host: "thrift", Subset: "v1"}, Weight: 75},
+					{Destination: &networking.Destination{Host: "thrift", Subset: "v2"}, Weight: 75},
+				},
+			},
+			valid: false,
+		},
+		{
+			name: "regex method",
+			route: &networking.HTTPRoute{
+				Match: []*networking.HTTPMatchRequest{{
+					Method: &networking.StringMatch{MatchType: &networking.StringMatch_Regex{Regex: "p.*"}},
+				}},
+				Route: destination,
+			},
+			valid: false,
+		},
+		{
+			name: "uri match",
+			route: &networking.HTTPRoute{
+				Match: []*networking.HTTPMatchRequest{{
+					Uri: &networking.StringMatch{MatchType: &networking.StringMatch_Prefix{Prefix: "/"}},
+				}},
+				Route: destination,
+			},
+			valid: false,
+		},
+		{
+			name:  "no destination",
+			route: &networking.HTTPRoute{Match: []*networking.HTTPMatchRequest{{Method: exactMethod}}},
+			valid: false,
+		},
+		{
+			name:  "retries",
+			route: &networking.HTTPRoute{Route: destination, Retries: &networking.HTTPRetry{Attempts: 3}},
+			valid: false,
+		},
+		{
+			name:  "timeout",
+			route: &networking.HTTPRoute{Route: destination, Timeout: &types.Duration{Seconds: 1}},
+			valid: false,
+		},
+		{
+			name: "fault",
+			route: &networking.HTTPRoute{Route: destination, Fault: &networking.HTTPFaultInjection{
+				Abort: &networking.HTTPFaultInjection_Abort{
+					ErrorType: &networking.HTTPFaultInjection_Abort_HttpStatus{HttpStatus: 503},
+				},
+			}},
+			valid: false,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateThriftRoute(tt.route); (err == nil) != tt.valid {
+				t.Errorf("ValidateThriftRoute() error = %v, valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestValidateThriftVirtualService(t *testing.T) {
+	virtualService := &networking.VirtualService{
+		Hosts: []string{"thrift.default.svc.cluster.local"},
+		Http: []*networking.HTTPRoute{{
+			Route: []*networking.HTTPRouteDestination{{
+				Destination: &networking.Destination{Host: "thrift.default.svc.cluster.local"},
+			}},
+			Retries: &networking.HTTPRetry{Attempts: 3},
+		}},
+	}
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		valid       bool
+	}{
+		{
+			name:  "http routes",
+			valid: true,
+		},
+		{
+			name:        "thrift routes",
+			annotations: map[string]string{ThriftRoutesAnnotation: "true"},
+			valid:       false,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ValidateVirtualService(config.Config{
+				Meta: config.Meta{Name: "thrift", Namespace: "default", Annotations: tc.annotations},
+				Spec: virtualService,
+			})
+			if valid := err == nil; valid != tc.valid {
+				t.Fatalf("expected valid=%v, got error %v", tc.valid, err)
+			}
+		})
+	}
+}
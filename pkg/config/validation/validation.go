@@ -1677,6 +1677,9 @@ var ValidateVirtualService = registerValidateFunc("ValidateVirtualService",
 				continue
 			}
 			errs = appendValidation(errs, validateHTTPRoute(httpRoute, isDelegate))
+			if HasThriftRoutes(cfg.Meta) {
+				errs = appendValidation(errs, ValidateThriftRoute(httpRoute))
+			}
 		}
 		for _, tlsRoute := range virtualService.Tls {
 			errs = appendValidation(errs, validateTLSRoute(tlsRoute, virtualService))
@@ -15,6 +15,7 @@
 package istioagent
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net"
@@ -29,14 +30,17 @@ import (
 	"istio.io/istio/pilot/pkg/dns"
 	"istio.io/istio/pilot/pkg/security/model"
 	"istio.io/istio/pkg/config/constants"
+	"istio.io/istio/pkg/istio-agent/grpcxds"
 	"istio.io/istio/pkg/kube"
 	"istio.io/istio/pkg/security"
 	"istio.io/istio/security/pkg/nodeagent/cache"
 	citadel "istio.io/istio/security/pkg/nodeagent/caclient/providers/citadel"
 	gca "istio.io/istio/security/pkg/nodeagent/caclient/providers/google"
+	rest "istio.io/istio/security/pkg/nodeagent/caclient/providers/rest"
 	"istio.io/istio/security/pkg/nodeagent/plugin"
 	"istio.io/istio/security/pkg/nodeagent/sds"
 	"istio.io/istio/security/pkg/nodeagent/secretfetcher"
+	nodeagentutil "istio.io/istio/security/pkg/nodeagent/util"
 	"istio.io/pkg/log"
 )
 
@@ -78,6 +82,9 @@ const (
 	MetadataClientCertKey   = "ISTIO_META_TLS_CLIENT_KEY"
 	MetadataClientCertChain = "ISTIO_META_TLS_CLIENT_CERT_CHAIN"
 	MetadataClientRootCert  = "ISTIO_META_TLS_CLIENT_ROOT_CERT"
+
+	// RESTCAProviderName is the CA_PROVIDER of external CAs signing the CSRs over HTTP.
+	RESTCAProviderName = "RestCA"
 )
 
 // Agent contains the configuration of the agent, based on the injected
@@ -150,6 +157,17 @@ type AgentConfig struct {
 
 	// Extra headers to add to the XDS connection.
 	XDSHeaders map[string]string
+
+	// WasmHealthCheckInterval is the interval at which Envoy's WebAssembly failure
+	// counters are checked and increases are reported to istiod. Zero disables the check.
+	WasmHealthCheckInterval time.Duration
+
+	// GRPCBootstrapPath if set will generate a file compatible with GRPC_XDS_BOOTSTRAP, pointing
+	// proxyless gRPC applications to the XDS proxy of the agent.
+	GRPCBootstrapPath string
+
+	// ServiceNode is the node ID of the proxy, also used by gRPC applications.
+	ServiceNode string
 }
 
 // NewAgent wraps the logic for a local SDS. It will check if the JWT token required for local SDS is
@@ -196,6 +214,10 @@ func NewAgent(proxyConfig *mesh.ProxyConfig, cfg *AgentConfig,
 		// if not set, we will fallback to the discovery address
 		sa.secOpts.CAEndpoint = discAddr
 	}
+	// The CA publishes its certificate revocation list next to the root cert.
+	if sa.secOpts.CRLFilePath == "" {
+		sa.secOpts.CRLFilePath = path.Join(CitadelCACertPath, constants.CACRLNamespaceConfigMapDataName)
+	}
 	// Next to the envoy config, writeable dir (mounted as mem)
 	if sa.secOpts.WorkloadUDSPath == "" {
 		sa.secOpts.WorkloadUDSPath = LocalSDS
@@ -269,9 +291,50 @@ func (sa *Agent) Start(isSidecar bool, podNamespace string) (*sds.Server, error)
 			return nil, fmt.Errorf("failed to start xds proxy: %v", err)
 		}
 	}
+	if sa.cfg.GRPCBootstrapPath != "" {
+		if err := sa.generateGRPCBootstrap(podNamespace); err != nil {
+			return nil, fmt.Errorf("failed generating gRPC XDS bootstrap: %v", err)
+		}
+	}
 	return server, nil
 }
 
+// generateGRPCBootstrap writes the bootstrap of proxyless gRPC applications, which connect to the XDS proxy.
+// If the certificates are output to a directory, they are generated first so that the file watcher
+// certificate provider of the bootstrap can read them; the secret cache keeps them up to date.
+func (sa *Agent) generateGRPCBootstrap(podNamespace string) error {
+	if !sa.cfg.ProxyXDSViaAgent {
+		return fmt.Errorf("the XDS proxy of the agent is required")
+	}
+	if sa.secOpts.OutputKeyCertToDir != "" {
+		token := ""
+		if sa.secOpts.JWTPath != "" {
+			tok, err := ioutil.ReadFile(sa.secOpts.JWTPath)
+			if err != nil {
+				return fmt.Errorf("failed to read credential token from %s: %v", sa.secOpts.JWTPath, err)
+			}
+			token = string(tok)
+		}
+		for _, resourceName := range []string{model.SDSDefaultResourceName, model.SDSRootResourceName} {
+			secret, err := sa.WorkloadSecrets.GenerateSecret(context.Background(), "grpc-bootstrap", resourceName, token)
+			if err != nil {
+				return fmt.Errorf("failed to generate secret %s: %v", resourceName, err)
+			}
+			if err := nodeagentutil.OutputKeyCertToDir(sa.secOpts.OutputKeyCertToDir, secret.PrivateKey,
+				secret.CertificateChain, secret.RootCert); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := grpcxds.GenerateBootstrapFile(grpcxds.GenerateBootstrapOptions{
+		NodeID:     sa.cfg.ServiceNode,
+		Metadata:   map[string]string{"NAMESPACE": podNamespace},
+		XdsUdsPath: xdsUdsPath,
+		CertDir:    sa.secOpts.OutputKeyCertToDir,
+	}, sa.cfg.GRPCBootstrapPath)
+	return err
+}
+
 func (sa *Agent) initLocalDNSServer(isSidecar bool) (err error) {
 	// we dont need dns server on gateways
 	if sa.cfg.DNSCapture && sa.cfg.ProxyXDSViaAgent && isSidecar {
@@ -398,6 +461,9 @@ func (sa *Agent) newWorkloadSecretCache() (workloadSecretCache *cache.SecretCach
 		// used.
 		caClient, err = gca.NewGoogleCAClient(sa.secOpts.CAEndpoint, true)
 		pluginNames = []string{plugin.GoogleTokenExchange}
+	} else if sa.secOpts.CAProviderName == RESTCAProviderName {
+		// An external CA, signing the CSRs over HTTP.
+		caClient, err = sa.newRESTCAClient()
 	} else {
 		var rootCert []byte
 		// Special case: if Istiod runs on a secure network, on the default port, don't use TLS
@@ -442,6 +508,30 @@ func (sa *Agent) newWorkloadSecretCache() (workloadSecretCache *cache.SecretCach
 	return
 }
 
+// newRESTCAClient creates the client of an external CA with a REST API. The CA server is verified with
+// the explicitly configured CA root, or with the system roots.
+func (sa *Agent) newRESTCAClient() (security.Client, error) {
+	opts := rest.Options{
+		Endpoint:       sa.secOpts.CAEndpoint,
+		Auth:           sa.secOpts.RESTCAAuth,
+		TokenFile:      sa.secOpts.RESTCATokenFile,
+		ClientCertFile: sa.secOpts.RESTCAClientCertFile,
+		ClientKeyFile:  sa.secOpts.RESTCAClientKeyFile,
+	}
+	var err error
+	if sa.cfg.CARootCerts != "" {
+		if opts.TLSRootCert, err = ioutil.ReadFile(sa.cfg.CARootCerts); err != nil {
+			return nil, fmt.Errorf("failed to read the CA root %s: %v", sa.cfg.CARootCerts, err)
+		}
+	}
+	if sa.secOpts.RESTCARootCertFile != "" {
+		if opts.RootCert, err = ioutil.ReadFile(sa.secOpts.RESTCARootCertFile); err != nil {
+			return nil, fmt.Errorf("failed to read the root certificate %s: %v", sa.secOpts.RESTCARootCertFile, err)
+		}
+	}
+	return rest.NewRESTClient(opts)
+}
+
 // TODO: use existing 'sidecar/router' config to enable loading Secrets
 func (sa *Agent) newSecretCache(namespace string) (gatewaySecretCache *cache.SecretCache) {
 	gSecretFetcher := &secretfetcher.SecretFetcher{}
@@ -0,0 +1,164 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcxds
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// ServerListenerNamePrefix is the prefix of the names of the listeners requested by gRPC servers.
+	// It is followed by the address the server listens on.
+	ServerListenerNamePrefix = "xds.istio.io/grpc/lds/inbound/"
+	// ServerListenerNameTemplate is the template of the names of the listeners requested by gRPC servers.
+	ServerListenerNameTemplate = ServerListenerNamePrefix + "%s"
+
+	// FileWatcherCertProviderName is the name of the certificate provider instance of the bootstrap,
+	// which reads the certificates output by the agent.
+	FileWatcherCertProviderName = "default"
+	// fileWatcherPluginName is the name of the gRPC certificate provider plugin that watches files.
+	fileWatcherPluginName = "file_watcher"
+
+	// The certificate files, as output by the agent.
+	certChainFile = "cert-chain.pem"
+	keyFile       = "key.pem"
+	rootCertFile  = "root-cert.pem"
+
+	defaultRefreshInterval = 15 * time.Minute
+)
+
+// Bootstrap is the bootstrap of gRPC applications using XDS, read from the file set in GRPC_XDS_BOOTSTRAP.
+type Bootstrap struct {
+	XDSServers                 []XdsServer                    `json:"xds_servers,omitempty"`
+	Node                       Node                           `json:"node,omitempty"`
+	CertProviders              map[string]CertificateProvider `json:"certificate_providers,omitempty"`
+	ServerListenerNameTemplate string                         `json:"server_listener_resource_name_template,omitempty"`
+}
+
+// XdsServer is an XDS server gRPC applications connect to.
+type XdsServer struct {
+	ServerURI      string         `json:"server_uri,omitempty"`
+	ChannelCreds   []ChannelCreds `json:"channel_creds,omitempty"`
+	ServerFeatures []string       `json:"server_features,omitempty"`
+}
+
+// ChannelCreds are the credentials used to connect to an XDS server.
+type ChannelCreds struct {
+	Type string `json:"type,omitempty"`
+}
+
+// Node identifies the gRPC application to the XDS server.
+type Node struct {
+	ID       string            `json:"id,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// CertificateProvider is an instance of a certificate provider plugin, referred to by the XDS security
+// configuration.
+type CertificateProvider struct {
+	PluginName string      `json:"plugin_name,omitempty"`
+	Config     interface{} `json:"config,omitempty"`
+}
+
+// FileWatcherCertProviderConfig is the configuration of the file_watcher certificate provider plugin.
+type FileWatcherCertProviderConfig struct {
+	CertificateFile   string `json:"certificate_file,omitempty"`
+	PrivateKeyFile    string `json:"private_key_file,omitempty"`
+	CACertificateFile string `json:"ca_certificate_file,omitempty"`
+	RefreshInterval   string `json:"refresh_interval,omitempty"`
+}
+
+// GenerateBootstrapOptions are the options of the gRPC bootstrap.
+type GenerateBootstrapOptions struct {
+	// NodeID is the ID of the node, which identifies the application.
+	NodeID string
+	// Metadata is the metadata of the node. The generator is always set to gRPC.
+	Metadata map[string]string
+	// XdsUdsPath is the path of the socket of the XDS proxy of the agent.
+	XdsUdsPath string
+	// CertDir is the directory of the certificates output by the agent. If empty, no certificate
+	// provider is configured and the applications can't use mTLS.
+	CertDir string
+}
+
+// GenerateBootstrap generates the bootstrap of gRPC applications.
+func GenerateBootstrap(opts GenerateBootstrapOptions) (*Bootstrap, error) {
+	xdsUdsPath, err := filepath.Abs(opts.XdsUdsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the path of the XDS socket: %v", err)
+	}
+	metadata := map[string]string{}
+	for k, v := range opts.Metadata {
+		metadata[k] = v
+	}
+	metadata["GENERATOR"] = "grpc"
+
+	bootstrap := &Bootstrap{
+		XDSServers: []XdsServer{{
+			ServerURI: "unix://" + xdsUdsPath,
+			// The connection to the agent is local
+			ChannelCreds:   []ChannelCreds{{Type: "insecure"}},
+			ServerFeatures: []string{"xds_v3"},
+		}},
+		Node: Node{
+			ID:       opts.NodeID,
+			Metadata: metadata,
+		},
+		ServerListenerNameTemplate: ServerListenerNameTemplate,
+	}
+	if opts.CertDir != "" {
+		certDir, err := filepath.Abs(opts.CertDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the path of the certificates: %v", err)
+		}
+		bootstrap.CertProviders = map[string]CertificateProvider{
+			FileWatcherCertProviderName: {
+				PluginName: fileWatcherPluginName,
+				Config: FileWatcherCertProviderConfig{
+					CertificateFile:   path.Join(certDir, certChainFile),
+					PrivateKeyFile:    path.Join(certDir, keyFile),
+					CACertificateFile: path.Join(certDir, rootCertFile),
+					RefreshInterval:   fmt.Sprintf("%ds", int(defaultRefreshInterval.Seconds())),
+				},
+			},
+		}
+	}
+	return bootstrap, nil
+}
+
+// GenerateBootstrapFile generates the bootstrap of gRPC applications, and writes it to a file.
+func GenerateBootstrapFile(opts GenerateBootstrapOptions, file string) (*Bootstrap, error) {
+	bootstrap, err := GenerateBootstrap(opts)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(bootstrap, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(file, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write gRPC bootstrap: %v", err)
+	}
+	return bootstrap, nil
+}
@@ -0,0 +1,91 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcxds
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerateBootstrap(t *testing.T) {
+	cases := []struct {
+		name         string
+		certDir      string
+		certProvider bool
+	}{
+		{name: "plaintext"},
+		{name: "mtls", certDir: "./etc/certs", certProvider: true},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "grpcxds")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			file := filepath.Join(dir, "bootstrap.json")
+			_, err = GenerateBootstrapFile(GenerateBootstrapOptions{
+				NodeID:     "sidecar~10.0.0.1~pod.ns~ns.svc.cluster.local",
+				Metadata:   map[string]string{"NAMESPACE": "ns"},
+				XdsUdsPath: "./etc/istio/proxy/XDS",
+				CertDir:    tt.certDir,
+			}, file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			bootstrap := &Bootstrap{}
+			if err := json.Unmarshal(data, bootstrap); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(bootstrap.XDSServers) != 1 {
+				t.Fatalf("expected 1 XDS server, got %v", bootstrap.XDSServers)
+			}
+			uri := bootstrap.XDSServers[0].ServerURI
+			if !strings.HasPrefix(uri, "unix:///") || !strings.HasSuffix(uri, "/etc/istio/proxy/XDS") {
+				t.Errorf("expected an absolute unix socket URI, got %s", uri)
+			}
+			if bootstrap.Node.Metadata["GENERATOR"] != "grpc" || bootstrap.Node.Metadata["NAMESPACE"] != "ns" {
+				t.Errorf("unexpected node metadata %v", bootstrap.Node.Metadata)
+			}
+			if bootstrap.ServerListenerNameTemplate != ServerListenerNameTemplate {
+				t.Errorf("unexpected server listener name template %s", bootstrap.ServerListenerNameTemplate)
+			}
+
+			provider, f := bootstrap.CertProviders[FileWatcherCertProviderName]
+			if f != tt.certProvider {
+				t.Fatalf("expected certificate provider: %v, got %v", tt.certProvider, bootstrap.CertProviders)
+			}
+			if !tt.certProvider {
+				return
+			}
+			if provider.PluginName != fileWatcherPluginName {
+				t.Errorf("unexpected plugin %s", provider.PluginName)
+			}
+			config := provider.Config.(map[string]interface{})
+			if cert := config["certificate_file"].(string); !filepath.IsAbs(cert) || filepath.Base(cert) != certChainFile {
+				t.Errorf("unexpected certificate file %s", cert)
+			}
+		})
+	}
+}
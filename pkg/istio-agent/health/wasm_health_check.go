@@ -0,0 +1,117 @@
+// Copyright Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package health
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"istio.io/pkg/log"
+)
+
+const (
+	// wasmFailureStatsRegex matches the Envoy counters that are incremented
+	// when a WebAssembly module fails to be fetched or loaded, or crashes
+	wasmFailureStatsRegex = "^wasm\\..*(fetch_failures|failed|crashed)$"
+
+	wasmStatsTimeout = 3 * time.Second
+)
+
+// WasmHealthChecker watches Envoy's WebAssembly failure counters
+type WasmHealthChecker struct {
+	statsURL string
+	interval time.Duration
+	client   *http.Client
+	// last holds the value of each failure counter at the last check
+	last map[string]uint64
+}
+
+// NewWasmHealthChecker creates a WasmHealthChecker that polls the stats of the
+// Envoy admin interface listening on adminPort every interval
+func NewWasmHealthChecker(adminPort int32, interval time.Duration) *WasmHealthChecker {
+	return &WasmHealthChecker{
+		statsURL: fmt.Sprintf("http://localhost:%d/stats?usedonly&filter=%s", adminPort, wasmFailureStatsRegex),
+		interval: interval,
+		client:   &http.Client{Timeout: wasmStatsTimeout},
+		last:     map[string]uint64{},
+	}
+}
+
+// PerformWasmHealthCheck calls callback with the number of new failures per
+// counter whenever Envoy's WebAssembly failure counters increase
+func (w *WasmHealthChecker) PerformWasmHealthCheck(callback func(failures map[string]uint64), quit chan struct{}) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-quit:
+			return
+		case <-ticker.C:
+			failures, err := w.check()
+			if err != nil {
+				log.Debugf("failed to check WebAssembly health: %v", err)
+				continue
+			}
+			if len(failures) > 0 {
+				callback(failures)
+			}
+		}
+	}
+}
+
+// check returns the number of failures since the last check of every counter
+// that increased. The counter names allow istiod to attribute the failures to
+// an extension.
+func (w *WasmHealthChecker) check() (map[string]uint64, error) {
+	resp, err := w.client.Get(w.statsURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	failures := map[string]uint64{}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		value, err := strconv.ParseUint(strings.TrimSpace(parts[1]), 10, 64)
+		if err != nil {
+			// histograms and text readouts
+			continue
+		}
+		name := strings.TrimSpace(parts[0])
+		last := w.last[name]
+		if value < last {
+			// Envoy restarted and its counters were reset
+			last = 0
+		}
+		if value > last {
+			failures[name] = value - last
+		}
+		w.last[name] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return failures, nil
+}
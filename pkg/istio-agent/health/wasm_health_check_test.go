@@ -0,0 +1,88 @@
+// Copyright Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package health
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWasmHealthCheck(t *testing.T) {
+	testCases := []struct {
+		name             string
+		stats            []string
+		expectedFailures []map[string]uint64
+	}{
+		{
+			name: "no failures",
+			stats: []string{
+				"",
+				"wasm.remote_load_fetch_failures: 0\n",
+			},
+			expectedFailures: []map[string]uint64{{}, {}},
+		},
+		{
+			name: "failures increase",
+			stats: []string{
+				"wasm.remote_load_fetch_failures: 1\n",
+				"wasm.remote_load_fetch_failures: 1\nwasm.envoy.wasm.runtime.v8.crashed: 2\n",
+				"wasm.remote_load_fetch_failures: 4\nwasm.envoy.wasm.runtime.v8.crashed: 2\n",
+			},
+			expectedFailures: []map[string]uint64{
+				{"wasm.remote_load_fetch_failures": 1},
+				{"wasm.envoy.wasm.runtime.v8.crashed": 2},
+				{"wasm.remote_load_fetch_failures": 3},
+			},
+		},
+		{
+			name: "envoy restarted",
+			stats: []string{
+				"wasm.remote_load_fetch_failures: 5\n",
+				"wasm.remote_load_fetch_failures: 2\n",
+			},
+			expectedFailures: []map[string]uint64{
+				{"wasm.remote_load_fetch_failures": 5},
+				{"wasm.remote_load_fetch_failures": 2},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			request := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, tc.stats[request])
+				request++
+			}))
+			defer server.Close()
+
+			checker := NewWasmHealthChecker(0, time.Second)
+			checker.statsURL = server.URL
+			for i, expected := range tc.expectedFailures {
+				failures, err := checker.check()
+				if err != nil {
+					t.Fatalf("Expected no error but got %s", err)
+				}
+				if !reflect.DeepEqual(failures, expected) {
+					t.Errorf("check %d: expected %v failures but got %v", i, expected, failures)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wasm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"istio.io/pkg/log"
+)
+
+var wasmLog = log.RegisterScope("wasm", "WebAssembly module cache in Istio Agent", 0)
+
+// cacheEntry is a module in the cache directory
+type cacheEntry struct {
+	path     string
+	lastUsed time.Time
+}
+
+// pendingFetch is a download in progress. Callers that request the same
+// module wait for it instead of downloading the module again.
+type pendingFetch struct {
+	done chan struct{}
+	path string
+	err  error
+}
+
+// Cache downloads WebAssembly modules and keeps them in a local directory,
+// keyed by their SHA256 checksum, so that Envoy can load them from a file.
+// Modules that have not been used for the expiry are purged, and modules
+// larger than maxModuleSize are rejected. Downloads run outside of the cache
+// lock, so a slow module does not delay the others.
+type Cache struct {
+	directory     string
+	expiry        time.Duration
+	maxModuleSize int64
+	client        *http.Client
+
+	modules map[string]*cacheEntry
+	pending map[string]*pendingFetch
+	now     func() time.Time
+
+	mux sync.Mutex
+}
+
+// NewCache creates a Cache that stores modules of up to maxModuleSize bytes in
+// the given directory
+func NewCache(directory string, expiry time.Duration, maxModuleSize int64) *Cache {
+	if absDir, err := filepath.Abs(directory); err == nil {
+		directory = absDir
+	}
+	return &Cache{
+		directory:     directory,
+		expiry:        expiry,
+		maxModuleSize: maxModuleSize,
+		client:        &http.Client{},
+		modules:       map[string]*cacheEntry{},
+		pending:       map[string]*pendingFetch{},
+		now:           time.Now,
+	}
+}
+
+// Get returns the path of the local copy of the module at the given URL,
+// downloading it first if it is not cached. If checksum is set, the module
+// must match it. Concurrent calls for the same module share one download.
+func (c *Cache) Get(url, checksum string, timeout time.Duration) (string, error) {
+	key := checksum
+	if key == "" {
+		key = url
+	}
+
+	c.mux.Lock()
+	if entry, ok := c.modules[key]; ok {
+		if _, err := os.Stat(entry.path); err == nil {
+			entry.lastUsed = c.now()
+			c.mux.Unlock()
+			return entry.path, nil
+		}
+		delete(c.modules, key)
+	}
+	if p, ok := c.pending[key]; ok {
+		c.mux.Unlock()
+		<-p.done
+		return p.path, p.err
+	}
+	p := &pendingFetch{done: make(chan struct{})}
+	c.pending[key] = p
+	c.mux.Unlock()
+
+	p.path, p.err = c.download(url, checksum, timeout)
+
+	c.mux.Lock()
+	delete(c.pending, key)
+	if p.err == nil {
+		c.modules[key] = &cacheEntry{
+			path:     p.path,
+			lastUsed: c.now(),
+		}
+	}
+	c.mux.Unlock()
+	close(p.done)
+	return p.path, p.err
+}
+
+// download fetches the module and writes it to the cache directory
+func (c *Cache) download(url, checksum string, timeout time.Duration) (string, error) {
+	module, err := c.fetch(url, timeout)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(module)
+	actual := hex.EncodeToString(sum[:])
+	if checksum != "" && actual != checksum {
+		return "", fmt.Errorf("module downloaded from %s has checksum %s, expected %s", url, actual, checksum)
+	}
+
+	if err := os.MkdirAll(c.directory, 0755); err != nil {
+		return "", fmt.Errorf("failed to create cache directory: %v", err)
+	}
+	path := filepath.Join(c.directory, actual+".wasm")
+	// write to a temporary file first so that Envoy never reads a partial module
+	tmpFile, err := ioutil.TempFile(c.directory, actual+".*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("failed to write module: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	_, err = tmpFile.Write(module)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to write module: %v", err)
+	}
+	if err := os.Rename(tmpFile.Name(), path); err != nil {
+		return "", fmt.Errorf("failed to write module: %v", err)
+	}
+
+	wasmLog.Infof("Cached module %s from %s", actual, url)
+	return path, nil
+}
+
+// Purge deletes the modules that have not been used for longer than the expiry
+func (c *Cache) Purge() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	now := c.now()
+	for key, entry := range c.modules {
+		if now.Sub(entry.lastUsed) < c.expiry {
+			continue
+		}
+		wasmLog.Infof("Deleting expired module %s", entry.path)
+		if err := os.Remove(entry.path); err != nil && !os.IsNotExist(err) {
+			wasmLog.Errorf("Failed to delete module %s: %v", entry.path, err)
+			continue
+		}
+		delete(c.modules, key)
+	}
+}
+
+// Start periodically purges expired modules until stopChan is closed
+func (c *Cache) Start(interval time.Duration, stopChan <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.Purge()
+			case <-stopChan:
+				return
+			}
+		}
+	}()
+}
+
+func (c *Cache) fetch(url string, timeout time.Duration) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid module URL %s: %v", url, err)
+	}
+	client := *c.client
+	client.Timeout = timeout
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download module from %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download module from %s: status %d", url, resp.StatusCode)
+	}
+	// read one byte past the maximum to tell a module of the maximum size from a larger one
+	module, err := ioutil.ReadAll(io.LimitReader(resp.Body, c.maxModuleSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download module from %s: %v", url, err)
+	}
+	if int64(len(module)) > c.maxModuleSize {
+		return nil, fmt.Errorf("failed to download module from %s: module exceeds the maximum size of %d bytes", url, c.maxModuleSize)
+	}
+	return module, nil
+}
@@ -0,0 +1,229 @@
+// Copyright Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wasm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testModule = "\x00asm\x01\x00\x00\x00"
+
+var testModuleChecksum = func() string {
+	sum := sha256.Sum256([]byte(testModule))
+	return hex.EncodeToString(sum[:])
+}()
+
+// newModuleServer serves the test module and counts the requests it receives
+func newModuleServer(requests *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		if r.URL.Path != "/module.wasm" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, testModule)
+	}))
+}
+
+func newTestCache(t *testing.T) (*Cache, func()) {
+	tmpDir, err := ioutil.TempDir("", "wasmcachetest")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	return NewCache(tmpDir, time.Hour, 1<<20), func() { os.RemoveAll(tmpDir) }
+}
+
+func TestCacheGet(t *testing.T) {
+	testCases := []struct {
+		name             string
+		path             string
+		checksum         string
+		maxModuleSize    int64
+		gets             int
+		expectedError    bool
+		expectedRequests int
+	}{
+		{
+			name:             "module_is_downloaded_once",
+			path:             "/module.wasm",
+			checksum:         testModuleChecksum,
+			gets:             3,
+			expectedRequests: 1,
+		},
+		{
+			name:             "module_without_checksum_is_cached_by_url",
+			path:             "/module.wasm",
+			gets:             2,
+			expectedRequests: 1,
+		},
+		{
+			name:             "checksum_mismatch",
+			path:             "/module.wasm",
+			checksum:         "0000",
+			gets:             2,
+			expectedError:    true,
+			expectedRequests: 2,
+		},
+		{
+			name:             "module_exceeds_max_size",
+			path:             "/module.wasm",
+			maxModuleSize:    int64(len(testModule) - 1),
+			gets:             1,
+			expectedError:    true,
+			expectedRequests: 1,
+		},
+		{
+			name:             "module_of_max_size",
+			path:             "/module.wasm",
+			maxModuleSize:    int64(len(testModule)),
+			gets:             1,
+			expectedRequests: 1,
+		},
+		{
+			name:             "module_not_found",
+			path:             "/missing.wasm",
+			gets:             1,
+			expectedError:    true,
+			expectedRequests: 1,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			requests := 0
+			server := newModuleServer(&requests)
+			defer server.Close()
+			cache, cleanup := newTestCache(t)
+			defer cleanup()
+			if tc.maxModuleSize != 0 {
+				cache.maxModuleSize = tc.maxModuleSize
+			}
+
+			for i := 0; i < tc.gets; i++ {
+				path, err := cache.Get(server.URL+tc.path, tc.checksum, time.Second)
+				if tc.expectedError {
+					if err == nil {
+						t.Fatalf("Expected error but got nil")
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("Expected no error but got %s", err)
+				}
+				module, err := ioutil.ReadFile(path)
+				if err != nil {
+					t.Fatalf("failed to read cached module: %s", err)
+				}
+				if string(module) != testModule {
+					t.Errorf("unexpected module content %q", module)
+				}
+			}
+			if requests != tc.expectedRequests {
+				t.Errorf("expected %d requests but got %d", tc.expectedRequests, requests)
+			}
+		})
+	}
+}
+
+func TestCachePurge(t *testing.T) {
+	requests := 0
+	server := newModuleServer(&requests)
+	defer server.Close()
+	cache, cleanup := newTestCache(t)
+	defer cleanup()
+	clock := time.Now()
+	cache.now = func() time.Time { return clock }
+
+	path, err := cache.Get(server.URL+"/module.wasm", testModuleChecksum, time.Second)
+	if err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+
+	clock = clock.Add(30 * time.Minute)
+	cache.Purge()
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("expected module to be kept before it expired: %s", err)
+	}
+
+	clock = clock.Add(time.Hour)
+	cache.Purge()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected expired module to be deleted")
+	}
+
+	if _, err := cache.Get(server.URL+"/module.wasm", testModuleChecksum, time.Second); err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+	if requests != 2 {
+		t.Errorf("expected purged module to be downloaded again")
+	}
+}
+
+func TestCacheGetDoesNotBlockOnDownloads(t *testing.T) {
+	var slowRequests int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	requests := 0
+	moduleServer := newModuleServer(&requests)
+	defer moduleServer.Close()
+	slowServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&slowRequests, 1) == 1 {
+			close(started)
+		}
+		<-release
+		fmt.Fprint(w, testModule)
+	}))
+	defer slowServer.Close()
+	cache, cleanup := newTestCache(t)
+	defer cleanup()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := cache.Get(slowServer.URL+"/slow.wasm", "", 10*time.Second)
+			errs <- err
+		}()
+	}
+	<-started
+
+	// other modules can be retrieved while the slow download is in progress
+	if _, err := cache.Get(moduleServer.URL+"/module.wasm", testModuleChecksum, time.Second); err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Expected no error but got %s", err)
+		}
+	}
+	if n := atomic.LoadInt32(&slowRequests); n != 1 {
+		t.Errorf("expected concurrent gets to share one download but got %d requests", n)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wasm
+
+import (
+	"fmt"
+	"time"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	wasmfilter "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/wasm/v3"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/any"
+)
+
+const defaultFetchTimeout = 30 * time.Second
+
+// ConvertResources replaces the remote code of the WebAssembly filters in the
+// given ECDS resources with the path of their local copy in the cache. Envoy
+// then loads the modules from disk instead of downloading them itself. If any
+// module cannot be retrieved, an error is returned and the resources must not
+// be handed to Envoy.
+func ConvertResources(resources []*any.Any, cache *Cache) error {
+	for i, resource := range resources {
+		config := &core.TypedExtensionConfig{}
+		if err := ptypes.UnmarshalAny(resource, config); err != nil {
+			return fmt.Errorf("failed to unmarshal extension config: %v", err)
+		}
+		wasmConfig := &wasmfilter.Wasm{}
+		if !ptypes.Is(config.GetTypedConfig(), wasmConfig) {
+			continue
+		}
+		if err := ptypes.UnmarshalAny(config.GetTypedConfig(), wasmConfig); err != nil {
+			return fmt.Errorf("failed to unmarshal WebAssembly filter %s: %v", config.Name, err)
+		}
+		vm := wasmConfig.GetConfig().GetVmConfig()
+		remote := vm.GetCode().GetRemote()
+		if remote == nil {
+			continue
+		}
+		path, err := fetchWithRetries(cache, remote)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve module of WebAssembly filter %s: %v", config.Name, err)
+		}
+		vm.Code = &core.AsyncDataSource{
+			Specifier: &core.AsyncDataSource_Local{
+				Local: &core.DataSource{
+					Specifier: &core.DataSource_Filename{
+						Filename: path,
+					},
+				},
+			},
+		}
+		if config.TypedConfig, err = ptypes.MarshalAny(wasmConfig); err != nil {
+			return err
+		}
+		if resources[i], err = ptypes.MarshalAny(config); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchWithRetries retrieves a remote module, honoring the timeout and retry
+// policy of the data source
+func fetchWithRetries(cache *Cache, remote *core.RemoteDataSource) (string, error) {
+	timeout := defaultFetchTimeout
+	if remote.GetHttpUri().GetTimeout() != nil {
+		if d, err := ptypes.Duration(remote.GetHttpUri().GetTimeout()); err == nil && d > 0 {
+			timeout = d
+		}
+	}
+	attempts := 1 + int(remote.GetRetryPolicy().GetNumRetries().GetValue())
+	var err error
+	for i := 0; i < attempts; i++ {
+		var path string
+		if path, err = cache.Get(remote.GetHttpUri().GetUri(), remote.GetSha256(), timeout); err == nil {
+			return path, nil
+		}
+		wasmLog.Warnf("Attempt %d of %d to retrieve module failed: %v", i+1, attempts, err)
+	}
+	return "", err
+}
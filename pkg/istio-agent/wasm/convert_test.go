@@ -0,0 +1,101 @@
+// Copyright Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wasm
+
+import (
+	"testing"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	wasmfilter "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/wasm/v3"
+	wasm "github.com/envoyproxy/go-control-plane/envoy/extensions/wasm/v3"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/any"
+	"github.com/golang/protobuf/ptypes/wrappers"
+)
+
+func remoteExtensionConfig(t *testing.T, name, url, checksum string) *any.Any {
+	filter, err := ptypes.MarshalAny(&wasmfilter.Wasm{
+		Config: &wasm.PluginConfig{
+			Name: name,
+			Vm: &wasm.PluginConfig_VmConfig{
+				VmConfig: &wasm.VmConfig{
+					Code: &core.AsyncDataSource{
+						Specifier: &core.AsyncDataSource_Remote{
+							Remote: &core.RemoteDataSource{
+								HttpUri: &core.HttpUri{Uri: url},
+								Sha256:  checksum,
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal filter: %s", err)
+	}
+	config, err := ptypes.MarshalAny(&core.TypedExtensionConfig{Name: name, TypedConfig: filter})
+	if err != nil {
+		t.Fatalf("failed to marshal extension config: %s", err)
+	}
+	return config
+}
+
+func TestConvertResources(t *testing.T) {
+	requests := 0
+	server := newModuleServer(&requests)
+	defer server.Close()
+	cache, cleanup := newTestCache(t)
+	defer cleanup()
+
+	otherConfig, err := ptypes.MarshalAny(&wrappers.StringValue{Value: "not a WebAssembly filter"})
+	if err != nil {
+		t.Fatalf("failed to marshal config: %s", err)
+	}
+	otherFilter, err := ptypes.MarshalAny(&core.TypedExtensionConfig{Name: "other", TypedConfig: otherConfig})
+	if err != nil {
+		t.Fatalf("failed to marshal extension config: %s", err)
+	}
+
+	resources := []*any.Any{
+		remoteExtensionConfig(t, "istio-system.header-append", server.URL+"/module.wasm", testModuleChecksum),
+		otherFilter,
+	}
+	if err := ConvertResources(resources, cache); err != nil {
+		t.Fatalf("Expected no error but got %s", err)
+	}
+
+	config := &core.TypedExtensionConfig{}
+	if err := ptypes.UnmarshalAny(resources[0], config); err != nil {
+		t.Fatalf("failed to unmarshal extension config: %s", err)
+	}
+	wasmConfig := &wasmfilter.Wasm{}
+	if err := ptypes.UnmarshalAny(config.TypedConfig, wasmConfig); err != nil {
+		t.Fatalf("failed to unmarshal filter: %s", err)
+	}
+	filename := wasmConfig.GetConfig().GetVmConfig().GetCode().GetLocal().GetFilename()
+	expected, _ := cache.Get(server.URL+"/module.wasm", testModuleChecksum, 0)
+	if filename == "" || filename != expected {
+		t.Errorf("expected module to be loaded from %q but got %q", expected, filename)
+	}
+	if resources[1] != otherFilter {
+		t.Errorf("expected other filters to be left unchanged")
+	}
+
+	failing := []*any.Any{remoteExtensionConfig(t, "istio-system.missing", server.URL+"/missing.wasm", "")}
+	if err := ConvertResources(failing, cache); err == nil {
+		t.Fatalf("Expected error but got nil")
+	}
+}
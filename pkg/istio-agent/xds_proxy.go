@@ -18,7 +18,6 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
-	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -49,14 +48,20 @@ import (
 	"istio.io/istio/pkg/config/constants"
 	"istio.io/istio/pkg/istio-agent/health"
 	"istio.io/istio/pkg/istio-agent/metrics"
+	"istio.io/istio/pkg/istio-agent/wasm"
 	"istio.io/istio/pkg/mcp/status"
+	maistramodel "istio.io/istio/pkg/servicemesh/model"
 	"istio.io/istio/pkg/uds"
+	"istio.io/pkg/env"
 	"istio.io/pkg/filewatcher"
 	"istio.io/pkg/log"
 )
 
 var (
 	newFileWatcher = filewatcher.NewWatcher
+
+	wasmModuleMaxSize = env.RegisterIntVar("WASM_MODULE_MAX_SIZE", 256<<20,
+		"The maximum size in bytes of the WebAssembly modules downloaded for the filters delivered over ECDS")
 )
 
 const (
@@ -69,6 +74,11 @@ const (
 
 const (
 	xdsUdsPath = "./etc/istio/proxy/XDS"
+
+	// wasmModuleDir holds the WebAssembly modules of the filters delivered over ECDS
+	wasmModuleDir         = "./etc/istio/proxy/wasm"
+	wasmModuleExpiry      = 24 * time.Hour
+	wasmModulePurgePeriod = time.Hour
 )
 
 // XDS Proxy proxies all XDS requests from envoy to istiod, in addition to allowing
@@ -89,6 +99,7 @@ type XdsProxy struct {
 	localDNSServer       *dns.LocalDNSServer
 	healthChecker        *health.WorkloadHealthChecker
 	fileWatcher          filewatcher.FileWatcher
+	wasmCache            *wasm.Cache
 	agent                *Agent
 
 	// connected stores the active gRPC stream. The proxy will only have 1 connection at a time
@@ -108,6 +119,7 @@ func initXdsProxy(ia *Agent) (*XdsProxy, error) {
 		stopChan:       make(chan struct{}),
 		resetChan:      make(chan struct{}),
 		healthChecker:  health.NewWorkloadHealthChecker(ia.proxyConfig.ReadinessProbe),
+		wasmCache:      wasm.NewCache(wasmModuleDir, wasmModuleExpiry, int64(wasmModuleMaxSize.Get())),
 		agent:          ia,
 	}
 
@@ -131,6 +143,8 @@ func initXdsProxy(ia *Agent) (*XdsProxy, error) {
 		return nil, err
 	}
 
+	proxy.wasmCache.Start(wasmModulePurgePeriod, proxy.stopChan)
+
 	go proxy.healthChecker.PerformApplicationHealthCheck(func(healthEvent *health.ProbeEvent) {
 		var req *discovery.DiscoveryRequest
 		if healthEvent.Healthy {
@@ -146,6 +160,18 @@ func initXdsProxy(ia *Agent) (*XdsProxy, error) {
 		}
 		proxy.SendRequest(req)
 	}, proxy.stopChan)
+
+	if ia.cfg.WasmHealthCheckInterval > 0 {
+		wasmHealthChecker := health.NewWasmHealthChecker(ia.proxyConfig.ProxyAdminPort, ia.cfg.WasmHealthCheckInterval)
+		go wasmHealthChecker.PerformWasmHealthCheck(func(failures map[string]uint64) {
+			req, err := maistramodel.NewWasmHealthRequest(failures)
+			if err != nil {
+				proxyLog.Errorf("failed to create WebAssembly health request: %v", err)
+				return
+			}
+			proxy.SendRequest(req)
+		}, proxy.stopChan)
+	}
 	return proxy, nil
 }
 
@@ -155,9 +181,17 @@ func (p *XdsProxy) SendRequest(req *discovery.DiscoveryRequest) {
 	defer p.connectedMutex.RUnlock()
 	// TODO especially for health check purposes, we need a way to ensure the send succeeded. Otherwise,
 	// requests send to a disconnecting proxy will be permanently dropped.
-	if p.connected != nil {
-		p.connected.requestsChan <- req
+	if p.connected == nil {
+		return
+	}
+	if p.connected.deltaDownstream != nil {
+		p.connected.deltaRequestsChan <- &discovery.DeltaDiscoveryRequest{
+			TypeUrl:     req.TypeUrl,
+			ErrorDetail: req.ErrorDetail,
+		}
+		return
 	}
+	p.connected.requestsChan <- req
 }
 
 func (p *XdsProxy) RegisterStream(c *ProxyConnection) {
@@ -176,6 +210,60 @@ type ProxyConnection struct {
 	responsesChan   chan *discovery.DiscoveryResponse
 	stopChan        chan struct{}
 	downstream      discovery.AggregatedDiscoveryService_StreamAggregatedResourcesServer
+
+	// delta connections use their own channels and downstream stream
+	deltaRequestsChan  chan *discovery.DeltaDiscoveryRequest
+	deltaResponsesChan chan *discovery.DeltaDiscoveryResponse
+	deltaDownstream    discovery.AggregatedDiscoveryService_DeltaAggregatedResourcesServer
+}
+
+// taskQueue runs tasks one at a time, in the order they were pushed, on its own
+// goroutine. Pushing a task never blocks.
+type taskQueue struct {
+	mu     sync.Mutex
+	tasks  []func()
+	notify chan struct{}
+}
+
+func newTaskQueue() *taskQueue {
+	return &taskQueue{notify: make(chan struct{}, 1)}
+}
+
+func (q *taskQueue) push(task func()) {
+	q.mu.Lock()
+	q.tasks = append(q.tasks, task)
+	q.mu.Unlock()
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// run executes the queued tasks until stop is closed
+func (q *taskQueue) run(stop <-chan struct{}) {
+	for {
+		select {
+		case <-q.notify:
+		case <-stop:
+			return
+		}
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			q.mu.Lock()
+			if len(q.tasks) == 0 {
+				q.mu.Unlock()
+				break
+			}
+			task := q.tasks[0]
+			q.tasks = q.tasks[1:]
+			q.mu.Unlock()
+			task()
+		}
+	}
 }
 
 // Every time envoy makes a fresh connection to the agent, we reestablish a new connection to the upstream xds
@@ -217,25 +305,40 @@ func (p *XdsProxy) StreamAggregatedResources(downstream discovery.AggregatedDisc
 		}
 	}()
 
+	upstreamConn, err := p.dialUpstream()
+	if err != nil {
+		return err
+	}
+	defer upstreamConn.Close()
+
+	xds := discovery.NewAggregatedDiscoveryServiceClient(upstreamConn)
+	// We must propagate upstream termination to Envoy. This ensures that we resume the full XDS sequence on new connection
+	return p.HandleUpstream(p.upstreamContext(), con, xds)
+}
+
+// dialUpstream connects to istiod
+func (p *XdsProxy) dialUpstream() (*grpc.ClientConn, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
 	upstreamConn, err := grpc.DialContext(ctx, p.istiodAddress, p.istiodDialOptions...)
 	if err != nil {
 		proxyLog.Errorf("failed to connect to upstream %s: %v", p.istiodAddress, err)
 		metrics.IstiodConnectionFailures.Increment()
-		return err
+		return nil, err
 	}
-	defer upstreamConn.Close()
+	return upstreamConn, nil
+}
 
-	xds := discovery.NewAggregatedDiscoveryServiceClient(upstreamConn)
-	ctx = metadata.AppendToOutgoingContext(context.Background(), "ClusterID", p.clusterID)
+// upstreamContext returns the context of the streams to istiod, which carries the cluster ID and
+// the configured XDS headers
+func (p *XdsProxy) upstreamContext() context.Context {
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "ClusterID", p.clusterID)
 	if p.agent.cfg.XDSHeaders != nil {
 		for k, v := range p.agent.cfg.XDSHeaders {
 			ctx = metadata.AppendToOutgoingContext(ctx, k, v)
 		}
 	}
-	// We must propagate upstream termination to Envoy. This ensures that we resume the full XDS sequence on new connection
-	return p.HandleUpstream(ctx, con, xds)
+	return ctx
 }
 
 func (p *XdsProxy) HandleUpstream(ctx context.Context, con *ProxyConnection, xds discovery.AggregatedDiscoveryServiceClient) error {
@@ -261,6 +364,14 @@ func (p *XdsProxy) HandleUpstream(ctx context.Context, con *ProxyConnection, xds
 		}
 	}()
 
+	// WebAssembly modules of ECDS responses are retrieved off the receive loop, so
+	// that a slow module download does not hold up the other types
+	done := make(chan struct{})
+	defer close(done)
+	ecdsQueue := newTaskQueue()
+	go ecdsQueue.run(done)
+	ecdsResponses := make(chan *discovery.DiscoveryResponse)
+
 	for {
 		select {
 		case err := <-con.upstreamError:
@@ -319,6 +430,31 @@ func (p *XdsProxy) HandleUpstream(ctx context.Context, con *ProxyConnection, xds
 					TypeUrl:       v3.NameTableType,
 					ResponseNonce: resp.Nonce,
 				}
+			case v3.ExtensionConfigurationType:
+				// intercept. Envoy loads the WebAssembly modules from the local cache
+				ecdsQueue.push(func() {
+					if err := wasm.ConvertResources(resp.Resources, p.wasmCache); err != nil {
+						proxyLog.Errorf("failed to retrieve WebAssembly modules: %v", err)
+						// NACK, so that Envoy keeps its current filter configuration
+						nack := &discovery.DiscoveryRequest{
+							TypeUrl:       v3.ExtensionConfigurationType,
+							ResponseNonce: resp.Nonce,
+							ErrorDetail: &google_rpc.Status{
+								Code:    int32(codes.Unavailable),
+								Message: err.Error(),
+							},
+						}
+						select {
+						case con.requestsChan <- nack:
+						case <-done:
+						}
+						return
+					}
+					select {
+					case ecdsResponses <- resp:
+					case <-done:
+					}
+				})
 			default:
 				// TODO: Validate the known type urls before forwarding them to Envoy.
 				if err := con.downstream.Send(resp); err != nil {
@@ -329,6 +465,11 @@ func (p *XdsProxy) HandleUpstream(ctx context.Context, con *ProxyConnection, xds
 					return err
 				}
 			}
+		case resp := <-ecdsResponses:
+			if err := con.downstream.Send(resp); err != nil {
+				proxyLog.Errorf("downstream send error: %v", err)
+				return err
+			}
 		case <-con.stopChan:
 			_ = upstream.CloseSend()
 			return nil
@@ -336,10 +477,6 @@ func (p *XdsProxy) HandleUpstream(ctx context.Context, con *ProxyConnection, xds
 	}
 }
 
-func (p *XdsProxy) DeltaAggregatedResources(server discovery.AggregatedDiscoveryService_DeltaAggregatedResourcesServer) error {
-	return errors.New("delta XDS is not implemented")
-}
-
 func (p *XdsProxy) close() {
 	close(p.stopChan)
 	if p.downstreamGrpcServer != nil {
@@ -569,11 +706,18 @@ func (p *XdsProxy) getRootCertificate(agent *Agent) (*x509.CertPool, error) {
 // sendUpstreamWithTimeout sends discovery request with default send timeout.
 func sendUpstreamWithTimeout(ctx context.Context, upstream discovery.AggregatedDiscoveryService_StreamAggregatedResourcesClient,
 	request *discovery.DiscoveryRequest) error {
+	return sendWithTimeout(ctx, func() error {
+		return upstream.Send(request)
+	})
+}
+
+// sendWithTimeout calls send with default send timeout.
+func sendWithTimeout(ctx context.Context, send func() error) error {
 	timeoutCtx, cancel := context.WithTimeout(ctx, sendTimeout)
 	defer cancel()
 	errChan := make(chan error, 1)
 	go func() {
-		errChan <- upstream.Send(request)
+		errChan <- send()
 		close(errChan)
 	}()
 	select {
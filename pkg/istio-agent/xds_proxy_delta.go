@@ -0,0 +1,229 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package istioagent
+
+import (
+	"context"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/any"
+	google_rpc "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	nds "istio.io/istio/pilot/pkg/proto"
+	v3 "istio.io/istio/pilot/pkg/xds/v3"
+	"istio.io/istio/pkg/istio-agent/metrics"
+	"istio.io/istio/pkg/istio-agent/wasm"
+	"istio.io/pkg/log"
+)
+
+// DeltaAggregatedResources proxies a delta ADS stream of Envoy to istiod. As for
+// StreamAggregatedResources, a new upstream connection is made for every downstream connection.
+func (p *XdsProxy) DeltaAggregatedResources(downstream discovery.AggregatedDiscoveryService_DeltaAggregatedResourcesServer) error {
+	proxyLog.Infof("Envoy delta ADS stream established")
+
+	con := &ProxyConnection{
+		upstreamError:      make(chan error),
+		downstreamError:    make(chan error),
+		deltaRequestsChan:  make(chan *discovery.DeltaDiscoveryRequest, 10),
+		deltaResponsesChan: make(chan *discovery.DeltaDiscoveryResponse, 10),
+		stopChan:           make(chan struct{}),
+		deltaDownstream:    downstream,
+	}
+
+	p.RegisterStream(con)
+
+	// Handle downstream xds
+	firstNDSSent := false
+	go func() {
+		for {
+			// From Envoy
+			req, err := downstream.Recv()
+			if err != nil {
+				con.downstreamError <- err
+				return
+			}
+			// forward to istiod
+			con.deltaRequestsChan <- req
+			if p.localDNSServer != nil && !firstNDSSent && req.TypeUrl == v3.ListenerType {
+				// fire off an initial NDS request
+				con.deltaRequestsChan <- &discovery.DeltaDiscoveryRequest{
+					TypeUrl: v3.NameTableType,
+				}
+				firstNDSSent = true
+			}
+		}
+	}()
+
+	upstreamConn, err := p.dialUpstream()
+	if err != nil {
+		return err
+	}
+	defer upstreamConn.Close()
+
+	xds := discovery.NewAggregatedDiscoveryServiceClient(upstreamConn)
+	// We must propagate upstream termination to Envoy. This ensures that we resume the full XDS sequence on new connection
+	return p.HandleDeltaUpstream(p.upstreamContext(), con, xds)
+}
+
+func (p *XdsProxy) HandleDeltaUpstream(ctx context.Context, con *ProxyConnection, xds discovery.AggregatedDiscoveryServiceClient) error {
+	proxyLog.Infof("connecting to upstream delta XDS server: %s", p.istiodAddress)
+	defer proxyLog.Infof("disconnected from delta XDS server: %s", p.istiodAddress)
+	upstream, err := xds.DeltaAggregatedResources(ctx,
+		grpc.MaxCallRecvMsgSize(defaultClientMaxReceiveMessageSize))
+	if err != nil {
+		proxyLog.Errorf("failed to create upstream grpc client: %v", err)
+		return err
+	}
+
+	// Handle upstream xds
+	go func() {
+		for {
+			// from istiod
+			resp, err := upstream.Recv()
+			if err != nil {
+				con.upstreamError <- err
+				return
+			}
+			con.deltaResponsesChan <- resp
+		}
+	}()
+
+	// as for HandleUpstream, WebAssembly modules are retrieved off the receive loop
+	done := make(chan struct{})
+	defer close(done)
+	ecdsQueue := newTaskQueue()
+	go ecdsQueue.run(done)
+	ecdsResponses := make(chan *discovery.DeltaDiscoveryResponse)
+
+	for {
+		select {
+		case err := <-con.upstreamError:
+			// error from upstream Istiod.
+			if isExpectedGRPCError(err) {
+				proxyLog.Debugf("upstream terminated with status %v", err)
+				metrics.IstiodConnectionCancellations.Increment()
+			} else {
+				proxyLog.Warnf("upstream terminated with unexpected error %v", err)
+				metrics.IstiodConnectionErrors.Increment()
+			}
+			_ = upstream.CloseSend()
+			return nil
+		case err := <-con.downstreamError:
+			// error from downstream Envoy.
+			if isExpectedGRPCError(err) {
+				proxyLog.Debugf("downstream terminated with status %v", err)
+				metrics.EnvoyConnectionCancellations.Increment()
+			} else {
+				proxyLog.Warnf("downstream terminated with unexpected error %v", err)
+				metrics.EnvoyConnectionErrors.Increment()
+			}
+			// On downstream error, we will return. This propagates the error to downstream envoy which will trigger reconnect
+			return err
+		case req, ok := <-con.deltaRequestsChan:
+			if !ok {
+				return nil
+			}
+			proxyLog.Debugf("delta request for type url %s", req.TypeUrl)
+			metrics.XdsProxyRequests.Increment()
+			if err = sendWithTimeout(ctx, func() error { return upstream.Send(req) }); err != nil {
+				proxyLog.Errorf("upstream send error for type url %s: %v", req.TypeUrl, err)
+				return err
+			}
+		case resp, ok := <-con.deltaResponsesChan:
+			if !ok {
+				return nil
+			}
+			proxyLog.Debugf("delta response for type url %s", resp.TypeUrl)
+			metrics.XdsProxyResponses.Increment()
+			switch resp.TypeUrl {
+			case v3.NameTableType:
+				// intercept. This is for the dns server
+				if p.localDNSServer != nil && len(resp.Resources) > 0 {
+					var nt nds.NameTable
+					if err = ptypes.UnmarshalAny(resp.Resources[0].Resource, &nt); err != nil {
+						log.Errorf("failed to unmarshall name table: %v", err)
+					}
+					p.localDNSServer.UpdateLookupTable(&nt)
+				}
+
+				// Send ACK
+				con.deltaRequestsChan <- &discovery.DeltaDiscoveryRequest{
+					TypeUrl:       v3.NameTableType,
+					ResponseNonce: resp.Nonce,
+				}
+			case v3.ExtensionConfigurationType:
+				// intercept. Envoy loads the WebAssembly modules from the local cache
+				ecdsQueue.push(func() {
+					if err := convertDeltaResources(resp.Resources, p.wasmCache); err != nil {
+						proxyLog.Errorf("failed to retrieve WebAssembly modules: %v", err)
+						// NACK, so that Envoy keeps its current filter configuration
+						nack := &discovery.DeltaDiscoveryRequest{
+							TypeUrl:       v3.ExtensionConfigurationType,
+							ResponseNonce: resp.Nonce,
+							ErrorDetail: &google_rpc.Status{
+								Code:    int32(codes.Unavailable),
+								Message: err.Error(),
+							},
+						}
+						select {
+						case con.deltaRequestsChan <- nack:
+						case <-done:
+						}
+						return
+					}
+					select {
+					case ecdsResponses <- resp:
+					case <-done:
+					}
+				})
+			default:
+				if err := con.deltaDownstream.Send(resp); err != nil {
+					proxyLog.Errorf("downstream send error: %v", err)
+					// we cannot return partial error and hope to restart just the downstream
+					// as we are blindly proxying req/responses. For now, the best course of action
+					// is to terminate upstream connection as well and restart afresh.
+					return err
+				}
+			}
+		case resp := <-ecdsResponses:
+			if err := con.deltaDownstream.Send(resp); err != nil {
+				proxyLog.Errorf("downstream send error: %v", err)
+				return err
+			}
+		case <-con.stopChan:
+			_ = upstream.CloseSend()
+			return nil
+		}
+	}
+}
+
+// convertDeltaResources rewrites the extension configurations of a delta response to load their
+// WebAssembly modules from the local cache.
+func convertDeltaResources(resources []*discovery.Resource, cache *wasm.Cache) error {
+	converted := make([]*any.Any, 0, len(resources))
+	for _, r := range resources {
+		converted = append(converted, r.Resource)
+	}
+	if err := wasm.ConvertResources(converted, cache); err != nil {
+		return err
+	}
+	for i, r := range resources {
+		r.Resource = converted[i]
+	}
+	return nil
+}
@@ -212,3 +212,26 @@ func setupDownstreamConnection(t *testing.T) *grpc.ClientConn {
 	})
 	return conn
 }
+
+func TestTaskQueue(t *testing.T) {
+	stop := make(chan struct{})
+	defer close(stop)
+	q := newTaskQueue()
+	go q.run(stop)
+
+	// pushing does not wait for the running task
+	release := make(chan struct{})
+	results := make(chan int, 3)
+	q.push(func() {
+		<-release
+		results <- 0
+	})
+	q.push(func() { results <- 1 })
+	q.push(func() { results <- 2 })
+	close(release)
+	for i := 0; i < 3; i++ {
+		if got := <-results; got != i {
+			t.Fatalf("expected task %d to run but got %d", i, got)
+		}
+	}
+}
@@ -26,6 +26,7 @@ import (
 	"os"
 	"reflect"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/hashicorp/go-multierror"
@@ -41,6 +42,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
 	kubeVersion "k8s.io/apimachinery/pkg/version"
 	"k8s.io/apimachinery/pkg/watch"
@@ -138,6 +140,11 @@ type Client interface {
 
 	// GetMemberRoll returns the member roll for the client, which may be nil.
 	GetMemberRoll() memberroll.MemberRollController
+
+	// AddNamespaceHandler adds a handler that is notified when the watched namespaces change.
+	// OnRemove is called before the informers of a namespace are stopped, while their caches still
+	// hold the objects of the namespace. OnAdd is called once the informers of a namespace synced.
+	AddNamespaceHandler(handler xnsinformers.NamespaceSetHandler)
 }
 
 // ExtendedClient is an extended client with additional helpers/functionality for Istioctl and testing.
@@ -203,6 +210,7 @@ const resyncInterval = 0
 func NewFakeClient(objects ...runtime.Object) ExtendedClient {
 	c := &client{
 		informerWatchesPending: atomic.NewInt32(0),
+		namespaces:             sets.NewString(metav1.NamespaceAll),
 	}
 	fakeClient := fake.NewSimpleClientset(objects...)
 	c.Interface = fakeClient
@@ -293,6 +301,11 @@ type client struct {
 
 	memberRoll memberroll.MemberRollController
 
+	// namespaces are the namespaces currently watched by the informers
+	namespaces        sets.String
+	namespaceHandlers []xnsinformers.NamespaceSetHandler
+	namespaceLock     sync.Mutex
+
 	// If enable, will wait for cache syncs with extremely short delay. This should be used only for tests
 	fastSync               bool
 	informerWatchesPending *atomic.Int32
@@ -305,6 +318,7 @@ func newClientInternal(clientFactory util.Factory, revision string) (*client, er
 
 	c.clientFactory = clientFactory
 	c.revision = revision
+	c.namespaces = sets.NewString(metav1.NamespaceAll)
 
 	c.restClient, err = clientFactory.RESTClient()
 	if err != nil {
@@ -427,11 +441,7 @@ func (c *client) SetNamespaces(namespaces ...string) {
 		return
 	}
 
-	c.kubeInformer.SetNamespaces(namespaces...)
-	c.istioInformer.SetNamespaces(namespaces...)
-	c.dynamicInformer.SetNamespaces(namespaces...)
-	c.metadataInformer.SetNamespaces(namespaces...)
-	c.serviceapisInformers.SetNamespaces(namespaces...)
+	c.setNamespaces(namespaces...)
 }
 
 func (c *client) AddMemberRoll(namespace, memberRollName string) (err error) {
@@ -440,11 +450,7 @@ func (c *client) AddMemberRoll(namespace, memberRollName string) (err error) {
 		return err
 	}
 
-	c.memberRoll.Register(c.kubeInformer, "kubernetes-informers")
-	c.memberRoll.Register(c.istioInformer, "istio-infomrers")
-	c.memberRoll.Register(c.dynamicInformer, "dynamic-informers")
-	c.memberRoll.Register(c.metadataInformer, "metadata-informers")
-	c.memberRoll.Register(c.serviceapisInformers, "service-apis-informers")
+	c.memberRoll.Register(memberRollListener{client: c}, "informers")
 
 	return nil
 }
@@ -0,0 +1,145 @@
+// Copyright Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kube
+
+import (
+	"time"
+
+	xnsinformers "github.com/maistra/xns-informer/pkg/informers"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"istio.io/pkg/log"
+	"istio.io/pkg/monitoring"
+)
+
+// namespaceSyncTimeout is how long to wait for the informers of added
+// namespaces to sync before giving up on notifying the handlers
+const namespaceSyncTimeout = 5 * time.Minute
+
+var (
+	phaseTag = monitoring.MustCreateLabel("phase")
+
+	namespaceReconcileTime = monitoring.NewDistribution(
+		"pilot_k8s_namespace_reconcile_seconds",
+		"Time to reconcile the informers with a change of the watched namespaces. The remove phase ends when "+
+			"the informers of removed namespaces are stopped, the add phase when the informers of added namespaces synced.",
+		[]float64{.01, .1, .5, 1, 3, 5, 10, 20, 30, 60, 120, 300},
+		monitoring.WithLabels(phaseTag),
+	)
+)
+
+func init() {
+	monitoring.MustRegister(namespaceReconcileTime)
+}
+
+// memberRollListener updates the namespaces watched by the client when the
+// member roll changes
+type memberRollListener struct {
+	client *client
+}
+
+func (l memberRollListener) SetNamespaces(namespaces ...string) {
+	l.client.setNamespaces(namespaces...)
+}
+
+func (c *client) AddNamespaceHandler(handler xnsinformers.NamespaceSetHandler) {
+	c.namespaceLock.Lock()
+	defer c.namespaceLock.Unlock()
+	c.namespaceHandlers = append(c.namespaceHandlers, handler)
+}
+
+// setNamespaces updates the namespaces watched by the informers. Only the
+// informers of the namespaces that were added or removed are started or
+// stopped. Handlers are notified of a removed namespace before its informers
+// are stopped, so they can still read the objects of the namespace from the
+// caches, and of an added namespace once its informers synced. Switching
+// from all namespaces to a set of namespaces removes metav1.NamespaceAll, so
+// the objects of the namespaces that remain watched are deleted and then
+// added again by their new informers.
+func (c *client) setNamespaces(namespaces ...string) {
+	c.namespaceLock.Lock()
+	defer c.namespaceLock.Unlock()
+
+	updated := sets.NewString(namespaces...)
+	if updated.Has(metav1.NamespaceAll) {
+		updated = sets.NewString(metav1.NamespaceAll)
+	}
+	removed := c.namespaces.Difference(updated)
+	added := updated.Difference(c.namespaces)
+	if removed.Len() == 0 && added.Len() == 0 {
+		return
+	}
+
+	t0 := time.Now()
+	for _, ns := range removed.List() {
+		for _, h := range c.namespaceHandlers {
+			h.OnRemove(ns)
+		}
+	}
+
+	c.kubeInformer.SetNamespaces(namespaces...)
+	c.istioInformer.SetNamespaces(namespaces...)
+	c.dynamicInformer.SetNamespaces(namespaces...)
+	c.metadataInformer.SetNamespaces(namespaces...)
+	c.serviceapisInformers.SetNamespaces(namespaces...)
+	c.namespaces = updated
+
+	if removed.Len() > 0 {
+		namespaceReconcileTime.With(phaseTag.Value("remove")).Record(time.Since(t0).Seconds())
+		log.Infof("Stopped informers for namespaces %v in %v", removed.List(), time.Since(t0))
+	}
+	if added.Len() > 0 {
+		handlers := append([]xnsinformers.NamespaceSetHandler(nil), c.namespaceHandlers...)
+		go c.waitForNamespaces(added.List(), handlers, t0)
+	}
+}
+
+// waitForNamespaces waits for the informers of the added namespaces to sync
+// and notifies the handlers
+func (c *client) waitForNamespaces(added []string, handlers []xnsinformers.NamespaceSetHandler, t0 time.Time) {
+	stop := make(chan struct{})
+	timer := time.AfterFunc(namespaceSyncTimeout, func() { close(stop) })
+	defer timer.Stop()
+
+	synced := true
+	for _, ok := range c.kubeInformer.WaitForCacheSync(stop) {
+		synced = synced && ok
+	}
+	for _, ok := range c.istioInformer.WaitForCacheSync(stop) {
+		synced = synced && ok
+	}
+	for _, ok := range c.dynamicInformer.WaitForCacheSync(stop) {
+		synced = synced && ok
+	}
+	for _, ok := range c.metadataInformer.WaitForCacheSync(stop) {
+		synced = synced && ok
+	}
+	for _, ok := range c.serviceapisInformers.WaitForCacheSync(stop) {
+		synced = synced && ok
+	}
+	if !synced {
+		log.Warnf("Informers for namespaces %v did not sync within %v", added, namespaceSyncTimeout)
+		return
+	}
+
+	namespaceReconcileTime.With(phaseTag.Value("add")).Record(time.Since(t0).Seconds())
+	log.Infof("Informers for namespaces %v synced in %v", added, time.Since(t0))
+	for _, ns := range added {
+		for _, h := range handlers {
+			h.OnAdd(ns)
+		}
+	}
+}
@@ -16,6 +16,7 @@ package security
 
 import (
 	"context"
+	"crypto"
 	"strings"
 	"time"
 
@@ -39,8 +40,15 @@ const (
 	DefaultRootCertFilePath = "./etc/certs/root-cert.pem"
 
 	// Credential fetcher type
-	GCE  = "GoogleComputeEngine"
-	Mock = "Mock" // testing only
+	GCE   = "GoogleComputeEngine"
+	AWS   = "AWS"
+	Azure = "Azure"
+	OIDC  = "OIDC"
+	Mock  = "Mock" // testing only
+
+	// Key provider type
+	KeyProviderMemory = "memory"
+	KeyProviderFile   = "file"
 )
 
 // TODO: For 1.8, make sure MeshConfig is updated with those settings,
@@ -103,6 +111,19 @@ type Options struct {
 	// The Vault TLS root certificate.
 	VaultTLSRootCert string
 
+	// The authentication of the CSRs sent to the REST CA: token, ott or mtls.
+	RESTCAAuth string
+
+	// The file holding the token used to authenticate with the REST CA. If empty, the workload token is used.
+	RESTCATokenFile string
+
+	// The client certificate and key presented to the REST CA.
+	RESTCAClientCertFile string
+	RESTCAClientKeyFile  string
+
+	// The root certificate of the PKI behind the REST CA, completing the certificate chains it returns.
+	RESTCARootCertFile string
+
 	// GrpcServer is an already configured (shared) grpc server. If set, the agent will just register on the server.
 	GrpcServer *grpc.Server
 
@@ -156,6 +177,10 @@ type Options struct {
 	// well-known ./etc/certs location.
 	FileMountedCerts bool
 
+	// CRLFilePath is the path of the certificate revocation list published by the CA. When the
+	// file exists, the revocation list is sent to the proxies along with the root cert.
+	CRLFilePath string
+
 	// PilotCertProvider is the provider of the Pilot certificate (PILOT_CERT_PROVIDER env)
 	// Determines the root CA file to use for connecting to CA gRPC:
 	// - istiod
@@ -194,6 +219,10 @@ type Options struct {
 	// credential identity provider
 	CredIdentityProvider string
 
+	// KeyProvider generates and holds the private keys of the workload certificates. The keys
+	// are generated and held in memory if it is not set.
+	KeyProvider KeyProvider
+
 	// Namespace corresponding to workload
 	WorkloadNamespace string
 
@@ -242,6 +271,9 @@ type SecretItem struct {
 
 	RootCert []byte
 
+	// CRL is the PEM encoded certificate revocation list of the CA, sent along with the root cert.
+	CRL []byte
+
 	// RootCertOwnedByCompoundSecret is true if this SecretItem was created by a
 	// K8S secret having both server cert/key and client ca and should be deleted
 	// with the secret.
@@ -262,6 +294,58 @@ type SecretItem struct {
 	CreatedTime time.Time
 
 	ExpireTime time.Time
+
+	// ProviderKey is the private key held by the KeyProvider, outside of the agent. PrivateKey is
+	// empty in this case, and the proxy uses the key through the file or the private key provider.
+	ProviderKey *PrivateKey
+}
+
+// KeyOptions are the parameters of the private keys generated by a KeyProvider.
+type KeyOptions struct {
+	// RSAKeySize is the size of the RSA keys, used if ECSigAlg is not set.
+	RSAKeySize int
+
+	// ECSigAlg is the elliptic curve signature algorithm of the keys. Only ECDSA is supported.
+	ECSigAlg string
+
+	// PKCS8 encodes the keys provided in PEM form as PKCS#8.
+	PKCS8 bool
+}
+
+// PrivateKey is a private key generated by a KeyProvider. Unless the key is held in memory, it is
+// referenced by Path or Provider, and is never sent to the proxy.
+type PrivateKey struct {
+	// ID identifies the key within the provider.
+	ID string
+
+	// PEM is the PEM encoded key, for the keys held in memory.
+	PEM []byte
+
+	// Path is the file holding the PEM encoded key.
+	Path string
+
+	// Provider is the Envoy private key provider performing the operations of the key.
+	Provider *PrivateKeyProvider
+}
+
+// PrivateKeyProvider is the configuration of an Envoy private key provider.
+type PrivateKeyProvider struct {
+	Name   string
+	Config map[string]string
+}
+
+// KeyProvider generates and holds the private keys of the workload certificates, so that the keys
+// may be kept outside of the agent.
+type KeyProvider interface {
+	// GenerateKey generates a new private key, named after the secret it is generated for. The signer
+	// performs the operations of the key, it is used to sign the CSR and should not be retained.
+	GenerateKey(name string, options KeyOptions) (*PrivateKey, crypto.Signer, error)
+
+	// DeleteKey deletes a key generated by the provider, once it is no longer used.
+	DeleteKey(key *PrivateKey) error
+
+	// GetType returns the type of the key provider.
+	GetType() string
 }
 
 type CredFetcher interface {
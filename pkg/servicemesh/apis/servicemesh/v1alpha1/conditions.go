@@ -0,0 +1,103 @@
+// Copyright Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ConditionType is the type of a ServiceMeshExtension condition
+type ConditionType string
+
+const (
+	// ConditionTypePulled signals whether the image of the extension could be
+	// pulled and the module extracted from it
+	ConditionTypePulled ConditionType = "Pulled"
+	// ConditionTypeVerified signals whether the module passed verification
+	ConditionTypeVerified ConditionType = "Verified"
+	// ConditionTypePublished signals whether the module is served to proxies
+	ConditionTypePublished ConditionType = "Published"
+	// ConditionTypeAppliedToProxies signals whether all proxies the module was
+	// sent to acknowledged it
+	ConditionTypeAppliedToProxies ConditionType = "AppliedToProxies"
+	// ConditionTypeOrdered signals whether the before/after constraints of the
+	// extension could be satisfied
+	ConditionTypeOrdered ConditionType = "Ordered"
+)
+
+// ConditionReason is the reason for a ServiceMeshExtension condition
+type ConditionReason string
+
+const (
+	ConditionReasonImagePulled          ConditionReason = "ImagePulled"
+	ConditionReasonInvalidImage         ConditionReason = "InvalidImage"
+	ConditionReasonPullFailed           ConditionReason = "PullFailed"
+	ConditionReasonVerificationPassed   ConditionReason = "VerificationPassed"
+	ConditionReasonVerificationDisabled ConditionReason = "VerificationDisabled"
+	ConditionReasonVerificationFailed   ConditionReason = "VerificationFailed"
+	ConditionReasonModulePublished      ConditionReason = "ModulePublished"
+	ConditionReasonPublishFailed        ConditionReason = "PublishFailed"
+	ConditionReasonQuotaExceeded        ConditionReason = "QuotaExceeded"
+	ConditionReasonProxiesAcked         ConditionReason = "ProxiesAcked"
+	ConditionReasonProxiesPending       ConditionReason = "ProxiesPending"
+	ConditionReasonNoMatchingProxies    ConditionReason = "NoMatchingProxies"
+	ConditionReasonOrderResolved        ConditionReason = "OrderResolved"
+	ConditionReasonCycleDetected        ConditionReason = "CycleDetected"
+	ConditionReasonConstraintsIgnored   ConditionReason = "ConstraintsIgnored"
+)
+
+// Condition describes an aspect of the state of a ServiceMeshExtension
+type Condition struct {
+	Type               ConditionType          `json:"type"`
+	Status             corev1.ConditionStatus `json:"status"`
+	Reason             ConditionReason        `json:"reason,omitempty"`
+	Message            string                 `json:"message,omitempty"`
+	LastTransitionTime metav1.Time            `json:"lastTransitionTime,omitempty"`
+}
+
+// GetCondition returns the condition of the given type or nil if it is not set
+func (s *ServiceMeshExtensionStatus) GetCondition(conditionType ConditionType) *Condition {
+	for i := range s.Conditions {
+		if s.Conditions[i].Type == conditionType {
+			return &s.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// SetCondition adds or replaces the condition of the same type. The last
+// transition time is only updated if the status changed. It returns false
+// if the condition was already set.
+func (s *ServiceMeshExtensionStatus) SetCondition(condition Condition) bool {
+	existing := s.GetCondition(condition.Type)
+	if existing == nil {
+		if condition.LastTransitionTime.IsZero() {
+			condition.LastTransitionTime = metav1.Now()
+		}
+		s.Conditions = append(s.Conditions, condition)
+		return true
+	}
+	if existing.Status == condition.Status && existing.Reason == condition.Reason && existing.Message == condition.Message {
+		return false
+	}
+	if existing.Status != condition.Status {
+		existing.LastTransitionTime = metav1.Now()
+	}
+	existing.Status = condition.Status
+	existing.Reason = condition.Reason
+	existing.Message = condition.Message
+	return true
+}
@@ -55,6 +55,8 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 		SchemeGroupVersion,
 		&ServiceMeshExtension{},
 		&ServiceMeshExtensionList{},
+		&ServiceMeshTrustBundle{},
+		&ServiceMeshTrustBundleList{},
 	)
 
 	metav1.AddToGroupVersion(
@@ -70,6 +72,8 @@ func addKnownInternalTypes(scheme *runtime.Scheme) error {
 		InternalSchemeGroupVersion,
 		&ServiceMeshExtension{},
 		&ServiceMeshExtensionList{},
+		&ServiceMeshTrustBundle{},
+		&ServiceMeshTrustBundleList{},
 	)
 
 	return nil
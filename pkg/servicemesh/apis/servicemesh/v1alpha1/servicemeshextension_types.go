@@ -25,6 +25,11 @@ type ServiceMeshExtensionSpec struct {
 	Phase            *FilterPhase     `json:"phase"`
 	Priority         *int             `json:"priority,omitempty"`
 	Config           string           `json:"config,omitempty"`
+	Rollout          *RolloutStrategy `json:"rollout,omitempty"`
+	// Before lists the extensions and native Envoy filters this extension must run before
+	Before []OrderingReference `json:"before,omitempty"`
+	// After lists the extensions and native Envoy filters this extension must run after
+	After []OrderingReference `json:"after,omitempty"`
 }
 
 // ServiceMeshExtensionStatus defines the observed state of ServiceMeshExtension
@@ -33,6 +38,11 @@ type ServiceMeshExtensionStatus struct {
 	Priority           int              `json:"priority,omitempty"`
 	ObservedGeneration int64            `json:"observedGeneration,omitempty"`
 	Deployment         DeploymentStatus `json:"deployment,omitempty"`
+	Rollout            *RolloutStatus   `json:"rollout,omitempty"`
+	Conditions         []Condition      `json:"conditions,omitempty"`
+	// AckedProxies is the number of proxies that acknowledged the listener
+	// or extension configuration containing the deployed module
+	AckedProxies int `json:"ackedProxies,omitempty"`
 }
 
 type DeploymentStatus struct {
@@ -40,6 +50,46 @@ type DeploymentStatus struct {
 	ContainerSHA256 string `json:"containerSha256,omitempty"`
 	SHA256          string `json:"sha256,omitempty"`
 	URL             string `json:"url,omitempty"`
+	Message         string `json:"message,omitempty"`
+}
+
+// OrderingReference refers to either another ServiceMeshExtension or to a
+// native Envoy HTTP filter. Exactly one of the fields must be set.
+type OrderingReference struct {
+	// Extension is the name of a ServiceMeshExtension in the same phase, either
+	// as <name> for extensions in the same namespace or as <namespace>/<name>
+	Extension string `json:"extension,omitempty"`
+	// Filter is the name of a native Envoy HTTP filter, e.g. envoy.filters.http.cors.
+	// If the filter is part of a filter chain, the extension is placed right
+	// next to it instead of at its phase. Constraints between the extension and
+	// other extensions are then ignored, which the Ordered condition reports.
+	Filter string `json:"filter,omitempty"`
+}
+
+// RolloutStrategy stages the rollout of a new image to the selected workloads.
+// While a rollout is in progress, workloads that are not part of it keep
+// running the previously deployed module. The rollout is completed by setting
+// percentage to 100 or by removing the rollout from the spec.
+type RolloutStrategy struct {
+	// Percentage of the selected workloads that receive the new module
+	Percentage *int `json:"percentage,omitempty"`
+	// CanarySelector selects workloads that receive the new module regardless of percentage
+	CanarySelector map[string]string `json:"canarySelector,omitempty"`
+	// FailureThreshold is the number of WebAssembly failures reported by proxies
+	// running the new module after which the rollout is rolled back.
+	// Zero disables automatic rollback.
+	FailureThreshold int `json:"failureThreshold,omitempty"`
+}
+
+// RolloutStatus tracks a rollout that is in progress
+type RolloutStatus struct {
+	// Previous is the deployment that was active before the rollout started
+	Previous *DeploymentStatus `json:"previous,omitempty"`
+	// Failures is the number of WebAssembly failures reported for the new module
+	Failures int `json:"failures,omitempty"`
+	// RolledBack is set once failures crossed the failure threshold. All
+	// workloads are served the previous deployment until the image changes.
+	RolledBack bool `json:"rolledBack,omitempty"`
 }
 
 // WorkloadSelector is used to match workloads based on pod labels
@@ -0,0 +1,57 @@
+// Copyright Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ServiceMeshTrustBundleSpec configures the trust bundle of a federated SPIFFE
+// trust domain. Exactly one of Endpoint and Bundle must be set.
+type ServiceMeshTrustBundleSpec struct {
+	// TrustDomain is the federated SPIFFE trust domain
+	TrustDomain string `json:"trustDomain"`
+	// Endpoint is the URL of the SPIFFE bundle endpoint of the trust domain,
+	// using the https_web profile. The bundle is refreshed periodically,
+	// honoring the refresh hint of the bundle.
+	Endpoint string `json:"endpoint,omitempty"`
+	// Bundle is a SPIFFE bundle document or the PEM encoded root certificates
+	// of the trust domain. PEM encoded bundles may also contain the certificate
+	// revocation lists of the trust domain, which proxies require to accept its
+	// peers once the mesh CA revokes certificates
+	Bundle string `json:"bundle,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// ServiceMeshTrustBundle is the Schema for the servicemeshtrustbundles API.
+// Only resources in the control plane namespace are used.
+type ServiceMeshTrustBundle struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ServiceMeshTrustBundleSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ServiceMeshTrustBundleList contains a list of ServiceMeshTrustBundle
+type ServiceMeshTrustBundleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ServiceMeshTrustBundle `json:"items"`
+}
@@ -23,6 +23,7 @@ import (
 	structpb "github.com/golang/protobuf/ptypes/struct"
 
 	"istio.io/istio/istioctl/pkg/authz"
+	"istio.io/istio/pilot/pkg/features"
 	"istio.io/istio/pilot/pkg/model"
 	"istio.io/istio/pilot/pkg/networking/util"
 	"istio.io/istio/pkg/servicemesh/apis/servicemesh/v1alpha1"
@@ -89,21 +90,22 @@ func ApplyListenerPatches(
 		if hcm == nil {
 			continue
 		}
+		pinned := pinToNativeFilters(extensions, hcm.GetHttpFilters())
 		newHTTPFilters := make([]*hcm_filter.HttpFilter, 0)
 		for _, httpFilter := range hcm.GetHttpFilters() {
 			switch httpFilter.Name {
 			case "envoy.filters.http.jwt_authn":
 				newHTTPFilters = popAppend(newHTTPFilters, extensions, v1alpha1.FilterPhasePreAuthN)
-				newHTTPFilters = append(newHTTPFilters, httpFilter)
+				newHTTPFilters = pinned.appendNative(newHTTPFilters, httpFilter)
 			case "istio_authn":
 				newHTTPFilters = popAppend(newHTTPFilters, extensions, v1alpha1.FilterPhasePreAuthN)
-				newHTTPFilters = append(newHTTPFilters, httpFilter)
+				newHTTPFilters = pinned.appendNative(newHTTPFilters, httpFilter)
 				newHTTPFilters = popAppend(newHTTPFilters, extensions, v1alpha1.FilterPhasePostAuthN)
 			case "envoy.filters.http.rbac":
 				newHTTPFilters = popAppend(newHTTPFilters, extensions, v1alpha1.FilterPhasePreAuthN)
 				newHTTPFilters = popAppend(newHTTPFilters, extensions, v1alpha1.FilterPhasePostAuthN)
 				newHTTPFilters = popAppend(newHTTPFilters, extensions, v1alpha1.FilterPhasePreAuthZ)
-				newHTTPFilters = append(newHTTPFilters, httpFilter)
+				newHTTPFilters = pinned.appendNative(newHTTPFilters, httpFilter)
 				newHTTPFilters = popAppend(newHTTPFilters, extensions, v1alpha1.FilterPhasePostAuthZ)
 			case "istio.stats":
 				newHTTPFilters = popAppend(newHTTPFilters, extensions, v1alpha1.FilterPhasePreAuthN)
@@ -111,7 +113,7 @@ func ApplyListenerPatches(
 				newHTTPFilters = popAppend(newHTTPFilters, extensions, v1alpha1.FilterPhasePreAuthZ)
 				newHTTPFilters = popAppend(newHTTPFilters, extensions, v1alpha1.FilterPhasePostAuthZ)
 				newHTTPFilters = popAppend(newHTTPFilters, extensions, v1alpha1.FilterPhasePreStats)
-				newHTTPFilters = append(newHTTPFilters, httpFilter)
+				newHTTPFilters = pinned.appendNative(newHTTPFilters, httpFilter)
 				newHTTPFilters = popAppend(newHTTPFilters, extensions, v1alpha1.FilterPhasePostStats)
 			case "envoy.router":
 				newHTTPFilters = popAppend(newHTTPFilters, extensions, v1alpha1.FilterPhasePreAuthN)
@@ -120,9 +122,9 @@ func ApplyListenerPatches(
 				newHTTPFilters = popAppend(newHTTPFilters, extensions, v1alpha1.FilterPhasePostAuthZ)
 				newHTTPFilters = popAppend(newHTTPFilters, extensions, v1alpha1.FilterPhasePreStats)
 				newHTTPFilters = popAppend(newHTTPFilters, extensions, v1alpha1.FilterPhasePostStats)
-				newHTTPFilters = append(newHTTPFilters, httpFilter)
+				newHTTPFilters = pinned.appendNative(newHTTPFilters, httpFilter)
 			default:
-				newHTTPFilters = append(newHTTPFilters, httpFilter)
+				newHTTPFilters = pinned.appendNative(newHTTPFilters, httpFilter)
 			}
 		}
 		hcm.HttpFilters = newHTTPFilters
@@ -147,6 +149,74 @@ func ApplyListenerListPatches(
 	return out
 }
 
+// phases lists all filter phases in the order they appear in the filter chain
+var phases = []v1alpha1.FilterPhase{
+	v1alpha1.FilterPhasePreAuthN,
+	v1alpha1.FilterPhasePostAuthN,
+	v1alpha1.FilterPhasePreAuthZ,
+	v1alpha1.FilterPhasePostAuthZ,
+	v1alpha1.FilterPhasePreStats,
+	v1alpha1.FilterPhasePostStats,
+}
+
+// pinnedExtensions holds the extensions that are placed right before or
+// after a native filter, keyed by the name of the native filter
+type pinnedExtensions struct {
+	before map[string][]*maistramodel.ExtensionWrapper
+	after  map[string][]*maistramodel.ExtensionWrapper
+}
+
+// pinToNativeFilters removes the extensions that reference a native filter of
+// the filter chain from their phase. References to filters that are not part
+// of the chain are ignored, so these extensions stay in their phase.
+func pinToNativeFilters(filterMap map[v1alpha1.FilterPhase][]*maistramodel.ExtensionWrapper,
+	httpFilters []*hcm_filter.HttpFilter) pinnedExtensions {
+	pinned := pinnedExtensions{
+		before: map[string][]*maistramodel.ExtensionWrapper{},
+		after:  map[string][]*maistramodel.ExtensionWrapper{},
+	}
+	present := map[string]bool{}
+	for _, httpFilter := range httpFilters {
+		present[httpFilter.Name] = true
+	}
+	firstPresent := func(filters []string) string {
+		for _, filter := range filters {
+			if present[filter] {
+				return filter
+			}
+		}
+		return ""
+	}
+	for _, phase := range phases {
+		remaining := []*maistramodel.ExtensionWrapper{}
+		for _, ext := range filterMap[phase] {
+			if filter := firstPresent(ext.BeforeFilters); filter != "" {
+				pinned.before[filter] = append(pinned.before[filter], ext)
+			} else if filter := firstPresent(ext.AfterFilters); filter != "" {
+				pinned.after[filter] = append(pinned.after[filter], ext)
+			} else {
+				remaining = append(remaining, ext)
+			}
+		}
+		if _, ok := filterMap[phase]; ok {
+			filterMap[phase] = remaining
+		}
+	}
+	return pinned
+}
+
+// appendNative appends a native filter together with the extensions pinned to it
+func (p pinnedExtensions) appendNative(list []*hcm_filter.HttpFilter, httpFilter *hcm_filter.HttpFilter) []*hcm_filter.HttpFilter {
+	for _, ext := range p.before[httpFilter.Name] {
+		list = append(list, toEnvoyHTTPFilter(ext))
+	}
+	list = append(list, httpFilter)
+	for _, ext := range p.after[httpFilter.Name] {
+		list = append(list, toEnvoyHTTPFilter(ext))
+	}
+	return list
+}
+
 func popAppend(list []*hcm_filter.HttpFilter,
 	filterMap map[v1alpha1.FilterPhase][]*maistramodel.ExtensionWrapper,
 	phase v1alpha1.FilterPhase) []*hcm_filter.HttpFilter {
@@ -158,6 +228,9 @@ func popAppend(list []*hcm_filter.HttpFilter,
 }
 
 func toEnvoyHTTPFilter(extension *maistramodel.ExtensionWrapper) *hcm_filter.HttpFilter {
+	if features.EnableMaistraExtensionECDS {
+		return toConfigDiscoveryFilter(extension)
+	}
 	return &hcm_filter.HttpFilter{
 		Name: "envoy.filters.http.wasm",
 		ConfigType: &hcm_filter.HttpFilter_TypedConfig{
@@ -0,0 +1,117 @@
+// Copyright Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extension
+
+import (
+	"testing"
+
+	hcm_filter "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	"github.com/google/go-cmp/cmp"
+
+	"istio.io/istio/pkg/servicemesh/apis/servicemesh/v1alpha1"
+	maistramodel "istio.io/istio/pkg/servicemesh/model"
+)
+
+func TestPinToNativeFilters(t *testing.T) {
+	httpFilters := []*hcm_filter.HttpFilter{
+		{Name: "envoy.filters.http.cors"},
+		{Name: "istio_authn"},
+		{Name: "envoy.router"},
+	}
+	ext := func(name string, beforeFilters, afterFilters []string) *maistramodel.ExtensionWrapper {
+		return &maistramodel.ExtensionWrapper{
+			Name:          name,
+			Namespace:     "test-ns",
+			Phase:         v1alpha1.FilterPhasePostAuthN,
+			BeforeFilters: beforeFilters,
+			AfterFilters:  afterFilters,
+		}
+	}
+
+	cases := []struct {
+		name              string
+		extension         *maistramodel.ExtensionWrapper
+		expectedBefore    map[string][]string
+		expectedAfter     map[string][]string
+		expectedRemaining []string
+	}{
+		{
+			name:              "not pinned",
+			extension:         ext("a", nil, nil),
+			expectedBefore:    map[string][]string{},
+			expectedAfter:     map[string][]string{},
+			expectedRemaining: []string{"test-ns/a"},
+		},
+		{
+			name:              "pinned before a filter of the chain",
+			extension:         ext("a", []string{"envoy.filters.http.cors"}, nil),
+			expectedBefore:    map[string][]string{"envoy.filters.http.cors": {"test-ns/a"}},
+			expectedAfter:     map[string][]string{},
+			expectedRemaining: []string{},
+		},
+		{
+			name:              "first filter of the chain is used",
+			extension:         ext("a", nil, []string{"envoy.filters.http.fault", "istio_authn", "envoy.filters.http.cors"}),
+			expectedBefore:    map[string][]string{},
+			expectedAfter:     map[string][]string{"istio_authn": {"test-ns/a"}},
+			expectedRemaining: []string{},
+		},
+		{
+			name:              "filter missing from the chain",
+			extension:         ext("a", []string{"envoy.filters.http.fault"}, nil),
+			expectedBefore:    map[string][]string{},
+			expectedAfter:     map[string][]string{},
+			expectedRemaining: []string{"test-ns/a"},
+		},
+		{
+			name:              "before takes precedence over after",
+			extension:         ext("a", []string{"envoy.router"}, []string{"envoy.filters.http.cors"}),
+			expectedBefore:    map[string][]string{"envoy.router": {"test-ns/a"}},
+			expectedAfter:     map[string][]string{},
+			expectedRemaining: []string{},
+		},
+	}
+
+	keys := func(extensions map[string][]*maistramodel.ExtensionWrapper) map[string][]string {
+		out := map[string][]string{}
+		for filter, list := range extensions {
+			for _, ext := range list {
+				out[filter] = append(out[filter], ext.Key())
+			}
+		}
+		return out
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			filterMap := map[v1alpha1.FilterPhase][]*maistramodel.ExtensionWrapper{
+				v1alpha1.FilterPhasePostAuthN: {tt.extension},
+			}
+			pinned := pinToNativeFilters(filterMap, httpFilters)
+			if got := keys(pinned.before); !cmp.Equal(got, tt.expectedBefore) {
+				t.Errorf("unexpected extensions pinned before filters, +got -want: %s", cmp.Diff(got, tt.expectedBefore))
+			}
+			if got := keys(pinned.after); !cmp.Equal(got, tt.expectedAfter) {
+				t.Errorf("unexpected extensions pinned after filters, +got -want: %s", cmp.Diff(got, tt.expectedAfter))
+			}
+			remaining := []string{}
+			for _, ext := range filterMap[v1alpha1.FilterPhasePostAuthN] {
+				remaining = append(remaining, ext.Key())
+			}
+			if !cmp.Equal(remaining, tt.expectedRemaining) {
+				t.Errorf("unexpected extensions left in their phase, +got -want: %s", cmp.Diff(remaining, tt.expectedRemaining))
+			}
+		})
+	}
+}
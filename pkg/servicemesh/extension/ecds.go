@@ -0,0 +1,134 @@
+// Copyright Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extension
+
+import (
+	"strings"
+	"time"
+
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	wasmfilter "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/http/wasm/v3"
+	hcm_filter "github.com/envoyproxy/go-control-plane/envoy/extensions/filters/network/http_connection_manager/v3"
+	wasm "github.com/envoyproxy/go-control-plane/envoy/extensions/wasm/v3"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/wrappers"
+
+	"istio.io/istio/pilot/pkg/model"
+	"istio.io/istio/pilot/pkg/networking/util"
+	maistramodel "istio.io/istio/pkg/servicemesh/model"
+)
+
+const (
+	// WasmFilterTypeURL is the type of the filter configs delivered over ECDS
+	WasmFilterTypeURL = "type.googleapis.com/envoy.extensions.filters.http.wasm.v3.Wasm"
+
+	moduleFetchTimeout = 30 * time.Second
+	moduleFetchRetries = 2
+)
+
+// ExtensionConfigName returns the name of the filter and of the ECDS resource
+// of an extension. Namespaces cannot contain dots, so the name can be split
+// at the first dot.
+func ExtensionConfigName(extension *maistramodel.ExtensionWrapper) string {
+	return extension.Namespace + "." + extension.Name
+}
+
+// SplitExtensionConfigName returns the namespace and name of the extension
+// with the given filter name
+func SplitExtensionConfigName(configName string) (namespace, name string) {
+	parts := strings.SplitN(configName, ".", 2)
+	if len(parts) != 2 {
+		return "", configName
+	}
+	return parts[0], parts[1]
+}
+
+// ExtensionConfigs returns the ECDS resources of the extensions applied to the
+// proxy. If names is not empty, only the resources with these names are returned.
+func ExtensionConfigs(proxy *model.Proxy, push *model.PushContext, names []string) []*core.TypedExtensionConfig {
+	requested := map[string]struct{}{}
+	for _, name := range names {
+		requested[name] = struct{}{}
+	}
+	extensions := push.Extensions(proxy)
+	configs := []*core.TypedExtensionConfig{}
+	for _, phase := range phases {
+		for _, extension := range extensions[phase] {
+			name := ExtensionConfigName(extension)
+			if _, ok := requested[name]; len(requested) > 0 && !ok {
+				continue
+			}
+			configs = append(configs, ToExtensionConfig(extension))
+		}
+	}
+	return configs
+}
+
+// ToExtensionConfig builds the ECDS resource of an extension. The module is
+// referenced by its remote URL, which the agent replaces with the path of its
+// local copy before handing the configuration to Envoy.
+func ToExtensionConfig(extension *maistramodel.ExtensionWrapper) *core.TypedExtensionConfig {
+	return &core.TypedExtensionConfig{
+		Name: ExtensionConfigName(extension),
+		TypedConfig: util.MessageToAny(&wasmfilter.Wasm{
+			Config: &wasm.PluginConfig{
+				Name:          extension.Name,
+				RootId:        extension.Name + "_root",
+				Configuration: util.MessageToAny(&wrappers.StringValue{Value: extension.Config}),
+				Vm: &wasm.PluginConfig_VmConfig{
+					VmConfig: &wasm.VmConfig{
+						Runtime: Runtime,
+						Code: &core.AsyncDataSource{
+							Specifier: &core.AsyncDataSource_Remote{
+								Remote: &core.RemoteDataSource{
+									HttpUri: &core.HttpUri{
+										Uri: extension.FilterURL,
+										HttpUpstreamType: &core.HttpUri_Cluster{
+											Cluster: CacheCluster,
+										},
+										Timeout: ptypes.DurationProto(moduleFetchTimeout),
+									},
+									Sha256: extension.SHA256,
+									RetryPolicy: &core.RetryPolicy{
+										NumRetries: &wrappers.UInt32Value{Value: moduleFetchRetries},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		}),
+	}
+}
+
+// toConfigDiscoveryFilter builds a filter that retrieves the configuration of
+// the extension from ECDS over the ADS stream
+func toConfigDiscoveryFilter(extension *maistramodel.ExtensionWrapper) *hcm_filter.HttpFilter {
+	return &hcm_filter.HttpFilter{
+		Name: ExtensionConfigName(extension),
+		ConfigType: &hcm_filter.HttpFilter_ConfigDiscovery{
+			ConfigDiscovery: &core.ExtensionConfigSource{
+				ConfigSource: &core.ConfigSource{
+					ConfigSourceSpecifier: &core.ConfigSource_Ads{
+						Ads: &core.AggregatedConfigSource{},
+					},
+					ResourceApiVersion: core.ApiVersion_V3,
+				},
+				TypeUrls: []string{WasmFilterTypeURL},
+			},
+		},
+	}
+}
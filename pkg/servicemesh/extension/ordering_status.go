@@ -0,0 +1,135 @@
+// Copyright Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extension
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+
+	"istio.io/istio/pkg/servicemesh/apis/servicemesh/v1alpha1"
+	v1alpha1client "istio.io/istio/pkg/servicemesh/client/v1alpha1/clientset/versioned/typed/servicemesh/v1alpha1"
+	maistramodel "istio.io/istio/pkg/servicemesh/model"
+	"istio.io/pkg/log"
+)
+
+// OrderingReporter reports whether the before/after constraints of extensions
+// can be satisfied in the Ordered condition of each extension.
+// Only the leading istiod writes the status of extensions, see SetStatusWrite.
+type OrderingReporter struct {
+	client v1alpha1client.ServicemeshV1alpha1Interface
+	mut    sync.Mutex
+	write  bool
+}
+
+func NewOrderingReporter(client v1alpha1client.ServicemeshV1alpha1Interface) *OrderingReporter {
+	return &OrderingReporter{
+		client: client,
+	}
+}
+
+// SetStatusWrite enables or disables writing the Ordered condition. It is
+// enabled while this istiod is the leader.
+func (r *OrderingReporter) SetStatusWrite(enabled bool) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.write = enabled
+}
+
+// Report detects ordering cycles and constraints that are ignored because of
+// pinning to native filters between the given extensions, and updates the
+// Ordered condition of every extension whose condition changed
+func (r *OrderingReporter) Report(extensions []*v1alpha1.ServiceMeshExtension) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	if !r.write {
+		return
+	}
+
+	wrappers := make([]*maistramodel.ExtensionWrapper, 0, len(extensions))
+	for _, extension := range extensions {
+		wrappers = append(wrappers, maistramodel.ToWrapper(extension))
+	}
+	cycleOf := map[string][]string{}
+	for _, cycle := range maistramodel.FindOrderingCycles(wrappers) {
+		for _, key := range cycle {
+			cycleOf[key] = cycle
+		}
+	}
+
+	ignored := maistramodel.FindIgnoredConstraints(wrappers)
+
+	for _, extension := range extensions {
+		key := maistramodel.ExtensionKey(extension.Namespace, extension.Name)
+		condition := orderedCondition(cycleOf[key], ignored[key])
+		// skip the API call if the informer cache already has the condition
+		if !extension.DeepCopy().Status.SetCondition(condition) {
+			continue
+		}
+		if err := r.updateCondition(extension.Namespace, extension.Name, condition); err != nil {
+			log.Errorf("failed to update Ordered condition of extension %s/%s: %v", extension.Namespace, extension.Name, err)
+		}
+	}
+}
+
+// updateCondition sets the condition on the latest version of the extension,
+// as mec and the rollout monitor write the status of extensions concurrently
+func (r *OrderingReporter) updateCondition(namespace, name string, condition v1alpha1.Condition) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		extension, err := r.client.ServiceMeshExtensions(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if !extension.Status.SetCondition(condition) {
+			return nil
+		}
+		_, err = r.client.ServiceMeshExtensions(namespace).UpdateStatus(context.TODO(), extension, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// orderedCondition returns the Ordered condition for an extension that is part
+// of the given cycle, or is not part of any cycle if cycle is empty, and
+// declares the given ignored constraints
+func orderedCondition(cycle, ignored []string) v1alpha1.Condition {
+	if len(cycle) == 0 && len(ignored) == 0 {
+		return v1alpha1.Condition{
+			Type:   v1alpha1.ConditionTypeOrdered,
+			Status: corev1.ConditionTrue,
+			Reason: v1alpha1.ConditionReasonOrderResolved,
+		}
+	}
+	if len(cycle) == 0 {
+		return v1alpha1.Condition{
+			Type:   v1alpha1.ConditionTypeOrdered,
+			Status: corev1.ConditionFalse,
+			Reason: v1alpha1.ConditionReasonConstraintsIgnored,
+			Message: fmt.Sprintf("the constraints %s are ignored where one of the extensions is placed next to "+
+				"a native filter", strings.Join(ignored, ", ")),
+		}
+	}
+	return v1alpha1.Condition{
+		Type:   v1alpha1.ConditionTypeOrdered,
+		Status: corev1.ConditionFalse,
+		Reason: v1alpha1.ConditionReasonCycleDetected,
+		Message: fmt.Sprintf("before/after constraints form a cycle between %s; "+
+			"these extensions are ordered by priority", strings.Join(cycle, ", ")),
+	}
+}
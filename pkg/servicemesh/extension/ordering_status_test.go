@@ -0,0 +1,111 @@
+// Copyright Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extension
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ktesting "k8s.io/client-go/testing"
+
+	"istio.io/istio/pkg/servicemesh/apis/servicemesh/v1alpha1"
+	"istio.io/istio/pkg/servicemesh/client/v1alpha1/clientset/versioned/fake"
+)
+
+func TestOrderingReporter(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	client := clientset.ServicemeshV1alpha1()
+	extension := &v1alpha1.ServiceMeshExtension{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "test"},
+	}
+	if _, err := client.ServiceMeshExtensions("test").Create(context.TODO(), extension, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("failed to create extension: %v", err)
+	}
+	statusUpdates := 0
+	clientset.PrependReactor("update", "servicemeshextensions", func(action ktesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "status" {
+			return false, nil, nil
+		}
+		statusUpdates++
+		if statusUpdates == 1 {
+			// another writer updated the extension since it was read
+			return true, nil, apierrors.NewConflict(v1alpha1.SchemeGroupVersion.WithResource("servicemeshextensions").GroupResource(),
+				"test", fmt.Errorf("the object has been modified"))
+		}
+		return false, nil, nil
+	})
+
+	r := NewOrderingReporter(client)
+	r.Report([]*v1alpha1.ServiceMeshExtension{extension})
+	if statusUpdates != 0 {
+		t.Fatalf("expected no status updates while not leading but got %d", statusUpdates)
+	}
+
+	r.SetStatusWrite(true)
+	r.Report([]*v1alpha1.ServiceMeshExtension{extension})
+	updated, err := client.ServiceMeshExtensions("test").Get(context.TODO(), "test", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get extension: %v", err)
+	}
+	if statusUpdates != 2 {
+		t.Errorf("expected the conflicting status update to be retried but got %d updates", statusUpdates)
+	}
+	if len(updated.Status.Conditions) != 1 || updated.Status.Conditions[0].Type != v1alpha1.ConditionTypeOrdered ||
+		updated.Status.Conditions[0].Status != corev1.ConditionTrue {
+		t.Errorf("expected the Ordered condition to be set but got %v", updated.Status.Conditions)
+	}
+}
+
+func TestOrderedCondition(t *testing.T) {
+	cases := []struct {
+		name           string
+		cycle          []string
+		ignored        []string
+		expectedStatus corev1.ConditionStatus
+		expectedReason v1alpha1.ConditionReason
+	}{
+		{
+			name:           "resolved",
+			expectedStatus: corev1.ConditionTrue,
+			expectedReason: v1alpha1.ConditionReasonOrderResolved,
+		},
+		{
+			name:           "cycle",
+			cycle:          []string{"test/a", "test/b"},
+			ignored:        []string{"before test/c"},
+			expectedStatus: corev1.ConditionFalse,
+			expectedReason: v1alpha1.ConditionReasonCycleDetected,
+		},
+		{
+			name:           "ignored constraints",
+			ignored:        []string{"before test/c"},
+			expectedStatus: corev1.ConditionFalse,
+			expectedReason: v1alpha1.ConditionReasonConstraintsIgnored,
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			condition := orderedCondition(tt.cycle, tt.ignored)
+			if condition.Status != tt.expectedStatus || condition.Reason != tt.expectedReason {
+				t.Errorf("expected %s/%s but got %v", tt.expectedStatus, tt.expectedReason, condition)
+			}
+		})
+	}
+}
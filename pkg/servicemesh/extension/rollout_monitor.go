@@ -0,0 +1,170 @@
+// Copyright Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extension
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+
+	"istio.io/istio/pilot/pkg/model"
+	v1alpha1client "istio.io/istio/pkg/servicemesh/client/v1alpha1/clientset/versioned/typed/servicemesh/v1alpha1"
+	maistramodel "istio.io/istio/pkg/servicemesh/model"
+	"istio.io/pkg/log"
+)
+
+// rolloutFlushInterval is the interval at which recorded failures are written
+// to the status of the extensions
+const rolloutFlushInterval = 5 * time.Second
+
+// RolloutMonitor rolls back the rollout of an extension once proxies running
+// the new module reported more WebAssembly failures than the rollout's
+// failure threshold allows.
+// Every istiod replica adds the failures reported by the proxies connected to
+// it to the failure count in the status of the extension, so that the count
+// covers all proxies.
+type RolloutMonitor struct {
+	client v1alpha1client.ServicemeshV1alpha1Interface
+
+	mu sync.Mutex
+	// pending holds the failures that have not been written yet, by revision
+	pending map[rolloutRevision]int
+}
+
+// rolloutRevision identifies the module of an extension that is rolled out
+type rolloutRevision struct {
+	namespace string
+	name      string
+	sha256    string
+}
+
+func NewRolloutMonitor(client v1alpha1client.ServicemeshV1alpha1Interface) *RolloutMonitor {
+	return &RolloutMonitor{
+		client:  client,
+		pending: map[rolloutRevision]int{},
+	}
+}
+
+// Run writes the recorded failures until stop is closed.
+func (m *RolloutMonitor) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(rolloutFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			m.flush()
+		}
+	}
+}
+
+// ReportFailures attributes failures reported by a proxy to the extensions
+// whose rollout the proxy is part of. A failure counter is attributed to the
+// extension whose filter name it contains or, if it names none of them, to the
+// only extension the proxy is rolling out. Failures that cannot be attributed
+// to a single extension are not counted.
+func (m *RolloutMonitor) ReportFailures(proxy *model.Proxy, push *model.PushContext, failures map[string]uint64) {
+	if len(failures) == 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var rollouts []*maistramodel.ExtensionWrapper
+	for _, extensions := range push.Extensions(proxy) {
+		for _, ext := range extensions {
+			// proxies that are not part of a rollout get the previous
+			// deployment, which does not carry rollout information
+			if ext.Rollout == nil || ext.Rollout.RolledBack || ext.Rollout.FailureThreshold <= 0 {
+				continue
+			}
+			rollouts = append(rollouts, ext)
+		}
+	}
+	if len(rollouts) == 0 {
+		return
+	}
+	for counter, count := range failures {
+		ext := attributeFailures(counter, rollouts)
+		if ext == nil {
+			log.Debugf("cannot attribute %d WebAssembly failures of %s counted by %q to one of %d rollouts",
+				count, proxy.ID, counter, len(rollouts))
+			continue
+		}
+		m.pending[rolloutRevision{namespace: ext.Namespace, name: ext.Name, sha256: ext.SHA256}] += int(count)
+	}
+}
+
+// attributeFailures returns the extension that the failures counted by the
+// given Envoy counter belong to, or nil if they cannot be attributed
+func attributeFailures(counter string, rollouts []*maistramodel.ExtensionWrapper) *maistramodel.ExtensionWrapper {
+	var match *maistramodel.ExtensionWrapper
+	for _, ext := range rollouts {
+		name := ExtensionConfigName(ext)
+		// the longest name wins if the name of one extension contains another
+		if strings.Contains(counter, name) && (match == nil || len(name) > len(ExtensionConfigName(match))) {
+			match = ext
+		}
+	}
+	if match == nil && len(rollouts) == 1 {
+		return rollouts[0]
+	}
+	return match
+}
+
+// flush writes the pending failures to the status of the extensions
+func (m *RolloutMonitor) flush() {
+	m.mu.Lock()
+	pending := m.pending
+	m.pending = map[rolloutRevision]int{}
+	m.mu.Unlock()
+	for revision, failures := range pending {
+		if err := m.recordFailures(revision, failures); err != nil {
+			log.Errorf("failed to record WebAssembly failures of extension %s/%s: %v", revision.namespace, revision.name, err)
+		}
+	}
+}
+
+// recordFailures adds the failures to the failure count of the rollout. The
+// count is updated on the latest version of the extension, as other replicas
+// add their failures concurrently.
+func (m *RolloutMonitor) recordFailures(revision rolloutRevision, failures int) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		extension, err := m.client.ServiceMeshExtensions(revision.namespace).Get(context.TODO(), revision.name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		rollout := extension.Status.Rollout
+		// the failures were reported for a module that is no longer being rolled out
+		if extension.Status.Deployment.SHA256 != revision.sha256 || rollout == nil || rollout.RolledBack {
+			return nil
+		}
+		rollout.Failures += failures
+		threshold := 0
+		if extension.Spec.Rollout != nil {
+			threshold = extension.Spec.Rollout.FailureThreshold
+		}
+		if threshold > 0 && rollout.Failures >= threshold {
+			log.Warnf("Rolling back extension %s/%s after %d WebAssembly failures", revision.namespace, revision.name, rollout.Failures)
+			rollout.RolledBack = true
+		}
+		_, err = m.client.ServiceMeshExtensions(revision.namespace).UpdateStatus(context.TODO(), extension, metav1.UpdateOptions{})
+		return err
+	})
+}
@@ -0,0 +1,129 @@
+// Copyright Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package extension
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"istio.io/istio/pkg/servicemesh/apis/servicemesh/v1alpha1"
+	"istio.io/istio/pkg/servicemesh/client/v1alpha1/clientset/versioned/fake"
+	maistramodel "istio.io/istio/pkg/servicemesh/model"
+)
+
+func TestAttributeFailures(t *testing.T) {
+	auth := &maistramodel.ExtensionWrapper{Namespace: "test", Name: "auth"}
+	authz := &maistramodel.ExtensionWrapper{Namespace: "test", Name: "authz"}
+
+	testCases := []struct {
+		name     string
+		counter  string
+		rollouts []*maistramodel.ExtensionWrapper
+		expected *maistramodel.ExtensionWrapper
+	}{
+		{
+			name:     "named counter",
+			counter:  "wasm.test.auth.crashed",
+			rollouts: []*maistramodel.ExtensionWrapper{auth, authz},
+			expected: auth,
+		},
+		{
+			name:     "longest name wins",
+			counter:  "wasm.test.authz.crashed",
+			rollouts: []*maistramodel.ExtensionWrapper{auth, authz},
+			expected: authz,
+		},
+		{
+			name:     "single rollout",
+			counter:  "wasm.remote_load_fetch_failures",
+			rollouts: []*maistramodel.ExtensionWrapper{auth},
+			expected: auth,
+		},
+		{
+			name:     "ambiguous counter",
+			counter:  "wasm.remote_load_fetch_failures",
+			rollouts: []*maistramodel.ExtensionWrapper{auth, authz},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := attributeFailures(tc.counter, tc.rollouts); got != tc.expected {
+				t.Errorf("expected %v but got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestRolloutMonitorFlush(t *testing.T) {
+	client := fake.NewSimpleClientset().ServicemeshV1alpha1()
+	threshold := 5
+	for _, name := range []string{"auth", "authz"} {
+		_, err := client.ServiceMeshExtensions("test").Create(context.TODO(), &v1alpha1.ServiceMeshExtension{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "test"},
+			Spec: v1alpha1.ServiceMeshExtensionSpec{
+				Rollout: &v1alpha1.RolloutStrategy{FailureThreshold: threshold},
+			},
+			Status: v1alpha1.ServiceMeshExtensionStatus{
+				Deployment: v1alpha1.DeploymentStatus{SHA256: "new"},
+				Rollout: &v1alpha1.RolloutStatus{
+					Previous: &v1alpha1.DeploymentStatus{SHA256: "old"},
+				},
+			},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			t.Fatalf("failed to create extension: %v", err)
+		}
+	}
+
+	m := NewRolloutMonitor(client)
+	m.pending[rolloutRevision{namespace: "test", name: "auth", sha256: "new"}] = 2
+	m.pending[rolloutRevision{namespace: "test", name: "authz", sha256: "new"}] = 5
+	// failures of a module that is no longer rolled out are ignored
+	m.pending[rolloutRevision{namespace: "test", name: "auth", sha256: "superseded"}] = 10
+	m.flush()
+
+	for name, expected := range map[string]v1alpha1.RolloutStatus{
+		"auth":  {Failures: 2},
+		"authz": {Failures: 5, RolledBack: true},
+	} {
+		extension, err := client.ServiceMeshExtensions("test").Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("failed to get extension: %v", err)
+		}
+		rollout := extension.Status.Rollout
+		if rollout.Failures != expected.Failures || rollout.RolledBack != expected.RolledBack {
+			t.Errorf("%s: expected %d failures and rolled back %t but got %d and %t",
+				name, expected.Failures, expected.RolledBack, rollout.Failures, rollout.RolledBack)
+		}
+	}
+	if len(m.pending) != 0 {
+		t.Errorf("expected no pending failures after flush but got %v", m.pending)
+	}
+
+	// the failures reported to every replica add up
+	for _, replica := range []*RolloutMonitor{NewRolloutMonitor(client), NewRolloutMonitor(client)} {
+		replica.pending[rolloutRevision{namespace: "test", name: "auth", sha256: "new"}] = 2
+		replica.flush()
+	}
+	extension, err := client.ServiceMeshExtensions("test").Get(context.TODO(), "auth", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get extension: %v", err)
+	}
+	if rollout := extension.Status.Rollout; rollout.Failures != 6 || !rollout.RolledBack {
+		t.Errorf("expected the failures of all replicas to roll back the extension but got %d failures", rollout.Failures)
+	}
+}
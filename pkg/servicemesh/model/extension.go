@@ -15,13 +15,25 @@
 package model
 
 import (
+	"reflect"
+	"strings"
+
+	"istio.io/istio/pkg/config"
 	"istio.io/istio/pkg/config/labels"
 	"istio.io/istio/pkg/servicemesh/apis/servicemesh/v1alpha1"
 )
 
+// ServiceMeshExtensionKind identifies ServiceMeshExtensions in push requests
+var ServiceMeshExtensionKind = config.GroupVersionKind{
+	Group:   v1alpha1.SchemeGroupVersion.Group,
+	Version: v1alpha1.SchemeGroupVersion.Version,
+	Kind:    "ServiceMeshExtension",
+}
+
 // ExtensionWrapper is a wrapper around extensions
 type ExtensionWrapper struct {
 	Name             string
+	Namespace        string
 	WorkloadSelector labels.Instance
 	Config           string
 	Image            string
@@ -29,11 +41,21 @@ type ExtensionWrapper struct {
 	SHA256           string
 	Phase            v1alpha1.FilterPhase
 	Priority         int
+	// Before and After hold the keys of the extensions this extension must run before or after
+	Before []string
+	After  []string
+	// BeforeFilters and AfterFilters hold the names of the native Envoy filters
+	// this extension must run before or after
+	BeforeFilters []string
+	AfterFilters  []string
+	// Rollout is set while a staged rollout of a new image is in progress
+	Rollout *RolloutWrapper
 }
 
 func ToWrapper(extension *v1alpha1.ServiceMeshExtension) *ExtensionWrapper {
-	return &ExtensionWrapper{
+	wrapper := &ExtensionWrapper{
 		Name:             extension.Name,
+		Namespace:        extension.Namespace,
 		WorkloadSelector: extension.Spec.WorkloadSelector.Labels,
 		Config:           extension.Spec.Config,
 		Image:            extension.Spec.Image,
@@ -42,4 +64,77 @@ func ToWrapper(extension *v1alpha1.ServiceMeshExtension) *ExtensionWrapper {
 		Phase:            extension.Status.Phase,
 		Priority:         extension.Status.Priority,
 	}
+	wrapper.Before, wrapper.BeforeFilters = resolveReferences(extension.Namespace, extension.Spec.Before)
+	wrapper.After, wrapper.AfterFilters = resolveReferences(extension.Namespace, extension.Spec.After)
+	if RolloutInProgress(extension) {
+		previous := *wrapper
+		previous.FilterURL = extension.Status.Rollout.Previous.URL
+		previous.SHA256 = extension.Status.Rollout.Previous.SHA256
+		wrapper.Rollout = &RolloutWrapper{
+			Previous:   &previous,
+			RolledBack: extension.Status.Rollout.RolledBack,
+		}
+		if rollout := extension.Spec.Rollout; rollout != nil {
+			wrapper.Rollout.CanarySelector = rollout.CanarySelector
+			wrapper.Rollout.FailureThreshold = rollout.FailureThreshold
+			if rollout.Percentage != nil {
+				wrapper.Rollout.Percentage = *rollout.Percentage
+			}
+		}
+	}
+	return wrapper
+}
+
+// Key returns the namespace/name of the extension
+func (w *ExtensionWrapper) Key() string {
+	return ExtensionKey(w.Namespace, w.Name)
+}
+
+// ExtensionKey returns the key identifying the extension with the given namespace and name
+func ExtensionKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+// resolveReferences splits ordering references into the keys of the extensions
+// and the names of the native filters they refer to
+func resolveReferences(namespace string, refs []v1alpha1.OrderingReference) (extensions, filters []string) {
+	for _, ref := range refs {
+		if ref.Extension != "" {
+			if strings.Contains(ref.Extension, "/") {
+				extensions = append(extensions, ref.Extension)
+			} else {
+				extensions = append(extensions, ExtensionKey(namespace, ref.Extension))
+			}
+		}
+		if ref.Filter != "" {
+			filters = append(filters, ref.Filter)
+		}
+	}
+	return extensions, filters
+}
+
+// ConfigChanged returns whether an update of an extension changed the
+// configuration pushed to proxies. Conditions and the number of proxies that
+// applied the module only inform users.
+func ConfigChanged(old, cur *v1alpha1.ServiceMeshExtension) bool {
+	if old.Generation != cur.Generation {
+		return true
+	}
+	oldStatus, curStatus := old.Status.DeepCopy(), cur.Status.DeepCopy()
+	oldStatus.Conditions, curStatus.Conditions = nil, nil
+	oldStatus.AckedProxies, curStatus.AckedProxies = 0, 0
+	return !reflect.DeepEqual(oldStatus, curStatus)
+}
+
+// FilterChainChanged returns whether an update of an extension changed where
+// its filter is placed in the filter chains of proxies. Changes that only
+// affect the module or its configuration do not require new listeners when
+// extensions are delivered over ECDS.
+func FilterChainChanged(old, cur *v1alpha1.ServiceMeshExtension) bool {
+	return old.Status.Deployment.Ready != cur.Status.Deployment.Ready ||
+		old.Status.Phase != cur.Status.Phase ||
+		old.Status.Priority != cur.Status.Priority ||
+		!reflect.DeepEqual(old.Spec.WorkloadSelector, cur.Spec.WorkloadSelector) ||
+		!reflect.DeepEqual(old.Spec.Before, cur.Spec.Before) ||
+		!reflect.DeepEqual(old.Spec.After, cur.Spec.After)
 }
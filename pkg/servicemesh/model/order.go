@@ -0,0 +1,220 @@
+// Copyright Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"sort"
+
+	"istio.io/istio/pkg/servicemesh/apis/servicemesh/v1alpha1"
+)
+
+// OrderExtensions orders the extensions of a single phase. Extensions are
+// ranked by priority, highest first, and then by namespace and name. The
+// ranking is adjusted as little as possible to satisfy the before/after
+// constraints between the extensions. Constraints that form a cycle are not
+// satisfiable; the extensions on the cycle are ordered by rank.
+func OrderExtensions(extensions []*ExtensionWrapper) []*ExtensionWrapper {
+	ranked := make([]*ExtensionWrapper, len(extensions))
+	copy(ranked, extensions)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].Priority != ranked[j].Priority {
+			return ranked[i].Priority > ranked[j].Priority
+		}
+		return ranked[i].Key() < ranked[j].Key()
+	})
+
+	graph := newOrderingGraph(ranked)
+	inDegree := make(map[string]int, len(ranked))
+	for _, successors := range graph {
+		for _, key := range successors {
+			inDegree[key]++
+		}
+	}
+
+	ordered := make([]*ExtensionWrapper, 0, len(ranked))
+	done := make(map[string]bool, len(ranked))
+	for len(ordered) < len(ranked) {
+		var next *ExtensionWrapper
+		for _, ext := range ranked {
+			if !done[ext.Key()] && inDegree[ext.Key()] == 0 {
+				next = ext
+				break
+			}
+		}
+		if next == nil {
+			// all remaining extensions are on or behind a cycle, break it at the highest ranked one
+			for _, ext := range ranked {
+				if !done[ext.Key()] {
+					next = ext
+					break
+				}
+			}
+		}
+		done[next.Key()] = true
+		ordered = append(ordered, next)
+		for _, key := range graph[next.Key()] {
+			inDegree[key]--
+		}
+	}
+	return ordered
+}
+
+// FindOrderingCycles returns the keys of the extensions whose before/after
+// constraints form cycles, one slice per cycle. Only constraints between
+// extensions in the same phase are considered.
+func FindOrderingCycles(extensions []*ExtensionWrapper) [][]string {
+	byPhase := map[v1alpha1.FilterPhase][]*ExtensionWrapper{}
+	for _, ext := range extensions {
+		byPhase[ext.Phase] = append(byPhase[ext.Phase], ext)
+	}
+	phases := make([]string, 0, len(byPhase))
+	for phase := range byPhase {
+		phases = append(phases, string(phase))
+	}
+	sort.Strings(phases)
+
+	var cycles [][]string
+	for _, phase := range phases {
+		graph := newOrderingGraph(byPhase[v1alpha1.FilterPhase(phase)])
+		for _, component := range stronglyConnectedComponents(graph) {
+			if len(component) > 1 || containsString(graph[component[0]], component[0]) {
+				sort.Strings(component)
+				cycles = append(cycles, component)
+			}
+		}
+	}
+	return cycles
+}
+
+// FindIgnoredConstraints returns the before/after constraints between
+// extensions that are ignored because one of the two extensions is pinned to
+// a native filter, by the key of the extension that declares them. Pinned
+// extensions are placed next to the native filter wherever it is part of the
+// filter chain, regardless of the other extensions of their phase.
+func FindIgnoredConstraints(extensions []*ExtensionWrapper) map[string][]string {
+	pinned := map[string]bool{}
+	for _, ext := range extensions {
+		if len(ext.BeforeFilters) > 0 || len(ext.AfterFilters) > 0 {
+			pinned[ext.Key()] = true
+		}
+	}
+	ignored := map[string][]string{}
+	for _, ext := range extensions {
+		for _, key := range ext.Before {
+			if pinned[ext.Key()] || pinned[key] {
+				ignored[ext.Key()] = append(ignored[ext.Key()], "before "+key)
+			}
+		}
+		for _, key := range ext.After {
+			if pinned[ext.Key()] || pinned[key] {
+				ignored[ext.Key()] = append(ignored[ext.Key()], "after "+key)
+			}
+		}
+	}
+	return ignored
+}
+
+// newOrderingGraph returns the edges between the given extensions. An edge
+// from a to b means that a must run before b.
+func newOrderingGraph(extensions []*ExtensionWrapper) map[string][]string {
+	present := make(map[string]bool, len(extensions))
+	for _, ext := range extensions {
+		present[ext.Key()] = true
+	}
+	graph := make(map[string][]string, len(extensions))
+	addEdge := func(from, to string) {
+		if present[from] && present[to] && !containsString(graph[from], to) {
+			graph[from] = append(graph[from], to)
+		}
+	}
+	for _, ext := range extensions {
+		if _, ok := graph[ext.Key()]; !ok {
+			graph[ext.Key()] = nil
+		}
+		for _, before := range ext.Before {
+			addEdge(ext.Key(), before)
+		}
+		for _, after := range ext.After {
+			addEdge(after, ext.Key())
+		}
+	}
+	return graph
+}
+
+// stronglyConnectedComponents implements Tarjan's algorithm
+func stronglyConnectedComponents(graph map[string][]string) [][]string {
+	nodes := make([]string, 0, len(graph))
+	for node := range graph {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+
+	index := 0
+	indices := map[string]int{}
+	lowLinks := map[string]int{}
+	onStack := map[string]bool{}
+	var stack []string
+	var components [][]string
+
+	var visit func(node string)
+	visit = func(node string) {
+		indices[node] = index
+		lowLinks[node] = index
+		index++
+		stack = append(stack, node)
+		onStack[node] = true
+
+		for _, successor := range graph[node] {
+			if _, visited := indices[successor]; !visited {
+				visit(successor)
+				if lowLinks[successor] < lowLinks[node] {
+					lowLinks[node] = lowLinks[successor]
+				}
+			} else if onStack[successor] && indices[successor] < lowLinks[node] {
+				lowLinks[node] = indices[successor]
+			}
+		}
+
+		if lowLinks[node] == indices[node] {
+			var component []string
+			for {
+				last := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[last] = false
+				component = append(component, last)
+				if last == node {
+					break
+				}
+			}
+			components = append(components, component)
+		}
+	}
+
+	for _, node := range nodes {
+		if _, visited := indices[node]; !visited {
+			visit(node)
+		}
+	}
+	return components
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
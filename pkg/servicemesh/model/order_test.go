@@ -0,0 +1,204 @@
+// Copyright Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"istio.io/istio/pkg/servicemesh/apis/servicemesh/v1alpha1"
+)
+
+func orderingExtension(namespace, name string, priority int, before, after []string) *ExtensionWrapper {
+	return &ExtensionWrapper{
+		Name:      name,
+		Namespace: namespace,
+		Phase:     v1alpha1.FilterPhasePostAuthN,
+		Priority:  priority,
+		Before:    before,
+		After:     after,
+	}
+}
+
+func TestOrderExtensions(t *testing.T) {
+	ext := orderingExtension
+	inPhase := func(ext *ExtensionWrapper, phase v1alpha1.FilterPhase) *ExtensionWrapper {
+		ext.Phase = phase
+		return ext
+	}
+
+	cases := []struct {
+		name           string
+		extensions     []*ExtensionWrapper
+		expectedOrder  []string
+		expectedCycles [][]string
+	}{
+		{
+			name: "ordered by priority and name",
+			extensions: []*ExtensionWrapper{
+				ext("test-ns", "c", 10, nil, nil),
+				ext("test-ns", "b", 20, nil, nil),
+				ext("test-ns", "a", 10, nil, nil),
+			},
+			expectedOrder: []string{"test-ns/b", "test-ns/a", "test-ns/c"},
+		},
+		{
+			name: "before overrides priority",
+			extensions: []*ExtensionWrapper{
+				ext("test-ns", "a", 20, nil, nil),
+				ext("test-ns", "b", 10, []string{"test-ns/a"}, nil),
+				ext("test-ns", "c", 5, nil, nil),
+			},
+			expectedOrder: []string{"test-ns/b", "test-ns/a", "test-ns/c"},
+		},
+		{
+			name: "after overrides priority across namespaces",
+			extensions: []*ExtensionWrapper{
+				ext("test-ns", "a", 20, nil, []string{"istio-system/b"}),
+				ext("istio-system", "b", 10, nil, nil),
+			},
+			expectedOrder: []string{"istio-system/b", "test-ns/a"},
+		},
+		{
+			name: "chained constraints",
+			extensions: []*ExtensionWrapper{
+				ext("test-ns", "a", 30, nil, []string{"test-ns/b"}),
+				ext("test-ns", "b", 20, nil, []string{"test-ns/c"}),
+				ext("test-ns", "c", 10, nil, nil),
+			},
+			expectedOrder: []string{"test-ns/c", "test-ns/b", "test-ns/a"},
+		},
+		{
+			name: "references to missing extensions are ignored",
+			extensions: []*ExtensionWrapper{
+				ext("test-ns", "a", 20, nil, []string{"test-ns/missing"}),
+				ext("test-ns", "b", 10, nil, nil),
+			},
+			expectedOrder: []string{"test-ns/a", "test-ns/b"},
+		},
+		{
+			name: "cycle falls back to priority",
+			extensions: []*ExtensionWrapper{
+				ext("test-ns", "a", 10, []string{"test-ns/b"}, nil),
+				ext("test-ns", "b", 20, []string{"test-ns/a"}, nil),
+				ext("test-ns", "c", 5, nil, []string{"test-ns/a"}),
+			},
+			expectedOrder:  []string{"test-ns/b", "test-ns/a", "test-ns/c"},
+			expectedCycles: [][]string{{"test-ns/a", "test-ns/b"}},
+		},
+		{
+			name: "cycle of three extensions",
+			extensions: []*ExtensionWrapper{
+				ext("test-ns", "a", 30, []string{"test-ns/b"}, nil),
+				ext("test-ns", "b", 20, []string{"test-ns/c"}, nil),
+				ext("test-ns", "c", 10, []string{"test-ns/a"}, nil),
+			},
+			expectedOrder:  []string{"test-ns/a", "test-ns/b", "test-ns/c"},
+			expectedCycles: [][]string{{"test-ns/a", "test-ns/b", "test-ns/c"}},
+		},
+		{
+			name: "extension referencing itself",
+			extensions: []*ExtensionWrapper{
+				ext("test-ns", "a", 10, []string{"test-ns/a"}, nil),
+				ext("test-ns", "b", 20, nil, nil),
+			},
+			expectedOrder:  []string{"test-ns/b", "test-ns/a"},
+			expectedCycles: [][]string{{"test-ns/a"}},
+		},
+		{
+			name: "constraints across phases do not form cycles",
+			extensions: []*ExtensionWrapper{
+				ext("test-ns", "a", 10, []string{"test-ns/b"}, nil),
+				inPhase(ext("test-ns", "b", 20, []string{"test-ns/a"}, nil), v1alpha1.FilterPhasePreAuthZ),
+			},
+			expectedOrder: []string{"test-ns/b", "test-ns/a"},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			order := []string{}
+			for _, ext := range OrderExtensions(tt.extensions) {
+				order = append(order, ext.Key())
+			}
+			if !cmp.Equal(order, tt.expectedOrder) {
+				t.Errorf("unexpected order, +got -want: %s", cmp.Diff(order, tt.expectedOrder))
+			}
+			cycles := FindOrderingCycles(tt.extensions)
+			if !cmp.Equal(cycles, tt.expectedCycles) {
+				t.Errorf("unexpected cycles, +got -want: %s", cmp.Diff(cycles, tt.expectedCycles))
+			}
+		})
+	}
+}
+
+func TestFindIgnoredConstraints(t *testing.T) {
+	pinned := func(ext *ExtensionWrapper, beforeFilters, afterFilters []string) *ExtensionWrapper {
+		ext.BeforeFilters = beforeFilters
+		ext.AfterFilters = afterFilters
+		return ext
+	}
+
+	cases := []struct {
+		name       string
+		extensions []*ExtensionWrapper
+		expected   map[string][]string
+	}{
+		{
+			name: "no pinned extension",
+			extensions: []*ExtensionWrapper{
+				orderingExtension("test-ns", "a", 10, []string{"test-ns/b"}, nil),
+				orderingExtension("test-ns", "b", 20, nil, nil),
+			},
+			expected: map[string][]string{},
+		},
+		{
+			name: "pinned extension without constraints on extensions",
+			extensions: []*ExtensionWrapper{
+				pinned(orderingExtension("test-ns", "a", 10, nil, nil), []string{"envoy.filters.http.cors"}, nil),
+				orderingExtension("test-ns", "b", 20, nil, nil),
+			},
+			expected: map[string][]string{},
+		},
+		{
+			name: "pinned extension with conflicting before and after",
+			extensions: []*ExtensionWrapper{
+				pinned(orderingExtension("test-ns", "a", 10, []string{"test-ns/b"}, []string{"test-ns/c"}),
+					nil, []string{"envoy.filters.http.cors"}),
+				orderingExtension("test-ns", "b", 20, nil, nil),
+				orderingExtension("test-ns", "c", 30, nil, nil),
+			},
+			expected: map[string][]string{"test-ns/a": {"before test-ns/b", "after test-ns/c"}},
+		},
+		{
+			name: "constraint on a pinned extension",
+			extensions: []*ExtensionWrapper{
+				pinned(orderingExtension("test-ns", "a", 10, nil, nil), []string{"envoy.filters.http.cors"}, nil),
+				orderingExtension("test-ns", "b", 20, nil, []string{"test-ns/a"}),
+			},
+			expected: map[string][]string{"test-ns/b": {"after test-ns/a"}},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			ignored := FindIgnoredConstraints(tt.extensions)
+			if !cmp.Equal(ignored, tt.expected) {
+				t.Errorf("unexpected ignored constraints, +got -want: %s", cmp.Diff(ignored, tt.expected))
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright Red Hat, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"hash/fnv"
+
+	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/any"
+	structpb "github.com/golang/protobuf/ptypes/struct"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	google_rpc "google.golang.org/genproto/googleapis/rpc/status"
+
+	"istio.io/istio/pkg/config/labels"
+	"istio.io/istio/pkg/servicemesh/apis/servicemesh/v1alpha1"
+)
+
+// WasmHealthTypeURL is the type URL of the requests the agent uses to report
+// WebAssembly failures observed in Envoy. The number of new failures is sent
+// as a UInt64Value in the details of the request's ErrorDetail.
+const WasmHealthTypeURL = "type.googleapis.com/maistra.v1.WasmHealth"
+
+// RolloutWrapper holds the state of a staged rollout of an extension
+type RolloutWrapper struct {
+	// Previous is the extension as it was deployed before the rollout started
+	Previous         *ExtensionWrapper
+	Percentage       int
+	CanarySelector   labels.Instance
+	FailureThreshold int
+	RolledBack       bool
+}
+
+// RolloutInProgress returns true if some workloads must still be served the
+// deployment that was active before the extension's image changed
+func RolloutInProgress(extension *v1alpha1.ServiceMeshExtension) bool {
+	status := extension.Status.Rollout
+	if status == nil || status.Previous == nil || status.Previous.URL == "" {
+		return false
+	}
+	if status.RolledBack {
+		return true
+	}
+	rollout := extension.Spec.Rollout
+	return rollout != nil && (rollout.Percentage == nil || *rollout.Percentage < 100)
+}
+
+// ForProxy returns the deployment of the extension that applies to the given proxy.
+// This is either the extension itself or, while a rollout is in progress and the
+// proxy is not part of it, the previous deployment.
+func (w *ExtensionWrapper) ForProxy(proxyID string, workloadLabels labels.Instance) *ExtensionWrapper {
+	if w.Rollout == nil {
+		return w
+	}
+	if w.Rollout.RolledBack {
+		return w.Rollout.Previous
+	}
+	if len(w.Rollout.CanarySelector) > 0 && w.Rollout.CanarySelector.SubsetOf(workloadLabels) {
+		return w
+	}
+	if rolloutBucket(w.Key(), proxyID) < w.Rollout.Percentage {
+		return w
+	}
+	return w.Rollout.Previous
+}
+
+// rolloutBucket deterministically assigns a proxy to one of 100 buckets.
+// The extension is part of the key so that the same proxies are not always
+// the first to receive every new extension.
+func rolloutBucket(extension, proxyID string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(extension))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(proxyID))
+	return int(h.Sum32() % 100)
+}
+
+// NewWasmHealthRequest creates the request the agent sends to report new
+// WebAssembly failures, by the name of the Envoy counter that counted them
+func NewWasmHealthRequest(failures map[string]uint64) (*discovery.DiscoveryRequest, error) {
+	var total uint64
+	counters := &structpb.Struct{Fields: map[string]*structpb.Value{}}
+	for name, count := range failures {
+		total += count
+		counters.Fields[name] = &structpb.Value{Kind: &structpb.Value_NumberValue{NumberValue: float64(count)}}
+	}
+	// the total is kept for istiod versions that do not read the counters
+	totalAny, err := ptypes.MarshalAny(&wrappers.UInt64Value{Value: total})
+	if err != nil {
+		return nil, err
+	}
+	countersAny, err := ptypes.MarshalAny(counters)
+	if err != nil {
+		return nil, err
+	}
+	return &discovery.DiscoveryRequest{
+		TypeUrl: WasmHealthTypeURL,
+		ErrorDetail: &google_rpc.Status{
+			Code:    500,
+			Message: fmt.Sprintf("%d WebAssembly failures", total),
+			Details: []*any.Any{totalAny, countersAny},
+		},
+	}, nil
+}
+
+// WasmFailures returns the failures reported in a WebAssembly health request,
+// by the name of the Envoy counter that counted them. Failures reported
+// without counter names are returned under the empty name.
+func WasmFailures(req *discovery.DiscoveryRequest) map[string]uint64 {
+	if req.ErrorDetail == nil {
+		return nil
+	}
+	var total *wrappers.UInt64Value
+	for _, detail := range req.ErrorDetail.Details {
+		counters := &structpb.Struct{}
+		if ptypes.Is(detail, counters) && ptypes.UnmarshalAny(detail, counters) == nil {
+			failures := map[string]uint64{}
+			for name, value := range counters.Fields {
+				if count := uint64(value.GetNumberValue()); count > 0 {
+					failures[name] = count
+				}
+			}
+			return failures
+		}
+		count := &wrappers.UInt64Value{}
+		if ptypes.Is(detail, count) && ptypes.UnmarshalAny(detail, count) == nil {
+			total = count
+		}
+	}
+	if total != nil {
+		return map[string]uint64{"": total.Value}
+	}
+	// the request does not say how many failures occurred, but at least one did
+	return map[string]uint64{"": 1}
+}
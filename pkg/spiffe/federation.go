@@ -0,0 +1,449 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spiffe
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+var (
+	// minBundleRefreshInterval bounds how often a trust bundle is fetched, regardless of its refresh hint.
+	minBundleRefreshInterval = 10 * time.Second
+	// maxBundleRefreshInterval bounds how long a trust bundle is used before it is fetched again.
+	maxBundleRefreshInterval = 24 * time.Hour
+)
+
+// TrustBundle holds the X.509 authorities of a SPIFFE trust domain.
+type TrustBundle struct {
+	TrustDomain string
+	Certs       []*x509.Certificate
+	// RefreshHint is how often the source of the bundle suggests to check it for updates, zero if unset.
+	RefreshHint time.Duration
+	// Sequence is the sequence number of the bundle document, zero if unset.
+	Sequence uint64
+	// CRLs are the DER encoded certificate revocation lists of the trust domain. They can only be
+	// provided along with PEM encoded certificates.
+	CRLs [][]byte
+}
+
+// PEM returns the PEM encoded certificates of the bundle.
+func (b *TrustBundle) PEM() []byte {
+	var out []byte
+	for _, cert := range b.Certs {
+		out = append(out, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	return out
+}
+
+// CRLPEM returns the PEM encoded certificate revocation lists of the bundle.
+func (b *TrustBundle) CRLPEM() []byte {
+	var out []byte
+	for _, crl := range b.CRLs {
+		out = append(out, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: crl})...)
+	}
+	return out
+}
+
+func (b *TrustBundle) sameCerts(other *TrustBundle) bool {
+	if len(b.Certs) != len(other.Certs) || len(b.CRLs) != len(other.CRLs) {
+		return false
+	}
+	for i := range b.Certs {
+		if !b.Certs[i].Equal(other.Certs[i]) {
+			return false
+		}
+	}
+	for i := range b.CRLs {
+		if !bytes.Equal(b.CRLs[i], other.CRLs[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseTrustBundle parses the trust bundle of a trust domain, either from a SPIFFE bundle document
+// or from PEM encoded certificates.
+func ParseTrustBundle(trustDomain string, data []byte) (*TrustBundle, error) {
+	return parseTrustBundle(trustDomain, "inline bundle", data)
+}
+
+func parseTrustBundle(trustDomain, source string, data []byte) (*TrustBundle, error) {
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte("{")) {
+		return parseBundleDoc(trustDomain, source, data)
+	}
+
+	bundle := &TrustBundle{TrustDomain: trustDomain}
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type == "X509 CRL" {
+			if _, err := x509.ParseCRL(block.Bytes); err != nil {
+				return nil, fmt.Errorf("trust domain [%s] from [%s] failed to parse CRL: %v", trustDomain, source, err)
+			}
+			bundle.CRLs = append(bundle.CRLs, block.Bytes)
+			continue
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("trust domain [%s] from [%s] failed to parse certificate: %v", trustDomain, source, err)
+		}
+		bundle.Certs = append(bundle.Certs, cert)
+	}
+	if len(bundle.Certs) == 0 {
+		return nil, fmt.Errorf("trust domain [%s] from [%s] does not contain a SPIFFE bundle or PEM certificates", trustDomain, source)
+	}
+	return bundle, nil
+}
+
+// BundleSource describes where the trust bundle of a federated trust domain is read from.
+// Exactly one of Endpoint, File and Bundle is set.
+type BundleSource struct {
+	TrustDomain string
+	// Endpoint is the URL of a SPIFFE bundle endpoint using the https_web profile.
+	Endpoint string
+	// File is the path of a SPIFFE bundle document or of PEM encoded certificates.
+	File string
+	// Bundle is an inline SPIFFE bundle document or PEM encoded certificates.
+	Bundle []byte
+}
+
+func (s BundleSource) String() string {
+	switch {
+	case s.Endpoint != "":
+		return s.Endpoint
+	case s.File != "":
+		return s.File
+	default:
+		return "inline bundle"
+	}
+}
+
+func (s BundleSource) equal(other BundleSource) bool {
+	return s.TrustDomain == other.TrustDomain && s.Endpoint == other.Endpoint && s.File == other.File &&
+		bytes.Equal(s.Bundle, other.Bundle)
+}
+
+// ParseBundleEndpoints parses trust domain to SPIFFE bundle endpoint mappings in the format of
+// "foo|URL1||bar|URL2...".
+func ParseBundleEndpoints(inputString string) ([]BundleSource, error) {
+	config, err := parseTrustDomainTuples(inputString, "url")
+	if err != nil {
+		return nil, err
+	}
+	sources := make([]BundleSource, 0, len(config))
+	for trustDomain, endpoint := range config {
+		sources = append(sources, BundleSource{TrustDomain: trustDomain, Endpoint: normalizeBundleEndpoint(endpoint)})
+	}
+	return sources, nil
+}
+
+// ParseBundleFiles parses trust domain to bundle file mappings in the format of
+// "foo|path1||bar|path2...".
+func ParseBundleFiles(inputString string) ([]BundleSource, error) {
+	config, err := parseTrustDomainTuples(inputString, "file")
+	if err != nil {
+		return nil, err
+	}
+	sources := make([]BundleSource, 0, len(config))
+	for trustDomain, file := range config {
+		sources = append(sources, BundleSource{TrustDomain: trustDomain, File: file})
+	}
+	return sources, nil
+}
+
+// FederatedBundles keeps the trust bundles of federated trust domains up to date. Each bundle is
+// fetched again when the refresh hint of the bundle, or the default refresh interval, elapsed.
+// If fetching fails, the last known bundle is kept and the fetch is retried with a backoff.
+//
+// Sources are set per group, e.g. for each configuration mechanism, so that the groups can be
+// updated independently. If several groups configure the same trust domain, the source from the
+// group that sorts first is used.
+type FederatedBundles struct {
+	client          *http.Client
+	refreshInterval time.Duration
+	wakeup          chan struct{}
+
+	mu       sync.RWMutex
+	groups   map[string][]BundleSource
+	sources  map[string]BundleSource
+	bundles  map[string]*TrustBundle
+	next     map[string]time.Time
+	failures map[string]int
+	handlers []func()
+}
+
+// NewFederatedBundles returns a FederatedBundles that refreshes bundles without a refresh hint after
+// the given interval. Bundle endpoints are authenticated with the system cert pool and the supplied certificates.
+func NewFederatedBundles(refreshInterval time.Duration, extraTrustedCerts []*x509.Certificate) (*FederatedBundles, error) {
+	client, err := newBundleHTTPClient(extraTrustedCerts)
+	if err != nil {
+		return nil, err
+	}
+	return &FederatedBundles{
+		client:          client,
+		refreshInterval: refreshInterval,
+		wakeup:          make(chan struct{}, 1),
+		groups:          map[string][]BundleSource{},
+		sources:         map[string]BundleSource{},
+		bundles:         map[string]*TrustBundle{},
+		next:            map[string]time.Time{},
+		failures:        map[string]int{},
+	}, nil
+}
+
+// AddHandler registers a handler that is called whenever the trust bundle of a trust domain changed or was removed.
+func (f *FederatedBundles) AddHandler(handler func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.handlers = append(f.handlers, handler)
+}
+
+// SetSources replaces the sources of a group. Trust domains with a new or changed source are fetched
+// by the next Refresh, or right away by Run.
+func (f *FederatedBundles) SetSources(group string, sources []BundleSource) {
+	f.mu.Lock()
+	if len(sources) == 0 {
+		delete(f.groups, group)
+	} else {
+		f.groups[group] = sources
+	}
+
+	groups := make([]string, 0, len(f.groups))
+	for name := range f.groups {
+		groups = append(groups, name)
+	}
+	sort.Strings(groups)
+	effective := map[string]BundleSource{}
+	for _, name := range groups {
+		for _, source := range f.groups[name] {
+			if existing, ok := effective[source.TrustDomain]; ok {
+				spiffeLog.Warnf("ignoring SPIFFE bundle source %s of trust domain %s, already using %s",
+					source, source.TrustDomain, existing)
+				continue
+			}
+			effective[source.TrustDomain] = source
+		}
+	}
+
+	removed := false
+	for trustDomain := range f.sources {
+		if _, ok := effective[trustDomain]; ok {
+			continue
+		}
+		if _, ok := f.bundles[trustDomain]; ok {
+			spiffeLog.Infof("Removed SPIFFE trust bundle for: %v", trustDomain)
+			removed = true
+		}
+		delete(f.bundles, trustDomain)
+		delete(f.next, trustDomain)
+		delete(f.failures, trustDomain)
+	}
+	for trustDomain, source := range effective {
+		if existing, ok := f.sources[trustDomain]; !ok || !existing.equal(source) {
+			f.next[trustDomain] = time.Time{}
+			f.failures[trustDomain] = 0
+		}
+	}
+	f.sources = effective
+	handlers := f.handlers
+	f.mu.Unlock()
+
+	select {
+	case f.wakeup <- struct{}{}:
+	default:
+	}
+	if removed {
+		for _, h := range handlers {
+			h()
+		}
+	}
+}
+
+// Refresh fetches the trust bundles that are due. It returns the errors of the bundles that could not be fetched.
+func (f *FederatedBundles) Refresh() error {
+	return f.refreshDue(time.Now())
+}
+
+// Run refreshes the trust bundles whenever they are due, until the stop channel is closed.
+func (f *FederatedBundles) Run(stop <-chan struct{}) {
+	for {
+		if err := f.refreshDue(time.Now()); err != nil {
+			spiffeLog.Warnf("failed to refresh SPIFFE trust bundles: %v", err)
+		}
+		timer := time.NewTimer(f.untilNextRefresh(time.Now()))
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-f.wakeup:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+func (f *FederatedBundles) refreshDue(now time.Time) error {
+	f.mu.RLock()
+	var due []BundleSource
+	for trustDomain, source := range f.sources {
+		if !now.Before(f.next[trustDomain]) {
+			due = append(due, source)
+		}
+	}
+	f.mu.RUnlock()
+
+	var errs *multierror.Error
+	changed := false
+	for _, source := range due {
+		bundle, err := f.load(source)
+
+		f.mu.Lock()
+		if current, ok := f.sources[source.TrustDomain]; !ok || !current.equal(source) {
+			// The source was replaced while fetching, the new source is fetched next.
+			f.mu.Unlock()
+			continue
+		}
+		if err != nil {
+			f.failures[source.TrustDomain]++
+			f.next[source.TrustDomain] = now.Add(f.retryDelay(f.failures[source.TrustDomain]))
+			f.mu.Unlock()
+			errs = multierror.Append(errs, err)
+			continue
+		}
+		f.failures[source.TrustDomain] = 0
+		f.next[source.TrustDomain] = now.Add(f.refreshDelay(bundle))
+		if existing := f.bundles[source.TrustDomain]; existing == nil || !existing.sameCerts(bundle) {
+			spiffeLog.Infof("Loaded SPIFFE trust bundle for: %v from %s, containing %d certs (sequence %d)",
+				source.TrustDomain, source, len(bundle.Certs), bundle.Sequence)
+			changed = true
+		}
+		f.bundles[source.TrustDomain] = bundle
+		f.mu.Unlock()
+	}
+
+	if changed {
+		f.mu.RLock()
+		handlers := f.handlers
+		f.mu.RUnlock()
+		for _, h := range handlers {
+			h()
+		}
+	}
+	return errs.ErrorOrNil()
+}
+
+func (f *FederatedBundles) load(source BundleSource) (*TrustBundle, error) {
+	switch {
+	case source.Endpoint != "":
+		body, err := fetchBundle(f.client, source.Endpoint)
+		if err != nil {
+			return nil, err
+		}
+		return parseBundleDoc(source.TrustDomain, source.Endpoint, body)
+	case source.File != "":
+		data, err := ioutil.ReadFile(source.File)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read SPIFFE bundle of trust domain %s: %v", source.TrustDomain, err)
+		}
+		return parseTrustBundle(source.TrustDomain, source.File, data)
+	default:
+		return parseTrustBundle(source.TrustDomain, source.String(), source.Bundle)
+	}
+}
+
+// refreshDelay returns when a bundle is fetched again, honoring its refresh hint.
+func (f *FederatedBundles) refreshDelay(bundle *TrustBundle) time.Duration {
+	delay := f.refreshInterval
+	if bundle.RefreshHint > 0 {
+		delay = bundle.RefreshHint
+	}
+	if delay < minBundleRefreshInterval {
+		delay = minBundleRefreshInterval
+	}
+	if delay > maxBundleRefreshInterval {
+		delay = maxBundleRefreshInterval
+	}
+	return delay
+}
+
+// retryDelay returns when a bundle that failed to be fetched is retried, backing off exponentially
+// up to the refresh interval.
+func (f *FederatedBundles) retryDelay(failures int) time.Duration {
+	delay := minBundleRefreshInterval
+	for i := 1; i < failures && delay < f.refreshInterval; i++ {
+		delay *= 2
+	}
+	if delay > f.refreshInterval && f.refreshInterval > minBundleRefreshInterval {
+		delay = f.refreshInterval
+	}
+	return delay
+}
+
+func (f *FederatedBundles) untilNextRefresh(now time.Time) time.Duration {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	wait := maxBundleRefreshInterval
+	for trustDomain := range f.sources {
+		if d := f.next[trustDomain].Sub(now); d < wait {
+			wait = d
+		}
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return wait
+}
+
+// TrustDomains returns the sorted list of trust domains with a trust bundle.
+func (f *FederatedBundles) TrustDomains() []string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	out := make([]string, 0, len(f.bundles))
+	for trustDomain := range f.bundles {
+		out = append(out, trustDomain)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Bundle returns the trust bundle of a trust domain, or nil if it is not known.
+func (f *FederatedBundles) Bundle(trustDomain string) *TrustBundle {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.bundles[trustDomain]
+}
+
+// Bundles returns the certificates of all known trust bundles, by trust domain.
+func (f *FederatedBundles) Bundles() map[string][]*x509.Certificate {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	out := make(map[string][]*x509.Certificate, len(f.bundles))
+	for trustDomain, bundle := range f.bundles {
+		out[trustDomain] = bundle.Certs
+	}
+	return out
+}
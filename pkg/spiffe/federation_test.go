@@ -0,0 +1,345 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spiffe
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/atomic"
+	"gopkg.in/square/go-jose.v2"
+
+	"istio.io/istio/pkg/test/util/retry"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T, trustDomain string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{Organization: []string{trustDomain}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key}
+}
+
+// issue returns the DER encoded workload certificate for the SPIFFE ID.
+func (ca *testCA) issue(t *testing.T, id string) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uri, _ := url.Parse(id)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		URIs:         []*url.URL{uri},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, key.Public(), ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func (ca *testCA) pem() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})
+}
+
+// crl returns the PEM encoded certificate revocation list of the CA, revoking nothing.
+func (ca *testCA) crl(t *testing.T) []byte {
+	t.Helper()
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now(),
+		NextUpdate: time.Now().Add(time.Hour),
+	}, ca.cert, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der})
+}
+
+func bundleDocument(t *testing.T, refreshHint int, sequence uint64, cas ...*testCA) []byte {
+	t.Helper()
+	doc := bundleDoc{RefreshHint: refreshHint, Sequence: sequence}
+	for _, ca := range cas {
+		doc.Keys = append(doc.Keys, jose.JSONWebKey{
+			Key:          ca.cert.PublicKey,
+			Certificates: []*x509.Certificate{ca.cert},
+			Use:          "x509-svid",
+		})
+	}
+	out, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// bundleEndpoint is a local SPIFFE bundle endpoint serving the bundle of a trust domain.
+type bundleEndpoint struct {
+	*httptest.Server
+	mu       sync.Mutex
+	bundle   []byte
+	status   int
+	requests atomic.Int32
+}
+
+func newBundleEndpoint(bundle []byte) *bundleEndpoint {
+	e := &bundleEndpoint{bundle: bundle, status: http.StatusOK}
+	e.Server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		e.requests.Inc()
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		w.WriteHeader(e.status)
+		_, _ = w.Write(e.bundle)
+	}))
+	return e
+}
+
+func (e *bundleEndpoint) set(status int, bundle []byte) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.status = status
+	e.bundle = bundle
+}
+
+func TestParseTrustBundle(t *testing.T) {
+	ca1 := newTestCA(t, "foo.domain.com")
+	ca2 := newTestCA(t, "foo.domain.com")
+
+	cases := []struct {
+		name        string
+		data        []byte
+		certs       int
+		crls        int
+		refreshHint time.Duration
+		sequence    uint64
+		errContains string
+	}{
+		{
+			name:        "bundle document",
+			data:        bundleDocument(t, 300, 7, ca1, ca2),
+			certs:       2,
+			refreshHint: 5 * time.Minute,
+			sequence:    7,
+		},
+		{
+			name:  "pem",
+			data:  append(ca1.pem(), ca2.pem()...),
+			certs: 2,
+		},
+		{
+			name:  "pem with crl",
+			data:  append(ca1.pem(), ca1.crl(t)...),
+			certs: 1,
+			crls:  1,
+		},
+		{
+			name:        "invalid crl",
+			data:        append(ca1.pem(), pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: []byte("garbage")})...),
+			errContains: "failed to parse CRL",
+		},
+		{
+			name:        "invalid bundle document",
+			data:        []byte(invalidSpiffeX509Bundle),
+			errContains: "expected 1 certificate in x509-svid entry 0; got 0",
+		},
+		{
+			name:        "garbage",
+			data:        []byte("not a bundle"),
+			errContains: "does not contain a SPIFFE bundle or PEM certificates",
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			bundle, err := ParseTrustBundle("foo.domain.com", tt.data)
+			if tt.errContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errContains) {
+					t.Fatalf("expected error containing %q, got %v", tt.errContains, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(bundle.Certs) != tt.certs || len(bundle.CRLs) != tt.crls || bundle.RefreshHint != tt.refreshHint || bundle.Sequence != tt.sequence {
+				t.Fatalf("unexpected bundle: %d certs, %d crls, refresh hint %v, sequence %d",
+					len(bundle.Certs), len(bundle.CRLs), bundle.RefreshHint, bundle.Sequence)
+			}
+			if parsed, err := ParseTrustBundle("foo.domain.com", append(bundle.PEM(), bundle.CRLPEM()...)); err != nil || !parsed.sameCerts(bundle) {
+				t.Fatalf("PEM does not round trip: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseBundleSources(t *testing.T) {
+	endpoints, err := ParseBundleEndpoints("foo|foo.example.com/bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(endpoints) != 1 || endpoints[0].TrustDomain != "foo" || endpoints[0].Endpoint != "https://foo.example.com/bundle" {
+		t.Fatalf("unexpected endpoints: %v", endpoints)
+	}
+	files, err := ParseBundleFiles("foo|/etc/foo.pem||bar|/etc/bar.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("unexpected files: %v", files)
+	}
+	if _, err := ParseBundleFiles("foo|/etc/foo.pem|bar"); err == nil || !strings.Contains(err.Error(), "<trustdomain>|<file>") {
+		t.Fatalf("expected invalid config, got %v", err)
+	}
+}
+
+func TestFederatedBundles(t *testing.T) {
+	minBundleRefreshInterval = time.Millisecond * 10
+	defer func() { minBundleRefreshInterval = 10 * time.Second }()
+
+	// Two trust domains with their own CA, one published by a bundle endpoint and one by a file.
+	fooCA := newTestCA(t, "foo.domain.com")
+	barCA := newTestCA(t, "bar.domain.com")
+	endpoint := newBundleEndpoint(bundleDocument(t, 3600, 1, fooCA))
+	defer endpoint.Close()
+	dir, err := ioutil.TempDir("", "spiffe-bundles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	barFile := filepath.Join(dir, "bar.pem")
+	if err := ioutil.WriteFile(barFile, barCA.pem(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	bundles, err := NewFederatedBundles(time.Hour, []*x509.Certificate{endpoint.Certificate()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	updates := atomic.NewInt32(0)
+	bundles.AddHandler(func() { updates.Inc() })
+	bundles.SetSources("endpoints", []BundleSource{{TrustDomain: "foo.domain.com", Endpoint: endpoint.URL}})
+	bundles.SetSources("files", []BundleSource{{TrustDomain: "bar.domain.com", File: barFile}})
+	if err := bundles.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(bundles.TrustDomains(), ","); got != "bar.domain.com,foo.domain.com" {
+		t.Fatalf("unexpected trust domains %v", got)
+	}
+	if got := bundles.Bundle("foo.domain.com"); got.RefreshHint != time.Hour || !got.Certs[0].Equal(fooCA.cert) {
+		t.Fatalf("unexpected bundle for foo.domain.com: %+v", got)
+	}
+	if updates.Load() != 1 {
+		t.Fatalf("expected 1 update, got %d", updates.Load())
+	}
+
+	// Bundles are not fetched again before their refresh hint elapsed.
+	if err := bundles.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if endpoint.requests.Load() != 1 {
+		t.Fatalf("expected 1 request to the bundle endpoint, got %d", endpoint.requests.Load())
+	}
+
+	// Workloads of both trust domains are verified with their own roots.
+	verifier := NewPeerCertVerifier()
+	for td, certs := range bundles.Bundles() {
+		verifier.SetMapping(td, certs)
+	}
+	if err := verifier.VerifyPeerCert([][]byte{barCA.issue(t, "spiffe://bar.domain.com/ns/foo/sa/bar")}, nil); err != nil {
+		t.Fatalf("failed to verify bar.domain.com workload: %v", err)
+	}
+	if err := verifier.VerifyPeerCert([][]byte{barCA.issue(t, "spiffe://foo.domain.com/ns/foo/sa/bar")}, nil); err == nil {
+		t.Fatalf("expected bar.domain.com CA not to be trusted for foo.domain.com")
+	}
+
+	// A failing endpoint keeps the last known bundle, and the endpoint is retried after a backoff.
+	endpoint.set(http.StatusServiceUnavailable, []byte("down"))
+	bundles.SetSources("endpoints", []BundleSource{{TrustDomain: "foo.domain.com", Endpoint: endpoint.URL + "/"}})
+	if err := bundles.Refresh(); err == nil || !strings.Contains(err.Error(), "unexpected status: 503") {
+		t.Fatalf("expected refresh to fail, got %v", err)
+	}
+	if !bundles.Bundle("foo.domain.com").Certs[0].Equal(fooCA.cert) {
+		t.Fatalf("expected the last known bundle to be kept")
+	}
+
+	// A rotated bundle is picked up once the endpoint recovers, honoring the refresh hint.
+	rotatedCA := newTestCA(t, "foo.domain.com")
+	endpoint.set(http.StatusOK, bundleDocument(t, 0, 2, fooCA, rotatedCA))
+	stop := make(chan struct{})
+	defer close(stop)
+	go bundles.Run(stop)
+	retry.UntilSuccessOrFail(t, func() error {
+		if got := len(bundles.Bundle("foo.domain.com").Certs); got != 2 {
+			return fmt.Errorf("expected 2 certs for foo.domain.com, got %d", got)
+		}
+		return nil
+	}, retry.Timeout(5*time.Second))
+	if updates.Load() != 2 {
+		t.Fatalf("expected 2 updates, got %d", updates.Load())
+	}
+
+	// Removing a source removes its trust bundle.
+	bundles.SetSources("files", nil)
+	if got := strings.Join(bundles.TrustDomains(), ","); got != "foo.domain.com" {
+		t.Fatalf("unexpected trust domains %v", got)
+	}
+	if updates.Load() != 3 {
+		t.Fatalf("expected 3 updates, got %d", updates.Load())
+	}
+}
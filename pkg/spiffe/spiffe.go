@@ -20,6 +20,8 @@ import (
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strings"
@@ -51,6 +53,7 @@ var (
 
 	firstRetryBackOffTime = time.Millisecond * 50
 	totalRetryTimeout     = time.Second * 10
+	bundleFetchTimeout    = time.Second * 10
 
 	spiffeLog = log.RegisterScope("spiffe", "SPIFFE library logging", 0)
 )
@@ -83,6 +86,9 @@ func (i Identity) String() string {
 	return URIPrefix + i.TrustDomain + "/ns/" + i.Namespace + "/sa/" + i.ServiceAccount
 }
 
+// maxBundleSize limits the size of a SPIFFE bundle document read from an endpoint.
+const maxBundleSize = 1 << 20
+
 type bundleDoc struct {
 	jose.JSONWebKeySet
 	Sequence    uint64 `json:"spiffe_sequence,omitempty"`
@@ -163,105 +169,69 @@ func GetTrustDomainFromURISAN(uriSan string) (string, error) {
 func RetrieveSpiffeBundleRootCertsFromStringInput(inputString string, extraTrustedCerts []*x509.Certificate) (
 	map[string][]*x509.Certificate, error) {
 	spiffeLog.Infof("Processing SPIFFE bundle configuration: %v", inputString)
+	config, err := parseTrustDomainTuples(inputString, "url")
+	if err != nil {
+		return nil, err
+	}
+	return RetrieveSpiffeBundleRootCerts(config, extraTrustedCerts)
+}
+
+// parseTrustDomainTuples parses a list of trust domain to location mappings in the format of
+// "foo|location1||bar|location2...".
+func parseTrustDomainTuples(inputString, location string) (map[string]string, error) {
 	config := make(map[string]string)
 	tuples := strings.Split(inputString, "||")
 	for _, tuple := range tuples {
 		items := strings.Split(tuple, "|")
 		if len(items) != 2 {
-			return nil, fmt.Errorf("config is invalid: %v. Expected <trustdomain>|<url>", tuple)
+			return nil, fmt.Errorf("config is invalid: %v. Expected <trustdomain>|<%s>", tuple, location)
 		}
 		trustDomain := items[0]
-		endpoint := items[1]
-		config[trustDomain] = endpoint
+		config[trustDomain] = items[1]
 	}
-	return RetrieveSpiffeBundleRootCerts(config, extraTrustedCerts)
+	return config, nil
 }
 
 // RetrieveSpiffeBundleRootCerts retrieves the trusted CA certificates from a list of SPIFFE bundle endpoints.
 // It can use the system cert pool and the supplied certificates to validate the endpoints.
 func RetrieveSpiffeBundleRootCerts(config map[string]string, extraTrustedCerts []*x509.Certificate) (
 	map[string][]*x509.Certificate, error) {
-	httpClient := &http.Client{}
-	caCertPool, err := x509.SystemCertPool()
+	httpClient, err := newBundleHTTPClient(extraTrustedCerts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get SystemCertPool: %v", err)
-	}
-	for _, cert := range extraTrustedCerts {
-		caCertPool.AddCert(cert)
+		return nil, err
 	}
 
 	ret := map[string][]*x509.Certificate{}
 	for trustdomain, endpoint := range config {
-		if !strings.HasPrefix(endpoint, "https://") {
-			endpoint = "https://" + endpoint
-		}
-		u, err := url.Parse(endpoint)
-		if err != nil {
+		endpoint = normalizeBundleEndpoint(endpoint)
+		if _, err := url.Parse(endpoint); err != nil {
 			return nil, fmt.Errorf("failed to split the SPIFFE bundle URL: %v", err)
 		}
 
-		config := &tls.Config{
-			ServerName: u.Hostname(),
-			RootCAs:    caCertPool,
-		}
-
-		httpClient.Transport = &http.Transport{
-			TLSClientConfig: config,
-		}
-
 		retryBackoffTime := firstRetryBackOffTime
 		startTime := time.Now()
-		var resp *http.Response
+		var body []byte
 		for {
-			resp, err = httpClient.Get(endpoint)
-			var errMsg string
-			if err != nil {
-				errMsg = fmt.Sprintf("Calling %s failed with error: %v", endpoint, err)
-			} else if resp == nil {
-				errMsg = fmt.Sprintf("Calling %s failed with nil response", endpoint)
-			} else if resp.StatusCode != http.StatusOK {
-				b := make([]byte, 1024)
-				n, _ := resp.Body.Read(b)
-				errMsg = fmt.Sprintf("Calling %s failed with unexpected status: %v, fetching bundle: %s",
-					endpoint, resp.StatusCode, string(b[:n]))
-			} else {
+			body, err = fetchBundle(httpClient, endpoint)
+			if err == nil {
 				break
 			}
 
 			if startTime.Add(totalRetryTimeout).Before(time.Now()) {
 				return nil, fmt.Errorf("exhausted retries to fetch the SPIFFE bundle %s from url %s. Latest error: %v",
-					trustdomain, endpoint, errMsg)
+					trustdomain, endpoint, err)
 			}
 
-			spiffeLog.Warnf("%s, retry in %v", errMsg, retryBackoffTime)
+			spiffeLog.Warnf("%v, retry in %v", err, retryBackoffTime)
 			time.Sleep(retryBackoffTime)
 			retryBackoffTime *= 2 // Exponentially increase the retry backoff time.
 		}
-		defer resp.Body.Close()
-
-		doc := new(bundleDoc)
-		if err := json.NewDecoder(resp.Body).Decode(doc); err != nil {
-			return nil, fmt.Errorf("trust domain [%s] at URL [%s] failed to decode bundle: %v", trustdomain, endpoint, err)
-		}
 
-		var cert *x509.Certificate
-		for i, key := range doc.Keys {
-			if key.Use == "x509-svid" {
-				if len(key.Certificates) != 1 {
-					return nil, fmt.Errorf("trust domain [%s] at URL [%s] expected 1 certificate in x509-svid entry %d; got %d",
-						trustdomain, endpoint, i, len(key.Certificates))
-				}
-				cert = key.Certificates[0]
-			}
-		}
-		if cert == nil {
-			return nil, fmt.Errorf("trust domain [%s] at URL [%s] does not provide a X509 SVID", trustdomain, endpoint)
-		}
-		if certs, ok := ret[trustdomain]; ok {
-			ret[trustdomain] = append(certs, cert)
-		} else {
-			ret[trustdomain] = []*x509.Certificate{cert}
+		bundle, err := parseBundleDoc(trustdomain, endpoint, body)
+		if err != nil {
+			return nil, err
 		}
+		ret[trustdomain] = append(ret[trustdomain], bundle.Certs...)
 	}
 	for trustDomain, certs := range ret {
 		spiffeLog.Infof("Loaded SPIFFE trust bundle for: %v, containing %d certs", trustDomain, len(certs))
@@ -269,10 +239,87 @@ func RetrieveSpiffeBundleRootCerts(config map[string]string, extraTrustedCerts [
 	return ret, nil
 }
 
+// newBundleHTTPClient returns a client for SPIFFE bundle endpoints, which are authenticated with the
+// system cert pool and the supplied certificates.
+func newBundleHTTPClient(extraTrustedCerts []*x509.Certificate) (*http.Client, error) {
+	caCertPool, err := x509.SystemCertPool()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get SystemCertPool: %v", err)
+	}
+	for _, cert := range extraTrustedCerts {
+		caCertPool.AddCert(cert)
+	}
+	return &http.Client{
+		Timeout: bundleFetchTimeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				RootCAs: caCertPool,
+			},
+		},
+	}, nil
+}
+
+func normalizeBundleEndpoint(endpoint string) string {
+	if !strings.HasPrefix(endpoint, "https://") {
+		endpoint = "https://" + endpoint
+	}
+	return endpoint
+}
+
+// fetchBundle makes a single request to a SPIFFE bundle endpoint and returns the bundle document.
+func fetchBundle(httpClient *http.Client, endpoint string) ([]byte, error) {
+	resp, err := httpClient.Get(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("calling %s failed with error: %v", endpoint, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b := make([]byte, 1024)
+		n, _ := resp.Body.Read(b)
+		return nil, fmt.Errorf("calling %s failed with unexpected status: %v, fetching bundle: %s",
+			endpoint, resp.StatusCode, string(b[:n]))
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBundleSize))
+	if err != nil {
+		return nil, fmt.Errorf("calling %s failed reading the bundle: %v", endpoint, err)
+	}
+	return body, nil
+}
+
+// parseBundleDoc decodes a SPIFFE bundle document and returns the X.509 authorities it contains.
+// The source is the location the document was read from, and is only used in errors.
+func parseBundleDoc(trustDomain, source string, data []byte) (*TrustBundle, error) {
+	doc := new(bundleDoc)
+	if err := json.Unmarshal(data, doc); err != nil {
+		return nil, fmt.Errorf("trust domain [%s] from [%s] failed to decode bundle: %v", trustDomain, source, err)
+	}
+
+	bundle := &TrustBundle{
+		TrustDomain: trustDomain,
+		RefreshHint: time.Duration(doc.RefreshHint) * time.Second,
+		Sequence:    doc.Sequence,
+	}
+	for i, key := range doc.Keys {
+		if key.Use == "x509-svid" {
+			if len(key.Certificates) != 1 {
+				return nil, fmt.Errorf("trust domain [%s] from [%s] expected 1 certificate in x509-svid entry %d; got %d",
+					trustDomain, source, i, len(key.Certificates))
+			}
+			bundle.Certs = append(bundle.Certs, key.Certificates[0])
+		}
+	}
+	if len(bundle.Certs) == 0 {
+		return nil, fmt.Errorf("trust domain [%s] from [%s] does not provide a X509 SVID", trustDomain, source)
+	}
+	return bundle, nil
+}
+
 // PeerCertVerifier is an instance to verify the peer certificate in the SPIFFE way using the retrieved root certificates.
 type PeerCertVerifier struct {
+	mu              sync.RWMutex
 	generalCertPool *x509.CertPool
 	certPools       map[string]*x509.CertPool
+	certs           map[string][]*x509.Certificate
 }
 
 // NewPeerCertVerifier returns a new PeerCertVerifier.
@@ -280,16 +327,22 @@ func NewPeerCertVerifier() *PeerCertVerifier {
 	return &PeerCertVerifier{
 		generalCertPool: x509.NewCertPool(),
 		certPools:       make(map[string]*x509.CertPool),
+		certs:           make(map[string][]*x509.Certificate),
 	}
 }
 
 // GetGeneralCertPool returns generalCertPool containing all root certs.
+// The pool is replaced rather than modified when a trust domain is updated or removed.
 func (v *PeerCertVerifier) GetGeneralCertPool() *x509.CertPool {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
 	return v.generalCertPool
 }
 
 // AddMapping adds a new trust domain to certificates mapping to the certPools map.
 func (v *PeerCertVerifier) AddMapping(trustDomain string, certs []*x509.Certificate) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
 	if v.certPools[trustDomain] == nil {
 		v.certPools[trustDomain] = x509.NewCertPool()
 	}
@@ -297,9 +350,37 @@ func (v *PeerCertVerifier) AddMapping(trustDomain string, certs []*x509.Certific
 		v.certPools[trustDomain].AddCert(cert)
 		v.generalCertPool.AddCert(cert)
 	}
+	v.certs[trustDomain] = append(v.certs[trustDomain], certs...)
 	spiffeLog.Infof("Added %d certs to trust domain %s in peer cert verifier", len(certs), trustDomain)
 }
 
+// SetMapping replaces the certificates of a trust domain. Passing no certificates removes the trust domain.
+func (v *PeerCertVerifier) SetMapping(trustDomain string, certs []*x509.Certificate) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if len(certs) == 0 {
+		delete(v.certPools, trustDomain)
+		delete(v.certs, trustDomain)
+	} else {
+		pool := x509.NewCertPool()
+		for _, cert := range certs {
+			pool.AddCert(cert)
+		}
+		v.certPools[trustDomain] = pool
+		v.certs[trustDomain] = append([]*x509.Certificate{}, certs...)
+	}
+
+	// Certificates cannot be removed from a pool, and the current pool may be in use by a handshake.
+	general := x509.NewCertPool()
+	for _, certs := range v.certs {
+		for _, cert := range certs {
+			general.AddCert(cert)
+		}
+	}
+	v.generalCertPool = general
+	spiffeLog.Infof("Set %d certs for trust domain %s in peer cert verifier", len(certs), trustDomain)
+}
+
 // AddMappingFromPEM adds multiple RootCA's to the spiffe Trust bundle in the trustDomain namespace
 func (v *PeerCertVerifier) AddMappingFromPEM(trustDomain string, rootCertBytes []byte) error {
 	block, rest := pem.Decode(rootCertBytes)
@@ -355,7 +436,9 @@ func (v *PeerCertVerifier) VerifyPeerCert(rawCerts [][]byte, _ [][]*x509.Certifi
 	if err != nil {
 		return err
 	}
+	v.mu.RLock()
 	rootCertPool, ok := v.certPools[trustDomain]
+	v.mu.RUnlock()
 	if !ok {
 		return fmt.Errorf("no cert pool found for trust domain %s", trustDomain)
 	}
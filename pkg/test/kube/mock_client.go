@@ -136,6 +136,10 @@ func (c MockClient) GetMemberRoll() memberroll.MemberRollController {
 	panic("not used in mock")
 }
 
+func (c MockClient) AddNamespaceHandler(handler xnsinformers.NamespaceSetHandler) {
+	panic("not used in mock")
+}
+
 func (c MockClient) AllDiscoveryDo(_ context.Context, _, _ string) (map[string][]byte, error) {
 	return c.Results, nil
 }
@@ -26,6 +26,18 @@ func NewCredFetcher(credtype, trustdomain, jwtPath, identityProvider string) (se
 	switch credtype {
 	case security.GCE:
 		return plugin.CreateGCEPlugin(trustdomain, jwtPath, identityProvider), nil
+	case security.AWS:
+		return plugin.CreateAWSPlugin(plugin.AWSMetadataEndpoint, plugin.AWSNonceFile, jwtPath, identityProvider), nil
+	case security.Azure:
+		// Like for GCE, the trust domain is the default audience of the token.
+		resource := plugin.AzureResource
+		if resource == "" {
+			resource = trustdomain
+		}
+		return plugin.CreateAzurePlugin(plugin.AzureMetadataEndpoint, resource, plugin.AzureClientID,
+			jwtPath, identityProvider), nil
+	case security.OIDC:
+		return plugin.CreateOIDCPlugin(plugin.OIDCTokenFile, plugin.OIDCTokenCommand, jwtPath, identityProvider)
 	case security.Mock: // for test only
 		return plugin.CreateMockPlugin(), nil
 	default:
@@ -39,6 +39,33 @@ func TestNewCredFetcher(t *testing.T) {
 			expectedToken:    "",
 			expectedIdp:      "GoogleComputeEngine",
 		},
+		"aws test": {
+			fetcherType:      security.AWS,
+			trustdomain:      "cluster.local",
+			jwtPath:          "",
+			identityProvider: security.AWS,
+			expectedErr:      "",
+			expectedToken:    "",
+			expectedIdp:      "AWS",
+		},
+		"azure test": {
+			fetcherType:      security.Azure,
+			trustdomain:      "cluster.local",
+			jwtPath:          "",
+			identityProvider: security.Azure,
+			expectedErr:      "",
+			expectedToken:    "",
+			expectedIdp:      "Azure",
+		},
+		"oidc test without token source": {
+			fetcherType:      security.OIDC,
+			trustdomain:      "cluster.local",
+			jwtPath:          "",
+			identityProvider: security.OIDC,
+			expectedErr:      "exactly one of the OIDC token file and command must be set",
+			expectedToken:    "",
+			expectedIdp:      "",
+		},
 		"mock test": {
 			fetcherType:      security.Mock,
 			trustdomain:      "",
@@ -0,0 +1,216 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This is AWS plugin of credentialfetcher.
+package plugin
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/pkg/env"
+	"istio.io/pkg/log"
+)
+
+var (
+	awscredLog = log.RegisterScope("awscred", "AWS credential fetcher for istio agent", 0)
+
+	// AWSMetadataEndpoint is the address of the EC2 instance metadata service.
+	AWSMetadataEndpoint = env.RegisterStringVar("AWS_EC2_METADATA_SERVICE_ENDPOINT", "http://169.254.169.254",
+		"The address of the EC2 instance metadata service used by the AWS credential fetcher").Get()
+
+	// AWSNonceFile is the file keeping the nonce the AWS credential fetcher presents with the instance
+	// identity document.
+	AWSNonceFile = env.RegisterStringVar("AWS_INSTANCE_NONCE_FILE", "./etc/istio/proxy/aws-instance-nonce",
+		"The file keeping the nonce presented with the EC2 instance identity document. The CA binds the instance "+
+			"to the nonce it first presents, so the file must survive restarts of the agent").Get()
+)
+
+const (
+	awsTokenPath     = "/latest/api/token"
+	awsDocumentPath  = "/latest/dynamic/instance-identity/document"
+	awsSignaturePath = "/latest/dynamic/instance-identity/signature"
+
+	awsTokenHeader    = "X-aws-ec2-metadata-token"
+	awsTokenTTLHeader = "X-aws-ec2-metadata-token-ttl-seconds"
+	awsTokenTTL       = "60"
+)
+
+// The plugin object.
+type AWSPlugin struct {
+	// endpoint is the address of the instance metadata service.
+	endpoint string
+
+	// nonceFile keeps the nonce across restarts, if set.
+	nonceFile string
+	nonceMu   sync.Mutex
+	nonce     string
+
+	// The location to save the identity credential
+	jwtPath string
+
+	// identity provider
+	identityProvider string
+
+	client *http.Client
+}
+
+// CreateAWSPlugin creates an AWS credential fetcher plugin. Return the pointer to the created plugin.
+func CreateAWSPlugin(endpoint, nonceFile, jwtPath, identityProvider string) *AWSPlugin {
+	p := &AWSPlugin{
+		endpoint:         strings.TrimSuffix(endpoint, "/"),
+		nonceFile:        nonceFile,
+		jwtPath:          jwtPath,
+		identityProvider: identityProvider,
+		client:           &http.Client{Timeout: 5 * time.Second},
+	}
+	return p
+}
+
+// GetPlatformCredential fetches the signed instance identity document of the EC2 instance from
+// the instance metadata service, using an IMDSv2 session token. The credential is the base64url
+// encoded document, its base64url encoded SHA256-RSA signature and the nonce of the instance,
+// joined by ".". The CA verifies the signature with the AWS public certificate of the region, and
+// rejects the document when it is presented with another nonce than the one it was first seen
+// with. If jwtPath is set, the credential is also written to it.
+// Note: this function only works in an EC2 environment.
+func (p *AWSPlugin) GetPlatformCredential() (string, error) {
+	req, err := http.NewRequest(http.MethodPut, p.endpoint+awsTokenPath, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set(awsTokenTTLHeader, awsTokenTTL)
+	session, err := fetchMetadata(p.client, req)
+	if err != nil {
+		awscredLog.Errorf("Failed to get session token from metadata service: %v", err)
+		return "", err
+	}
+
+	doc, err := p.get(awsDocumentPath, session)
+	if err != nil {
+		awscredLog.Errorf("Failed to get instance identity document from metadata service: %v", err)
+		return "", err
+	}
+	sig, err := p.get(awsSignaturePath, session)
+	if err != nil {
+		awscredLog.Errorf("Failed to get instance identity signature from metadata service: %v", err)
+		return "", err
+	}
+	// The signature is served base64 encoded, wrapped over several lines.
+	sigBytes, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(sig)), ""))
+	if err != nil {
+		return "", fmt.Errorf("invalid instance identity signature: %v", err)
+	}
+
+	nonce, err := p.instanceNonce()
+	if err != nil {
+		awscredLog.Errorf("Failed to get the instance nonce: %v", err)
+		return "", err
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(doc) + "." + base64.RawURLEncoding.EncodeToString(sigBytes) +
+		"." + nonce
+	awscredLog.Debugf("Got AWS instance identity credential: %d", len(token))
+	if err := writeCredential(p.jwtPath, token); err != nil {
+		awscredLog.Errorf("Encountered error when writing instance identity credential: %v", err)
+		return "", err
+	}
+	return token, nil
+}
+
+// instanceNonce returns the nonce presented with the instance identity document. It is read from
+// nonceFile, or generated and saved to it on first use.
+func (p *AWSPlugin) instanceNonce() (string, error) {
+	p.nonceMu.Lock()
+	defer p.nonceMu.Unlock()
+	if p.nonce != "" {
+		return p.nonce, nil
+	}
+	if p.nonceFile != "" {
+		saved, err := ioutil.ReadFile(p.nonceFile)
+		if err != nil && !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to read nonce file %s: %v", p.nonceFile, err)
+		}
+		if nonce := strings.TrimSpace(string(saved)); nonce != "" {
+			p.nonce = nonce
+			return p.nonce, nil
+		}
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	nonce := base64.RawURLEncoding.EncodeToString(b)
+	if p.nonceFile != "" {
+		if err := ioutil.WriteFile(p.nonceFile, []byte(nonce), 0600); err != nil {
+			return "", fmt.Errorf("failed to write nonce file %s: %v", p.nonceFile, err)
+		}
+	}
+	p.nonce = nonce
+	return p.nonce, nil
+}
+
+func (p *AWSPlugin) get(path, session string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, p.endpoint+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(awsTokenHeader, session)
+	body, err := fetchMetadata(p.client, req)
+	return []byte(body), err
+}
+
+// GetType returns credential fetcher type.
+func (p *AWSPlugin) GetType() string {
+	return security.AWS
+}
+
+// GetIdentityProvider returns the name of the identity provider that can authenticate the workload credential.
+func (p *AWSPlugin) GetIdentityProvider() string {
+	return p.identityProvider
+}
+
+// fetchMetadata sends a request to a metadata service and returns the response body.
+func fetchMetadata(client *http.Client, req *http.Request) (string, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("metadata request %s failed with status %d: %s",
+			req.URL.Path, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return string(body), nil
+}
+
+// writeCredential saves the credential to path, if set, for the Envoy STS client.
+func writeCredential(path, token string) error {
+	if path == "" {
+		return nil
+	}
+	return ioutil.WriteFile(path, []byte(token), 0600)
+}
@@ -0,0 +1,109 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	testDocument  = `{"accountId":"123456789012","instanceId":"i-0123456789abcdef0","region":"us-east-1"}`
+	testSignature = "c2lnbmF0dXJl"
+)
+
+func newAWSMetadataServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == awsTokenPath {
+			if r.Method != http.MethodPut || r.Header.Get(awsTokenTTLHeader) == "" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			_, _ = w.Write([]byte("session"))
+			return
+		}
+		if r.Header.Get(awsTokenHeader) != "session" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case awsDocumentPath:
+			_, _ = w.Write([]byte(testDocument))
+		case awsSignaturePath:
+			// The metadata service wraps the signature over several lines.
+			_, _ = w.Write([]byte(testSignature[:4] + "\n" + testSignature[4:]))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestAWSPlugin(t *testing.T) {
+	server := newAWSMetadataServer()
+	defer server.Close()
+
+	dir := t.TempDir()
+	jwtPath := filepath.Join(dir, "istio-token")
+	nonceFile := filepath.Join(dir, "aws-instance-nonce")
+	p := CreateAWSPlugin(server.URL, nonceFile, jwtPath, "AWS")
+	token, err := p.GetPlatformCredential()
+	if err != nil {
+		t.Fatalf("GetPlatformCredential() failed: %v", err)
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("credential %q does not have three parts", token)
+	}
+	if doc, _ := base64.RawURLEncoding.DecodeString(parts[0]); string(doc) != testDocument {
+		t.Errorf("document: got %q, want %q", doc, testDocument)
+	}
+	if sig, _ := base64.RawURLEncoding.DecodeString(parts[1]); string(sig) != "signature" {
+		t.Errorf("signature: got %q, want %q", sig, "signature")
+	}
+	if saved, err := ioutil.ReadFile(jwtPath); err != nil || string(saved) != token {
+		t.Errorf("saved credential: got %q (%v), want %q", saved, err, token)
+	}
+	for _, f := range []string{jwtPath, nonceFile} {
+		if info, err := os.Stat(f); err != nil || info.Mode().Perm() != 0600 {
+			t.Errorf("expected %s to be only readable by its owner, got %v (%v)", f, info.Mode(), err)
+		}
+	}
+
+	// The nonce is kept across restarts of the agent.
+	restarted, err := CreateAWSPlugin(server.URL, nonceFile, "", "AWS").GetPlatformCredential()
+	if err != nil {
+		t.Fatalf("GetPlatformCredential() failed: %v", err)
+	}
+	if restarted != token {
+		t.Errorf("credential after restart: got %q, want %q", restarted, token)
+	}
+	if other, _ := CreateAWSPlugin(server.URL, "", "", "AWS").GetPlatformCredential(); other == token {
+		t.Errorf("expected another nonce without the nonce file")
+	}
+	if p.GetType() != "AWS" || p.GetIdentityProvider() != "AWS" {
+		t.Errorf("unexpected type %s or identity provider %s", p.GetType(), p.GetIdentityProvider())
+	}
+
+	server.Close()
+	if _, err := p.GetPlatformCredential(); err == nil {
+		t.Errorf("GetPlatformCredential() succeeded without a metadata service")
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This is Azure plugin of credentialfetcher.
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/pkg/env"
+	"istio.io/pkg/log"
+)
+
+var (
+	azurecredLog = log.RegisterScope("azurecred", "Azure credential fetcher for istio agent", 0)
+
+	// AzureMetadataEndpoint is the address of the Azure instance metadata service.
+	AzureMetadataEndpoint = env.RegisterStringVar("AZURE_METADATA_SERVICE_ENDPOINT", "http://169.254.169.254",
+		"The address of the Azure instance metadata service used by the Azure credential fetcher").Get()
+
+	// AzureResource is the audience of the managed identity token.
+	AzureResource = env.RegisterStringVar("AZURE_MANAGED_IDENTITY_RESOURCE", "",
+		"The resource the Azure credential fetcher requests the managed identity token for. "+
+			"If unset, the trust domain is used").Get()
+
+	// AzureClientID selects a user-assigned managed identity of the VM.
+	AzureClientID = env.RegisterStringVar("AZURE_MANAGED_IDENTITY_CLIENT_ID", "",
+		"The client ID of the user-assigned managed identity used by the Azure credential fetcher. "+
+			"If unset, the system-assigned identity of the VM is used").Get()
+)
+
+const (
+	azureTokenPath  = "/metadata/identity/oauth2/token"
+	azureAPIVersion = "2018-02-01"
+)
+
+// The plugin object.
+type AzurePlugin struct {
+	// endpoint is the address of the instance metadata service.
+	endpoint string
+
+	// resource is the audience of the managed identity token.
+	resource string
+
+	// clientID selects a user-assigned managed identity, if set.
+	clientID string
+
+	// The location to save the identity token
+	jwtPath string
+
+	// identity provider
+	identityProvider string
+
+	client *http.Client
+}
+
+// CreateAzurePlugin creates an Azure credential fetcher plugin. Return the pointer to the created plugin.
+func CreateAzurePlugin(endpoint, resource, clientID, jwtPath, identityProvider string) *AzurePlugin {
+	p := &AzurePlugin{
+		endpoint:         strings.TrimSuffix(endpoint, "/"),
+		resource:         resource,
+		clientID:         clientID,
+		jwtPath:          jwtPath,
+		identityProvider: identityProvider,
+		client:           &http.Client{Timeout: 5 * time.Second},
+	}
+	return p
+}
+
+// GetPlatformCredential fetches a managed identity access token of the VM for the configured
+// resource from the instance metadata service. If jwtPath is set, the token is also written to it.
+// Note: this function only works in an Azure VM environment.
+func (p *AzurePlugin) GetPlatformCredential() (string, error) {
+	q := url.Values{}
+	q.Set("api-version", azureAPIVersion)
+	q.Set("resource", p.resource)
+	if p.clientID != "" {
+		q.Set("client_id", p.clientID)
+	}
+	req, err := http.NewRequest(http.MethodGet, p.endpoint+azureTokenPath+"?"+q.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata", "true")
+	body, err := fetchMetadata(p.client, req)
+	if err != nil {
+		azurecredLog.Errorf("Failed to get managed identity token from metadata service: %v", err)
+		return "", err
+	}
+
+	resp := struct {
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		return "", fmt.Errorf("failed to parse managed identity token response: %v", err)
+	}
+	if resp.AccessToken == "" {
+		return "", fmt.Errorf("managed identity token response has no access_token")
+	}
+	azurecredLog.Debugf("Got Azure managed identity token: %d", len(resp.AccessToken))
+	if err := writeCredential(p.jwtPath, resp.AccessToken); err != nil {
+		azurecredLog.Errorf("Encountered error when writing managed identity token: %v", err)
+		return "", err
+	}
+	return resp.AccessToken, nil
+}
+
+// GetType returns credential fetcher type.
+func (p *AzurePlugin) GetType() string {
+	return security.Azure
+}
+
+// GetIdentityProvider returns the name of the identity provider that can authenticate the workload credential.
+func (p *AzurePlugin) GetIdentityProvider() string {
+	return p.identityProvider
+}
@@ -0,0 +1,77 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAzurePlugin(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path != azureTokenPath || r.Header.Get("Metadata") != "true" || q.Get("api-version") != azureAPIVersion {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if q.Get("resource") != "api://istio" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_resource"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"access_token":"token-` + q.Get("client_id") + `","token_type":"Bearer"}`))
+	}))
+	defer server.Close()
+
+	testCases := map[string]struct {
+		resource    string
+		clientID    string
+		expectedTok string
+		expectedErr bool
+	}{
+		"system-assigned identity": {
+			resource:    "api://istio",
+			expectedTok: "token-",
+		},
+		"user-assigned identity": {
+			resource:    "api://istio",
+			clientID:    "client",
+			expectedTok: "token-client",
+		},
+		"unknown resource": {
+			resource:    "api://other",
+			expectedErr: true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			p := CreateAzurePlugin(server.URL+"/", tc.resource, tc.clientID, "", "Azure")
+			token, err := p.GetPlatformCredential()
+			if tc.expectedErr {
+				if err == nil {
+					t.Fatalf("GetPlatformCredential() succeeded, expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetPlatformCredential() failed: %v", err)
+			}
+			if token != tc.expectedTok {
+				t.Errorf("got token %q, want %q", token, tc.expectedTok)
+			}
+		})
+	}
+}
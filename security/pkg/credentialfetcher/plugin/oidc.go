@@ -0,0 +1,115 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This is the generic OIDC plugin of credentialfetcher.
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+	"time"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/pkg/env"
+	"istio.io/pkg/log"
+)
+
+var (
+	oidccredLog = log.RegisterScope("oidccred", "OIDC credential fetcher for istio agent", 0)
+
+	// OIDCTokenFile is the file holding the OIDC token, kept up to date by another process.
+	OIDCTokenFile = env.RegisterStringVar("OIDC_TOKEN_FILE", "",
+		"The file holding the token of the OIDC credential fetcher").Get()
+
+	// OIDCTokenCommand is the command printing the OIDC token on its standard output.
+	OIDCTokenCommand = env.RegisterStringVar("OIDC_TOKEN_COMMAND", "",
+		"The command printing the token of the OIDC credential fetcher on its standard output. "+
+			"The command is split on white spaces and not run through a shell").Get()
+)
+
+// oidcCommandTimeout bounds the runtime of the token command.
+const oidcCommandTimeout = 10 * time.Second
+
+// The plugin object.
+type OIDCPlugin struct {
+	// tokenFile is the file holding the token.
+	tokenFile string
+
+	// command prints the token, when tokenFile is unset.
+	command []string
+
+	// The location to save the identity token
+	jwtPath string
+
+	// identity provider
+	identityProvider string
+}
+
+// CreateOIDCPlugin creates an OIDC credential fetcher plugin, reading the token from tokenFile or
+// from the output of command. Exactly one of them must be set.
+func CreateOIDCPlugin(tokenFile, command, jwtPath, identityProvider string) (*OIDCPlugin, error) {
+	if (tokenFile == "") == (command == "") {
+		return nil, fmt.Errorf("exactly one of the OIDC token file and command must be set")
+	}
+	p := &OIDCPlugin{
+		tokenFile:        tokenFile,
+		command:          strings.Fields(command),
+		jwtPath:          jwtPath,
+		identityProvider: identityProvider,
+	}
+	return p, nil
+}
+
+// GetPlatformCredential reads the OIDC token from the token file, or runs the token command.
+// If jwtPath is set, the token is also written to it.
+func (p *OIDCPlugin) GetPlatformCredential() (string, error) {
+	var out []byte
+	var err error
+	if p.tokenFile != "" {
+		out, err = ioutil.ReadFile(p.tokenFile)
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), oidcCommandTimeout)
+		defer cancel()
+		out, err = exec.CommandContext(ctx, p.command[0], p.command[1:]...).Output()
+	}
+	if err != nil {
+		oidccredLog.Errorf("Failed to get OIDC token: %v", err)
+		return "", err
+	}
+	token := strings.TrimSpace(string(out))
+	if token == "" {
+		return "", fmt.Errorf("the OIDC token is empty")
+	}
+	oidccredLog.Debugf("Got OIDC token: %d", len(token))
+	if p.tokenFile != p.jwtPath {
+		if err := writeCredential(p.jwtPath, token); err != nil {
+			oidccredLog.Errorf("Encountered error when writing OIDC token: %v", err)
+			return "", err
+		}
+	}
+	return token, nil
+}
+
+// GetType returns credential fetcher type.
+func (p *OIDCPlugin) GetType() string {
+	return security.OIDC
+}
+
+// GetIdentityProvider returns the name of the identity provider that can authenticate the workload credential.
+func (p *OIDCPlugin) GetIdentityProvider() string {
+	return p.identityProvider
+}
@@ -0,0 +1,82 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestOIDCPlugin(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("file-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := map[string]struct {
+		tokenFile   string
+		command     string
+		expectedTok string
+		expectedErr bool
+	}{
+		"token file": {
+			tokenFile:   tokenFile,
+			expectedTok: "file-token",
+		},
+		"token command": {
+			command:     "echo command-token",
+			expectedTok: "command-token",
+		},
+		"missing token file": {
+			tokenFile:   filepath.Join(dir, "missing"),
+			expectedErr: true,
+		},
+		"failing token command": {
+			command:     "false",
+			expectedErr: true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			jwtPath := filepath.Join(dir, "istio-token")
+			p, err := CreateOIDCPlugin(tc.tokenFile, tc.command, jwtPath, "OIDC")
+			if err != nil {
+				t.Fatalf("CreateOIDCPlugin() failed: %v", err)
+			}
+			token, err := p.GetPlatformCredential()
+			if tc.expectedErr {
+				if err == nil {
+					t.Fatalf("GetPlatformCredential() succeeded, expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetPlatformCredential() failed: %v", err)
+			}
+			if token != tc.expectedTok {
+				t.Errorf("got token %q, want %q", token, tc.expectedTok)
+			}
+			if saved, _ := ioutil.ReadFile(jwtPath); string(saved) != tc.expectedTok {
+				t.Errorf("saved token: got %q, want %q", saved, tc.expectedTok)
+			}
+		})
+	}
+
+	if _, err := CreateOIDCPlugin(tokenFile, "echo token", "", "OIDC"); err == nil {
+		t.Errorf("CreateOIDCPlugin() succeeded with both a token file and a command")
+	}
+}
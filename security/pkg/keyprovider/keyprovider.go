@@ -0,0 +1,44 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// keyprovider generates and holds the private keys of the workload certificates.
+package keyprovider
+
+import (
+	"fmt"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/istio/security/pkg/keyprovider/plugin"
+)
+
+// Options configures the key provider.
+type Options struct {
+	// Type is the type of the key provider, memory by default.
+	Type string
+
+	// Dir is the directory holding the keys of the file key provider.
+	Dir string
+}
+
+// NewKeyProvider creates the key provider of the given type.
+func NewKeyProvider(opts Options) (security.KeyProvider, error) {
+	switch opts.Type {
+	case "", security.KeyProviderMemory:
+		return plugin.CreateMemoryPlugin(), nil
+	case security.KeyProviderFile:
+		return plugin.CreateFilePlugin(opts.Dir)
+	default:
+		return nil, fmt.Errorf("invalid key provider type %s", opts.Type)
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keyprovider
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"istio.io/istio/pkg/security"
+)
+
+func TestNewKeyProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keyprovider")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	testCases := map[string]struct {
+		opts         Options
+		expectedType string
+		expectedErr  string
+	}{
+		"default": {
+			expectedType: security.KeyProviderMemory,
+		},
+		"file": {
+			opts:         Options{Type: security.KeyProviderFile, Dir: filepath.Join(dir, "keys")},
+			expectedType: security.KeyProviderFile,
+		},
+		"file without directory": {
+			opts:        Options{Type: security.KeyProviderFile},
+			expectedErr: "the directory of the keys is not set",
+		},
+		"pkcs11": {
+			opts:        Options{Type: "pkcs11"},
+			expectedErr: "invalid key provider type pkcs11",
+		},
+		"invalid": {
+			opts:        Options{Type: "foo"},
+			expectedErr: "invalid key provider type foo",
+		},
+	}
+
+	for id, tc := range testCases {
+		t.Run(id, func(t *testing.T) {
+			kp, err := NewKeyProvider(tc.opts)
+			if tc.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+					t.Fatalf("expected error %q, got %v", tc.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if kp.GetType() != tc.expectedType {
+				t.Errorf("expected key provider type %s, got %s", tc.expectedType, kp.GetType())
+			}
+		})
+	}
+}
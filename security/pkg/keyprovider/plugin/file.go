@@ -0,0 +1,106 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"crypto"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync/atomic"
+	"time"
+
+	"istio.io/istio/pkg/security"
+	pkiutil "istio.io/istio/security/pkg/pki/util"
+	"istio.io/pkg/log"
+)
+
+var (
+	filekeyLog = log.RegisterScope("filekey", "File key provider for istio agent", 0)
+
+	invalidFileNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+)
+
+// The plugin object.
+type FilePlugin struct {
+	dir string
+	// generation makes the file of every key unique, so that the file referenced by the secret
+	// of the proxy is not replaced before the proxy receives the new secret.
+	generation uint64
+}
+
+// CreateFilePlugin creates a key provider plugin which holds the keys in files of the directory,
+// only accessible to the user of the agent and the proxy. Return the pointer to the created plugin.
+func CreateFilePlugin(dir string) (*FilePlugin, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("the directory of the keys is not set")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create the directory of the keys: %v", err)
+	}
+	if err := os.Chmod(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to restrict the permissions of the directory of the keys: %v", err)
+	}
+	p := &FilePlugin{
+		dir:        dir,
+		generation: uint64(time.Now().UnixNano()),
+	}
+	return p, nil
+}
+
+// GenerateKey generates a key, and writes it to a new file.
+func (p *FilePlugin) GenerateKey(name string, options security.KeyOptions) (*security.PrivateKey, crypto.Signer, error) {
+	signer, keyPEM, err := pkiutil.GenKey(certOptions(options))
+	if err != nil {
+		return nil, nil, err
+	}
+	path := filepath.Join(p.dir, fmt.Sprintf("%s-%d-key.pem",
+		invalidFileNameChars.ReplaceAllString(name, "_"), atomic.AddUint64(&p.generation, 1)))
+	// The temporary file is created with 0600 permissions, and renamed so that the key file is
+	// never read partially written.
+	tmp, err := ioutil.TempFile(p.dir, ".key-")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create the key file: %v", err)
+	}
+	_, err = tmp.Write(keyPEM)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return nil, nil, fmt.Errorf("failed to write the key file: %v", err)
+	}
+	filekeyLog.Debugf("generated key %s for %s", path, name)
+	return &security.PrivateKey{ID: path, Path: path}, signer, nil
+}
+
+// DeleteKey removes the file of the key.
+func (p *FilePlugin) DeleteKey(key *security.PrivateKey) error {
+	if err := os.Remove(key.Path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	filekeyLog.Debugf("deleted key %s", key.Path)
+	return nil
+}
+
+// GetType returns key provider type.
+func (p *FilePlugin) GetType() string {
+	return security.KeyProviderFile
+}
@@ -0,0 +1,60 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"crypto"
+
+	"istio.io/istio/pkg/security"
+	pkiutil "istio.io/istio/security/pkg/pki/util"
+)
+
+// The plugin object.
+type MemoryPlugin struct {
+}
+
+// CreateMemoryPlugin creates a key provider plugin which holds the keys in memory, and sends them
+// to the proxy. Return the pointer to the created plugin.
+func CreateMemoryPlugin() *MemoryPlugin {
+	p := &MemoryPlugin{}
+	return p
+}
+
+// GenerateKey generates a key held in memory.
+func (p *MemoryPlugin) GenerateKey(name string, options security.KeyOptions) (*security.PrivateKey, crypto.Signer, error) {
+	signer, keyPEM, err := pkiutil.GenKey(certOptions(options))
+	if err != nil {
+		return nil, nil, err
+	}
+	return &security.PrivateKey{ID: name, PEM: keyPEM}, signer, nil
+}
+
+// DeleteKey does nothing, the key is released along with the secret holding it.
+func (p *MemoryPlugin) DeleteKey(*security.PrivateKey) error {
+	return nil
+}
+
+// GetType returns key provider type.
+func (p *MemoryPlugin) GetType() string {
+	return security.KeyProviderMemory
+}
+
+func certOptions(options security.KeyOptions) pkiutil.CertOptions {
+	return pkiutil.CertOptions{
+		RSAKeySize: options.RSAKeySize,
+		ECSigAlg:   pkiutil.SupportedECSignatureAlgorithms(options.ECSigAlg),
+		PKCS8Key:   options.PKCS8,
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"crypto"
+	"crypto/tls"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"istio.io/istio/pkg/security"
+	pkiutil "istio.io/istio/security/pkg/pki/util"
+)
+
+// signAndCheck signs a certificate for the key, and checks that the certificate matches the key PEM.
+func signAndCheck(t *testing.T, signer crypto.Signer, keyPEM []byte) {
+	t.Helper()
+	csrPEM, err := pkiutil.GenCSRWithSigner(pkiutil.CertOptions{Host: "spiffe://cluster.local/ns/foo/sa/bar"}, signer)
+	if err != nil {
+		t.Fatalf("failed to generate CSR: %v", err)
+	}
+	csr, err := pkiutil.ParsePemEncodedCSR(csrPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		t.Fatalf("invalid CSR signature: %v", err)
+	}
+	if keyPEM == nil {
+		return
+	}
+	caCertPEM, caKeyPEM, err := pkiutil.GenCertKeyFromOptions(pkiutil.CertOptions{
+		Org: "ca", IsCA: true, IsSelfSigned: true, TTL: time.Hour, RSAKeySize: 2048})
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, _ := pkiutil.ParsePemEncodedCertificate(caCertPEM)
+	caKey, _ := pkiutil.ParsePemEncodedKey(caKeyPEM)
+	certDER, err := pkiutil.GenCertFromCSR(csr, caCert, csr.PublicKey, caKey, nil, time.Hour, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tls.X509KeyPair(certPEM(certDER), keyPEM); err != nil {
+		t.Fatalf("the key PEM does not match the signer: %v", err)
+	}
+}
+
+func TestMemoryPlugin(t *testing.T) {
+	p := CreateMemoryPlugin()
+	for name, options := range map[string]security.KeyOptions{
+		"rsa":   {RSAKeySize: 2048},
+		"ecdsa": {ECSigAlg: string(pkiutil.EcdsaSigAlg), PKCS8: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			key, signer, err := p.GenerateKey("default", options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if key.Path != "" || key.Provider != nil {
+				t.Errorf("expected the key to be held in memory, got %+v", key)
+			}
+			signAndCheck(t, signer, key.PEM)
+		})
+	}
+}
+
+func TestFilePlugin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filekey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	keyDir := filepath.Join(dir, "keys")
+	p, err := CreateFilePlugin(keyDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(keyDir); err != nil || info.Mode().Perm() != 0700 {
+		t.Fatalf("expected the key directory to be only accessible to its owner, got %v %v", info.Mode(), err)
+	}
+
+	key, signer, err := p.GenerateKey("proxy~10.0.0.1~pod.ns~ns.svc.cluster.local-1-default", security.KeyOptions{RSAKeySize: 2048})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.PEM != nil || key.Provider != nil || filepath.Dir(key.Path) != keyDir {
+		t.Fatalf("expected the key to be held in a file of the key directory, got %+v", key)
+	}
+	info, err := os.Stat(key.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected the key file to be only accessible to its owner, got %v", info.Mode())
+	}
+	keyPEM, err := ioutil.ReadFile(key.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signAndCheck(t, signer, keyPEM)
+
+	// Every key has its own file.
+	next, _, err := p.GenerateKey("proxy~10.0.0.1~pod.ns~ns.svc.cluster.local-1-default", security.KeyOptions{RSAKeySize: 2048})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Path == key.Path {
+		t.Errorf("expected a new file for the new key, got %s", next.Path)
+	}
+	if err := p.DeleteKey(key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(key.Path); !os.IsNotExist(err) {
+		t.Errorf("expected the key file to be deleted, got %v", err)
+	}
+	if _, err := os.Stat(next.Path); err != nil {
+		t.Errorf("expected the new key file to be kept, got %v", err)
+	}
+	if err := p.DeleteKey(key); err != nil {
+		t.Errorf("expected deleting a deleted key to succeed, got %v", err)
+	}
+}
+
+func certPEM(der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
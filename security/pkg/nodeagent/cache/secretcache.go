@@ -18,11 +18,13 @@ package cache
 import (
 	"bytes"
 	"context"
+	"crypto"
 	"crypto/tls"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"math/rand"
+	"os"
 	"path/filepath"
 	"strings"
 	"sync"
@@ -35,6 +37,7 @@ import (
 	"istio.io/istio/pkg/mcp/status"
 	"istio.io/istio/pkg/security"
 	"istio.io/istio/pkg/spiffe"
+	keyplugin "istio.io/istio/security/pkg/keyprovider/plugin"
 	"istio.io/istio/security/pkg/nodeagent/secretfetcher"
 	nodeagentutil "istio.io/istio/security/pkg/nodeagent/util"
 	pkiutil "istio.io/istio/security/pkg/pki/util"
@@ -142,11 +145,18 @@ type SecretCache struct {
 	existingKeyFile       string
 	existingRootCertFile  string
 
+	// crlFile is the path of the certificate revocation list published by the CA.
+	crlFile  string
+	crlWatch sync.Once
+
 	// certWatcher watches the certificates for changes and triggers a notification to proxy.
 	certWatcher filewatcher.FileWatcher
 	// unique certs being watched with file watcher.
 	fileCerts map[string]map[ConnKey]struct{}
 	certMutex *sync.RWMutex
+
+	// keyProvider generates and holds the private keys of the certificates signed by the CA.
+	keyProvider security.KeyProvider
 }
 
 // NewSecretCache creates a new secret cache.
@@ -162,9 +172,14 @@ func NewSecretCache(fetcher *secretfetcher.SecretFetcher,
 		existingCertChainFile: security.DefaultCertChainFilePath,
 		existingKeyFile:       security.DefaultKeyFilePath,
 		existingRootCertFile:  security.DefaultRootCertFilePath,
+		crlFile:               options.CRLFilePath,
 		certWatcher:           newFileWatcher(),
 		fileCerts:             make(map[string]map[ConnKey]struct{}),
 		certMutex:             &sync.RWMutex{},
+		keyProvider:           options.KeyProvider,
+	}
+	if ret.keyProvider == nil {
+		ret.keyProvider = keyplugin.CreateMemoryPlugin()
 	}
 	randSource := rand.NewSource(time.Now().UnixNano())
 	ret.rand = rand.New(randSource)
@@ -234,7 +249,7 @@ func (sc *SecretCache) GenerateSecret(ctx context.Context, connectionID, resourc
 		}
 
 		cacheLog.Infoa("GenerateSecret ", resourceName)
-		sc.secrets.Store(connKey, *ns)
+		sc.storeSecret(connKey, ns)
 		return ns, nil
 	}
 
@@ -264,6 +279,7 @@ func (sc *SecretCache) GenerateSecret(ctx context.Context, connectionID, resourc
 	ns = &security.SecretItem{
 		ResourceName: resourceName,
 		RootCert:     rootCert,
+		CRL:          sc.readCRL(),
 		ExpireTime:   rootCertExpr,
 		Token:        token,
 		CreatedTime:  t,
@@ -271,6 +287,7 @@ func (sc *SecretCache) GenerateSecret(ctx context.Context, connectionID, resourc
 	}
 	cacheLog.Infoa("Loaded root cert from certificate ", resourceName)
 	sc.secrets.Store(connKey, *ns)
+	sc.addCRLWatcher()
 	cacheLog.Debugf("%s successfully generate secret for proxy", logPrefix)
 	return ns, nil
 }
@@ -331,6 +348,81 @@ func (sc *SecretCache) addFileWatcher(file string, token string, connKey ConnKey
 	}()
 }
 
+// readCRL returns the certificate revocation list published by the CA, or nil if there is none.
+func (sc *SecretCache) readCRL() []byte {
+	if sc.crlFile == "" {
+		return nil
+	}
+	crl, err := ioutil.ReadFile(sc.crlFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			cacheLog.Warnf("failed to read certificate revocation list %s: %v", sc.crlFile, err)
+		}
+		return nil
+	}
+	if len(bytes.TrimSpace(crl)) == 0 {
+		return nil
+	}
+	return crl
+}
+
+// addCRLWatcher starts watching the certificate revocation list file, and pushes the root
+// certificate with the new revocation list to the proxies whenever it changes.
+func (sc *SecretCache) addCRLWatcher() {
+	if sc.crlFile == "" {
+		return
+	}
+	sc.crlWatch.Do(func() {
+		if err := sc.certWatcher.Add(sc.crlFile); err != nil {
+			cacheLog.Warnf("error adding watcher for certificate revocation list %s: %v", sc.crlFile, err)
+			return
+		}
+		events := sc.certWatcher.Events(sc.crlFile)
+		go func() {
+			var timerC <-chan time.Time
+			for {
+				select {
+				case <-timerC:
+					timerC = nil
+					sc.updateCRL()
+				case e, ok := <-events:
+					if !ok {
+						return
+					}
+					// Use a timer to debounce watch updates
+					if len(e.Op.String()) > 0 && timerC == nil {
+						timerC = time.After(100 * time.Millisecond)
+					}
+				}
+			}
+		}()
+	})
+}
+
+// updateCRL reloads the certificate revocation list and pushes it to the root certificate
+// connections using a different one.
+func (sc *SecretCache) updateCRL() {
+	crl := sc.readCRL()
+	sc.secrets.Range(func(k interface{}, v interface{}) bool {
+		connKey := k.(ConnKey)
+		if connKey.ResourceName != RootCertReqResourceName {
+			return true
+		}
+		secret := v.(security.SecretItem)
+		if bytes.Equal(secret.CRL, crl) {
+			return true
+		}
+		now := time.Now()
+		secret.CRL = crl
+		secret.CreatedTime = now
+		secret.Version = now.String()
+		sc.secrets.Store(connKey, secret)
+		cacheLog.Infof("%v: certificate revocation list changed, triggering secret push to proxy", connKey)
+		sc.callbackWithTimeout(connKey, &secret)
+		return true
+	})
+}
+
 // SecretExist checks if secret already existed.
 // This API is used for sds server to check if coming request is ack request.
 func (sc *SecretCache) SecretExist(connectionID, resourceName, token, version string) bool {
@@ -395,7 +487,32 @@ func (sc *SecretCache) DeleteSecret(connectionID, resourceName string) {
 		ConnectionID: connectionID,
 		ResourceName: resourceName,
 	}
-	sc.secrets.Delete(connKey)
+	if v, ok := sc.secrets.Load(connKey); ok {
+		sc.secrets.Delete(connKey)
+		secret := v.(security.SecretItem)
+		sc.releaseKey(connKey, &secret)
+	}
+}
+
+// storeSecret caches the secret generated for the connection, and deletes the key of the secret it replaces.
+func (sc *SecretCache) storeSecret(connKey ConnKey, ns *security.SecretItem) {
+	if v, ok := sc.secrets.Load(connKey); ok {
+		old := v.(security.SecretItem)
+		if old.ProviderKey != ns.ProviderKey {
+			defer sc.releaseKey(connKey, &old)
+		}
+	}
+	sc.secrets.Store(connKey, *ns)
+}
+
+// releaseKey deletes the private key of a secret which is no longer used, if the key is held by the key provider.
+func (sc *SecretCache) releaseKey(connKey ConnKey, secret *security.SecretItem) {
+	if secret.ProviderKey == nil {
+		return
+	}
+	if err := sc.keyProvider.DeleteKey(secret.ProviderKey); err != nil {
+		cacheLog.Warnf("%s failed to delete the private key %s: %v", cacheLogPrefix(connKey.ResourceName), secret.ProviderKey.ID, err)
+	}
 }
 
 func (sc *SecretCache) callbackWithTimeout(connKey ConnKey, secret *security.SecretItem) {
@@ -545,6 +662,7 @@ func (sc *SecretCache) rotate(updateRootFlag bool) {
 			ns := &security.SecretItem{
 				ResourceName: connKey.ResourceName,
 				RootCert:     rootCert,
+				CRL:          sc.readCRL(),
 				ExpireTime:   rootCertExpr,
 				Token:        secret.Token,
 				CreatedTime:  now,
@@ -567,6 +685,7 @@ func (sc *SecretCache) rotate(updateRootFlag bool) {
 		// Remove stale secrets from cache, this prevents the cache growing indefinitely.
 		if sc.configOptions.EvictionDuration != 0 && now.After(secret.CreatedTime.Add(sc.configOptions.EvictionDuration)) {
 			sc.secrets.Delete(connKey)
+			sc.releaseKey(connKey, &secret)
 			return true
 		}
 
@@ -640,7 +759,7 @@ func (sc *SecretCache) rotate(updateRootFlag bool) {
 	secretMap.Range(func(k interface{}, v interface{}) bool {
 		key := k.(ConnKey)
 		secret := v.(*security.SecretItem)
-		sc.secrets.Store(key, *secret)
+		sc.storeSecret(key, secret)
 		return true
 	})
 }
@@ -855,16 +974,42 @@ func (sc *SecretCache) generateSecret(ctx context.Context, token string, connKey
 
 	cacheLog.Debugf("constructed host name for CSR: %s", csrHostName.String())
 	options := pkiutil.CertOptions{
-		Host:       csrHostName.String(),
+		Host: csrHostName.String(),
+	}
+
+	// Generate the key and CSR, send CSR to CA.
+	key, signer, err := sc.keyProvider.GenerateKey(connKey.ConnectionID+"-"+connKey.ResourceName, security.KeyOptions{
 		RSAKeySize: keySize,
-		PKCS8Key:   sc.configOptions.Pkcs8Keys,
-		ECSigAlg:   pkiutil.SupportedECSignatureAlgorithms(sc.configOptions.ECCSigAlg),
+		ECSigAlg:   sc.configOptions.ECCSigAlg,
+		PKCS8:      sc.configOptions.Pkcs8Keys,
+	})
+	if err != nil {
+		cacheLog.Errorf("%s failed to generate key for CSR: %v", logPrefix, err)
+		return nil, err
 	}
+	sitem, err := sc.signKey(ctx, token, exchangedToken, connKey, t, key, signer, options)
+	if err != nil {
+		sc.releaseKey(connKey, &security.SecretItem{ProviderKey: providerKey(key)})
+		return nil, err
+	}
+	return sitem, nil
+}
 
-	// Generate the cert/key, send CSR to CA.
-	csrPEM, keyPEM, err := pkiutil.GenCSR(options)
+// providerKey returns the key if it is held by the key provider, rather than sent to the proxy.
+func providerKey(key *security.PrivateKey) *security.PrivateKey {
+	if key.PEM != nil {
+		return nil
+	}
+	return key
+}
+
+// signKey sends the CSR of the key to the CA, and returns the secret with the signed certificate.
+func (sc *SecretCache) signKey(ctx context.Context, token, exchangedToken string, connKey ConnKey, t time.Time,
+	key *security.PrivateKey, signer crypto.Signer, options pkiutil.CertOptions) (*security.SecretItem, error) {
+	logPrefix := cacheLogPrefix(connKey.ResourceName)
+	csrPEM, err := pkiutil.GenCSRWithSigner(options, signer)
 	if err != nil {
-		cacheLog.Errorf("%s failed to generate key and certificate for CSR: %v", logPrefix, err)
+		cacheLog.Errorf("%s failed to generate CSR: %v", logPrefix, err)
 		return nil, err
 	}
 
@@ -914,7 +1059,8 @@ func (sc *SecretCache) generateSecret(ctx context.Context, token string, connKey
 
 	return &security.SecretItem{
 		CertificateChain: certChain,
-		PrivateKey:       keyPEM,
+		PrivateKey:       key.PEM,
+		ProviderKey:      providerKey(key),
 		ResourceName:     connKey.ResourceName,
 		Token:            token,
 		CreatedTime:      t,
@@ -17,6 +17,7 @@ package cache
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -34,6 +35,7 @@ import (
 	"k8s.io/client-go/kubernetes/fake"
 
 	"istio.io/istio/pkg/security"
+	keyplugin "istio.io/istio/security/pkg/keyprovider/plugin"
 	"istio.io/istio/security/pkg/nodeagent/cache/mock"
 	"istio.io/istio/security/pkg/nodeagent/secretfetcher"
 	nodeagentutil "istio.io/istio/security/pkg/nodeagent/util"
@@ -315,6 +317,140 @@ func TestWorkloadAgentRefreshSecret(t *testing.T) {
 	}
 }
 
+// TestWorkloadAgentRootCertCRL verifies that the CA revocation list is sent with the root cert,
+// and pushed to the proxy when it changes.
+func TestWorkloadAgentRootCertCRL(t *testing.T) {
+	fakeCACli, err := mock.NewMockCAClient(0, time.Hour)
+	if err != nil {
+		t.Fatalf("Error creating Mock CA client: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "crl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	crlPath := filepath.Join(dir, "crl.pem")
+	if err := ioutil.WriteFile(crlPath, []byte("crl-1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opt := &security.Options{
+		RotationInterval: 2 * time.Hour,
+		EvictionDuration: 0,
+		CRLFilePath:      crlPath,
+	}
+	fetcher := &secretfetcher.SecretFetcher{
+		CaClient: fakeCACli,
+	}
+
+	var wgAddedWatch sync.WaitGroup
+	addedWatchProbe := func(_ string, _ bool) { wgAddedWatch.Done() }
+	var fakeWatcher *filewatcher.FakeWatcher
+	newFileWatcher, fakeWatcher = filewatcher.NewFakeWatcher(addedWatchProbe)
+	pushed := make(chan *security.SecretItem, 1)
+	sc := NewSecretCache(fetcher, func(_ ConnKey, secret *security.SecretItem) error {
+		pushed <- secret
+		return nil
+	}, opt)
+	defer func() {
+		sc.Close()
+		newFileWatcher = filewatcher.NewWatcher
+	}()
+
+	conID := "proxy1-id"
+	ctx := context.Background()
+	if _, err := sc.GenerateSecret(ctx, conID, WorkloadKeyCertResourceName, "jwtToken1"); err != nil {
+		t.Fatalf("Failed to get secrets: %v", err)
+	}
+	wgAddedWatch.Add(1) // Watch should be added for the CRL file.
+	gotSecretRoot, err := sc.GenerateSecret(ctx, conID, RootCertReqResourceName, "jwtToken1")
+	if err != nil {
+		t.Fatalf("Failed to get secrets: %v", err)
+	}
+	wgAddedWatch.Wait()
+	if got := string(gotSecretRoot.CRL); got != "crl-1" {
+		t.Errorf("Got unexpected CRL %q", got)
+	}
+
+	if err := ioutil.WriteFile(crlPath, []byte("crl-2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fakeWatcher.InjectEvent(crlPath, fsnotify.Event{
+		Name: crlPath,
+		Op:   fsnotify.Write,
+	})
+	select {
+	case secret := <-pushed:
+		if secret.ResourceName != RootCertReqResourceName || string(secret.CRL) != "crl-2" {
+			t.Errorf("Got unexpected secret push %s with CRL %q", secret.ResourceName, secret.CRL)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for the CRL push")
+	}
+	checkBool(t, "SecretExist", sc.SecretExist(conID, RootCertReqResourceName, "jwtToken1", gotSecretRoot.Version), false)
+}
+
+// TestWorkloadAgentKeyProvider verifies that the keys held by the key provider are not sent to the proxy,
+// and are deleted once their secret is replaced or deleted.
+func TestWorkloadAgentKeyProvider(t *testing.T) {
+	fakeCACli, err := mock.NewMockCAClient(0, time.Hour)
+	if err != nil {
+		t.Fatalf("Error creating Mock CA client: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	keyProvider, err := keyplugin.CreateFilePlugin(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opt := &security.Options{
+		RotationInterval: 2 * time.Hour,
+		EvictionDuration: 0,
+		KeyProvider:      keyProvider,
+	}
+	fetcher := &secretfetcher.SecretFetcher{
+		CaClient: fakeCACli,
+	}
+	sc := NewSecretCache(fetcher, notifyCb, opt)
+	defer sc.Close()
+
+	conID := "proxy1-id"
+	generate := func() *security.SecretItem {
+		t.Helper()
+		secret, err := sc.GenerateSecret(context.Background(), conID, WorkloadKeyCertResourceName, "jwtToken1")
+		if err != nil {
+			t.Fatalf("Failed to get secrets: %v", err)
+		}
+		if secret.PrivateKey != nil || secret.ProviderKey == nil {
+			t.Fatalf("Expected the key to be held by the key provider, got %+v", secret)
+		}
+		keyPEM, err := ioutil.ReadFile(secret.ProviderKey.Path)
+		if err != nil {
+			t.Fatalf("Failed to read the key file: %v", err)
+		}
+		if _, err := tls.X509KeyPair(secret.CertificateChain, keyPEM); err != nil {
+			t.Fatalf("The key file does not match the certificate: %v", err)
+		}
+		return secret
+	}
+	exists := func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}
+
+	first := generate()
+	second := generate()
+	if exists(first.ProviderKey.Path) || !exists(second.ProviderKey.Path) {
+		t.Errorf("Expected the key of the replaced secret to be deleted")
+	}
+	sc.DeleteSecret(conID, WorkloadKeyCertResourceName)
+	if exists(second.ProviderKey.Path) {
+		t.Errorf("Expected the key of the deleted secret to be deleted")
+	}
+}
+
 // TestGatewayAgentGenerateSecret verifies that ingress gateway agent manages secret cache correctly.
 func TestGatewayAgentGenerateSecret(t *testing.T) {
 	sc := createSecretCache()
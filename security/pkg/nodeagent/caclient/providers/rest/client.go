@@ -0,0 +1,341 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"istio.io/istio/pkg/security"
+	"istio.io/pkg/log"
+)
+
+const (
+	// AuthToken authenticates the CSR with the workload token, sent as a bearer token
+	// in the Authorization header.
+	AuthToken = "token"
+	// AuthOTT authenticates the CSR with the workload token, sent as the one-time token
+	// in the "ott" field of the request body, as expected by the step-ca sign API.
+	AuthOTT = "ott"
+	// AuthMTLS authenticates the CSR with the client certificate only.
+	AuthMTLS = "mtls"
+
+	bearerTokenPrefix   = "Bearer "
+	pemChainContentType = "application/pem-certificate-chain"
+	requestTimeout      = 30 * time.Second
+	maxResponseSize     = 1 << 20
+)
+
+var restClientLog = log.RegisterScope("restca", "REST CA client debugging", 0)
+
+// Options configures the CA client.
+type Options struct {
+	// Endpoint is the URL to which the CSRs are posted.
+	Endpoint string
+
+	// TLSRootCert is the PEM encoded root used to verify the CA server. The system roots are
+	// used when it is empty.
+	TLSRootCert []byte
+
+	// Auth is the authentication method of the CSR: AuthToken (the default), AuthOTT or AuthMTLS.
+	Auth string
+
+	// TokenFile is the file holding the token used to authenticate with the CA. The file is read for
+	// every CSR, so that rotated tokens are picked up. If empty, the workload token is used.
+	TokenFile string
+
+	// ClientCertFile and ClientKeyFile are the client certificate presented to the CA. They are
+	// required with AuthMTLS, and optional otherwise. They are reloaded for every connection.
+	ClientCertFile string
+	ClientKeyFile  string
+
+	// RootCert is the PEM encoded root of the PKI issuing the workload certificates. It is appended
+	// to the certificate chain returned by the CA, when the chain does not end with a root.
+	RootCert []byte
+}
+
+// signRequest is the body of the CSR request.
+type signRequest struct {
+	CSR string `json:"csr"`
+	// OTT is the one-time token authenticating the request, with AuthOTT.
+	OTT string `json:"ott,omitempty"`
+	// NotAfter is the requested validity of the certificate, as a duration such as "24h0m0s".
+	NotAfter string `json:"notAfter,omitempty"`
+}
+
+// signResponse is the JSON body of the CSR response. CertChain is used when set, otherwise the chain
+// is Crt followed by the certificates in CA.
+type signResponse struct {
+	CertChain []string `json:"certChain"`
+	Crt       string   `json:"crt"`
+	CA        string   `json:"ca"`
+}
+
+type restClient struct {
+	opts     Options
+	client   *http.Client
+	rootCert string
+}
+
+// NewRESTClient creates a CA client, which posts the CSRs to the endpoint of an external CA.
+// The response is either a JSON document, or a PEM encoded certificate chain.
+func NewRESTClient(opts Options) (security.Client, error) {
+	u, err := url.Parse(opts.Endpoint)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("invalid CA endpoint %q: expected an http or https URL", opts.Endpoint)
+	}
+	if opts.Auth == "" {
+		opts.Auth = AuthToken
+	}
+	switch opts.Auth {
+	case AuthToken, AuthOTT:
+	case AuthMTLS:
+		if opts.ClientCertFile == "" || opts.ClientKeyFile == "" {
+			return nil, fmt.Errorf("the %s authentication requires a client certificate and key", AuthMTLS)
+		}
+		if u.Scheme != "https" {
+			return nil, fmt.Errorf("the %s authentication requires an https CA endpoint, got %q", AuthMTLS, opts.Endpoint)
+		}
+	default:
+		return nil, fmt.Errorf("unknown CA authentication %q, expected one of %s, %s or %s", opts.Auth, AuthToken, AuthOTT, AuthMTLS)
+	}
+	if (opts.ClientCertFile == "") != (opts.ClientKeyFile == "") {
+		return nil, fmt.Errorf("both the client certificate and key must be set")
+	}
+
+	c := &restClient{opts: opts}
+	if len(opts.RootCert) > 0 {
+		roots, err := parseCertChain(opts.RootCert)
+		if err != nil || len(roots) != 1 || !isSelfSigned(roots[0]) {
+			return nil, fmt.Errorf("invalid root certificate: expected a single self-signed certificate")
+		}
+		c.rootCert = encodeCert(roots[0])
+	}
+
+	tlsConfig := &tls.Config{}
+	if len(opts.TLSRootCert) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(opts.TLSRootCert) {
+			return nil, fmt.Errorf("failed to append a certificate (%v) to the certificate pool", string(opts.TLSRootCert))
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if opts.ClientCertFile != "" {
+		tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, err := tls.LoadX509KeyPair(opts.ClientCertFile, opts.ClientKeyFile)
+			if err != nil {
+				restClientLog.Errorf("failed to load the client certificate: %v", err)
+				return nil, err
+			}
+			return &cert, nil
+		}
+	}
+	c.client = &http.Client{
+		Timeout:   requestTimeout,
+		Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig},
+	}
+	restClientLog.Infof("created REST CA client for %s with %s authentication", opts.Endpoint, opts.Auth)
+	return c, nil
+}
+
+// CSRSign posts the CSR to the CA. Errors carry a gRPC status derived from the HTTP status of the
+// response, so that transient failures are retried by the caller.
+func (c *restClient) CSRSign(ctx context.Context, reqID string, csrPEM []byte, token string,
+	certValidTTLInSec int64) ([]string /*PEM-encoded certificate chain*/, error) {
+	token, err := c.token(token)
+	if err != nil {
+		return nil, err
+	}
+	body := signRequest{CSR: string(csrPEM)}
+	if certValidTTLInSec > 0 {
+		body.NotAfter = (time.Duration(certValidTTLInSec) * time.Second).String()
+	}
+	if c.opts.Auth == AuthOTT {
+		body.OTT = token
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, c.opts.Endpoint, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, "+pemChainContentType)
+	req.Header.Set("X-Request-Id", reqID)
+	if c.opts.Auth == AuthToken && token != "" {
+		req.Header.Set("Authorization", bearerTokenPrefix+token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		restClientLog.Errorf("failed to send the CSR to %s: %v", c.opts.Endpoint, err)
+		return nil, status.Errorf(codes.Unavailable, "failed to send the CSR to %s: %v", c.opts.Endpoint, err)
+	}
+	defer resp.Body.Close()
+	data, err = ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "failed to read the CSR response from %s: %v", c.opts.Endpoint, err)
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		restClientLog.Errorf("CA %s rejected the CSR with status %d: %s", c.opts.Endpoint, resp.StatusCode, bytes.TrimSpace(data))
+		return nil, status.Errorf(codeForHTTPStatus(resp.StatusCode), "CA %s rejected the CSR with status %d: %s",
+			c.opts.Endpoint, resp.StatusCode, bytes.TrimSpace(data))
+	}
+
+	certChain, err := c.parseResponse(resp.Header.Get("Content-Type"), data)
+	if err != nil {
+		restClientLog.Errorf("invalid CSR response from %s: %v", c.opts.Endpoint, err)
+		return nil, status.Errorf(codes.Unknown, "invalid CSR response from %s: %v", c.opts.Endpoint, err)
+	}
+	return certChain, nil
+}
+
+// token returns the token authenticating the CSR.
+func (c *restClient) token(workloadToken string) (string, error) {
+	if c.opts.Auth == AuthMTLS {
+		return "", nil
+	}
+	if c.opts.TokenFile == "" {
+		return workloadToken, nil
+	}
+	token, err := ioutil.ReadFile(c.opts.TokenFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the CA token: %v", err)
+	}
+	return strings.TrimSpace(string(token)), nil
+}
+
+// parseResponse returns the PEM encoded certificate chain of the response, starting with the
+// workload certificate and ending with the root.
+func (c *restClient) parseResponse(contentType string, data []byte) ([]string, error) {
+	var chain []*x509.Certificate
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == "application/json" {
+		resp := signResponse{}
+		if err := json.Unmarshal(data, &resp); err != nil {
+			return nil, fmt.Errorf("failed to parse the JSON response: %v", err)
+		}
+		pemChain := resp.CertChain
+		if len(pemChain) == 0 {
+			pemChain = []string{resp.Crt, resp.CA}
+		}
+		for _, certs := range pemChain {
+			parsed, err := parseCertChain([]byte(certs))
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, parsed...)
+		}
+	} else {
+		parsed, err := parseCertChain(data)
+		if err != nil {
+			return nil, err
+		}
+		chain = parsed
+	}
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("no certificate in the response")
+	}
+
+	certChain := make([]string, 0, len(chain)+1)
+	for _, cert := range chain {
+		certChain = append(certChain, encodeCert(cert))
+	}
+	if !isSelfSigned(chain[len(chain)-1]) {
+		if c.rootCert == "" {
+			restClientLog.Warnf("the certificate chain of the CA %s does not end with a root, and no root is configured", c.opts.Endpoint)
+		} else {
+			certChain = append(certChain, c.rootCert)
+		}
+	}
+	if len(certChain) <= 1 {
+		return nil, fmt.Errorf("certificate chain length is %d, expected more than 1", len(certChain))
+	}
+	return certChain, nil
+}
+
+// parseCertChain parses the PEM encoded certificates in data. Other PEM blocks are ignored.
+func parseCertChain(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+func encodeCert(cert *x509.Certificate) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+}
+
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignatureFrom(cert) == nil
+}
+
+// codeForHTTPStatus maps the HTTP status of a failed CSR to the gRPC code whose retry policy matches it.
+func codeForHTTPStatus(code int) codes.Code {
+	switch code {
+	case http.StatusUnauthorized, http.StatusNetworkAuthenticationRequired:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusNotImplemented, http.StatusHTTPVersionNotSupported:
+		return codes.Unimplemented
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return codes.Unavailable
+	}
+	if code >= 500 {
+		return codes.Internal
+	}
+	if code >= 400 {
+		return codes.InvalidArgument
+	}
+	return codes.Unknown
+}
@@ -0,0 +1,282 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caclient
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+type testCert struct {
+	certPem []byte
+	keyPem  []byte
+}
+
+func newTestCert(t *testing.T, opts util.CertOptions, signer *testCert) *testCert {
+	t.Helper()
+	opts.TTL = time.Hour
+	opts.RSAKeySize = 2048
+	if signer == nil {
+		opts.IsSelfSigned = true
+	} else {
+		cert, err := util.ParsePemEncodedCertificate(signer.certPem)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := util.ParsePemEncodedKey(signer.keyPem)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts.SignerCert, opts.SignerPriv = cert, key
+	}
+	certPem, keyPem, err := util.GenCertKeyFromOptions(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{certPem: certPem, keyPem: keyPem}
+}
+
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCSRSign(t *testing.T) {
+	root := newTestCert(t, util.CertOptions{Org: "root", IsCA: true}, nil)
+	intermediate := newTestCert(t, util.CertOptions{Org: "intermediate", IsCA: true}, root)
+	leaf := newTestCert(t, util.CertOptions{Host: "spiffe://cluster.local/ns/foo/sa/bar", IsServer: true, IsClient: true}, intermediate)
+	clientCert := newTestCert(t, util.CertOptions{Host: "spiffe://cluster.local/ns/istio-system/sa/ca-client", IsClient: true}, root)
+
+	dir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tokenFile := writeFile(t, dir, "token", []byte("static-token\n"))
+	clientCertFile := writeFile(t, dir, "cert.pem", clientCert.certPem)
+	clientKeyFile := writeFile(t, dir, "key.pem", clientCert.keyPem)
+
+	fullChain := []string{string(leaf.certPem), string(intermediate.certPem), string(root.certPem)}
+	testCases := []struct {
+		name        string
+		opts        Options
+		token       string
+		contentType string
+		status      int
+		response    string
+		// expectedRequest is the request received by the CA, with its Authorization header.
+		expectedRequest signRequest
+		expectedAuth    string
+		expectedChain   []string
+		expectedCode    codes.Code
+	}{
+		{
+			name:            "json chain with bearer token",
+			token:           "workload-token",
+			contentType:     "application/json",
+			status:          http.StatusOK,
+			response:        mustJSON(t, signResponse{CertChain: fullChain}),
+			expectedRequest: signRequest{NotAfter: "1h0m0s"},
+			expectedAuth:    "Bearer workload-token",
+			expectedChain:   fullChain,
+		},
+		{
+			name:            "step-ca response with one-time token and configured root",
+			opts:            Options{Auth: AuthOTT, RootCert: root.certPem},
+			token:           "workload-token",
+			contentType:     "application/json; charset=utf-8",
+			status:          http.StatusCreated,
+			response:        mustJSON(t, signResponse{Crt: string(leaf.certPem), CA: string(intermediate.certPem)}),
+			expectedRequest: signRequest{OTT: "workload-token", NotAfter: "1h0m0s"},
+			expectedChain:   fullChain,
+		},
+		{
+			name:            "pem chain with token file",
+			opts:            Options{TokenFile: tokenFile},
+			token:           "workload-token",
+			contentType:     pemChainContentType,
+			status:          http.StatusOK,
+			response:        strings.Join(fullChain, ""),
+			expectedRequest: signRequest{NotAfter: "1h0m0s"},
+			expectedAuth:    "Bearer static-token",
+			expectedChain:   fullChain,
+		},
+		{
+			name:            "mutual tls",
+			opts:            Options{Auth: AuthMTLS, ClientCertFile: clientCertFile, ClientKeyFile: clientKeyFile},
+			token:           "workload-token",
+			contentType:     pemChainContentType,
+			status:          http.StatusOK,
+			response:        strings.Join(fullChain, ""),
+			expectedRequest: signRequest{NotAfter: "1h0m0s"},
+			expectedChain:   fullChain,
+		},
+		{
+			name:            "unavailable CA is retryable",
+			status:          http.StatusServiceUnavailable,
+			response:        "try again later",
+			expectedRequest: signRequest{NotAfter: "1h0m0s"},
+			expectedCode:    codes.Unavailable,
+		},
+		{
+			name:            "rejected CSR",
+			token:           "workload-token",
+			status:          http.StatusForbidden,
+			response:        "not allowed",
+			expectedRequest: signRequest{NotAfter: "1h0m0s"},
+			expectedAuth:    "Bearer workload-token",
+			expectedCode:    codes.PermissionDenied,
+		},
+		{
+			name:            "response without certificates",
+			contentType:     "application/json",
+			status:          http.StatusOK,
+			response:        "{}",
+			expectedRequest: signRequest{NotAfter: "1h0m0s"},
+			expectedCode:    codes.Unknown,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var request signRequest
+			var auth string
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				auth = r.Header.Get("Authorization")
+				if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+					t.Errorf("invalid request: %v", err)
+				}
+				if tc.opts.Auth == AuthMTLS && len(r.TLS.PeerCertificates) == 0 {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				w.Header().Set("Content-Type", tc.contentType)
+				w.WriteHeader(tc.status)
+				_, _ = w.Write([]byte(tc.response))
+			}))
+			server.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+			server.StartTLS()
+			defer server.Close()
+
+			opts := tc.opts
+			opts.Endpoint = server.URL + "/1.0/sign"
+			opts.TLSRootCert = certPEM(server.Certificate().Raw)
+			client, err := NewRESTClient(opts)
+			if err != nil {
+				t.Fatalf("failed to create client: %v", err)
+			}
+			chain, err := client.CSRSign(context.Background(), "12345", []byte("csr"), tc.token, 3600)
+			if code := status.Code(err); code != tc.expectedCode {
+				t.Fatalf("expected code %v, got error %v", tc.expectedCode, err)
+			}
+			if !reflect.DeepEqual(chain, tc.expectedChain) {
+				t.Errorf("expected chain %v, got %v", tc.expectedChain, chain)
+			}
+			tc.expectedRequest.CSR = "csr"
+			if request != tc.expectedRequest {
+				t.Errorf("expected request %+v, got %+v", tc.expectedRequest, request)
+			}
+			if auth != tc.expectedAuth {
+				t.Errorf("expected authorization %q, got %q", tc.expectedAuth, auth)
+			}
+		})
+	}
+}
+
+func TestNewRESTClient(t *testing.T) {
+	root := newTestCert(t, util.CertOptions{Org: "root", IsCA: true}, nil)
+	intermediate := newTestCert(t, util.CertOptions{Org: "intermediate", IsCA: true}, root)
+	testCases := []struct {
+		name        string
+		opts        Options
+		expectedErr string
+	}{
+		{
+			name: "valid",
+			opts: Options{Endpoint: "https://ca.example.com/1.0/sign", RootCert: root.certPem},
+		},
+		{
+			name:        "invalid endpoint",
+			opts:        Options{Endpoint: "ca.example.com:443"},
+			expectedErr: "invalid CA endpoint",
+		},
+		{
+			name:        "unknown authentication",
+			opts:        Options{Endpoint: "https://ca.example.com/1.0/sign", Auth: "basic"},
+			expectedErr: "unknown CA authentication",
+		},
+		{
+			name:        "mtls without client certificate",
+			opts:        Options{Endpoint: "https://ca.example.com/1.0/sign", Auth: AuthMTLS},
+			expectedErr: "requires a client certificate",
+		},
+		{
+			name: "mtls over http",
+			opts: Options{Endpoint: "http://ca.example.com/1.0/sign", Auth: AuthMTLS,
+				ClientCertFile: "cert.pem", ClientKeyFile: "key.pem"},
+			expectedErr: "requires an https CA endpoint",
+		},
+		{
+			name:        "root is not self-signed",
+			opts:        Options{Endpoint: "https://ca.example.com/1.0/sign", RootCert: intermediate.certPem},
+			expectedErr: "invalid root certificate",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewRESTClient(tc.opts)
+			if tc.expectedErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+				t.Fatalf("expected error containing %q, got %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func mustJSON(t *testing.T, v interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func certPEM(der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
@@ -31,6 +31,7 @@ import (
 	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
 	sds "github.com/envoyproxy/go-control-plane/envoy/service/secret/v3"
 	"github.com/golang/protobuf/ptypes"
+	structpb "github.com/golang/protobuf/ptypes/struct"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
@@ -671,21 +672,28 @@ func sdsDiscoveryResponse(s *security.SecretItem, resourceName, typeURL string)
 				},
 			},
 		}
-	} else {
-		secret.Type = &tls.Secret_TlsCertificate{
-			TlsCertificate: &tls.TlsCertificate{
-				CertificateChain: &core.DataSource{
-					Specifier: &core.DataSource_InlineBytes{
-						InlineBytes: s.CertificateChain,
-					},
+		if len(s.CRL) > 0 {
+			secret.GetValidationContext().Crl = &core.DataSource{
+				Specifier: &core.DataSource_InlineBytes{
+					InlineBytes: s.CRL,
 				},
-				PrivateKey: &core.DataSource{
-					Specifier: &core.DataSource_InlineBytes{
-						InlineBytes: s.PrivateKey,
-					},
+			}
+		}
+	} else {
+		tlsCert := &tls.TlsCertificate{
+			CertificateChain: &core.DataSource{
+				Specifier: &core.DataSource_InlineBytes{
+					InlineBytes: s.CertificateChain,
 				},
 			},
 		}
+		if err := setPrivateKey(tlsCert, s); err != nil {
+			sdsServiceLog.Errorf("%s failed to set private key for proxy: %v", conIDresourceNamePrefix, err)
+			return nil, err
+		}
+		secret.Type = &tls.Secret_TlsCertificate{
+			TlsCertificate: tlsCert,
+		}
 	}
 
 	ms, err := ptypes.MarshalAny(secret)
@@ -699,6 +707,41 @@ func sdsDiscoveryResponse(s *security.SecretItem, resourceName, typeURL string)
 	return resp, nil
 }
 
+// setPrivateKey sets the private key of the certificate. Keys held outside of the agent are not sent to
+// the proxy, which reads them from their file or uses them through its private key provider.
+func setPrivateKey(tlsCert *tls.TlsCertificate, s *security.SecretItem) error {
+	switch {
+	case s.ProviderKey == nil:
+		tlsCert.PrivateKey = &core.DataSource{
+			Specifier: &core.DataSource_InlineBytes{
+				InlineBytes: s.PrivateKey,
+			},
+		}
+	case s.ProviderKey.Path != "":
+		tlsCert.PrivateKey = &core.DataSource{
+			Specifier: &core.DataSource_Filename{
+				Filename: s.ProviderKey.Path,
+			},
+		}
+	case s.ProviderKey.Provider != nil:
+		config := &structpb.Struct{Fields: map[string]*structpb.Value{}}
+		for k, v := range s.ProviderKey.Provider.Config {
+			config.Fields[k] = &structpb.Value{Kind: &structpb.Value_StringValue{StringValue: v}}
+		}
+		typedConfig, err := ptypes.MarshalAny(config)
+		if err != nil {
+			return err
+		}
+		tlsCert.PrivateKeyProvider = &tls.PrivateKeyProvider{
+			ProviderName: s.ProviderKey.Provider.Name,
+			ConfigType:   &tls.PrivateKeyProvider_TypedConfig{TypedConfig: typedConfig},
+		}
+	default:
+		return fmt.Errorf("key %s is neither held in a file nor by a private key provider", s.ProviderKey.ID)
+	}
+	return nil
+}
+
 func newSDSConnection(stream xds.DiscoveryStream) *sdsConnection {
 	return &sdsConnection{
 		pushChannel: make(chan *sdsEvent, 1),
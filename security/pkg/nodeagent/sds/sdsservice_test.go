@@ -14,6 +14,7 @@
 package sds
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"net"
@@ -31,6 +32,7 @@ import (
 	discovery "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
 	sds "github.com/envoyproxy/go-control-plane/envoy/service/secret/v3"
 	"github.com/golang/protobuf/ptypes"
+	structpb "github.com/golang/protobuf/ptypes/struct"
 	"github.com/google/go-cmp/cmp"
 	"golang.org/x/net/context"
 	"google.golang.org/genproto/googleapis/rpc/status"
@@ -849,6 +851,78 @@ func verifySDSSResponse(resp *discovery.DiscoveryResponse, expectedPrivateKey []
 	return nil
 }
 
+func TestSDSDiscoveryResponseWithCRL(t *testing.T) {
+	crl := []byte("fake crl")
+	resp, err := sdsDiscoveryResponse(&ca2.SecretItem{
+		ResourceName: "ROOTCA",
+		RootCert:     fakeRootCert,
+		CRL:          crl,
+	}, "ROOTCA", SecretTypeV3)
+	if err != nil {
+		t.Fatalf("sdsDiscoveryResponse failed: %v", err)
+	}
+	pb := &authapi.Secret{}
+	if err := ptypes.UnmarshalAny(resp.Resources[0], pb); err != nil {
+		t.Fatalf("UnmarshalAny SDS response failed: %v", err)
+	}
+	if got := pb.GetValidationContext().GetCrl().GetInlineBytes(); !bytes.Equal(got, crl) {
+		t.Errorf("got CRL %q, want %q", got, crl)
+	}
+}
+
+func TestSDSDiscoveryResponseWithProviderKey(t *testing.T) {
+	config, _ := ptypes.MarshalAny(&structpb.Struct{Fields: map[string]*structpb.Value{
+		"key_label": {Kind: &structpb.Value_StringValue{StringValue: "istio-default-1"}},
+	}})
+	testCases := []struct {
+		name     string
+		key      *ca2.PrivateKey
+		expected *authapi.TlsCertificate
+	}{
+		{
+			name: "file",
+			key:  &ca2.PrivateKey{ID: "/etc/istio/proxy/keys/default-1-key.pem", Path: "/etc/istio/proxy/keys/default-1-key.pem"},
+			expected: &authapi.TlsCertificate{
+				CertificateChain: &core.DataSource{Specifier: &core.DataSource_InlineBytes{InlineBytes: fakeCertificateChain}},
+				PrivateKey:       &core.DataSource{Specifier: &core.DataSource_Filename{Filename: "/etc/istio/proxy/keys/default-1-key.pem"}},
+			},
+		},
+		{
+			name: "private key provider",
+			key: &ca2.PrivateKey{ID: "istio-default-1", Provider: &ca2.PrivateKeyProvider{
+				Name:   "pkcs11",
+				Config: map[string]string{"key_label": "istio-default-1"},
+			}},
+			expected: &authapi.TlsCertificate{
+				CertificateChain: &core.DataSource{Specifier: &core.DataSource_InlineBytes{InlineBytes: fakeCertificateChain}},
+				PrivateKeyProvider: &authapi.PrivateKeyProvider{
+					ProviderName: "pkcs11",
+					ConfigType:   &authapi.PrivateKeyProvider_TypedConfig{TypedConfig: config},
+				},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := sdsDiscoveryResponse(&ca2.SecretItem{
+				ResourceName:     "default",
+				CertificateChain: fakeCertificateChain,
+				ProviderKey:      tc.key,
+			}, "default", SecretTypeV3)
+			if err != nil {
+				t.Fatalf("sdsDiscoveryResponse failed: %v", err)
+			}
+			pb := &authapi.Secret{}
+			if err := ptypes.UnmarshalAny(resp.Resources[0], pb); err != nil {
+				t.Fatalf("UnmarshalAny SDS response failed: %v", err)
+			}
+			if diff := cmp.Diff(pb.GetTlsCertificate(), tc.expected, protocmp.Transform()); diff != "" {
+				t.Errorf("unexpected TLS certificate: %v", diff)
+			}
+		})
+	}
+}
+
 func verifySDSSResponseForRootCert(t *testing.T, resp *discovery.DiscoveryResponse, expectedRootCert []byte) {
 	pb := &authapi.Secret{}
 	if err := ptypes.UnmarshalAny(resp.Resources[0], pb); err != nil {
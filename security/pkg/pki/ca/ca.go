@@ -255,6 +255,10 @@ type IstioCA struct {
 	// rootCertRotator periodically rotates self-signed root cert for CA. It is nil
 	// if CA is not self-signed CA.
 	rootCertRotator *SelfSignedCARootCertRotator
+
+	// revocations holds the revoked certificates and identities, and the workload
+	// certificates issued by the CA.
+	revocations *revocationList
 }
 
 // NewIstioCA returns a new IstioCA instance.
@@ -264,6 +268,7 @@ func NewIstioCA(opts *IstioCAOptions) (*IstioCA, error) {
 		keyCertBundle: opts.KeyCertBundle,
 		livenessProbe: probe.NewProbe(),
 		caRSAKeySize:  opts.CARSAKeySize,
+		revocations:   newRevocationList(),
 	}
 
 	if opts.CAType == selfSignedCA && opts.RotatorConfig.CheckInterval > time.Duration(0) {
@@ -318,6 +323,13 @@ func (ca *IstioCA) Sign(csrPEM []byte, subjectIDs []string, requestedLifetime ti
 	if err != nil {
 		return nil, caerror.NewError(caerror.CertGenError, err)
 	}
+	if !forCA {
+		issued, err := x509.ParseCertificate(certBytes)
+		if err != nil {
+			return nil, caerror.NewError(caerror.CertGenError, err)
+		}
+		ca.revocations.record(issued, subjectIDs)
+	}
 
 	block := &pem.Block{
 		Type:  "CERTIFICATE",
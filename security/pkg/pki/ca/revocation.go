@@ -0,0 +1,391 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ca
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/util/retry"
+
+	caerror "istio.io/istio/security/pkg/pki/error"
+)
+
+const (
+	// RevocationConfigMap is the name of the ConfigMap, in the istiod namespace, holding the revocation list.
+	RevocationConfigMap = "istio-ca-revocations"
+	// RevocationsID is the ConfigMap key of the JSON encoded revocation list.
+	RevocationsID = "revocations.json"
+
+	// crlValidity is the lifetime of a generated CRL. The CRL is regenerated once half of it has elapsed.
+	crlValidity = 24 * time.Hour
+)
+
+// Revocation is a single entry of the CA revocation list. Either SerialNumber or Identity is set.
+type Revocation struct {
+	// SerialNumber is the hex encoded serial number of a revoked certificate.
+	SerialNumber string `json:"serialNumber,omitempty"`
+	// Identity is a revoked SPIFFE identity. When SerialNumber is empty, every certificate
+	// carrying the identity and issued before RevokedAt is revoked. The revocation is one-shot:
+	// the CA keeps signing certificates for the identity, and those issued after RevokedAt are
+	// valid. A workload that must lose its identity has to be denied new certificates as well,
+	// for example by deleting its service account.
+	// The certificates issued by the CA are only tracked in memory, so an identity revocation
+	// only covers the certificates issued by a running istiod since it started. Certificates
+	// issued before a restart have to be revoked by serial number.
+	Identity string `json:"identity,omitempty"`
+	// RevokedAt is the time of the revocation.
+	RevokedAt time.Time `json:"revokedAt"`
+	// ExpiresAt is the expiration of the revoked certificate, if known. Expired entries are
+	// left out of the CRL.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+func (r Revocation) key() string {
+	if r.SerialNumber != "" {
+		return "serial/" + r.SerialNumber
+	}
+	return "identity/" + r.Identity
+}
+
+func (r Revocation) expired(now time.Time) bool {
+	return r.ExpiresAt != nil && now.After(*r.ExpiresAt)
+}
+
+// NormalizeSerialNumber converts a serial number, as printed by Go or openssl, to the
+// lower case hex form used in the revocation list.
+func NormalizeSerialNumber(serial string) (string, error) {
+	s := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(serial), ":", ""))
+	n, ok := new(big.Int).SetString(strings.TrimPrefix(s, "0x"), 16)
+	if !ok || n.Sign() <= 0 {
+		return "", fmt.Errorf("invalid certificate serial number %q", serial)
+	}
+	return n.Text(16), nil
+}
+
+// issuedCert is a workload certificate signed by the CA, kept so that identity revocations
+// can be resolved to the serial numbers needed in the CRL. Issued certificates are not persisted:
+// once resolved, the serial numbers are stored in the revocation ConfigMap instead.
+type issuedCert struct {
+	serial   string
+	issuedAt time.Time
+	notAfter time.Time
+}
+
+// revocationList holds the revocations known to the CA and the certificates it has issued.
+type revocationList struct {
+	mu          sync.RWMutex
+	revocations map[string]Revocation
+	issued      map[string][]issuedCert
+
+	crl        []byte
+	crlSerials string
+	crlRefresh time.Time
+	crlNumber  int64
+}
+
+func newRevocationList() *revocationList {
+	return &revocationList{
+		revocations: map[string]Revocation{},
+		issued:      map[string][]issuedCert{},
+	}
+}
+
+// record remembers a certificate issued for the given identities, dropping expired ones.
+func (rl *revocationList) record(cert *x509.Certificate, identities []string) {
+	now := time.Now()
+	ic := issuedCert{
+		serial:   cert.SerialNumber.Text(16),
+		issuedAt: now,
+		notAfter: cert.NotAfter,
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	for _, id := range identities {
+		certs := rl.issued[id][:0]
+		for _, c := range rl.issued[id] {
+			if c.notAfter.After(now) {
+				certs = append(certs, c)
+			}
+		}
+		rl.issued[id] = append(certs, ic)
+	}
+}
+
+// resolve returns serial number revocations for the issued certificates covered by an
+// identity revocation but not yet revoked by serial number.
+func (rl *revocationList) resolve(now time.Time) []Revocation {
+	var out []Revocation
+	for _, r := range rl.revocations {
+		if r.SerialNumber != "" {
+			continue
+		}
+		for _, c := range rl.issued[r.Identity] {
+			if c.issuedAt.After(r.RevokedAt) || !c.notAfter.After(now) {
+				continue
+			}
+			resolved := Revocation{SerialNumber: c.serial, Identity: r.Identity, RevokedAt: r.RevokedAt}
+			if _, f := rl.revocations[resolved.key()]; f {
+				continue
+			}
+			notAfter := c.notAfter
+			resolved.ExpiresAt = &notAfter
+			out = append(out, resolved)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].SerialNumber < out[j].SerialNumber
+	})
+	return out
+}
+
+// Revoke adds revocations to the revocation list of the CA.
+func (ca *IstioCA) Revoke(revocations ...Revocation) {
+	ca.revocations.mu.Lock()
+	defer ca.revocations.mu.Unlock()
+	for _, r := range revocations {
+		ca.revocations.revocations[r.key()] = r
+	}
+}
+
+// SetRevocations replaces the revocation list of the CA.
+func (ca *IstioCA) SetRevocations(revocations []Revocation) {
+	ca.revocations.mu.Lock()
+	defer ca.revocations.mu.Unlock()
+	ca.revocations.revocations = make(map[string]Revocation, len(revocations))
+	for _, r := range revocations {
+		ca.revocations.revocations[r.key()] = r
+	}
+}
+
+// ResolveRevocations returns the certificates issued by this CA that are revoked through their
+// identity, as serial number revocations that are not part of the revocation list yet.
+func (ca *IstioCA) ResolveRevocations() []Revocation {
+	ca.revocations.mu.RLock()
+	defer ca.revocations.mu.RUnlock()
+	return ca.revocations.resolve(time.Now())
+}
+
+// CheckCRLSigner returns an error if the CA signing certificate is not allowed to sign certificate
+// revocation lists. Signing certificates generated by Istio have the cRLSign key usage, but roots
+// created by older releases and plugged-in CA certificates may not, in which case the root
+// certificate has to be rotated before revoked certificates can be published.
+//
+// CRLs are only published when the CA signs with a root certificate. Envoy requires a CRL for
+// every CA of the chain once a CRL is configured, and the CA cannot sign one on behalf of the
+// CAs above a plugged-in intermediate certificate.
+func (ca *IstioCA) CheckCRLSigner() error {
+	signingCert, _, _, _ := ca.keyCertBundle.GetAll()
+	if signingCert == nil {
+		return caerror.NewError(caerror.CANotReady, fmt.Errorf("Istio CA is not ready")) // nolint
+	}
+	return checkCRLSigner(signingCert)
+}
+
+func checkCRLSigner(cert *x509.Certificate) error {
+	if !bytes.Equal(cert.RawIssuer, cert.RawSubject) || cert.CheckSignatureFrom(cert) != nil {
+		return caerror.NewError(caerror.CertGenError, fmt.Errorf(
+			"CA signing certificate %q is an intermediate certificate, certificate revocation lists "+
+				"are only published when the CA signs with a root certificate", cert.Subject.String()))
+	}
+	if cert.KeyUsage&x509.KeyUsageCRLSign == 0 {
+		return caerror.NewError(caerror.CertGenError, fmt.Errorf(
+			"CA signing certificate %q lacks the cRLSign key usage, rotate the root "+
+				"certificate to one that has it", cert.Subject.String()))
+	}
+	return nil
+}
+
+// CRL returns the PEM encoded certificate revocation list, signed by the CA signing certificate.
+// It is nil when no unexpired certificate is revoked. The CRL is regenerated when the revoked
+// serial numbers change or when half of its validity has elapsed.
+func (ca *IstioCA) CRL() ([]byte, error) {
+	now := time.Now()
+	rl := ca.revocations
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	revoked := map[string]Revocation{}
+	for _, r := range append(rl.resolve(now), rl.sortedRevocations()...) {
+		if r.SerialNumber == "" || r.expired(now) {
+			continue
+		}
+		revoked[r.SerialNumber] = r
+	}
+	if len(revoked) == 0 {
+		rl.crl, rl.crlSerials = nil, ""
+		return nil, nil
+	}
+	serials := make([]string, 0, len(revoked))
+	for s := range revoked {
+		serials = append(serials, s)
+	}
+	sort.Strings(serials)
+	if key := strings.Join(serials, ","); rl.crl != nil && key == rl.crlSerials && now.Before(rl.crlRefresh) {
+		return rl.crl, nil
+	}
+
+	signingCert, signingKey, _, _ := ca.keyCertBundle.GetAll()
+	if signingCert == nil || signingKey == nil {
+		return nil, caerror.NewError(caerror.CANotReady, fmt.Errorf("Istio CA is not ready")) // nolint
+	}
+	if err := checkCRLSigner(signingCert); err != nil {
+		return nil, err
+	}
+	signer, ok := (*signingKey).(crypto.Signer)
+	if !ok {
+		return nil, caerror.NewError(caerror.CertGenError, fmt.Errorf("CA signing key is not a crypto.Signer"))
+	}
+	entries := make([]pkix.RevokedCertificate, 0, len(serials))
+	for _, s := range serials {
+		serial, _ := new(big.Int).SetString(s, 16)
+		if serial == nil {
+			return nil, caerror.NewError(caerror.CertGenError, fmt.Errorf("invalid revoked serial number %q", s))
+		}
+		entries = append(entries, pkix.RevokedCertificate{
+			SerialNumber:   serial,
+			RevocationTime: revoked[s].RevokedAt.UTC(),
+		})
+	}
+	// The CRL number must increase with every CRL issued, including across restarts.
+	rl.crlNumber++
+	if n := now.Unix(); n > rl.crlNumber {
+		rl.crlNumber = n
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		RevokedCertificates: entries,
+		Number:              big.NewInt(rl.crlNumber),
+		ThisUpdate:          now,
+		NextUpdate:          now.Add(crlValidity),
+	}, signingCert, signer)
+	if err != nil {
+		return nil, caerror.NewError(caerror.CertGenError, err)
+	}
+	rl.crl = pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der})
+	rl.crlSerials = strings.Join(serials, ",")
+	rl.crlRefresh = now.Add(crlValidity / 2)
+	return rl.crl, nil
+}
+
+func (rl *revocationList) sortedRevocations() []Revocation {
+	out := make([]Revocation, 0, len(rl.revocations))
+	for _, r := range rl.revocations {
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].key() < out[j].key()
+	})
+	return out
+}
+
+// ParseRevocations decodes the revocation list stored in the revocation ConfigMap.
+func ParseRevocations(cm *v1.ConfigMap) ([]Revocation, error) {
+	if cm == nil || cm.Data[RevocationsID] == "" {
+		return nil, nil
+	}
+	var revocations []Revocation
+	if err := json.Unmarshal([]byte(cm.Data[RevocationsID]), &revocations); err != nil {
+		return nil, fmt.Errorf("failed to parse %s in configmap %s: %v", RevocationsID, cm.Name, err)
+	}
+	for i, r := range revocations {
+		if r.SerialNumber == "" && r.Identity == "" {
+			return nil, fmt.Errorf("revocation %d in configmap %s has neither a serial number nor an identity", i, cm.Name)
+		}
+	}
+	return revocations, nil
+}
+
+// AddRevocations merges revocations into the revocation ConfigMap in the given namespace,
+// creating it if needed. It returns the revocations that were not present yet.
+func AddRevocations(client corev1.ConfigMapsGetter, namespace string, revocations []Revocation) ([]Revocation, error) {
+	var added []Revocation
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := client.ConfigMaps(namespace).Get(context.TODO(), RevocationConfigMap, metav1.GetOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		create := errors.IsNotFound(err)
+		if create {
+			cm = &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: RevocationConfigMap, Namespace: namespace}}
+		}
+		existing, err := ParseRevocations(cm)
+		if err != nil {
+			return err
+		}
+		var merged []Revocation
+		merged, added = mergeRevocations(existing, revocations)
+		if len(added) == 0 {
+			return nil
+		}
+		data, err := json.MarshalIndent(merged, "", "  ")
+		if err != nil {
+			return err
+		}
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		cm.Data[RevocationsID] = string(data)
+		if create {
+			_, err = client.ConfigMaps(namespace).Create(context.TODO(), cm, metav1.CreateOptions{})
+		} else {
+			_, err = client.ConfigMaps(namespace).Update(context.TODO(), cm, metav1.UpdateOptions{})
+		}
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update configmap %s/%s: %v", namespace, RevocationConfigMap, err)
+	}
+	return added, nil
+}
+
+// mergeRevocations adds revocations to an existing list. A repeated identity revocation
+// moves its revocation time forward; other duplicates are ignored.
+func mergeRevocations(existing, revocations []Revocation) (merged, added []Revocation) {
+	merged = append(merged, existing...)
+	index := map[string]int{}
+	for i, r := range merged {
+		index[r.key()] = i
+	}
+	for _, r := range revocations {
+		i, f := index[r.key()]
+		switch {
+		case !f:
+			index[r.key()] = len(merged)
+			merged = append(merged, r)
+		case r.SerialNumber == "" && r.RevokedAt.After(merged[i].RevokedAt):
+			merged[i] = r
+		default:
+			continue
+		}
+		added = append(added, r)
+	}
+	return merged, added
+}
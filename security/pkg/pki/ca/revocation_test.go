@@ -0,0 +1,277 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ca
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+func signWorkloadCert(t *testing.T, ca *IstioCA, id string) *x509.Certificate {
+	t.Helper()
+	csrPEM, _, err := util.GenCSR(util.CertOptions{Host: id, RSAKeySize: 2048})
+	if err != nil {
+		t.Fatalf("GenCSR error: %v", err)
+	}
+	certPEM, err := ca.Sign(csrPEM, []string{id}, time.Hour, false)
+	if err != nil {
+		t.Fatalf("Sign error: %v", err)
+	}
+	cert, err := util.ParsePemEncodedCertificate(certPEM)
+	if err != nil {
+		t.Fatalf("ParsePemEncodedCertificate error: %v", err)
+	}
+	return cert
+}
+
+// createRootCA returns a CA signing workload certificates with its root certificate.
+func createRootCA(t *testing.T) *IstioCA {
+	t.Helper()
+	certPEM, keyPEM, err := util.GenCertKeyFromOptions(util.CertOptions{
+		IsCA:         true,
+		IsSelfSigned: true,
+		TTL:          time.Hour,
+		Org:          "Root CA",
+		ECSigAlg:     util.EcdsaSigAlg,
+	})
+	if err != nil {
+		t.Fatalf("GenCertKeyFromOptions error: %v", err)
+	}
+	bundle, err := util.NewVerifiedKeyCertBundleFromPem(certPEM, keyPEM, nil, certPEM)
+	if err != nil {
+		t.Fatalf("NewVerifiedKeyCertBundleFromPem error: %v", err)
+	}
+	ca, err := NewIstioCA(&IstioCAOptions{
+		DefaultCertTTL: time.Hour,
+		MaxCertTTL:     24 * time.Hour,
+		KeyCertBundle:  bundle,
+		RotatorConfig:  &SelfSignedCARootCertRotatorConfig{},
+	})
+	if err != nil {
+		t.Fatalf("NewIstioCA error: %v", err)
+	}
+	return ca
+}
+
+func TestRevocation(t *testing.T) {
+	ca := createRootCA(t)
+	foo := "spiffe://cluster.local/ns/default/sa/foo"
+	bar := "spiffe://cluster.local/ns/default/sa/bar"
+	fooCert := signWorkloadCert(t, ca, foo)
+	barCert := signWorkloadCert(t, ca, bar)
+
+	crl, err := ca.CRL()
+	if err != nil || crl != nil {
+		t.Fatalf("expected no CRL without revocations, got %q, %v", crl, err)
+	}
+
+	ca.Revoke(Revocation{Identity: foo, RevokedAt: time.Now()})
+	resolved := ca.ResolveRevocations()
+	if len(resolved) != 1 || resolved[0].SerialNumber != fooCert.SerialNumber.Text(16) || resolved[0].Identity != foo {
+		t.Fatalf("unexpected resolved revocations: %+v", resolved)
+	}
+
+	// Certificates issued after the revocation are not revoked.
+	ca.Revoke(Revocation{Identity: bar, RevokedAt: time.Now().Add(-time.Hour)})
+	if resolved := ca.ResolveRevocations(); len(resolved) != 1 {
+		t.Errorf("unexpected resolved revocations: %+v", resolved)
+	}
+
+	// Identity revocations are one-shot, the CA keeps signing certificates for revoked identities.
+	if newFooCert := signWorkloadCert(t, ca, foo); newFooCert.SerialNumber.Cmp(fooCert.SerialNumber) == 0 {
+		t.Fatalf("expected a new certificate for %s", foo)
+	}
+	if resolved := ca.ResolveRevocations(); len(resolved) != 1 || resolved[0].SerialNumber != fooCert.SerialNumber.Text(16) {
+		t.Errorf("expected certificates issued after the revocation not to be revoked: %+v", resolved)
+	}
+
+	ca.Revoke(Revocation{SerialNumber: barCert.SerialNumber.Text(16), RevokedAt: time.Now()})
+
+	crlPEM, err := ca.CRL()
+	if err != nil {
+		t.Fatalf("CRL error: %v", err)
+	}
+	block, _ := pem.Decode(crlPEM)
+	if block == nil || block.Type != "X509 CRL" {
+		t.Fatalf("unexpected CRL PEM: %q", crlPEM)
+	}
+	list, err := x509.ParseCRL(block.Bytes)
+	if err != nil {
+		t.Fatalf("ParseCRL error: %v", err)
+	}
+	signingCert, _, _, _ := ca.GetCAKeyCertBundle().GetAll()
+	if err := signingCert.CheckCRLSignature(list); err != nil {
+		t.Errorf("CRL is not signed by the CA: %v", err)
+	}
+	got := map[string]bool{}
+	for _, rc := range list.TBSCertList.RevokedCertificates {
+		got[rc.SerialNumber.Text(16)] = true
+	}
+	want := map[string]bool{fooCert.SerialNumber.Text(16): true, barCert.SerialNumber.Text(16): true}
+	if len(got) != len(want) || !got[fooCert.SerialNumber.Text(16)] || !got[barCert.SerialNumber.Text(16)] {
+		t.Errorf("unexpected revoked serials %v, want %v", got, want)
+	}
+
+	again, err := ca.CRL()
+	if err != nil || string(again) != string(crlPEM) {
+		t.Errorf("expected CRL to be reused while the revocations are unchanged")
+	}
+
+	ca.SetRevocations(nil)
+	if crl, err := ca.CRL(); err != nil || crl != nil {
+		t.Errorf("expected no CRL after clearing the revocation list, got %q, %v", crl, err)
+	}
+}
+
+func TestRevocationWithoutCRLSign(t *testing.T) {
+	// Roots created before Istio set the cRLSign key usage are only allowed to sign certificates.
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{Organization: []string{"Root CA"}},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate error: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey error: %v", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	bundle, err := util.NewVerifiedKeyCertBundleFromPem(certPEM, keyPEM, nil, certPEM)
+	if err != nil {
+		t.Fatalf("NewVerifiedKeyCertBundleFromPem error: %v", err)
+	}
+	ca, err := NewIstioCA(&IstioCAOptions{
+		DefaultCertTTL: time.Hour,
+		MaxCertTTL:     24 * time.Hour,
+		KeyCertBundle:  bundle,
+		RotatorConfig:  &SelfSignedCARootCertRotatorConfig{},
+	})
+	if err != nil {
+		t.Fatalf("NewIstioCA error: %v", err)
+	}
+
+	if err := ca.CheckCRLSigner(); err == nil || !strings.Contains(err.Error(), "cRLSign") {
+		t.Errorf("expected the signing certificate to be rejected for CRL signing, got %v", err)
+	}
+	foo := "spiffe://cluster.local/ns/default/sa/foo"
+	fooCert := signWorkloadCert(t, ca, foo)
+	ca.Revoke(Revocation{SerialNumber: fooCert.SerialNumber.Text(16), RevokedAt: time.Now()})
+	if crl, err := ca.CRL(); err == nil || !strings.Contains(err.Error(), "cRLSign") {
+		t.Errorf("expected CRL generation to fail for lack of cRLSign, got %q, %v", crl, err)
+	}
+}
+
+func TestNormalizeSerialNumber(t *testing.T) {
+	cases := map[string]string{
+		"3A:5F:01":  "3a5f01",
+		"0x00ff":    "ff",
+		" 1234abcd": "1234abcd",
+	}
+	for in, want := range cases {
+		got, err := NormalizeSerialNumber(in)
+		if err != nil || got != want {
+			t.Errorf("NormalizeSerialNumber(%q) = %q, %v, want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "xyz", "0"} {
+		if _, err := NormalizeSerialNumber(in); err == nil {
+			t.Errorf("NormalizeSerialNumber(%q) expected error", in)
+		}
+	}
+}
+
+func TestAddRevocations(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	t0 := time.Now().Truncate(time.Second)
+	added, err := AddRevocations(client.CoreV1(), "istio-system", []Revocation{
+		{Identity: "spiffe://cluster.local/ns/default/sa/foo", RevokedAt: t0},
+		{SerialNumber: "ab", RevokedAt: t0},
+	})
+	if err != nil || len(added) != 2 {
+		t.Fatalf("AddRevocations() = %v, %v", added, err)
+	}
+
+	added, err = AddRevocations(client.CoreV1(), "istio-system", []Revocation{
+		{SerialNumber: "ab", RevokedAt: t0.Add(time.Minute)},
+		{Identity: "spiffe://cluster.local/ns/default/sa/foo", RevokedAt: t0.Add(time.Minute)},
+	})
+	if err != nil || len(added) != 1 || added[0].Identity == "" {
+		t.Fatalf("expected only the identity revocation to be updated, got %v, %v", added, err)
+	}
+
+	cm, err := client.CoreV1().ConfigMaps("istio-system").Get(context.TODO(), RevocationConfigMap, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	revocations, err := ParseRevocations(cm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revocations) != 2 || !revocations[0].RevokedAt.Equal(t0.Add(time.Minute)) || !revocations[1].RevokedAt.Equal(t0) {
+		t.Errorf("unexpected revocations: %+v", revocations)
+	}
+
+	if _, err := ParseRevocations(&v1.ConfigMap{Data: map[string]string{RevocationsID: `[{"revokedAt":"2020-01-01T00:00:00Z"}]`}}); err == nil {
+		t.Errorf("expected an error for a revocation without serial number and identity")
+	}
+}
+
+func TestRevocationWithIntermediateCA(t *testing.T) {
+	// Envoy requires a CRL for every CA of the chain, the intermediate cannot sign one for the root.
+	ca, err := createCA(24*time.Hour, util.EcdsaSigAlg)
+	if err != nil {
+		t.Fatalf("createCA error: %v", err)
+	}
+	if _, _, chain, _ := ca.GetCAKeyCertBundle().GetAll(); len(chain) == 0 {
+		t.Fatalf("expected the CA to sign with an intermediate certificate")
+	}
+
+	if err := ca.CheckCRLSigner(); err == nil || !strings.Contains(err.Error(), "intermediate") {
+		t.Errorf("expected the intermediate signing certificate to be rejected for CRL signing, got %v", err)
+	}
+	foo := "spiffe://cluster.local/ns/default/sa/foo"
+	fooCert := signWorkloadCert(t, ca, foo)
+	ca.Revoke(Revocation{SerialNumber: fooCert.SerialNumber.Text(16), RevokedAt: time.Now()})
+	if crl, err := ca.CRL(); err == nil || crl != nil || !strings.Contains(err.Error(), "intermediate") {
+		t.Errorf("expected no CRL with an intermediate signing certificate, got %q, %v", crl, err)
+	}
+}
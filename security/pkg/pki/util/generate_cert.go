@@ -261,8 +261,9 @@ func genCertTemplateFromCSR(csr *x509.CertificateRequest, subjectIDs []string, t
 	var keyUsage x509.KeyUsage
 	extKeyUsages := []x509.ExtKeyUsage{}
 	if isCA {
-		// If the cert is a CA cert, the private key is allowed to sign other certificates.
-		keyUsage = x509.KeyUsageCertSign
+		// If the cert is a CA cert, the private key is allowed to sign other certificates
+		// and the revocation lists for them.
+		keyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
 	} else {
 		// Otherwise the private key is allowed for digital signature and key encipherment.
 		keyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
@@ -313,8 +314,9 @@ func genCertTemplateFromCSR(csr *x509.CertificateRequest, subjectIDs []string, t
 func genCertTemplateFromOptions(options CertOptions) (*x509.Certificate, error) {
 	var keyUsage x509.KeyUsage
 	if options.IsCA {
-		// If the cert is a CA cert, the private key is allowed to sign other certificates.
-		keyUsage = x509.KeyUsageCertSign
+		// If the cert is a CA cert, the private key is allowed to sign other certificates
+		// and the revocation lists for them.
+		keyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
 	} else {
 		// Otherwise the private key is allowed for digital signature and key encipherment.
 		keyUsage = x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
@@ -389,25 +391,30 @@ func encodePem(isCSR bool, csrOrCert []byte, priv interface{}, pkcs8 bool) (
 	}
 	csrOrCertPem = pem.EncodeToMemory(&pem.Block{Type: encodeMsg, Bytes: csrOrCert})
 
-	var encodedKey []byte
+	if privPem, err = encodePrivateKeyPem(priv, pkcs8); err != nil {
+		return nil, nil, err
+	}
+	return
+}
+
+// encodePrivateKeyPem encodes the RSA or ECDSA private key in PKCS#8, or in its PKCS#1 or SEC 1 form.
+func encodePrivateKeyPem(priv interface{}, pkcs8 bool) ([]byte, error) {
 	if pkcs8 {
-		if encodedKey, err = x509.MarshalPKCS8PrivateKey(priv); err != nil {
-			return nil, nil, err
+		encodedKey, err := x509.MarshalPKCS8PrivateKey(priv)
+		if err != nil {
+			return nil, err
 		}
-		privPem = pem.EncodeToMemory(&pem.Block{Type: blockTypePKCS8PrivateKey, Bytes: encodedKey})
-	} else {
-		switch k := priv.(type) {
-		case *rsa.PrivateKey:
-			encodedKey = x509.MarshalPKCS1PrivateKey(k)
-			privPem = pem.EncodeToMemory(&pem.Block{Type: blockTypeRSAPrivateKey, Bytes: encodedKey})
-		case *ecdsa.PrivateKey:
-			encodedKey, err = x509.MarshalECPrivateKey(k)
-			if err != nil {
-				return nil, nil, err
-			}
-			privPem = pem.EncodeToMemory(&pem.Block{Type: blockTypeECPrivateKey, Bytes: encodedKey})
+		return pem.EncodeToMemory(&pem.Block{Type: blockTypePKCS8PrivateKey, Bytes: encodedKey}), nil
+	}
+	switch k := priv.(type) {
+	case *rsa.PrivateKey:
+		return pem.EncodeToMemory(&pem.Block{Type: blockTypeRSAPrivateKey, Bytes: x509.MarshalPKCS1PrivateKey(k)}), nil
+	case *ecdsa.PrivateKey:
+		encodedKey, err := x509.MarshalECPrivateKey(k)
+		if err != nil {
+			return nil, err
 		}
+		return pem.EncodeToMemory(&pem.Block{Type: blockTypeECPrivateKey, Bytes: encodedKey}), nil
 	}
-	err = nil
-	return
+	return nil, nil
 }
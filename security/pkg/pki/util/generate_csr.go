@@ -26,6 +26,7 @@ import (
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -40,7 +41,20 @@ const minimumRsaKeySize = 2048
 
 // GenCSR generates a X.509 certificate sign request and private key with the given options.
 func GenCSR(options CertOptions) ([]byte, []byte, error) {
-	var priv interface{}
+	priv, privKey, err := GenKey(options)
+	if err != nil {
+		return nil, nil, err
+	}
+	csr, err := GenCSRWithSigner(options, priv)
+	if err != nil {
+		return nil, nil, err
+	}
+	return csr, privKey, nil
+}
+
+// GenKey generates a private key with the given options, and returns it along with its PEM encoding.
+func GenKey(options CertOptions) (crypto.Signer, []byte, error) {
+	var priv crypto.Signer
 	var err error
 	if options.ECSigAlg != "" {
 		switch options.ECSigAlg {
@@ -62,18 +76,26 @@ func GenCSR(options CertOptions) ([]byte, []byte, error) {
 			return nil, nil, fmt.Errorf("RSA key generation failed (%v)", err)
 		}
 	}
-	template, err := GenCSRTemplate(options)
+	privKey, err := encodePrivateKeyPem(priv, options.PKCS8Key)
 	if err != nil {
-		return nil, nil, fmt.Errorf("CSR template creation failed (%v)", err)
+		return nil, nil, err
 	}
+	return priv, privKey, nil
+}
 
-	csrBytes, err := x509.CreateCertificateRequest(rand.Reader, template, crypto.PrivateKey(priv))
+// GenCSRWithSigner generates a X.509 certificate sign request with the given options, signed by the
+// private key of the signer. The key may be held outside of the process, e.g. by a PKCS#11 token.
+func GenCSRWithSigner(options CertOptions, signer crypto.Signer) ([]byte, error) {
+	template, err := GenCSRTemplate(options)
 	if err != nil {
-		return nil, nil, fmt.Errorf("CSR creation failed (%v)", err)
+		return nil, fmt.Errorf("CSR template creation failed (%v)", err)
 	}
 
-	csr, privKey, err := encodePem(true, csrBytes, priv, options.PKCS8Key)
-	return csr, privKey, err
+	csrBytes, err := x509.CreateCertificateRequest(rand.Reader, template, signer)
+	if err != nil {
+		return nil, fmt.Errorf("CSR creation failed (%v)", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrBytes}), nil
 }
 
 // GenCSRTemplate generates a certificateRequest template with the given options.
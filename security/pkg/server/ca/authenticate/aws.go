@@ -0,0 +1,301 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authenticate
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	AWSAuthenticatorType = "AWSInstanceIdentityAuthenticator"
+
+	// AWSInstancesConfigMap is the name of the ConfigMap, in the istiod namespace, holding the nonces the
+	// EC2 instances are bound to.
+	AWSInstancesConfigMap = "istio-aws-instances"
+
+	// awsInstanceRecordTTL is how long the nonce of an instance is remembered after its last
+	// authentication. Agents renew their certificates well within it.
+	awsInstanceRecordTTL = 7 * 24 * time.Hour
+)
+
+// AWSAuthenticator authenticates EC2 instances with their signed instance identity document, as
+// sent by the AWS credential fetcher of the istio agent: the base64url encoded document, its
+// base64url encoded SHA256-RSA signature and a nonce generated by the agent, joined by ".".
+// The account of the instance, or the account and instance ID as "account/instance", is mapped
+// to the workload identity.
+//
+// The document does not change while the instance runs, so anyone who obtains it can present it
+// again. To detect replays, the instance is bound to the nonce it first presents, and the document
+// is rejected with any other nonce until the instance is restarted, which updates the pendingTime
+// of its document. The bindings are stored in the AWSInstancesConfigMap ConfigMap, shared by the
+// istiod replicas, and only the hashes of the nonces are stored. Without a Kubernetes client, the
+// bindings are kept in memory, and are lost when istiod restarts.
+type AWSAuthenticator struct {
+	// certs are the AWS public certificates of the trusted regions.
+	certs       []*x509.Certificate
+	trustDomain string
+	mapping     IdentityMapping
+	// instances holds the nonces the instances are bound to, keyed by account and instance ID.
+	instances awsInstanceStore
+}
+
+// awsInstanceRecord is the nonce an instance is bound to.
+type awsInstanceRecord struct {
+	// NonceHash is the hex encoded SHA256 hash of the nonce.
+	NonceHash   string    `json:"nonceHash"`
+	PendingTime time.Time `json:"pendingTime"`
+	LastSeen    time.Time `json:"lastSeen"`
+}
+
+func (r *awsInstanceRecord) expired(now time.Time) bool {
+	return now.Sub(r.LastSeen) > awsInstanceRecordTTL
+}
+
+// awsInstanceStore holds the records of the instances.
+type awsInstanceStore interface {
+	// update calls bind with the record of the instance, nil if it has none, and stores the record
+	// bind returns. Nothing is stored if bind fails.
+	update(instance string, bind func(*awsInstanceRecord) (*awsInstanceRecord, error)) error
+}
+
+var _ Authenticator = &AWSAuthenticator{}
+
+// awsIdentityDocument is the subset of the instance identity document used for authentication.
+type awsIdentityDocument struct {
+	AccountID   string    `json:"accountId"`
+	InstanceID  string    `json:"instanceId"`
+	Region      string    `json:"region"`
+	PendingTime time.Time `json:"pendingTime"`
+}
+
+// NewAWSAuthenticator creates an AWSAuthenticator trusting the instance identity documents signed
+// by the PEM encoded AWS public certificates. The instance bindings are stored in a ConfigMap of the
+// namespace if client is set, and in memory otherwise.
+func NewAWSAuthenticator(certsPEM []byte, trustDomain string, mapping IdentityMapping,
+	client corev1.ConfigMapsGetter, namespace string) (*AWSAuthenticator, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, certsPEM = pem.Decode(certsPEM)
+		if block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse AWS certificate: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no AWS certificate is found")
+	}
+	var instances awsInstanceStore = &awsMemoryStore{
+		records:   map[string]*awsInstanceRecord{},
+		lastPrune: time.Now(),
+	}
+	if client != nil {
+		instances = &awsConfigMapStore{client: client, namespace: namespace}
+	}
+	return &AWSAuthenticator{
+		certs:       certs,
+		trustDomain: trustDomain,
+		mapping:     mapping,
+		instances:   instances,
+	}, nil
+}
+
+// Authenticate verifies the signature of the instance identity document and the nonce it is
+// presented with, and maps its account to the caller identity.
+func (a *AWSAuthenticator) Authenticate(ctx context.Context) (*Caller, error) {
+	bearerToken, err := extractBearerToken(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("instance identity extraction error: %v", err)
+	}
+	parts := strings.Split(bearerToken, ".")
+	if len(parts) != 3 || parts[2] == "" {
+		return nil, fmt.Errorf("the bearer token is not an instance identity credential")
+	}
+	doc, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid instance identity document: %v", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid instance identity signature: %v", err)
+	}
+
+	verified := false
+	for _, cert := range a.certs {
+		if cert.CheckSignature(x509.SHA256WithRSA, doc, sig) == nil {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, fmt.Errorf("failed to verify the instance identity signature")
+	}
+
+	identity := &awsIdentityDocument{}
+	if err := json.Unmarshal(doc, identity); err != nil {
+		return nil, fmt.Errorf("failed to parse the instance identity document: %v", err)
+	}
+	if identity.AccountID == "" || identity.InstanceID == "" {
+		return nil, fmt.Errorf("the instance identity document has no account or instance ID")
+	}
+	instance := identity.AccountID + "/" + identity.InstanceID
+	id, err := a.mapping.identity(a.trustDomain, instance, identity.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.checkNonce(instance, identity.PendingTime, parts[2]); err != nil {
+		return nil, err
+	}
+
+	return &Caller{
+		AuthSource: AuthSourceIDToken,
+		Identities: []string{id},
+	}, nil
+}
+
+// checkNonce binds the instance to the nonce the first time it authenticates, or again after it
+// was restarted, and otherwise rejects any other nonce.
+func (a *AWSAuthenticator) checkNonce(instance string, pendingTime time.Time, nonce string) error {
+	sum := sha256.Sum256([]byte(nonce))
+	nonceHash := hex.EncodeToString(sum[:])
+	return a.instances.update(instance, func(r *awsInstanceRecord) (*awsInstanceRecord, error) {
+		now := time.Now()
+		switch {
+		case r == nil || r.expired(now) || pendingTime.After(r.PendingTime):
+			return &awsInstanceRecord{NonceHash: nonceHash, PendingTime: pendingTime, LastSeen: now}, nil
+		case pendingTime.Before(r.PendingTime):
+			return nil, fmt.Errorf("the instance identity document of %s predates the last restart of the instance", instance)
+		case nonceHash != r.NonceHash:
+			return nil, fmt.Errorf("the instance identity document of %s is presented with another nonce than the "+
+				"instance is bound to, it may be replayed", instance)
+		}
+		return &awsInstanceRecord{NonceHash: r.NonceHash, PendingTime: r.PendingTime, LastSeen: now}, nil
+	})
+}
+
+// awsMemoryStore keeps the instance records in memory.
+type awsMemoryStore struct {
+	mu      sync.Mutex
+	records map[string]*awsInstanceRecord
+	// lastPrune is when the expired instance records were last removed.
+	lastPrune time.Time
+}
+
+func (m *awsMemoryStore) update(instance string, bind func(*awsInstanceRecord) (*awsInstanceRecord, error)) error {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if now.Sub(m.lastPrune) > awsInstanceRecordTTL {
+		for k, r := range m.records {
+			if r.expired(now) {
+				delete(m.records, k)
+			}
+		}
+		m.lastPrune = now
+	}
+	r, err := bind(m.records[instance])
+	if err != nil {
+		return err
+	}
+	m.records[instance] = r
+	return nil
+}
+
+// awsConfigMapStore keeps the instance records in the AWSInstancesConfigMap ConfigMap, keyed by the
+// account and instance ID joined by ".". Concurrent updates by other istiod replicas are retried.
+type awsConfigMapStore struct {
+	client    corev1.ConfigMapsGetter
+	namespace string
+}
+
+func (c *awsConfigMapStore) update(instance string, bind func(*awsInstanceRecord) (*awsInstanceRecord, error)) error {
+	key := strings.ReplaceAll(instance, "/", ".")
+	var bindErr error
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		bindErr = nil
+		cm, err := c.client.ConfigMaps(c.namespace).Get(context.TODO(), AWSInstancesConfigMap, metav1.GetOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		create := errors.IsNotFound(err)
+		if create {
+			cm = &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: AWSInstancesConfigMap, Namespace: c.namespace}}
+		}
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+
+		now := time.Now()
+		var current *awsInstanceRecord
+		for k, v := range cm.Data {
+			r := &awsInstanceRecord{}
+			if err := json.Unmarshal([]byte(v), r); err != nil || r.expired(now) {
+				delete(cm.Data, k)
+				continue
+			}
+			if k == key {
+				current = r
+			}
+		}
+		r, err := bind(current)
+		if err != nil {
+			bindErr = err
+			return nil
+		}
+		data, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		cm.Data[key] = string(data)
+		if create {
+			_, err = c.client.ConfigMaps(c.namespace).Create(context.TODO(), cm, metav1.CreateOptions{})
+			if errors.IsAlreadyExists(err) {
+				// Another replica created the configmap, bind against its records.
+				return errors.NewConflict(v1.Resource("configmaps"), AWSInstancesConfigMap, err)
+			}
+		} else {
+			_, err = c.client.ConfigMaps(c.namespace).Update(context.TODO(), cm, metav1.UpdateOptions{})
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update configmap %s/%s: %v", c.namespace, AWSInstancesConfigMap, err)
+	}
+	return bindErr
+}
+
+func (a *AWSAuthenticator) AuthenticatorType() string {
+	return AWSAuthenticatorType
+}
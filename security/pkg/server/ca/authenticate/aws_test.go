@@ -0,0 +1,266 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authenticate
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	"istio.io/istio/security/pkg/credentialfetcher/plugin"
+)
+
+// newAWSSigner returns a key and the PEM encoded certificate standing in for the AWS public
+// certificate of a region.
+func newAWSSigner(t *testing.T) (*rsa.PrivateKey, []byte) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Amazon Web Services LLC"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// newAWSMetadataServer stands in for the EC2 instance metadata service, serving the document
+// signed by key.
+func newAWSMetadataServer(t *testing.T, key *rsa.PrivateKey, doc string) *httptest.Server {
+	digest := sha256.Sum256([]byte(doc))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/latest/api/token":
+			_, _ = w.Write([]byte("session"))
+		case "/latest/dynamic/instance-identity/document":
+			_, _ = w.Write([]byte(doc))
+		case "/latest/dynamic/instance-identity/signature":
+			_, _ = w.Write([]byte(base64.StdEncoding.EncodeToString(sig)))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func bearerContext(token string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.MD{
+		"authorization": []string{"Bearer " + token},
+	})
+}
+
+func TestAWSAuthenticator(t *testing.T) {
+	key, certPEM := newAWSSigner(t)
+	otherKey, _ := newAWSSigner(t)
+	mapping := IdentityMapping{
+		"123456789012":                     "vm/app",
+		"210987654321/i-0123456789abcdef0": "vm/db",
+	}
+	authenticator, err := NewAWSAuthenticator(certPEM, "cluster.local", mapping, nil, "")
+	if err != nil {
+		t.Fatalf("NewAWSAuthenticator() failed: %v", err)
+	}
+
+	testCases := map[string]struct {
+		key         *rsa.PrivateKey
+		doc         string
+		expectedID  string
+		expectedErr string
+	}{
+		"mapped account": {
+			key:        key,
+			doc:        `{"accountId":"123456789012","instanceId":"i-0fedcba9876543210","region":"us-east-1"}`,
+			expectedID: "spiffe://cluster.local/ns/vm/sa/app",
+		},
+		"mapped instance": {
+			key:        key,
+			doc:        `{"accountId":"210987654321","instanceId":"i-0123456789abcdef0","region":"us-east-1"}`,
+			expectedID: "spiffe://cluster.local/ns/vm/sa/db",
+		},
+		"unmapped instance": {
+			key:         key,
+			doc:         `{"accountId":"210987654321","instanceId":"i-0fedcba9876543210","region":"us-east-1"}`,
+			expectedErr: "no identity is mapped",
+		},
+		"untrusted signer": {
+			key:         otherKey,
+			doc:         `{"accountId":"123456789012","instanceId":"i-0fedcba9876543210","region":"us-east-1"}`,
+			expectedErr: "failed to verify the instance identity signature",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			server := newAWSMetadataServer(t, tc.key, tc.doc)
+			defer server.Close()
+			token, err := plugin.CreateAWSPlugin(server.URL, "", "", "AWS").GetPlatformCredential()
+			if err != nil {
+				t.Fatalf("GetPlatformCredential() failed: %v", err)
+			}
+
+			caller, err := authenticator.Authenticate(bearerContext(token))
+			if tc.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+					t.Fatalf("Authenticate() returned error %v, expected %q", err, tc.expectedErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate() failed: %v", err)
+			}
+			expected := &Caller{AuthSource: AuthSourceIDToken, Identities: []string{tc.expectedID}}
+			if !reflect.DeepEqual(caller, expected) {
+				t.Errorf("got caller %v, want %v", caller, expected)
+			}
+		})
+	}
+
+	if _, err := authenticator.Authenticate(bearerContext("a.jwt.token")); err == nil {
+		t.Errorf("Authenticate() succeeded with a JWT")
+	}
+	if _, err := NewAWSAuthenticator([]byte("not a certificate"), "cluster.local", mapping, nil, ""); err == nil {
+		t.Errorf("NewAWSAuthenticator() succeeded without a certificate")
+	}
+}
+
+// awsCredential returns the credential of the test instance, launched at pendingTime, with the nonce
+// of the file. A new nonce is used if the file is empty.
+func awsCredential(t *testing.T, key *rsa.PrivateKey, pendingTime, nonceFile string) string {
+	t.Helper()
+	server := newAWSMetadataServer(t, key, `{"accountId":"123456789012","instanceId":"i-0123456789abcdef0",`+
+		`"region":"us-east-1","pendingTime":"`+pendingTime+`"}`)
+	defer server.Close()
+	token, err := plugin.CreateAWSPlugin(server.URL, nonceFile, "", "AWS").GetPlatformCredential()
+	if err != nil {
+		t.Fatalf("GetPlatformCredential() failed: %v", err)
+	}
+	return token
+}
+
+func TestAWSAuthenticatorReplay(t *testing.T) {
+	key, certPEM := newAWSSigner(t)
+	for name, client := range map[string]corev1.ConfigMapsGetter{
+		"memory":    nil,
+		"configmap": fake.NewSimpleClientset().CoreV1(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			authenticator, err := NewAWSAuthenticator(certPEM, "cluster.local", IdentityMapping{"123456789012": "vm/app"},
+				client, "istio-system")
+			if err != nil {
+				t.Fatalf("NewAWSAuthenticator() failed: %v", err)
+			}
+			nonceFile := filepath.Join(t.TempDir(), "aws-instance-nonce")
+			launched := "2021-01-01T00:00:00Z"
+
+			instance := awsCredential(t, key, launched, nonceFile)
+			if _, err := authenticator.Authenticate(bearerContext(instance)); err != nil {
+				t.Fatalf("Authenticate() failed: %v", err)
+			}
+			// The instance authenticates again, also after a restart of its agent.
+			if _, err := authenticator.Authenticate(bearerContext(awsCredential(t, key, launched, nonceFile))); err != nil {
+				t.Fatalf("Authenticate() failed for the bound nonce: %v", err)
+			}
+			// The document replayed with another nonce is rejected.
+			if _, err := authenticator.Authenticate(bearerContext(awsCredential(t, key, launched, ""))); err == nil ||
+				!strings.Contains(err.Error(), "may be replayed") {
+				t.Fatalf("Authenticate() returned error %v for a replayed document", err)
+			}
+
+			// After a restart of the instance, its new document binds a new nonce.
+			restartedNonceFile := filepath.Join(t.TempDir(), "aws-instance-nonce")
+			restarted := "2021-02-01T00:00:00Z"
+			if _, err := authenticator.Authenticate(bearerContext(awsCredential(t, key, restarted, restartedNonceFile))); err != nil {
+				t.Fatalf("Authenticate() failed after a restart of the instance: %v", err)
+			}
+			if _, err := authenticator.Authenticate(bearerContext(instance)); err == nil ||
+				!strings.Contains(err.Error(), "predates the last restart") {
+				t.Fatalf("Authenticate() returned error %v for the document of the previous run", err)
+			}
+			if _, err := authenticator.Authenticate(bearerContext(awsCredential(t, key, restarted, nonceFile))); err == nil {
+				t.Fatalf("Authenticate() succeeded with the nonce of the previous run")
+			}
+		})
+	}
+}
+
+func TestAWSAuthenticatorSharedBindings(t *testing.T) {
+	key, certPEM := newAWSSigner(t)
+	client := fake.NewSimpleClientset()
+	// Two istiod replicas share the bindings.
+	var replicas []*AWSAuthenticator
+	for i := 0; i < 2; i++ {
+		authenticator, err := NewAWSAuthenticator(certPEM, "cluster.local", IdentityMapping{"123456789012": "vm/app"},
+			client.CoreV1(), "istio-system")
+		if err != nil {
+			t.Fatalf("NewAWSAuthenticator() failed: %v", err)
+		}
+		replicas = append(replicas, authenticator)
+	}
+	nonceFile := filepath.Join(t.TempDir(), "aws-instance-nonce")
+	launched := "2021-01-01T00:00:00Z"
+
+	if _, err := replicas[0].Authenticate(bearerContext(awsCredential(t, key, launched, nonceFile))); err != nil {
+		t.Fatalf("Authenticate() failed: %v", err)
+	}
+	if _, err := replicas[1].Authenticate(bearerContext(awsCredential(t, key, launched, ""))); err == nil ||
+		!strings.Contains(err.Error(), "may be replayed") {
+		t.Fatalf("Authenticate() returned error %v for a document replayed to another replica", err)
+	}
+	if _, err := replicas[1].Authenticate(bearerContext(awsCredential(t, key, launched, nonceFile))); err != nil {
+		t.Fatalf("Authenticate() failed for the bound nonce on another replica: %v", err)
+	}
+
+	// Only the hash of the nonce is stored.
+	nonce, err := ioutil.ReadFile(nonceFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cm, err := client.CoreV1().ConfigMaps("istio-system").Get(context.TODO(), AWSInstancesConfigMap, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, f := cm.Data["123456789012.i-0123456789abcdef0"]
+	if !f || strings.Contains(record, strings.TrimSpace(string(nonce))) {
+		t.Errorf("unexpected instance record %q", record)
+	}
+}
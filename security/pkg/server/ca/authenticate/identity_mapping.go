@@ -0,0 +1,61 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authenticate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// IdentityMapping maps the principals of a platform identity provider, such as an AWS account
+// or an Azure managed identity, to the "namespace/serviceaccount" of their workload identity.
+type IdentityMapping map[string]string
+
+// ParseIdentityMapping parses a comma separated list of "principal=namespace/serviceaccount" entries.
+func ParseIdentityMapping(s string) (IdentityMapping, error) {
+	m := IdentityMapping{}
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		// The principal may contain "=", the service account does not.
+		i := strings.LastIndex(entry, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid identity mapping %q, expected principal=namespace/serviceaccount", entry)
+		}
+		principal, sa := strings.TrimSpace(entry[:i]), strings.TrimSpace(entry[i+1:])
+		parts := strings.Split(sa, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid service account %q for %s, expected namespace/serviceaccount", sa, principal)
+		}
+		m[principal] = sa
+	}
+	if len(m) == 0 {
+		return nil, fmt.Errorf("empty identity mapping")
+	}
+	return m, nil
+}
+
+// identity returns the SPIFFE identity of the first mapped principal.
+func (m IdentityMapping) identity(trustDomain string, principals ...string) (string, error) {
+	for _, p := range principals {
+		if sa, ok := m[p]; ok {
+			parts := strings.Split(sa, "/")
+			return fmt.Sprintf(identityTemplate, trustDomain, parts[0], parts[1]), nil
+		}
+	}
+	return "", fmt.Errorf("no identity is mapped to %s", strings.Join(principals, " or "))
+}
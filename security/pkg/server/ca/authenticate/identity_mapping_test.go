@@ -0,0 +1,66 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authenticate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseIdentityMapping(t *testing.T) {
+	testCases := map[string]struct {
+		mapping     string
+		expected    IdentityMapping
+		expectedErr bool
+	}{
+		"valid mapping": {
+			mapping: "123456789012=vm/app, 210987654321/i-0123=vm/db,a=b=ns/sa",
+			expected: IdentityMapping{
+				"123456789012":        "vm/app",
+				"210987654321/i-0123": "vm/db",
+				"a=b":                 "ns/sa",
+			},
+		},
+		"missing principal": {
+			mapping:     "=vm/app",
+			expectedErr: true,
+		},
+		"invalid service account": {
+			mapping:     "123456789012=app",
+			expectedErr: true,
+		},
+		"empty mapping": {
+			mapping:     " , ",
+			expectedErr: true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			m, err := ParseIdentityMapping(tc.mapping)
+			if tc.expectedErr {
+				if err == nil {
+					t.Fatalf("ParseIdentityMapping(%q) succeeded, expected an error", tc.mapping)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseIdentityMapping(%q) failed: %v", tc.mapping, err)
+			}
+			if !reflect.DeepEqual(m, tc.expected) {
+				t.Errorf("got %v, want %v", m, tc.expected)
+			}
+		})
+	}
+}
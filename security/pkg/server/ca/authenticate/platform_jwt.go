@@ -0,0 +1,111 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authenticate
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/coreos/go-oidc"
+)
+
+const (
+	OIDCAuthenticatorType  = "OIDCAuthenticator"
+	AzureAuthenticatorType = "AzureManagedIdentityAuthenticator"
+
+	// azurePrincipalClaim is the object ID of the managed identity in its access tokens.
+	azurePrincipalClaim = "oid"
+)
+
+// PlatformJwtAuthenticator authenticates the JWTs of a platform identity provider, such as an
+// Azure tenant or an OIDC issuer of VM workloads, and maps the principal claim of the token to
+// the workload identity.
+// Unlike JwtAuthenticator, the principals are not Kubernetes service accounts.
+type PlatformJwtAuthenticator struct {
+	authType    string
+	claim       string
+	verifier    *oidc.IDTokenVerifier
+	trustDomain string
+	mapping     IdentityMapping
+}
+
+var _ Authenticator = &PlatformJwtAuthenticator{}
+
+// NewOIDCAuthenticator creates an authenticator for the tokens sent by the OIDC credential
+// fetcher of the istio agent, mapping their "sub" claim to the workload identity.
+func NewOIDCAuthenticator(iss, audience, trustDomain string, mapping IdentityMapping) (*PlatformJwtAuthenticator, error) {
+	return newPlatformJwtAuthenticator(OIDCAuthenticatorType, "sub", iss, audience, trustDomain, mapping)
+}
+
+// NewAzureAuthenticator creates an authenticator for the managed identity tokens sent by the Azure
+// credential fetcher of the istio agent, mapping the object ID of the managed identity to the
+// workload identity. The issuer is "https://sts.windows.net/<tenant ID>/" and the audience is
+// the resource requested by the agent.
+func NewAzureAuthenticator(iss, audience, trustDomain string, mapping IdentityMapping) (*PlatformJwtAuthenticator, error) {
+	return newPlatformJwtAuthenticator(AzureAuthenticatorType, azurePrincipalClaim, iss, audience, trustDomain, mapping)
+}
+
+func newPlatformJwtAuthenticator(authType, claim, iss, audience, trustDomain string,
+	mapping IdentityMapping) (*PlatformJwtAuthenticator, error) {
+	if audience == "" {
+		return nil, fmt.Errorf("the audience of the %s tokens is not set", iss)
+	}
+	provider, err := oidc.NewProvider(context.Background(), iss)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize OIDC provider %s: %v", iss, err)
+	}
+	return &PlatformJwtAuthenticator{
+		authType:    authType,
+		claim:       claim,
+		verifier:    provider.Verifier(&oidc.Config{ClientID: audience}),
+		trustDomain: trustDomain,
+		mapping:     mapping,
+	}, nil
+}
+
+// Authenticate verifies the bearer token and maps its principal claim to the caller identity.
+func (j *PlatformJwtAuthenticator) Authenticate(ctx context.Context) (*Caller, error) {
+	bearerToken, err := extractBearerToken(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ID token extraction error: %v", err)
+	}
+
+	idToken, err := j.verifier.Verify(context.Background(), bearerToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify the ID token (error %v)", err)
+	}
+
+	claims := map[string]interface{}{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("failed to extract claims from ID token: %v", err)
+	}
+	principal, _ := claims[j.claim].(string)
+	if principal == "" {
+		return nil, fmt.Errorf("the ID token has no %s claim", j.claim)
+	}
+	id, err := j.mapping.identity(j.trustDomain, principal)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Caller{
+		AuthSource: AuthSourceIDToken,
+		Identities: []string{id},
+	}, nil
+}
+
+func (j *PlatformJwtAuthenticator) AuthenticatorType() string {
+	return j.authType
+}
@@ -0,0 +1,172 @@
+// Copyright Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authenticate
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+
+	"istio.io/istio/security/pkg/credentialfetcher/plugin"
+)
+
+// testIssuer stands in for an OIDC issuer, serving its discovery document and keys.
+type testIssuer struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss := &testIssuer{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   iss.URL,
+			"jwks_uri": iss.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &key.PublicKey, KeyID: "test", Algorithm: string(jose.RS256), Use: "sig"},
+		}})
+	})
+	iss.Server = httptest.NewServer(mux)
+	return iss
+}
+
+func (i *testIssuer) token(t *testing.T, claims map[string]interface{}) string {
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: i.key},
+		(&jose.SignerOptions{}).WithHeader("kid", "test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	std := jwt.Claims{
+		Issuer: i.URL,
+		Expiry: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}
+	token, err := jwt.Signed(signer).Claims(std).Claims(claims).CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestOIDCAuthenticator(t *testing.T) {
+	iss := newTestIssuer(t)
+	defer iss.Close()
+	authenticator, err := NewOIDCAuthenticator(iss.URL, "istio-ca", "cluster.local",
+		IdentityMapping{"vm-1": "vm/app"})
+	if err != nil {
+		t.Fatalf("NewOIDCAuthenticator() failed: %v", err)
+	}
+	if authenticator.AuthenticatorType() != OIDCAuthenticatorType {
+		t.Errorf("unexpected authenticator type %s", authenticator.AuthenticatorType())
+	}
+
+	testCases := map[string]struct {
+		claims      map[string]interface{}
+		expectedID  string
+		expectedErr string
+	}{
+		"mapped subject": {
+			claims:     map[string]interface{}{"sub": "vm-1", "aud": "istio-ca"},
+			expectedID: "spiffe://cluster.local/ns/vm/sa/app",
+		},
+		"unmapped subject": {
+			claims:      map[string]interface{}{"sub": "vm-2", "aud": "istio-ca"},
+			expectedErr: "no identity is mapped",
+		},
+		"wrong audience": {
+			claims:      map[string]interface{}{"sub": "vm-1", "aud": "other"},
+			expectedErr: "failed to verify the ID token",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			caller, err := authenticator.Authenticate(bearerContext(iss.token(t, tc.claims)))
+			if tc.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+					t.Fatalf("Authenticate() returned error %v, expected %q", err, tc.expectedErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate() failed: %v", err)
+			}
+			expected := &Caller{AuthSource: AuthSourceIDToken, Identities: []string{tc.expectedID}}
+			if !reflect.DeepEqual(caller, expected) {
+				t.Errorf("got caller %v, want %v", caller, expected)
+			}
+		})
+	}
+}
+
+func TestAzureAuthenticator(t *testing.T) {
+	iss := newTestIssuer(t)
+	defer iss.Close()
+	// The instance metadata service stand-in issues managed identity tokens for the requested resource.
+	imds := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := iss.token(t, map[string]interface{}{
+			"oid": "00000000-0000-0000-0000-00000000000" + r.URL.Query().Get("client_id"),
+			"aud": r.URL.Query().Get("resource"),
+		})
+		_ = json.NewEncoder(w).Encode(map[string]string{"access_token": token})
+	}))
+	defer imds.Close()
+
+	authenticator, err := NewAzureAuthenticator(iss.URL, "api://istio", "cluster.local",
+		IdentityMapping{"00000000-0000-0000-0000-000000000001": "vm/app"})
+	if err != nil {
+		t.Fatalf("NewAzureAuthenticator() failed: %v", err)
+	}
+
+	token, err := plugin.CreateAzurePlugin(imds.URL, "api://istio", "1", "", "Azure").GetPlatformCredential()
+	if err != nil {
+		t.Fatalf("GetPlatformCredential() failed: %v", err)
+	}
+	caller, err := authenticator.Authenticate(bearerContext(token))
+	if err != nil {
+		t.Fatalf("Authenticate() failed: %v", err)
+	}
+	if want := "spiffe://cluster.local/ns/vm/sa/app"; !reflect.DeepEqual(caller.Identities, []string{want}) {
+		t.Errorf("got identities %v, want %s", caller.Identities, want)
+	}
+
+	for name, p := range map[string]*plugin.AzurePlugin{
+		"unmapped identity": plugin.CreateAzurePlugin(imds.URL, "api://istio", "2", "", "Azure"),
+		"other resource":    plugin.CreateAzurePlugin(imds.URL, "api://other", "1", "", "Azure"),
+	} {
+		token, err := p.GetPlatformCredential()
+		if err != nil {
+			t.Fatalf("%s: GetPlatformCredential() failed: %v", name, err)
+		}
+		if _, err := authenticator.Authenticate(bearerContext(token)); err == nil {
+			t.Errorf("%s: Authenticate() succeeded, expected an error", name)
+		}
+	}
+}